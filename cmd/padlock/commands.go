@@ -0,0 +1,122 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// command is a padlock subcommand. Its handler receives the arguments following the command
+// name, and parses them with a flag set from newFlagSet and parseArgs.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+// commands lists the subcommands in the order they are shown in the usage text. A new
+// subcommand only needs an entry here and a handler. It is filled in by init because the
+// handlers refer back to it through usage.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"encode", "Split input data into N collections with K-of-N threshold security", handleEncode},
+		{"decode", "Reconstruct original data from K or more collections", handleDecode},
+		{"repair", "Regenerate a lost collection from the surviving collections", handleRepair},
+		{"reshare", "Re-encode K or more collections with new -copies and -required, without writing the data to disk", handleReshare},
+		{"verify", "Check the integrity of collections without decoding them", handleVerify},
+		{"info", "Report the name, K and N, format, size, and compression of collections", handleInfo},
+		{"inspect", "Print the header, size, CRC status, and a hex preview of a single chunk file", handleInspect},
+		{"custodians", "Print the custodian plan from a catalog or from collection metadata", handleCustodians},
+		{"snapshots", "List the encodes recorded in a snapshot log, and restore one of them", handleSnapshots},
+		{"plan", "Recommend -copies, -required, and -format for a redundancy target and storage budget", handlePlan},
+		{"clean", "Remove temporary directories left behind by interrupted runs", handleClean},
+		{"scatter", "Deliver encoded collections one per destination from a destinations file", handleScatter},
+		{"gather", "Fetch K or more collections back from their destinations for decode", handleGather},
+	}
+}
+
+// findCommand returns the subcommand with the given name
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// printCommands writes the Commands section of the usage text
+func printCommands(w io.Writer) {
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-17s %s\n", c.name, c.summary)
+	}
+}
+
+// newFlagSet creates the flag set for a subcommand, which prints the usage text and exits
+// when the arguments can't be parsed
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = usage
+	return fs
+}
+
+// parseArgs parses args with fs, allowing flags before, between, and after the positional
+// arguments, so that "encode -copies 3 in out" and "encode in out -copies 3" are the same.
+// It returns the positional arguments in order. Arguments following "--" are always
+// positional, for directory names that begin with "-".
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		rest := fs.Args()
+
+		// The flag package stops at "--" and consumes it
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" && !isFlagValue(fs, args[:consumed-1]) {
+			return append(positional, rest...)
+		}
+		if len(rest) == 0 {
+			return positional
+		}
+
+		// The flag package stops at the first positional argument; take it and continue
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// isFlagValue reports whether the argument following args is the value of the last flag in
+// args, as in "-labels --", rather than an argument of its own
+func isFlagValue(fs *flag.FlagSet, args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	last := args[len(args)-1]
+	if !strings.HasPrefix(last, "-") || strings.Contains(last, "=") || last == "--" {
+		return false
+	}
+	f := fs.Lookup(strings.TrimLeft(last, "-"))
+	if f == nil {
+		return false
+	}
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return false
+	}
+	return true
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	c, ok := findCommand(os.Args[1])
+	if !ok {
+		usage()
+	}
+	c.run(os.Args[2:])
+}
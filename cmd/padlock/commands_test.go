@@ -0,0 +1,55 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		copies     int
+		labels     string
+		clear      bool
+	}{
+		{[]string{"in", "out", "-copies", "3"}, []string{"in", "out"}, 3, "", false},
+		{[]string{"-copies", "3", "in", "out"}, []string{"in", "out"}, 3, "", false},
+		{[]string{"in", "-copies=3", "out", "-clear"}, []string{"in", "out"}, 3, "", true},
+		{[]string{"-clear", "in", "out1", "out2", "out3"}, []string{"in", "out1", "out2", "out3"}, 2, "", true},
+		{[]string{"in", "--", "-out", "-clear"}, []string{"in", "-out", "-clear"}, 2, "", false},
+		{[]string{"-labels", "--", "in", "out"}, []string{"in", "out"}, 2, "--", false},
+		{[]string{"in"}, []string{"in"}, 2, "", false},
+		{nil, nil, 2, "", false},
+	}
+
+	for _, tt := range tests {
+		fs := newFlagSet("test")
+		copies := fs.Int("copies", 2, "")
+		labels := fs.String("labels", "", "")
+		clear := fs.Bool("clear", false, "")
+
+		positional := parseArgs(fs, tt.args)
+		if !slices.Equal(positional, tt.positional) {
+			t.Errorf("%q: expected arguments %q, got %q", tt.args, tt.positional, positional)
+		}
+		if *copies != tt.copies || *labels != tt.labels || *clear != tt.clear {
+			t.Errorf("%q: unexpected flags -copies %d -labels %q -clear %v", tt.args, *copies, *labels, *clear)
+		}
+	}
+}
+
+func TestIsSet(t *testing.T) {
+	fs := newFlagSet("test")
+	fs.Int("copies", 2, "")
+	fs.Int("required", 2, "")
+	parseArgs(fs, []string{"in", "-copies", "2"})
+	if !isSet(fs, "copies") {
+		t.Errorf("Expected -copies to be set, even to its default")
+	}
+	if isSet(fs, "required") {
+		t.Errorf("Expected -required not to be set")
+	}
+}
@@ -4,163 +4,359 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"strconv"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/blues/padlock/pkg/file"
 	"github.com/blues/padlock/pkg/pad"
 	"github.com/blues/padlock/pkg/padlock"
 	"github.com/blues/padlock/pkg/trace"
+	"golang.org/x/term"
 )
 
 // usage prints the command-line help information and exits.
 func usage() {
 	fmt.Fprintf(os.Stderr, `Usage:
-  padlock encode <inputDir> <outputDir> [-copies N] [-required REQUIRED] [-format bin|png] [-clear] [-chunk SIZE] [-verbose] [-files]
-  padlock encode <inputDir> <outputDir1> <outputDir2> ... <outputDirN> [-required REQUIRED] [-format bin|png] [-clear] [-chunk SIZE] [-verbose] [-files]
-  padlock encode <inputDir> <outputDir> [-copies N] [-required REQUIRED] [-format bin|png] [-chunk SIZE] [-verbose] [-dryrun]
-  padlock encode <inputDir> [-copies N] [-required REQUIRED] [-format bin|png] [-chunk SIZE] [-verbose] [-dryrun]
+  padlock encode <inputDir> <outputDir> [-copies N] [-required REQUIRED] [-format bin|png|txt|wav] [-clear] [-chunk SIZE] [-verbose] [-files] [-archive tar|zip] [-volume-size SIZE] [-sha256] [-parity PCT] [-par2 PCT] [-cover DIR | -generated-covers] [-embed chunk|lsb] [-keep-partial] [-no-space-check]
+  padlock encode <inputDir1> <inputDir2> ... <inputDirN> -out <outputDir> [-out <outputDir2> ...] [-copies N] [-required REQUIRED] [-verbose]
+  padlock encode <inputDir> <outputDir> [-exclude PATTERN]... [-include PATTERN]... [-ignore-file FILE] [-copies N] [-required REQUIRED] [-verbose]
+  padlock encode <inputDir> <outputDir> -files -resume [-copies N] [-required REQUIRED] [-format bin|png|txt|wav] [-chunk SIZE] [-verbose]
+  padlock encode <inputDir> <outputDir1> <outputDir2> ... <outputDirN> [-required REQUIRED] [-format bin|png|txt|wav] [-clear] [-chunk SIZE] [-verbose] [-files] [-archive tar|zip] [-sha256]
+  padlock encode <inputDir> <outputDir> [-copies N] [-required REQUIRED] [-format bin|png|txt|wav] [-chunk SIZE] [-verbose] [-dryrun]
+  padlock encode <inputDir> [-copies N] [-required REQUIRED] [-format bin|png|txt|wav] [-chunk SIZE] [-verbose] [-dryrun]
+  padlock encode <inputDir> -dryrun -matrix 2of3,3of5,4of7 [-chunk SIZE] [-json]
   padlock decode <inputDir> <outputDir> [-clear] [-verbose]
-  padlock decode <inputDir1> <inputDir2> ... <inputDirN> <outputDir> [-clear] [-verbose]
+  padlock decode <collection.tar> ... <chunkFile> ... <outputDir> [-clear] [-verbose]
+  padlock decode -from <listFile> <outputDir> [-clear] [-verbose]
+  padlock decode <inputDir1> <inputDir2> ... <inputDirN> <outputDir> [-clear | -resume] [-keep-partial] [-salvage] [-depth N] [-no-space-check] [-verbose]
   padlock decode <inputDir1> <inputDir2> ... <inputDirN> <outputDir> [-verbose] [-dryrun]
+  <command> | padlock encode - <outputDir> [-name NAME] [-copies N] [-required REQUIRED] [-verbose]
+  padlock decode <inputDir1> <inputDir2> ... <inputDirN> - [-verbose] > <file>
+  padlock decode <inputDir1> <inputDir2> ... <inputDirN> -tar <file.tar>|- [-compressed] [-verbose]
+  padlock encode <inputDir> <outputDir> -index [-copies N] [-required REQUIRED] [-verbose]
+  padlock encode <inputDir> <outputDir1> ... <outputDirN> -append [-verbose]
+  padlock encode <inputDir> <outputDir> -dedup [-copies N] [-required REQUIRED] [-verbose]
+  padlock encode <inputDir> <outputDir1> ... <outputDirN> -weights W1,...,WN [-required REQUIRED] [-verbose]
+  padlock encode <inputDir> <outputDir1> ... <outputDirN> -format F1,...,FN [-required REQUIRED] [-verbose]
+  padlock decode <inputDir1> <inputDir2> ... <inputDirN> <outputDir> -include PATTERN... [-exclude PATTERN]... [-verbose]
+  padlock encode <inputDir> -stdout [-copies N] [-required REQUIRED] [-chunk SIZE] [-verbose] | <transport>
+  <transport> | padlock decode <outputDir> -stdin [-clear] [-verbose]
   padlock decode <inputDir1> <inputDir2> ... <inputDirN> [-verbose] [-dryrun]
+  padlock encode <inputDir> <outputDir> -snapshots <snapshotsFile> [-snapshot-label LABEL] [-copies N] [-required REQUIRED] [-verbose]
+  padlock snapshots <snapshotsFile> [-select latest|ID|LABEL|SESSION [-restore <outputDir> [-clear]]] [-verbose]
+  padlock custodians <catalogFile> [-catalog-key FILE]
+  padlock custodians <inputDir1> ... <inputDirN> [-metadata-key FILE] [-verbose]
+  padlock repair <inputDir1> ... <inputDirN> <outputDir> [-collection NAME] [-format bin|png|txt|wav] [-files] [-archive tar|zip] [-clear] [-verbose]
+  padlock reshare <inputDir1> ... <inputDirN> <outputDir> -copies N -required REQUIRED [-format bin|png|txt|wav] [-files] [-archive tar|zip] [-clear] [-chunk SIZE] [-verbose]
+  padlock verify <inputDir1> ... <inputDirN> [-verbose] [-retries N] [-timeout D]
+  padlock info <inputDir1> ... <inputDirN> [-metadata-key FILE] [-verbose]
+  padlock inspect <chunkFile> [-bytes N] [-verbose]
+  padlock plan <inputDir> -survive LOST [-custodians N] [-budget SIZE] [-chunk SIZE]
+  padlock clean [<tempDir1> ... <tempDirN>] [-dryrun] [-older-than D] [-verbose]
+  padlock scatter <collectionsDir> -destinations FILE [-verbose] [-timeout D]
+  padlock gather <outputDir> -destinations FILE [-all] [-metadata-key FILE] [-verbose] [-timeout D]
 
 Commands:
-  encode            Split input data into N collections with K-of-N threshold security
-  decode            Reconstruct original data from K or more collections
-
+`)
+	printCommands(os.Stderr)
+	fmt.Fprintf(os.Stderr, `
 Parameters:
-  <inputDir>        Source directory containing data to encode or collections to decode
+  <inputDir>        Source directory containing data to encode or collections to decode; encode also accepts
+                    a single file, which decode restores as that file in <outputDir>
   <outputDir>       Destination directory for encoded collections or decoded data
   <outputDir1>..N>  Individual destination directories for each collection (number of dirs = number of copies)
+                    Each may be a local path or a URL: file:///path, s3://bucket/prefix, sftp://[user@]host/path,
+                    webdavs://[user@]host/path (webdav:// for plain HTTP)
+  -                 For encode: read the data to encode from stdin, as in pg_dump | padlock encode - <outputDir>
+                    For decode: write the stream encoded from stdin to stdout, in place of <outputDir>
   <inputDir1>..N>   For decode: collection directories to process (last argument is output directory)
+                    Each may also be an s3, sftp, or WebDAV URL, which is downloaded before decoding
 
-Options:
+Options (may be given before, between, or after the arguments; use -- before an argument starting with "-"):
   -copies N         Number of collections to create (must be between 2 and 26, default: 2)
                     Not needed if multiple output directories are provided (count is inferred)
   -required REQUIRED  Minimum collections required for reconstruction (default: 2)
-  -format FORMAT    Output format: bin or png (default: png)
+  -format FORMAT    Output format: bin, png, txt, or wav (default: png). txt writes base64 text for email or print,
+                    wav hides chunks in audio files. Encode: a list such as png,bin,png gives each collection, or
+                    each output directory with -weights, a format of its own
+  -scheme SCHEME    Encode and reshare: secret sharing scheme, otp (default) or shamir. Shamir collections are each
+                    about the size of the input whatever K and N are; otp collections grow with the permutations
+  -mandatory L1,L2  Encode and reshare with -scheme shamir: letters of collections that must be among any K that
+                    reconstruct the data, e.g. A, giving their holders a veto; mandatory collections can't be repaired
   -clear            Clear output directories if not empty
-  -chunk SIZE       Maximum candidate block size in bytes (default: 2MB)
+  -chunk SIZE       Maximum candidate block size in bytes (default: 2MB); encode also accepts auto
+  -chunks MIN-MAX   Encode: with -chunk auto, the number of chunks per collection to aim for (default: 16-1024)
   -verbose          Enable detailed debug output
   -files            Create individual files for each collection instead of tar archives (default: creates tar archives)
+  -resume           Encode with -files: continue an encode that died part way through from the last chunk written to
+                    every collection; give the same input, output, -copies, -required, -format and -chunk
+                    Decode: skip rewriting the files an interrupted decode to <outputDir> already restored
+  -out DIR          Encode: write the collections to DIR, making every argument an input directory; the inputs are
+                    encoded together, each under a top-level directory named after it. Repeat for one directory
+                    per collection
+  -exclude PATTERN  Encode: leave out the entries matching a .gitignore-style pattern, e.g. node_modules/, *.tmp,
+                    or /build; may be repeated, and a pattern starting with ! re-includes what an earlier one excluded
+  -include PATTERN  Encode: encode only the entries matching a .gitignore-style pattern, with what is in the
+                    directories it matches; may be repeated, and -exclude still leaves entries out
+  -ignore-file FILE Encode: read -exclude patterns from FILE, one per line as in a .gitignore file
+                    Decode: -exclude and -include restore only the entries they select, in the same way
+  -index            Encode: compress the data in blocks and end it with an index of the chunks holding each file,
+                    so that decode -include reads and decodes only the chunks of the files it restores
+  -append           Encode: add the input to the collections already in <outputDir>, as further chunks numbered on
+                    from theirs, with their scheme, format, and chunk size; decode restores every encode in turn,
+                    later files replacing earlier ones of the same name. A failed append leaves them as they were
+  -dedup            Encode: store each distinct block of the input once, before it is compressed, so repeated
+                    files and data take up the space of one copy; decode spools the distinct blocks to -tmpdir
+  -weights LIST     Encode: give each output directory as many collections as its weight, such as 1,2,2, or in
+                    proportion to its capacity, such as 16G,64G,64G; -required then counts output directories,
+                    any that many of which restore the data; the data is split with -scheme shamir, and
+                    -scheme otp is refused
+  -name NAME        Encode with input -: the name of the file decode restores the stream read from stdin to
+                    (default: stdin); decode with output - writes the stream to stdout instead
+  -keep-partial     Keep the partial output of an encode or decode that fails, for example to -resume it later;
+                    by default it is rolled back, and each collection or file removed is reported
+  -no-space-check   Start an encode or decode even if its output is estimated not to fit in the free space
+                    of the output directories; by default it is refused before anything is written
+  -salvage          Decode: if part of the data can't be decoded, keep the files restored before it and the file
+                    it cut short, as <name>.partial, and report them, instead of rolling them back
+  -depth N          Decode: also search N levels of subdirectories of each input directory for collections,
+                    such as collections kept in nested folders, on mounted drives, or in synced cloud folders
+  -tar FILE         Decode: write the decoded TAR to FILE, or to stdout with -, instead of extracting it, making
+                    every argument an input directory; it ends with .padlock-hashes.json, the SHA-256 of each file
+  -compressed       Decode with -tar: leave the TAR compressed as it was encoded, e.g. as a .tar.gz
+  -from FILE        Decode: read the collection locations from FILE, one local path or URL per line, ahead of
+                    any given as arguments; relative paths are taken relative to FILE, and lines starting with # are skipped
+  -archive FORMAT   Archive format for collections: tar or zip (default: tar). ZIP archives are store-only
+                    and open with the built-in tools on Windows and macOS
+  -volume-size SIZE Split each collection archive into numbered volumes of at most SIZE, e.g. 4.7GB for a DVD,
+                    25GB for a Blu-ray, or 4GiB for FAT32; decode reassembles them using <collection>.volumes.json
   -dryrun           Calculate and display size information without actually writing output files
+  -compression C    Encode: auto, none, gzip[:LEVEL] (levels 1-9), or zstd[:LEVEL] (levels 1-22) (default: auto,
+                    which uses gzip unless a sample of the input shows it is already compressed)
+                    Decode detects the compression from the data
+  -level L          Encode: compression level, as a number, fast, best, or default; recorded in collection metadata
+  -matrix S1,S2,..  With -dryrun, compare per-collection and total storage for several KofN schemes
+  -json             Encode and decode: write the result (sizes, collections, chunks, timing, error) to stdout as JSON
+                    instead of log lines; with -dryrun -matrix, write the comparison as JSON
+  -sha256           With -files, write a <chunk>.sha256 sidecar for each chunk (verified on decode)
+  -parity PCT       With -files, write a <chunk>.parity sidecar of Reed-Solomon parity, PCT%% of the chunk's size
+                    (e.g. 5), from which decode, verify, and repair transparently correct small corruptions
+  -par2 PCT         Write standard PAR2 recovery files with PCT%% redundancy for each collection (e.g. 10), so
+                    custodians can verify and repair media errors with any PAR2 tool; verify checks them
+  -units UNITS      Units for reported sizes: bytes, iec (KiB, MiB), or si (kB, MB) (default: bytes)
+  -precision N      Decimal places for iec and si sizes (default: 1)
+  -retries N        Retry chunk file writes/reads up to N times on transient IO errors (default: 0)
+  -retry-delay D    Initial delay between retries, doubled after each attempt (default: 500ms)
+  -pipe-buffer SIZE Bytes buffered between pipeline stages, e.g. 4M (default: 0, unbuffered)
+  -max-memory SIZE  Keep estimated memory use below SIZE, e.g. 512M; encode reduces -chunk to fit
+  -threads N        Encode: write the chunks of up to N collections at once (default: 1)
+  -prefetch N       Decode: read up to N chunks ahead from every collection in parallel (default: 1)
+  -prefetch-dir DIR Decode: cache prefetched chunks in files under DIR instead of in memory
+  -tmpdir DIR       Create temporary files, such as extracted TAR collections, staged remote collections and
+                    spooled -stdin frames, under DIR instead of the system temp directory (default: $TMPDIR or /tmp)
+  -spool SIZE       Hold data kept for later, such as each archive entry, in memory up to SIZE and spool
+                    anything larger to a temporary file (default: 8M)
+  -timeout D        Abort encode or decode if it takes longer than D, e.g. 90m (default: no limit)
+  -catalog FILE     Write a catalog listing every collection, its destination, size and fingerprint
+  -catalog-key FILE Sign the catalog with an HMAC using the key stored in FILE
+  -labels L1,L2,..  Label for each collection, recorded in its metadata and in the catalog
+  -label L          Label of the next collection, which may contain commas (repeat once per collection)
+  -snapshots FILE   Encode: record the encode, its inputs, and where its collections are in the snapshot log in FILE
+  -snapshot-label L Encode: label of the encode in the snapshot log
+  -select REF       Snapshots: show the snapshot with this ID, label, or session, or the latest
+  -restore DIR      Snapshots: decode the selected snapshot to DIR from its collections still on local disk
+  -custodian C      Custodian of the next collection, as "Name" or "Name <contact>" (repeat once per collection)
+  -note TEXT        Notes about the next collection, such as where it is kept (repeat once per collection)
+  -review-by DATE   Date (YYYY-MM-DD) or period from now (90d, 12w, 18m, 2y) by which shares should be reviewed
+  -stealth          Store collections under random names (e.g. share-9f2c41d7) that don't reveal K and N
+  -recovery-notes   Encode: store a RECOVERY.txt in each collection saying what it is, how many others are needed,
+                    who holds them, and the decode command that restores the data
+  -cover DIR        Encode: use the PNG or JPEG photos in DIR, in turn, as the visible images of PNG chunks
+  -generated-covers Encode: show a generated gradient image, sized to the chunk, in each PNG chunk
+  -embed MODE       Encode: hide PNG chunk data in a custom chunk (chunk, default) or in the pixels (lsb)
+  -metadata-key FILE  Encrypt collection metadata with the passphrase in FILE (also accepted by decode, verify, repair, gather, and custodians);
+                    only sealed metadata records the SHA-256 of the encoded stream, which decode checks the rebuilt stream against,
+                    since in the clear it would let the holder of one collection test guesses of the data
+  -mac-key FILE     Authenticate every chunk with an HMAC keyed from the passphrase in FILE, stored in padlock.mac in each
+                    collection; decode, verify, and repair given the same FILE reject chunks that were modified or removed
+  -passphrase       Prompt, without echo, for a passphrase whose Argon2id-derived keystream masks the data before it is
+                    split, so that decoding needs the passphrase as well as K collections (also accepted by decode)
+  -passphrase-file FILE  Like -passphrase, but read the passphrase from FILE
+  -envelope-key FILE  Encrypt the data with AES-256-GCM under a key derived from FILE before it is split, recording the
+                    nonce and KDF parameters in the collection metadata; decode needs the same FILE
+  -pad-to SIZE      Encode: pad the compressed data with random bytes to SIZE (e.g. 4G), to the next power of two
+                    (pow2), or to the next multiple of a size (bucket:SIZE), so the collections don't reveal its size
+  -hidden DIR       Encode: hide DIR as a second payload in the -pad-to padding, which decodes only with -hidden-key
+  -hidden-key FILE  Secret the hidden volume is keyed from; decode given it restores the hidden volume instead
+  -stdout           Encode: write each chunk to stdout as a length-prefixed framed record
+  -stdin            Decode: read framed records from stdin; the only argument is the output directory
+  -survive LOST     Plan: number of collections that may be lost while the data stays recoverable
+  -custodians N     Plan: number of custodians available to hold a collection each (default: no limit)
+  -budget SIZE      Plan: storage available for all collections together, e.g. 20G (default: no limit)
+  -collection NAME  Repair: name of the collection to regenerate, e.g. 2B3 (default: the one that is missing)
+  -bytes N          Inspect: number of bytes of cipher data to show as a hex preview (default: 64)
+  -older-than D     Clean: only remove leftovers not modified for D, so running operations are unaffected (default: 1h)
+  -destinations FILE  Scatter and gather: file listing one local path or URL per line, one per collection
+  -all              Gather: fetch from every destination, rather than stopping once enough collections are gathered
 `)
 	os.Exit(1)
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		usage()
-	}
-
-	cmd := os.Args[1]
-
-	switch cmd {
-	case "encode":
-		handleEncode()
-	case "decode":
-		handleDecode()
-	default:
-		usage()
-	}
-}
-
 // handleEncode handles the encode command
-func handleEncode() {
-	if len(os.Args) < 3 {
-		usage()
-	}
-
-	inputDir := os.Args[2]
-	
-	// Parse flags
-	fs := flag.NewFlagSet("encode", flag.ExitOnError)
+func handleEncode(args []string) {
+	fs := newFlagSet("encode")
 	nVal := fs.Int("copies", 2, "number of collections (must be between 2 and 26)")
 	reqVal := fs.Int("required", 2, "minimum collections required for reconstruction")
-	formatVal := fs.String("format", "png", "bin or png (default: png)")
+	formatVal := fs.String("format", "png", "bin, png, txt, or wav, or one for each collection such as png,bin,png (default: png)")
+	schemeVal := fs.String("scheme", "otp", "secret sharing scheme: otp or shamir")
+	mandatoryVal := fs.String("mandatory", "", "with -scheme shamir, letters of the collections every reconstruction needs, e.g. A")
 	clearVal := fs.Bool("clear", false, "clear output directory if not empty")
-	chunkVal := fs.Int("chunk", 2*1024*1024, "maximum candidate block size in bytes (default: 2MB)")
+	chunkVal := fs.String("chunk", "2M", "maximum candidate block size (e.g. 4M), or auto to choose it from the input size")
+	chunksVal := fs.String("chunks", padlock.DefaultChunkCount.String(), "with -chunk auto, the range of chunks per collection to aim for")
 	verboseVal := fs.Bool("verbose", false, "enable detailed debug output (includes all trace information)")
 	filesVal := fs.Bool("files", false, "create individual files for each collection instead of tar archives")
+	resumeVal := fs.Bool("resume", false, "continue an encode that died part way through (files mode only)")
+	keepPartialVal := fs.Bool("keep-partial", false, "keep the partial output of a failed encode instead of rolling it back")
+	noSpaceCheckVal := fs.Bool("no-space-check", false, "don't check that the output directories have room for the collections")
+	archiveVal := fs.String("archive", "tar", "archive format for collections: tar or zip")
+	volumeSizeVal := fs.String("volume-size", "", "split each collection into volumes of at most this size (e.g. 4.7GB)")
 	dryrunVal := fs.Bool("dryrun", false, "calculate and display size information without actually writing output files")
+	sha256Val := fs.Bool("sha256", false, "write a .sha256 sidecar file for each chunk (files mode only)")
+	parityVal := fs.Int("parity", 0, "write a Reed-Solomon .parity sidecar with this percentage overhead for each chunk (files mode only)")
+	par2Val := fs.Int("par2", 0, "write PAR2 recovery files with this percentage redundancy for each collection")
+	unitsVal := fs.String("units", "bytes", "units for reported sizes: bytes, iec, or si")
+	precisionVal := fs.Int("precision", 1, "decimal places for iec and si sizes")
+	tmpdirVal := fs.String("tmpdir", "", "directory for temporary files, such as extracted TAR collections (default: the system's)")
+	spoolVal := fs.String("spool", "8M", "size above which data held for later is spooled to a temporary file instead of memory")
+	retriesVal := fs.Int("retries", 0, "number of retries for transient IO errors")
+	retryDelayVal := fs.Duration("retry-delay", 500*time.Millisecond, "initial delay between retries")
+	pipeBufferVal := fs.String("pipe-buffer", "0", "bytes buffered between pipeline stages (e.g. 4M)")
+	maxMemoryVal := fs.String("max-memory", "", "maximum memory for the pipeline (e.g. 512M)")
+	threadsVal := fs.Int("threads", 1, "number of collections whose chunks are written concurrently")
+	timeoutVal := fs.Duration("timeout", 0, "abort the operation if it takes longer than this (e.g. 2h)")
+	catalogVal := fs.String("catalog", "", "write a catalog describing every collection to this file")
+	catalogKeyVal := fs.String("catalog-key", "", "file containing the HMAC key used to sign the catalog")
+	labelsVal := fs.String("labels", "", "comma-separated label for each collection, recorded in its metadata and in the catalog")
+	snapshotsVal := fs.String("snapshots", "", "record the encode in the snapshot log in this file")
+	snapshotLabelVal := fs.String("snapshot-label", "", "label of the encode in the snapshot log")
+	stealthVal := fs.Bool("stealth", false, "store collections under random names that don't reveal K and N")
+	recoveryNotesVal := fs.Bool("recovery-notes", false, "store a RECOVERY.txt in each collection explaining how to restore the data")
+	coverVal := fs.String("cover", "", "directory of PNG or JPEG photos to use as the visible images of PNG chunks")
+	generatedCoversVal := fs.Bool("generated-covers", false, "show a generated image in each PNG chunk instead of a single pixel")
+	embedVal := fs.String("embed", "", "where PNG chunks hide their data: chunk or lsb")
+	metadataKeyVal := fs.String("metadata-key", "", "file containing a passphrase used to encrypt collection metadata")
+	macKeyVal := fs.String("mac-key", "", "file containing a passphrase from which the keys that authenticate every chunk are derived")
+	passphraseVal := fs.Bool("passphrase", false, "prompt for a passphrase that decoding will also need")
+	passphraseFileVal := fs.String("passphrase-file", "", "file containing a passphrase that decoding will also need")
+	envelopeKeyVal := fs.String("envelope-key", "", "file containing a key from which the key that encrypts the data with AES-256-GCM is derived")
+	padToVal := fs.String("pad-to", "", "pad the data to a size, pow2, or bucket:SIZE so the collections don't reveal its size")
+	hiddenVal := fs.String("hidden", "", "directory to hide in the padding as a second payload")
+	hiddenKeyVal := fs.String("hidden-key", "", "file containing the secret the hidden volume is keyed from")
+	reviewByVal := fs.String("review-by", "", "date (YYYY-MM-DD) or period (e.g. 18m, 2y) by which shares should be reviewed")
+	stdoutVal := fs.Bool("stdout", false, "write chunks to stdout as framed records instead of to output directories")
+	matrixVal := fs.String("matrix", "", "with -dryrun, compare storage for several schemes, e.g. 2of3,3of5,4of7")
+	jsonVal := fs.Bool("json", false, "write the result to stdout as JSON instead of logging it")
+	compressionVal := fs.String("compression", "auto", "compression: auto, none, gzip[:LEVEL], or zstd[:LEVEL]")
+	levelVal := fs.String("level", "", "compression level: a number, fast, best, or default")
+	ignoreFileVal := fs.String("ignore-file", "", "file of .gitignore-style patterns of entries to leave out of the encode")
+	nameVal := fs.String("name", "", "with input -, the name of the file decode restores the stream to (default: stdin)")
+	indexVal := fs.Bool("index", false, "write a chunk index so decode -include can restore files from only the chunks holding them")
+	appendVal := fs.Bool("append", false, "add the input to the collections already in the output directories, as further chunks")
+	dedupVal := fs.Bool("dedup", false, "store each distinct block of the input once, before it is compressed")
+	weightsVal := fs.String("weights", "", "collections each output directory receives, as weights such as 1,2,2 or capacities such as 16G,64G,64G")
+	var custodianVals, labelVals, noteVals, excludeVals, includeVals, outVals stringList
+	fs.Var(&custodianVals, "custodian", "custodian of the next collection, as \"Name\" or \"Name <contact>\"")
+	fs.Var(&labelVals, "label", "label of the next collection (repeat once per collection)")
+	fs.Var(&noteVals, "note", "notes about the next collection, such as where it is kept (repeat once per collection)")
+	fs.Var(&outVals, "out", "output directory, making every argument an input directory (repeat for one per collection)")
+	fs.Var(&excludeVals, "exclude", "leave out entries matching this .gitignore-style pattern (repeatable)")
+	fs.Var(&includeVals, "include", "encode only entries matching this .gitignore-style pattern (repeatable)")
 	
-	// Determine if we're in size-only mode
-	dryrunMode := false
-	for i := 3; i < len(os.Args); i++ {
-		if os.Args[i] == "-dryrun" {
-			dryrunMode = true
-			break
-		}
+	positional := parseArgs(fs, args)
+	if len(positional) == 0 {
+		usage()
 	}
-	
-	// Collect output directories
-	var outputDirs []string
-	if len(os.Args) > 3 && !strings.HasPrefix(os.Args[3], "-") {
-		// First output directory
-		outputDirs = append(outputDirs, os.Args[3])
-		
-		// Check for additional output directories
-		for i := 4; i < len(os.Args); i++ {
-			if strings.HasPrefix(os.Args[i], "-") {
-				break
-			}
-			outputDirs = append(outputDirs, os.Args[i])
-		}
+	inputDirs := positional[:1]
+	outputDirs := positional[1:]
+
+	// With -out, every argument is an input directory, and they are encoded together
+	if len(outVals) > 0 {
+		inputDirs, outputDirs = positional, outVals
 	}
-	
-	// In dry run mode, output directory is optional
-	if len(outputDirs) == 0 && !dryrunMode {
-		// Check if -dryrun flag appears after the input dir
-		foundDryRunFlag := false
-		for i := 3; i < len(os.Args); i++ {
-			if os.Args[i] == "-dryrun" {
-				foundDryRunFlag = true
-				break
-			}
-		}
-		
-		// If not in dry run mode and no output directory, show usage
-		if !foundDryRunFlag {
-			usage()
-		}
+
+	// With input -, the data is read from stdin and encoded as it is
+	rawInput := len(inputDirs) == 1 && inputDirs[0] == "-"
+	if slices.Contains(inputDirs, "-") && !rawInput {
+		log.Fatalf("Error: input - cannot be combined with other inputs")
+	}
+	if *nameVal != "" && !rawInput {
+		log.Fatalf("Error: -name can only be used with input -")
+	}
+	if rawInput && (*stdoutVal || *resumeVal || *matrixVal != "") {
+		log.Fatalf("Error: input - cannot be combined with -stdout, -resume, or -matrix")
+	}
+	if rawInput && (len(excludeVals) > 0 || len(includeVals) > 0 || *ignoreFileVal != "") {
+		log.Fatalf("Error: -exclude, -include, and -ignore-file cannot be used with input -")
 	}
 
-	// Calculate where to start parsing flags
-	flagsStartIndex := 3
-	if len(outputDirs) > 0 {
-		flagsStartIndex = 3 + len(outputDirs)
+	// In framed stdout mode, there are no output directories
+	if *stdoutVal && len(outputDirs) > 0 {
+		log.Fatalf("Error: -stdout cannot be combined with output directories")
 	}
-	
-	// Parse flags if there are any
-	if flagsStartIndex < len(os.Args) {
-		fs.Parse(os.Args[flagsStartIndex:])
+	if *stdoutVal && *jsonVal {
+		log.Fatalf("Error: -json cannot be combined with -stdout")
 	}
-	
-	// Validate input directory
-	inputStat, err := os.Stat(inputDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			log.Fatalf("Error: Input directory does not exist: %s", inputDir)
+	if *resumeVal && *clearVal {
+		log.Fatalf("Error: -resume cannot be combined with -clear, which would remove the output to resume")
+	}
+	if *appendVal && (*resumeVal || *clearVal || *dryrunVal || *stdoutVal) {
+		log.Fatalf("Error: -append cannot be combined with -resume, -clear, -dryrun, or -stdout")
+	}
+	if *appendVal {
+		for _, name := range []string{"copies", "required", "format", "chunk", "files", "archive"} {
+			if isSet(fs, name) {
+				log.Fatalf("Error: -append uses the scheme, format, chunk size, and layout of the collections it adds to, so -%s cannot be given", name)
+			}
 		}
-		log.Fatalf("Error: Cannot access input directory %s: %v", inputDir, err)
 	}
-	if !inputStat.IsDir() {
-		log.Fatalf("Error: Input path is not a directory: %s", inputDir)
+
+	// In dry run mode, output directory is optional
+	if len(outputDirs) == 0 && !*dryrunVal && !*stdoutVal {
+		usage()
+	}
+
+	// Validate input directories; a single file may be encoded too
+	for _, inputDir := range inputDirs {
+		if inputDir == "-" {
+			continue // Stdin
+		}
+		inputStat, err := os.Stat(inputDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				log.Fatalf("Error: Input directory does not exist: %s", inputDir)
+			}
+			log.Fatalf("Error: Cannot access input directory %s: %v", inputDir, err)
+		}
+		if !inputStat.IsDir() && !inputStat.Mode().IsRegular() {
+			log.Fatalf("Error: Input path is not a directory or regular file: %s", inputDir)
+		}
 	}
 	
 	// If multiple output directories are provided, use their count as N
 	if len(outputDirs) > 1 {
 		// Check if -copies was also specified and they don't match
-		if fs.Lookup("copies").Value.String() != "2" { // 2 is the default
-			specifiedCopies, _ := strconv.Atoi(fs.Lookup("copies").Value.String())
-			if specifiedCopies != len(outputDirs) {
-				log.Fatalf("Error: Number of output directories (%d) does not match -copies value (%d)", 
-					len(outputDirs), specifiedCopies)
-			}
+		if isSet(fs, "copies") && *nVal != len(outputDirs) {
+			log.Fatalf("Error: Number of output directories (%d) does not match -copies value (%d)",
+				len(outputDirs), *nVal)
 		}
 		*nVal = len(outputDirs)
 	}
@@ -171,7 +367,7 @@ func handleEncode() {
 	}
 	
 	// If -required not explicitly set on command line, default to same as copies when using multiple output dirs
-	if fs.Lookup("required").Value.String() == "2" && len(outputDirs) > 1 {
+	if !isSet(fs, "required") && len(outputDirs) > 1 {
 		// Only update if we have multiple output directories and -required wasn't specified
 		*reqVal = *nVal
 		log.Printf("Setting -required to %d to match number of collections", *reqVal)
@@ -184,15 +380,192 @@ func handleEncode() {
 		log.Fatalf("Error: -required value %d cannot be greater than number of collections (-copies) %d", *reqVal, *nVal)
 	}
 
+	// With weights, -copies and -required count output directories rather than collections
+	var weights []int
+	if *weightsVal != "" {
+		if len(outputDirs) < 2 {
+			log.Fatalf("Error: -weights needs an output directory for each weight")
+		}
+		if *filesVal || *appendVal || *resumeVal || *matrixVal != "" {
+			log.Fatalf("Error: -weights cannot be combined with -files, -append, -resume, or -matrix")
+		}
+		var err error
+		if weights, err = padlock.ParseWeights(*weightsVal, len(outputDirs)); err != nil {
+			log.Fatalf("Error: -weights: %v", err)
+		}
+	}
+
+	applySizeFormat(*unitsVal, *precisionVal)
+	applyTempPolicy(*tmpdirVal, *spoolVal)
+
+	var labels []string
+	if *labelsVal != "" {
+		labels = strings.Split(*labelsVal, ",")
+		if len(labels) != *nVal {
+			log.Fatalf("Error: -labels lists %d labels but %d collections will be created", len(labels), *nVal)
+		}
+		for i := range labels {
+			labels[i] = strings.TrimSpace(labels[i])
+		}
+	}
+	if len(labelVals) > 0 {
+		if *labelsVal != "" {
+			log.Fatalf("Error: give labels either with -labels or with -label, not both")
+		}
+		if len(labelVals) != *nVal {
+			log.Fatalf("Error: %d -label values given but %d collections will be created", len(labelVals), *nVal)
+		}
+		labels = labelVals
+	}
+	if len(noteVals) > 0 && len(noteVals) != *nVal {
+		log.Fatalf("Error: %d -note values given but %d collections will be created", len(noteVals), *nVal)
+	}
+	if *catalogKeyVal != "" && *catalogVal == "" {
+		log.Fatalf("Error: -catalog-key requires -catalog")
+	}
+	if *snapshotLabelVal != "" && *snapshotsVal == "" {
+		log.Fatalf("Error: -snapshot-label requires -snapshots")
+	}
+	if *snapshotsVal != "" && *stdoutVal {
+		log.Fatalf("Error: -snapshots cannot be combined with -stdout, whose chunks have no location to record")
+	}
+	var custodians []padlock.Custodian
+	if len(custodianVals) > 0 {
+		if len(custodianVals) != *nVal {
+			log.Fatalf("Error: %d -custodian values given but %d collections will be created", len(custodianVals), *nVal)
+		}
+		for _, v := range custodianVals {
+			c, err := file.ParseCustodian(v)
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			custodians = append(custodians, c)
+		}
+	}
+	filter := inputFilter(excludeVals, includeVals, *ignoreFileVal)
+	var reviewBy time.Time
+	if *reviewByVal != "" {
+		var err error
+		reviewBy, err = padlock.ParseReviewBy(*reviewByVal, time.Now())
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	var catalogKey []byte
+	if *catalogKeyVal != "" {
+		catalogKey = readKeyFile(*catalogKeyVal)
+	}
+	if *recoveryNotesVal && (*stealthVal || *metadataKeyVal != "" || *stdoutVal || *appendVal) {
+		log.Fatalf("Error: -recovery-notes cannot be combined with -stealth, -metadata-key, -stdout, or -append")
+	}
+	var metadataKey []byte
+	if *metadataKeyVal != "" {
+		metadataKey = readKeyFile(*metadataKeyVal)
+	}
+	var macKey []byte
+	if *macKeyVal != "" {
+		macKey = readKeyFile(*macKeyVal)
+	}
+	if *resumeVal && (*passphraseVal || *passphraseFileVal != "") {
+		log.Fatalf("Error: -resume cannot be combined with -passphrase or -passphrase-file")
+	}
+	padTo, err := padlock.ParsePadding(*padToVal)
+	if err != nil {
+		log.Fatalf("Error: -pad-to: %v", err)
+	}
+	if *resumeVal && padTo.Mode != padlock.PadNone {
+		log.Fatalf("Error: -resume cannot be combined with -pad-to")
+	}
+	if *indexVal && (rawInput || *stdoutVal || *resumeVal || *passphraseVal || *passphraseFileVal != "" || *envelopeKeyVal != "" || padTo.Mode != padlock.PadNone) {
+		log.Fatalf("Error: -index cannot be combined with input -, -stdout, -resume, -passphrase, -envelope-key, or -pad-to")
+	}
+	if *dedupVal && (rawInput || *indexVal) {
+		log.Fatalf("Error: -dedup cannot be combined with input - or -index")
+	}
+	if (*hiddenVal == "") != (*hiddenKeyVal == "") {
+		log.Fatalf("Error: -hidden and -hidden-key must be given together")
+	}
+	if *hiddenVal != "" && padTo.Mode == padlock.PadNone {
+		log.Fatalf("Error: -hidden needs -pad-to, since the hidden volume is carried in the padding")
+	}
+	var hiddenKey []byte
+	if *hiddenKeyVal != "" {
+		hiddenKey = readKeyFile(*hiddenKeyVal)
+	}
+	encodePassphrase := passphrase(*passphraseVal, *passphraseFileVal, true)
+	var envelopeKey []byte
+	if *envelopeKeyVal != "" {
+		envelopeKey = readKeyFile(*envelopeKeyVal)
+	}
+
+	// A list of formats gives one for each collection, or for each output directory with -weights
+	var formats []padlock.Format
+	if strings.Contains(*formatVal, ",") {
+		if *stdoutVal || *resumeVal || *matrixVal != "" {
+			log.Fatalf("Error: a -format for each collection cannot be combined with -stdout, -resume, or -matrix")
+		}
+		if formats, err = padlock.ParseFormats(*formatVal); err != nil {
+			log.Fatalf("Error: -format: %v", err)
+		}
+		if len(formats) != *nVal {
+			log.Fatalf("Error: -format lists %d formats but %d collections will be created", len(formats), *nVal)
+		}
+		// Covers and embedding apply to the collections written as PNG
+		*formatVal = string(formats[0])
+		if slices.Contains(formats, padlock.FormatPNG) {
+			*formatVal = "png"
+		}
+	}
 	*formatVal = strings.ToLower(*formatVal)
-	if *formatVal != "bin" && *formatVal != "png" {
-		log.Fatalf("Error: -format must be 'bin' or 'png', got '%s'", *formatVal)
+	if *formatVal != "bin" && *formatVal != "png" && *formatVal != "txt" && *formatVal != "wav" {
+		log.Fatalf("Error: -format must be 'bin', 'png', 'txt', or 'wav', got '%s'", *formatVal)
+	}
+	if (*coverVal != "" || *generatedCoversVal) && *formatVal != "png" {
+		log.Fatalf("Error: -cover and -generated-covers can only be used with -format png")
+	}
+	if *coverVal != "" && *generatedCoversVal {
+		log.Fatalf("Error: -cover and -generated-covers cannot be combined")
+	}
+	var pngEmbedding padlock.PNGEmbedding
+	if *embedVal != "" {
+		if *formatVal != "png" {
+			log.Fatalf("Error: -embed can only be used with -format png")
+		}
+		if pngEmbedding, err = file.ParsePNGEmbedding(*embedVal); err != nil {
+			log.Fatalf("Error: -embed: %v", err)
+		}
+	}
+	compression, compressionLevel, err := padlock.ParseCompression(*compressionVal)
+	if err != nil {
+		log.Fatalf("Error: -compression: %v", err)
+	}
+	var volumeSize int64
+	if *volumeSizeVal != "" {
+		if *filesVal || *stdoutVal {
+			log.Fatalf("Error: -volume-size cannot be combined with -files or -stdout")
+		}
+		if volumeSize, err = file.ParseSize(*volumeSizeVal); err != nil || volumeSize == 0 {
+			log.Fatalf("Error: invalid -volume-size %q", *volumeSizeVal)
+		}
+	}
+	if *levelVal != "" {
+		if strings.Contains(*compressionVal, ":") {
+			log.Fatalf("Error: give the compression level either with -level or in -compression, not both")
+		}
+		compressionLevel, err = padlock.ParseCompressionLevel(compression, *levelVal)
+		if err != nil {
+			log.Fatalf("Error: -level: %v", err)
+		}
 	}
 
 	// Create config
 	format := padlock.FormatPNG
 	if *formatVal == "bin" {
 		format = padlock.FormatBin
+	} else if *formatVal == "txt" {
+		format = padlock.FormatText
+	} else if *formatVal == "wav" {
+		format = padlock.FormatWAV
 	}
 
 	// Create context with tracer
@@ -208,21 +581,107 @@ func handleEncode() {
 	rng := pad.NewDefaultRand(ctx)
 
 	cfg := padlock.EncodeConfig{
-		InputDir:           inputDir,
+		InputDir:           inputDirs[0],
+		InputDirs:          multipleInputs(inputDirs),
+		Filter:             filter,
 		OutputDir:          "", // Will be set below if not in size mode
 		OutputDirs:         nil, // Will be set below if not in size mode
 		N:                  *nVal,
 		K:                  *reqVal,
+		Sharing:            sharing(*schemeVal, *mandatoryVal),
 		Format:             format,
-		ChunkSize:          *chunkVal,
+		ChunkSize:          chunkSize(*chunkVal),
+		ChunkCount:         chunkCount(*chunksVal),
 		RNG:                rng,
 		ClearIfNotEmpty:    *clearVal,
 		Verbose:            *verboseVal,
-		Compression:        padlock.CompressionGzip,
+		Compression:        compression,
+		CompressionLevel:   compressionLevel,
 		ArchiveCollections: !*filesVal,
-		SizeOnly:           *dryrunVal || dryrunMode,
+		ArchiveFormat:      archiveFormat(fs, *archiveVal, *filesVal),
+		VolumeSize:         volumeSize,
+		SizeOnly:           *dryrunVal,
+		ChecksumSidecars:   *sha256Val,
+		ParityPercent:      parityPercent(*parityVal),
+		Par2Percent:        par2Percent(*par2Val),
+		Retry:              retryPolicy(*retriesVal, *retryDelayVal),
+		Pipeline:           pipelineConfig(*pipeBufferVal, *maxMemoryVal),
+		CatalogPath:        *catalogVal,
+		CatalogKey:         catalogKey,
+		SnapshotsPath:      *snapshotsVal,
+		SnapshotLabel:      *snapshotLabelVal,
+		Labels:             labels,
+		Notes:              noteVals,
+		Custodians:         custodians,
+		ReviewBy:           reviewBy,
+		StealthNames:       *stealthVal,
+		RecoveryNotes:      *recoveryNotesVal,
+		CoverDir:           *coverVal,
+		GeneratedCovers:    *generatedCoversVal,
+		PNGEmbedding:       pngEmbedding,
+		MetadataKey:        metadataKey,
+		MACKey:             macKey,
+		Passphrase:         encodePassphrase,
+		EnvelopeKey:        envelopeKey,
+		PadTo:              padTo,
+		HiddenDir:          *hiddenVal,
+		HiddenKey:          hiddenKey,
+		ChunkIndex:         *indexVal,
+		Append:             *appendVal,
+		Dedup:              *dedupVal,
+		Weights:            weights,
+		Formats:            formats,
+		Resume:             *resumeVal,
+		KeepPartial:        *keepPartialVal,
+		SkipSpaceCheck:     *noSpaceCheckVal,
+	}
+	if len(weights) > 0 && !isSet(fs, "scheme") {
+		cfg.Sharing = nil // Weights split the data with Shamir sharing unless -scheme says otherwise
+	}
+	if *threadsVal < 1 {
+		log.Fatalf("Error: -threads must be at least 1, got %d", *threadsVal)
+	}
+	cfg.Pipeline.WriteThreads = *threadsVal
+	if rawInput {
+		cfg.InputDir = ""
+		cfg.RawInput = os.Stdin
+		cfg.RawInputName = *nameVal
 	}
 	
+	// Compare the storage needed by several schemes in a single pass over the input
+	if *matrixVal != "" {
+		if !cfg.SizeOnly {
+			log.Fatalf("Error: -matrix requires -dryrun")
+		}
+		schemes, err := padlock.ParseSchemes(*matrixVal)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		restoreLog := quietLog(*jsonVal && !*verboseVal)
+		matrix, err := padlock.EstimateSizeMatrix(ctx, cfg, schemes)
+		restoreLog()
+		if err != nil {
+			log.Fatal(fmt.Errorf("dry run failed: %w", err))
+		}
+		if *jsonVal {
+			if err := matrix.WriteJSON(os.Stdout); err != nil {
+				log.Fatal(fmt.Errorf("failed to write result: %w", err))
+			}
+			return
+		}
+		matrix.Print(os.Stdout)
+		return
+	}
+
+	// Stream framed chunks to stdout for an external transport
+	if *stdoutVal {
+		err := runOperation(ctx, *timeoutVal, func(ctx context.Context) error {
+			return padlock.EncodeFrames(ctx, cfg, os.Stdout)
+		})
+		exitOnError("encode", err)
+		return
+	}
+
 	// Set output directories 
 	if len(outputDirs) > 0 {
 		cfg.OutputDir = outputDirs[0] // First output dir for backward compatibility
@@ -237,57 +696,117 @@ func handleEncode() {
 	}
 
 	// Encode the directory
-	if err := padlock.EncodeDirectory(ctx, cfg); err != nil {
-		log.Fatal(fmt.Errorf("encode failed: %w", err))
+	var result padlock.Result
+	if *jsonVal {
+		cfg.Result = &result
 	}
+	restoreLog := quietLog(*jsonVal && !*verboseVal)
+	err = runOperation(ctx, *timeoutVal, func(ctx context.Context) error {
+		return padlock.EncodeDirectory(ctx, cfg)
+	})
+	restoreLog()
+	if *jsonVal {
+		writeResult(&result, err)
+	}
+	exitOnError("encode", err)
 }
 
 // handleDecode handles the decode command
-func handleDecode() {
-	if len(os.Args) < 3 {
-		usage()
-	}
-
-	// First find where the flags start (if any)
-	flagIndex := -1
-	for i := 2; i < len(os.Args); i++ {
-		if strings.HasPrefix(os.Args[i], "-") {
-			flagIndex = i
-			break
-		}
-	}
-
-	// If no flags were found, flagIndex is still -1
-	if flagIndex == -1 {
-		flagIndex = len(os.Args)
-	}
-
-	// Parse flags
-	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+func handleDecode(args []string) {
+	fs := newFlagSet("decode")
 	clearVal := fs.Bool("clear", false, "clear output directory if not empty")
 	verboseVal := fs.Bool("verbose", false, "enable detailed debug output")
 	dryrunVal := fs.Bool("dryrun", false, "calculate and display size information without actually writing output files")
+	unitsVal := fs.String("units", "bytes", "units for reported sizes: bytes, iec, or si")
+	precisionVal := fs.Int("precision", 1, "decimal places for iec and si sizes")
+	tmpdirVal := fs.String("tmpdir", "", "directory for temporary files, such as extracted TAR collections (default: the system's)")
+	spoolVal := fs.String("spool", "8M", "size above which data held for later is spooled to a temporary file instead of memory")
+	retriesVal := fs.Int("retries", 0, "number of retries for transient IO errors")
+	retryDelayVal := fs.Duration("retry-delay", 500*time.Millisecond, "initial delay between retries")
+	pipeBufferVal := fs.String("pipe-buffer", "0", "bytes buffered between pipeline stages (e.g. 4M)")
+	maxMemoryVal := fs.String("max-memory", "", "maximum memory for the pipeline (e.g. 512M)")
+	prefetchVal := fs.Int("prefetch", padlock.DefaultPrefetchChunks, "chunks to read ahead from each collection in parallel")
+	prefetchDirVal := fs.String("prefetch-dir", "", "cache prefetched chunks in this directory instead of in memory")
+	timeoutVal := fs.Duration("timeout", 0, "abort the operation if it takes longer than this (e.g. 2h)")
+	metadataKeyVal := fs.String("metadata-key", "", "file containing the passphrase for encrypted collection metadata")
+	macKeyVal := fs.String("mac-key", "", "file containing the passphrase that authenticates every chunk")
+	passphraseVal := fs.Bool("passphrase", false, "prompt for the passphrase the data was encoded with")
+	passphraseFileVal := fs.String("passphrase-file", "", "file containing the passphrase the data was encoded with")
+	envelopeKeyVal := fs.String("envelope-key", "", "file containing the key the data was encrypted with")
+	hiddenKeyVal := fs.String("hidden-key", "", "file containing the secret of the hidden volume to decode instead of the data")
+	stdinVal := fs.Bool("stdin", false, "read chunks from stdin as framed records produced by encode -stdout")
+	jsonVal := fs.Bool("json", false, "write the result to stdout as JSON instead of logging it")
+	resumeVal := fs.Bool("resume", false, "skip the files an interrupted decode to the output directory already restored")
+	keepPartialVal := fs.Bool("keep-partial", false, "keep the files restored by a failed decode instead of rolling them back")
+	noSpaceCheckVal := fs.Bool("no-space-check", false, "don't check that the output directory has room for the decoded data")
+	salvageVal := fs.Bool("salvage", false, "keep and report the files restored before data that can't be decoded")
+	depthVal := fs.Int("depth", 0, "levels of subdirectories of the input directories to search for collections")
+	fromVal := fs.String("from", "", "file listing the collection locations to decode, one local path or URL per line")
+	tarVal := fs.String("tar", "", "write the decoded TAR to this file, or to stdout with -, instead of extracting it")
+	compressedVal := fs.Bool("compressed", false, "with -tar, leave the TAR compressed as it was encoded")
+	var excludeVals, includeVals stringList
+	fs.Var(&excludeVals, "exclude", "don't restore entries matching this .gitignore-style pattern (repeatable)")
+	fs.Var(&includeVals, "include", "restore only entries matching this .gitignore-style pattern (repeatable)")
 	
-	// Parse flags if there are any
-	if flagIndex < len(os.Args) {
-		fs.Parse(os.Args[flagIndex:])
+	args = parseArgs(fs, args)
+	applySizeFormat(*unitsVal, *precisionVal)
+	applyTempPolicy(*tmpdirVal, *spoolVal)
+	if *resumeVal && (*clearVal || *dryrunVal) {
+		log.Fatalf("Error: -resume cannot be combined with -clear or -dryrun")
 	}
-	
-	// Check if we're in size-only mode
-	dryrunMode := *dryrunVal
-	for i := 2; i < flagIndex; i++ {
-		if os.Args[i] == "-dryrun" {
-			dryrunMode = true
-			break
-		}
+	if *salvageVal && *dryrunVal {
+		log.Fatalf("Error: -salvage cannot be combined with -dryrun")
 	}
-	
-	// Collect all the non-flag arguments
-	args := os.Args[2:flagIndex]
-	
-	// Need at least input directories
-	if len(args) < 1 {
-		usage()
+	if *depthVal < 0 {
+		log.Fatalf("Error: -depth must not be negative, got %d", *depthVal)
+	}
+	if *compressedVal && *tarVal == "" {
+		log.Fatalf("Error: -compressed requires -tar")
+	}
+	if *tarVal != "" && (*stdinVal || *resumeVal || *salvageVal || *clearVal || *dryrunVal) {
+		log.Fatalf("Error: -tar cannot be combined with -stdin, -resume, -salvage, -clear, or -dryrun")
+	}
+	if *tarVal == "-" && *jsonVal {
+		log.Fatalf("Error: -json cannot be combined with -tar -, which writes to stdout")
+	}
+	filter := inputFilter(excludeVals, includeVals, "")
+	if filter != nil && (*tarVal != "" || *stdinVal) {
+		log.Fatalf("Error: -exclude and -include cannot be combined with -tar or -stdin")
+	}
+
+	// In framed stdin mode the only argument is the output directory
+	if *stdinVal {
+		if len(args) != 1 {
+			usage()
+		}
+		if *jsonVal {
+			log.Fatalf("Error: -json cannot be combined with -stdin")
+		}
+		if *fromVal != "" {
+			log.Fatalf("Error: -from cannot be combined with -stdin")
+		}
+		logLevel := trace.LogLevelNormal
+		if *verboseVal {
+			logLevel = trace.LogLevelVerbose
+		}
+		ctx := trace.WithContext(context.Background(), trace.NewTracer("MAIN", logLevel))
+		cfg := padlock.DecodeConfig{
+			OutputDir:       args[0],
+			Compression:     padlock.CompressionGzip,
+			ClearIfNotEmpty: *clearVal,
+			Passphrase:      passphrase(*passphraseVal, *passphraseFileVal, false),
+			Resume:          *resumeVal,
+			KeepPartial:     *keepPartialVal,
+			Salvage:         *salvageVal,
+		}
+		if *hiddenKeyVal != "" {
+			cfg.HiddenKey = readKeyFile(*hiddenKeyVal)
+		}
+		err := runOperation(ctx, *timeoutVal, func(ctx context.Context) error {
+			return padlock.DecodeFrames(ctx, os.Stdin, cfg)
+		})
+		exitOnError("decode", err)
+		return
 	}
 	
 	// Need at least one input directory
@@ -295,12 +814,30 @@ func handleDecode() {
 	var outputDir string
 	var inputDirs []string
 	
-	if len(args) >= 2 {
+	if *fromVal != "" {
+		// The inputs are listed in the -from file, ahead of any given as arguments
+		listed, err := padlock.ReadInputsFile(*fromVal)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if *tarVal != "" {
+			// With -tar, there is no output directory
+		} else if len(args) >= 1 {
+			outputDir = args[len(args)-1]
+			args = args[:len(args)-1]
+		} else if !*dryrunVal {
+			usage()
+		}
+		inputDirs = append(listed, args...)
+	} else if *tarVal != "" && len(args) >= 1 {
+		// With -tar, every argument is an input directory
+		inputDirs = args
+	} else if len(args) >= 2 {
 		// Last non-flag argument is the output directory
 		outputDir = args[len(args)-1]
 		// All other non-flag arguments are input directories
 		inputDirs = args[:len(args)-1]
-	} else if len(args) == 1 && dryrunMode {
+	} else if len(args) == 1 && *dryrunVal {
 		// In dry run mode with just one arg, it's the input directory
 		outputDir = ""
 		inputDirs = args
@@ -309,8 +846,17 @@ func handleDecode() {
 		usage()
 	}
 
-	// Validate input directories
+	// With output -, a stream encoded from stdin is written to stdout
+	toStdout := outputDir == "-"
+	if toStdout && (*jsonVal || *resumeVal || *salvageVal || *clearVal || *dryrunVal || filter != nil) {
+		log.Fatalf("Error: output - cannot be combined with -json, -resume, -salvage, -clear, -dryrun, -exclude, or -include")
+	}
+
+	// Validate input directories; remote ones are checked when they are downloaded
 	for _, dir := range inputDirs {
+		if file.IsDestinationURL(dir) {
+			continue
+		}
 		inputStat, err := os.Stat(dir)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -318,9 +864,9 @@ func handleDecode() {
 			}
 			log.Fatalf("Error: Cannot access input directory %s: %v", dir, err)
 		}
-		// Input must be a directory for decoding
-		if !inputStat.IsDir() {
-			log.Fatalf("Error: Input path is not a directory: %s. The input should be a directory containing collection subdirectories or ZIP files.", dir)
+		// Input must be a directory, a collection archive, or a chunk file for decoding
+		if !inputStat.IsDir() && !file.IsArchivePath(dir) && !file.IsChunkFileName(dir) {
+			log.Fatalf("Error: Input path is not a directory, collection archive, or chunk file: %s. The input should be a directory containing collection subdirectories or archives, a collection TAR or ZIP, or chunk files.", dir)
 		}
 	}
 
@@ -345,16 +891,1008 @@ func handleDecode() {
 		Verbose:         *verboseVal,
 		Compression:     padlock.CompressionGzip,
 		ClearIfNotEmpty: *clearVal,
-		SizeOnly:        *dryrunVal || dryrunMode,
+		SizeOnly:        *dryrunVal,
+		Retry:           retryPolicy(*retriesVal, *retryDelayVal),
+		Pipeline:        pipelineConfig(*pipeBufferVal, *maxMemoryVal),
+		Resume:          *resumeVal,
+		KeepPartial:     *keepPartialVal,
+		Salvage:         *salvageVal,
+		SearchDepth:     *depthVal,
+		SkipSpaceCheck:  *noSpaceCheckVal,
+		Filter:          filter,
+	}
+	if *prefetchVal < 1 {
+		log.Fatalf("Error: -prefetch must be at least 1, got %d", *prefetchVal)
+	}
+	cfg.Pipeline.PrefetchChunks = *prefetchVal
+	cfg.Pipeline.PrefetchDir = *prefetchDirVal
+	if *metadataKeyVal != "" {
+		cfg.MetadataKey = readKeyFile(*metadataKeyVal)
+	}
+	if *macKeyVal != "" {
+		cfg.MACKey = readKeyFile(*macKeyVal)
+	}
+	cfg.Passphrase = passphrase(*passphraseVal, *passphraseFileVal, false)
+	if *envelopeKeyVal != "" {
+		cfg.EnvelopeKey = readKeyFile(*envelopeKeyVal)
+	}
+	if *hiddenKeyVal != "" {
+		cfg.HiddenKey = readKeyFile(*hiddenKeyVal)
 	}
 	
 	// In dry run mode, check if we need a placeholder output directory
 	if cfg.SizeOnly && outputDir == "" {
 		cfg.OutputDir = "dryrun-output"
 	}
+	if toStdout {
+		cfg.OutputDir = ""
+		cfg.OutputStream = os.Stdout
+	}
+
+	// With -tar, the decoded TAR is written as it is rather than extracted
+	var tarFile *os.File
+	if *tarVal == "-" {
+		cfg.OutputStream, cfg.OutputTar, cfg.KeepCompressed = os.Stdout, true, *compressedVal
+	} else if *tarVal != "" {
+		var err error
+		if tarFile, err = os.Create(*tarVal); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		cfg.OutputStream, cfg.OutputTar, cfg.KeepCompressed = tarFile, true, *compressedVal
+	}
 
 	// Decode the directory
-	if err := padlock.DecodeDirectory(ctx, cfg); err != nil {
-		log.Fatal(fmt.Errorf("decode failed: %w", err))
+	var result padlock.Result
+	if *jsonVal {
+		cfg.Result = &result
+	}
+	restoreLog := quietLog(*jsonVal && !*verboseVal)
+	err := runOperation(ctx, *timeoutVal, func(ctx context.Context) error {
+		return padlock.DecodeDirectory(ctx, cfg)
+	})
+	restoreLog()
+	if tarFile != nil {
+		// A TAR cut short by a failure isn't kept, like the files of a failed extraction
+		if closeErr := tarFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil && !*keepPartialVal {
+			os.Remove(tarFile.Name())
+		}
+	}
+	if *jsonVal {
+		writeResult(&result, err)
+	}
+	exitOnError("decode", err)
+}
+
+// handleCustodians handles the custodians command
+func handleCustodians(args []string) {
+	fs := newFlagSet("custodians")
+	verboseVal := fs.Bool("verbose", false, "enable detailed debug output")
+	tmpdirVal := fs.String("tmpdir", "", "directory for temporary files, such as extracted TAR collections (default: the system's)")
+	spoolVal := fs.String("spool", "8M", "size above which data held for later is spooled to a temporary file instead of memory")
+	catalogKeyVal := fs.String("catalog-key", "", "file containing the HMAC key used to verify the catalog")
+	metadataKeyVal := fs.String("metadata-key", "", "file containing the passphrase for encrypted collection metadata")
+	args = parseArgs(fs, args)
+	applyTempPolicy(*tmpdirVal, *spoolVal)
+	if len(args) == 0 {
+		usage()
 	}
-}
\ No newline at end of file
+
+	ctx := context.Background()
+	logLevel := trace.LogLevelNormal
+	if *verboseVal {
+		logLevel = trace.LogLevelVerbose
+	}
+	ctx = trace.WithContext(ctx, trace.NewTracer("MAIN", logLevel))
+
+	var plan *padlock.CustodianPlan
+	if info, err := os.Stat(args[0]); err == nil && !info.IsDir() {
+		// A single regular file is a catalog
+		if len(args) > 1 {
+			log.Fatalf("Error: Only one catalog file may be given")
+		}
+		var key []byte
+		if *catalogKeyVal != "" {
+			key = readKeyFile(*catalogKeyVal)
+		}
+		catalog, err := padlock.ReadCatalog(ctx, args[0], key)
+		if err != nil {
+			log.Fatal(fmt.Errorf("custodians failed: %w", err))
+		}
+		plan = padlock.CustodianPlanFromCatalog(catalog)
+	} else {
+		if *catalogKeyVal != "" {
+			log.Fatalf("Error: -catalog-key can only be used with a catalog file")
+		}
+		var key []byte
+		if *metadataKeyVal != "" {
+			key = readKeyFile(*metadataKeyVal)
+		}
+		plan, err = padlock.ReadCustodianPlan(ctx, args[0], args, key)
+		if err != nil {
+			log.Fatal(fmt.Errorf("custodians failed: %w", err))
+		}
+	}
+
+	plan.Print(os.Stdout)
+}
+
+// handleSnapshots handles the snapshots command
+func handleSnapshots(args []string) {
+	fs := newFlagSet("snapshots")
+	verboseVal := fs.Bool("verbose", false, "enable detailed debug output")
+	selectVal := fs.String("select", "", "snapshot to show or restore: latest, or its ID, label, or session")
+	restoreVal := fs.String("restore", "", "decode the selected snapshot to this directory")
+	clearVal := fs.Bool("clear", false, "clear output directory if not empty")
+	tmpdirVal := fs.String("tmpdir", "", "directory for temporary files, such as extracted TAR collections (default: the system's)")
+	spoolVal := fs.String("spool", "8M", "size above which data held for later is spooled to a temporary file instead of memory")
+	args = parseArgs(fs, args)
+	applyTempPolicy(*tmpdirVal, *spoolVal)
+	if len(args) != 1 {
+		usage()
+	}
+	if *restoreVal != "" && *selectVal == "" {
+		log.Fatalf("Error: -restore needs the snapshot to restore given with -select")
+	}
+	if *clearVal && *restoreVal == "" {
+		log.Fatalf("Error: -clear can only be used with -restore")
+	}
+
+	ctx := context.Background()
+	logLevel := trace.LogLevelNormal
+	if *verboseVal {
+		logLevel = trace.LogLevelVerbose
+	}
+	ctx = trace.WithContext(ctx, trace.NewTracer("MAIN", logLevel))
+
+	snapshots, err := padlock.ReadSnapshots(ctx, args[0])
+	if err != nil {
+		log.Fatal(fmt.Errorf("snapshots failed: %w", err))
+	}
+	if *selectVal == "" {
+		snapshots.Print(os.Stdout)
+		return
+	}
+	snapshot, err := snapshots.Select(*selectVal)
+	if err != nil {
+		log.Fatal(fmt.Errorf("snapshots failed: %w", err))
+	}
+	if *restoreVal == "" {
+		snapshot.Print(os.Stdout)
+		return
+	}
+
+	// Restore from whichever of the snapshot's collections are still where they were written
+	inputDirs := snapshot.LocalPaths()
+	if len(inputDirs) < snapshot.Required {
+		log.Fatalf("Error: only %d of the %d collections snapshot %d needs are on local disk; gather them and decode them instead",
+			len(inputDirs), snapshot.Required, snapshot.ID)
+	}
+	log.Printf("Restoring snapshot %d (session %s) from %d collections", snapshot.ID, snapshot.Session, len(inputDirs))
+	cfg := padlock.DecodeConfig{
+		InputDir:        inputDirs[0],
+		InputDirs:       inputDirs,
+		OutputDir:       *restoreVal,
+		RNG:             pad.NewDefaultRand(ctx),
+		Verbose:         *verboseVal,
+		Compression:     padlock.CompressionGzip,
+		ClearIfNotEmpty: *clearVal,
+	}
+	err = runOperation(ctx, 0, func(ctx context.Context) error {
+		return padlock.DecodeDirectory(ctx, cfg)
+	})
+	exitOnError("restore", err)
+}
+
+// handleRepair handles the repair command
+func handleRepair(args []string) {
+	fs := newFlagSet("repair")
+	collectionVal := fs.String("collection", "", "name of the collection to regenerate (default: the one that is missing)")
+	formatVal := fs.String("format", "", "bin, png, txt, or wav (default: the format of the surviving collections)")
+	clearVal := fs.Bool("clear", false, "clear output directory if not empty")
+	verboseVal := fs.Bool("verbose", false, "enable detailed debug output")
+	tmpdirVal := fs.String("tmpdir", "", "directory for temporary files, such as extracted TAR collections (default: the system's)")
+	spoolVal := fs.String("spool", "8M", "size above which data held for later is spooled to a temporary file instead of memory")
+	filesVal := fs.Bool("files", false, "create individual files for the collection instead of a tar archive")
+	archiveVal := fs.String("archive", "tar", "archive format for the collection: tar or zip")
+	sha256Val := fs.Bool("sha256", false, "write a .sha256 sidecar file for each chunk (files mode only)")
+	parityVal := fs.Int("parity", 0, "write a Reed-Solomon .parity sidecar with this percentage overhead for each chunk (files mode only)")
+	par2Val := fs.Int("par2", 0, "write PAR2 recovery files with this percentage redundancy for each collection")
+	retriesVal := fs.Int("retries", 0, "number of retries for transient IO errors")
+	retryDelayVal := fs.Duration("retry-delay", 500*time.Millisecond, "initial delay between retries")
+	timeoutVal := fs.Duration("timeout", 0, "abort the operation if it takes longer than this (e.g. 2h)")
+	metadataKeyVal := fs.String("metadata-key", "", "file containing the passphrase for encrypted collection metadata")
+	macKeyVal := fs.String("mac-key", "", "file containing the passphrase that authenticates every chunk")
+	args = parseArgs(fs, args)
+	applyTempPolicy(*tmpdirVal, *spoolVal)
+	if len(args) < 2 {
+		usage()
+	}
+	inputDirs := args[:len(args)-1]
+	outputDir := args[len(args)-1]
+
+	var format padlock.Format
+	switch strings.ToLower(*formatVal) {
+	case "":
+	case "bin":
+		format = padlock.FormatBin
+	case "png":
+		format = padlock.FormatPNG
+	case "txt":
+		format = padlock.FormatText
+	case "wav":
+		format = padlock.FormatWAV
+	default:
+		log.Fatalf("Error: -format must be 'bin', 'png', 'txt', or 'wav', got '%s'", *formatVal)
+	}
+	ctx := context.Background()
+	logLevel := trace.LogLevelNormal
+	if *verboseVal {
+		logLevel = trace.LogLevelVerbose
+	}
+	ctx = trace.WithContext(ctx, trace.NewTracer("MAIN", logLevel))
+
+	cfg := padlock.RepairConfig{
+		InputDirs:          inputDirs,
+		OutputDir:          outputDir,
+		Collection:         strings.ToUpper(*collectionVal),
+		Format:             format,
+		ArchiveCollections: !*filesVal,
+		ArchiveFormat:      archiveFormat(fs, *archiveVal, *filesVal),
+		ClearIfNotEmpty:    *clearVal,
+		ChecksumSidecars:   *sha256Val,
+		ParityPercent:      parityPercent(*parityVal),
+		Par2Percent:        par2Percent(*par2Val),
+		Retry:              retryPolicy(*retriesVal, *retryDelayVal),
+	}
+	if *metadataKeyVal != "" {
+		cfg.MetadataKey = readKeyFile(*metadataKeyVal)
+	}
+	if *macKeyVal != "" {
+		cfg.MACKey = readKeyFile(*macKeyVal)
+	}
+
+	var coll file.Collection
+	err := runOperation(ctx, *timeoutVal, func(ctx context.Context) error {
+		var err error
+		coll, err = padlock.RepairCollection(ctx, cfg)
+		return err
+	})
+	exitOnError("repair", err)
+	fmt.Printf("Regenerated collection %s at %s\n", coll.Name, coll.Path)
+}
+
+// handleReshare handles the reshare command
+func handleReshare(args []string) {
+	fs := newFlagSet("reshare")
+	nVal := fs.Int("copies", 2, "number of new collections (must be between 2 and 26)")
+	reqVal := fs.Int("required", 2, "minimum new collections required for reconstruction")
+	formatVal := fs.String("format", "png", "bin, png, txt, or wav (default: png)")
+	schemeVal := fs.String("scheme", "otp", "secret sharing scheme: otp or shamir")
+	mandatoryVal := fs.String("mandatory", "", "with -scheme shamir, letters of the collections every reconstruction needs, e.g. A")
+	clearVal := fs.Bool("clear", false, "clear output directory if not empty")
+	chunkVal := fs.Int("chunk", 2*1024*1024, "maximum candidate block size in bytes (default: 2MB)")
+	verboseVal := fs.Bool("verbose", false, "enable detailed debug output")
+	tmpdirVal := fs.String("tmpdir", "", "directory for temporary files, such as extracted TAR collections (default: the system's)")
+	spoolVal := fs.String("spool", "8M", "size above which data held for later is spooled to a temporary file instead of memory")
+	filesVal := fs.Bool("files", false, "create individual files for each collection instead of tar archives")
+	archiveVal := fs.String("archive", "tar", "archive format for collections: tar or zip")
+	sha256Val := fs.Bool("sha256", false, "write a .sha256 sidecar file for each chunk (files mode only)")
+	parityVal := fs.Int("parity", 0, "write a Reed-Solomon .parity sidecar with this percentage overhead for each chunk (files mode only)")
+	par2Val := fs.Int("par2", 0, "write PAR2 recovery files with this percentage redundancy for each collection")
+	retriesVal := fs.Int("retries", 0, "number of retries for transient IO errors")
+	retryDelayVal := fs.Duration("retry-delay", 500*time.Millisecond, "initial delay between retries")
+	pipeBufferVal := fs.String("pipe-buffer", "0", "bytes buffered between pipeline stages (e.g. 4M)")
+	timeoutVal := fs.Duration("timeout", 0, "abort the operation if it takes longer than this (e.g. 2h)")
+	stealthVal := fs.Bool("stealth", false, "store collections under random names that don't reveal K and N")
+	metadataKeyVal := fs.String("metadata-key", "", "file containing a passphrase used to encrypt the new collection metadata")
+	macKeyVal := fs.String("mac-key", "", "file containing a passphrase from which the keys that authenticate the new chunks are derived")
+	args = parseArgs(fs, args)
+	applyTempPolicy(*tmpdirVal, *spoolVal)
+	if len(args) < 2 {
+		usage()
+	}
+	if *nVal < 2 || *nVal > 26 {
+		log.Fatalf("Error: Number of collections (-copies) must be between 2 and 26, got %d", *nVal)
+	}
+	if *reqVal < 2 || *reqVal > *nVal {
+		log.Fatalf("Error: -required must be between 2 and -copies %d, got %d", *nVal, *reqVal)
+	}
+	format := padlock.FormatPNG
+	switch strings.ToLower(*formatVal) {
+	case "png":
+	case "bin":
+		format = padlock.FormatBin
+	case "txt":
+		format = padlock.FormatText
+	case "wav":
+		format = padlock.FormatWAV
+	default:
+		log.Fatalf("Error: -format must be 'bin', 'png', 'txt', or 'wav', got '%s'", *formatVal)
+	}
+
+	ctx := context.Background()
+	logLevel := trace.LogLevelNormal
+	if *verboseVal {
+		logLevel = trace.LogLevelVerbose
+	}
+	ctx = trace.WithContext(ctx, trace.NewTracer("MAIN", logLevel))
+
+	cfg := padlock.ReshareConfig{
+		InputDirs: args[:len(args)-1],
+		Retry:     retryPolicy(*retriesVal, *retryDelayVal),
+		Encode: padlock.EncodeConfig{
+			OutputDir:          args[len(args)-1],
+			N:                  *nVal,
+			K:                  *reqVal,
+			Sharing:            sharing(*schemeVal, *mandatoryVal),
+			Format:             format,
+			ChunkSize:          *chunkVal,
+			RNG:                pad.NewDefaultRand(ctx),
+			ClearIfNotEmpty:    *clearVal,
+			Verbose:            *verboseVal,
+			ArchiveCollections: !*filesVal,
+			ArchiveFormat:      archiveFormat(fs, *archiveVal, *filesVal),
+			ChecksumSidecars:   *sha256Val,
+			ParityPercent:      parityPercent(*parityVal),
+			Par2Percent:        par2Percent(*par2Val),
+			Retry:              retryPolicy(*retriesVal, *retryDelayVal),
+			Pipeline:           pipelineConfig(*pipeBufferVal, ""),
+			StealthNames:       *stealthVal,
+		},
+	}
+	if *metadataKeyVal != "" {
+		cfg.Encode.MetadataKey = readKeyFile(*metadataKeyVal)
+	}
+	if *macKeyVal != "" {
+		cfg.Encode.MACKey = readKeyFile(*macKeyVal)
+	}
+
+	err := runOperation(ctx, *timeoutVal, func(ctx context.Context) error {
+		return padlock.ReshareCollections(ctx, cfg)
+	})
+	exitOnError("reshare", err)
+}
+
+// handleVerify handles the verify command
+func handleVerify(args []string) {
+	fs := newFlagSet("verify")
+	verboseVal := fs.Bool("verbose", false, "enable detailed debug output")
+	unitsVal := fs.String("units", "bytes", "units for reported sizes: bytes, iec, or si")
+	precisionVal := fs.Int("precision", 1, "decimal places for iec and si sizes")
+	tmpdirVal := fs.String("tmpdir", "", "directory for temporary files, such as extracted TAR collections (default: the system's)")
+	spoolVal := fs.String("spool", "8M", "size above which data held for later is spooled to a temporary file instead of memory")
+	retriesVal := fs.Int("retries", 0, "number of retries for transient IO errors")
+	retryDelayVal := fs.Duration("retry-delay", 500*time.Millisecond, "initial delay between retries")
+	timeoutVal := fs.Duration("timeout", 0, "abort the operation if it takes longer than this (e.g. 2h)")
+	metadataKeyVal := fs.String("metadata-key", "", "file containing the passphrase for encrypted collection metadata")
+	macKeyVal := fs.String("mac-key", "", "file containing the passphrase that authenticates every chunk")
+	args = parseArgs(fs, args)
+	if len(args) == 0 {
+		usage()
+	}
+	applySizeFormat(*unitsVal, *precisionVal)
+	applyTempPolicy(*tmpdirVal, *spoolVal)
+
+	ctx := context.Background()
+	logLevel := trace.LogLevelNormal
+	if *verboseVal {
+		logLevel = trace.LogLevelVerbose
+	}
+	ctx = trace.WithContext(ctx, trace.NewTracer("MAIN", logLevel))
+
+	cfg := padlock.VerifyConfig{
+		InputDirs: args,
+		Retry:     retryPolicy(*retriesVal, *retryDelayVal),
+	}
+	if *metadataKeyVal != "" {
+		cfg.MetadataKey = readKeyFile(*metadataKeyVal)
+	}
+	if *macKeyVal != "" {
+		cfg.MACKey = readKeyFile(*macKeyVal)
+	}
+
+	var report *padlock.VerifyReport
+	err := runOperation(ctx, *timeoutVal, func(ctx context.Context) error {
+		var err error
+		report, err = padlock.VerifyCollections(ctx, cfg)
+		return err
+	})
+	exitOnError("verify", err)
+
+	report.Print(os.Stdout)
+	if !report.Passed() {
+		os.Exit(1)
+	}
+}
+
+// handleInfo handles the info command
+func handleInfo(args []string) {
+	fs := newFlagSet("info")
+	verboseVal := fs.Bool("verbose", false, "enable detailed debug output")
+	unitsVal := fs.String("units", "bytes", "units for reported sizes: bytes, iec, or si")
+	precisionVal := fs.Int("precision", 1, "decimal places for iec and si sizes")
+	tmpdirVal := fs.String("tmpdir", "", "directory for temporary files, such as extracted TAR collections (default: the system's)")
+	spoolVal := fs.String("spool", "8M", "size above which data held for later is spooled to a temporary file instead of memory")
+	timeoutVal := fs.Duration("timeout", 0, "abort the operation if it takes longer than this (e.g. 2h)")
+	metadataKeyVal := fs.String("metadata-key", "", "file containing the passphrase for encrypted collection metadata")
+	args = parseArgs(fs, args)
+	if len(args) == 0 {
+		usage()
+	}
+	applySizeFormat(*unitsVal, *precisionVal)
+	applyTempPolicy(*tmpdirVal, *spoolVal)
+
+	ctx := context.Background()
+	logLevel := trace.LogLevelNormal
+	if *verboseVal {
+		logLevel = trace.LogLevelVerbose
+	}
+	ctx = trace.WithContext(ctx, trace.NewTracer("MAIN", logLevel))
+
+	var key []byte
+	if *metadataKeyVal != "" {
+		key = readKeyFile(*metadataKeyVal)
+	}
+
+	var infos []padlock.CollectionInfo
+	err := runOperation(ctx, *timeoutVal, func(ctx context.Context) error {
+		var err error
+		infos, err = padlock.ReadCollectionInfo(ctx, args, key)
+		return err
+	})
+	exitOnError("info", err)
+	padlock.PrintCollectionInfo(os.Stdout, infos)
+}
+
+// handleInspect handles the inspect command
+func handleInspect(args []string) {
+	fs := newFlagSet("inspect")
+	verboseVal := fs.Bool("verbose", false, "enable detailed debug output")
+	bytesVal := fs.Int("bytes", 64, "number of bytes of cipher data to show as a hex preview")
+	unitsVal := fs.String("units", "bytes", "units for reported sizes: bytes, iec, or si")
+	precisionVal := fs.Int("precision", 1, "decimal places for iec and si sizes")
+	args = parseArgs(fs, args)
+	if len(args) != 1 {
+		usage()
+	}
+	applySizeFormat(*unitsVal, *precisionVal)
+
+	ctx := context.Background()
+	logLevel := trace.LogLevelNormal
+	if *verboseVal {
+		logLevel = trace.LogLevelVerbose
+	}
+	ctx = trace.WithContext(ctx, trace.NewTracer("MAIN", logLevel))
+
+	inspection, err := padlock.InspectChunkFile(ctx, args[0])
+	exitOnError("inspect", err)
+
+	inspection.Print(os.Stdout, *bytesVal)
+	if !inspection.OK() {
+		os.Exit(1)
+	}
+}
+
+// handlePlan handles the plan command
+func handlePlan(args []string) {
+	fs := newFlagSet("plan")
+	surviveVal := fs.Int("survive", -1, "number of collections that may be lost while the data stays recoverable")
+	custodiansVal := fs.Int("custodians", 0, "number of custodians available to hold a collection each")
+	budgetVal := fs.String("budget", "", "storage available for all collections together (e.g. 20G)")
+	chunkVal := fs.Int("chunk", 2*1024*1024, "maximum candidate block size in bytes (default: 2MB)")
+	verboseVal := fs.Bool("verbose", false, "enable detailed debug output")
+	unitsVal := fs.String("units", "bytes", "units for reported sizes: bytes, iec, or si")
+	precisionVal := fs.Int("precision", 1, "decimal places for iec and si sizes")
+	args = parseArgs(fs, args)
+	if len(args) != 1 {
+		usage()
+	}
+	inputDir := args[0]
+
+	if *surviveVal < 0 {
+		log.Fatalf("Error: -survive is required, e.g. -survive 2 to tolerate losing any 2 collections")
+	}
+	var budget int64
+	if *budgetVal != "" {
+		var err error
+		if budget, err = file.ParseSize(*budgetVal); err != nil {
+			log.Fatalf("Error: invalid -budget: %v", err)
+		}
+	}
+	applySizeFormat(*unitsVal, *precisionVal)
+
+	ctx := context.Background()
+	logLevel := trace.LogLevelNormal
+	if *verboseVal {
+		logLevel = trace.LogLevelVerbose
+	}
+	ctx = trace.WithContext(ctx, trace.NewTracer("MAIN", logLevel))
+
+	cfg := padlock.EncodeConfig{InputDir: inputDir, ChunkSize: *chunkVal}
+	plan, err := padlock.RecommendScheme(ctx, cfg, padlock.PlanRequest{
+		SurviveLoss: *surviveVal,
+		Custodians:  *custodiansVal,
+		Budget:      budget,
+	})
+	if err != nil {
+		log.Fatal(fmt.Errorf("plan failed: %w", err))
+	}
+	plan.Print(os.Stdout)
+}
+
+// handleClean handles the clean command
+func handleClean(args []string) {
+	fs := newFlagSet("clean")
+	dryRunVal := fs.Bool("dryrun", false, "list leftovers without removing them")
+	olderThanVal := fs.Duration("older-than", time.Hour, "only remove leftovers not modified for this long")
+	verboseVal := fs.Bool("verbose", false, "enable detailed debug output")
+	unitsVal := fs.String("units", "bytes", "units for reported sizes: bytes, iec, or si")
+	precisionVal := fs.Int("precision", 1, "decimal places for iec and si sizes")
+	dirs := parseArgs(fs, args)
+	if len(dirs) == 0 {
+		// Without any directories, the system temp directory is cleaned
+		dirs = []string{os.TempDir()}
+	}
+
+	if *olderThanVal < 0 {
+		log.Fatalf("Error: -older-than must not be negative, got %v", *olderThanVal)
+	}
+	applySizeFormat(*unitsVal, *precisionVal)
+
+	ctx := context.Background()
+	logLevel := trace.LogLevelNormal
+	if *verboseVal {
+		logLevel = trace.LogLevelVerbose
+	}
+	ctx = trace.WithContext(ctx, trace.NewTracer("MAIN", logLevel))
+
+	leftovers, err := padlock.FindLeftovers(ctx, dirs, *olderThanVal)
+	if err != nil {
+		log.Fatal(fmt.Errorf("clean failed: %w", err))
+	}
+	padlock.PrintLeftovers(os.Stdout, leftovers)
+	if *dryRunVal || len(leftovers) == 0 {
+		return
+	}
+
+	freed, err := padlock.RemoveLeftovers(ctx, leftovers)
+	fmt.Printf("Freed %s\n", padlock.FormatByteSize(freed))
+	if err != nil {
+		log.Fatal(fmt.Errorf("clean failed: %w", err))
+	}
+}
+
+// handleScatter handles the scatter command
+func handleScatter(args []string) {
+	fs := newFlagSet("scatter")
+	destinationsVal := fs.String("destinations", "", "file listing one local path or URL per line, one per collection")
+	verboseVal := fs.Bool("verbose", false, "enable detailed debug output")
+	unitsVal := fs.String("units", "bytes", "units for reported sizes: bytes, iec, or si")
+	precisionVal := fs.Int("precision", 1, "decimal places for iec and si sizes")
+	tmpdirVal := fs.String("tmpdir", "", "directory for temporary files, such as extracted TAR collections (default: the system's)")
+	spoolVal := fs.String("spool", "8M", "size above which data held for later is spooled to a temporary file instead of memory")
+	timeoutVal := fs.Duration("timeout", 0, "abort the operation if it takes longer than this (e.g. 2h)")
+	args = parseArgs(fs, args)
+	if len(args) != 1 || *destinationsVal == "" {
+		usage()
+	}
+	applySizeFormat(*unitsVal, *precisionVal)
+	applyTempPolicy(*tmpdirVal, *spoolVal)
+
+	destinations, err := padlock.ReadDestinationsFile(*destinationsVal)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	ctx := context.Background()
+	logLevel := trace.LogLevelNormal
+	if *verboseVal {
+		logLevel = trace.LogLevelVerbose
+	}
+	ctx = trace.WithContext(ctx, trace.NewTracer("MAIN", logLevel))
+
+	var report *padlock.DistributionReport
+	err = runOperation(ctx, *timeoutVal, func(ctx context.Context) error {
+		var err error
+		report, err = padlock.Scatter(ctx, padlock.ScatterConfig{InputDir: args[0], Destinations: destinations})
+		return err
+	})
+	if report != nil {
+		report.Print(os.Stdout)
+	}
+	exitOnError("scatter", err)
+	if report.Failed() > 0 {
+		os.Exit(1)
+	}
+}
+
+// handleGather handles the gather command
+func handleGather(args []string) {
+	fs := newFlagSet("gather")
+	destinationsVal := fs.String("destinations", "", "file listing one local path or URL per line")
+	allVal := fs.Bool("all", false, "gather from every destination, not just until enough collections are gathered")
+	metadataKeyVal := fs.String("metadata-key", "", "file containing the passphrase for encrypted collection metadata")
+	verboseVal := fs.Bool("verbose", false, "enable detailed debug output")
+	unitsVal := fs.String("units", "bytes", "units for reported sizes: bytes, iec, or si")
+	precisionVal := fs.Int("precision", 1, "decimal places for iec and si sizes")
+	tmpdirVal := fs.String("tmpdir", "", "directory for temporary files, such as extracted TAR collections (default: the system's)")
+	spoolVal := fs.String("spool", "8M", "size above which data held for later is spooled to a temporary file instead of memory")
+	timeoutVal := fs.Duration("timeout", 0, "abort the operation if it takes longer than this (e.g. 2h)")
+	args = parseArgs(fs, args)
+	if len(args) != 1 || *destinationsVal == "" {
+		usage()
+	}
+	applySizeFormat(*unitsVal, *precisionVal)
+	applyTempPolicy(*tmpdirVal, *spoolVal)
+
+	destinations, err := padlock.ReadDestinationsFile(*destinationsVal)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	ctx := context.Background()
+	logLevel := trace.LogLevelNormal
+	if *verboseVal {
+		logLevel = trace.LogLevelVerbose
+	}
+	ctx = trace.WithContext(ctx, trace.NewTracer("MAIN", logLevel))
+
+	cfg := padlock.GatherConfig{Destinations: destinations, OutputDir: args[0], All: *allVal}
+	if *metadataKeyVal != "" {
+		cfg.MetadataKey = readKeyFile(*metadataKeyVal)
+	}
+	var report *padlock.DistributionReport
+	err = runOperation(ctx, *timeoutVal, func(ctx context.Context) error {
+		var err error
+		report, err = padlock.Gather(ctx, cfg)
+		return err
+	})
+	if report != nil {
+		report.Print(os.Stdout)
+	}
+	exitOnError("gather", err)
+	if !report.Recoverable() {
+		os.Exit(1)
+	}
+}
+
+// isSet reports whether a flag was given on the command line, rather than left at its default
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// multipleInputs returns the input directories of an encode of several, or nil for one
+func multipleInputs(dirs []string) []string {
+	if len(dirs) < 2 {
+		return nil
+	}
+	return dirs
+}
+
+// inputFilter returns the filter the -exclude, -include, and -ignore-file flags describe, or
+// nil if none was given
+func inputFilter(exclude, include []string, ignoreFile string) *padlock.Filter {
+	if len(exclude) == 0 && len(include) == 0 && ignoreFile == "" {
+		return nil
+	}
+	filter, err := padlock.NewFilter(exclude, include)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if ignoreFile != "" {
+		if err := filter.AddIgnoreFile(ignoreFile); err != nil {
+			log.Fatalf("Error: -ignore-file: %v", err)
+		}
+	}
+	return filter
+}
+
+// applySizeFormat configures how sizes are reported from the -units and -precision flags
+func applySizeFormat(units string, precision int) {
+	u, err := file.ParseSizeUnits(units)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if precision < 0 {
+		log.Fatalf("Error: -precision must not be negative, got %d", precision)
+	}
+	padlock.SetSizeFormat(padlock.SizeFormat{Units: u, Precision: precision})
+}
+
+// applyTempPolicy applies the -tmpdir and -spool flags
+func applyTempPolicy(dir string, spool string) {
+	threshold, err := file.ParseSize(spool)
+	if err != nil || threshold <= 0 {
+		log.Fatalf("Error: invalid -spool %q: expected a positive size, e.g. 64M", spool)
+	}
+	if dir != "" {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			log.Fatalf("Error: -tmpdir %s is not a directory", dir)
+		}
+	}
+	padlock.SetTempPolicy(padlock.TempPolicy{Dir: dir, SpoolThreshold: threshold})
+}
+
+// retryPolicy builds the IO retry policy from the -retries and -retry-delay flags
+func retryPolicy(retries int, delay time.Duration) padlock.RetryPolicy {
+	if retries < 0 {
+		log.Fatalf("Error: -retries must not be negative, got %d", retries)
+	}
+	return file.NewRetryPolicy(retries+1, delay)
+}
+
+// archiveFormat parses the -archive flag, which only applies when collections are archived
+func archiveFormat(fs *flag.FlagSet, archive string, files bool) padlock.ArchiveFormat {
+	if files && isSet(fs, "archive") {
+		log.Fatalf("Error: -archive cannot be combined with -files")
+	}
+	format, err := file.ParseArchiveFormat(archive)
+	if err != nil {
+		log.Fatalf("Error: -archive: %v", err)
+	}
+	return format
+}
+
+// Exit statuses for operations stopped by a signal, following the shell convention of
+// 128 plus the signal number, so scripts can tell an interrupted run from a failed one
+const (
+	exitInterrupted = 130 // SIGINT
+	exitTerminated  = 143 // SIGTERM
+)
+
+// abandonGracePeriod is how long an operation has to stop after it is interrupted or its
+// deadline passes
+const abandonGracePeriod = 5 * time.Second
+
+// interruptedError reports that an operation was stopped by a signal
+type interruptedError struct {
+	sig os.Signal
+}
+
+func (e *interruptedError) Error() string {
+	return fmt.Sprintf("stopped by signal %q", e.sig)
+}
+
+// runOperation runs op with a context that is cancelled on SIGINT or SIGTERM and, if timeout
+// is nonzero, expires after timeout. The operation removes its partial output when its context
+// ends. If it is blocked in IO that can't be interrupted, such as on a dead network mount, it
+// is abandoned shortly afterwards so that the process can still exit. A second signal exits
+// immediately.
+func runOperation(ctx context.Context, timeout time.Duration, op func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		defer cancelTimeout()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case sig := <-signals:
+			// Restore the default behavior so that a second signal exits immediately
+			signal.Stop(signals)
+			log.Printf("Received %v: stopping and removing partial output (repeat to exit immediately)", sig)
+			cancel(&interruptedError{sig: sig})
+		case <-ctx.Done():
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- op(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Give the operation a moment to stop cleanly
+		select {
+		case err = <-done:
+		case <-time.After(abandonGracePeriod):
+			err = fmt.Errorf("operation did not stop, abandoning it: %w", ctx.Err())
+		}
+	}
+
+	if err != nil && ctx.Err() != nil {
+		if cause := context.Cause(ctx); cause != nil && cause != ctx.Err() {
+			return fmt.Errorf("%w: %v", cause, err)
+		}
+		if timeout > 0 {
+			return fmt.Errorf("timed out after %v: %w", timeout, err)
+		}
+	}
+	return err
+}
+
+// exitOnError exits the process if an operation failed, with a distinct status if it was
+// stopped by a signal
+func exitOnError(operation string, err error) {
+	if err == nil {
+		return
+	}
+	var interrupted *interruptedError
+	if errors.As(err, &interrupted) {
+		log.Printf("%s %v", operation, err)
+		if interrupted.sig == syscall.SIGTERM {
+			os.Exit(exitTerminated)
+		}
+		os.Exit(exitInterrupted)
+	}
+	log.Fatal(fmt.Errorf("%s failed: %w", operation, err))
+}
+
+// quietLog discards log output until the returned function is called, if quiet is set, so that
+// a JSON result is not mixed with log lines
+func quietLog(quiet bool) func() {
+	if !quiet {
+		return func() {}
+	}
+	log.SetOutput(io.Discard)
+	return func() { log.SetOutput(os.Stderr) }
+}
+
+// writeResult writes the result of an operation to stdout as JSON. The error returned by
+// runOperation is recorded, since it also reports an operation that was stopped or abandoned.
+func writeResult(result *padlock.Result, err error) {
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+	}
+	if err := result.WriteJSON(os.Stdout); err != nil {
+		log.Fatal(fmt.Errorf("failed to write result: %w", err))
+	}
+}
+
+// pipelineConfig builds the pipeline configuration from the -pipe-buffer and -max-memory flags
+func pipelineConfig(pipeBuffer, maxMemory string) padlock.PipelineConfig {
+	var cfg padlock.PipelineConfig
+	size, err := file.ParseSize(pipeBuffer)
+	if err != nil || size > 1<<30 {
+		log.Fatalf("Error: invalid -pipe-buffer %q", pipeBuffer)
+	}
+	cfg.PipeBufferSize = int(size)
+	if maxMemory != "" {
+		if cfg.MaxMemory, err = file.ParseSize(maxMemory); err != nil || cfg.MaxMemory == 0 {
+			log.Fatalf("Error: invalid -max-memory %q", maxMemory)
+		}
+	}
+	return cfg
+}
+
+// chunkSize parses the encode -chunk flag, a size or auto
+func chunkSize(value string) int {
+	if strings.EqualFold(value, "auto") {
+		return padlock.ChunkSizeAuto
+	}
+	size, err := file.ParseSize(value)
+	if err != nil || size == 0 || size > 1<<30 {
+		log.Fatalf("Error: invalid -chunk %q", value)
+	}
+	return int(size)
+}
+
+// sharing parses the -scheme and -mandatory flags
+func sharing(value string, mandatory string) pad.Sharing {
+	s, err := pad.SharingByName(strings.ToLower(value))
+	if err != nil || value == "" || strings.Contains(value, "+") {
+		log.Fatalf("Error: invalid -scheme %q: expected otp or shamir", value)
+	}
+	if mandatory == "" {
+		return s
+	}
+	if s != pad.Shamir {
+		log.Fatalf("Error: -mandatory needs -scheme shamir")
+	}
+	s, err = pad.ShamirMandatory(strings.Split(mandatory, ",")...)
+	if err != nil {
+		log.Fatalf("Error: invalid -mandatory %q: %v", mandatory, err)
+	}
+	return s
+}
+
+// parityPercent checks the -parity flag
+func parityPercent(value int) int {
+	if value < 0 || value > file.MaxParityPercent {
+		log.Fatalf("Error: -parity must be between 0 (none) and %d percent, got %d", file.MaxParityPercent, value)
+	}
+	return value
+}
+
+// par2Percent checks the -par2 flag
+func par2Percent(value int) int {
+	if value < 0 || value > file.MaxPar2Percent {
+		log.Fatalf("Error: -par2 must be between 0 (none) and %d percent, got %d", file.MaxPar2Percent, value)
+	}
+	return value
+}
+
+// chunkCount parses the encode -chunks flag
+func chunkCount(value string) padlock.ChunkRange {
+	count, err := padlock.ParseChunkRange(value)
+	if err != nil {
+		log.Fatalf("Error: -chunks: %v", err)
+	}
+	return count
+}
+
+// readKeyFile reads an HMAC key from a file, ignoring surrounding whitespace
+func readKeyFile(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Error: Cannot read key file %s: %v", path, err)
+	}
+	key := []byte(strings.TrimSpace(string(data)))
+	if len(key) == 0 {
+		log.Fatalf("Error: Key file %s is empty", path)
+	}
+	return key
+}
+
+// passphrase returns the passphrase given by -passphrase-file, or prompted for on the terminal
+// without echo if -passphrase was given, or nil for neither. With confirm, as when encoding,
+// the prompt asks for it twice, since a mistyped passphrase makes the data unrecoverable.
+func passphrase(prompt bool, path string, confirm bool) []byte {
+	if path != "" {
+		if prompt {
+			log.Fatalf("Error: -passphrase cannot be combined with -passphrase-file")
+		}
+		return readKeyFile(path)
+	}
+	if !prompt {
+		return nil
+	}
+
+	// Prompt on the terminal even if stdin or stdout carry chunks, as with -stdin and -stdout
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		tty = os.Stdin
+	} else {
+		defer tty.Close()
+	}
+	if !term.IsTerminal(int(tty.Fd())) {
+		log.Fatalf("Error: -passphrase needs a terminal to prompt on; use -passphrase-file instead")
+	}
+	read := func(prompt string) []byte {
+		fmt.Fprint(os.Stderr, prompt)
+		value, err := term.ReadPassword(int(tty.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			log.Fatalf("Error: Cannot read passphrase: %v", err)
+		}
+		return value
+	}
+	value := read("Passphrase: ")
+	if len(value) == 0 {
+		log.Fatalf("Error: The passphrase is empty")
+	}
+	if confirm && string(read("Repeat passphrase: ")) != string(value) {
+		log.Fatalf("Error: The passphrases don't match")
+	}
+	return value
+}
@@ -0,0 +1,50 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/padlock"
+)
+
+// TestEncodeJSONStdout checks that encode -json writes nothing to stdout but the result, even
+// when the encode is long enough for the verify pass to report progress
+func TestEncodeJSONStdout(t *testing.T) {
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	content := make([]byte, 64<<10)
+	rand.Read(content)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.bin"), content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	stdout, err := os.Create(filepath.Join(tempDir, "stdout"))
+	if err != nil {
+		t.Fatalf("Failed to create stdout file: %v", err)
+	}
+	defer stdout.Close()
+	saved := os.Stdout
+	os.Stdout = stdout
+	handleEncode([]string{inputDir, filepath.Join(tempDir, "output"), "-copies", "3", "-required", "2", "-chunk", "1K", "-json"})
+	os.Stdout = saved
+
+	out, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatalf("Failed to read stdout: %v", err)
+	}
+	var result padlock.Result
+	if err := json.Unmarshal(out, &result); err != nil {
+		t.Fatalf("Expected stdout to be a JSON result: %v\n%s", err, out)
+	}
+	if !result.Success || result.Chunks < 40 {
+		t.Errorf("Expected a successful encode of at least 40 chunks, got %+v", result)
+	}
+}
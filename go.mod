@@ -3,8 +3,10 @@ module github.com/blues/padlock
 go 1.24.2
 
 require (
+	github.com/klauspost/compress v1.18.0
 	github.com/seehuhn/mt19937 v1.0.0
 	golang.org/x/crypto v0.37.0
+	golang.org/x/term v0.31.0
 )
 
 require golang.org/x/sys v0.32.0 // indirect
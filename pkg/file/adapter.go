@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"path/filepath"
 
 	"github.com/blues/padlock/pkg/trace"
 )
@@ -30,6 +31,9 @@ type NamedChunkWriter struct {
 	CollPath  string
 	CollName  string // Use this name for the files instead of basename
 	ChunkNum  int
+	Checksum  bool        // Write a SHA-256 sidecar file next to the chunk
+	Parity    int         // If positive, write a Reed-Solomon parity sidecar with this percentage overhead
+	Retry     RetryPolicy // Retry policy for transient write failures
 	chunkData []byte
 }
 
@@ -239,7 +243,31 @@ func (cw *NamedChunkWriter) Close() error {
 	}
 
 	// Call the custom write function that uses Collection name instead of path basename
-	return WriteNamedChunk(cw.Ctx, cw.Formatter, cw.CollPath, cw.CollName, cw.ChunkNum, cw.chunkData)
+	// Chunk files are rewritten from scratch, so transient failures can be retried safely
+	err := cw.Retry.Do(cw.Ctx, fmt.Sprintf("write chunk %d of %s", cw.ChunkNum, cw.CollName), func() error {
+		return WriteNamedChunk(cw.Ctx, cw.Formatter, cw.CollPath, cw.CollName, cw.ChunkNum, cw.chunkData)
+	})
+	if err != nil {
+		return err
+	}
+
+	if !cw.Checksum && cw.Parity <= 0 {
+		return nil
+	}
+	fname, err := NamedChunkFileName(cw.Formatter, cw.CollName, cw.ChunkNum)
+	if err != nil {
+		return err
+	}
+	chunkPath := filepath.Join(cw.CollPath, fname)
+	if cw.Parity > 0 {
+		if err := WriteParitySidecar(cw.Ctx, chunkPath, cw.Parity); err != nil {
+			return err
+		}
+	}
+	if !cw.Checksum {
+		return nil
+	}
+	return WriteChecksumSidecar(cw.Ctx, chunkPath)
 }
 
 // ChunkReaderAdapter adapts a CollectionReader to io.Reader
@@ -7,15 +7,12 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"image"
-	"image/color"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/blues/padlock/pkg/trace"
 )
@@ -31,8 +28,8 @@ var TarCollection = func(ctx context.Context, collPath string) (string, error) {
 
 	log.Debugf("Creating tar archive for collection %s: %s", collName, tarPath)
 
-	// Create tar file
-	tarFile, err := os.Create(tarPath)
+	// Create tar file, under its partial name until it is complete
+	tarFile, err := os.Create(PartialPath(tarPath))
 	if err != nil {
 		log.Error(fmt.Errorf("failed to create tar file %s: %w", tarPath, err))
 		return "", fmt.Errorf("failed to create tar file %s: %w", tarPath, err)
@@ -97,20 +94,15 @@ var TarCollection = func(ctx context.Context, collPath string) (string, error) {
 	if err != nil {
 		tarWriter.Close()
 		tarFile.Close()
+		os.Remove(PartialPath(tarPath))
 		log.Error(fmt.Errorf("error creating tar for collection %s: %w", collName, err))
 		return "", fmt.Errorf("error creating tar for collection %s: %w", collName, err)
 	}
 
-	// Close the tar writer and file
-	if err := tarWriter.Close(); err != nil {
-		tarFile.Close()
-		log.Error(fmt.Errorf("failed to close tar writer: %w", err))
-		return "", fmt.Errorf("failed to close tar writer: %w", err)
-	}
-
-	if err := tarFile.Close(); err != nil {
-		log.Error(fmt.Errorf("failed to close tar file: %w", err))
-		return "", fmt.Errorf("failed to close tar file: %w", err)
+	// Close the tar writer and file, and give the archive its final name
+	if err := closePartialTar(tarWriter, tarFile, tarPath); err != nil {
+		log.Error(err)
+		return "", err
 	}
 
 	log.Debugf("Successfully created tar archive: %s", tarPath)
@@ -245,35 +237,71 @@ func TarCollections(ctx context.Context, collections []Collection) ([]string, er
 }
 
 // TarChunkWriter is an implementation of io.WriteCloser that writes chunks directly to a TAR file
-// instead of temporary files, avoiding the need to write to disk twice
+// instead of temporary files, avoiding the need to write to disk twice. If the path ends in .zip,
+// a store-only ZIP file is written instead.
 type TarChunkWriter struct {
-	Ctx       context.Context
-	TarPath   string
-	CollName  string
-	ChunkNum  int
-	Format    Format
-	chunkData []byte
-	tarFile   *os.File
-	tarWriter *tar.Writer
-	mutex     sync.Mutex // Protects concurrent writes to the same tar
+	Ctx      context.Context
+	TarPath  string
+	CollName string
+	ChunkNum int
+	Format   Format
+	Covers   *CoverImages // Photos used in turn as the visible image of PNG chunks, if set
+
+	// PNGEmbedding is how data is hidden in PNG chunks; a 'rAWd' chunk if empty
+	PNGEmbedding PNGEmbedding
+	chunkData    []byte          // Data of the chunk in progress, for formats that encode it as a whole
+	spool        *entrySpool     // The chunk's archive entry, until its size is known
+	bin          *binChunkWriter // Frames binary chunks with their header and CRC as they are spooled
+	tarFile      *os.File
+	tarWriter    archiveWriter
+	mutex        sync.Mutex // Protects concurrent writes to the same tar
+
+	// Volume splitting, used when volumeSize is positive
+	volumeSize  int64        // Maximum size of each volume file
+	volumeBytes int64        // Upper bound on the size of the current volume so far
+	volumes     []VolumeInfo // Volumes written so far, the last being the current one
+
+	registry *TarWriterRegistry // The registry the writer is kept in until it is finalized
+	appended bool               // The archive continues one that already existed, which an abort leaves in place
+}
+
+// TarWriterRegistry holds the TarChunkWriters of one encode by archive path, so that every
+// chunk of a collection is appended to the same archive, and so that all of the encode's
+// archives can be finalized, or aborted, together. Each encode owns its own registry, so
+// that encodes running at the same time in one process never share a writer.
+type TarWriterRegistry struct {
+	mutex   sync.Mutex
+	writers map[string]*TarChunkWriter
 }
 
-// Map of TarChunkWriters by tar path for global access and cleanup
-var tarWriterMutex sync.Mutex
-var tarWriters = make(map[string]*TarChunkWriter)
+// NewTarWriterRegistry creates an empty registry for an encode's archives
+func NewTarWriterRegistry() *TarWriterRegistry {
+	return &TarWriterRegistry{writers: make(map[string]*TarChunkWriter)}
+}
+
+// TarChunkWriter returns the writer streaming chunks to the TAR or ZIP file at tarPath,
+// creating it the first time the path is used
+func (r *TarWriterRegistry) TarChunkWriter(ctx context.Context, tarPath string, collName string, format Format) (*TarChunkWriter, error) {
+	return r.VolumeChunkWriter(ctx, tarPath, collName, format, 0)
+}
 
-// NewTarChunkWriter creates a new TarChunkWriter for streaming chunks directly to a TAR file
-func NewTarChunkWriter(ctx context.Context, tarPath string, collName string, format Format) (*TarChunkWriter, error) {
+// VolumeChunkWriter returns a TarChunkWriter that splits the archive at tarPath into
+// numbered volumes of at most volumeSize bytes, each a complete archive holding whole chunks.
+// The volumes are named by VolumePath and listed in a manifest at VolumeManifestPath when the
+// archive is finalized. A volumeSize of zero writes a single archive, like TarChunkWriter.
+func (r *TarWriterRegistry) VolumeChunkWriter(ctx context.Context, tarPath string, collName string, format Format, volumeSize int64) (*TarChunkWriter, error) {
 	log := trace.FromContext(ctx).WithPrefix("TAR-CHUNK-WRITER")
 
 	// Check if we already have a writer for this tar path
-	tarWriterMutex.Lock()
-	defer tarWriterMutex.Unlock()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 
-	if writer, exists := tarWriters[tarPath]; exists {
+	if writer, exists := r.writers[tarPath]; exists {
 		log.Debugf("Reusing existing TAR writer for collection %s at %s", collName, tarPath)
 		// Always reset chunk data to ensure we don't mix data from previous chunks
-		writer.chunkData = make([]byte, 0)
+		writer.chunkData = writer.chunkData[:0]
+		writer.spool.Reset()
+		writer.bin = nil
 		return writer, nil
 	}
 
@@ -281,7 +309,6 @@ func NewTarChunkWriter(ctx context.Context, tarPath string, collName string, for
 
 	// Create/open the tar file
 	var tarFile *os.File
-	var tarWriter *tar.Writer
 	var err error
 
 	// Create parent directory if needed
@@ -290,15 +317,19 @@ func NewTarChunkWriter(ctx context.Context, tarPath string, collName string, for
 		return nil, fmt.Errorf("failed to create directory for tar file: %w", err)
 	}
 
-	// Create or open the tar file
-	tarFile, err = os.OpenFile(tarPath, os.O_CREATE|os.O_RDWR, 0644)
+	// Create the tar file, or its first volume, under its partial name until it is finalized
+	filePath := tarPath
+	if volumeSize > 0 {
+		filePath = VolumePath(tarPath, 1)
+	}
+	tarFile, err = os.OpenFile(PartialPath(filePath), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
 	if err != nil {
-		log.Error(fmt.Errorf("failed to create/open tar file %s: %w", tarPath, err))
-		return nil, fmt.Errorf("failed to create/open tar file %s: %w", tarPath, err)
+		log.Error(fmt.Errorf("failed to create/open tar file %s: %w", filePath, err))
+		return nil, fmt.Errorf("failed to create/open tar file %s: %w", filePath, err)
 	}
 
-	// Create tar writer directly without gzip compression
-	tarWriter = tar.NewWriter(tarFile)
+	// Create the archive writer directly without compression
+	tarWriter := newArchiveWriter(tarPath, tarFile)
 
 	writer := &TarChunkWriter{
 		Ctx:       ctx,
@@ -306,32 +337,113 @@ func NewTarChunkWriter(ctx context.Context, tarPath string, collName string, for
 		CollName:  collName,
 		Format:    format,
 		chunkData: make([]byte, 0),
+		spool:     &entrySpool{dir: filepath.Dir(tarPath)},
 		tarFile:   tarFile,
 		tarWriter: tarWriter,
+		registry:  r,
+	}
+	if volumeSize > 0 {
+		writer.volumeSize = volumeSize
+		writer.volumes = []VolumeInfo{{Name: filepath.Base(filePath)}}
+	}
+
+	// Store the writer in the registry for later reuse and cleanup
+	r.writers[tarPath] = writer
+
+	return writer, nil
+}
+
+// AppendChunkWriter returns a TarChunkWriter that adds chunks to the existing TAR file at
+// tarPath. The entries already in it are copied to its partial name first, and the copy
+// replaces it when it is finalized, so the archive stays as it was if the append is aborted.
+func (r *TarWriterRegistry) AppendChunkWriter(ctx context.Context, tarPath string, collName string, format Format) (*TarChunkWriter, error) {
+	log := trace.FromContext(ctx).WithPrefix("TAR-CHUNK-WRITER")
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.writers[tarPath]; exists {
+		return nil, fmt.Errorf("%s is already being written", tarPath)
+	}
+	if ArchiveFormatOf(tarPath) != ArchiveTar {
+		return nil, fmt.Errorf("only TAR archives can be appended to, not %s", tarPath)
+	}
+
+	log.Debugf("Appending to the TAR of collection %s at %s", collName, tarPath)
+	existing, err := os.Open(tarPath)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to open tar file %s: %w", tarPath, err))
+		return nil, fmt.Errorf("failed to open tar file %s: %w", tarPath, err)
+	}
+	defer existing.Close()
+	tarFile, err := os.OpenFile(PartialPath(tarPath), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to create tar file %s: %w", PartialPath(tarPath), err))
+		return nil, fmt.Errorf("failed to create tar file %s: %w", PartialPath(tarPath), err)
 	}
 
-	// Store the writer in the map for later reuse and cleanup
-	tarWriters[tarPath] = writer
+	// Copy the existing entries as they are, leaving the archive open for more
+	tarWriter := &tarArchiveWriter{tw: tar.NewWriter(tarFile)}
+	tarReader := tar.NewReader(existing)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = tarWriter.tw.WriteHeader(header)
+		}
+		if err == nil {
+			_, err = io.Copy(tarWriter.tw, tarReader)
+		}
+		if err != nil {
+			tarFile.Close()
+			os.Remove(PartialPath(tarPath))
+			log.Error(fmt.Errorf("failed to copy %s: %w", tarPath, err))
+			return nil, fmt.Errorf("failed to copy %s: %w", tarPath, err)
+		}
+	}
 
+	writer := &TarChunkWriter{
+		Ctx:       ctx,
+		TarPath:   tarPath,
+		CollName:  collName,
+		Format:    format,
+		chunkData: make([]byte, 0),
+		spool:     &entrySpool{dir: filepath.Dir(tarPath)},
+		tarFile:   tarFile,
+		tarWriter: tarWriter,
+		registry:  r,
+		appended:  true,
+	}
+	r.writers[tarPath] = writer
 	return writer, nil
 }
 
-// Write implements io.Writer interface for TarChunkWriter
+// Write implements io.Writer interface for TarChunkWriter. Binary chunks only need a header
+// and CRC around them, so they go straight to the spool; other formats encode the chunk as a
+// whole when it is closed.
 func (tw *TarChunkWriter) Write(p []byte) (n int, err error) {
 	tw.mutex.Lock()
 	defer tw.mutex.Unlock()
 
+	if tw.Format == FormatBin {
+		if tw.bin == nil {
+			tw.bin = &binChunkWriter{w: tw.spool}
+		}
+		return tw.bin.Write(p)
+	}
 	tw.chunkData = append(tw.chunkData, p...)
 	return len(p), nil
 }
 
 // validateRandomness performs basic statistical tests on data to ensure it appears random for TarChunkWriter
-func (tw *TarChunkWriter) validateRandomness() error {
+func (tw *TarChunkWriter) validateRandomness(size int64) error {
 	log := trace.FromContext(tw.Ctx).WithPrefix("RANDOMNESS-CHECK")
 
 	// Skip validation for very small chunks (less than 32 bytes)
-	if len(tw.chunkData) < 32 {
-		log.Debugf("Skipping randomness check for small chunk (%d bytes)", len(tw.chunkData))
+	if size < 32 {
+		log.Debugf("Skipping randomness check for small chunk (%d bytes)", size)
 		return nil
 	}
 
@@ -351,63 +463,72 @@ func (tw *TarChunkWriter) Close() error {
 	log := trace.FromContext(tw.Ctx).WithPrefix("TAR-CHUNK-WRITER")
 
 	// Validate randomness
-	if err := tw.validateRandomness(); err != nil {
+	chunkBytes := int64(len(tw.chunkData))
+	if tw.Format == FormatBin {
+		chunkBytes = tw.spool.Size()
+		if tw.bin == nil {
+			tw.bin = &binChunkWriter{w: tw.spool}
+		}
+		if err := tw.bin.Close(); err != nil {
+			log.Error(fmt.Errorf("failed to write bin chunk CRC: %w", err))
+			return fmt.Errorf("failed to write bin chunk CRC: %w", err)
+		}
+	}
+	if err := tw.validateRandomness(chunkBytes); err != nil {
 		log.Error(fmt.Errorf("randomness validation failed: %w", err))
 	}
 
 	// Generate the entry name based on format and collection name
 	var entryName string
 	if tw.Format == FormatPNG {
-		entryName = fmt.Sprintf("IMG%s_%04d.PNG", tw.CollName, tw.ChunkNum)
+		entryName = fmt.Sprintf("IMG%s_%s.PNG", tw.CollName, formatChunkNumber(tw.ChunkNum))
+	} else if tw.Format == FormatText {
+		entryName = fmt.Sprintf("%s_%s.txt", tw.CollName, formatChunkNumber(tw.ChunkNum))
+	} else if tw.Format == FormatWAV {
+		entryName = fmt.Sprintf("REC%s_%s.WAV", tw.CollName, formatChunkNumber(tw.ChunkNum))
 	} else {
-		entryName = fmt.Sprintf("%s_%04d.bin", tw.CollName, tw.ChunkNum)
+		entryName = fmt.Sprintf("%s_%s.bin", tw.CollName, formatChunkNumber(tw.ChunkNum))
 	}
 
-	log.Debugf("Creating tar entry: %s (size: %d bytes)", entryName, len(tw.chunkData))
+	log.Debugf("Creating tar entry: %s (size: %d bytes)", entryName, chunkBytes)
 
-	// If using PNG format, convert the data first
-	var data []byte
+	// Encode the chunk into the spool, which binary chunks were written to directly. The
+	// entry is only added to the archive once it is complete, since its header holds its size.
 	if tw.Format == FormatPNG {
-		// Create a minimal PNG with the data
-		img := image.NewRGBA(image.Rect(0, 0, 1, 1))
-		img.Set(0, 0, color.Transparent)
-
-		// Use a separate buffer for each PNG to avoid mixing data
-		var pngBuf bytes.Buffer
-		if err := encodePNGWithData(&pngBuf, img, tw.chunkData); err != nil {
+		// Wrap the data in a cover photo, or a minimal PNG if there are none
+		if err := writePNGChunk(tw.spool, tw.Covers, tw.PNGEmbedding, tw.chunkData); err != nil {
 			log.Error(fmt.Errorf("failed to encode PNG: %w", err))
 			return fmt.Errorf("failed to encode PNG: %w", err)
 		}
-		data = pngBuf.Bytes()
-	} else {
-		// Use raw binary data
-		data = tw.chunkData
-	}
-
-	// Create the tar header
-	header := &tar.Header{
-		Name:    entryName,
-		Mode:    0644,
-		Size:    int64(len(data)),
-		ModTime: time.Now(),
+	} else if tw.Format == FormatText {
+		if err := EncodeTextArmor(tw.spool, tw.CollName, tw.ChunkNum, tw.chunkData); err != nil {
+			log.Error(fmt.Errorf("failed to encode text chunk: %w", err))
+			return fmt.Errorf("failed to encode text chunk: %w", err)
+		}
+	} else if tw.Format == FormatWAV {
+		if err := encodeWAVWithData(tw.spool, tw.chunkData); err != nil {
+			log.Error(fmt.Errorf("failed to encode WAV: %w", err))
+			return fmt.Errorf("failed to encode WAV: %w", err)
+		}
 	}
+	tw.chunkData = tw.chunkData[:0]
 
-	// Write the header to the tar stream
-	if err := tw.tarWriter.WriteHeader(header); err != nil {
-		log.Error(fmt.Errorf("failed to write tar header: %w", err))
-		return fmt.Errorf("failed to write tar header: %w", err)
+	// Stream the entry into the archive
+	size := tw.spool.Size()
+	entry, err := tw.spool.Reader()
+	if err != nil {
+		log.Error(err)
+		return err
 	}
-
-	// Write the data to the tar entry
-	if _, err := tw.tarWriter.Write(data); err != nil {
-		log.Error(fmt.Errorf("failed to write data to tar entry: %w", err))
-		return fmt.Errorf("failed to write data to tar entry: %w", err)
+	if err := tw.addEntry(entryName, size, entry, true); err != nil {
+		log.Error(err)
+		return err
 	}
 
-	log.Debugf("Successfully wrote %d bytes to tar entry %s", len(data), entryName)
+	log.Debugf("Successfully wrote %d bytes to tar entry %s", size, entryName)
 
-	// Clear the chunk data after writing to the tar to avoid reusing it
-	tw.chunkData = make([]byte, 0)
+	// Clear the entry after writing it to the tar to avoid reusing it
+	tw.spool.Reset()
 
 	// Don't close the tar writer or file here - they're kept open for additional chunks
 	// They will be closed when all chunks are written
@@ -415,13 +536,118 @@ func (tw *TarChunkWriter) Close() error {
 	return nil
 }
 
-// FinalizeTar closes the tar writer and file when all chunks have been written
+// AddFile writes a non-chunk entry, such as collection metadata, to the TAR file
+func (tw *TarChunkWriter) AddFile(name string, data []byte) error {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+
+	log := trace.FromContext(tw.Ctx).WithPrefix("TAR-CHUNK-WRITER")
+
+	if err := tw.addEntry(name, int64(len(data)), bytes.NewReader(data), false); err != nil {
+		log.Error(fmt.Errorf("failed to write archive entry %s: %w", name, err))
+		return fmt.Errorf("failed to write archive entry %s: %w", name, err)
+	}
+
+	log.Debugf("Added %s (%d bytes) to %s", name, len(data), tw.TarPath)
+	return nil
+}
+
+// addEntry writes an entry of size bytes read from r to the archive, first starting a new
+// volume if the entry would make the current one larger than the volume size
+func (tw *TarChunkWriter) addEntry(name string, size int64, r io.Reader, chunk bool) error {
+	if tw.volumeSize > 0 {
+		entrySize := tw.tarWriter.EntrySize(name, size)
+		if entrySize+tw.tarWriter.TrailerSize() > tw.volumeSize {
+			return fmt.Errorf("%s (%d bytes) does not fit in a volume of %d bytes", name, size, tw.volumeSize)
+		}
+		if tw.volumeBytes+entrySize+tw.tarWriter.TrailerSize() > tw.volumeSize {
+			if err := tw.nextVolume(); err != nil {
+				return err
+			}
+		}
+		tw.volumeBytes += entrySize
+		if chunk {
+			tw.volumes[len(tw.volumes)-1].Chunks++
+		}
+	}
+	return tw.tarWriter.AddEntry(name, size, r)
+}
+
+// nextVolume closes the current volume and starts the next one
+func (tw *TarChunkWriter) nextVolume() error {
+	if err := tw.closeVolume(); err != nil {
+		return err
+	}
+
+	filePath := VolumePath(tw.TarPath, len(tw.volumes)+1)
+	trace.FromContext(tw.Ctx).WithPrefix("TAR-CHUNK-WRITER").Debugf("Starting volume %s", filePath)
+	tarFile, err := os.OpenFile(PartialPath(filePath), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create volume %s: %w", filePath, err)
+	}
+	tw.tarFile = tarFile
+	tw.tarWriter = newArchiveWriter(filePath, tarFile)
+	tw.volumeBytes = 0
+	tw.volumes = append(tw.volumes, VolumeInfo{Name: filepath.Base(filePath)})
+	return nil
+}
+
+// closeVolume closes the archive writer and file of the current volume and records its size
+func (tw *TarChunkWriter) closeVolume() error {
+	if err := tw.tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close tar writer: %w", err)
+	}
+	info, err := tw.tarFile.Stat()
+	if err != nil {
+		tw.tarFile.Close()
+		return fmt.Errorf("failed to stat volume: %w", err)
+	}
+	if err := tw.tarFile.Close(); err != nil {
+		return fmt.Errorf("failed to close tar file: %w", err)
+	}
+	tw.volumes[len(tw.volumes)-1].Size = info.Size()
+	return nil
+}
+
+// FinalizeTar closes the tar writer and file when all chunks have been written, and renames
+// the archive, or its volumes, from their partial names. Volumes are renamed before their
+// manifest is written, so a manifest only ever lists complete volumes.
 func (tw *TarChunkWriter) FinalizeTar() error {
 	tw.mutex.Lock()
 	defer tw.mutex.Unlock()
 
 	log := trace.FromContext(tw.Ctx).WithPrefix("TAR-CHUNK-WRITER")
 	log.Debugf("Finalizing tar file: %s", tw.TarPath)
+	defer tw.spool.Close()
+
+	// Close the last volume and list every volume in the manifest
+	if tw.volumeSize > 0 {
+		if err := tw.closeVolume(); err != nil {
+			log.Error(err)
+			return err
+		}
+		for _, volume := range tw.volumes {
+			if err := CommitPartial(filepath.Join(filepath.Dir(tw.TarPath), volume.Name)); err != nil {
+				log.Error(fmt.Errorf("failed to rename volume %s: %w", volume.Name, err))
+				return fmt.Errorf("failed to rename volume %s: %w", volume.Name, err)
+			}
+		}
+		manifest := &VolumeManifest{
+			Version:    1,
+			Collection: tw.CollName,
+			VolumeSize: tw.volumeSize,
+			Volumes:    tw.volumes,
+		}
+		if err := WriteVolumeManifest(VolumeManifestPath(tw.TarPath), manifest); err != nil {
+			log.Error(err)
+			return err
+		}
+
+		tw.registry.remove(tw)
+
+		log.Debugf("Successfully finalized %d volumes of %s", len(tw.volumes), tw.TarPath)
+		return nil
+	}
 
 	// Close the tar writer
 	if err := tw.tarWriter.Close(); err != nil {
@@ -435,29 +661,46 @@ func (tw *TarChunkWriter) FinalizeTar() error {
 		return fmt.Errorf("failed to close tar file: %w", err)
 	}
 
-	// Remove from the map
-	tarWriterMutex.Lock()
-	delete(tarWriters, tw.TarPath)
-	tarWriterMutex.Unlock()
+	// An archive that was appended to replaces the one it continues
+	commit := CommitPartial
+	if tw.appended {
+		commit = func(path string) error { return os.Rename(PartialPath(path), path) }
+	}
+	if err := commit(tw.TarPath); err != nil {
+		log.Error(fmt.Errorf("failed to rename tar file: %w", err))
+		return fmt.Errorf("failed to rename tar file: %w", err)
+	}
+
+	// Remove from the registry
+	tw.registry.remove(tw)
 
 	log.Debugf("Successfully finalized tar file: %s", tw.TarPath)
 	return nil
 }
 
-// FinalizeAllTarWriters closes all open TAR writers
-// This function should be called at the end of encoding to ensure all TAR files are properly closed
-func FinalizeAllTarWriters(ctx context.Context) error {
+// remove drops a finalized writer from the registry
+func (r *TarWriterRegistry) remove(tw *TarChunkWriter) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.writers[tw.TarPath] == tw {
+		delete(r.writers, tw.TarPath)
+	}
+}
+
+// FinalizeAll closes all of the registry's open TAR writers. It should be called at the end
+// of encoding to ensure all TAR files are properly closed.
+func (r *TarWriterRegistry) FinalizeAll(ctx context.Context) error {
 	log := trace.FromContext(ctx).WithPrefix("TAR-CHUNK-WRITER")
 	log.Debugf("Finalizing all TAR writers")
 
-	tarWriterMutex.Lock()
-	writers := make([]*TarChunkWriter, 0, len(tarWriters))
+	r.mutex.Lock()
+	writers := make([]*TarChunkWriter, 0, len(r.writers))
 
-	// Collect all writers and paths to avoid modifying the map during iteration
-	for _, writer := range tarWriters {
+	// Collect all writers to avoid modifying the map during iteration
+	for _, writer := range r.writers {
 		writers = append(writers, writer)
 	}
-	tarWriterMutex.Unlock()
+	r.mutex.Unlock()
 
 	if len(writers) == 0 {
 		log.Debugf("No TAR writers to finalize")
@@ -477,11 +720,6 @@ func FinalizeAllTarWriters(ctx context.Context) error {
 		}
 	}
 
-	// Clear the map
-	tarWriterMutex.Lock()
-	tarWriters = make(map[string]*TarChunkWriter)
-	tarWriterMutex.Unlock()
-
 	if lastErr != nil {
 		return fmt.Errorf("failed to finalize one or more TAR writers: %w", lastErr)
 	}
@@ -490,6 +728,45 @@ func FinalizeAllTarWriters(ctx context.Context) error {
 	return nil
 }
 
+// AbortAll closes all of the registry's open TAR writers without finalizing them and removes
+// their TAR files and any volumes, so that an interrupted encode leaves no truncated archive
+// behind. An archive that was being appended to keeps the entries it had before.
+func (r *TarWriterRegistry) AbortAll(ctx context.Context) {
+	log := trace.FromContext(ctx).WithPrefix("TAR-CHUNK-WRITER")
+
+	r.mutex.Lock()
+	writers := r.writers
+	r.writers = make(map[string]*TarChunkWriter)
+	r.mutex.Unlock()
+
+	// The writer mutexes aren't taken, since a writer may be blocked in IO while holding one
+	for _, writer := range writers {
+		writer.tarFile.Close()
+		if spool := writer.spool.file; spool != nil {
+			spool.Close()
+			os.Remove(spool.Name())
+		}
+		paths := []string{writer.TarPath}
+		for _, volume := range writer.volumes {
+			paths = append(paths, filepath.Join(filepath.Dir(writer.TarPath), volume.Name))
+		}
+		for _, path := range paths {
+			if err := os.Remove(PartialPath(path)); err != nil && !os.IsNotExist(err) {
+				log.Error(fmt.Errorf("failed to remove partial tar file %s: %w", PartialPath(path), err))
+			}
+			// Volumes are renamed before their manifest is written, so some may be complete
+			if writer.appended {
+				continue
+			}
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				log.Error(fmt.Errorf("failed to remove partial tar file %s: %w", path, err))
+				continue
+			}
+			log.Debugf("Removed partial tar file: %s", path)
+		}
+	}
+}
+
 // TarDirectoryContents creates a TAR archive of contents in a directory without removing the directory,
 // but removes all the original files after creating the archive
 func TarDirectoryContents(ctx context.Context, dirPath string, collName string) (string, error) {
@@ -498,17 +775,15 @@ func TarDirectoryContents(ctx context.Context, dirPath string, collName string)
 	tarPath := filepath.Join(dirPath, collName+".tar")
 	log.Debugf("Creating tar archive for collection %s: %s", collName, tarPath)
 
-	// Create tar file
-	tarFile, err := os.Create(tarPath)
+	// Create tar file, under its partial name until it is complete
+	tarFile, err := os.Create(PartialPath(tarPath))
 	if err != nil {
 		log.Error(fmt.Errorf("failed to create tar file %s: %w", tarPath, err))
 		return "", fmt.Errorf("failed to create tar file %s: %w", tarPath, err)
 	}
-	defer tarFile.Close()
 
 	// Create tar writer directly without gzip compression
 	tarWriter := tar.NewWriter(tarFile)
-	defer tarWriter.Close()
 
 	// Keep track of all files we add to the tar (to delete later)
 	var filesToDelete []string
@@ -519,8 +794,8 @@ func TarDirectoryContents(ctx context.Context, dirPath string, collName string)
 			return err
 		}
 
-		// Skip directories and the tar file itself
-		if info.IsDir() || path == tarPath {
+		// Skip directories, the tar file itself, and the lock of the encode writing it
+		if info.IsDir() || path == tarPath || path == PartialPath(tarPath) || info.Name() == LockFileName {
 			return nil
 		}
 
@@ -570,10 +845,19 @@ func TarDirectoryContents(ctx context.Context, dirPath string, collName string)
 	})
 
 	if err != nil {
+		tarWriter.Close()
+		tarFile.Close()
+		os.Remove(PartialPath(tarPath))
 		log.Error(fmt.Errorf("error creating tar for collection %s: %w", collName, err))
 		return "", fmt.Errorf("error creating tar for collection %s: %w", collName, err)
 	}
 
+	// The original files are only deleted once the archive is complete under its final name
+	if err := closePartialTar(tarWriter, tarFile, tarPath); err != nil {
+		log.Error(err)
+		return "", err
+	}
+
 	// After successful tar creation, delete all the original files
 	for _, filePath := range filesToDelete {
 		if err := os.Remove(filePath); err != nil {
@@ -587,3 +871,22 @@ func TarDirectoryContents(ctx context.Context, dirPath string, collName string)
 	log.Debugf("Successfully created tar archive: %s", tarPath)
 	return tarPath, nil
 }
+
+// closePartialTar closes a tar archive written under its partial name and renames it to
+// tarPath, removing it instead if it couldn't be completed
+func closePartialTar(tarWriter *tar.Writer, tarFile *os.File, tarPath string) error {
+	if err := tarWriter.Close(); err != nil {
+		tarFile.Close()
+		os.Remove(PartialPath(tarPath))
+		return fmt.Errorf("failed to close tar writer: %w", err)
+	}
+	if err := tarFile.Close(); err != nil {
+		os.Remove(PartialPath(tarPath))
+		return fmt.Errorf("failed to close tar file: %w", err)
+	}
+	if err := CommitPartial(tarPath); err != nil {
+		os.Remove(PartialPath(tarPath))
+		return fmt.Errorf("failed to rename tar file: %w", err)
+	}
+	return nil
+}
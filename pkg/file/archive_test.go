@@ -3,9 +3,13 @@
 package file
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 	"testing"
 
 	"github.com/blues/padlock/pkg/trace"
@@ -160,3 +164,209 @@ func TestExtractTarCollection(t *testing.T) {
 		}
 	}
 }
+
+func TestTarWriterRegistriesAreIsolated(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	tempDir, err := os.MkdirTemp("", "padlock-registry-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Two encodes write archives of the same collection name at the same time
+	kept, aborted := NewTarWriterRegistry(), NewTarWriterRegistry()
+	keptPath := filepath.Join(tempDir, "kept", "3A5.tar")
+	abortedPath := filepath.Join(tempDir, "aborted", "3A5.tar")
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, w := range []struct {
+		registry *TarWriterRegistry
+		path     string
+	}{{kept, keptPath}, {aborted, abortedPath}} {
+		if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= 20; i++ {
+				writer, err := w.registry.TarChunkWriter(ctx, w.path, "3A5", FormatBin)
+				if err != nil {
+					errs <- err
+					return
+				}
+				writer.ChunkNum = i
+				writer.Write([]byte("chunk"))
+				if err := writer.Close(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Failed to write chunks: %v", err)
+	}
+
+	// Aborting one encode leaves the other's archive to be finalized
+	aborted.AbortAll(ctx)
+	if err := kept.FinalizeAll(ctx); err != nil {
+		t.Fatalf("FinalizeAll failed: %v", err)
+	}
+	if _, err := os.Stat(keptPath); err != nil {
+		t.Errorf("Expected the finalized archive: %v", err)
+	}
+	if _, err := os.Stat(PartialPath(abortedPath)); !os.IsNotExist(err) {
+		t.Errorf("Expected the aborted archive to be removed")
+	}
+
+	count := 0
+	err = WalkArchive(keptPath, func(name string, r io.Reader) error {
+		count++
+		return nil
+	})
+	if err != nil || count != 20 {
+		t.Errorf("Expected 20 chunks in the finalized archive, got %d: %v", count, err)
+	}
+}
+
+func TestTarChunkWriterSpoolsLargeChunks(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	defer SetTempPolicy(GetTempPolicy())
+	SetTempPolicy(TempPolicy{SpoolThreshold: 1000})
+
+	for _, format := range []Format{FormatBin, FormatPNG} {
+		t.Run(string(format), func(t *testing.T) {
+			tempDir := t.TempDir()
+			tarPath := filepath.Join(tempDir, "3A5.tar")
+			registry := NewTarWriterRegistry()
+
+			// Chunks either side of the limit, written in pieces so that some spill part way
+			sizes := []int{10, 999, 1000, 1001, 5000, 20}
+			var chunks [][]byte
+			for i, size := range sizes {
+				chunk := bytes.Repeat([]byte{byte(i + 1)}, size)
+				chunks = append(chunks, chunk)
+				writer, err := registry.TarChunkWriter(ctx, tarPath, "3A5", format)
+				if err != nil {
+					t.Fatalf("Failed to create writer: %v", err)
+				}
+				writer.ChunkNum = i + 1
+				for piece := range slices.Chunk(chunk, 300) {
+					if _, err := writer.Write(piece); err != nil {
+						t.Fatalf("Write failed: %v", err)
+					}
+				}
+				if err := writer.Close(); err != nil {
+					t.Fatalf("Close failed: %v", err)
+				}
+			}
+			if err := registry.FinalizeAll(ctx); err != nil {
+				t.Fatalf("FinalizeAll failed: %v", err)
+			}
+
+			var got [][]byte
+			err := WalkArchive(tarPath, func(name string, r io.Reader) error {
+				var data []byte
+				var err error
+				if format == FormatPNG {
+					data, err = ExtractDataFromPNG(r)
+				} else {
+					data, err = ExtractDataFromBin(r)
+				}
+				if err != nil {
+					return err
+				}
+				got = append(got, data)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("WalkArchive failed: %v", err)
+			}
+			if len(got) != len(chunks) {
+				t.Fatalf("Expected %d chunks, got %d", len(chunks), len(got))
+			}
+			for i := range chunks {
+				if !bytes.Equal(got[i], chunks[i]) {
+					t.Errorf("Chunk %d (%d bytes) does not round trip", i+1, len(chunks[i]))
+				}
+			}
+
+			// The spool file is removed with the archive's writer
+			entries, _ := os.ReadDir(tempDir)
+			for _, entry := range entries {
+				if entry.Name() != "3A5.tar" {
+					t.Errorf("Unexpected file left behind: %s", entry.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestTarChunkWriterAppends(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	tarPath := filepath.Join(t.TempDir(), "3A5.tar")
+
+	writeChunks := func(registry *TarWriterRegistry, appended bool, nums ...int) {
+		for _, num := range nums {
+			var writer *TarChunkWriter
+			var err error
+			if appended && num == nums[0] {
+				writer, err = registry.AppendChunkWriter(ctx, tarPath, "3A5", FormatBin)
+			} else {
+				writer, err = registry.TarChunkWriter(ctx, tarPath, "3A5", FormatBin)
+			}
+			if err != nil {
+				t.Fatalf("Failed to create writer: %v", err)
+			}
+			writer.ChunkNum = num
+			if _, err := writer.Write([]byte("chunk")); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+		}
+	}
+	countChunks := func() int {
+		count := 0
+		err := WalkArchive(tarPath, func(name string, r io.Reader) error {
+			count++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("WalkArchive failed: %v", err)
+		}
+		return count
+	}
+
+	registry := NewTarWriterRegistry()
+	writeChunks(registry, false, 1, 2)
+	if err := registry.FinalizeAll(ctx); err != nil {
+		t.Fatalf("FinalizeAll failed: %v", err)
+	}
+
+	// Appending keeps the chunks already in the archive
+	registry = NewTarWriterRegistry()
+	writeChunks(registry, true, 3, 4)
+	if err := registry.FinalizeAll(ctx); err != nil {
+		t.Fatalf("FinalizeAll failed: %v", err)
+	}
+	if count := countChunks(); count != 4 {
+		t.Errorf("Expected 4 chunks after appending, got %d", count)
+	}
+
+	// An aborted append leaves the archive as it was
+	registry = NewTarWriterRegistry()
+	writeChunks(registry, true, 5)
+	registry.AbortAll(ctx)
+	if count := countChunks(); count != 4 {
+		t.Errorf("Expected 4 chunks after an aborted append, got %d", count)
+	}
+	if _, err := os.Stat(PartialPath(tarPath)); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial archive to be removed")
+	}
+}
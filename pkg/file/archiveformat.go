@@ -0,0 +1,249 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ArchiveFormat is the kind of archive a collection is packed into when it isn't stored as
+// individual files
+type ArchiveFormat string
+
+const (
+	// ArchiveTar packs each collection into a TAR file. This is the default.
+	ArchiveTar ArchiveFormat = "tar"
+
+	// ArchiveZip packs each collection into a store-only ZIP file, which Windows and macOS
+	// can open with their built-in tools
+	ArchiveZip ArchiveFormat = "zip"
+)
+
+// ParseArchiveFormat parses an archive format name, "tar" or "zip"
+func ParseArchiveFormat(s string) (ArchiveFormat, error) {
+	switch a := ArchiveFormat(strings.ToLower(strings.TrimSpace(s))); a {
+	case ArchiveTar, ArchiveZip:
+		return a, nil
+	}
+	return "", fmt.Errorf("archive format must be tar or zip, got %q", s)
+}
+
+// Ext returns the file extension of archives in this format, e.g. ".tar". The zero value is
+// treated as ArchiveTar.
+func (a ArchiveFormat) Ext() string {
+	if a == "" {
+		return "." + string(ArchiveTar)
+	}
+	return "." + string(a)
+}
+
+// ArchiveFormatOf returns the archive format of the file at path, judged by its extension, or
+// "" if it isn't a collection archive
+func ArchiveFormatOf(path string) ArchiveFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tar":
+		return ArchiveTar
+	case ".zip":
+		return ArchiveZip
+	}
+	return ""
+}
+
+// IsArchivePath reports whether path names a TAR or ZIP collection archive
+func IsArchivePath(path string) bool {
+	return ArchiveFormatOf(path) != ""
+}
+
+// archiveWriter adds whole entries to a collection archive
+type archiveWriter interface {
+	// AddEntry adds an entry of size bytes, read from r
+	AddEntry(name string, size int64, r io.Reader) error
+	Close() error
+
+	// EntrySize returns an upper bound on the bytes an entry adds to the archive file
+	EntrySize(name string, size int64) int64
+
+	// TrailerSize returns an upper bound on the bytes Close adds to the archive file
+	TrailerSize() int64
+}
+
+// newArchiveWriter returns a writer for the archive format of path, writing to w
+func newArchiveWriter(path string, w io.Writer) archiveWriter {
+	if ArchiveFormatOf(path) == ArchiveZip {
+		return &zipArchiveWriter{zw: zip.NewWriter(w)}
+	}
+	return &tarArchiveWriter{tw: tar.NewWriter(w)}
+}
+
+type tarArchiveWriter struct {
+	tw *tar.Writer
+}
+
+func (a *tarArchiveWriter) AddEntry(name string, size int64, r io.Reader) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+	if err := a.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write tar header: %w", err)
+	}
+	if n, err := io.Copy(a.tw, r); err != nil {
+		return fmt.Errorf("failed to write data to tar entry: %w", err)
+	} else if n != size {
+		return fmt.Errorf("failed to write data to tar entry: wrote %d of %d bytes", n, size)
+	}
+	return nil
+}
+
+func (a *tarArchiveWriter) Close() error {
+	return a.tw.Close()
+}
+
+// EntrySize is the header block and the data padded to a whole block, plus a PAX header for
+// names too long for the header block
+func (a *tarArchiveWriter) EntrySize(name string, size int64) int64 {
+	const block = 512
+	padded := func(n int64) int64 { return (n + block - 1) / block * block }
+	total := block + padded(size)
+	if len(name) > 100 {
+		total += block + padded(int64(len(name))+64)
+	}
+	return total
+}
+
+// TrailerSize is the two zero blocks that end a TAR file
+func (a *tarArchiveWriter) TrailerSize() int64 {
+	return 2 * 512
+}
+
+// zipArchiveWriter writes uncompressed entries, since chunk data is random and can't be
+// compressed, and stored entries are the most widely readable
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchiveWriter) AddEntry(name string, size int64, r io.Reader) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: time.Now(),
+	}
+	header.SetMode(0644)
+	w, err := a.zw.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to write zip header: %w", err)
+	}
+	if n, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("failed to write data to zip entry: %w", err)
+	} else if n != size {
+		return fmt.Errorf("failed to write data to zip entry: wrote %d of %d bytes", n, size)
+	}
+	return nil
+}
+
+func (a *zipArchiveWriter) Close() error {
+	return a.zw.Close()
+}
+
+// EntrySize allows for the local header, data descriptor, and central directory record, each
+// with room for ZIP64 and timestamp extra fields
+func (a *zipArchiveWriter) EntrySize(name string, size int64) int64 {
+	return 256 + 2*int64(len(name)) + size
+}
+
+// TrailerSize is the end of central directory record, with room for the ZIP64 records
+func (a *zipArchiveWriter) TrailerSize() int64 {
+	return 128
+}
+
+// WalkArchive calls fn with the name and contents of each regular file in the TAR or ZIP
+// archive at path, in archive order. It stops at the first error fn returns. If fn returns
+// io.EOF, the walk stops without an error.
+func WalkArchive(path string, fn func(name string, r io.Reader) error) error {
+	err := walkArchive(path, fn)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func walkArchive(path string, fn func(name string, r io.Reader) error) error {
+	if ArchiveFormatOf(path) == ArchiveZip {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return fmt.Errorf("failed to open zip file: %w", err)
+		}
+		defer zr.Close()
+
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("failed to open zip entry %s: %w", f.Name, err)
+			}
+			err = fn(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open tar file: %w", err)
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading tar header: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(header.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// readArchiveEntry returns the contents of the named entry in a TAR or ZIP file, or
+// os.ErrNotExist. If the archive has several entries with the name, the last one is returned.
+func readArchiveEntry(path string, name string) ([]byte, error) {
+	var data []byte
+	found := false
+	err := WalkArchive(path, func(entry string, r io.Reader) error {
+		if entry != name {
+			return nil
+		}
+		found = true
+		var err error
+		data, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s in %s: %w", name, path, os.ErrNotExist)
+	}
+	return data, nil
+}
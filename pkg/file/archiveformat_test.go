@@ -0,0 +1,97 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestZipCollectionRoundTrip(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	tempDir, err := os.MkdirTemp("", "padlock-zip-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	zipPath := filepath.Join(tempDir, "3A5.zip")
+	chunks := [][]byte{[]byte("first chunk"), []byte("second chunk")}
+	registry := NewTarWriterRegistry()
+	for i, chunk := range chunks {
+		writer, err := registry.TarChunkWriter(ctx, zipPath, "3A5", FormatBin)
+		if err != nil {
+			t.Fatalf("TarChunkWriter failed: %v", err)
+		}
+		writer.ChunkNum = i + 1
+		if _, err := writer.Write(chunk); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if i == 0 {
+			if err := writer.AddFile(MetadataFileName, []byte(`{"version":1}`)); err != nil {
+				t.Fatalf("AddFile failed: %v", err)
+			}
+		}
+	}
+	if err := registry.FinalizeAll(ctx); err != nil {
+		t.Fatalf("FinalizeAll failed: %v", err)
+	}
+
+	var names []string
+	err = WalkArchive(zipPath, func(name string, r io.Reader) error {
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkArchive failed: %v", err)
+	}
+	if len(names) != 3 || names[0] != "3A5_0001.bin" || names[2] != "3A5_0002.bin" {
+		t.Errorf("Unexpected zip entries %v", names)
+	}
+
+	collections, _, err := FindCollections(ctx, tempDir)
+	if err != nil {
+		t.Fatalf("FindCollections failed: %v", err)
+	}
+	if len(collections) != 1 || collections[0].Name != "3A5" || collections[0].Format != FormatBin {
+		t.Fatalf("Unexpected collections %+v", collections)
+	}
+
+	reader := NewCollectionReader(collections[0])
+	defer reader.Close()
+	for i, want := range chunks {
+		data, err := reader.ReadNextChunk(ctx)
+		if err != nil {
+			t.Fatalf("ReadNextChunk %d failed: %v", i+1, err)
+		}
+		if string(data) != string(want) {
+			t.Errorf("Chunk %d is %q, want %q", i+1, data, want)
+		}
+	}
+	if _, err := reader.ReadNextChunk(ctx); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last chunk, got %v", err)
+	}
+}
+
+func TestParseArchiveFormat(t *testing.T) {
+	for _, s := range []string{"tar", "ZIP"} {
+		if _, err := ParseArchiveFormat(s); err != nil {
+			t.Errorf("ParseArchiveFormat(%q) failed: %v", s, err)
+		}
+	}
+	if _, err := ParseArchiveFormat("7z"); err == nil {
+		t.Errorf("ParseArchiveFormat accepted an unknown format")
+	}
+	if ArchiveFormat("").Ext() != ".tar" || ArchiveZip.Ext() != ".zip" {
+		t.Errorf("Unexpected archive extensions")
+	}
+}
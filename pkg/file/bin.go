@@ -0,0 +1,129 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Bin chunk files of version 2 frame the chunk with a short header and a CRC-32C footer, so
+// that corruption is detected when the chunk is read instead of surfacing as garbled decode
+// output:
+//
+//	magic    4 bytes  "\x89PLB"
+//	version  1 byte   2
+//	chunk    the chunk exactly as produced by the pad encoder
+//	crc      4 bytes  CRC-32C of the chunk, big-endian
+//
+// Version 1 bin chunk files hold the chunk with nothing around it. A chunk starts with the
+// length of its name, which is far below 0x89, so the two versions can't be confused and
+// version 1 files are still read as they are.
+const (
+	binMagic       = "\x89PLB"
+	binVersion     = 2
+	binHeaderBytes = len(binMagic) + 1
+	binFooterBytes = 4
+)
+
+// BinPayload is the chunk held in a bin chunk file, as found by FindBinPayload
+type BinPayload struct {
+	Data        []byte // Chunk data
+	Version     int    // Format version of the file: 1 for a bare chunk, 2 for one with a CRC
+	StoredCRC   uint32 // CRC recorded in the file (version 2 only)
+	ComputedCRC uint32 // CRC of the data as read (version 2 only)
+}
+
+// CRCValid reports whether the stored CRC matches the data; version 1 files have no CRC
+func (p BinPayload) CRCValid() bool {
+	return p.StoredCRC == p.ComputedCRC
+}
+
+// IsBinV2 reports whether data starts like a version 2 bin chunk file
+func IsBinV2(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(binMagic))
+}
+
+// FindBinPayload returns the chunk held in a bin chunk file of either version. Unlike
+// ExtractDataFromBin it doesn't fail on a CRC mismatch, so the caller can report both CRCs.
+func FindBinPayload(all []byte) (BinPayload, error) {
+	if !IsBinV2(all) {
+		return BinPayload{Data: all, Version: 1}, nil
+	}
+	if len(all) < binHeaderBytes+binFooterBytes {
+		return BinPayload{}, fmt.Errorf("bin chunk file of %d bytes is too short for its header and CRC", len(all))
+	}
+	if version := int(all[len(binMagic)]); version > binVersion {
+		return BinPayload{}, fmt.Errorf("bin chunk file version %d, but this padlock reads up to version %d: %w", version, binVersion, ErrNewerFormat)
+	} else if version != binVersion {
+		return BinPayload{}, fmt.Errorf("unsupported bin chunk file version %d", version)
+	}
+	data := all[binHeaderBytes : len(all)-binFooterBytes]
+	return BinPayload{
+		Data:        data,
+		Version:     binVersion,
+		StoredCRC:   binary.BigEndian.Uint32(all[len(all)-binFooterBytes:]),
+		ComputedCRC: crc32.Checksum(data, crc32c),
+	}, nil
+}
+
+// ExtractDataFromBin reads a bin chunk file and returns the chunk it holds, verifying its CRC
+// if it has one
+func ExtractDataFromBin(r io.Reader) ([]byte, error) {
+	all, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read bin data: %w", err)
+	}
+	p, err := FindBinPayload(all)
+	if err != nil {
+		return nil, err
+	}
+	if !p.CRCValid() {
+		return nil, fmt.Errorf("CRC mismatch in bin chunk: expected 0x%08x, calculated 0x%08x: %w", p.StoredCRC, p.ComputedCRC, ErrChecksumMismatch)
+	}
+	return p.Data, nil
+}
+
+// binChunkWriter writes a version 2 bin chunk file to w as the chunk is written to it, so
+// the chunk never has to be held in memory. Close writes the CRC and leaves the writer ready
+// for the next chunk; it doesn't close w.
+type binChunkWriter struct {
+	w       io.Writer
+	crc     uint32
+	started bool
+}
+
+// Write writes the header before the first bytes of a chunk, and then the bytes themselves
+func (bw *binChunkWriter) Write(p []byte) (int, error) {
+	if !bw.started {
+		if _, err := bw.w.Write(append([]byte(binMagic), binVersion)); err != nil {
+			return 0, err
+		}
+		bw.started = true
+	}
+	bw.crc = crc32.Update(bw.crc, crc32c, p)
+	return bw.w.Write(p)
+}
+
+// Close finishes the chunk by writing its CRC
+func (bw *binChunkWriter) Close() error {
+	if _, err := bw.Write(nil); err != nil {
+		return err
+	}
+	footer := binary.BigEndian.AppendUint32(nil, bw.crc)
+	bw.crc, bw.started = 0, false
+	_, err := bw.w.Write(footer)
+	return err
+}
+
+// encodeBin writes data to w as a version 2 bin chunk file
+func encodeBin(w io.Writer, data []byte) error {
+	bw := &binChunkWriter{w: w}
+	if _, err := bw.Write(data); err != nil {
+		return err
+	}
+	return bw.Close()
+}
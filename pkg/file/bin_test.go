@@ -0,0 +1,89 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestBinChunkCRC(t *testing.T) {
+	chunk := append([]byte{9}, []byte("2A3:1:100 and some cipher data")...)
+
+	var buf bytes.Buffer
+	if err := encodeBin(&buf, chunk); err != nil {
+		t.Fatalf("encodeBin failed: %v", err)
+	}
+	if !IsBinV2(buf.Bytes()) || buf.Len() != len(chunk)+binHeaderBytes+binFooterBytes {
+		t.Fatalf("Unexpected bin chunk file of %d bytes", buf.Len())
+	}
+
+	// Writing the chunk in pieces gives the same file, and the writer can be reused
+	var streamed bytes.Buffer
+	bw := &binChunkWriter{w: &streamed}
+	for range 2 {
+		bw.Write(chunk[:5])
+		bw.Write(chunk[5:])
+		bw.Close()
+	}
+	if !bytes.Equal(streamed.Bytes(), append(bytes.Clone(buf.Bytes()), buf.Bytes()...)) {
+		t.Errorf("Streamed bin chunks differ from encoded ones")
+	}
+
+	data, err := ExtractDataFromBin(bytes.NewReader(buf.Bytes()))
+	if err != nil || !bytes.Equal(data, chunk) {
+		t.Errorf("Chunk doesn't round trip: %v", err)
+	}
+
+	// Chunks written before bin chunk files had a CRC are read as they are
+	data, err = ExtractDataFromBin(bytes.NewReader(chunk))
+	if err != nil || !bytes.Equal(data, chunk) {
+		t.Errorf("Version 1 chunk not read as it is: %v", err)
+	}
+
+	// Damage is detected
+	damaged := bytes.Clone(buf.Bytes())
+	damaged[10] ^= 1
+	if _, err := ExtractDataFromBin(bytes.NewReader(damaged)); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := ExtractDataFromBin(bytes.NewReader(buf.Bytes()[:binHeaderBytes+2])); err == nil {
+		t.Errorf("Expected a truncated chunk to fail")
+	}
+	unknown := bytes.Clone(buf.Bytes())
+	unknown[len(binMagic)] = 3
+	if _, err := ExtractDataFromBin(bytes.NewReader(unknown)); err == nil {
+		t.Errorf("Expected an unknown version to fail")
+	}
+}
+
+func TestCollectionReaderBinCRC(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	collPath := filepath.Join(t.TempDir(), "2A3")
+	chunk := append([]byte{9}, []byte("2A3:1:100 and some cipher data")...)
+	if err := WriteNamedChunk(ctx, &BinFormatter{}, collPath, "2A3", 1, chunk); err != nil {
+		t.Fatalf("WriteNamedChunk failed: %v", err)
+	}
+
+	chunkPath := filepath.Join(collPath, "2A3_0001.bin")
+	contents, _ := os.ReadFile(chunkPath)
+	contents[len(contents)/2] ^= 1
+	if err := os.WriteFile(chunkPath, contents, 0644); err != nil {
+		t.Fatalf("Failed to damage chunk: %v", err)
+	}
+
+	reader := NewCollectionReader(Collection{Name: "2A3", Path: collPath, Format: FormatBin})
+	defer reader.Close()
+	if _, err := reader.ReadNextChunk(ctx); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected the damaged chunk to fail its CRC, got %v", err)
+	}
+	if _, err := (&BinFormatter{}).ReadChunk(ctx, collPath, 0, 1); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected BinFormatter.ReadChunk to check the CRC, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// ChecksumSidecarExt is the extension appended to a chunk file name to form its checksum sidecar.
+// Sidecars use the same "<hex digest>  <file name>" layout as sha256sum, so standard tools
+// (e.g. "sha256sum -c") and object-store checksum features can validate shares independently.
+const ChecksumSidecarExt = ".sha256"
+
+// ErrChecksumMismatch is returned, wrapped with the file or chunk at fault, when data doesn't
+// match the SHA-256 sidecar or CRC stored with it
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// fileSHA256 returns the hex-encoded SHA-256 digest of a file's contents
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WriteChecksumSidecar computes the SHA-256 of a chunk file as written on disk and
+// stores it next to the file in sha256sum format
+func WriteChecksumSidecar(ctx context.Context, chunkPath string) error {
+	log := trace.FromContext(ctx).WithPrefix("CHECKSUM")
+
+	digest, err := fileSHA256(chunkPath)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to hash chunk file %s: %w", chunkPath, err))
+		return fmt.Errorf("failed to hash chunk file %s: %w", chunkPath, err)
+	}
+
+	sidecarPath := chunkPath + ChecksumSidecarExt
+	line := fmt.Sprintf("%s  %s\n", digest, filepath.Base(chunkPath))
+	if err := os.WriteFile(sidecarPath, []byte(line), 0644); err != nil {
+		log.Error(fmt.Errorf("failed to write checksum sidecar %s: %w", sidecarPath, err))
+		return fmt.Errorf("failed to write checksum sidecar %s: %w", sidecarPath, err)
+	}
+
+	log.Debugf("Wrote checksum sidecar %s", sidecarPath)
+	return nil
+}
+
+// VerifyChecksumSidecar checks a chunk file against its sidecar, if one exists.
+//
+// Returns:
+//   - found: whether a sidecar was present for the chunk file
+//   - An error if the sidecar is malformed or the digest does not match
+func VerifyChecksumSidecar(ctx context.Context, chunkPath string) (bool, error) {
+	actual := func() (string, error) {
+		digest, err := fileSHA256(chunkPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash chunk file %s: %w", chunkPath, err)
+		}
+		return digest, nil
+	}
+	return verifyChecksumSidecar(ctx, chunkPath, actual)
+}
+
+// VerifyChecksumSidecarData is VerifyChecksumSidecar for the contents of the chunk file already
+// read into data, which may have been corrected since
+func VerifyChecksumSidecarData(ctx context.Context, chunkPath string, data []byte) (bool, error) {
+	actual := func() (string, error) {
+		digest := sha256.Sum256(data)
+		return hex.EncodeToString(digest[:]), nil
+	}
+	return verifyChecksumSidecar(ctx, chunkPath, actual)
+}
+
+// verifyChecksumSidecar checks the digest actual computes against the chunk file's sidecar
+func verifyChecksumSidecar(ctx context.Context, chunkPath string, actual func() (string, error)) (bool, error) {
+	log := trace.FromContext(ctx).WithPrefix("CHECKSUM")
+
+	sidecarPath := chunkPath + ChecksumSidecarExt
+	f, err := os.Open(sidecarPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to open checksum sidecar %s: %w", sidecarPath, err)
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return true, fmt.Errorf("failed to read checksum sidecar %s: %w", sidecarPath, err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return true, fmt.Errorf("malformed checksum sidecar %s", sidecarPath)
+	}
+	expected := strings.ToLower(fields[0])
+
+	digest, err := actual()
+	if err != nil {
+		return true, err
+	}
+
+	if digest != expected {
+		log.Error(fmt.Errorf("checksum mismatch for %s: expected %s, calculated %s", filepath.Base(chunkPath), expected, digest))
+		return true, fmt.Errorf("%s: %w", filepath.Base(chunkPath), ErrChecksumMismatch)
+	}
+
+	log.Debugf("Checksum verified for %s", filepath.Base(chunkPath))
+	return true, nil
+}
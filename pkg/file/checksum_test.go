@@ -0,0 +1,72 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestChecksumSidecar(t *testing.T) {
+	// Create a temporary directory
+	tempDir, err := os.MkdirTemp("", "padlock-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create a context with tracer
+	ctx := context.Background()
+	tracer := trace.NewTracer("TEST", trace.LogLevelVerbose)
+	ctx = trace.WithContext(ctx, tracer)
+
+	// Write a chunk through a NamedChunkWriter with sidecars enabled
+	w := &NamedChunkWriter{
+		Ctx:       ctx,
+		Formatter: &BinFormatter{},
+		CollPath:  tempDir,
+		CollName:  "2A3",
+		ChunkNum:  1,
+		Checksum:  true,
+	}
+	if _, err := w.Write([]byte("checksum test data")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	chunkPath := filepath.Join(tempDir, "2A3_0001.bin")
+	if _, err := os.Stat(chunkPath + ChecksumSidecarExt); err != nil {
+		t.Fatalf("Expected sidecar file to exist: %v", err)
+	}
+
+	// An intact chunk should verify
+	found, err := VerifyChecksumSidecar(ctx, chunkPath)
+	if err != nil || !found {
+		t.Fatalf("VerifyChecksumSidecar = (%v, %v), want (true, nil)", found, err)
+	}
+
+	// A chunk without a sidecar is reported as not found
+	otherPath := filepath.Join(tempDir, "2A3_0002.bin")
+	if err := os.WriteFile(otherPath, []byte("no sidecar"), 0644); err != nil {
+		t.Fatalf("Failed to write chunk: %v", err)
+	}
+	found, err = VerifyChecksumSidecar(ctx, otherPath)
+	if err != nil || found {
+		t.Errorf("VerifyChecksumSidecar without sidecar = (%v, %v), want (false, nil)", found, err)
+	}
+
+	// A modified chunk should fail verification
+	if err := os.WriteFile(chunkPath, []byte("tampered data"), 0644); err != nil {
+		t.Fatalf("Failed to modify chunk: %v", err)
+	}
+	if _, err := VerifyChecksumSidecar(ctx, chunkPath); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected checksum mismatch for modified chunk, got %v", err)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/blues/padlock/pkg/trace"
@@ -34,9 +35,45 @@ import (
 // collections, can reconstruct the original data. Collections can be stored as
 // directories on disk or packaged as ZIP files for distribution.
 type Collection struct {
-	Name   string // The name of the collection (e.g., "3A5")
-	Path   string // The filesystem path to the collection
-	Format Format // The format of the data chunks (binary or PNG)
+	Name       string   // The name of the collection (e.g., "3A5")
+	Path       string   // The filesystem path to the collection
+	Format     Format   // The format of the data chunks (binary or PNG)
+	StoredName string   // Name used for files on disk when it differs from Name (stealth naming)
+	Volumes    []string // Volume archives in order, when the collection is split into volumes; Path is then the volume manifest
+
+	// PNGEmbedding is how data is hidden in the collection's PNG chunks, from its metadata.
+	// If it is empty, each chunk is examined to find out.
+	PNGEmbedding PNGEmbedding
+}
+
+// DiskName returns the name used for the collection's directory, TAR, and chunk files
+func (c Collection) DiskName() string {
+	if c.StoredName != "" {
+		return c.StoredName
+	}
+	return c.Name
+}
+
+// UseMetadata sets the collection's format, and how data is hidden in its PNG chunks, from
+// its metadata, which records them at encode time. A collection without metadata that can be
+// read without a key keeps what was inferred from its files.
+func (c *Collection) UseMetadata(ctx context.Context) {
+	log := trace.FromContext(ctx).WithPrefix("COLLECTION")
+
+	md, err := ReadMetadata(ctx, *c, nil)
+	if err != nil {
+		return
+	}
+	switch md.Format {
+	case FormatBin, FormatPNG, FormatText, FormatWAV:
+		if md.Format != c.Format {
+			log.Debugf("Collection %s records format %s, not %s", c.Name, md.Format, c.Format)
+		}
+		c.Format = md.Format
+	}
+	if c.Format == FormatPNG && c.PNGEmbedding == "" {
+		c.PNGEmbedding = md.PNGEmbedding
+	}
 }
 
 // CreateCollections creates collection directories for the padlock scheme
@@ -64,9 +101,70 @@ func CreateCollections(ctx context.Context, outputDir string, collectionNames []
 	return collections, nil
 }
 
-// FindCollections locates collection directories or TAR files in the input directory
-// It handles direct access to TAR files for collections
+// FindCollections locates collection directories, TAR files or ZIP files in the input directory
+// It handles direct access to TAR and ZIP files for collections; ZIP files are never extracted
 func FindCollections(ctx context.Context, inputDir string) ([]Collection, string, error) {
+	return FindCollectionsDepth(ctx, inputDir, 0)
+}
+
+// FindCollectionsDepth locates collections like FindCollections, in the input directory and
+// in up to depth levels of its subdirectories, so that collections kept in nested folders, on
+// mounted drives, or in synced cloud folders are found too. The directories of the collections
+// found, and hidden directories, aren't searched.
+func FindCollectionsDepth(ctx context.Context, inputDir string, depth int) ([]Collection, string, error) {
+	log := trace.FromContext(ctx).WithPrefix("COLLECTION")
+
+	var collections []Collection
+	var tempDir string // Temporary directory for TAR extraction
+	dirs := []string{inputDir}
+	for level := 0; level <= depth && len(dirs) > 0; level++ {
+		var subdirs []string
+		for _, dir := range dirs {
+			found, more, err := scanCollections(ctx, dir, &tempDir)
+			if err != nil && dir == inputDir {
+				log.Error(fmt.Errorf("failed to read input directory: %w", err))
+				return nil, "", fmt.Errorf("failed to read input directory: %w", err)
+			}
+			if err != nil {
+				log.Infof("Skipping %s: %v", dir, err)
+				continue
+			}
+			if level > 0 && len(found) > 0 {
+				log.Infof("Found %d collections in %s", len(found), dir)
+			}
+			collections = append(collections, found...)
+			subdirs = append(subdirs, more...)
+		}
+		dirs = subdirs
+	}
+
+	// Check if we found any collections
+	if len(collections) == 0 {
+		log.Error(fmt.Errorf("no collections found in %s", inputDir))
+		if tempDir != "" {
+			os.RemoveAll(tempDir)
+		}
+		return nil, "", fmt.Errorf("no collections found in %s", inputDir)
+	}
+
+	// What the collections record about themselves overrides what their files suggest
+	for i := range collections {
+		collections[i].UseMetadata(ctx)
+	}
+
+	// Sort collections by name, keeping a directory ahead of an archive of the same collection
+	sort.SliceStable(collections, func(i, j int) bool {
+		return collections[i].Name < collections[j].Name
+	})
+
+	log.Debugf("Found %d collections", len(collections))
+	return collections, tempDir, nil
+}
+
+// scanCollections finds the collections in one directory, extracting any TAR that isn't named
+// after its collection into *tempDir, which it creates if needed. It also returns the
+// subdirectories that aren't collections, other than hidden ones, for a deeper search.
+func scanCollections(ctx context.Context, inputDir string, tempDir *string) ([]Collection, []string, error) {
 	log := trace.FromContext(ctx).WithPrefix("COLLECTION")
 
 	log.Debugf("Finding collections in %s", inputDir)
@@ -74,14 +172,23 @@ func FindCollections(ctx context.Context, inputDir string) ([]Collection, string
 	// Check if we have files in the input directory
 	files, err := os.ReadDir(inputDir)
 	if err != nil {
-		log.Error(fmt.Errorf("failed to read input directory: %w", err))
-		return nil, "", fmt.Errorf("failed to read input directory: %w", err)
+		return nil, nil, err
+	}
+
+	// Output that an encode is still writing, or that one left unfinished, isn't a collection
+	complete := files[:0]
+	for _, entry := range files {
+		if IsPartialOutput(filepath.Join(inputDir, entry.Name())) {
+			log.Infof("Ignoring partial output %s", entry.Name())
+			continue
+		}
+		complete = append(complete, entry)
 	}
+	files = complete
 
 	// Gather collections from directories and tar files
 	var collections []Collection
-	directTarCollections := make(map[string]bool) // Used to track TAR files processed directly
-	var tempDir string                            // Temporary directory for TAR extraction
+	var subdirs []string
 
 	// First, gather all collection directories
 	log.Debugf("Checking for collection directories")
@@ -89,7 +196,7 @@ func FindCollections(ctx context.Context, inputDir string) ([]Collection, string
 		if entry.IsDir() {
 			collName := entry.Name()
 			// Check if this looks like a collection directory (e.g. "3A5")
-			if len(collName) >= 3 && IsCollectionName(collName) {
+			if len(collName) >= 3 && IsStoredCollectionName(collName) {
 				collPath := filepath.Join(inputDir, collName)
 				log.Debugf("Found collection directory: %s", collPath)
 
@@ -107,145 +214,148 @@ func FindCollections(ctx context.Context, inputDir string) ([]Collection, string
 				})
 
 				log.Debugf("Added collection %s with format %s", collName, format)
+				continue
+			}
+			if !strings.HasPrefix(collName, ".") {
+				subdirs = append(subdirs, filepath.Join(inputDir, collName))
 			}
 		}
 	}
 
-	// Process TAR files directly without extraction
-	log.Debugf("Checking for collection tar files for direct access")
+	// Collections split into volumes are found through their volume manifests
+	log.Debugf("Checking for volume manifests")
 	for _, entry := range files {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".tar") {
-			tarPath := filepath.Join(inputDir, entry.Name())
-			log.Debugf("Found collection tar file: %s", tarPath)
-
-			// Try to determine collection name from the TAR filename
-			// TAR files are usually named after the collection, like "3A5.tar"
-			baseName := strings.TrimSuffix(entry.Name(), ".tar")
-
-			// Check if it looks like a valid collection name
-			if IsCollectionName(baseName) {
-				log.Debugf("Using direct TAR access for collection %s", baseName)
-
-				// Try to open the TAR file to check for contents
-				file, err := os.Open(tarPath)
-				if err != nil {
-					log.Error(fmt.Errorf("failed to open tar file %s: %w", tarPath, err))
-					continue
-				}
-
-				// Create tar reader directly without gzip decompression
-				tarReader := tar.NewReader(file)
-
-				// Determine format by examining TAR entries
-				format := Format("")
-				for {
-					header, err := tarReader.Next()
-					if err == io.EOF {
-						break // End of archive
-					}
-					if err != nil {
-						log.Error(fmt.Errorf("error reading tar header: %w", err))
-						break
-					}
-
-					// Check file extension to determine format
-					name := header.Name
-					if strings.HasSuffix(strings.ToUpper(name), ".PNG") {
-						format = FormatPNG
-						break
-					} else if strings.HasSuffix(name, ".bin") {
-						format = FormatBin
-						break
-					}
-				}
-
-				// Close reader
-				file.Close()
-
-				if format == "" {
-					log.Error(fmt.Errorf("could not determine format for tar file %s", tarPath))
-					continue
-				}
-
-				// Add the collection for direct access
-				collections = append(collections, Collection{
-					Name:   baseName,
-					Path:   tarPath,
-					Format: format,
-				})
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), VolumeManifestSuffix) {
+			continue
+		}
+		manifestPath := filepath.Join(inputDir, entry.Name())
+		manifest, volumes, err := ReadVolumeManifest(manifestPath)
+		if err != nil {
+			log.Error(fmt.Errorf("skipping collection split into volumes: %w", err))
+			continue
+		}
+		collName := strings.TrimSuffix(entry.Name(), VolumeManifestSuffix)
+		if !IsStoredCollectionName(collName) {
+			collName = manifest.Collection
+		}
+		_, format, err := inspectArchive(volumes[0])
+		if err != nil || format == "" {
+			log.Error(fmt.Errorf("could not determine format for volume %s: %v", volumes[0], err))
+			continue
+		}
 
-				directTarCollections[tarPath] = true
-				log.Debugf("Added TAR-based collection %s with format %s for direct access", baseName, format)
-			} else {
-				log.Debugf("TAR filename doesn't match collection name pattern: %s", entry.Name())
-				// For TARs without collection names in their filename, we'd need a way to examine
-				// their contents to determine collection name. For now, handle them the traditional way.
-
-				// Create a temporary directory for extraction if needed
-				if tempDir == "" {
-					var err error
-					tempDir, err = os.MkdirTemp("", "padlock-collections-")
-					if err != nil {
-						log.Error(fmt.Errorf("failed to create temp directory: %w", err))
-						continue
-					}
-					log.Debugf("Created temporary directory for TAR extraction: %s", tempDir)
-				}
+		collections = append(collections, Collection{
+			Name:    collName,
+			Path:    manifestPath,
+			Format:  format,
+			Volumes: volumes,
+		})
+		log.Debugf("Added collection %s with format %s in %d volumes", collName, format, len(volumes))
+	}
 
-				// Extract the TAR file to the temporary directory
-				extractedDir, err := ExtractTarCollection(ctx, tarPath, tempDir)
-				if err != nil {
-					log.Error(fmt.Errorf("failed to extract TAR file %s: %w", tarPath, err))
-					continue
-				}
+	// Process TAR and ZIP files directly without extraction
+	log.Debugf("Checking for collection tar and zip files for direct access")
+	for _, entry := range files {
+		if entry.IsDir() || !IsArchivePath(entry.Name()) || IsVolumePath(entry.Name()) {
+			// Volumes are read through their manifest
+			continue
+		}
+		coll, err := archiveCollection(ctx, filepath.Join(inputDir, entry.Name()), tempDir)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		collections = append(collections, coll)
+	}
 
-				// Try to determine the collection name from the extracted directory
-				collName := filepath.Base(extractedDir)
-				if !IsCollectionName(collName) {
-					// If the directory name doesn't look like a collection name,
-					// try to determine it from file contents
-					collName, err = determineCollectionNameFromContent(ctx, extractedDir)
-					if err != nil {
-						log.Error(fmt.Errorf("failed to determine collection name for extracted TAR: %w", err))
-						continue
-					}
-				}
+	// Chunk files of several collections mixed together in the directory are grouped by the
+	// collection their names give
+	var loose []string
+	names := make(map[string]bool)
+	for _, entry := range files {
+		if name := collectionNameFromChunkFile(entry.Name()); name != "" && !entry.IsDir() {
+			loose = append(loose, filepath.Join(inputDir, entry.Name()))
+			names[name] = true
+		}
+	}
+	if len(loose) > 0 {
+		log.Debugf("Found loose chunk files of %d collections", len(names))
+		grouped, err := groupLooseChunks(ctx, loose, tempDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		collections = append(collections, grouped...)
+	}
+	return collections, subdirs, nil
+}
 
-				// Determine the format
-				format, err := DetermineCollectionFormat(extractedDir)
-				if err != nil {
-					log.Error(fmt.Errorf("failed to determine format for extracted TAR: %w", err))
-					continue
-				}
+// archiveCollection returns the collection in a TAR or ZIP archive. Archives named after their
+// collection, and ZIPs, are read in place; a TAR with another name is extracted into *tempDir,
+// which is created if needed.
+func archiveCollection(ctx context.Context, tarPath string, tempDir *string) (Collection, error) {
+	log := trace.FromContext(ctx).WithPrefix("COLLECTION")
+	log.Debugf("Found collection archive file: %s", tarPath)
 
-				// Add the extracted collection
-				collections = append(collections, Collection{
-					Name:   collName,
-					Path:   extractedDir,
-					Format: format,
-				})
+	// Archives are usually named after the collection, like "3A5.tar" or "3A5.zip"
+	baseName := strings.TrimSuffix(filepath.Base(tarPath), filepath.Ext(tarPath))
+	if IsStoredCollectionName(baseName) {
+		log.Debugf("Using direct archive access for collection %s", baseName)
 
-				log.Debugf("Added extracted TAR collection %s with format %s", collName, format)
-			}
+		// Determine format by examining the archive entries
+		_, format, err := inspectArchive(tarPath)
+		if err != nil {
+			return Collection{}, fmt.Errorf("failed to read archive %s: %w", tarPath, err)
 		}
+		if format == "" {
+			return Collection{}, fmt.Errorf("could not determine format for archive %s", tarPath)
+		}
+		log.Debugf("Added TAR-based collection %s with format %s for direct access", baseName, format)
+		return Collection{Name: baseName, Path: tarPath, Format: format}, nil
 	}
 
-	// Check if we found any collections
-	if len(collections) == 0 {
-		log.Error(fmt.Errorf("no collections found in %s", inputDir))
-		if tempDir != "" {
-			os.RemoveAll(tempDir)
+	if ArchiveFormatOf(tarPath) == ArchiveZip {
+		// ZIP files are read in place, so a renamed ZIP is identified by its chunk entries
+		// rather than by extracting it
+		log.Debugf("ZIP filename doesn't match collection name pattern: %s", tarPath)
+		collName, format, err := inspectArchive(tarPath)
+		if err != nil {
+			return Collection{}, fmt.Errorf("failed to read archive %s: %w", tarPath, err)
 		}
-		return nil, "", fmt.Errorf("no collections found in %s", inputDir)
+		if collName == "" || format == "" {
+			return Collection{}, fmt.Errorf("could not determine collection for zip file %s", tarPath)
+		}
+		log.Debugf("Added ZIP-based collection %s with format %s from %s", collName, format, tarPath)
+		return Collection{Name: collName, Path: tarPath, Format: format}, nil
 	}
 
-	// Sort collections by name
-	sort.Slice(collections, func(i, j int) bool {
-		return collections[i].Name < collections[j].Name
-	})
-
-	log.Debugf("Found %d collections", len(collections))
-	return collections, tempDir, nil
+	// A TAR without the collection name in its filename is extracted, and the collection
+	// identified by the files in it
+	log.Debugf("TAR filename doesn't match collection name pattern: %s", tarPath)
+	if *tempDir == "" {
+		dir, err := MkdirTemp("padlock-collections-")
+		if err != nil {
+			return Collection{}, fmt.Errorf("failed to create temp directory: %w", err)
+		}
+		*tempDir = dir
+		log.Debugf("Created temporary directory for TAR extraction: %s", dir)
+	}
+	extractedDir, err := ExtractTarCollection(ctx, tarPath, *tempDir)
+	if err != nil {
+		return Collection{}, fmt.Errorf("failed to extract TAR file %s: %w", tarPath, err)
+	}
+	collName := filepath.Base(extractedDir)
+	if !IsStoredCollectionName(collName) {
+		collName, err = determineCollectionNameFromContent(ctx, extractedDir)
+		if err != nil {
+			return Collection{}, fmt.Errorf("failed to determine collection name for extracted TAR: %w", err)
+		}
+	}
+	format, err := DetermineCollectionFormat(extractedDir)
+	if err != nil {
+		return Collection{}, fmt.Errorf("failed to determine format for extracted TAR: %w", err)
+	}
+	log.Debugf("Added extracted TAR collection %s with format %s", collName, format)
+	return Collection{Name: collName, Path: extractedDir, Format: format}, nil
 }
 
 // DetermineCollectionFormat determines the format of a collection by looking at its files
@@ -263,6 +373,10 @@ func DetermineCollectionFormat(collPath string) (Format, error) {
 				return FormatPNG, nil
 			} else if strings.HasSuffix(name, ".bin") {
 				return FormatBin, nil
+			} else if strings.HasSuffix(name, ".txt") && collectionNameFromChunkFile(name) != "" {
+				return FormatText, nil
+			} else if strings.HasPrefix(name, "REC") && strings.HasSuffix(strings.ToUpper(name), ".WAV") {
+				return FormatWAV, nil
 			}
 		}
 	}
@@ -328,39 +442,52 @@ func determineCollectionNameFromContent(ctx context.Context, dirPath string) (st
 		}
 
 		name := entry.Name()
-
-		// Check for PNG files
-		if strings.HasSuffix(strings.ToUpper(name), ".PNG") && strings.HasPrefix(name, "IMG") {
-			// Extract the collection name after "IMG" and before "_"
-			parts := strings.Split(strings.TrimPrefix(name, "IMG"), "_")
-			if len(parts) > 0 && IsCollectionName(parts[0]) {
-				log.Debugf("Determined collection name '%s' from file %s", parts[0], name)
-				return parts[0], nil
-			}
-		}
-
-		// Check for bin files
-		if strings.HasSuffix(name, ".bin") {
-			// Extract the collection name before "_"
-			parts := strings.Split(name, "_")
-			if len(parts) > 0 && IsCollectionName(parts[0]) {
-				log.Debugf("Determined collection name '%s' from file %s", parts[0], name)
-				return parts[0], nil
-			}
+		if collName := collectionNameFromChunkFile(name); collName != "" {
+			log.Debugf("Determined collection name '%s' from file %s", collName, name)
+			return collName, nil
 		}
 	}
 
 	return "", fmt.Errorf("could not determine collection name from directory content")
 }
 
+// collectionNameFromChunkFile returns the collection name in a chunk file name such as
+// "IMG3A5_0001.PNG", "REC3A5_0001.WAV", "3A5_0001.bin" or "3A5_0001.txt", or "" if name
+// isn't a chunk file
+func collectionNameFromChunkFile(name string) string {
+	var parts []string
+	if strings.HasSuffix(strings.ToUpper(name), ".PNG") && strings.HasPrefix(name, "IMG") {
+		// The collection name is after "IMG" and before "_"
+		parts = strings.Split(strings.TrimPrefix(name, "IMG"), "_")
+	} else if strings.HasSuffix(strings.ToUpper(name), ".WAV") && strings.HasPrefix(name, "REC") {
+		// The collection name is after "REC" and before "_"
+		parts = strings.Split(strings.TrimPrefix(name, "REC"), "_")
+	} else if strings.HasSuffix(name, ".bin") || strings.HasSuffix(name, ".txt") {
+		// The collection name is before "_"
+		parts = strings.Split(name, "_")
+	}
+	if len(parts) > 0 && IsStoredCollectionName(parts[0]) {
+		return parts[0]
+	}
+	return ""
+}
+
 // CollectionReader reads data from a collection
 type CollectionReader struct {
 	Collection       Collection
 	ChunkIndex       int
 	Formatter        Formatter
-	sortedChunkFiles []string    // Cached list of sorted chunk files in directory
-	tarFile          *os.File    // File handle for TAR files
-	tarReader        *tar.Reader // TAR reader for streaming chunks
+	sortedChunkFiles []string             // Cached list of sorted chunk files in directory
+	tarFile          *os.File             // File handle for TAR files
+	tarReader        *tar.Reader          // TAR reader for streaming chunks
+	zipReader        *ZipCollectionReader // Reader for ZIP files
+	volume           int                  // Index of the volume being read, for collections split into volumes
+	volumeReader     *CollectionReader    // Reader for the volume being read
+	lastChunkName    string               // File or TAR entry name of the most recently read chunk
+	chunkPath        string               // Where the chunk being read is stored, for errors
+	Retry            RetryPolicy          // Retry policy for reading individual chunk files
+	CorrectedChunks  int                  // Chunks read so far whose damage was corrected from their parity sidecars
+	MACs             *ChunkMACs           // If set, every chunk is authenticated against its MAC as it is read
 }
 
 // NewCollectionReader creates a new collection reader
@@ -372,13 +499,129 @@ func NewCollectionReader(collection Collection) *CollectionReader {
 	}
 }
 
-// ReadNextChunk reads the next chunk from the collection
+// ChunkError reports a chunk of a collection that couldn't be read, and where it is stored
+type ChunkError struct {
+	Collection string // Name of the collection
+	Chunk      int    // Position of the chunk in the collection, from 1
+	Path       string // Chunk file, archive entry, or collection the chunk was read from
+	Err        error  // What was wrong with it
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("chunk %d of collection %s (%s): %v", e.Chunk, e.Collection, e.Path, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// ReadNextChunk reads the next chunk from the collection. If the reader has MACs, a chunk
+// that fails authentication is returned as an error, and a collection that ends before the
+// last authenticated chunk returns an error instead of io.EOF. Errors other than io.EOF are
+// returned as a *ChunkError naming the chunk and where it is stored.
 func (cr *CollectionReader) ReadNextChunk(ctx context.Context) ([]byte, error) {
+	position := cr.ChunkIndex
+	cr.chunkPath = ""
+	data, err := cr.readNextChunk(ctx)
+	if cr.MACs != nil {
+		if err == io.EOF && position <= cr.MACs.Len() {
+			err = fmt.Errorf("collection %s ends after %d chunks, but has MACs for %d: %w", cr.Collection.Name, position-1, cr.MACs.Len(), ErrChecksumMismatch)
+			trace.FromContext(ctx).WithPrefix("COLLECTION-READER").Error(err)
+		} else if err == nil {
+			if err = cr.MACs.Verify(position, data); err != nil {
+				trace.FromContext(ctx).WithPrefix("COLLECTION-READER").Error(fmt.Errorf("collection %s: %w", cr.Collection.Name, err))
+			}
+		}
+	}
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		path := cr.chunkPath
+		if path == "" {
+			path = cr.Collection.Path
+		}
+		return nil, &ChunkError{Collection: cr.Collection.Name, Chunk: position, Path: path, Err: err}
+	}
+	return data, nil
+}
+
+// SkipTo positions the reader so that ReadNextChunk reads chunk next, counting from 1. The
+// chunk files of a collection directory are read from there directly; archived collections
+// are read through to it, without the chunks before it being checked.
+func (cr *CollectionReader) SkipTo(ctx context.Context, next int) error {
+	if len(cr.Collection.Volumes) == 0 && ArchiveFormatOf(cr.Collection.Path) != ArchiveZip && !strings.HasSuffix(cr.Collection.Path, ".tar") {
+		cr.ChunkIndex = next
+		return nil
+	}
+	for cr.ChunkIndex < next {
+		position := cr.ChunkIndex
+		if _, err := cr.readNextChunk(ctx); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("collection %s ends before chunk %d", cr.Collection.Name, next)
+			}
+			return &ChunkError{Collection: cr.Collection.Name, Chunk: position, Path: cr.Collection.Path, Err: err}
+		}
+	}
+	return nil
+}
+
+// ChunkRange is a ChunkSequence of the chunks First to Last of a collection, counting from 1,
+// or to the end of the collection if Last is 0
+type ChunkRange struct {
+	Reader  *CollectionReader
+	First   int
+	Last    int
+	started bool
+}
+
+// ReadNextChunk reads the next chunk of the range, returning io.EOF after the last one
+func (r *ChunkRange) ReadNextChunk(ctx context.Context) ([]byte, error) {
+	if !r.started {
+		if err := r.Reader.SkipTo(ctx, r.First); err != nil {
+			return nil, err
+		}
+		r.started = true
+	}
+	if r.Last > 0 && r.Reader.ChunkIndex > r.Last {
+		return nil, io.EOF
+	}
+	return r.Reader.ReadNextChunk(ctx)
+}
+
+// Close closes the collection reader
+func (r *ChunkRange) Close() error {
+	return r.Reader.Close()
+}
+
+// readNextChunk reads the next chunk from the collection, without authenticating it
+func (cr *CollectionReader) readNextChunk(ctx context.Context) ([]byte, error) {
 	log := trace.FromContext(ctx).WithPrefix("COLLECTION-READER")
 
 	log.Debugf("Reading next chunk %d from collection %s (path: %s)",
 		cr.ChunkIndex, cr.Collection.Name, cr.Collection.Path)
 
+	// Check if this collection is split into volumes
+	if len(cr.Collection.Volumes) > 0 {
+		return cr.readNextChunkFromVolumes(ctx)
+	}
+
+	// Check if this collection is a ZIP file
+	if ArchiveFormatOf(cr.Collection.Path) == ArchiveZip {
+		log.Debugf("Collection is a ZIP file, using ZIP reader")
+		if cr.zipReader == nil {
+			cr.zipReader = NewZipCollectionReader(cr.Collection)
+		}
+		data, err := cr.zipReader.ReadNextChunk(ctx)
+		if err != nil {
+			cr.chunkPath = cr.Collection.Path
+			return nil, err
+		}
+		cr.lastChunkName = cr.zipReader.LastChunkName()
+		cr.ChunkIndex++
+		return data, nil
+	}
+
 	// Check if this collection is a TAR file
 	if strings.HasSuffix(cr.Collection.Path, ".tar") {
 		log.Debugf("Collection is a TAR file, using TAR reader")
@@ -405,12 +648,9 @@ func (cr *CollectionReader) ReadNextChunk(ctx context.Context) ([]byte, error) {
 			}
 
 			name := entry.Name()
-			ext := strings.ToUpper(filepath.Ext(name))
 
 			// Check if it's a valid chunk file based on extension
-			if (cr.Collection.Format == FormatPNG && (ext == ".PNG" || ext == ".png")) ||
-				(cr.Collection.Format == FormatBin && ext == ".bin") ||
-				(cr.Collection.Format == "" && (ext == ".PNG" || ext == ".png" || ext == ".bin")) {
+			if isChunkFile(cr.Collection.Format, name) {
 				chunkFiles = append(chunkFiles, name)
 			}
 		}
@@ -421,8 +661,8 @@ func (cr *CollectionReader) ReadNextChunk(ctx context.Context) ([]byte, error) {
 			return nil, io.EOF
 		}
 
-		// Sort the chunk files to ensure consistent ordering
-		sort.Strings(chunkFiles)
+		// Sort the chunk files by chunk number to ensure consistent ordering
+		sortChunkFiles(chunkFiles)
 
 		// Log the sorted files for debugging
 		if len(chunkFiles) > 0 {
@@ -444,46 +684,83 @@ func (cr *CollectionReader) ReadNextChunk(ctx context.Context) ([]byte, error) {
 	// Get the current chunk file
 	chunkFile := cr.sortedChunkFiles[cr.ChunkIndex-1]
 	filePath := filepath.Join(cr.Collection.Path, chunkFile)
+	cr.chunkPath = filePath
 
 	log.Debugf("Reading chunk %d (file: %s) from collection %s", cr.ChunkIndex, chunkFile, cr.Collection.Name)
 
-	// Read the chunk data
+	// Read the chunk data, retrying transient failures (e.g. a network mount hiccup)
 	var data []byte
-	var err error
-
-	// Use the appropriate method to read the data based on file extension
-	ext := strings.ToUpper(filepath.Ext(chunkFile))
-	if ext == ".PNG" || ext == ".png" {
-		// Use PNG format to read the file
-		f, err := os.Open(filePath)
-		if err != nil {
-			log.Error(fmt.Errorf("failed to open PNG file: %w", err))
-			return nil, fmt.Errorf("failed to open chunk file: %w", err)
-		}
-		defer f.Close()
-
-		data, err = ExtractDataFromPNG(f)
-		if err != nil {
-			log.Error(fmt.Errorf("failed to extract data from PNG: %w", err))
-			return nil, fmt.Errorf("failed to extract data from PNG: %w", err)
-		}
-	} else {
-		// Default to binary format
-		data, err = os.ReadFile(filePath)
-		if err != nil {
-			log.Error(fmt.Errorf("failed to read chunk file: %w", err))
-			return nil, fmt.Errorf("failed to read chunk file: %w", err)
-		}
+	var corrected int
+	err := cr.Retry.Do(ctx, fmt.Sprintf("read chunk %s", chunkFile), func() error {
+		var readErr error
+		data, corrected, readErr = readChunkFile(ctx, filePath, cr.Collection.PNGEmbedding)
+		return readErr
+	})
+	if err != nil {
+		log.Error(fmt.Errorf("failed to read chunk %d: %w", cr.ChunkIndex, err))
+		return nil, err
+	}
+	if corrected > 0 {
+		cr.CorrectedChunks++
 	}
 
 	log.Debugf("Successfully read %d bytes from chunk file %s", len(data), chunkFile)
 
 	// Increment the chunk index for the next read
+	cr.lastChunkName = chunkFile
 	cr.ChunkIndex++
 
 	return data, nil
 }
 
+// readChunkFile reads the payload of a single chunk file, correcting it from its parity
+// sidecar and validating it against its checksum sidecar when they are present. It returns
+// the payload and the number of damaged blocks that were corrected.
+func readChunkFile(ctx context.Context, filePath string, embedding PNGEmbedding) ([]byte, int, error) {
+	log := trace.FromContext(ctx).WithPrefix("COLLECTION-READER")
+	chunkFile := filepath.Base(filePath)
+
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read chunk file: %w", err)
+	}
+
+	// Correct any damage the parity sidecar covers, if the collection was written with them
+	contents, corrected, err := CorrectWithParity(ctx, filePath, contents)
+	if err != nil {
+		return nil, 0, fmt.Errorf("parity correction failed: %w", err)
+	}
+
+	// Validate against the checksum sidecar, if the collection was written with them
+	if found, err := VerifyChecksumSidecarData(ctx, filePath, contents); err != nil {
+		return nil, 0, fmt.Errorf("checksum verification failed: %w", err)
+	} else if found {
+		log.Debugf("Chunk file %s matches its checksum sidecar", chunkFile)
+	}
+
+	// Use the appropriate method to read the data based on file extension
+	var data []byte
+	switch strings.ToUpper(filepath.Ext(chunkFile)) {
+	case ".PNG":
+		if data, err = ExtractPNGChunkData(bytes.NewReader(contents), embedding); err != nil {
+			return nil, 0, fmt.Errorf("failed to extract data from PNG: %w", err)
+		}
+	case ".WAV":
+		if data, err = ExtractDataFromWAV(bytes.NewReader(contents)); err != nil {
+			return nil, 0, fmt.Errorf("failed to extract data from WAV: %w", err)
+		}
+	case ".TXT":
+		if data, err = ExtractDataFromText(bytes.NewReader(contents)); err != nil {
+			return nil, 0, fmt.Errorf("failed to extract data from text: %w", err)
+		}
+	default:
+		if data, err = ExtractDataFromBin(bytes.NewReader(contents)); err != nil {
+			return nil, 0, fmt.Errorf("failed to extract data from bin chunk: %w", err)
+		}
+	}
+	return data, corrected, nil
+}
+
 // readNextChunkFromTar reads the next chunk directly from a TAR file
 func (cr *CollectionReader) readNextChunkFromTar(ctx context.Context) ([]byte, error) {
 	log := trace.FromContext(ctx).WithPrefix("TAR-READER")
@@ -535,9 +812,8 @@ func (cr *CollectionReader) readNextChunkFromTar(ctx context.Context) ([]byte, e
 		ext := strings.ToUpper(filepath.Ext(name))
 
 		// Check if it's a valid chunk file based on extension
-		if (cr.Collection.Format == FormatPNG && (ext == ".PNG" || ext == ".png")) ||
-			(cr.Collection.Format == FormatBin && ext == ".bin") ||
-			(cr.Collection.Format == "" && (ext == ".PNG" || ext == ".png" || ext == ".bin")) {
+		if isChunkFile(cr.Collection.Format, name) {
+			cr.chunkPath = cr.Collection.Path + ":" + name
 
 			log.Debugf("Reading chunk %d (file: %s) from TAR stream for collection %s",
 				cr.ChunkIndex, name, cr.Collection.Name)
@@ -558,7 +834,7 @@ func (cr *CollectionReader) readNextChunkFromTar(ctx context.Context) ([]byte, e
 				log.Debugf("Successfully read %d bytes from TAR chunk %s", bytesRead, name)
 
 				// Extract data from the PNG with enhanced error reporting
-				data, err = ExtractDataFromPNG(&buf)
+				data, err = ExtractPNGChunkData(&buf, cr.Collection.PNGEmbedding)
 				if err != nil {
 					// Detailed error logging for PNG extraction failure
 					pngErr := fmt.Errorf("failed to extract data from PNG in TAR: %w", err)
@@ -574,18 +850,33 @@ func (cr *CollectionReader) readNextChunkFromTar(ctx context.Context) ([]byte, e
 					// Return the error rather than just continuing, to help with debugging
 					return nil, pngErr
 				}
+			} else if ext == ".WAV" {
+				data, err = ExtractDataFromWAV(cr.tarReader)
+				if err != nil {
+					wavErr := fmt.Errorf("failed to extract data from WAV in TAR: %w", err)
+					log.Error(wavErr)
+					return nil, wavErr
+				}
+			} else if ext == ".TXT" {
+				data, err = ExtractDataFromText(cr.tarReader)
+				if err != nil {
+					txtErr := fmt.Errorf("failed to extract data from text in TAR: %w", err)
+					log.Error(txtErr)
+					return nil, txtErr
+				}
 			} else {
-				// For binary files, just read the content
-				data, err = io.ReadAll(cr.tarReader)
+				data, err = ExtractDataFromBin(cr.tarReader)
 				if err != nil {
-					log.Error(fmt.Errorf("failed to read binary data from TAR: %w", err))
-					continue
+					binErr := fmt.Errorf("failed to extract data from bin chunk in TAR: %w", err)
+					log.Error(binErr)
+					return nil, binErr
 				}
 			}
 
 			log.Debugf("Successfully read %d bytes from TAR chunk %s", len(data), name)
 
 			// Increment the chunk index for the next read
+			cr.lastChunkName = name
 			cr.ChunkIndex++
 
 			return data, nil
@@ -600,6 +891,281 @@ func (cr *CollectionReader) readNextChunkFromTar(ctx context.Context) ([]byte, e
 	}
 }
 
+// readNextChunkFromVolumes reads the next chunk from a collection split into volumes, moving
+// on to the next volume at the end of each one
+func (cr *CollectionReader) readNextChunkFromVolumes(ctx context.Context) ([]byte, error) {
+	log := trace.FromContext(ctx).WithPrefix("COLLECTION-READER")
+
+	for cr.volume < len(cr.Collection.Volumes) {
+		volumePath := cr.Collection.Volumes[cr.volume]
+		if cr.volumeReader == nil {
+			log.Debugf("Reading volume %d of %d of collection %s: %s",
+				cr.volume+1, len(cr.Collection.Volumes), cr.Collection.Name, volumePath)
+			cr.volumeReader = NewCollectionReader(Collection{
+				Name:         cr.Collection.Name,
+				Path:         volumePath,
+				Format:       cr.Collection.Format,
+				StoredName:   cr.Collection.StoredName,
+				PNGEmbedding: cr.Collection.PNGEmbedding,
+			})
+			cr.volumeReader.Retry = cr.Retry
+		}
+
+		data, err := cr.volumeReader.readNextChunk(ctx)
+		cr.chunkPath = cr.volumeReader.chunkPath
+		if err == io.EOF || (err != nil && ArchiveFormatOf(volumePath) == ArchiveTar) {
+			// A damaged TAR can't be read past the bad entry, so carry on with the next volume
+			cr.volumeReader.Close()
+			cr.volumeReader = nil
+			cr.volume++
+		}
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("volume %s: %w", filepath.Base(volumePath), err)
+		}
+
+		cr.lastChunkName = cr.volumeReader.lastChunkName
+		cr.ChunkIndex++
+		return data, nil
+	}
+	return nil, io.EOF
+}
+
+// inspectArchive returns the collection name and chunk format of a TAR or ZIP collection from
+// the name of its first chunk entry, or empty strings if it holds no chunks. Only the entry
+// names are read.
+func inspectArchive(path string) (string, Format, error) {
+	var collName string
+	format := Format("")
+	err := WalkArchive(path, func(name string, r io.Reader) error {
+		if !isChunkFile("", name) {
+			return nil
+		}
+		switch strings.ToUpper(filepath.Ext(name)) {
+		case ".PNG":
+			format = FormatPNG
+		case ".BIN":
+			format = FormatBin
+		case ".TXT":
+			format = FormatText
+		case ".WAV":
+			format = FormatWAV
+		default:
+			return nil
+		}
+		collName = collectionNameFromChunkFile(filepath.Base(name))
+		return io.EOF
+	})
+	return collName, format, err
+}
+
+// isChunkFile reports whether the file or archive entry name holds chunk data for a
+// collection of the given format, by its extension; the recovery notes never do
+func isChunkFile(format Format, name string) bool {
+	if filepath.Base(name) == RecoveryFileName {
+		return false
+	}
+	return isChunkFileExt(format, strings.ToUpper(filepath.Ext(name)))
+}
+
+// isChunkFileExt reports whether a file with the given upper-cased extension holds
+// chunk data for a collection of the given format
+func isChunkFileExt(format Format, ext string) bool {
+	switch format {
+	case FormatPNG:
+		return ext == ".PNG"
+	case FormatBin:
+		return ext == ".BIN"
+	case FormatText:
+		return ext == ".TXT"
+	case FormatWAV:
+		return ext == ".WAV"
+	case "":
+		return ext == ".PNG" || ext == ".BIN" || ext == ".TXT" || ext == ".WAV"
+	}
+	return false
+}
+
+// chunkNumberDigits is the minimum number of digits in the chunk number of a chunk file
+// name. Chunks after 9999 simply use more digits, so names stay unique and collections
+// written before there could be more keep their names.
+const chunkNumberDigits = 4
+
+// formatChunkNumber formats a chunk number as it appears in chunk file names
+func formatChunkNumber(chunkNumber int) string {
+	return fmt.Sprintf("%0*d", chunkNumberDigits, chunkNumber)
+}
+
+// chunkNumberFromName returns the chunk number in a chunk file name such as
+// "3A5_0001.bin" or "IMG3A5_12345.PNG", or false if it has none
+func chunkNumberFromName(name string) (int, bool) {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	i := strings.LastIndexByte(name, '_')
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// ChunkNumbers returns the number of each chunk in a collection, in the order they are
+// stored, from the names in its directory or archives, without reading any chunks. A chunk
+// whose name has no number, such as one stored under a stealth name, is returned as 0.
+func ChunkNumbers(coll Collection) ([]int, error) {
+	paths := coll.Volumes
+	if len(paths) == 0 {
+		paths = []string{coll.Path}
+	}
+	var names []string
+	for _, path := range paths {
+		if IsArchivePath(path) {
+			var entries []string
+			err := WalkArchive(path, func(name string, r io.Reader) error {
+				entries = append(entries, filepath.Base(name))
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, entries...)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, entry.Name())
+			}
+		}
+		sortChunkFiles(files)
+		names = append(names, files...)
+	}
+
+	var numbers []int
+	for _, name := range names {
+		if isChunkFile(coll.Format, name) {
+			n, _ := chunkNumberFromName(name)
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers, nil
+}
+
+// sortChunkFiles orders chunk file names by chunk number, since chunk numbers past 9999
+// have more digits and sort wrongly as strings. Names without a chunk number sort by name
+// after those with one.
+func sortChunkFiles(names []string) {
+	sort.SliceStable(names, func(i, j int) bool {
+		ni, oki := chunkNumberFromName(names[i])
+		nj, okj := chunkNumberFromName(names[j])
+		switch {
+		case oki && okj && ni != nj:
+			return ni < nj
+		case oki != okj:
+			return oki
+		}
+		return names[i] < names[j]
+	})
+}
+
+// ChunkInfo describes where a chunk delivered by Chunks came from.
+type ChunkInfo struct {
+	Collection string // Name of the collection the chunk belongs to (e.g., "3A5")
+	FileName   string // Chunk file name, or TAR entry name for TAR collections
+	Format     Format // Storage format of the chunk file
+	Size       int    // Payload size in bytes, after any format decoding
+}
+
+// Chunk is a single item produced by CollectionReader.Chunks.
+//
+// Data holds the chunk payload exactly as ReadNextChunk would return it, that is
+// with any PNG wrapping removed but with the pad chunk header still present.
+// If Err is non-nil the iteration has failed and no further chunks will follow.
+type Chunk struct {
+	Index int       // 1-based position of the chunk within the collection
+	Info  ChunkInfo // Metadata about the chunk's origin
+	Data  []byte    // Chunk payload
+	Err   error     // Read error, set only on the final item of a failed iteration
+}
+
+// Chunks streams every remaining chunk in the collection over the returned channel,
+// in the same order that ReadNextChunk would deliver them.
+//
+// This lets library users upload, verify, or transform chunks without reimplementing
+// the directory, TAR, and PNG handling behind ReadNextChunk. The channel is closed
+// after the last chunk, after an error item, or when ctx is cancelled. Callers that
+// stop early should cancel ctx so the producing goroutine can exit.
+func (cr *CollectionReader) Chunks(ctx context.Context) <-chan Chunk {
+	ch := make(chan Chunk)
+
+	go func() {
+		defer close(ch)
+		defer cr.Close()
+
+		for {
+			index := cr.ChunkIndex
+			data, err := cr.ReadNextChunk(ctx)
+			if err == io.EOF {
+				return
+			}
+
+			var item Chunk
+			if err != nil {
+				item = Chunk{Index: index, Err: err}
+			} else {
+				item = Chunk{
+					Index: index,
+					Info: ChunkInfo{
+						Collection: cr.Collection.Name,
+						FileName:   cr.lastChunkName,
+						Format:     cr.Collection.Format,
+						Size:       len(data),
+					},
+					Data: data,
+				}
+			}
+
+			select {
+			case ch <- item:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Close releases any open file handles held by the reader
+func (cr *CollectionReader) Close() error {
+	if cr.volumeReader != nil {
+		err := cr.volumeReader.Close()
+		cr.volumeReader = nil
+		return err
+	}
+	if cr.zipReader != nil {
+		return cr.zipReader.Close()
+	}
+	if cr.tarFile != nil {
+		err := cr.tarFile.Close()
+		cr.tarFile = nil
+		cr.tarReader = nil
+		return err
+	}
+	return nil
+}
+
 // min is a helper function to get the minimum of two integers
 func min(a, b int) int {
 	if a < b {
@@ -4,9 +4,11 @@ package file
 
 import (
 	"context"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/blues/padlock/pkg/trace"
@@ -62,6 +64,38 @@ func TestCreateCollections(t *testing.T) {
 	}
 }
 
+// TestFindCollectionsMetadata checks that what a collection's metadata records about it
+// overrides what its files suggest
+func TestFindCollectionsMetadata(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+
+	for _, name := range []string{"2A3", "2B3"} {
+		collPath := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(collPath, 0755); err != nil {
+			t.Fatalf("Failed to create collection: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(collPath, "IMG"+name+"_0001.PNG"), []byte("chunk"), 0644); err != nil {
+			t.Fatalf("Failed to write chunk: %v", err)
+		}
+	}
+	md := &Metadata{Version: MetadataVersion, Collection: "2A3", Copies: 3, Required: 2, Format: FormatPNG, PNGEmbedding: PNGEmbedLSB, Chunks: 1}
+	if err := WriteMetadata(ctx, filepath.Join(tempDir, "2A3"), md); err != nil {
+		t.Fatalf("WriteMetadata failed: %v", err)
+	}
+
+	collections, _, err := FindCollections(ctx, tempDir)
+	if err != nil || len(collections) != 2 {
+		t.Fatalf("Expected 2 collections, got %d, %v", len(collections), err)
+	}
+	if c := collections[0]; c.Format != FormatPNG || c.PNGEmbedding != PNGEmbedLSB {
+		t.Errorf("Expected 2A3 to be read as its metadata records, got %s, %q", c.Format, c.PNGEmbedding)
+	}
+	if c := collections[1]; c.Format != FormatPNG || c.PNGEmbedding != "" {
+		t.Errorf("Expected 2B3, without metadata, to be inferred from its files, got %s, %q", c.Format, c.PNGEmbedding)
+	}
+}
+
 func TestTarCollections(t *testing.T) {
 	// Create a temporary output directory
 	tempDir, err := os.MkdirTemp("", "padlock-test-*")
@@ -201,3 +235,178 @@ func TestCollectionNameValidation(t *testing.T) {
 		})
 	}
 }
+
+// TestFindCollectionsDepth checks that collections in nested folders are found down to the
+// depth asked for, and that hidden folders aren't searched
+func TestFindCollectionsDepth(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	root := t.TempDir()
+	for _, path := range []string{"drive/2A3", "cloud/backups/2B3", ".trash/2C3"} {
+		name := filepath.Base(path)
+		if err := WriteNamedChunk(ctx, &BinFormatter{}, filepath.Join(root, path), name, 1, []byte("chunk")); err != nil {
+			t.Fatalf("Failed to write chunk: %v", err)
+		}
+	}
+
+	if _, _, err := FindCollectionsDepth(ctx, root, 0); err == nil {
+		t.Errorf("Expected no collections at the top level")
+	}
+	for depth, want := range map[int][]string{1: {"2A3"}, 2: {"2A3", "2B3"}, 5: {"2A3", "2B3"}} {
+		collections, _, err := FindCollectionsDepth(ctx, root, depth)
+		if err != nil {
+			t.Fatalf("Depth %d: %v", depth, err)
+		}
+		var names []string
+		for _, coll := range collections {
+			names = append(names, coll.Name)
+		}
+		if !slices.Equal(names, want) {
+			t.Errorf("Depth %d found %v, want %v", depth, names, want)
+		}
+	}
+}
+
+func TestCollectionReaderChunks(t *testing.T) {
+	// Create a temporary collection directory
+	tempDir, err := os.MkdirTemp("", "padlock-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create a context with tracer
+	ctx := context.Background()
+	tracer := trace.NewTracer("TEST", trace.LogLevelVerbose)
+	ctx = trace.WithContext(ctx, tracer)
+
+	// Write a few chunks in binary format
+	collPath := filepath.Join(tempDir, "2A3")
+	payloads := [][]byte{[]byte("first"), []byte("second"), []byte("third")}
+	for i, payload := range payloads {
+		if err := WriteNamedChunk(ctx, &BinFormatter{}, collPath, "2A3", i+1, payload); err != nil {
+			t.Fatalf("Failed to write chunk %d: %v", i+1, err)
+		}
+	}
+
+	reader := NewCollectionReader(Collection{Name: "2A3", Path: collPath, Format: FormatBin})
+
+	count := 0
+	for chunk := range reader.Chunks(ctx) {
+		if chunk.Err != nil {
+			t.Fatalf("Unexpected error reading chunk %d: %v", chunk.Index, chunk.Err)
+		}
+		if chunk.Index != count+1 {
+			t.Errorf("Chunk index = %d, want %d", chunk.Index, count+1)
+		}
+		if string(chunk.Data) != string(payloads[count]) {
+			t.Errorf("Chunk %d data = %q, want %q", chunk.Index, chunk.Data, payloads[count])
+		}
+		if chunk.Info.Collection != "2A3" || chunk.Info.Format != FormatBin || chunk.Info.Size != len(payloads[count]) {
+			t.Errorf("Chunk %d has unexpected info: %+v", chunk.Index, chunk.Info)
+		}
+		if chunk.Info.FileName == "" {
+			t.Errorf("Chunk %d has no file name", chunk.Index)
+		}
+		count++
+	}
+
+	if count != len(payloads) {
+		t.Errorf("Got %d chunks, want %d", count, len(payloads))
+	}
+}
+
+func TestCollectionReaderChunksPast9999(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	// Chunk numbers past 9999 get more digits, and are read after the 4-digit ones
+	collPath := filepath.Join(t.TempDir(), "2A3")
+	numbers := []int{9998, 9999, 10000, 10001, 100000}
+	for _, number := range numbers {
+		if err := WriteNamedChunk(ctx, &BinFormatter{}, collPath, "2A3", number, []byte(formatChunkNumber(number))); err != nil {
+			t.Fatalf("Failed to write chunk %d: %v", number, err)
+		}
+	}
+	if name, _ := NamedChunkFileName(&BinFormatter{}, "2A3", 10000); name != "2A3_10000.bin" {
+		t.Errorf("Unexpected name for chunk 10000: %s", name)
+	}
+	if name, _ := NamedChunkFileName(&PngFormatter{}, "2A3", 1); name != "IMG2A3_0001.PNG" {
+		t.Errorf("Unexpected name for chunk 1: %s", name)
+	}
+
+	reader := NewCollectionReader(Collection{Name: "2A3", Path: collPath, Format: FormatBin})
+	for _, number := range numbers {
+		data, err := reader.ReadNextChunk(ctx)
+		if err != nil {
+			t.Fatalf("Failed to read chunk %d: %v", number, err)
+		}
+		if string(data) != formatChunkNumber(number) {
+			t.Errorf("Read chunk %s, want %d", data, number)
+		}
+	}
+	if _, err := reader.ReadNextChunk(ctx); err != io.EOF {
+		t.Errorf("Expected EOF after the last chunk, got %v", err)
+	}
+
+	// Chunks are found by number, and a 4-digit number doesn't match the end of a longer one
+	for _, number := range []int{9999, 10001} {
+		data, err := (&BinFormatter{}).ReadChunk(ctx, collPath, 0, number)
+		if err != nil || string(data) != formatChunkNumber(number) {
+			t.Errorf("ReadChunk(%d) = %q, %v", number, data, err)
+		}
+	}
+	if _, err := (&BinFormatter{}).ReadChunk(ctx, collPath, 0, 1000); err == nil {
+		t.Errorf("Expected chunk 1000 not to be found")
+	}
+}
+
+func TestSortChunkFiles(t *testing.T) {
+	names := []string{"3A5_10000.bin", "padlock.json", "3A5_0002.bin", "3A5_9999.bin", "3A5_0001.bin"}
+	sortChunkFiles(names)
+	want := []string{"3A5_0001.bin", "3A5_0002.bin", "3A5_9999.bin", "3A5_10000.bin", "padlock.json"}
+	if !slices.Equal(names, want) {
+		t.Errorf("Got %v, want %v", names, want)
+	}
+}
+
+// TestChunkErrors checks that a chunk that can't be read is reported with its collection,
+// number, and file, and that ChunkNumbers lists the chunks a collection has without reading them
+func TestChunkErrors(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	collPath := filepath.Join(t.TempDir(), "2A3")
+	for _, number := range []int{1, 2, 4} {
+		if err := WriteNamedChunk(ctx, &BinFormatter{}, collPath, "2A3", number, []byte("chunk")); err != nil {
+			t.Fatalf("Failed to write chunk %d: %v", number, err)
+		}
+	}
+	coll := Collection{Name: "2A3", Path: collPath, Format: FormatBin}
+	numbers, err := ChunkNumbers(coll)
+	if err != nil || !slices.Equal(numbers, []int{1, 2, 4}) {
+		t.Errorf("ChunkNumbers = %v, %v; want [1 2 4]", numbers, err)
+	}
+
+	// The MAC of the second chunk doesn't match, so reading it fails with its file named
+	macs, err := NewChunkMACs([]byte("passphrase"))
+	if err != nil {
+		t.Fatalf("Failed to create MACs: %v", err)
+	}
+	for number, data := range []string{"chunk", "other", "chunk"} {
+		h := macs.NewHash(number + 1)
+		h.Write([]byte(data))
+		macs.Set(number+1, h)
+	}
+	reader := NewCollectionReader(coll)
+	reader.MACs = macs
+	if _, err := reader.ReadNextChunk(ctx); err != nil {
+		t.Fatalf("Failed to read chunk 1: %v", err)
+	}
+	_, err = reader.ReadNextChunk(ctx)
+	var chunkErr *ChunkError
+	if !errors.As(err, &chunkErr) || !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Expected a ChunkError, got %v", err)
+	}
+	if chunkErr.Collection != "2A3" || chunkErr.Chunk != 2 || chunkErr.Path != filepath.Join(collPath, "2A3_0002.bin") {
+		t.Errorf("Unexpected chunk error %+v", chunkErr)
+	}
+}
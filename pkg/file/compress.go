@@ -8,33 +8,178 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/blues/padlock/pkg/trace"
+	"github.com/klauspost/compress/zstd"
 )
 
+// Compressor is a stream compression algorithm that can be applied to serialized data.
+// Compressed streams are recognized on decode by the magic bytes they start with.
+type Compressor struct {
+	Name         string                                               // Name used to select the algorithm, e.g. "gzip"
+	Magic        []byte                                               // Bytes every compressed stream starts with
+	MinLevel     int                                                  // Lowest accepted compression level
+	MaxLevel     int                                                  // Highest accepted compression level
+	DefaultLevel int                                                  // Level used when none is selected
+	FastLevel    int                                                  // Level that compresses fastest
+	BestLevel    int                                                  // Level that compresses smallest
+	NewWriter    func(w io.Writer, level int) (io.WriteCloser, error) // Level 0 selects the algorithm's default
+	NewReader    func(r io.Reader) (io.Reader, error)
+}
+
+// zstdMagic starts every zstd frame, and is the longest magic number of any compressor
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+var (
+	compressorMutex sync.RWMutex
+	compressors     = map[string]Compressor{
+		"gzip": {
+			Name:         "gzip",
+			Magic:        []byte{0x1f, 0x8b},
+			MinLevel:     gzip.BestSpeed,
+			MaxLevel:     gzip.BestCompression,
+			DefaultLevel: 6, // What gzip.DefaultCompression selects
+			FastLevel:    gzip.BestSpeed,
+			BestLevel:    gzip.BestCompression,
+			NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+				if level == 0 {
+					level = gzip.DefaultCompression
+				}
+				return gzip.NewWriterLevel(w, level)
+			},
+			NewReader: func(r io.Reader) (io.Reader, error) {
+				return gzip.NewReader(r)
+			},
+		},
+		// Zstd levels follow the zstd command line, 1 to 22, and are mapped onto the nearest
+		// of the encoder's four speeds
+		"zstd": {
+			Name:         "zstd",
+			Magic:        zstdMagic,
+			MinLevel:     1,
+			MaxLevel:     22,
+			DefaultLevel: 3, // What zstd.SpeedDefault corresponds to
+			FastLevel:    1,
+			BestLevel:    22,
+			NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+				if level == 0 {
+					level = 3
+				}
+				return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+			},
+			NewReader: func(r io.Reader) (io.Reader, error) {
+				// A single-threaded decoder decodes synchronously, so it holds no goroutines
+				// that would need closing
+				return zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			},
+		},
+	}
+)
+
+// RegisterCompressor makes a compression algorithm available by name, replacing any existing
+// algorithm with the same name
+func RegisterCompressor(c Compressor) {
+	compressorMutex.Lock()
+	defer compressorMutex.Unlock()
+	compressors[strings.ToLower(c.Name)] = c
+}
+
+// Compressors returns the names of the registered compression algorithms, sorted
+func Compressors() []string {
+	compressorMutex.RLock()
+	defer compressorMutex.RUnlock()
+
+	names := make([]string, 0, len(compressors))
+	for name := range compressors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupCompressor returns the registered compression algorithm with the given name
+func LookupCompressor(name string) (Compressor, error) {
+	compressorMutex.RLock()
+	c, ok := compressors[strings.ToLower(name)]
+	compressorMutex.RUnlock()
+	if !ok {
+		return Compressor{}, fmt.Errorf("unknown compression %q (available: %s)", name, strings.Join(Compressors(), ", "))
+	}
+	return c, nil
+}
+
+// CheckLevel returns an error if level is neither 0 (the default) nor within the algorithm's range
+func (c Compressor) CheckLevel(level int) error {
+	if level != 0 && (level < c.MinLevel || level > c.MaxLevel) {
+		return fmt.Errorf("%s compression level must be between %d and %d, got %d", c.Name, c.MinLevel, c.MaxLevel, level)
+	}
+	return nil
+}
+
+// ResolveLevel returns the level that is actually used when level is selected, replacing 0
+// with the algorithm's default
+func (c Compressor) ResolveLevel(level int) int {
+	if level == 0 {
+		return c.DefaultLevel
+	}
+	return level
+}
+
 // CompressStreamToStream takes an io.Reader that it can read from and returns an io.Reader
 // where it writes a compressed form of the stream using gzip.
 func CompressStreamToStream(ctx context.Context, r io.Reader) io.Reader {
+	pr, err := CompressStream(ctx, r, "gzip", 0)
+	if err != nil {
+		// gzip is always registered, and the default level is always valid
+		panic(err)
+	}
+	return pr
+}
+
+// CompressStream returns an io.Reader that yields r compressed with the named algorithm at
+// the given level, where 0 selects the algorithm's default
+func CompressStream(ctx context.Context, r io.Reader, algorithm string, level int) (io.Reader, error) {
 	log := trace.FromContext(ctx).WithPrefix("compress")
-	log.Debugf("Starting compression of stream")
+
+	c, err := LookupCompressor(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.CheckLevel(level); err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Starting %s compression of stream", c.Name)
 	pr, pw := io.Pipe()
 
 	go func() {
-		log.Debugf("Creating gzip writer")
-		gzw := gzip.NewWriter(pw)
-		log.Debugf("Copying input stream to gzip writer")
-		written, err := io.Copy(gzw, r)
+		// Cancelling ctx unblocks a write to a reader that has stopped reading
+		defer context.AfterFunc(ctx, func() { pw.CloseWithError(ctx.Err()) })()
+
+		log.Debugf("Creating %s writer", c.Name)
+		cw, err := c.NewWriter(pw, level)
+		if err != nil {
+			log.Error(fmt.Errorf("error creating %s writer: %w", c.Name, err))
+			pw.CloseWithError(fmt.Errorf("error creating %s writer: %w", c.Name, err))
+			return
+		}
+		log.Debugf("Copying input stream to %s writer", c.Name)
+		written, err := io.Copy(cw, NewContextReader(ctx, r))
 
 		if err != nil {
 			log.Error(fmt.Errorf("error during compression: %w", err))
-		} else {
-			log.Debugf("Successfully copied %d bytes to gzip writer", written)
+			pw.CloseWithError(fmt.Errorf("error during compression: %w", err))
+			return
 		}
+		log.Debugf("Successfully copied %d bytes to %s writer", written, c.Name)
 
-		// Close gzip writer and pipe writer
-		if err := gzw.Close(); err != nil {
-			log.Error(fmt.Errorf("error closing gzip writer: %w", err))
-			pw.CloseWithError(fmt.Errorf("error closing gzip writer: %w", err))
+		// Close compressing writer and pipe writer
+		if err := cw.Close(); err != nil {
+			log.Error(fmt.Errorf("error closing %s writer: %w", c.Name, err))
+			pw.CloseWithError(fmt.Errorf("error closing %s writer: %w", c.Name, err))
 			return
 		}
 
@@ -42,54 +187,76 @@ func CompressStreamToStream(ctx context.Context, r io.Reader) io.Reader {
 		pw.Close()
 	}()
 
-	return pr
+	return pr, nil
+}
+
+// DetectCompression returns the name of the compression algorithm a stream starting with
+// prefix was compressed with, or "" if it doesn't start with a known magic number
+func DetectCompression(prefix []byte) string {
+	compressorMutex.RLock()
+	defer compressorMutex.RUnlock()
+
+	for name, c := range compressors {
+		if len(c.Magic) > 0 && bytes.HasPrefix(prefix, c.Magic) {
+			return name
+		}
+	}
+	return ""
 }
 
 // DecompressStreamToStream takes a compressed io.Reader that it can read from and returns an io.Reader
-// where it writes the decompressed form of the stream.
+// where it writes the decompressed form of the stream. The compression algorithm is detected from
+// the start of the stream; a stream that isn't compressed is returned as it is.
 func DecompressStreamToStream(ctx context.Context, r io.Reader) (io.Reader, error) {
 	log := trace.FromContext(ctx).WithPrefix("decompress")
 	log.Debugf("Starting decompression of stream")
 
-	// Use a buffer to peek at the first 2 bytes without consuming the stream
-	peekBuf := make([]byte, 2)
+	// Use a buffer to peek at the magic number without consuming the stream
+	peekBuf := make([]byte, len(zstdMagic))
 	n, err := io.ReadFull(r, peekBuf)
 
 	// If we couldn't read 2 bytes, the stream might be empty or has only 1 byte
-	if err != nil {
+	if err != nil && err != io.ErrUnexpectedEOF {
 		if err == io.EOF {
 			// Empty stream
 			log.Debugf("Stream is empty, returning empty reader")
 			return bytes.NewReader([]byte{}), nil
-		} else if err == io.ErrUnexpectedEOF {
-			// Stream has fewer than 2 bytes
-			log.Debugf("Stream has only %d bytes, too small to be compressed", n)
-			return bytes.NewReader(peekBuf[:n]), nil
-		} else {
-			// Real error
-			log.Error(fmt.Errorf("failed to read from input stream: %w", err))
-			return nil, fmt.Errorf("failed to read from input stream: %w", err)
 		}
+		// Real error
+		log.Error(fmt.Errorf("failed to read from input stream: %w", err))
+		return nil, fmt.Errorf("failed to read from input stream: %w", err)
+	}
+	peekBuf = peekBuf[:n]
+	if n < 2 {
+		// Stream has fewer than 2 bytes
+		log.Debugf("Stream has only %d bytes, too small to be compressed", n)
+		return bytes.NewReader(peekBuf), nil
 	}
 
 	// Create a combined reader with the peeked data and the rest of the stream
 	combinedReader := io.MultiReader(bytes.NewReader(peekBuf), r)
 
-	// Check if the data has a valid gzip header
-	if peekBuf[0] != 0x1f || peekBuf[1] != 0x8b {
-		log.Debugf("Data does not appear to be gzip compressed, skipping decompression")
+	// Check if the data starts with the magic number of a known algorithm
+	algorithm := DetectCompression(peekBuf)
+	if algorithm == "" {
+		log.Debugf("Data does not appear to be compressed, skipping decompression")
 		// Return the combined reader without decompression
 		return combinedReader, nil
 	}
+	c, err := LookupCompressor(algorithm)
+	if err != nil {
+		log.Error(fmt.Errorf("data is %s compressed: %w", algorithm, err))
+		return nil, fmt.Errorf("data is %s compressed: %w", algorithm, err)
+	}
 
-	// Create a new gzip reader
-	gzr, err := gzip.NewReader(combinedReader)
+	// Create a new decompressing reader
+	cr, err := c.NewReader(combinedReader)
 	if err != nil {
-		log.Error(fmt.Errorf("failed to create gzip reader: %w", err))
-		// If we can't create a gzip reader but detected gzip header, something is wrong with the data
-		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		log.Error(fmt.Errorf("failed to create %s reader: %w", c.Name, err))
+		// If we can't create a reader but detected its magic number, something is wrong with the data
+		return nil, fmt.Errorf("failed to create %s reader: %w", c.Name, err)
 	}
 
-	log.Debugf("Decompression started successfully")
-	return gzr, nil
+	log.Debugf("%s decompression started successfully", c.Name)
+	return cr, nil
 }
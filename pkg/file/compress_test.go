@@ -5,6 +5,7 @@ package file
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"strings"
 	"testing"
@@ -42,6 +43,22 @@ func TestCompressStreamToStream(t *testing.T) {
 	}
 }
 
+func TestCompressStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal)))
+
+	compressed, err := CompressStream(ctx, endlessReader{}, "gzip", 0)
+	if err != nil {
+		t.Fatalf("CompressStream failed: %v", err)
+	}
+	if _, err := io.ReadFull(compressed, make([]byte, 64)); err != nil {
+		t.Fatalf("Read before cancel failed: %v", err)
+	}
+	cancel()
+	if _, err := io.Copy(io.Discard, compressed); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled after cancel, got %v", err)
+	}
+}
+
 func TestDecompressStreamToStream(t *testing.T) {
 	ctx := context.Background()
 	tracer := trace.NewTracer("TEST", trace.LogLevelVerbose)
@@ -169,3 +186,114 @@ func TestCompressEmptyInput(t *testing.T) {
 		t.Errorf("Decompressed empty input is not empty: %v", decompressedData)
 	}
 }
+
+// nopWriteCloser adds a Close method to a writer, for the test compressor
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestRegisteredCompressors(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	// A registered algorithm is used to compress and is detected on decompression
+	magic := []byte("TST1")
+	RegisterCompressor(Compressor{
+		Name:     "test",
+		Magic:    magic,
+		MinLevel: 1,
+		MaxLevel: 3,
+		NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			if _, err := w.Write(magic); err != nil {
+				return nil, err
+			}
+			return nopWriteCloser{w}, nil
+		},
+		NewReader: func(r io.Reader) (io.Reader, error) {
+			if _, err := io.ReadFull(r, make([]byte, len(magic))); err != nil {
+				return nil, err
+			}
+			return r, nil
+		},
+	})
+	defer func() {
+		compressorMutex.Lock()
+		delete(compressors, "test")
+		compressorMutex.Unlock()
+	}()
+
+	testData := strings.Repeat("compress me ", 100)
+	compressed, err := CompressStream(ctx, strings.NewReader(testData), "TEST", 2)
+	if err != nil {
+		t.Fatalf("CompressStream failed: %v", err)
+	}
+	data, err := io.ReadAll(compressed)
+	if err != nil || !bytes.HasPrefix(data, magic) {
+		t.Fatalf("Expected the test compressor's output, got %q (%v)", data[:min(len(data), 8)], err)
+	}
+	if got := DetectCompression(data); got != "test" {
+		t.Errorf("Expected test compression to be detected, got %q", got)
+	}
+	decompressed, err := DecompressStreamToStream(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecompressStreamToStream failed: %v", err)
+	}
+	if out, _ := io.ReadAll(decompressed); string(out) != testData {
+		t.Errorf("Round trip through the test compressor changed the data")
+	}
+
+	// Levels outside the algorithm's range and unknown algorithms are refused
+	if _, err := CompressStream(ctx, strings.NewReader(testData), "test", 4); err == nil {
+		t.Errorf("Expected an error for an out of range level")
+	}
+	if _, err := CompressStream(ctx, strings.NewReader(testData), "lzma", 0); err == nil {
+		t.Errorf("Expected an error for an unknown algorithm")
+	}
+}
+
+func TestZstdRoundTrip(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	testData := strings.Repeat("zstd compresses this nicely ", 1000)
+
+	compress := func(level int) []byte {
+		compressed, err := CompressStream(ctx, strings.NewReader(testData), "zstd", level)
+		if err != nil {
+			t.Fatalf("CompressStream at level %d failed: %v", level, err)
+		}
+		data, err := io.ReadAll(compressed)
+		if err != nil {
+			t.Fatalf("Failed to read zstd stream at level %d: %v", level, err)
+		}
+		return data
+	}
+	decompress := func(data []byte) string {
+		decompressed, err := DecompressStreamToStream(ctx, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("DecompressStreamToStream failed: %v", err)
+		}
+		out, err := io.ReadAll(decompressed)
+		if err != nil {
+			t.Fatalf("Failed to decompress: %v", err)
+		}
+		return string(out)
+	}
+
+	// Every level compresses, and decode recognizes zstd from the data
+	for _, level := range []int{0, 1, 3, 9, 19, 22} {
+		data := compress(level)
+		if len(data) >= len(testData) || DetectCompression(data) != "zstd" {
+			t.Errorf("Level %d: expected a smaller zstd stream, got %d bytes detected as %q", level, len(data), DetectCompression(data))
+		}
+		if decompress(data) != testData {
+			t.Errorf("Level %d: round trip changed the data", level)
+		}
+	}
+
+	// Frames written one after another, as indexed blocks are, decompress as one stream
+	if got := decompress(append(compress(1), compress(19)...)); got != testData+testData {
+		t.Errorf("Concatenated zstd frames did not decompress to both inputs")
+	}
+
+	if _, err := CompressStream(ctx, strings.NewReader(testData), "zstd", 23); err == nil {
+		t.Errorf("Expected an error for an out of range zstd level")
+	}
+}
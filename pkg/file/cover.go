@@ -0,0 +1,261 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // Register the JPEG decoder for cover photos
+	"image/png"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CoverImages supplies the visible images of PNG chunk files from a directory of the user's
+// own photos, so that a collection looks like an ordinary folder of pictures rather than a
+// series of single-pixel images. The photos are used in turn, starting over after the last.
+//
+// PNG photos are used unchanged, with the chunk data inserted before their IEND chunk. JPEG
+// photos are converted to PNG, which is slower and produces larger files.
+//
+// Without photos, GeneratedCoverImages synthesizes a different image for each chunk instead.
+type CoverImages struct {
+	paths    []string
+	mutex    sync.Mutex
+	next     int
+	generate bool   // Synthesize images instead of using photos
+	seed     uint64 // Varies the generated images from one encode to the next
+}
+
+// GeneratedCoverImages returns cover images that are synthesized for each chunk: smooth
+// gradients with soft highlights and a little sensor-like noise, sized in proportion to the
+// chunk data, as a photo of that file size would be
+func GeneratedCoverImages() *CoverImages {
+	return &CoverImages{generate: true, seed: uint64(time.Now().UnixNano())}
+}
+
+// LoadCoverImages finds the PNG and JPEG photos in dir. Only their headers are read here;
+// each photo is read in full when it is next used.
+func LoadCoverImages(dir string) (*CoverImages, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cover directory: %w", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".png", ".jpg", ".jpeg":
+		default:
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open cover image: %w", err)
+		}
+		_, _, err = image.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cover image %s is not a readable PNG or JPEG: %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no PNG or JPEG images found in cover directory %s", dir)
+	}
+	sort.Strings(paths)
+
+	return &CoverImages{paths: paths}, nil
+}
+
+// Len returns the number of cover photos, or 0 for generated images
+func (c *CoverImages) Len() int {
+	return len(c.paths)
+}
+
+// nextPath returns the path of the next cover photo in turn
+func (c *CoverImages) nextPath() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	path := c.paths[c.next]
+	c.next = (c.next + 1) % len(c.paths)
+	return path
+}
+
+// nextRand returns the source of randomness for the next generated image
+func (c *CoverImages) nextRand() *rand.Rand {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	n := c.next
+	c.next++
+	return rand.New(rand.NewPCG(c.seed, uint64(n)))
+}
+
+// nextImage returns the next cover photo in turn, decoded
+func (c *CoverImages) nextImage() (image.Image, error) {
+	path := c.nextPath()
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cover image: %w", err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cover image %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// nextPNG returns the PNG encoding of the next cover photo in turn
+func (c *CoverImages) nextPNG() ([]byte, error) {
+	path := c.nextPath()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cover image: %w", err)
+	}
+
+	if bytes.HasPrefix(data, pngSignature) {
+		if findPNGChunk(data, "rAWd") >= 0 {
+			return nil, fmt.Errorf("cover image %s already holds padlock chunk data", path)
+		}
+		return data, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cover image %s: %w", path, err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to convert cover image %s to PNG: %w", path, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writePNGChunk writes data as a PNG chunk file, using the next cover image as the visible
+// image, or a single transparent pixel if covers is nil. With PNGEmbedLSB the data is hidden
+// in the image's pixels, and if covers is nil an image large enough to hold it is generated.
+func writePNGChunk(w io.Writer, covers *CoverImages, embedding PNGEmbedding, data []byte) error {
+	if embedding == PNGEmbedLSB {
+		var img image.Image
+		switch {
+		case covers == nil:
+			img = generateCoverImage(lsbPixelsNeeded(len(data)), rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())))
+		case covers.generate:
+			img = generateCoverImage(lsbPixelsNeeded(len(data)), covers.nextRand())
+		default:
+			var err error
+			if img, err = covers.nextImage(); err != nil {
+				return err
+			}
+		}
+		return encodePNGWithPixelData(w, img, data)
+	}
+
+	if covers == nil {
+		img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+		img.Set(0, 0, color.Transparent)
+		return encodePNGWithData(w, img, data)
+	}
+
+	if covers.generate {
+		// About as many bytes of pixel data as the chunk data it will carry
+		return encodePNGWithData(w, generateCoverImage(len(data)/3, covers.nextRand()), data)
+	}
+
+	cover, err := covers.nextPNG()
+	if err != nil {
+		return err
+	}
+	return insertPNGData(w, cover, data)
+}
+
+const (
+	// Generated cover images are between these sizes, in a 4:3 aspect ratio
+	minCoverWidth = 64
+	maxCoverWidth = 4032
+)
+
+// coverImageSize returns the dimensions of a 4:3 generated image with at least the given
+// number of pixels, within the limits on its size
+func coverImageSize(pixels int) (width, height int) {
+	width = int(math.Ceil(math.Sqrt(float64(pixels) * 4 / 3)))
+	width = max(minCoverWidth, min(maxCoverWidth, (width+3)&^3))
+	for width*(width*3/4) < pixels && width < maxCoverWidth {
+		width += 4
+	}
+	return width, width * 3 / 4
+}
+
+// generateCoverImage synthesizes a plausible picture with at least the given number of
+// pixels: a gradient between two random colors, a few soft blobs of color, and noise
+func generateCoverImage(pixels int, rng *rand.Rand) image.Image {
+	width, height := coverImageSize(pixels)
+
+	randomColor := func() [3]float64 {
+		return [3]float64{rng.Float64() * 255, rng.Float64() * 255, rng.Float64() * 255}
+	}
+	from, to := randomColor(), randomColor()
+	angle := rng.Float64() * 2 * math.Pi
+	dx, dy := math.Cos(angle), math.Sin(angle)
+
+	type blob struct {
+		x, y, radius float64
+		color        [3]float64
+	}
+	blobs := make([]blob, 2+rng.IntN(3))
+	for i := range blobs {
+		blobs[i] = blob{
+			x:      rng.Float64() * float64(width),
+			y:      rng.Float64() * float64(height),
+			radius: (0.1 + rng.Float64()*0.3) * float64(width),
+			color:  randomColor(),
+		}
+	}
+	noise := 2 + rng.IntN(10)
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	diagonal := math.Hypot(float64(width), float64(height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Position along the gradient, from 0 to 1
+			t := ((float64(x)-float64(width)/2)*dx+(float64(y)-float64(height)/2)*dy)/diagonal + 0.5
+			var c [3]float64
+			for i := range c {
+				c[i] = from[i] + (to[i]-from[i])*t
+			}
+			for _, b := range blobs {
+				d2 := ((float64(x)-b.x)*(float64(x)-b.x) + (float64(y)-b.y)*(float64(y)-b.y)) / (b.radius * b.radius)
+				if d2 < 4 {
+					weight := math.Exp(-d2) * 0.6
+					for i := range c {
+						c[i] += (b.color[i] - c[i]) * weight
+					}
+				}
+			}
+
+			p := img.PixOffset(x, y)
+			for i := range c {
+				v := int(c[i]) + rng.IntN(2*noise+1) - noise
+				img.Pix[p+i] = uint8(max(0, min(255, v)))
+			}
+			img.Pix[p+3] = 255
+		}
+	}
+	return img
+}
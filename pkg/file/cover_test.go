@@ -0,0 +1,171 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCoverPNG writes a small PNG photo with a tEXt chunk holding the bytes "rAWd", which
+// must not be mistaken for the chunk data inserted later
+func writeCoverPNG(t *testing.T, path string) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 12))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 12; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 20), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode cover: %v", err)
+	}
+	encoded := buf.Bytes()
+
+	text := []byte("Comment\x00rAWd")
+	var chunk bytes.Buffer
+	binary.Write(&chunk, binary.BigEndian, uint32(len(text)))
+	chunk.WriteString("tEXt")
+	chunk.Write(text)
+	binary.Write(&chunk, binary.BigEndian, crc32.ChecksumIEEE(append([]byte("tEXt"), text...)))
+
+	iend := findPNGChunk(encoded, "IEND")
+	photo := append(append(append([]byte{}, encoded[:iend]...), chunk.Bytes()...), encoded[iend:]...)
+	if err := os.WriteFile(path, photo, 0644); err != nil {
+		t.Fatalf("Failed to write cover: %v", err)
+	}
+}
+
+func TestCoverImages(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "padlock-cover-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	writeCoverPNG(t, filepath.Join(tempDir, "a.png"))
+	f, err := os.Create(filepath.Join(tempDir, "b.jpg"))
+	if err != nil {
+		t.Fatalf("Failed to create JPEG: %v", err)
+	}
+	if err := jpeg.Encode(f, image.NewGray(image.Rect(0, 0, 20, 10)), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	f.Close()
+	if err := os.WriteFile(filepath.Join(tempDir, "notes.txt"), []byte("not a photo"), 0644); err != nil {
+		t.Fatalf("Failed to write notes: %v", err)
+	}
+
+	covers, err := LoadCoverImages(tempDir)
+	if err != nil {
+		t.Fatalf("LoadCoverImages failed: %v", err)
+	}
+	if covers.Len() != 2 {
+		t.Fatalf("Expected 2 cover images, got %d", covers.Len())
+	}
+
+	// The covers are used in turn, and the data comes back from each
+	wantWidths := []int{16, 20, 16}
+	for i, width := range wantWidths {
+		data := bytes.Repeat([]byte{byte(i)}, 500)
+		var buf bytes.Buffer
+		if err := writePNGChunk(&buf, covers, PNGEmbedChunk, data); err != nil {
+			t.Fatalf("writePNGChunk %d failed: %v", i, err)
+		}
+
+		cfg, err := png.DecodeConfig(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("Chunk file %d is not a valid PNG: %v", i, err)
+		}
+		if cfg.Width != width {
+			t.Errorf("Chunk file %d is %d pixels wide, want %d", i, cfg.Width, width)
+		}
+
+		got, err := ExtractDataFromPNG(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("ExtractDataFromPNG %d failed: %v", i, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Extracted data %d does not match the original", i)
+		}
+	}
+}
+
+func TestCoverImagesRejected(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "padlock-cover-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := LoadCoverImages(tempDir); err == nil {
+		t.Errorf("Expected an error for a directory without images")
+	}
+
+	// A chunk file can't be used as a cover, since it already holds chunk data
+	var buf bytes.Buffer
+	if err := writePNGChunk(&buf, nil, PNGEmbedChunk, []byte("data")); err != nil {
+		t.Fatalf("writePNGChunk failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "IMG2A3_0001.PNG"), buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write chunk file: %v", err)
+	}
+	covers, err := LoadCoverImages(tempDir)
+	if err != nil {
+		t.Fatalf("LoadCoverImages failed: %v", err)
+	}
+	if err := writePNGChunk(&bytes.Buffer{}, covers, PNGEmbedChunk, []byte("data")); err == nil {
+		t.Errorf("Expected an error for a cover that already holds chunk data")
+	}
+}
+
+func TestGeneratedCoverImages(t *testing.T) {
+	covers := GeneratedCoverImages()
+
+	var first []byte
+	for i, size := range []int{100, 300000, 300000} {
+		data := bytes.Repeat([]byte{byte(i)}, size)
+		var buf bytes.Buffer
+		if err := writePNGChunk(&buf, covers, PNGEmbedChunk, data); err != nil {
+			t.Fatalf("writePNGChunk %d failed: %v", i, err)
+		}
+
+		img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("Chunk file %d is not a valid PNG: %v", i, err)
+		}
+		width, height := img.Bounds().Dx(), img.Bounds().Dy()
+		if width*3 != height*4 {
+			t.Errorf("Chunk file %d is %dx%d, want a 4:3 image", i, width, height)
+		}
+		if size == 100 && width != minCoverWidth {
+			t.Errorf("Small chunk has a %d pixel wide image, want the minimum of %d", width, minCoverWidth)
+		}
+		if pixelBytes := width * height * 3; size > 1000 && (pixelBytes < size/2 || pixelBytes > size*2) {
+			t.Errorf("Image of %dx%d isn't in proportion to %d bytes of data", width, height, size)
+		}
+
+		got, err := ExtractDataFromPNG(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("ExtractDataFromPNG %d failed: %v", i, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Extracted data %d does not match the original", i)
+		}
+
+		// Each chunk gets a different image
+		if i == 1 {
+			first = buf.Bytes()
+		} else if i == 2 && bytes.Equal(first[:200], buf.Bytes()[:200]) {
+			t.Errorf("Two chunks have the same generated image")
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// A deduplicated stream stores each block of its data once. The data is cut into blocks at
+// boundaries chosen by a rolling hash of its content, so that the same run of bytes is cut
+// the same way wherever it occurs, such as in copies of a file, or in a file that only had
+// something inserted in it. The first time a block occurs it is written as a literal; each
+// time it occurs again it is written as a reference to the literal, by number.
+//
+// Stream layout:
+//
+//	magic     8 bytes  dedupMagic
+//	records            One of, repeated:
+//	                     'L', 4-byte big-endian length, then that many bytes of data
+//	                     'R', 8-byte big-endian number of an earlier literal, from 0
+//	end       1 byte   'E'
+//	length    8 bytes  Total length of the data, big-endian
+//
+// Like the padding magic, the magic starts with a NUL byte, so a deduplicated stream is never
+// mistaken for a TAR, gzip, or zstd stream. Decoding needs every literal that may be referred
+// to, so they are spooled to a temporary file.
+const dedupMagic = "\x00PLKDEDP"
+
+const (
+	dedupLiteral   = 'L'
+	dedupReference = 'R'
+	dedupEnd       = 'E'
+)
+
+// Block sizes of a deduplicated stream. A boundary is found, on average, every
+// dedupAverageBlock bytes after the first dedupMinBlock of a block, and a block is cut at
+// dedupMaxBlock if none is.
+const (
+	dedupMinBlock     = 2 * 1024
+	dedupAverageBlock = 8 * 1024
+	dedupMaxBlock     = 64 * 1024
+)
+
+// DedupMaxBlocks is the number of distinct blocks a deduplicated stream indexes, which bounds
+// the memory its encoder uses to about 100 bytes a block. Blocks after that are still
+// written, but only the blocks already indexed are found again.
+const DedupMaxBlocks = 1 << 22
+
+// gearTable holds the random value each byte adds to the rolling hash. It only decides where
+// blocks are cut, so any table works, but one that is fixed finds the same blocks every time.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x5061646c6f636b21) // SplitMix64
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// IsDedupStream reports whether data begins with the magic of a deduplicated stream
+func IsDedupStream(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(dedupMagic))
+}
+
+// DedupStats counts what a deduplicated stream stored. It is complete once the stream has
+// been read to the end.
+type DedupStats struct {
+	Bytes          int64 // Bytes of data read
+	Blocks         int   // Blocks the data was cut into
+	DuplicateBytes int64 // Bytes of data written as references to earlier blocks
+}
+
+// DedupStream returns a reader that yields r as a deduplicated stream, and counts what it
+// stores in stats, if that isn't nil.
+func DedupStream(ctx context.Context, r io.Reader, stats *DedupStats) io.Reader {
+	trace.FromContext(ctx).WithPrefix("dedup").Debugf("Deduplicating the stream in blocks of about %d bytes", dedupAverageBlock)
+	if stats == nil {
+		stats = &DedupStats{}
+	}
+	return &dedupReader{
+		r:      bufio.NewReaderSize(NewContextReader(ctx, r), 2*dedupMaxBlock),
+		out:    []byte(dedupMagic),
+		blocks: make(map[[sha256.Size]byte]uint64),
+		stats:  stats,
+	}
+}
+
+// dedupReader writes the records of a deduplicated stream as it is read
+type dedupReader struct {
+	r        *bufio.Reader
+	out      []byte // Encoded bytes not yet read
+	blocks   map[[sha256.Size]byte]uint64
+	literals uint64 // Literals written
+	stats    *DedupStats
+	done     bool
+}
+
+func (dr *dedupReader) Read(p []byte) (int, error) {
+	for len(dr.out) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.out)
+	dr.out = dr.out[n:]
+	return n, nil
+}
+
+// next encodes the next block of the data, or the end of the stream
+func (dr *dedupReader) next() error {
+	window, err := dr.r.Peek(dedupMaxBlock)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+	if len(window) == 0 {
+		dr.out = binary.BigEndian.AppendUint64([]byte{dedupEnd}, uint64(dr.stats.Bytes))
+		dr.done = true
+		return nil
+	}
+	block := window[:blockBoundary(window)]
+	dr.stats.Bytes += int64(len(block))
+	dr.stats.Blocks++
+
+	sum := sha256.Sum256(block)
+	if number, ok := dr.blocks[sum]; ok {
+		dr.out = binary.BigEndian.AppendUint64(append(dr.out[:0], dedupReference), number)
+		dr.stats.DuplicateBytes += int64(len(block))
+	} else {
+		if len(dr.blocks) < DedupMaxBlocks {
+			dr.blocks[sum] = dr.literals
+		}
+		dr.literals++
+		dr.out = binary.BigEndian.AppendUint32(append(dr.out[:0], dedupLiteral), uint32(len(block)))
+		dr.out = append(dr.out, block...)
+	}
+	_, err = dr.r.Discard(len(block))
+	return err
+}
+
+// blockBoundary returns the length of the block that starts data: up to where the rolling
+// hash of its content selects a boundary, or all of data if it is shorter than a block
+func blockBoundary(data []byte) int {
+	if len(data) <= dedupMinBlock {
+		return len(data)
+	}
+	limit := min(len(data), dedupMaxBlock)
+	const mask = dedupAverageBlock - 1
+	var hash uint64
+	for i := dedupMinBlock; i < limit; i++ {
+		hash = hash<<1 + gearTable[data[i]]
+		if hash&(mask<<48) == 0 {
+			return i + 1
+		}
+	}
+	return limit
+}
+
+// UndedupStream returns a reader that yields the data of a deduplicated stream, or r itself
+// if it isn't deduplicated. The literals of the stream are spooled to a temporary file, which
+// Close removes.
+func UndedupStream(ctx context.Context, r io.Reader) (io.ReadCloser, error) {
+	log := trace.FromContext(ctx).WithPrefix("dedup")
+
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(dedupMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read from input stream: %w", err)
+	}
+	if !IsDedupStream(magic) {
+		return io.NopCloser(br), nil
+	}
+	br.Discard(len(dedupMagic))
+
+	spool, err := os.CreateTemp(TempDir(), "padlock-dedup-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a file for the blocks of the deduplicated stream: %w", err)
+	}
+	log.Debugf("Rebuilding the deduplicated stream, with its blocks in %s", spool.Name())
+	return &undedupReader{r: br, spool: spool}, nil
+}
+
+// undedupReader rebuilds the data of a deduplicated stream from its records
+type undedupReader struct {
+	r        *bufio.Reader
+	spool    *os.File
+	size     int64   // Bytes written to spool
+	literals []int64 // Offset in spool of each literal, which ends where the next starts
+	block    []byte  // Rebuilt data not yet read
+	buf      []byte
+	length   int64 // Bytes of data rebuilt
+	done     bool
+}
+
+func (ur *undedupReader) Read(p []byte) (int, error) {
+	for len(ur.block) == 0 {
+		if ur.done {
+			return 0, io.EOF
+		}
+		if err := ur.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, ur.block)
+	ur.block = ur.block[n:]
+	ur.length += int64(n)
+	return n, nil
+}
+
+// next reads the next record, rebuilding its block of data
+func (ur *undedupReader) next() error {
+	kind, err := ur.r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("deduplicated stream ended within its data: %w", io.ErrUnexpectedEOF)
+	}
+	switch kind {
+	case dedupLiteral:
+		var header [4]byte
+		if _, err := io.ReadFull(ur.r, header[:]); err != nil {
+			return fmt.Errorf("deduplicated stream ended within its data: %w", io.ErrUnexpectedEOF)
+		}
+		size := int(binary.BigEndian.Uint32(header[:]))
+		if size == 0 || size > dedupMaxBlock {
+			return fmt.Errorf("deduplicated stream has a block of %d bytes, more than the most of %d", size, dedupMaxBlock)
+		}
+		ur.buf = ur.blockBuffer(size)
+		if _, err := io.ReadFull(ur.r, ur.buf); err != nil {
+			return fmt.Errorf("deduplicated stream ended within its data: %w", io.ErrUnexpectedEOF)
+		}
+		if _, err := ur.spool.WriteAt(ur.buf, ur.size); err != nil {
+			return fmt.Errorf("failed to spool a block of the deduplicated stream: %w", err)
+		}
+		ur.literals = append(ur.literals, ur.size)
+		ur.size += int64(size)
+		ur.block = ur.buf
+
+	case dedupReference:
+		var header [8]byte
+		if _, err := io.ReadFull(ur.r, header[:]); err != nil {
+			return fmt.Errorf("deduplicated stream ended within its data: %w", io.ErrUnexpectedEOF)
+		}
+		number := binary.BigEndian.Uint64(header[:])
+		if number >= uint64(len(ur.literals)) {
+			return fmt.Errorf("deduplicated stream refers to block %d of the %d it has held", number, len(ur.literals))
+		}
+		end := ur.size
+		if number+1 < uint64(len(ur.literals)) {
+			end = ur.literals[number+1]
+		}
+		ur.buf = ur.blockBuffer(int(end - ur.literals[number]))
+		if _, err := ur.spool.ReadAt(ur.buf, ur.literals[number]); err != nil {
+			return fmt.Errorf("failed to read a spooled block of the deduplicated stream: %w", err)
+		}
+		ur.block = ur.buf
+
+	case dedupEnd:
+		var length [8]byte
+		if _, err := io.ReadFull(ur.r, length[:]); err != nil {
+			return fmt.Errorf("deduplicated stream ended within its data: %w", io.ErrUnexpectedEOF)
+		}
+		if recorded := int64(binary.BigEndian.Uint64(length[:])); recorded != ur.length {
+			return fmt.Errorf("deduplicated stream holds %d bytes of data, but records %d", ur.length, recorded)
+		}
+		ur.done = true
+
+	default:
+		return fmt.Errorf("deduplicated stream has a record of unknown kind %#x", kind)
+	}
+	return nil
+}
+
+// blockBuffer returns ur.buf resized to hold a block of size bytes
+func (ur *undedupReader) blockBuffer(size int) []byte {
+	if cap(ur.buf) < size {
+		ur.buf = make([]byte, dedupMaxBlock)
+	}
+	return ur.buf[:size]
+}
+
+// Close removes the spooled blocks
+func (ur *undedupReader) Close() error {
+	ur.spool.Close()
+	return os.Remove(ur.spool.Name())
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestDedupStream(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	defer SetTempPolicy(GetTempPolicy())
+	tempDir := t.TempDir()
+	SetTempPolicy(TempPolicy{Dir: tempDir})
+
+	dedup := func(data []byte) ([]byte, DedupStats) {
+		var stats DedupStats
+		stream, err := io.ReadAll(DedupStream(ctx, bytes.NewReader(data), &stats))
+		if err != nil {
+			t.Fatalf("DedupStream failed: %v", err)
+		}
+		return stream, stats
+	}
+	undedup := func(stream []byte) ([]byte, error) {
+		r, err := UndedupStream(ctx, bytes.NewReader(stream))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		data := make([]byte, n)
+		rng.Read(data)
+		return data
+	}
+
+	// A file stored twice, the second time with a few bytes inserted near its start, is mostly
+	// stored once
+	file := random(1 << 20)
+	edited := append(append(append([]byte(nil), file[:1000]...), "inserted"...), file[1000:]...)
+	data := append(append(random(5000), file...), edited...)
+	stream, stats := dedup(data)
+	if !IsDedupStream(stream) || stats.Bytes != int64(len(data)) {
+		t.Fatalf("Expected a deduplicated stream of %d bytes of data, got %+v", len(data), stats)
+	}
+	if stats.DuplicateBytes < int64(len(file))*9/10 || len(stream) > len(data)-len(file)*9/10 {
+		t.Errorf("Expected most of the second copy to be stored once: %d of %d bytes in a stream of %d", stats.DuplicateBytes, len(data), len(stream))
+	}
+	if got, err := undedup(stream); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Expected the data to be rebuilt (%v)", err)
+	}
+
+	// Short and empty data round trip too
+	for _, data := range [][]byte{nil, []byte("x"), bytes.Repeat([]byte{'a'}, dedupMaxBlock*3+5)} {
+		stream, _ := dedup(data)
+		if got, err := undedup(stream); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: expected the data to be rebuilt (%v)", len(data), err)
+		}
+	}
+
+	// Streams that aren't deduplicated pass through
+	if got, err := undedup([]byte("plain")); err != nil || string(got) != "plain" {
+		t.Errorf("Expected a plain stream to pass through: %q, %v", got, err)
+	}
+
+	// A stream cut off within its data, or with a reference to a block it doesn't hold, fails
+	if _, err := undedup(stream[:len(stream)-4]); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected ErrUnexpectedEOF for a truncated stream, got %v", err)
+	}
+	bad := append([]byte(dedupMagic), dedupReference, 0, 0, 0, 0, 0, 0, 0, 0)
+	if _, err := undedup(bad); err == nil {
+		t.Errorf("Expected an error for a reference to a missing block")
+	}
+
+	// The spooled blocks are removed once the stream is closed
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+		t.Errorf("Expected the spooled blocks to be removed, found %s", filepath.Join(tempDir, entries[0].Name()))
+	}
+}
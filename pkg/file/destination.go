@@ -0,0 +1,291 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// Destination is a place that encoded collections are delivered to.
+//
+// Collections are always written to a local directory first. Local destinations are
+// that directory; remote destinations stage the collection in a temporary directory
+// and upload it with Publish once encoding has finished successfully.
+type Destination interface {
+	// String returns the destination as given by the user (a path or URL)
+	String() string
+
+	// LocalDir returns the directory that the collection is written to while encoding
+	LocalDir() string
+
+	// Publish delivers the contents of LocalDir to the destination
+	Publish(ctx context.Context) error
+
+	// Cleanup removes any staging directory created for the destination
+	Cleanup() error
+}
+
+// Source is a remote destination that collections can also be read back from. Decode
+// fetches the collections into LocalDir and reads them from there.
+type Source interface {
+	Destination
+
+	// Fetch downloads the contents of the destination into LocalDir
+	Fetch(ctx context.Context) error
+}
+
+// DestinationFactory creates a Destination for a URL with a registered scheme
+type DestinationFactory func(ctx context.Context, u *url.URL) (Destination, error)
+
+var (
+	destinationMutex   sync.RWMutex
+	destinationSchemes = map[string]DestinationFactory{
+		"s3":      newS3Destination,
+		"sftp":    newSFTPDestination,
+		"webdav":  newWebDAVDestination,
+		"webdavs": newWebDAVDestination,
+	}
+)
+
+// RegisterDestinationScheme makes a URL scheme available as an encode destination,
+// replacing any existing factory for the scheme
+func RegisterDestinationScheme(scheme string, factory DestinationFactory) {
+	destinationMutex.Lock()
+	defer destinationMutex.Unlock()
+	destinationSchemes[strings.ToLower(scheme)] = factory
+}
+
+// DestinationSchemes returns the registered remote URL schemes, sorted
+func DestinationSchemes() []string {
+	destinationMutex.RLock()
+	defer destinationMutex.RUnlock()
+
+	schemes := make([]string, 0, len(destinationSchemes))
+	for scheme := range destinationSchemes {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// IsDestinationURL reports whether s is a URL ("scheme://...") rather than a local path
+func IsDestinationURL(s string) bool {
+	i := strings.Index(s, "://")
+	if i <= 1 {
+		// A single letter before ":" is a Windows drive, not a scheme
+		return false
+	}
+	for _, c := range s[:i] {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseDestination resolves a local path, file:// URL, or remote URL to a Destination
+func ParseDestination(ctx context.Context, s string) (Destination, error) {
+	if !IsDestinationURL(s) {
+		return localDestination(s), nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination %s: %w", s, err)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "file" {
+		return localDestination(u.Path), nil
+	}
+
+	destinationMutex.RLock()
+	factory, ok := destinationSchemes[scheme]
+	destinationMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported destination scheme %q in %s (supported: file, %s)",
+			u.Scheme, s, strings.Join(DestinationSchemes(), ", "))
+	}
+	return factory(ctx, u)
+}
+
+// localDestination is a directory on a locally mounted filesystem
+type localDestination string
+
+func (d localDestination) String() string                    { return string(d) }
+func (d localDestination) LocalDir() string                  { return string(d) }
+func (d localDestination) Publish(ctx context.Context) error { return nil }
+func (d localDestination) Cleanup() error                    { return nil }
+
+// StagedDestination stages a collection in a temporary directory and delivers it with an
+// upload function. It is the building block for remote destination schemes.
+type StagedDestination struct {
+	URL      string                                           // Destination URL as given by the user
+	Dir      string                                           // Local staging directory
+	Upload   func(ctx context.Context, localDir string) error // Delivers the staged files
+	Download func(ctx context.Context, localDir string) error // Fetches the remote files, if the scheme can
+}
+
+// NewStagedDestination creates a staging directory for a remote destination
+func NewStagedDestination(rawURL string, upload func(ctx context.Context, localDir string) error) (*StagedDestination, error) {
+	dir, err := MkdirTemp("padlock-staging-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory for %s: %w", rawURL, err)
+	}
+	return &StagedDestination{URL: rawURL, Dir: dir, Upload: upload}, nil
+}
+
+func (d *StagedDestination) String() string   { return d.URL }
+func (d *StagedDestination) LocalDir() string { return d.Dir }
+func (d *StagedDestination) Cleanup() error   { return os.RemoveAll(d.Dir) }
+
+// Publish uploads the staged collection
+func (d *StagedDestination) Publish(ctx context.Context) error {
+	log := trace.FromContext(ctx).WithPrefix("DESTINATION")
+	log.Infof("Uploading %s to %s", d.Dir, d.URL)
+
+	if err := d.Upload(ctx, d.Dir); err != nil {
+		log.Error(fmt.Errorf("failed to upload to %s: %w", d.URL, err))
+		return fmt.Errorf("failed to upload to %s: %w", d.URL, err)
+	}
+
+	log.Debugf("Upload to %s complete", d.URL)
+	return nil
+}
+
+// Fetch downloads the remote collection into the staging directory
+func (d *StagedDestination) Fetch(ctx context.Context) error {
+	log := trace.FromContext(ctx).WithPrefix("DESTINATION")
+	if d.Download == nil {
+		return fmt.Errorf("collections can't be read back from %s; copy them to a local directory first", d.URL)
+	}
+	log.Infof("Downloading %s to %s", d.URL, d.Dir)
+
+	if err := d.Download(ctx, d.Dir); err != nil {
+		log.Error(fmt.Errorf("failed to download from %s: %w", d.URL, err))
+		return fmt.Errorf("failed to download from %s: %w", d.URL, err)
+	}
+
+	log.Debugf("Download from %s complete", d.URL)
+	return nil
+}
+
+// runTool runs an external transfer tool, including its output in any error
+func runTool(ctx context.Context, name string, args ...string) error {
+	log := trace.FromContext(ctx).WithPrefix("DESTINATION")
+	log.Debugf("Running %s %s", name, strings.Join(args, " "))
+
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// requireTool checks that an external transfer tool is installed before any work is done
+func requireTool(scheme, tool string) error {
+	if _, err := exec.LookPath(tool); err != nil {
+		return fmt.Errorf("%s:// destinations require the %q command in PATH: %w", scheme, tool, err)
+	}
+	return nil
+}
+
+// newS3Destination delivers to s3://bucket/prefix using the AWS CLI, which picks up
+// credentials and region from the usual AWS environment and configuration files
+func newS3Destination(ctx context.Context, u *url.URL) (Destination, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("s3 destination %s has no bucket", u)
+	}
+	if err := requireTool("s3", "aws"); err != nil {
+		return nil, err
+	}
+
+	target := "s3://" + u.Host + "/" + strings.Trim(u.Path, "/")
+	dest, err := NewStagedDestination(u.String(), func(ctx context.Context, localDir string) error {
+		return runTool(ctx, "aws", "s3", "cp", "--recursive", "--only-show-errors", localDir, target)
+	})
+	if err != nil {
+		return nil, err
+	}
+	dest.Download = func(ctx context.Context, localDir string) error {
+		return runTool(ctx, "aws", "s3", "cp", "--recursive", "--only-show-errors", target, localDir)
+	}
+	return dest, nil
+}
+
+// newSFTPDestination delivers to sftp://[user@]host[:port]/path using the OpenSSH sftp
+// client in batch mode, so authentication must not require interaction (e.g. ssh-agent)
+func newSFTPDestination(ctx context.Context, u *url.URL) (Destination, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("sftp destination %s has no host", u)
+	}
+	// sftp would take a host or user name starting with "-" as an option, such as -oProxyCommand
+	if strings.HasPrefix(u.Hostname(), "-") || (u.User != nil && strings.HasPrefix(u.User.Username(), "-")) {
+		return nil, fmt.Errorf("sftp destination %s has a host or user name starting with \"-\"", u)
+	}
+	if err := requireTool("sftp", "sftp"); err != nil {
+		return nil, err
+	}
+
+	remoteDir := strings.TrimPrefix(u.Path, "/")
+	if remoteDir == "" {
+		remoteDir = "."
+	}
+	target := u.Hostname()
+	if u.User != nil {
+		target = u.User.Username() + "@" + target
+	}
+	args := []string{"-q", "-b", "-"}
+	if port := u.Port(); port != "" {
+		args = append(args, "-P", port)
+	}
+	args = append(args, target)
+
+	dest, err := NewStagedDestination(u.String(), func(ctx context.Context, localDir string) error {
+		entries, err := os.ReadDir(localDir)
+		if err != nil {
+			return err
+		}
+
+		// "-mkdir" tolerates an existing directory; each staged file is put individually
+		var batch strings.Builder
+		fmt.Fprintf(&batch, "-mkdir %q\ncd %q\n", remoteDir, remoteDir)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				fmt.Fprintf(&batch, "-mkdir %q\nput -r %q %q\n", entry.Name(), filepath.Join(localDir, entry.Name()), entry.Name())
+			} else {
+				fmt.Fprintf(&batch, "put %q %q\n", filepath.Join(localDir, entry.Name()), entry.Name())
+			}
+		}
+
+		return runSFTPBatch(ctx, args, batch.String())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Everything in the remote directory is fetched, recursively
+	dest.Download = func(ctx context.Context, localDir string) error {
+		return runSFTPBatch(ctx, args, fmt.Sprintf("cd %q\nlcd %q\nget -r *\n", remoteDir, localDir))
+	}
+	return dest, nil
+}
+
+// runSFTPBatch runs the sftp client with a batch of commands on its standard input
+func runSFTPBatch(ctx context.Context, args []string, batch string) error {
+	cmd := exec.CommandContext(ctx, "sftp", args...)
+	cmd.Stdin = strings.NewReader(batch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sftp failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestIsDestinationURL(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"/mnt/usb1", false},
+		{"relative/dir", false},
+		{`C:\shares`, false},
+		{"c://shares", false},
+		{"file:///mnt/usb1", true},
+		{"s3://bucket/share2", true},
+		{"sftp://user@host:2222/share3", true},
+		{"my+scheme://x", true},
+		{"not a scheme://x", false},
+	}
+	for _, tt := range tests {
+		if got := IsDestinationURL(tt.input); got != tt.want {
+			t.Errorf("IsDestinationURL(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseDestinationLocal(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	for input, want := range map[string]string{
+		"/mnt/usb1":        "/mnt/usb1",
+		"file:///mnt/usb2": "/mnt/usb2",
+	} {
+		dest, err := ParseDestination(ctx, input)
+		if err != nil {
+			t.Fatalf("ParseDestination(%q) failed: %v", input, err)
+		}
+		if dest.LocalDir() != want {
+			t.Errorf("ParseDestination(%q).LocalDir() = %q, want %q", input, dest.LocalDir(), want)
+		}
+		if err := dest.Publish(ctx); err != nil {
+			t.Errorf("Publish of local destination %q failed: %v", input, err)
+		}
+	}
+
+	_, err := ParseDestination(ctx, "gopher://host/share")
+	if err == nil || !strings.Contains(err.Error(), "unsupported destination scheme") {
+		t.Errorf("Expected unsupported scheme error, got %v", err)
+	}
+
+	// Host and user names that sftp would take as options are refused
+	for _, input := range []string{"sftp://-oProxyCommand=reboot/share", "sftp://-oProxyCommand=x@host/share"} {
+		if _, err := ParseDestination(ctx, input); err == nil || !strings.Contains(err.Error(), `starting with "-"`) {
+			t.Errorf("Expected %s to be refused, got %v", input, err)
+		}
+	}
+}
+
+func TestStagedDestinationPublish(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	var uploaded []string
+	var uploadedHost string
+	RegisterDestinationScheme("memtest", func(ctx context.Context, u *url.URL) (Destination, error) {
+		uploadedHost = u.Host
+		return NewStagedDestination(u.String(), func(ctx context.Context, localDir string) error {
+			entries, err := os.ReadDir(localDir)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				uploaded = append(uploaded, entry.Name())
+			}
+			return nil
+		})
+	})
+	defer func() {
+		destinationMutex.Lock()
+		delete(destinationSchemes, "memtest")
+		destinationMutex.Unlock()
+	}()
+
+	dest, err := ParseDestination(ctx, "memtest://vault/share2")
+	if err != nil {
+		t.Fatalf("ParseDestination failed: %v", err)
+	}
+	if dest.String() != "memtest://vault/share2" || uploadedHost != "vault" {
+		t.Errorf("Unexpected destination %q (host %q)", dest.String(), uploadedHost)
+	}
+
+	if err := os.WriteFile(filepath.Join(dest.LocalDir(), "3B5.tar"), []byte("share"), 0644); err != nil {
+		t.Fatalf("Failed to write staged file: %v", err)
+	}
+	if err := dest.Publish(ctx); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if len(uploaded) != 1 || uploaded[0] != "3B5.tar" {
+		t.Errorf("Expected 3B5.tar to be uploaded, got %v", uploaded)
+	}
+
+	if err := dest.Cleanup(); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if _, err := os.Stat(dest.LocalDir()); !os.IsNotExist(err) {
+		t.Errorf("Expected staging directory %s to be removed", dest.LocalDir())
+	}
+}
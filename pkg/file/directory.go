@@ -36,7 +36,31 @@ func ValidateInputDirectory(ctx context.Context, inputDir string) error {
 	return nil
 }
 
-// PrepareOutputDirectory ensures the output directory exists and is empty if clear is true
+// ValidateInput checks that an encode input exists and is a directory or a regular file
+func ValidateInput(ctx context.Context, input string) error {
+	log := trace.FromContext(ctx).WithPrefix("FILE")
+
+	inputStat, err := os.Stat(input)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("input does not exist: %s", input)
+		} else {
+			err = fmt.Errorf("cannot access input %s: %v", input, err)
+		}
+		log.Error(err)
+		return err
+	}
+	if !inputStat.IsDir() && !inputStat.Mode().IsRegular() {
+		err := fmt.Errorf("input is not a directory or regular file: %s", input)
+		log.Error(err)
+		return err
+	}
+	log.Debugf("Input is valid: %s", input)
+	return nil
+}
+
+// PrepareOutputDirectory ensures the output directory exists and is empty if clear is true.
+// The lock file of the operation preparing it is left in place, and doesn't count as content.
 func PrepareOutputDirectory(ctx context.Context, outputDir string, clear bool) error {
 	log := trace.FromContext(ctx).WithPrefix("FILE")
 
@@ -70,6 +94,9 @@ func PrepareOutputDirectory(ctx context.Context, outputDir string, clear bool) e
 
 		// Remove each entry
 		for _, entry := range entries {
+			if entry.Name() == LockFileName {
+				continue
+			}
 			entryPath := filepath.Join(outputDir, entry.Name())
 			log.Debugf("Removing: %s", entryPath)
 
@@ -87,6 +114,7 @@ func PrepareOutputDirectory(ctx context.Context, outputDir string, clear bool) e
 			log.Error(fmt.Errorf("failed to read output directory: %w", err))
 			return fmt.Errorf("failed to read output directory: %w", err)
 		}
+		entries = withoutLockFile(entries)
 
 		if len(entries) > 0 {
 			var fileList string
@@ -140,3 +168,13 @@ func CreateCollectionDirectory(ctx context.Context, baseDir string, collectionNa
 	log.Debugf("Collection directory created: %s", collPath)
 	return collPath, nil
 }
+
+// withoutLockFile removes the lock file from a directory listing
+func withoutLockFile(entries []os.DirEntry) []os.DirEntry {
+	for i, entry := range entries {
+		if entry.Name() == LockFileName {
+			return append(entries[:i:i], entries[i+1:]...)
+		}
+	}
+	return entries
+}
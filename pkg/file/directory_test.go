@@ -54,6 +54,21 @@ func TestValidateInputDirectory(t *testing.T) {
 	}
 }
 
+// TestValidateInput checks that an encode input may be a directory or a regular file
+func TestValidateInput(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	tempFile := filepath.Join(tempDir, "disk.img")
+	if err := os.WriteFile(tempFile, []byte("test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	for input, valid := range map[string]bool{tempDir: true, tempFile: true, filepath.Join(tempDir, "nonexistent"): false, os.DevNull: false} {
+		if err := ValidateInput(ctx, input); (err == nil) != valid {
+			t.Errorf("ValidateInput(%s) = %v, expected valid %v", input, err, valid)
+		}
+	}
+}
+
 func TestPrepareOutputDirectory(t *testing.T) {
 	ctx := context.Background()
 	tracer := trace.NewTracer("TEST", trace.LogLevelVerbose)
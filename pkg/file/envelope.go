@@ -0,0 +1,226 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/blues/padlock/pkg/trace"
+	"golang.org/x/crypto/scrypt"
+)
+
+// An envelope encrypts the serialized stream with AES-256-GCM before it is split, as a
+// conventional layer of defense in depth under the threshold scheme. The key is derived
+// from a key file's contents with scrypt. The stream is cut into segments that are sealed
+// one at a time, so it never has to be held in memory; each segment's nonce is the
+// envelope's random nonce prefix followed by the segment number and a flag marking the
+// last segment, so segments can't be reordered, dropped, or cut off at the end unnoticed.
+// Everything but the key is recorded in the collection metadata as an Envelope.
+
+// EnvelopeCipher is the only envelope cipher, recorded in Envelope.Cipher
+const EnvelopeCipher = "aes-256-gcm"
+
+// envelopeKDF is the only envelope key derivation function, recorded in Envelope.KDF
+const envelopeKDF = "scrypt"
+
+// maxEnvelopeScryptMemory and maxEnvelopeScryptP bound the scrypt parameters an envelope
+// recorded in metadata can ask for, so that damaged or hostile metadata can't exhaust the
+// memory or time of the machine decrypting it. scrypt uses 128*N*r bytes.
+const (
+	maxEnvelopeScryptMemory = 1 << 30
+	maxEnvelopeScryptP      = 16
+)
+
+// envelopeSegmentSize is the amount of plaintext sealed in each segment
+const envelopeSegmentSize = 64 * 1024
+
+// maxEnvelopeSegmentSize bounds the segment size an envelope recorded in metadata can ask
+// for, since a buffer of that size is allocated to open each segment
+const maxEnvelopeSegmentSize = 4 * 1024 * 1024
+
+// envelopeNoncePrefixSize is the size of the random part of every segment nonce; the
+// remaining 5 of the 12 bytes hold the segment number and the last-segment flag
+const envelopeNoncePrefixSize = 7
+
+// ErrEnvelopeAuth is returned when a segment of an envelope fails authentication, because
+// the key is wrong or the data was modified.
+var ErrEnvelopeAuth = errors.New("envelope authentication failed: the key is wrong or the data was modified")
+
+// Envelope describes how a stream was encrypted, without the key
+type Envelope struct {
+	Cipher      string `json:"cipher"`       // EnvelopeCipher
+	KDF         string `json:"kdf"`          // Key derivation function, "scrypt"
+	Salt        string `json:"salt"`         // Base64 KDF salt
+	N           int    `json:"n"`            // scrypt cost parameter
+	R           int    `json:"r"`            // scrypt block size
+	P           int    `json:"p"`            // scrypt parallelism
+	Nonce       string `json:"nonce"`        // Base64 nonce prefix of every segment
+	SegmentSize int    `json:"segment_size"` // Plaintext bytes sealed in each segment
+}
+
+// NewEnvelope returns the parameters of a new envelope, with a random salt and nonce prefix
+func NewEnvelope() (*Envelope, error) {
+	salt := make([]byte, sealSaltSize)
+	nonce := make([]byte, envelopeNoncePrefixSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return &Envelope{
+		Cipher:      EnvelopeCipher,
+		KDF:         envelopeKDF,
+		Salt:        base64.StdEncoding.EncodeToString(salt),
+		N:           sealScryptN,
+		R:           sealScryptR,
+		P:           sealScryptP,
+		Nonce:       base64.StdEncoding.EncodeToString(nonce),
+		SegmentSize: envelopeSegmentSize,
+	}, nil
+}
+
+// Equal reports whether two envelopes have the same parameters
+func (e *Envelope) Equal(other *Envelope) bool {
+	if e == nil || other == nil {
+		return e == other
+	}
+	return *e == *other
+}
+
+// aead derives the key from key and returns the cipher and nonce prefix of the envelope
+func (e *Envelope) aead(key []byte) (cipher.AEAD, []byte, error) {
+	if e.Cipher != EnvelopeCipher || e.KDF != envelopeKDF {
+		return nil, nil, fmt.Errorf("unsupported envelope %s with %s", e.Cipher, e.KDF)
+	}
+	salt, err := base64.StdEncoding.DecodeString(e.Salt)
+	if err != nil || len(salt) == 0 {
+		return nil, nil, fmt.Errorf("malformed envelope salt")
+	}
+	prefix, err := base64.StdEncoding.DecodeString(e.Nonce)
+	if err != nil || len(prefix) != envelopeNoncePrefixSize {
+		return nil, nil, fmt.Errorf("malformed envelope nonce")
+	}
+	if e.SegmentSize <= 0 || e.SegmentSize > maxEnvelopeSegmentSize {
+		return nil, nil, fmt.Errorf("malformed envelope segment size %d", e.SegmentSize)
+	}
+	if e.N <= 1 || e.R <= 0 || e.P <= 0 || e.P > maxEnvelopeScryptP || e.N > maxEnvelopeScryptMemory/128/e.R {
+		return nil, nil, fmt.Errorf("malformed envelope scrypt parameters N=%d r=%d p=%d", e.N, e.R, e.P)
+	}
+	derived, err := scrypt.Key(key, salt, e.N, e.R, e.P, 32)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive envelope key: %w", err)
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create envelope cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create envelope cipher: %w", err)
+	}
+	return gcm, prefix, nil
+}
+
+// EncryptStream returns a reader that yields r encrypted in the envelope e under key
+func EncryptStream(ctx context.Context, r io.Reader, e *Envelope, key []byte) (io.Reader, error) {
+	log := trace.FromContext(ctx).WithPrefix("envelope")
+
+	gcm, prefix, err := e.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Encrypting the stream with %s in segments of %d bytes", e.Cipher, e.SegmentSize)
+	return &envelopeReader{r: bufio.NewReader(r), gcm: gcm, prefix: prefix, size: e.SegmentSize}, nil
+}
+
+// DecryptStream returns a reader that yields r, encrypted in the envelope e, decrypted under
+// key. Reads fail with ErrEnvelopeAuth at the first segment that fails authentication,
+// including a stream that ends without its last segment.
+func DecryptStream(ctx context.Context, r io.Reader, e *Envelope, key []byte) (io.Reader, error) {
+	log := trace.FromContext(ctx).WithPrefix("envelope")
+
+	gcm, prefix, err := e.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Decrypting the %s envelope of the stream", e.Cipher)
+	return &envelopeReader{r: bufio.NewReader(r), gcm: gcm, prefix: prefix, size: e.SegmentSize + gcm.Overhead(), open: true}, nil
+}
+
+// envelopeReader seals or opens a stream one segment at a time
+type envelopeReader struct {
+	r       *bufio.Reader
+	gcm     cipher.AEAD
+	prefix  []byte
+	size    int  // Size of the segments read from r
+	open    bool // Whether segments are opened rather than sealed
+	segment uint32
+	out     bytes.Buffer
+	done    bool
+}
+
+func (er *envelopeReader) Read(p []byte) (int, error) {
+	for er.out.Len() == 0 {
+		if er.done {
+			return 0, io.EOF
+		}
+		if err := er.next(); err != nil {
+			return 0, err
+		}
+	}
+	return er.out.Read(p)
+}
+
+// next seals or opens the next segment into out. A segment is the last one if the stream
+// ends with it, which is recorded in its nonce.
+func (er *envelopeReader) next() error {
+	buf := make([]byte, er.size)
+	n, err := io.ReadFull(er.r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := n < er.size
+	if !last {
+		if _, err := er.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if er.segment == ^uint32(0) {
+		return fmt.Errorf("envelope stream is too long")
+	}
+
+	nonce := make([]byte, 0, er.gcm.NonceSize())
+	nonce = append(nonce, er.prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, er.segment)
+	if last {
+		nonce = append(nonce, 1)
+	} else {
+		nonce = append(nonce, 0)
+	}
+
+	if er.open {
+		plaintext, err := er.gcm.Open(nil, nonce, buf[:n], nil)
+		if err != nil {
+			return fmt.Errorf("segment %d: %w", er.segment+1, ErrEnvelopeAuth)
+		}
+		er.out.Write(plaintext)
+	} else {
+		er.out.Write(er.gcm.Seal(nil, nonce, buf[:n], nil))
+	}
+	er.segment++
+	er.done = last
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestEnvelope(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	key := []byte("envelope key")
+
+	env, err := NewEnvelope()
+	if err != nil {
+		t.Fatalf("NewEnvelope failed: %v", err)
+	}
+	env.SegmentSize = 100
+	encrypt := func(data []byte) []byte {
+		r, err := EncryptStream(ctx, bytes.NewReader(data), env, key)
+		if err != nil {
+			t.Fatalf("EncryptStream failed: %v", err)
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("Failed to read encrypted stream: %v", err)
+		}
+		return out
+	}
+	decrypt := func(data, key []byte) ([]byte, error) {
+		r, err := DecryptStream(ctx, bytes.NewReader(data), env, key)
+		if err != nil {
+			t.Fatalf("DecryptStream failed: %v", err)
+		}
+		return io.ReadAll(r)
+	}
+
+	// Streams of every length around the segment boundaries come back unchanged
+	for _, size := range []int{0, 1, 99, 100, 101, 200, 1234} {
+		data := bytes.Repeat([]byte{byte(size)}, size)
+		encrypted := encrypt(data)
+		segments := max(1, (size+99)/100)
+		if len(encrypted) != size+16*segments {
+			t.Errorf("size %d: encrypted to %d bytes, expected %d segments", size, len(encrypted), segments)
+		}
+		if got, err := decrypt(encrypted, key); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("size %d: decryption did not reproduce the data (%v)", size, err)
+		}
+	}
+
+	data := bytes.Repeat([]byte("enveloped "), 100)
+	encrypted := encrypt(data)
+	if _, err := decrypt(encrypted, []byte("wrong key")); !errors.Is(err, ErrEnvelopeAuth) {
+		t.Errorf("Expected ErrEnvelopeAuth with the wrong key, got %v", err)
+	}
+	modified := bytes.Clone(encrypted)
+	modified[150] ^= 1
+	if _, err := decrypt(modified, key); !errors.Is(err, ErrEnvelopeAuth) {
+		t.Errorf("Expected ErrEnvelopeAuth for a modified segment, got %v", err)
+	}
+
+	// Dropping whole segments from the end is detected
+	if _, err := decrypt(encrypted[:2*116], key); !errors.Is(err, ErrEnvelopeAuth) {
+		t.Errorf("Expected ErrEnvelopeAuth for a truncated stream, got %v", err)
+	}
+	if _, err := decrypt(nil, key); !errors.Is(err, ErrEnvelopeAuth) {
+		t.Errorf("Expected ErrEnvelopeAuth for an empty stream, got %v", err)
+	}
+
+	// Metadata that asks for more memory or time than allowed is refused before deriving anything
+	for _, params := range [][3]int{{1 << 21, 8, 1}, {1 << 15, 512, 1}, {1 << 15, 8, 17}, {0, 8, 1}} {
+		hostile := *env
+		hostile.N, hostile.R, hostile.P = params[0], params[1], params[2]
+		if _, err := DecryptStream(ctx, bytes.NewReader(encrypted), &hostile, key); err == nil || !strings.Contains(err.Error(), "scrypt") {
+			t.Errorf("Expected scrypt parameters %v to be refused, got %v", params, err)
+		}
+	}
+
+	// So is a segment size that would need an oversized buffer
+	for _, size := range []int{0, -1, maxEnvelopeSegmentSize + 1, 1 << 40} {
+		hostile := *env
+		hostile.SegmentSize = size
+		if _, err := DecryptStream(ctx, bytes.NewReader(encrypted), &hostile, key); err == nil || !strings.Contains(err.Error(), "segment size") {
+			t.Errorf("Expected segment size %d to be refused, got %v", size, err)
+		}
+	}
+
+	other, _ := NewEnvelope()
+	if env.Equal(other) || !env.Equal(env) || (*Envelope)(nil).Equal(env) {
+		t.Errorf("Unexpected envelope equality")
+	}
+}
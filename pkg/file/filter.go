@@ -0,0 +1,278 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Filter selects the entries of an input directory that are serialized, with patterns written
+// as in a .gitignore file:
+//
+//   - A pattern without a slash, such as node_modules or *.tmp, matches a name at any depth.
+//   - A pattern with a slash, such as /build or docs/*.pdf, matches a path from the top of the
+//     input directory; a leading slash only anchors it.
+//   - A trailing slash, as in cache/, matches only directories.
+//   - * and ? match within one name, [...] matches a class of characters, and ** matches any
+//     number of directories, as in **/testdata or logs/**/*.gz.
+//   - A leading ! re-includes what an earlier exclude pattern excluded. The last pattern that
+//     matches an entry decides, but nothing in an excluded directory is re-included, since the
+//     directory isn't read.
+//
+// A directory that is excluded is skipped with everything in it. If include patterns are given,
+// only the files they match, and the files in the directories they match, are serialized, with
+// the directories that lead to them.
+type Filter struct {
+	exclude []filterRule
+	include []filterRule
+}
+
+// filterRule is one parsed pattern
+type filterRule struct {
+	segments []string // The pattern split at slashes
+	anchored bool     // Whether the pattern matches a path from the top rather than a name at any depth
+	dirOnly  bool     // Whether the pattern only matches directories
+	negate   bool     // Whether a match re-includes the entry
+}
+
+// NewFilter returns a filter that excludes the entries matching exclude, and if include is not
+// empty, everything that doesn't match include
+func NewFilter(exclude, include []string) (*Filter, error) {
+	f := &Filter{}
+	for _, pattern := range exclude {
+		if err := f.addExclude(pattern); err != nil {
+			return nil, err
+		}
+	}
+	for _, pattern := range include {
+		rule, err := parseFilterRule(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if rule.negate {
+			return nil, fmt.Errorf("invalid include pattern %q: ! can only be used in exclude patterns", pattern)
+		}
+		f.include = append(f.include, rule)
+	}
+	return f, nil
+}
+
+// AddIgnoreFile adds the exclude patterns in a .gitignore-style file: one pattern per line,
+// skipping blank lines and lines starting with #. A pattern starting with \ has it removed, so
+// that \#name and \!name match names starting with # and !.
+func (f *Filter) AddIgnoreFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read ignore file: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimRight(scanner.Text(), " \t\r")
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if err := f.addExclude(pattern); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// addExclude adds an exclude pattern, or with a leading !, a pattern that re-includes
+func (f *Filter) addExclude(pattern string) error {
+	rule, err := parseFilterRule(pattern)
+	if err != nil {
+		return err
+	}
+	f.exclude = append(f.exclude, rule)
+	return nil
+}
+
+// parseFilterRule parses a .gitignore-style pattern
+func parseFilterRule(pattern string) (filterRule, error) {
+	var rule filterRule
+	p := pattern
+	if strings.HasPrefix(p, "!") {
+		rule.negate = true
+		p = p[1:]
+	} else if strings.HasPrefix(p, `\`) {
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		rule.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	if strings.Contains(p, "/") {
+		rule.anchored = true
+		p = strings.TrimPrefix(p, "/")
+	}
+	if p == "" {
+		return filterRule{}, fmt.Errorf("invalid pattern %q: it matches nothing", pattern)
+	}
+	rule.segments = strings.Split(p, "/")
+	for _, segment := range rule.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return filterRule{}, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return rule, nil
+}
+
+// matches reports whether the rule matches the entry at rel, a slash-separated path relative
+// to the top of the input directory
+func (r filterRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if !r.anchored {
+		ok, _ := path.Match(r.segments[0], path.Base(rel))
+		return ok
+	}
+	return matchSegments(r.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches a pattern split at slashes against a path split at slashes, where a
+// ** segment matches any number of names
+func matchSegments(pattern, names []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(names); skip++ {
+				if matchSegments(pattern[1:], names[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], names[0]); !ok {
+			return false
+		}
+		pattern, names = pattern[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+// Excludes reports whether the entry at rel, a path relative to the top of the input
+// directory, is excluded by the exclude patterns. A nil filter excludes nothing.
+func (f *Filter) Excludes(rel string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	excluded := false
+	for _, rule := range f.exclude {
+		if rule.matches(rel, isDir) {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+// Includes reports whether the entry at rel matches an include pattern, or is in a directory
+// that does. Everything is included if there are no include patterns.
+func (f *Filter) Includes(rel string, isDir bool) bool {
+	if f == nil || len(f.include) == 0 {
+		return true
+	}
+	rel = filepath.ToSlash(rel)
+	for _, rule := range f.include {
+		if rule.matches(rel, isDir) {
+			return true
+		}
+		// Any directory the entry is in
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if rule.matches(dir, true) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Selects reports whether a decode restores the entry at rel: whether it is included, and
+// neither it nor any directory it is in is excluded. Unlike when serializing, where an
+// excluded directory isn't read, the directories an entry is in are checked along with it. A
+// nil filter selects everything.
+func (f *Filter) Selects(rel string, isDir bool) bool {
+	if f == nil {
+		return true
+	}
+	if f.Excludes(rel, isDir) || !f.Includes(rel, isDir) {
+		return false
+	}
+	for dir := path.Dir(filepath.ToSlash(rel)); dir != "."; dir = path.Dir(dir) {
+		if f.Excludes(dir, true) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasIncludes reports whether the filter only serializes what its include patterns match
+func (f *Filter) hasIncludes() bool {
+	return f != nil && len(f.include) > 0
+}
+
+// walkInput calls fn for each entry of inputDir that filter selects, in the order filepath.Walk
+// visits them, skipping symbolic links and excluded directories with their contents. With
+// include patterns, a directory is passed to fn just before the first entry selected in it,
+// so that directories holding nothing that is selected are left out.
+func walkInput(inputDir string, filter *Filter, fn func(path, rel string, info os.FileInfo) error) error {
+	visited := make(map[string]bool) // Directories passed to fn, with include patterns
+	var visitParents func(rel string) error
+	visitParents = func(rel string) error {
+		dir := filepath.Dir(rel)
+		if dir == "." || visited[dir] {
+			return nil
+		}
+		if err := visitParents(dir); err != nil {
+			return err
+		}
+		info, err := os.Lstat(filepath.Join(inputDir, dir))
+		if err != nil {
+			return err
+		}
+		visited[dir] = true
+		return fn(filepath.Join(inputDir, dir), dir, info)
+	}
+
+	return filepath.Walk(inputDir, func(path string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if path == inputDir || info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(inputDir, path)
+		if err != nil {
+			return fmt.Errorf("failed to determine relative path: %w", err)
+		}
+		if filter.Excludes(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !filter.hasIncludes() {
+			return fn(path, rel, info)
+		}
+		if !filter.Includes(rel, info.IsDir()) || visited[rel] {
+			return nil
+		}
+		if err := visitParents(rel); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			visited[rel] = true
+		}
+		return fn(path, rel, info)
+	})
+}
@@ -0,0 +1,221 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestFilterPatterns checks how .gitignore-style patterns match entries
+func TestFilterPatterns(t *testing.T) {
+	filter, err := NewFilter([]string{"*.tmp", "node_modules/", "/build", "docs/**/*.pdf", "logs/*", "!logs/keep.log"}, nil)
+	if err != nil {
+		t.Fatalf("NewFilter failed: %v", err)
+	}
+	tests := []struct {
+		rel      string
+		isDir    bool
+		excluded bool
+	}{
+		{"a.tmp", false, true},
+		{"src/deep/b.tmp", false, true},
+		{"a.tmpl", false, false},
+		{"node_modules", true, true},
+		{"web/node_modules", true, true},
+		{"node_modules", false, false}, // Only directories
+		{"build", true, true},
+		{"src/build", true, false}, // Anchored to the top
+		{"docs/a.pdf", false, true},
+		{"docs/x/y/a.pdf", false, true},
+		{"docs/a.txt", false, false},
+		{"logs/today.log", false, true},
+		{"logs/keep.log", false, false}, // Re-included by the last pattern that matches
+	}
+	for _, tt := range tests {
+		if got := filter.Excludes(tt.rel, tt.isDir); got != tt.excluded {
+			t.Errorf("Excludes(%q, %v) = %v, expected %v", tt.rel, tt.isDir, got, tt.excluded)
+		}
+	}
+
+	include, err := NewFilter(nil, []string{"*.go", "/docs/"})
+	if err != nil {
+		t.Fatalf("NewFilter failed: %v", err)
+	}
+	for rel, included := range map[string]bool{"main.go": true, "pkg/a.go": true, "docs/x/guide.md": true, "README.md": false} {
+		if got := include.Includes(rel, false); got != included {
+			t.Errorf("Includes(%q) = %v, expected %v", rel, got, included)
+		}
+	}
+
+	var none *Filter
+	if none.Excludes("a", false) || !none.Includes("a", false) {
+		t.Errorf("Expected a nil filter to select everything")
+	}
+	for _, bad := range []string{"[", "/", "a/[b"} {
+		if _, err := NewFilter([]string{bad}, nil); err == nil {
+			t.Errorf("Expected pattern %q to be rejected", bad)
+		}
+	}
+	if _, err := NewFilter(nil, []string{"!a"}); err == nil {
+		t.Errorf("Expected a negated include pattern to be rejected")
+	}
+}
+
+// TestFilterIgnoreFile checks that an ignore file's comments and blank lines are skipped, that
+// escaped patterns are read literally, and that a bad pattern is reported with its line
+func TestFilterIgnoreFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".padlockignore")
+	content := "# Build output\n\n/build/\n*.log\n!important.log\n\\#notes\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write ignore file: %v", err)
+	}
+	filter, err := NewFilter(nil, nil)
+	if err != nil {
+		t.Fatalf("NewFilter failed: %v", err)
+	}
+	if err := filter.AddIgnoreFile(path); err != nil {
+		t.Fatalf("AddIgnoreFile failed: %v", err)
+	}
+	for rel, excluded := range map[string]bool{"build": true, "debug.log": true, "important.log": false, "#notes": true, "notes": false} {
+		if got := filter.Excludes(rel, rel == "build"); got != excluded {
+			t.Errorf("Excludes(%q) = %v, expected %v", rel, got, excluded)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("ok\n[bad\n"), 0644); err != nil {
+		t.Fatalf("Failed to write ignore file: %v", err)
+	}
+	if err := filter.AddIgnoreFile(path); err == nil || !strings.HasPrefix(err.Error(), path+":2:") {
+		t.Errorf("Expected the bad pattern to be reported on line 2, got %v", err)
+	}
+}
+
+// TestSerializeDirectoryWithFilter checks that excluded entries are left out of the stream,
+// and that with include patterns only the directories leading to what is included are written
+func TestSerializeDirectoryWithFilter(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	inputDir := t.TempDir()
+	for _, name := range []string{"main.go", "notes.tmp", ".DS_Store", "node_modules/lib/index.js", "pkg/a.go", "pkg/a.tmp", "assets/logo.png"} {
+		path := filepath.Join(inputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	serialized := func(filter *Filter) []string {
+		stream, err := SerializeDirectoryWithFilter(ctx, inputDir, filter)
+		if err != nil {
+			t.Fatalf("SerializeDirectoryWithFilter failed: %v", err)
+		}
+		defer stream.Close()
+		var names []string
+		tr := tar.NewReader(stream)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Failed to read stream: %v", err)
+			}
+			if hdr.Name != HashManifestName {
+				names = append(names, hdr.Name)
+			}
+		}
+		size, err := EstimateSerializedSizeWithFilter(ctx, inputDir, filter)
+		if err != nil || size <= 0 {
+			t.Errorf("Expected the filtered size to be estimated, got %d (%v)", size, err)
+		}
+		return names
+	}
+
+	exclude, err := NewFilter([]string{"node_modules/", ".DS_Store", "*.tmp"}, nil)
+	if err != nil {
+		t.Fatalf("NewFilter failed: %v", err)
+	}
+	names := serialized(exclude)
+	for _, name := range names {
+		if slices.Contains([]string{"node_modules", "node_modules/lib/index.js", ".DS_Store", "notes.tmp", "pkg/a.tmp"}, name) {
+			t.Errorf("Expected %s to be excluded", name)
+		}
+	}
+	for _, name := range []string{"main.go", "pkg", "pkg/a.go", "assets/logo.png"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("Expected %s to be serialized, got %v", name, names)
+		}
+	}
+
+	include, err := NewFilter([]string{"main.go"}, []string{"*.go"})
+	if err != nil {
+		t.Fatalf("NewFilter failed: %v", err)
+	}
+	names = serialized(include)
+	if !slices.Equal(names, []string{"pkg", "pkg/a.go"}) {
+		t.Errorf("Expected only pkg and pkg/a.go, got %v", names)
+	}
+}
+
+// TestDeserializeDirectoryWithFilter checks that a decode with a filter restores only what it
+// selects, including nothing in an excluded directory, and checks just those files against
+// the hash manifest
+func TestDeserializeDirectoryWithFilter(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	for _, name := range []string{"main.go", "docs/guide.md", "docs/old/notes.md", "pkg/a.go"} {
+		path := filepath.Join(inputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	filter, err := NewFilter([]string{"old/"}, []string{"*.md"})
+	if err != nil {
+		t.Fatalf("NewFilter failed: %v", err)
+	}
+	stream, err := SerializeDirectoryToStream(ctx, inputDir)
+	if err != nil {
+		t.Fatalf("SerializeDirectoryToStream failed: %v", err)
+	}
+	defer stream.Close()
+	outputDir := filepath.Join(tempDir, "output")
+	if err := DeserializeDirectoryWithFilter(ctx, outputDir, stream, false, nil, filter); err != nil {
+		t.Fatalf("DeserializeDirectoryWithFilter failed: %v", err)
+	}
+	for name, want := range map[string]bool{"docs/guide.md": true, "docs/old/notes.md": false, "main.go": false, "pkg/a.go": false} {
+		_, err := os.Stat(filepath.Join(outputDir, filepath.FromSlash(name)))
+		if got := err == nil; got != want {
+			t.Errorf("Expected %s restored to be %v, got %v", name, want, got)
+		}
+	}
+
+	// A filter that selects nothing fails rather than restoring an empty directory
+	none, err := NewFilter(nil, []string{"*.pdf"})
+	if err != nil {
+		t.Fatalf("NewFilter failed: %v", err)
+	}
+	stream, err = SerializeDirectoryToStream(ctx, inputDir)
+	if err != nil {
+		t.Fatalf("SerializeDirectoryToStream failed: %v", err)
+	}
+	defer stream.Close()
+	if err := DeserializeDirectoryWithFilter(ctx, filepath.Join(tempDir, "none"), stream, false, nil, none); err == nil {
+		t.Errorf("Expected a filter that selects nothing to fail")
+	}
+}
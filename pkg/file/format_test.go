@@ -200,3 +200,43 @@ func writeMinimalPNG(w io.Writer, img image.Image) error {
 func createSmallPNG() image.Image {
 	return image.NewRGBA(image.Rect(0, 0, 1, 1))
 }
+
+func TestFindPNGPayload(t *testing.T) {
+	testData := []byte("test data for PNG inspection")
+	var buf bytes.Buffer
+	if err := encodePNGWithData(&buf, createSmallPNG(), testData); err != nil {
+		t.Fatalf("Failed to encode PNG with data: %v", err)
+	}
+	all := buf.Bytes()
+
+	payload, err := FindPNGPayload(all)
+	if err != nil {
+		t.Fatalf("Failed to find payload: %v", err)
+	}
+	if !bytes.Equal(payload.Data, testData) || !payload.CRCValid() {
+		t.Errorf("Unexpected payload %q, CRC valid %v", payload.Data, payload.CRCValid())
+	}
+
+	// A damaged payload is still returned, with a CRC mismatch
+	damaged := bytes.Clone(all)
+	damaged[bytes.Index(damaged, testData)] ^= 0xff
+	payload, err = FindPNGPayload(damaged)
+	if err != nil {
+		t.Fatalf("Failed to find damaged payload: %v", err)
+	}
+	if payload.CRCValid() || len(payload.Data) != len(testData) {
+		t.Errorf("Expected a CRC mismatch for the damaged payload")
+	}
+
+	// A truncated file and a PNG without a payload are errors
+	if _, err := FindPNGPayload(all[:len(all)-20]); err == nil {
+		t.Errorf("Expected an error for a truncated PNG")
+	}
+	var plain bytes.Buffer
+	if err := writeMinimalPNG(&plain, createSmallPNG()); err != nil {
+		t.Fatalf("Failed to write minimal PNG: %v", err)
+	}
+	if _, err := FindPNGPayload(plain.Bytes()); err == nil {
+		t.Errorf("Expected an error for a PNG without a rAWd chunk")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// FrameMagic starts every framed chunk record.
+//
+// A framed stream is a sequence of self-contained records, one per encoded chunk:
+//
+//	magic       4 bytes  "PLKF"
+//	name length 1 byte   length of the collection name
+//	name        n bytes  collection name (e.g. "3A5")
+//	chunk       4 bytes  chunk number, big-endian, starting at 1
+//	length      4 bytes  payload length, big-endian
+//	payload     length bytes, the raw chunk exactly as produced by the pad encoder
+//
+// Records are emitted in encode order. A transport may split the stream into records and
+// store each one anywhere, as long as the records of each collection are fed back to a
+// decoder in chunk order.
+const FrameMagic = "PLKF"
+
+// MaxFramePayload bounds the payload length accepted when reading a frame, so a corrupt
+// length field cannot cause an enormous allocation.
+const MaxFramePayload = 1 << 30
+
+// Frame is one encoded chunk of one collection.
+type Frame struct {
+	Collection string // Collection the chunk belongs to
+	Chunk      int    // Chunk number within the collection, starting at 1
+	Data       []byte // Raw chunk payload
+}
+
+// WriteFrame writes a single framed record to w
+func WriteFrame(w io.Writer, f Frame) error {
+	if len(f.Collection) == 0 || len(f.Collection) > 255 {
+		return fmt.Errorf("invalid frame collection name %q", f.Collection)
+	}
+	if f.Chunk < 1 || len(f.Data) > MaxFramePayload {
+		return fmt.Errorf("invalid frame for collection %s chunk %d (%d bytes)", f.Collection, f.Chunk, len(f.Data))
+	}
+
+	header := make([]byte, 0, len(FrameMagic)+1+len(f.Collection)+8)
+	header = append(header, FrameMagic...)
+	header = append(header, byte(len(f.Collection)))
+	header = append(header, f.Collection...)
+	header = binary.BigEndian.AppendUint32(header, uint32(f.Chunk))
+	header = binary.BigEndian.AppendUint32(header, uint32(len(f.Data)))
+
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("failed to write frame header: %w", err)
+	}
+	if _, err := w.Write(f.Data); err != nil {
+		return fmt.Errorf("failed to write frame payload: %w", err)
+	}
+	return nil
+}
+
+// ReadFrame reads a single framed record from r. It returns io.EOF if the stream ends
+// cleanly before a new record, and io.ErrUnexpectedEOF if it ends inside one.
+func ReadFrame(r io.Reader) (Frame, error) {
+	var f Frame
+
+	prefix := make([]byte, len(FrameMagic)+1)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return f, err
+	}
+	if string(prefix[:len(FrameMagic)]) != FrameMagic {
+		return f, fmt.Errorf("invalid frame: bad magic %q", prefix[:len(FrameMagic)])
+	}
+
+	rest := make([]byte, int(prefix[len(FrameMagic)])+8)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return f, noEOF(err)
+	}
+	nameLen := len(rest) - 8
+	f.Collection = string(rest[:nameLen])
+	f.Chunk = int(binary.BigEndian.Uint32(rest[nameLen:]))
+	length := binary.BigEndian.Uint32(rest[nameLen+4:])
+	if length > MaxFramePayload {
+		return f, fmt.Errorf("invalid frame: payload of %d bytes for collection %s chunk %d", length, f.Collection, f.Chunk)
+	}
+
+	f.Data = make([]byte, length)
+	if _, err := io.ReadFull(r, f.Data); err != nil {
+		return f, noEOF(err)
+	}
+	return f, nil
+}
+
+// noEOF converts a clean EOF in the middle of a record into io.ErrUnexpectedEOF
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// FrameWriter writes chunks as framed records to a shared output stream. It is safe for
+// use by concurrent chunk writers.
+type FrameWriter struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// NewFrameWriter creates a FrameWriter that writes records to w
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{w: bufio.NewWriter(w)}
+}
+
+// ChunkWriter returns a writer for one chunk. The chunk is emitted as a single record
+// when the writer is closed.
+func (fw *FrameWriter) ChunkWriter(collection string, chunkNumber int) io.WriteCloser {
+	return &frameChunkWriter{fw: fw, frame: Frame{Collection: collection, Chunk: chunkNumber}}
+}
+
+// Flush writes any buffered records to the underlying stream
+func (fw *FrameWriter) Flush() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.w.Flush()
+}
+
+func (fw *FrameWriter) writeFrame(f Frame) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return WriteFrame(fw.w, f)
+}
+
+// frameChunkWriter buffers one chunk until it is closed
+type frameChunkWriter struct {
+	fw    *FrameWriter
+	frame Frame
+}
+
+func (cw *frameChunkWriter) Write(p []byte) (int, error) {
+	cw.frame.Data = append(cw.frame.Data, p...)
+	return len(p), nil
+}
+
+func (cw *frameChunkWriter) Close() error {
+	return cw.fw.writeFrame(cw.frame)
+}
@@ -0,0 +1,72 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	fw := NewFrameWriter(&buf)
+
+	frames := []Frame{
+		{Collection: "2A3", Chunk: 1, Data: []byte("first chunk")},
+		{Collection: "2B3", Chunk: 1, Data: []byte{}},
+		{Collection: "2A3", Chunk: 2, Data: bytes.Repeat([]byte{0xAB}, 5000)},
+	}
+	for _, f := range frames {
+		cw := fw.ChunkWriter(f.Collection, f.Chunk)
+		if _, err := cw.Write(f.Data); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := cw.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+	if err := fw.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	for i, want := range frames {
+		got, err := ReadFrame(&buf)
+		if err != nil {
+			t.Fatalf("ReadFrame %d failed: %v", i, err)
+		}
+		if got.Collection != want.Collection || got.Chunk != want.Chunk || !bytes.Equal(got.Data, want.Data) {
+			t.Errorf("Frame %d: got %s/%d (%d bytes), want %s/%d (%d bytes)", i,
+				got.Collection, got.Chunk, len(got.Data), want.Collection, want.Chunk, len(want.Data))
+		}
+	}
+	if _, err := ReadFrame(&buf); err != io.EOF {
+		t.Errorf("Expected io.EOF at end of stream, got %v", err)
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, Frame{Collection: "3A5", Chunk: 7, Data: []byte("payload")}); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+	record := buf.Bytes()
+
+	// A record cut short is an unexpected EOF, not a clean end of stream
+	if _, err := ReadFrame(bytes.NewReader(record[:len(record)-2])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF for truncated record, got %v", err)
+	}
+
+	bad := append([]byte("XXXX"), record[4:]...)
+	if _, err := ReadFrame(bytes.NewReader(bad)); err == nil {
+		t.Errorf("Expected error for bad magic")
+	}
+
+	if err := WriteFrame(&buf, Frame{Collection: "", Chunk: 1}); err == nil {
+		t.Errorf("Expected error for empty collection name")
+	}
+	if err := WriteFrame(&buf, Frame{Collection: "3A5", Chunk: 0}); err == nil {
+		t.Errorf("Expected error for chunk number 0")
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// HashManifestName is the name of the entry at the end of a serialized stream that lists the
+// SHA-256 of every file in it. Decode doesn't restore it, but checks each restored file
+// against it, so that reconstruction is known to be exact end to end.
+const HashManifestName = ".padlock-hashes.json"
+
+// hashManifestVersion is the version of the hash manifest format written by serialization
+const hashManifestVersion = 1
+
+// hashManifestPAXKey marks the hash manifest's tar entry, so that an input file that happens
+// to have the same name is still restored like any other
+const hashManifestPAXKey = "PADLOCK.hashes"
+
+// HashedFile is a file listed in a hash manifest
+type HashedFile struct {
+	Name   string `json:"name"`   // Path relative to the input directory, as in the serialized stream
+	Size   int64  `json:"size"`   // Size of the file
+	SHA256 string `json:"sha256"` // Hex-encoded SHA-256 of the file's contents
+}
+
+// HashManifest lists the files of a serialized stream with their SHA-256 hashes
+type HashManifest struct {
+	Version int          `json:"version"`
+	Files   []HashedFile `json:"files"`
+}
+
+// isHashManifest reports whether a tar entry of a serialized stream is its hash manifest
+func isHashManifest(header *tar.Header) bool {
+	return header.Typeflag == tar.TypeReg && header.Name == HashManifestName && header.PAXRecords[hashManifestPAXKey] != ""
+}
+
+// parseHashManifest reads a hash manifest entry
+func parseHashManifest(data []byte) (*HashManifest, error) {
+	var m HashManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid hash manifest: %w", err)
+	}
+	if m.Version != hashManifestVersion {
+		return nil, fmt.Errorf("unsupported hash manifest version %d", m.Version)
+	}
+	return &m, nil
+}
+
+// Verify compares the files restored from a stream, with the hashes computed as they were
+// written, against the manifest. It returns a description of each file that is missing,
+// doesn't match, or isn't listed, in name order.
+func (m *HashManifest) Verify(restored map[string]HashedFile) []string {
+	var mismatches []string
+	listed := make(map[string]bool, len(m.Files))
+	for _, expected := range m.Files {
+		listed[expected.Name] = true
+		actual, ok := restored[expected.Name]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, fmt.Sprintf("%s: missing from the decoded stream", expected.Name))
+		case actual.Size != expected.Size:
+			mismatches = append(mismatches, fmt.Sprintf("%s: restored %d bytes, expected %d", expected.Name, actual.Size, expected.Size))
+		case actual.SHA256 != expected.SHA256:
+			mismatches = append(mismatches, fmt.Sprintf("%s: SHA-256 %s, expected %s", expected.Name, actual.SHA256, expected.SHA256))
+		}
+	}
+	for name := range restored {
+		if !listed[name] {
+			mismatches = append(mismatches, fmt.Sprintf("%s: not listed in the manifest", name))
+		}
+	}
+	sort.Strings(mismatches)
+	return mismatches
+}
+
+// Select returns a manifest of just the files filter selects, to check a decode that restored
+// only those against. A nil filter selects every file.
+func (m *HashManifest) Select(filter *Filter) *HashManifest {
+	selected := &HashManifest{Version: m.Version}
+	for _, f := range m.Files {
+		if filter.Selects(f.Name, false) {
+			selected.Files = append(selected.Files, f)
+		}
+	}
+	return selected
+}
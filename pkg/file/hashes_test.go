@@ -0,0 +1,112 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestHashManifestRoundTrip serializes a directory, checks that decode verifies the restored
+// files against the stream's hash manifest, and that a damaged stream is reported
+func TestHashManifestRoundTrip(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	inputDir := filepath.Join(t.TempDir(), "input")
+	files := map[string]string{
+		"a.txt":          "alpha",
+		"sub/b.txt":      "bravo",
+		HashManifestName: "an input file that happens to share the manifest's name",
+	}
+	for name, content := range files {
+		path := filepath.Join(inputDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	r, err := SerializeDirectoryToStream(ctx, inputDir)
+	if err != nil {
+		t.Fatalf("SerializeDirectoryToStream failed: %v", err)
+	}
+	stream, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+	if estimate, err := EstimateSerializedSize(ctx, inputDir); err != nil || estimate < int64(len(stream)) {
+		t.Errorf("Estimate %d is below the stream's %d bytes: %v", estimate, len(stream), err)
+	}
+
+	// The manifest has a fixed modification time, so that the same input always gives the
+	// same stream, which resuming an encode relies on
+	tr := tar.NewReader(bytes.NewReader(stream))
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			t.Fatalf("The stream has no hash manifest: %v", err)
+		}
+		if isHashManifest(header) {
+			if header.ModTime.Unix() != 0 {
+				t.Errorf("Expected the hash manifest to have a fixed modification time, got %v", header.ModTime)
+			}
+			break
+		}
+	}
+
+	outputDir := filepath.Join(t.TempDir(), "output")
+	if err := DeserializeDirectoryFromStream(ctx, outputDir, bytes.NewReader(stream), false); err != nil {
+		t.Fatalf("DeserializeDirectoryFromStream failed: %v", err)
+	}
+	for name, content := range files {
+		if got, err := os.ReadFile(filepath.Join(outputDir, name)); err != nil || string(got) != content {
+			t.Errorf("%s: restored %q, %v", name, got, err)
+		}
+	}
+
+	// Changing a file's contents in the stream is caught
+	i := bytes.Index(stream, []byte("bravo"))
+	damaged := bytes.Clone(stream)
+	damaged[i] = 'B'
+	err = DeserializeDirectoryFromStream(ctx, filepath.Join(t.TempDir(), "damaged"), bytes.NewReader(damaged), false)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+// TestHashManifestVerify checks the mismatches reported against a hash manifest
+func TestHashManifestVerify(t *testing.T) {
+	m, err := parseHashManifest([]byte(`{"version":1,"files":[` +
+		`{"name":"a","size":1,"sha256":"aa"},{"name":"b","size":2,"sha256":"bb"},{"name":"c","size":3,"sha256":"cc"}]}`))
+	if err != nil {
+		t.Fatalf("parseHashManifest failed: %v", err)
+	}
+	mismatches := m.Verify(map[string]HashedFile{
+		"a": {Name: "a", Size: 1, SHA256: "aa"},
+		"b": {Name: "b", Size: 2, SHA256: "b0"},
+		"d": {Name: "d", Size: 4, SHA256: "dd"},
+	})
+	expected := []string{"b: SHA-256", "c: missing", "d: not listed"}
+	if len(mismatches) != len(expected) {
+		t.Fatalf("Expected %d mismatches, got %v", len(expected), mismatches)
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(mismatches[i], prefix) {
+			t.Errorf("Mismatch %d: expected %q..., got %q", i, prefix, mismatches[i])
+		}
+	}
+
+	if _, err := parseHashManifest([]byte(`{"version":9}`)); err == nil {
+		t.Errorf("Expected an unsupported version to be rejected")
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// A hidden volume is a second payload carried in the random padding of a padded stream, so
+// that the same collections decode to the outer data, and to the hidden data only given a
+// secret. Nothing but the secret distinguishes it from padding: the padding starts with a
+// random salt, followed by the hidden data framed like a padded stream (see paddingMagic)
+// and XORed with a ChaCha20 keystream keyed from the secret and salt with Argon2id. The
+// Argon2id parameters are always DefaultPassphraseParams, since recording them would give
+// the volume away. Someone made to reveal K collections can reveal them without the secret,
+// and they decode to the outer data; whether there is anything else in the padding can't
+// be told, since a wrong secret and no hidden volume look the same.
+//
+// Hidden volume layout, within the padding:
+//
+//	salt     16 bytes  Random
+//	records            The hidden data framed as a padded stream, from its magic to its
+//	                   length, masked with the keystream
+//	padding            Random bytes up to the end of the stream
+
+// ErrNoHiddenVolume is returned when no hidden volume opens with the secret, either because
+// there is none or because the secret is wrong; the two can't be told apart by design.
+var ErrNoHiddenVolume = errors.New("no hidden volume opens with this secret")
+
+// HiddenVolume holds a hidden payload, already masked, until it is written into the padding
+// of a padded stream. It is spooled to a temporary file once it outgrows memory, since its
+// size must be known before the padding can be sized.
+type HiddenVolume struct {
+	spool *entrySpool
+}
+
+// NewHiddenVolume reads r to its end and masks it as a hidden volume under secret. The
+// temporary file it may create is removed by Close.
+func NewHiddenVolume(ctx context.Context, r io.Reader, secret []byte) (*HiddenVolume, error) {
+	log := trace.FromContext(ctx).WithPrefix("hidden")
+
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("the hidden volume secret is empty")
+	}
+	salt := make([]byte, passphraseSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key, _ := passphraseKeys(secret, salt, DefaultPassphraseParams)
+	framed := PadStream(ctx, r, func(size int64) (int64, error) { return size, nil })
+	masked, err := newKeystreamReader(framed, key)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &HiddenVolume{spool: &entrySpool{}}
+	h.spool.Write(salt)
+	if _, err := io.Copy(h.spool, masked); err != nil {
+		h.Close()
+		return nil, fmt.Errorf("failed to prepare hidden volume: %w", err)
+	}
+	log.Debugf("Prepared a hidden volume of %d bytes", h.Size())
+	return h, nil
+}
+
+// Size returns the number of bytes of padding the hidden volume takes
+func (h *HiddenVolume) Size() int64 {
+	return h.spool.Size()
+}
+
+// Close discards the hidden volume
+func (h *HiddenVolume) Close() error {
+	return h.spool.Close()
+}
+
+// RevealHidden returns a reader that yields the hidden volume in the padding of the padded
+// stream r, skipping the data before it. It fails with ErrNoHiddenVolume if the stream isn't
+// padded, or no hidden volume in its padding opens with secret.
+func RevealHidden(ctx context.Context, r io.Reader, secret []byte) (io.Reader, error) {
+	log := trace.FromContext(ctx).WithPrefix("hidden")
+
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(paddingMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read from input stream: %w", err)
+	}
+	if !IsPaddedStream(magic) {
+		return nil, ErrNoHiddenVolume
+	}
+	br.Discard(len(paddingMagic))
+
+	// Skip the outer data, checking its length, up to the start of the padding
+	outer := &unpadReader{r: br, keepPadding: true}
+	if _, err := io.Copy(io.Discard, outer); err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, passphraseSaltSize)
+	if _, err := io.ReadFull(br, salt); err != nil {
+		return nil, ErrNoHiddenVolume
+	}
+	key, _ := passphraseKeys(secret, salt, DefaultPassphraseParams)
+	unmasked, err := newKeystreamReader(br, key)
+	if err != nil {
+		return nil, err
+	}
+	hidden := bufio.NewReader(unmasked)
+	magic = make([]byte, len(paddingMagic))
+	if _, err := io.ReadFull(hidden, magic); err != nil || !bytes.Equal(magic, []byte(paddingMagic)) {
+		return nil, ErrNoHiddenVolume
+	}
+
+	log.Debugf("Opened the hidden volume in the padding of the stream")
+	return &unpadReader{r: hidden}, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestHiddenVolume(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	outer := bytes.Repeat([]byte("decoy "), 5000)
+	hiddenData := bytes.Repeat([]byte("the real secret "), 6000)
+	secret := []byte("hidden volume secret")
+	const size = 256 * 1024
+
+	hidden, err := NewHiddenVolume(ctx, bytes.NewReader(hiddenData), secret)
+	if err != nil {
+		t.Fatalf("NewHiddenVolume failed: %v", err)
+	}
+	defer hidden.Close()
+	if hidden.Size() != int64(passphraseSaltSize)+PaddedSize(int64(len(hiddenData))) {
+		t.Errorf("Hidden volume is %d bytes, expected %d", hidden.Size(), int64(passphraseSaltSize)+PaddedSize(int64(len(hiddenData))))
+	}
+
+	var needed int64
+	stream, err := io.ReadAll(PadStreamHiding(ctx, bytes.NewReader(outer), func(n int64) (int64, error) {
+		needed = n
+		return size, nil
+	}, hidden))
+	if err != nil || len(stream) != size {
+		t.Fatalf("Padded stream is %d bytes, expected %d (%v)", len(stream), size, err)
+	}
+	if needed != PaddedSize(int64(len(outer)))+hidden.Size() {
+		t.Errorf("Target was asked for %d bytes, expected room for the hidden volume too", needed)
+	}
+	if bytes.Contains(stream, []byte("the real secret")) {
+		t.Errorf("The hidden volume is in the clear")
+	}
+
+	// Without the secret, the stream decodes to the outer data
+	r, err := UnpadStream(ctx, bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("UnpadStream failed: %v", err)
+	}
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, outer) {
+		t.Errorf("Unpadding did not reproduce the outer data (%v)", err)
+	}
+
+	// With it, to the hidden data
+	reveal := func(stream, secret []byte) ([]byte, error) {
+		r, err := RevealHidden(ctx, bytes.NewReader(stream), secret)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+	if got, err := reveal(stream, secret); err != nil || !bytes.Equal(got, hiddenData) {
+		t.Errorf("Revealing did not reproduce the hidden data (%v)", err)
+	}
+
+	// A wrong secret, padding without a hidden volume, and an unpadded stream look the same
+	if _, err := reveal(stream, []byte("wrong")); !errors.Is(err, ErrNoHiddenVolume) {
+		t.Errorf("Expected ErrNoHiddenVolume for a wrong secret, got %v", err)
+	}
+	plain, _ := io.ReadAll(PadStream(ctx, bytes.NewReader(outer), func(int64) (int64, error) { return size, nil }))
+	if _, err := reveal(plain, secret); !errors.Is(err, ErrNoHiddenVolume) {
+		t.Errorf("Expected ErrNoHiddenVolume for padding without a hidden volume, got %v", err)
+	}
+	if _, err := reveal(outer, secret); !errors.Is(err, ErrNoHiddenVolume) {
+		t.Errorf("Expected ErrNoHiddenVolume for an unpadded stream, got %v", err)
+	}
+
+	// The padding must have room for the hidden volume
+	_, err = io.ReadAll(PadStreamHiding(ctx, bytes.NewReader(outer), func(n int64) (int64, error) {
+		return PaddedSize(int64(len(outer))) + 10, nil
+	}, hidden))
+	if err == nil {
+		t.Errorf("Expected an error padding to less than the hidden volume needs")
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// A chunk index lets decode restore some of the files of a serialized stream without decoding
+// all of its chunks. The stream is compressed in blocks of about IndexBlockSize of TAR, each a
+// complete gzip member or zstd frame starting at a TAR entry, so that a block decompresses on
+// its own; one after another they decompress as a single stream, so decoders that don't use
+// the index read the stream as before. The index is the last entry of the stream, in a block
+// of its own, and records where each block starts in the stream, which chunks hold it, and
+// where each entry is in its block. Where the block holding the index starts is recorded in
+// the metadata of the collections, as an IndexLocation.
+
+// IndexName is the name of the entry at the end of an indexed stream that holds its chunk
+// index. Decode doesn't restore it.
+const IndexName = ".padlock-index.json"
+
+// IndexBlockSize is how much of the TAR is compressed in a block before the next entry starts
+// a new one. Smaller blocks waste less decoding on entries that weren't selected, and larger
+// blocks compress better.
+const IndexBlockSize = 1024 * 1024
+
+// indexVersion is the version of the chunk index format written by SerializeIndexed
+const indexVersion = 1
+
+// indexPAXKey marks the chunk index's tar entry, as hashManifestPAXKey marks the hash manifest
+const indexPAXKey = "PADLOCK.index"
+
+// ChunkIndex maps the entries of a serialized stream to the blocks and chunks that hold them
+type ChunkIndex struct {
+	Version     int          `json:"version"`
+	Compression string       `json:"compression"` // Compression of every block: "gzip", "zstd", or "none"
+	ChunkBytes  int64        `json:"chunk_bytes"` // Bytes of the stream each chunk encodes
+	Blocks      []IndexBlock `json:"blocks"`
+	Entries     []IndexEntry `json:"entries"` // In stream order, ending with the hash manifest
+}
+
+// IndexBlock is a separately compressed block of an indexed stream
+type IndexBlock struct {
+	Offset     int64 `json:"offset"`      // Where the block starts in the stream
+	Length     int64 `json:"length"`      // Bytes of the stream the block takes, compressed
+	FirstChunk int   `json:"first_chunk"` // Chunk holding the start of the block, from 1
+	LastChunk  int   `json:"last_chunk"`  // Chunk holding the end of the block
+}
+
+// IndexEntry locates an entry of an indexed stream within its block
+type IndexEntry struct {
+	Name   string `json:"name"`          // Path of the entry, as in the serialized stream
+	Dir    bool   `json:"dir,omitempty"` // Whether the entry is a directory
+	Block  int    `json:"block"`         // Position of the block holding the entry in Blocks
+	Skip   int64  `json:"skip"`          // Where the entry's headers start in the decompressed block
+	Length int64  `json:"length"`        // Bytes of the entry's headers and padded data
+}
+
+// IndexLocation locates the chunk index of a stream, and is recorded in collection metadata
+type IndexLocation struct {
+	Offset     int64 `json:"offset"`      // Where the block holding the index starts in the stream
+	ChunkBytes int64 `json:"chunk_bytes"` // Bytes of the stream each chunk encodes
+}
+
+// Chunk returns the chunk holding the start of the block the index is in, from 1
+func (l IndexLocation) Chunk() int {
+	return int(l.Offset/l.ChunkBytes) + 1
+}
+
+// Select returns the entries filter selects, with the hash manifest the restored files are
+// checked against, in stream order
+func (ix *ChunkIndex) Select(filter *Filter) []IndexEntry {
+	var selected []IndexEntry
+	for i, entry := range ix.Entries {
+		if i == len(ix.Entries)-1 || filter.Selects(entry.Name, entry.Dir) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
+
+// OpenBlock returns the decompressed contents of a block, read from r starting at the block
+func (ix *ChunkIndex) OpenBlock(r io.Reader, block int) (io.Reader, error) {
+	return openBlock(io.LimitReader(r, ix.Blocks[block].Length), ix.Compression)
+}
+
+// openBlock decompresses a block compressed with the named compression
+func openBlock(r io.Reader, compression string) (io.Reader, error) {
+	if compression == "" || strings.EqualFold(compression, "none") {
+		return r, nil
+	}
+	c, err := LookupCompressor(compression)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewReader(r)
+}
+
+// ReadChunkIndex reads the chunk index from r, which starts at the block that holds it,
+// compressed with the named compression
+func ReadChunkIndex(r io.Reader, compression string) (*ChunkIndex, error) {
+	block, err := openBlock(r, compression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk index: %w", err)
+	}
+	header, err := tar.NewReader(block).Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk index: %w", err)
+	}
+	if !isChunkIndex(header) {
+		return nil, fmt.Errorf("failed to read chunk index: found %s where it should be", header.Name)
+	}
+	var ix ChunkIndex
+	if err := json.NewDecoder(io.LimitReader(block, header.Size)).Decode(&ix); err != nil {
+		return nil, fmt.Errorf("invalid chunk index: %w", err)
+	}
+	if ix.Version != indexVersion {
+		return nil, fmt.Errorf("unsupported chunk index version %d", ix.Version)
+	}
+	if len(ix.Entries) == 0 || ix.ChunkBytes <= 0 {
+		return nil, fmt.Errorf("invalid chunk index: no entries")
+	}
+	for _, entry := range ix.Entries {
+		if entry.Block < 0 || entry.Block >= len(ix.Blocks) {
+			return nil, fmt.Errorf("invalid chunk index: %s is in block %d of %d", entry.Name, entry.Block, len(ix.Blocks))
+		}
+	}
+	return &ix, nil
+}
+
+// isChunkIndex reports whether a tar entry of a serialized stream is its chunk index
+func isChunkIndex(header *tar.Header) bool {
+	return header.Typeflag == tar.TypeReg && header.Name == IndexName && header.PAXRecords[indexPAXKey] != ""
+}
+
+// IndexedStream is a serialized stream compressed in blocks, ending with a chunk index
+type IndexedStream struct {
+	*io.PipeReader
+	location IndexLocation
+}
+
+// Location returns where the chunk index is in the stream. It is only known once the stream
+// has been read to its end.
+func (s *IndexedStream) Location() IndexLocation {
+	return s.location
+}
+
+// SerializeIndexed is SerializeDirectoriesWithFilter, compressing the stream in blocks with
+// the named compression at the given level, or not at all if compression is "none", and
+// ending it with a chunk index for chunks that each encode chunkBytes of the stream
+func SerializeIndexed(ctx context.Context, inputDirs []string, filter *Filter, compression string, level int, chunkBytes int64) (*IndexedStream, error) {
+	log := trace.FromContext(ctx).WithPrefix("serialize")
+
+	if chunkBytes <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d for a chunk index", chunkBytes)
+	}
+	w := &blockWriter{level: level, index: &ChunkIndex{Version: indexVersion, Compression: "none", ChunkBytes: chunkBytes}}
+	if compression != "" && !strings.EqualFold(compression, "none") {
+		c, err := LookupCompressor(compression)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.CheckLevel(level); err != nil {
+			return nil, err
+		}
+		w.compressor = &c
+		w.index.Compression = c.Name
+	}
+
+	log.Debugf("Serializing to an indexed tar stream: %s", strings.Join(inputDirs, ", "))
+	pr, pw := io.Pipe()
+	stream := &IndexedStream{PipeReader: pr}
+	w.out = &countingOutput{w: pw}
+
+	go func() {
+		defer pw.Close()
+
+		// Cancelling ctx unblocks a write to a reader that has stopped reading
+		defer context.AfterFunc(ctx, func() { pw.CloseWithError(ctx.Err()) })()
+
+		tw := tar.NewWriter(w)
+		err := writeInputs(ctx, tw, inputDirs, filter, func(name string, isDir bool, size int64) error {
+			return w.startEntry(tw, name, isDir, size)
+		})
+		if err == nil {
+			stream.location, err = w.writeIndex(tw)
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("error during directory serialization: %w", err))
+			pw.CloseWithError(fmt.Errorf("error during directory serialization: %w", err))
+			return
+		}
+		log.Debugf("Indexed %d entries in %d blocks", len(w.index.Entries), len(w.index.Blocks))
+	}()
+
+	return stream, nil
+}
+
+// countingOutput counts the bytes written through it
+type countingOutput struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingOutput) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// uncompressedBlock writes a block of a stream that isn't compressed
+type uncompressedBlock struct {
+	io.Writer
+}
+
+func (uncompressedBlock) Close() error {
+	return nil
+}
+
+// blockWriter compresses the TAR written to it in blocks, recording them and the entries in
+// them in a chunk index
+type blockWriter struct {
+	out        *countingOutput
+	compressor *Compressor // Nil if the blocks aren't compressed
+	level      int
+	block      io.WriteCloser // Compresses the current block to out
+	raw        int64          // Bytes of TAR written to the current block
+	open       bool           // Whether the last entry in the index is still being written
+	index      *ChunkIndex
+}
+
+func (w *blockWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		// Flushing the TAR before its first entry writes nothing, with no block to write to
+		return 0, nil
+	}
+	n, err := w.block.Write(p)
+	w.raw += int64(n)
+	return n, err
+}
+
+// startEntry records the entry whose headers tw writes next, starting a new block first if
+// the current one is full, or if the entry of size bytes would fill a block by itself so that
+// the entries before it can be decoded without it
+func (w *blockWriter) startEntry(tw *tar.Writer, name string, isDir bool, size int64) error {
+	if err := w.endEntry(tw); err != nil {
+		return err
+	}
+	if w.block == nil || w.raw >= IndexBlockSize || (w.raw > 0 && size >= IndexBlockSize) {
+		if err := w.endBlock(); err != nil {
+			return err
+		}
+		w.index.Blocks = append(w.index.Blocks, IndexBlock{Offset: w.out.n, FirstChunk: w.chunk(w.out.n)})
+		if err := w.openBlock(); err != nil {
+			return err
+		}
+	}
+	w.index.Entries = append(w.index.Entries, IndexEntry{Name: name, Dir: isDir, Block: len(w.index.Blocks) - 1, Skip: w.raw})
+	w.open = true
+	return nil
+}
+
+// endEntry pads the entry being written to a whole TAR block and records its length
+func (w *blockWriter) endEntry(tw *tar.Writer) error {
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if w.open {
+		entry := &w.index.Entries[len(w.index.Entries)-1]
+		entry.Length = w.raw - entry.Skip
+		w.open = false
+	}
+	return nil
+}
+
+// openBlock starts compressing a new block
+func (w *blockWriter) openBlock() error {
+	w.raw = 0
+	if w.compressor == nil {
+		w.block = uncompressedBlock{w.out}
+		return nil
+	}
+	var err error
+	w.block, err = w.compressor.NewWriter(w.out, w.level)
+	return err
+}
+
+// endBlock finishes the current block, if any, and records its length
+func (w *blockWriter) endBlock() error {
+	if w.block == nil {
+		return nil
+	}
+	if err := w.block.Close(); err != nil {
+		return err
+	}
+	w.block = nil
+	block := &w.index.Blocks[len(w.index.Blocks)-1]
+	block.Length = w.out.n - block.Offset
+	block.LastChunk = w.chunk(block.Offset + max(block.Length, 1) - 1)
+	return nil
+}
+
+// chunk returns the chunk holding the byte of the stream at offset
+func (w *blockWriter) chunk(offset int64) int {
+	return int(offset/w.index.ChunkBytes) + 1
+}
+
+// writeIndex ends the stream with the chunk index, in a block of its own, and returns where
+// that block starts
+func (w *blockWriter) writeIndex(tw *tar.Writer) (IndexLocation, error) {
+	if err := w.endEntry(tw); err != nil {
+		return IndexLocation{}, err
+	}
+	if err := w.endBlock(); err != nil {
+		return IndexLocation{}, err
+	}
+	location := IndexLocation{Offset: w.out.n, ChunkBytes: w.index.ChunkBytes}
+	if err := w.openBlock(); err != nil {
+		return IndexLocation{}, err
+	}
+
+	data, err := json.Marshal(w.index)
+	if err != nil {
+		return IndexLocation{}, fmt.Errorf("failed to encode chunk index: %w", err)
+	}
+	header := &tar.Header{
+		Name:       IndexName,
+		Mode:       0644,
+		Size:       int64(len(data)),
+		ModTime:    time.Unix(0, 0),
+		Typeflag:   tar.TypeReg,
+		PAXRecords: map[string]string{indexPAXKey: fmt.Sprint(indexVersion)},
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return IndexLocation{}, fmt.Errorf("failed to write chunk index: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return IndexLocation{}, fmt.Errorf("failed to write chunk index: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return IndexLocation{}, err
+	}
+	if err := w.block.Close(); err != nil {
+		return IndexLocation{}, err
+	}
+	return location, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestSerializeIndexed checks that an indexed stream decompresses and restores as an ordinary
+// one, and that its chunk index locates every entry in its own block and chunks
+func TestSerializeIndexed(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	rng := rand.New(rand.NewSource(1))
+	files := make(map[string][]byte)
+	for i := 0; i < 6; i++ {
+		data := make([]byte, 400*1024)
+		rng.Read(data[:len(data)/2]) // Half random, so that it compresses but not to nothing
+		name := fmt.Sprintf("dir%d/file%d.bin", i%2, i)
+		files[name] = data
+		path := filepath.Join(inputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	for _, compression := range []string{"gzip", "none"} {
+		t.Run(compression, func(t *testing.T) {
+			const chunkBytes = 256 * 1024
+			stream, err := SerializeIndexed(ctx, []string{inputDir}, nil, compression, 0, chunkBytes)
+			if err != nil {
+				t.Fatalf("SerializeIndexed failed: %v", err)
+			}
+			data, err := io.ReadAll(stream)
+			if err != nil {
+				t.Fatalf("Failed to read the indexed stream: %v", err)
+			}
+			location := stream.Location()
+			if location.Offset <= 0 || location.ChunkBytes != chunkBytes || location.Chunk() != int(location.Offset/chunkBytes)+1 {
+				t.Fatalf("Unexpected index location %+v", location)
+			}
+
+			// Decoders that don't use the index restore the files, without the index
+			var r io.Reader = bytes.NewReader(data)
+			if compression != "none" {
+				if r, err = DecompressStreamToStream(ctx, r); err != nil {
+					t.Fatalf("Failed to decompress: %v", err)
+				}
+			}
+			outputDir := filepath.Join(t.TempDir(), "restored")
+			if err := DeserializeDirectoryFromStream(ctx, outputDir, r, false); err != nil {
+				t.Fatalf("Failed to restore the indexed stream: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(outputDir, IndexName)); !os.IsNotExist(err) {
+				t.Errorf("Expected the chunk index not to be restored")
+			}
+
+			index, err := ReadChunkIndex(bytes.NewReader(data[location.Offset:]), compression)
+			if err != nil {
+				t.Fatalf("ReadChunkIndex failed: %v", err)
+			}
+			if len(index.Blocks) < 2 {
+				t.Fatalf("Expected the stream to be compressed in several blocks, got %d", len(index.Blocks))
+			}
+			if last := index.Entries[len(index.Entries)-1]; last.Name != HashManifestName {
+				t.Errorf("Expected the hash manifest to be the last entry, got %s", last.Name)
+			}
+			for _, block := range index.Blocks {
+				if block.FirstChunk != int(block.Offset/chunkBytes)+1 || block.LastChunk != int((block.Offset+block.Length-1)/chunkBytes)+1 {
+					t.Errorf("Block %+v is in the wrong chunks", block)
+				}
+			}
+
+			// Each entry is found where the index says, decompressing only its block
+			found := 0
+			for _, entry := range index.Entries {
+				block := index.Blocks[entry.Block]
+				decompressed, err := index.OpenBlock(bytes.NewReader(data[block.Offset:]), entry.Block)
+				if err != nil {
+					t.Fatalf("OpenBlock failed: %v", err)
+				}
+				if _, err := io.CopyN(io.Discard, decompressed, entry.Skip); err != nil {
+					t.Fatalf("Failed to skip to %s: %v", entry.Name, err)
+				}
+				tr := tar.NewReader(io.LimitReader(decompressed, entry.Length))
+				hdr, err := tr.Next()
+				if err != nil || hdr.Name != entry.Name {
+					t.Fatalf("Expected %s where the index locates it, got %v (%v)", entry.Name, hdr, err)
+				}
+				if want, ok := files[entry.Name]; ok {
+					got, err := io.ReadAll(tr)
+					if err != nil || !bytes.Equal(got, want) {
+						t.Errorf("%s doesn't match where the index locates it (%v)", entry.Name, err)
+					}
+					found++
+				}
+			}
+			if found != len(files) {
+				t.Errorf("Expected the index to locate %d files, found %d", len(files), found)
+			}
+		})
+	}
+}
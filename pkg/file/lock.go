@@ -0,0 +1,176 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// LockFileName is the advisory lock file padlock keeps in a directory it is writing to, so
+// that a second encode or decode into the same directory fails rather than corrupting it
+const LockFileName = ".padlock.lock"
+
+// ErrLocked is returned, wrapped with who holds the lock, when a directory is locked by
+// another operation that is still running
+var ErrLocked = errors.New("directory is in use by another padlock operation")
+
+// unwrittenLockAge is how old a lock file that doesn't yet say who holds it must be before
+// it is taken to be stale, since the process that created it died before writing it
+const unwrittenLockAge = time.Minute
+
+// LockInfo is the content of a lock file: the operation that holds it
+type LockInfo struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	Operation string    `json:"operation"` // e.g. "encode" or "decode"
+	Started   time.Time `json:"started"`
+}
+
+// Stale reports whether the operation holding the lock is no longer running. Only a lock
+// held on this host can be checked; one held on another host, such as through a network
+// share, is never stale.
+func (info *LockInfo) Stale() bool {
+	host, err := os.Hostname()
+	if err != nil || info.Host != host {
+		return false
+	}
+	return !processAlive(info.PID)
+}
+
+// String describes the holder of the lock for error messages
+func (info *LockInfo) String() string {
+	return fmt.Sprintf("%s (pid %d on %s, started %s)", info.Operation, info.PID, info.Host, info.Started.Format(time.RFC3339))
+}
+
+// Lock is an advisory lock on a directory, held until Release is called
+type Lock struct {
+	path string
+}
+
+// AcquireLock locks dir for operation, creating the directory if needed. A lock left by an
+// operation that died is detected and replaced; one held by an operation that is still
+// running fails with an error wrapping ErrLocked that names the holder.
+func AcquireLock(dir string, operation string) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	host, _ := os.Hostname()
+	info := LockInfo{PID: os.Getpid(), Host: host, Operation: operation, Started: time.Now()}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode lock: %w", err)
+	}
+
+	path := filepath.Join(dir, LockFileName)
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.Write(append(data, '\n'))
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock file %s: %w", path, err)
+			}
+			return &Lock{path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file %s: %w", path, err)
+		}
+
+		// Replace a stale lock once; if it is back, another operation took it meanwhile
+		holder, stale, err := inspectLock(path)
+		if errors.Is(err, os.ErrNotExist) && attempt == 0 {
+			continue // Released meanwhile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !stale || attempt > 0 {
+			return nil, lockedError(dir, path, holder)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove stale lock file %s: %w", path, err)
+		}
+	}
+}
+
+// CheckLock fails with an error wrapping ErrLocked if dir is locked by an operation that is
+// still running. It is used for directories that are only read, which may be on read-only
+// media, so no lock is taken.
+func CheckLock(dir string) error {
+	path := filepath.Join(dir, LockFileName)
+	holder, stale, err := inspectLock(path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && stale) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return lockedError(dir, path, holder)
+}
+
+// ReadLock returns the holder of the lock on dir, and whether the lock is stale
+func ReadLock(dir string) (*LockInfo, bool, error) {
+	return inspectLock(filepath.Join(dir, LockFileName))
+}
+
+// inspectLock reads a lock file and decides whether it is stale. A lock file that can't be
+// parsed was left by a process that died while creating it, once it is old enough.
+func inspectLock(path string) (*LockInfo, bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read lock file %s: %w", path, err)
+	}
+	var info LockInfo
+	if err := json.Unmarshal(data, &info); err != nil || info.PID == 0 {
+		return nil, time.Since(fi.ModTime()) > unwrittenLockAge, nil
+	}
+	return &info, info.Stale(), nil
+}
+
+// lockedError describes a lock that is held by another operation
+func lockedError(dir string, path string, holder *LockInfo) error {
+	if holder == nil {
+		return fmt.Errorf("%s is being locked by another operation; try again, or remove %s if none is running: %w", dir, path, ErrLocked)
+	}
+	return fmt.Errorf("%s is in use by %s; if it is no longer running, remove %s: %w", dir, holder, path, ErrLocked)
+}
+
+// Path returns the path of the lock file
+func (l *Lock) Path() string {
+	return l.path
+}
+
+// Release removes the lock file
+func (l *Lock) Release() error {
+	if l == nil {
+		return nil
+	}
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove lock file %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// processAlive reports whether a process with the given ID is running on this host. Where
+// that can't be determined, the process is assumed to be running.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return !errors.Is(err, os.ErrProcessDone) && !errors.Is(err, syscall.ESRCH)
+}
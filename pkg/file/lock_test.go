@@ -0,0 +1,105 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeLock writes a lock file as if held by the given process
+func writeLock(t *testing.T, dir string, info LockInfo) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("Failed to encode lock: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, LockFileName), data, 0644); err != nil {
+		t.Fatalf("Failed to write lock: %v", err)
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "padlock-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	dir := filepath.Join(tempDir, "output")
+
+	lock, err := AcquireLock(dir, "encode")
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	holder, stale, err := ReadLock(dir)
+	if err != nil || stale || holder.PID != os.Getpid() || holder.Operation != "encode" {
+		t.Errorf("ReadLock = %+v, %v, %v", holder, stale, err)
+	}
+
+	// A second operation, even in the same process, fails fast
+	if _, err := AcquireLock(dir, "decode"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected a second lock to fail with ErrLocked, got %v", err)
+	}
+	if err := CheckLock(dir); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected CheckLock to report the lock, got %v", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if err := CheckLock(dir); err != nil {
+		t.Errorf("Expected no lock after release, got %v", err)
+	}
+	lock, err = AcquireLock(dir, "decode")
+	if err != nil {
+		t.Fatalf("Expected the lock to be free after release: %v", err)
+	}
+	lock.Release()
+}
+
+func TestStaleLock(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "padlock-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	host, _ := os.Hostname()
+
+	// A lock held by a process that died is replaced
+	writeLock(t, tempDir, LockInfo{PID: 0x7ffffff0, Host: host, Operation: "encode", Started: time.Now()})
+	if err := CheckLock(tempDir); err != nil {
+		t.Errorf("Expected a lock of a dead process to be ignored, got %v", err)
+	}
+	lock, err := AcquireLock(tempDir, "encode")
+	if err != nil {
+		t.Fatalf("Expected a stale lock to be replaced: %v", err)
+	}
+	lock.Release()
+
+	// A lock held on another host can't be checked, so it is never stale
+	writeLock(t, tempDir, LockInfo{PID: 0x7ffffff0, Host: host + "-elsewhere", Operation: "encode", Started: time.Now()})
+	if _, err := AcquireLock(tempDir, "encode"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected a lock held on another host to be respected, got %v", err)
+	}
+
+	// A lock file that was never written is only stale once it is old
+	path := filepath.Join(tempDir, LockFileName)
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("Failed to write lock: %v", err)
+	}
+	if _, err := AcquireLock(tempDir, "encode"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected a lock being created to be respected, got %v", err)
+	}
+	old := time.Now().Add(-2 * unwrittenLockAge)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Failed to age lock: %v", err)
+	}
+	lock, err = AcquireLock(tempDir, "encode")
+	if err != nil {
+		t.Fatalf("Expected an old unwritten lock to be replaced: %v", err)
+	}
+	lock.Release()
+}
@@ -0,0 +1,164 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// IsChunkFileName reports whether the file at path is named like a chunk of a collection, such
+// as 3A5_0001.bin or IMG3A5_0001.PNG, so that its collection can be told from its name
+func IsChunkFileName(path string) bool {
+	return collectionNameFromChunkFile(filepath.Base(path)) != ""
+}
+
+// ChunkCollectionNames returns the names of the collections whose chunk files are directly in
+// dir, as their file names give them. A collection directory has one; a directory into which
+// the chunks of several collections were copied has more.
+func ChunkCollectionNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if name := collectionNameFromChunkFile(entry.Name()); name != "" && !entry.IsDir() && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// FindCollectionFiles returns the collections in files given as decode inputs rather than in
+// directories: collection TAR and ZIP archives, and chunk files, which are grouped by the
+// collection their names give. Grouped chunks, and TARs that must be extracted, are placed in
+// tempDir, or if it is empty in a new temporary directory, which is returned and must be
+// removed by the caller.
+func FindCollectionFiles(ctx context.Context, paths []string, tempDir string) ([]Collection, string, error) {
+	log := trace.FromContext(ctx).WithPrefix("COLLECTION")
+
+	created := tempDir == ""
+	fail := func(err error) ([]Collection, string, error) {
+		if created && tempDir != "" {
+			os.RemoveAll(tempDir)
+		}
+		log.Error(err)
+		return nil, "", err
+	}
+
+	var collections []Collection
+	var chunks []string
+	for _, path := range paths {
+		switch {
+		case IsVolumePath(path):
+			return fail(fmt.Errorf("%s is one volume of a collection; give the directory holding its %s manifest instead", path, VolumeManifestSuffix))
+		case IsArchivePath(path):
+			coll, err := archiveCollection(ctx, path, &tempDir)
+			if err != nil {
+				return fail(err)
+			}
+			collections = append(collections, coll)
+		case IsChunkFileName(path):
+			chunks = append(chunks, path)
+		default:
+			return fail(fmt.Errorf("%s is not a collection archive or chunk file", path))
+		}
+	}
+	if len(chunks) > 0 {
+		grouped, err := groupLooseChunks(ctx, chunks, &tempDir)
+		if err != nil {
+			return fail(err)
+		}
+		collections = append(collections, grouped...)
+	}
+
+	for i := range collections {
+		collections[i].UseMetadata(ctx)
+	}
+	return collections, tempDir, nil
+}
+
+// groupLooseChunks makes a collection of the chunk files of each collection among paths, by
+// linking them into a directory per collection under *tempDir, which is created if needed.
+// Files that can't be linked are copied. A chunk given more than once is used once.
+func groupLooseChunks(ctx context.Context, paths []string, tempDir *string) ([]Collection, error) {
+	log := trace.FromContext(ctx).WithPrefix("COLLECTION")
+
+	var names []string
+	groups := make(map[string][]string)
+	for _, path := range paths {
+		name := collectionNameFromChunkFile(filepath.Base(path))
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], path)
+	}
+	slices.Sort(names)
+
+	if *tempDir == "" {
+		dir, err := MkdirTemp("padlock-collections-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp directory: %w", err)
+		}
+		*tempDir = dir
+	}
+
+	var collections []Collection
+	for _, name := range names {
+		collDir, err := os.MkdirTemp(*tempDir, name+"-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create directory for collection %s: %w", name, err)
+		}
+		for _, path := range groups[name] {
+			target := filepath.Join(collDir, filepath.Base(path))
+			if _, err := os.Lstat(target); err == nil {
+				log.Infof("Chunk file %s was given more than once; using the first", filepath.Base(path))
+				continue
+			}
+			if err := linkChunkFile(path, target); err != nil {
+				return nil, fmt.Errorf("failed to gather chunk file %s: %w", path, err)
+			}
+		}
+		format, err := DetermineCollectionFormat(collDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine format for collection %s: %w", name, err)
+		}
+		collections = append(collections, Collection{Name: name, Path: collDir, Format: format})
+		log.Infof("Gathered %d loose chunk files of collection %s", len(groups[name]), name)
+	}
+	return collections, nil
+}
+
+// linkChunkFile makes the chunk file at path available at target, as a symbolic link, or where
+// links can't be made, as a copy
+func linkChunkFile(path, target string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if os.Symlink(abs, target) == nil {
+		return nil
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
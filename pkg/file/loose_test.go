@@ -0,0 +1,79 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestFindCollectionFiles checks that chunk files of several collections, given one by one or
+// mixed together in a directory, are grouped into a collection each
+func TestFindCollectionFiles(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	mixed := t.TempDir()
+	var paths []string
+	for _, name := range []string{"2A3", "2B3"} {
+		for number := 1; number <= 3; number++ {
+			payload := fmt.Sprintf("%s chunk %d", name, number)
+			if err := WriteNamedChunk(ctx, &BinFormatter{}, mixed, name, number, []byte(payload)); err != nil {
+				t.Fatalf("Failed to write chunk: %v", err)
+			}
+			paths = append(paths, filepath.Join(mixed, fmt.Sprintf("%s_%04d.bin", name, number)))
+		}
+	}
+	if err := os.WriteFile(filepath.Join(mixed, "notes.txt"), []byte("not a chunk"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	check := func(what string, collections []Collection) {
+		t.Helper()
+		if len(collections) != 2 {
+			t.Fatalf("%s: expected 2 collections, got %d", what, len(collections))
+		}
+		for i, name := range []string{"2A3", "2B3"} {
+			coll := collections[i]
+			if coll.Name != name || coll.Format != FormatBin {
+				t.Errorf("%s: unexpected collection %+v", what, coll)
+			}
+			reader := NewCollectionReader(coll)
+			for number := 1; number <= 3; number++ {
+				data, err := reader.ReadNextChunk(ctx)
+				if want := fmt.Sprintf("%s chunk %d", name, number); err != nil || string(data) != want {
+					t.Errorf("%s: chunk %d of %s = %q, %v; want %q", what, number, name, data, err, want)
+				}
+			}
+			reader.Close()
+		}
+	}
+
+	// Chunk files given one by one, one of them twice
+	collections, tempDir, err := FindCollectionFiles(ctx, append(paths, paths[0]), "")
+	if err != nil {
+		t.Fatalf("Failed to find collections in files: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	check("files", collections)
+
+	// The directory they are mixed together in
+	collections, tempDir, err = FindCollections(ctx, mixed)
+	if err != nil {
+		t.Fatalf("Failed to find collections in a mixed directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	check("mixed directory", collections)
+	if names, err := ChunkCollectionNames(mixed); err != nil || len(names) != 2 {
+		t.Errorf("ChunkCollectionNames = %v, %v", names, err)
+	}
+
+	// A file that is neither an archive nor a chunk is refused
+	if _, _, err := FindCollectionFiles(ctx, []string{filepath.Join(mixed, "notes.txt")}, ""); err == nil {
+		t.Errorf("Expected a file that isn't a chunk to be refused")
+	}
+}
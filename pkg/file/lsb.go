@@ -0,0 +1,234 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// PNGEmbedding is how chunk data is hidden in a PNG chunk file
+type PNGEmbedding string
+
+const (
+	// PNGEmbedChunk stores the data in a custom 'rAWd' PNG chunk after the image. This is the
+	// default, and the zero value means the same.
+	PNGEmbedChunk PNGEmbedding = "chunk"
+
+	// PNGEmbedLSB stores the data in the two low-order bits of each red, green, and blue value
+	// of the image's pixels, so it survives tools that strip non-standard PNG chunks. The image
+	// must have at least 4 pixels for every 3 bytes of data, which makes these files several
+	// times larger than the data they hold.
+	PNGEmbedLSB PNGEmbedding = "lsb"
+)
+
+// lsbBitsPerChannel is the number of low-order bits of each color value that hold data
+const lsbBitsPerChannel = 2
+
+// lsbOverhead is the size of the length, type, and CRC fields around the data in the pixels,
+// which are laid out exactly as a 'rAWd' PNG chunk is
+const lsbOverhead = 12
+
+// ParsePNGEmbedding parses a PNG embedding name, "chunk" or "lsb"
+func ParsePNGEmbedding(s string) (PNGEmbedding, error) {
+	switch e := PNGEmbedding(strings.ToLower(strings.TrimSpace(s))); e {
+	case PNGEmbedChunk, PNGEmbedLSB:
+		return e, nil
+	}
+	return "", fmt.Errorf("PNG embedding must be chunk or lsb, got %q", s)
+}
+
+// lsbPixelsNeeded returns the number of pixels needed to hide dataLen bytes
+func lsbPixelsNeeded(dataLen int) int {
+	bits := (dataLen + lsbOverhead) * 8
+	perPixel := 3 * lsbBitsPerChannel
+	return (bits + perPixel - 1) / perPixel
+}
+
+// lsbChannels addresses the red, green, and blue values of an image's pixels, in row order,
+// as a single sequence
+type lsbChannels struct {
+	pix    []byte
+	stride int
+	width  int
+	count  int // Number of color values
+}
+
+func newLSBChannels(img image.Image) (*lsbChannels, error) {
+	var pix []byte
+	var stride int
+	switch img := img.(type) {
+	case *image.NRGBA:
+		pix, stride = img.Pix, img.Stride
+	case *image.RGBA:
+		pix, stride = img.Pix, img.Stride
+	default:
+		return nil, fmt.Errorf("unsupported PNG pixel layout %T for hidden data", img)
+	}
+	b := img.Bounds()
+	return &lsbChannels{pix: pix, stride: stride, width: b.Dx(), count: b.Dx() * b.Dy() * 3}, nil
+}
+
+// offset returns the position in pix of the i'th color value
+func (c *lsbChannels) offset(i int) int {
+	pixel := i / 3
+	return (pixel/c.width)*c.stride + (pixel%c.width)*4 + i%3
+}
+
+// write hides data in the color values starting at the i'th, and returns the next index
+func (c *lsbChannels) write(i int, data []byte) int {
+	const mask = 1<<lsbBitsPerChannel - 1
+	for _, b := range data {
+		for shift := 8 - lsbBitsPerChannel; shift >= 0; shift -= lsbBitsPerChannel {
+			p := c.offset(i)
+			c.pix[p] = c.pix[p]&^mask | (b>>shift)&mask
+			i++
+		}
+	}
+	return i
+}
+
+// read recovers n bytes hidden in the color values starting at the i'th, and returns the
+// next index
+func (c *lsbChannels) read(i int, n int) ([]byte, int) {
+	const mask = 1<<lsbBitsPerChannel - 1
+	data := make([]byte, n)
+	for j := range data {
+		var b byte
+		for k := 0; k < 8/lsbBitsPerChannel; k++ {
+			b = b<<lsbBitsPerChannel | c.pix[c.offset(i)]&mask
+			i++
+		}
+		data[j] = b
+	}
+	return data, i
+}
+
+// encodePNGWithPixelData hides data in the low-order bits of the pixels of img and writes
+// the result as a PNG. The length, 'rAWd' type, and CRC fields are hidden with the data,
+// in the same layout as a 'rAWd' PNG chunk.
+func encodePNGWithPixelData(w io.Writer, img image.Image, data []byte) error {
+	b := img.Bounds()
+	if have, need := b.Dx()*b.Dy(), lsbPixelsNeeded(len(data)); have < need {
+		return fmt.Errorf("a %dx%d image can hide %d bytes, but the chunk has %d; use larger cover images or a smaller chunk size",
+			b.Dx(), b.Dy(), have*3*lsbBitsPerChannel/8-lsbOverhead, len(data))
+	}
+
+	// Work on a copy in a layout whose color values are stored exactly
+	canvas := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), img, b.Min, draw.Src)
+	channels, err := newLSBChannels(canvas)
+	if err != nil {
+		return err
+	}
+
+	chunkType := []byte("rAWd")
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], chunkType)
+	crc := crc32.NewIEEE()
+	crc.Write(chunkType)
+	crc.Write(data)
+	var crcBytes [4]byte
+	binary.BigEndian.PutUint32(crcBytes[:], crc.Sum32())
+
+	i := channels.write(0, header[:])
+	i = channels.write(i, data)
+	channels.write(i, crcBytes[:])
+
+	if err := png.Encode(w, canvas); err != nil {
+		return fmt.Errorf("PNG encode error: %w", err)
+	}
+	return nil
+}
+
+// FindPNGPixelPayload decodes a PNG image and returns the data hidden in the low-order bits
+// of its pixels. As with FindPNGPayload, a CRC mismatch is reported in the result rather
+// than as an error.
+func FindPNGPixelPayload(r io.Reader) (PNGPayload, error) {
+	img, err := png.Decode(r)
+	if err != nil {
+		return PNGPayload{}, fmt.Errorf("failed to decode PNG image: %w", err)
+	}
+	channels, err := newLSBChannels(img)
+	if err != nil {
+		return PNGPayload{}, err
+	}
+	if channels.count*lsbBitsPerChannel < lsbOverhead*8 {
+		return PNGPayload{}, fmt.Errorf("PNG image is too small to hold hidden data")
+	}
+
+	header, i := channels.read(0, 8)
+	if string(header[4:]) != "rAWd" {
+		return PNGPayload{}, fmt.Errorf("no data hidden in the PNG pixels")
+	}
+	length := int64(binary.BigEndian.Uint32(header[:4]))
+	if capacity := int64(channels.count*lsbBitsPerChannel/8 - lsbOverhead); length > capacity {
+		return PNGPayload{}, fmt.Errorf("hidden data length %d exceeds the %d bytes the PNG pixels can hold", length, capacity)
+	}
+
+	data, i := channels.read(i, int(length))
+	stored, _ := channels.read(i, 4)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	return PNGPayload{
+		Data:        data,
+		StoredCRC:   binary.BigEndian.Uint32(stored),
+		ComputedCRC: crc.Sum32(),
+	}, nil
+}
+
+// ExtractDataFromPNGPixels extracts data hidden in the low-order bits of a PNG's pixels,
+// verifying its CRC
+func ExtractDataFromPNGPixels(r io.Reader) ([]byte, error) {
+	p, err := FindPNGPixelPayload(r)
+	if err != nil {
+		return nil, err
+	}
+	if !p.CRCValid() {
+		return nil, fmt.Errorf("CRC mismatch in data hidden in PNG pixels: expected 0x%08x, calculated 0x%08x: %w", p.StoredCRC, p.ComputedCRC, ErrChecksumMismatch)
+	}
+	return p.Data, nil
+}
+
+// ExtractPNGChunkData extracts the chunk data from a PNG chunk file that was written with
+// the given embedding. If the embedding isn't known, the file is searched for a 'rAWd'
+// chunk first, and then for data hidden in its pixels.
+func ExtractPNGChunkData(r io.Reader, embedding PNGEmbedding) ([]byte, error) {
+	switch embedding {
+	case PNGEmbedLSB:
+		return ExtractDataFromPNGPixels(r)
+	case PNGEmbedChunk:
+		return ExtractDataFromPNG(r)
+	}
+
+	// A file can be read again from the start, so only pixel-embedded files are read twice
+	if rs, ok := r.(io.ReadSeeker); ok {
+		data, err := ExtractDataFromPNG(rs)
+		if !errors.Is(err, ErrPNGDataNotFound) {
+			return data, err
+		}
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("rewind PNG data: %w", err)
+		}
+		return ExtractDataFromPNGPixels(rs)
+	}
+
+	all, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read PNG data: %w", err)
+	}
+	if findPNGChunk(all, "rAWd") >= 0 {
+		return ExtractDataFromPNG(bytes.NewReader(all))
+	}
+	return ExtractDataFromPNGPixels(bytes.NewReader(all))
+}
@@ -0,0 +1,157 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPNGPixelRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, 1000, 30001} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i * 31)
+		}
+
+		var buf bytes.Buffer
+		if err := writePNGChunk(&buf, nil, PNGEmbedLSB, data); err != nil {
+			t.Fatalf("writePNGChunk(%d bytes) failed: %v", size, err)
+		}
+		if findPNGChunk(buf.Bytes(), "rAWd") >= 0 {
+			t.Errorf("Pixel-embedded PNG unexpectedly has a rAWd chunk")
+		}
+
+		got, err := ExtractDataFromPNGPixels(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("ExtractDataFromPNGPixels(%d bytes) failed: %v", size, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Extracted %d bytes do not match the original", size)
+		}
+
+		// Auto-detection finds the data in the pixels too
+		got, err = ExtractPNGChunkData(bytes.NewReader(buf.Bytes()), "")
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("ExtractPNGChunkData did not find the data in the pixels: %v", err)
+		}
+	}
+}
+
+func TestPNGPixelCoverPhotos(t *testing.T) {
+	dir, err := os.MkdirTemp("", "padlock-lsb-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A paletted photo, whose pixels must be converted before they can hold data
+	palette := color.Palette{color.Black, color.White, color.RGBA{200, 30, 30, 255}}
+	photo := image.NewPaletted(image.Rect(0, 0, 40, 30), palette)
+	for i := range photo.Pix {
+		photo.Pix[i] = uint8(i % len(palette))
+	}
+	f, err := os.Create(filepath.Join(dir, "photo.png"))
+	if err != nil {
+		t.Fatalf("Failed to create photo: %v", err)
+	}
+	if err := png.Encode(f, photo); err != nil {
+		t.Fatalf("Failed to encode photo: %v", err)
+	}
+	f.Close()
+
+	covers, err := LoadCoverImages(dir)
+	if err != nil {
+		t.Fatalf("LoadCoverImages failed: %v", err)
+	}
+
+	// 1200 pixels hold 900 bytes, less the length, type, and CRC
+	data := bytes.Repeat([]byte{0xA5}, 888)
+	var buf bytes.Buffer
+	if err := writePNGChunk(&buf, covers, PNGEmbedLSB, data); err != nil {
+		t.Fatalf("writePNGChunk failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Chunk is not a readable PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 40 || b.Dy() != 30 {
+		t.Errorf("Chunk image is %dx%d, want the photo's 40x30", b.Dx(), b.Dy())
+	}
+	got, err := ExtractPNGChunkData(bytes.NewReader(buf.Bytes()), PNGEmbedLSB)
+	if err != nil {
+		t.Fatalf("ExtractPNGChunkData failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Extracted data does not match the original")
+	}
+
+	// One more byte doesn't fit
+	buf.Reset()
+	err = writePNGChunk(&buf, covers, PNGEmbedLSB, append(data, 0))
+	if err == nil || !strings.Contains(err.Error(), "can hide 888 bytes") {
+		t.Errorf("Expected the photo to be too small, got %v", err)
+	}
+}
+
+func TestPNGPixelDetectsCorruption(t *testing.T) {
+	data := bytes.Repeat([]byte("padlock"), 100)
+	img := generateCoverImage(lsbPixelsNeeded(len(data)), rand.New(rand.NewPCG(1, 2)))
+	var buf bytes.Buffer
+	if err := encodePNGWithPixelData(&buf, img, data); err != nil {
+		t.Fatalf("encodePNGWithPixelData failed: %v", err)
+	}
+
+	// Flip the hidden bits of a color value in the middle of the data
+	decoded, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	channels, err := newLSBChannels(decoded)
+	if err != nil {
+		t.Fatalf("newLSBChannels failed: %v", err)
+	}
+	channels.pix[channels.offset(400)] ^= 0x03
+	buf.Reset()
+	if err := png.Encode(&buf, decoded); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+
+	if _, err := ExtractDataFromPNGPixels(bytes.NewReader(buf.Bytes())); err == nil || !strings.Contains(err.Error(), "CRC mismatch") {
+		t.Errorf("Expected a CRC mismatch, got %v", err)
+	}
+	p, err := FindPNGPixelPayload(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("FindPNGPixelPayload failed: %v", err)
+	}
+	if p.CRCValid() {
+		t.Errorf("Expected CRCValid to report the corruption")
+	}
+
+	// An ordinary image has nothing hidden in it
+	buf.Reset()
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	if _, err := ExtractPNGChunkData(bytes.NewReader(buf.Bytes()), ""); err == nil {
+		t.Errorf("Expected no data to be found in an ordinary image")
+	}
+}
+
+func TestParsePNGEmbedding(t *testing.T) {
+	for in, want := range map[string]PNGEmbedding{"chunk": PNGEmbedChunk, "LSB": PNGEmbedLSB, " lsb ": PNGEmbedLSB} {
+		if got, err := ParsePNGEmbedding(in); err != nil || got != want {
+			t.Errorf("ParsePNGEmbedding(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParsePNGEmbedding("exif"); err == nil {
+		t.Errorf("Expected an error for an unknown embedding")
+	}
+}
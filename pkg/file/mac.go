@@ -0,0 +1,195 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/blues/padlock/pkg/trace"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ChunkMACFileName is the name of the file, stored alongside the chunks of a collection like
+// its metadata, that authenticates every chunk with an HMAC-SHA256. CRCs, checksum sidecars,
+// and PAR2 files detect accidental damage, but anyone can recompute them after modifying a
+// chunk; a MAC can only be computed with the key.
+//
+// The MAC key is derived from a passphrase with scrypt and a random salt stored in the file,
+// so each collection has its own key. Each chunk's MAC covers its position in the collection
+// as well as its data, and the file carries a MAC of the whole list, so chunks can't be
+// swapped between collections, reordered, dropped from the end, or added without detection.
+const ChunkMACFileName = "padlock.mac"
+
+// chunkMACVersion is the version of the chunk MAC file layout written by this package
+const chunkMACVersion = 1
+
+// ChunkMACs holds the MAC of every chunk of a collection
+type ChunkMACs struct {
+	Version int      `json:"version"`
+	Salt    string   `json:"salt"`   // Base64 scrypt salt from which the MAC key is derived
+	Chunks  []string `json:"chunks"` // Hex MAC of each chunk, in chunk order
+	HMAC    string   `json:"hmac"`   // Hex MAC of the chunk count and every chunk MAC
+
+	key []byte
+	mu  sync.Mutex
+}
+
+// NewChunkMACs returns an empty set of chunk MACs for a collection, with a new salt and a
+// key derived from passphrase
+func NewChunkMACs(passphrase []byte) (*ChunkMACs, error) {
+	salt := make([]byte, sealSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	m := &ChunkMACs{Version: chunkMACVersion, Salt: base64.StdEncoding.EncodeToString(salt)}
+	if err := m.deriveKey(passphrase); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// deriveKey derives the MAC key from the passphrase and the salt
+func (m *ChunkMACs) deriveKey(passphrase []byte) error {
+	salt, err := base64.StdEncoding.DecodeString(m.Salt)
+	if err != nil || len(salt) != sealSaltSize {
+		return fmt.Errorf("malformed chunk MAC salt")
+	}
+	m.key, err = scrypt.Key(passphrase, salt, sealScryptN, sealScryptR, sealScryptP, 32)
+	if err != nil {
+		return fmt.Errorf("failed to derive chunk MAC key: %w", err)
+	}
+	return nil
+}
+
+// NewHash returns the hash that computes the MAC of chunk number chunkNum (from 1) as the
+// chunk's data is written to it
+func (m *ChunkMACs) NewHash(chunkNum int) hash.Hash {
+	h := hmac.New(sha256.New, m.key)
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(chunkNum)))
+	return h
+}
+
+// Set records the MAC of chunk number chunkNum, computed with a hash from NewHash
+func (m *ChunkMACs) Set(chunkNum int, h hash.Hash) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for len(m.Chunks) < chunkNum {
+		m.Chunks = append(m.Chunks, "")
+	}
+	m.Chunks[chunkNum-1] = hex.EncodeToString(h.Sum(nil))
+}
+
+// Len returns the number of chunks the MACs cover
+func (m *ChunkMACs) Len() int {
+	return len(m.Chunks)
+}
+
+// Verify checks the data of chunk number chunkNum against its MAC
+func (m *ChunkMACs) Verify(chunkNum int, data []byte) error {
+	if chunkNum < 1 || chunkNum > len(m.Chunks) {
+		return fmt.Errorf("chunk %d is not authenticated: the collection has MACs for %d chunks: %w", chunkNum, len(m.Chunks), ErrChecksumMismatch)
+	}
+	h := m.NewHash(chunkNum)
+	h.Write(data)
+	want, err := hex.DecodeString(m.Chunks[chunkNum-1])
+	if err != nil || !hmac.Equal(h.Sum(nil), want) {
+		return fmt.Errorf("chunk %d failed authentication: it was modified or the MAC key is wrong: %w", chunkNum, ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// listHMAC returns the MAC of the chunk count and every chunk MAC
+func (m *ChunkMACs) listHMAC() string {
+	h := hmac.New(sha256.New, m.key)
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(m.Chunks))))
+	for _, mac := range m.Chunks {
+		h.Write([]byte(mac))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Marshal signs the list of chunk MACs and encodes it as indented JSON
+func (m *ChunkMACs) Marshal() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, mac := range m.Chunks {
+		if mac == "" {
+			return nil, fmt.Errorf("chunk %d has no MAC", i+1)
+		}
+	}
+	m.HMAC = m.listHMAC()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode chunk MACs: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// WriteChunkMACs writes the chunk MAC file into a collection directory
+func WriteChunkMACs(ctx context.Context, collPath string, m *ChunkMACs) error {
+	log := trace.FromContext(ctx).WithPrefix("MAC")
+
+	data, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	macPath := filepath.Join(collPath, ChunkMACFileName)
+	if err := os.WriteFile(macPath, data, 0644); err != nil {
+		log.Error(fmt.Errorf("failed to write chunk MACs %s: %w", macPath, err))
+		return fmt.Errorf("failed to write chunk MACs %s: %w", macPath, err)
+	}
+
+	log.Debugf("Wrote MACs of %d chunks to %s", m.Len(), macPath)
+	return nil
+}
+
+// ReadChunkMACs reads the chunk MAC file of a directory, TAR, ZIP, or volume-split collection,
+// derives its key from passphrase, and checks the MAC of the list. A collection without the
+// file returns an error satisfying errors.Is(err, os.ErrNotExist); a list that was modified,
+// or a wrong passphrase, one satisfying errors.Is(err, ErrChecksumMismatch).
+func ReadChunkMACs(ctx context.Context, coll Collection, passphrase []byte) (*ChunkMACs, error) {
+	log := trace.FromContext(ctx).WithPrefix("MAC")
+
+	var data []byte
+	var err error
+	if len(coll.Volumes) > 0 {
+		// The chunk MACs are written at the end, so they are in the last volume
+		data, err = readArchiveEntry(coll.Volumes[len(coll.Volumes)-1], ChunkMACFileName)
+	} else if IsArchivePath(coll.Path) {
+		data, err = readArchiveEntry(coll.Path, ChunkMACFileName)
+	} else {
+		data, err = os.ReadFile(filepath.Join(coll.Path, ChunkMACFileName))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("chunk MACs for collection %s: %w", coll.Name, err)
+	}
+
+	m := &ChunkMACs{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("collection %s: failed to parse chunk MACs: %w", coll.Name, err)
+	}
+	if m.Version != chunkMACVersion {
+		return nil, fmt.Errorf("collection %s: unsupported chunk MAC version %d", coll.Name, m.Version)
+	}
+	if err := m.deriveKey(passphrase); err != nil {
+		return nil, fmt.Errorf("collection %s: %w", coll.Name, err)
+	}
+	if !hmac.Equal([]byte(m.listHMAC()), []byte(m.HMAC)) {
+		return nil, fmt.Errorf("collection %s: chunk MACs were modified or the MAC key is wrong: %w", coll.Name, ErrChecksumMismatch)
+	}
+
+	log.Debugf("Read MACs of %d chunks for collection %s", m.Len(), coll.Name)
+	return m, nil
+}
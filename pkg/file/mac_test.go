@@ -0,0 +1,83 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestChunkMACs writes chunk MACs for a collection directory and checks that reading them back
+// authenticates the chunks, and rejects a wrong key, a modified list, and modified chunks
+func TestChunkMACs(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	collPath := filepath.Join(t.TempDir(), "2A3")
+	if err := os.MkdirAll(collPath, 0755); err != nil {
+		t.Fatalf("Failed to create collection directory: %v", err)
+	}
+	passphrase := []byte("correct horse battery staple")
+	chunks := [][]byte{[]byte("first chunk"), []byte("second chunk")}
+
+	m, err := NewChunkMACs(passphrase)
+	if err != nil {
+		t.Fatalf("NewChunkMACs failed: %v", err)
+	}
+	// Chunks may be completed out of order
+	for i := len(chunks) - 1; i >= 0; i-- {
+		h := m.NewHash(i + 1)
+		h.Write(chunks[i])
+		m.Set(i+1, h)
+	}
+	if err := WriteChunkMACs(ctx, collPath, m); err != nil {
+		t.Fatalf("WriteChunkMACs failed: %v", err)
+	}
+
+	coll := Collection{Name: "2A3", Path: collPath}
+	read, err := ReadChunkMACs(ctx, coll, passphrase)
+	if err != nil {
+		t.Fatalf("ReadChunkMACs failed: %v", err)
+	}
+	if read.Len() != 2 {
+		t.Errorf("Expected MACs for 2 chunks, got %d", read.Len())
+	}
+	for i, chunk := range chunks {
+		if err := read.Verify(i+1, chunk); err != nil {
+			t.Errorf("Chunk %d failed authentication: %v", i+1, err)
+		}
+	}
+	if err := read.Verify(1, []byte("first chunK")); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected a modified chunk to fail, got %v", err)
+	}
+	if err := read.Verify(2, chunks[0]); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected a chunk in the wrong position to fail, got %v", err)
+	}
+	if err := read.Verify(3, chunks[0]); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected an added chunk to fail, got %v", err)
+	}
+
+	if _, err := ReadChunkMACs(ctx, coll, []byte("wrong")); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected a wrong key to fail, got %v", err)
+	}
+
+	// Dropping the last chunk's MAC from the list, without the key to sign it again, is detected
+	var list map[string]any
+	macPath := filepath.Join(collPath, ChunkMACFileName)
+	data, _ := os.ReadFile(macPath)
+	json.Unmarshal(data, &list)
+	list["chunks"] = list["chunks"].([]any)[:1]
+	data, _ = json.Marshal(list)
+	os.WriteFile(macPath, data, 0644)
+	if _, err := ReadChunkMACs(ctx, coll, passphrase); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected a modified list to fail, got %v", err)
+	}
+
+	if _, err := ReadChunkMACs(ctx, Collection{Name: "2B3", Path: t.TempDir()}, passphrase); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist without chunk MACs, got %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// MetadataFileName is the name of the metadata file stored alongside the chunks of a
+// collection, either in the collection directory or as an entry in the collection TAR.
+// It is ignored by chunk readers, so collections without it decode exactly as before.
+const MetadataFileName = "padlock.json"
+
+// RecoveryFileName is the name of the recovery notes an encode may store alongside the chunks
+// of a collection, telling whoever holds it what it is and how to restore the data. Its name
+// ends in .txt like a text chunk's, but chunk readers never take it for one.
+const RecoveryFileName = "RECOVERY.txt"
+
+// MetadataVersion is the version of the metadata layout written by this package.
+const MetadataVersion = 1
+
+// CollectionFormatVersion is the version of the collection format written by this package:
+// how chunks are named, framed, and stored, and how the stream they carry is laid out. It is
+// recorded in the metadata of every collection as FormatVersion, and bumped whenever a change
+// would keep an older padlock from reading the collection correctly. Collections written
+// before it was recorded have a FormatVersion of 0, and are the same as version 1.
+const CollectionFormatVersion = 1
+
+// ErrNewerFormat is returned when a collection file has a version newer than this package
+// reads, because a newer padlock wrote it.
+var ErrNewerFormat = errors.New("upgrade padlock to read it")
+
+// Custodian identifies the person or organization designated to hold one collection.
+type Custodian struct {
+	Collection string `json:"collection"`        // Collection held by this custodian
+	Name       string `json:"name"`              // Custodian name
+	Contact    string `json:"contact,omitempty"` // How to reach the custodian (email, phone, ...)
+}
+
+// String formats a custodian as "Name <contact>", or just the name if there is no contact.
+func (c Custodian) String() string {
+	if c.Contact == "" {
+		return c.Name
+	}
+	return fmt.Sprintf("%s <%s>", c.Name, c.Contact)
+}
+
+// ParseCustodian parses a custodian given as "Name" or "Name <contact>".
+func ParseCustodian(s string) (Custodian, error) {
+	s = strings.TrimSpace(s)
+	var c Custodian
+	if open := strings.LastIndex(s, "<"); open >= 0 && strings.HasSuffix(s, ">") {
+		c.Name = strings.TrimSpace(s[:open])
+		c.Contact = strings.TrimSpace(s[open+1 : len(s)-1])
+	} else {
+		c.Name = s
+	}
+	if c.Name == "" {
+		return c, fmt.Errorf("custodian %q has no name", s)
+	}
+	return c, nil
+}
+
+// Metadata is the descriptive information recorded with every collection at encode time.
+//
+// Metadata never contains share data or key material. It describes the distribution the
+// collection belongs to so that a holder can tell what they have and who else to contact.
+type Metadata struct {
+	Version          int            `json:"version"`
+	FormatVersion    int            `json:"format_version,omitempty"` // CollectionFormatVersion of the padlock that wrote the collection
+	Collection       string         `json:"collection,omitempty"`
+	Copies           int            `json:"copies,omitempty"`
+	Required         int            `json:"required,omitempty"`
+	Format           Format         `json:"format,omitempty"`
+	Compression      string         `json:"compression,omitempty"`       // Compression of the encoded data: "gzip", "zstd", or "none"
+	CompressionLevel int            `json:"compression_level,omitempty"` // Compression level, if known
+	CompressionAuto  bool           `json:"compression_auto,omitempty"`  // Compression was chosen by sampling the input
+	ChunkSize        int            `json:"chunk_size,omitempty"`        // Maximum size of each chunk in bytes
+	ChunkSizeAuto    bool           `json:"chunk_size_auto,omitempty"`   // Chunk size was chosen from the size of the input
+	Chunks           int            `json:"chunks,omitempty"`            // Number of chunks in the collection, recorded once the encode finishes
+	Sharing          string         `json:"sharing,omitempty"`           // Secret sharing scheme, if not the one-time pad scheme
+	Session          string         `json:"session,omitempty"`           // Random identifier shared by the collections of one encode
+	PayloadSHA256    string         `json:"payload_sha256,omitempty"`    // SHA-256 of the serialized and compressed stream the chunks encode, recorded only in sealed metadata
+	Stream           string         `json:"stream,omitempty"`            // Name of the file a stream encoded as it is, such as stdin, restores to; empty if the payload is a TAR of the input
+	Index            *IndexLocation `json:"index,omitempty"`             // Where the chunk index is in the stream, if it was written with one
+	Dedup            bool           `json:"dedup,omitempty"`             // The serialized input was deduplicated before it was compressed, see DedupStream
+	Segments         []Segment      `json:"segments,omitempty"`          // Data appended by later encodes, as chunks numbered on from the first payload's
+	Envelope         *Envelope      `json:"envelope,omitempty"`          // How the stream was encrypted before it was split, if it was
+	Created          time.Time      `json:"created,omitzero"`
+	ReviewBy         time.Time      `json:"review_by,omitzero"`      // Date by which the shares should be checked or re-encoded
+	Custodians       []Custodian    `json:"custodians,omitempty"`    // Custodian plan for the whole distribution
+	Label            string         `json:"label,omitempty"`         // Label given to this collection at encode time
+	Notes            string         `json:"notes,omitempty"`         // Notes about this collection, such as who holds it and where
+	StoredName       string         `json:"stored_name,omitempty"`   // Stealth name the collection is stored under, if any
+	PNGEmbedding     PNGEmbedding   `json:"png_embedding,omitempty"` // How chunk data is hidden in PNG chunks, if not in a custom chunk
+	Sealed           string         `json:"sealed,omitempty"`        // Encrypted metadata, see SealMetadata
+}
+
+// Segment is data appended to a collection by a later encode: a payload of its own, encoded
+// as further chunks numbered on from the last chunk the collection already held. The other
+// fields of the metadata describe the first payload, which ends at the first segment's first
+// chunk; Chunks counts the chunks of every payload.
+type Segment struct {
+	FirstChunk       int       `json:"first_chunk"`                 // First chunk of the segment
+	Chunks           int       `json:"chunks"`                      // Number of chunks in the segment
+	PayloadSHA256    string    `json:"payload_sha256,omitempty"`    // SHA-256 of the serialized and compressed stream the chunks encode, if the metadata is sealed
+	Compression      string    `json:"compression,omitempty"`       // Compression of the appended data
+	CompressionLevel int       `json:"compression_level,omitempty"` // Compression level, if known
+	CompressionAuto  bool      `json:"compression_auto,omitempty"`  // Compression was chosen by sampling the input
+	Appended         time.Time `json:"appended,omitzero"`           // When the segment was appended
+}
+
+// NewSession returns a random identifier for the collections of a new encode, formatted as
+// a version 4 UUID
+func NewSession() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session identifier: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// PastReview reports whether the metadata has a review-by date that is before now.
+func (md *Metadata) PastReview(now time.Time) bool {
+	return !md.ReviewBy.IsZero() && now.After(md.ReviewBy)
+}
+
+// Custodian returns the custodian designated for this metadata's own collection, if any.
+func (md *Metadata) Custodian() (Custodian, bool) {
+	for _, c := range md.Custodians {
+		if c.Collection == md.Collection {
+			return c, true
+		}
+	}
+	return Custodian{}, false
+}
+
+// MarshalMetadata encodes metadata as indented JSON
+func MarshalMetadata(md *Metadata) ([]byte, error) {
+	data, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// UnmarshalMetadata decodes metadata previously produced by MarshalMetadata
+func UnmarshalMetadata(data []byte) (*Metadata, error) {
+	var md Metadata
+	if err := json.Unmarshal(data, &md); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+	if md.Version > MetadataVersion {
+		return nil, fmt.Errorf("metadata version %d, but this padlock reads up to version %d: %w", md.Version, MetadataVersion, ErrNewerFormat)
+	}
+	return &md, nil
+}
+
+// WriteMetadata writes the metadata file into a collection directory
+func WriteMetadata(ctx context.Context, collPath string, md *Metadata) error {
+	log := trace.FromContext(ctx).WithPrefix("METADATA")
+
+	data, err := MarshalMetadata(md)
+	if err != nil {
+		return err
+	}
+
+	metaPath := filepath.Join(collPath, MetadataFileName)
+	if err := os.WriteFile(metaPath, data, 0644); err != nil {
+		log.Error(fmt.Errorf("failed to write metadata %s: %w", metaPath, err))
+		return fmt.Errorf("failed to write metadata %s: %w", metaPath, err)
+	}
+
+	log.Debugf("Wrote metadata for collection %s to %s", md.Collection, metaPath)
+	return nil
+}
+
+// ReadMetadata reads the metadata of a directory, TAR, ZIP, or volume-split collection,
+// decrypting it with key if it was sealed. An archive gets its metadata as its first entry,
+// before any chunks, and again with the payload hash as its last; the last one is read. If the collection has no metadata file the returned
+// error satisfies errors.Is(err, os.ErrNotExist); if it is sealed and no key is given,
+// ErrMetadataSealed.
+func ReadMetadata(ctx context.Context, coll Collection, key []byte) (*Metadata, error) {
+	log := trace.FromContext(ctx).WithPrefix("METADATA")
+
+	var data []byte
+	var err error
+	if len(coll.Volumes) > 0 {
+		// The metadata is in the first volume, and again with the payload hash in the last
+		for _, volume := range coll.Volumes {
+			if found, volumeErr := readArchiveEntry(volume, MetadataFileName); volumeErr == nil {
+				data, err = found, nil
+			} else if data == nil {
+				err = volumeErr
+			}
+		}
+	} else if IsArchivePath(coll.Path) {
+		data, err = readArchiveEntry(coll.Path, MetadataFileName)
+	} else {
+		data, err = os.ReadFile(filepath.Join(coll.Path, MetadataFileName))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("metadata for collection %s: %w", coll.Name, err)
+	}
+
+	md, err := UnmarshalMetadata(data)
+	if err != nil {
+		log.Error(fmt.Errorf("collection %s: %w", coll.Name, err))
+		return nil, fmt.Errorf("collection %s: %w", coll.Name, err)
+	}
+	md, err = OpenMetadata(md, key)
+	if err != nil {
+		return nil, fmt.Errorf("collection %s: %w", coll.Name, err)
+	}
+	return md, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestParseCustodian(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Custodian
+		wantErr bool
+	}{
+		{"Alice", Custodian{Name: "Alice"}, false},
+		{"Alice Smith <alice@example.com>", Custodian{Name: "Alice Smith", Contact: "alice@example.com"}, false},
+		{"  Bob <+1 555 0100> ", Custodian{Name: "Bob", Contact: "+1 555 0100"}, false},
+		{"<nobody@example.com>", Custodian{}, true},
+		{"", Custodian{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCustodian(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCustodian(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseCustodian(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	tempDir, err := os.MkdirTemp("", "metadata-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	md := &Metadata{
+		Version:    MetadataVersion,
+		Collection: "2B3",
+		Copies:     3,
+		Required:   2,
+		Format:     FormatBin,
+		Created:    time.Now().UTC().Truncate(time.Second),
+		Custodians: []Custodian{
+			{Collection: "2A3", Name: "Alice"},
+			{Collection: "2B3", Name: "Bob", Contact: "bob@example.com"},
+		},
+	}
+
+	// Directory collection
+	collDir := filepath.Join(tempDir, "2B3")
+	if err := os.MkdirAll(collDir, 0755); err != nil {
+		t.Fatalf("Failed to create collection dir: %v", err)
+	}
+	if err := WriteMetadata(ctx, collDir, md); err != nil {
+		t.Fatalf("WriteMetadata failed: %v", err)
+	}
+	got, err := ReadMetadata(ctx, Collection{Name: "2B3", Path: collDir, Format: FormatBin}, nil)
+	if err != nil {
+		t.Fatalf("ReadMetadata failed: %v", err)
+	}
+	if got.Required != 2 || got.Copies != 3 || !got.Created.Equal(md.Created) {
+		t.Errorf("Metadata mismatch: got %+v, want %+v", got, md)
+	}
+	if c, ok := got.Custodian(); !ok || c.Name != "Bob" {
+		t.Errorf("Expected own custodian Bob, got %+v (found=%v)", c, ok)
+	}
+
+	// TAR collection
+	data, err := MarshalMetadata(md)
+	if err != nil {
+		t.Fatalf("MarshalMetadata failed: %v", err)
+	}
+	tarPath := filepath.Join(tempDir, "2B3.tar")
+	tw, err := NewTarWriterRegistry().TarChunkWriter(ctx, tarPath, "2B3", FormatBin)
+	if err != nil {
+		t.Fatalf("TarChunkWriter failed: %v", err)
+	}
+	if err := tw.AddFile(MetadataFileName, data); err != nil {
+		t.Fatalf("AddFile failed: %v", err)
+	}
+	if err := tw.FinalizeTar(); err != nil {
+		t.Fatalf("FinalizeTar failed: %v", err)
+	}
+	got, err = ReadMetadata(ctx, Collection{Name: "2B3", Path: tarPath, Format: FormatBin}, nil)
+	if err != nil {
+		t.Fatalf("ReadMetadata from TAR failed: %v", err)
+	}
+	if len(got.Custodians) != 2 {
+		t.Errorf("Expected 2 custodians from TAR metadata, got %d", len(got.Custodians))
+	}
+
+	// Missing metadata
+	emptyDir := filepath.Join(tempDir, "2C3")
+	if err := os.MkdirAll(emptyDir, 0755); err != nil {
+		t.Fatalf("Failed to create collection dir: %v", err)
+	}
+	if _, err := ReadMetadata(ctx, Collection{Name: "2C3", Path: emptyDir}, nil); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist for missing metadata, got %v", err)
+	}
+}
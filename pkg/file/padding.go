@@ -0,0 +1,232 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// A padded stream hides the size of the data it carries by ending with random padding up to
+// a size chosen once the data's size is known. Since the stream is encoded as it is read,
+// the data can't be preceded by its length; instead it is cut into records, each preceded
+// by its length, and ended by an empty record that holds the total length, after which
+// everything is padding. The true length is only recorded inside the stream, so only
+// someone who can decode the collections can learn it.
+//
+// Stream layout:
+//
+//	magic     8 bytes  paddingMagic
+//	records            4-byte big-endian length, then that many bytes of data, repeated
+//	end       4 bytes  Zero, marking the end of the data
+//	length    8 bytes  Total length of the data, big-endian
+//	padding            Random bytes up to the padded size
+//
+// Like the passphrase magic, the magic starts with a NUL byte, so a padded stream is never
+// mistaken for a TAR, gzip, or zstd stream.
+const paddingMagic = "\x00PLKPADS"
+
+// paddingRecordSize is the largest record a padded stream is written with
+const paddingRecordSize = 64 * 1024
+
+// PaddedSize returns the size of the padded stream of dataSize bytes before its padding,
+// which is the smallest size it can be padded to
+func PaddedSize(dataSize int64) int64 {
+	records := (dataSize + paddingRecordSize - 1) / paddingRecordSize
+	return int64(len(paddingMagic)) + 4*records + dataSize + 4 + 8
+}
+
+// IsPaddedStream reports whether data starts like a padded stream
+func IsPaddedStream(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(paddingMagic))
+}
+
+// PadStream returns a reader that yields r as a padded stream. Once r ends, target is called
+// with the size of the stream so far, PaddedSize of r's length, and returns the size to pad
+// it to, which can't be smaller.
+func PadStream(ctx context.Context, r io.Reader, target func(size int64) (int64, error)) io.Reader {
+	return PadStreamHiding(ctx, r, target, nil)
+}
+
+// PadStreamHiding is PadStream with the hidden volume, if not nil, at the start of the
+// padding. The size passed to target includes the hidden volume.
+func PadStreamHiding(ctx context.Context, r io.Reader, target func(size int64) (int64, error), hidden *HiddenVolume) io.Reader {
+	pr := &padReader{ctx: ctx, r: r, target: target, hidden: hidden, written: int64(len(paddingMagic))}
+	pr.out.WriteString(paddingMagic)
+	return pr
+}
+
+// padReader cuts a stream into records and pads it
+type padReader struct {
+	ctx       context.Context
+	r         io.Reader
+	target    func(int64) (int64, error)
+	out       bytes.Buffer
+	length    int64 // Bytes of data read from r
+	written   int64 // Bytes of the padded stream produced so far, padding aside
+	remaining int64 // Bytes of padding still to produce, once r has ended
+	ended     bool
+	hidden    *HiddenVolume // Hidden volume at the start of the padding, if any
+	fill      io.Reader     // What remains of the hidden volume, once the padding has started
+}
+
+func (pr *padReader) Read(p []byte) (int, error) {
+	for pr.out.Len() == 0 {
+		if pr.ended {
+			return pr.readPadding(p)
+		}
+		if err := pr.next(); err != nil {
+			return 0, err
+		}
+	}
+	return pr.out.Read(p)
+}
+
+// next reads the next record from r, or ends the data if r has ended
+func (pr *padReader) next() error {
+	buf := make([]byte, paddingRecordSize)
+	n, err := io.ReadFull(pr.r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	if n > 0 {
+		pr.out.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+		pr.out.Write(buf[:n])
+		pr.length += int64(n)
+		pr.written += 4 + int64(n)
+		if err == nil {
+			return nil
+		}
+	}
+
+	// The data has ended: record its length, and work out how much padding follows
+	pr.out.Write(binary.BigEndian.AppendUint32(nil, 0))
+	pr.out.Write(binary.BigEndian.AppendUint64(nil, uint64(pr.length)))
+	pr.written += 4 + 8
+	needed := pr.written
+	if pr.hidden != nil {
+		if pr.fill, err = pr.hidden.spool.Reader(); err != nil {
+			return err
+		}
+		needed += pr.hidden.Size()
+	}
+	size, err := pr.target(needed)
+	if err != nil {
+		return err
+	}
+	if size < needed {
+		return fmt.Errorf("the data needs %d bytes, more than the %d it is to be padded to", needed, size)
+	}
+	pr.remaining = size - pr.written
+	pr.ended = true
+	trace.FromContext(pr.ctx).WithPrefix("padding").Debugf("Padding %d bytes of data to %d bytes", pr.length, size)
+	return nil
+}
+
+// readPadding fills p with the hidden volume, if any, and then with random padding until
+// there is none left
+func (pr *padReader) readPadding(p []byte) (int, error) {
+	if pr.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > pr.remaining {
+		p = p[:pr.remaining]
+	}
+	if pr.fill != nil {
+		n, err := pr.fill.Read(p)
+		pr.remaining -= int64(n)
+		if err == io.EOF {
+			pr.fill = nil
+		} else if err != nil {
+			return n, fmt.Errorf("failed to read hidden volume: %w", err)
+		}
+		if n > 0 {
+			return n, nil
+		}
+		return pr.readPadding(p)
+	}
+	if _, err := rand.Read(p); err != nil {
+		return 0, fmt.Errorf("failed to generate padding: %w", err)
+	}
+	pr.remaining -= int64(len(p))
+	return len(p), nil
+}
+
+// UnpadStream returns a reader that yields the data of a padded stream, or r itself if it
+// isn't padded. Once the data has been read, the padding is read from r and discarded, so
+// that whatever writes r isn't left blocked.
+func UnpadStream(ctx context.Context, r io.Reader) (io.Reader, error) {
+	log := trace.FromContext(ctx).WithPrefix("padding")
+
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(paddingMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read from input stream: %w", err)
+	}
+	if !IsPaddedStream(magic) {
+		return br, nil
+	}
+	br.Discard(len(paddingMagic))
+	log.Debugf("Removing the padding of the stream")
+	return &unpadReader{r: br}, nil
+}
+
+// unpadReader reads the records of a padded stream
+type unpadReader struct {
+	r           *bufio.Reader
+	record      int   // Bytes left in the current record
+	length      int64 // Bytes of data read
+	done        bool
+	keepPadding bool // Leave the padding in r rather than discarding it
+}
+
+func (ur *unpadReader) Read(p []byte) (int, error) {
+	if ur.done {
+		return 0, io.EOF
+	}
+	for ur.record == 0 {
+		var header [4]byte
+		if _, err := io.ReadFull(ur.r, header[:]); err != nil {
+			return 0, fmt.Errorf("padded stream ended within its data: %w", io.ErrUnexpectedEOF)
+		}
+		ur.record = int(binary.BigEndian.Uint32(header[:]))
+		if ur.record == 0 {
+			return 0, ur.end()
+		}
+	}
+	if len(p) > ur.record {
+		p = p[:ur.record]
+	}
+	n, err := ur.r.Read(p)
+	ur.record -= n
+	ur.length += int64(n)
+	if err == io.EOF {
+		err = fmt.Errorf("padded stream ended within its data: %w", io.ErrUnexpectedEOF)
+	}
+	return n, err
+}
+
+// end checks the length recorded after the data, and discards the padding
+func (ur *unpadReader) end() error {
+	var length [8]byte
+	if _, err := io.ReadFull(ur.r, length[:]); err != nil {
+		return fmt.Errorf("padded stream ended within its data: %w", io.ErrUnexpectedEOF)
+	}
+	if recorded := int64(binary.BigEndian.Uint64(length[:])); recorded != ur.length {
+		return fmt.Errorf("padded stream holds %d bytes of data, but records %d", ur.length, recorded)
+	}
+	if !ur.keepPadding {
+		if _, err := io.Copy(io.Discard, ur.r); err != nil {
+			return err
+		}
+	}
+	ur.done = true
+	return io.EOF
+}
@@ -0,0 +1,66 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestPadStream(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	pad := func(data []byte, size int64) ([]byte, error) {
+		padded := PadStream(ctx, bytes.NewReader(data), func(n int64) (int64, error) {
+			if n != PaddedSize(int64(len(data))) {
+				t.Errorf("target called with %d for %d bytes of data, expected %d", n, len(data), PaddedSize(int64(len(data))))
+			}
+			return size, nil
+		})
+		return io.ReadAll(padded)
+	}
+	unpad := func(stream []byte) ([]byte, error) {
+		r, err := UnpadStream(ctx, bytes.NewReader(stream))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+
+	for _, size := range []int{0, 1, paddingRecordSize - 1, paddingRecordSize, 3*paddingRecordSize + 17} {
+		data := bytes.Repeat([]byte{'d'}, size)
+		target := PaddedSize(int64(size)) + 1000
+		padded, err := pad(data, target)
+		if err != nil || int64(len(padded)) != target || !IsPaddedStream(padded) {
+			t.Fatalf("size %d: padded to %d bytes, expected %d (%v)", size, len(padded), target, err)
+		}
+		if got, err := unpad(padded); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("size %d: unpadding did not reproduce the data (%v)", size, err)
+		}
+	}
+
+	// Data that needs more room than the target is an error
+	if _, err := pad(make([]byte, 100), 50); err == nil {
+		t.Errorf("Expected an error padding data to less than its size")
+	}
+
+	// Streams that aren't padded pass through
+	if got, err := unpad([]byte("plain")); err != nil || string(got) != "plain" {
+		t.Errorf("Expected an unpadded stream to pass through: %q, %v", got, err)
+	}
+
+	// A padded stream cut off within its data, or with the wrong recorded length, fails
+	padded, _ := pad([]byte("truncated data"), 200)
+	if _, err := unpad(padded[:20]); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected ErrUnexpectedEOF for a truncated stream, got %v", err)
+	}
+	padded[len(paddingMagic)+4+len("truncated data")+4+7]++
+	if _, err := unpad(padded); err == nil {
+		t.Errorf("Expected an error for a stream recording the wrong length")
+	}
+}
@@ -0,0 +1,587 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// Par2Ext is the extension of PAR2 recovery files. Each collection can have a set of standard
+// PAR 2.0 recovery files, "<collection>.par2" and "<collection>.volNN+MM.par2", covering the
+// files of the collection as stored, so that custodians can verify and repair media errors with
+// any PAR2 tool, such as par2cmdline or MultiPar, on machines without padlock.
+const Par2Ext = ".par2"
+
+// MaxPar2Percent is the largest PAR2 redundancy that can be asked for
+const MaxPar2Percent = 100
+
+const (
+	par2Magic        = "PAR2\x00PKT"
+	par2HeaderBytes  = 64        // Magic, length, packet MD5, recovery set ID, packet type
+	par2TargetSlices = 250       // Source slices a recovery set is divided into, roughly
+	par2MaxSlices    = 32768     // Source slices the PAR 2.0 specification allows
+	par2BatchBytes   = 64 << 20  // Recovery slices computed in one pass over the files, at most
+	par2Creator      = "padlock" // Written in the creator packet
+)
+
+// PAR 2.0 packet types
+var (
+	par2TypeMain     = par2Type("Main")
+	par2TypeFileDesc = par2Type("FileDesc")
+	par2TypeIFSC     = par2Type("IFSC")
+	par2TypeRecovery = par2Type("RecvSlic")
+	par2TypeCreator  = par2Type("Creator")
+)
+
+func par2Type(name string) [16]byte {
+	var t [16]byte
+	copy(t[:], "PAR 2.0\x00"+name)
+	return t
+}
+
+// par2Slice holds the checksums of one source slice, zero-padded to the slice size
+type par2Slice struct {
+	md5 [16]byte
+	crc uint32
+}
+
+// par2File is a file of a recovery set
+type par2File struct {
+	path    string // Where the file is on disk
+	name    string // Name recorded in the recovery files, relative to them
+	size    int64
+	id      [16]byte
+	hash    [16]byte // MD5 of the whole file
+	hash16k [16]byte // MD5 of the first 16KiB
+	slices  []par2Slice
+}
+
+// Par2Report is the result of checking files against their PAR2 recovery files
+type Par2Report struct {
+	IndexPath      string   // The "<collection>.par2" file the check started from
+	Files          int      // Files in the recovery set
+	Damaged        []string // Files that are missing or don't match their checksums
+	DamagedSlices  int      // Source slices that are missing or don't match their checksums
+	RecoverySlices int      // Intact recovery slices available to repair them
+}
+
+// Repairable reports whether a PAR2 tool can repair every damaged file
+func (r *Par2Report) Repairable() bool {
+	return r.DamagedSlices <= r.RecoverySlices
+}
+
+// Par2IndexPath returns the path of a collection's main PAR2 file: inside the collection
+// directory for individual chunk files, and next to the archive for archived collections
+func Par2IndexPath(coll Collection) string {
+	switch {
+	case len(coll.Volumes) > 0:
+		return strings.TrimSuffix(coll.Path, VolumeManifestSuffix) + Par2Ext
+	case IsArchivePath(coll.Path):
+		return strings.TrimSuffix(coll.Path, filepath.Ext(coll.Path)) + Par2Ext
+	default:
+		return filepath.Join(coll.Path, coll.DiskName()+Par2Ext)
+	}
+}
+
+// par2CoveredFiles returns the files of a collection that its PAR2 recovery files protect
+func par2CoveredFiles(coll Collection) ([]string, error) {
+	switch {
+	case len(coll.Volumes) > 0:
+		return append(slices.Clone(coll.Volumes), coll.Path), nil
+	case IsArchivePath(coll.Path):
+		return []string{coll.Path}, nil
+	}
+	entries, err := os.ReadDir(coll.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collection directory: %w", err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasSuffix(entry.Name(), Par2Ext) {
+			paths = append(paths, filepath.Join(coll.Path, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// WriteCollectionPar2 writes PAR2 recovery files with percent redundancy for a finished
+// collection, and returns the paths of the files written
+func WriteCollectionPar2(ctx context.Context, coll Collection, percent int) ([]string, error) {
+	paths, err := par2CoveredFiles(coll)
+	if err != nil {
+		return nil, err
+	}
+	return WritePar2(ctx, Par2IndexPath(coll), paths, percent)
+}
+
+// VerifyCollectionPar2 checks the files of a collection against its PAR2 recovery files.
+// It returns nil if the collection has none.
+func VerifyCollectionPar2(ctx context.Context, coll Collection) (*Par2Report, error) {
+	indexPath := Par2IndexPath(coll)
+	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return VerifyPar2(ctx, indexPath)
+}
+
+// WritePar2 writes a PAR 2.0 recovery set protecting paths, which must be in the directory of
+// indexPath or below it. indexPath holds the checksums of every file, and a single recovery
+// volume next to it holds the recovery slices, about percent of the size of the files, along
+// with copies of the checksums. Returns the paths of the files written.
+func WritePar2(ctx context.Context, indexPath string, paths []string, percent int) ([]string, error) {
+	log := trace.FromContext(ctx).WithPrefix("PAR2")
+
+	if percent < 1 || percent > MaxPar2Percent {
+		return nil, fmt.Errorf("PAR2 redundancy must be between 1%% and %d%%, got %d%%", MaxPar2Percent, percent)
+	}
+	// Choose a slice size that divides the files into about par2TargetSlices slices
+	// Empty files have no slices, so they aren't part of the recovery set
+	var files []*par2File
+	var total int64
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if info.Size() == 0 {
+			continue
+		}
+		name, err := filepath.Rel(filepath.Dir(indexPath), path)
+		if err != nil || strings.HasPrefix(name, "..") {
+			return nil, fmt.Errorf("%s is not below the directory of %s", path, indexPath)
+		}
+		files = append(files, &par2File{path: path, name: filepath.ToSlash(name), size: info.Size()})
+		total += info.Size()
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files to protect with %s", indexPath)
+	}
+	sliceSize := (max(total/par2TargetSlices, 4) + 3) &^ 3
+
+	// Hash the files, and sort them by file ID as the main packet lists them
+	sourceSlices := 0
+	for _, f := range files {
+		if err := f.hashFile(sliceSize); err != nil {
+			return nil, err
+		}
+		sourceSlices += len(f.slices)
+	}
+	if sourceSlices > par2MaxSlices {
+		return nil, fmt.Errorf("%d files are too many to protect with PAR2", len(files))
+	}
+	slices.SortFunc(files, func(a, b *par2File) int { return par2CompareIDs(a.id, b.id) })
+
+	// The main packet's body identifies the recovery set
+	var main bytes.Buffer
+	binary.Write(&main, binary.LittleEndian, uint64(sliceSize))
+	binary.Write(&main, binary.LittleEndian, uint32(len(files)))
+	for _, f := range files {
+		main.Write(f.id[:])
+	}
+	setID := md5.Sum(main.Bytes())
+
+	// The packets that describe the files go in every PAR2 file of the set
+	var critical bytes.Buffer
+	critical.Write(par2Packet(setID, par2TypeMain, main.Bytes()))
+	for _, f := range files {
+		critical.Write(par2Packet(setID, par2TypeFileDesc, f.descriptionBody()))
+		critical.Write(par2Packet(setID, par2TypeIFSC, f.checksumBody()))
+	}
+	critical.Write(par2Packet(setID, par2TypeCreator, par2Pad([]byte(par2Creator))))
+
+	if err := os.WriteFile(indexPath, critical.Bytes(), 0644); err != nil {
+		log.Error(fmt.Errorf("failed to write PAR2 file %s: %w", indexPath, err))
+		return nil, fmt.Errorf("failed to write PAR2 file %s: %w", indexPath, err)
+	}
+
+	recoverySlices := min(max(1, (sourceSlices*percent+99)/100), par2MaxSlices)
+	digits := len(fmt.Sprint(recoverySlices))
+	volumePath := fmt.Sprintf("%s.vol%0*d+%0*d%s", strings.TrimSuffix(indexPath, Par2Ext), digits, 0, digits, recoverySlices, Par2Ext)
+	if err := writePar2Volume(ctx, volumePath, setID, critical.Bytes(), files, sliceSize, recoverySlices); err != nil {
+		os.Remove(indexPath)
+		log.Error(fmt.Errorf("failed to write PAR2 file %s: %w", volumePath, err))
+		return nil, fmt.Errorf("failed to write PAR2 file %s: %w", volumePath, err)
+	}
+
+	log.Debugf("Wrote PAR2 recovery files %s: %d files, %d source slices of %d bytes, %d recovery slices",
+		indexPath, len(files), sourceSlices, sliceSize, recoverySlices)
+	return []string{indexPath, volumePath}, nil
+}
+
+// writePar2Volume computes the recovery slices and writes them to a recovery volume. The
+// files are read once for each batch of recovery slices that fits in par2BatchBytes.
+func writePar2Volume(ctx context.Context, path string, setID [16]byte, critical []byte, files []*par2File, sliceSize int64, count int) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+
+	batch := int(max(1, par2BatchBytes/sliceSize))
+	for first := 0; first < count; first += batch {
+		recovery := make([][]byte, min(batch, count-first))
+		for i := range recovery {
+			recovery[i] = make([]byte, sliceSize)
+		}
+		if err := par2Accumulate(ctx, files, sliceSize, first, recovery); err != nil {
+			out.Close()
+			os.Remove(path)
+			return err
+		}
+		for i, slice := range recovery {
+			body := make([]byte, 4, 4+len(slice))
+			binary.LittleEndian.PutUint32(body, uint32(first+i))
+			w.Write(par2Packet(setID, par2TypeRecovery, append(body, slice...)))
+		}
+	}
+	w.Write(critical)
+
+	err = w.Flush()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// par2Accumulate adds every source slice, times its constant raised to the recovery slice's
+// exponent, to recovery slices first, first+1, and so on
+func par2Accumulate(ctx context.Context, files []*par2File, sliceSize int64, first int, recovery [][]byte) error {
+	slice := make([]byte, sliceSize)
+	var low, high [256]uint16
+	logBase := 0
+	for _, f := range files {
+		in, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		r := bufio.NewReader(in)
+		for range f.slices {
+			if err := ctx.Err(); err != nil {
+				in.Close()
+				return err
+			}
+			clear(slice)
+			if _, err := io.ReadFull(r, slice); err != nil && err != io.ErrUnexpectedEOF {
+				in.Close()
+				return fmt.Errorf("failed to read %s: %w", f.path, err)
+			}
+			logBase = par2NextLogBase(logBase + 1)
+			for i, dst := range recovery {
+				coefficient := gf16Exp[logBase*(first+i)%65535]
+				for b := range 256 {
+					low[b] = gf16Mul(coefficient, uint16(b))
+					high[b] = gf16Mul(coefficient, uint16(b)<<8)
+				}
+				for k := 0; k < len(slice); k += 2 {
+					product := low[slice[k]] ^ high[slice[k+1]]
+					dst[k] ^= byte(product)
+					dst[k+1] ^= byte(product >> 8)
+				}
+			}
+		}
+		in.Close()
+	}
+	return nil
+}
+
+// hashFile computes the whole-file, first-16KiB, and per-slice checksums of a file, and
+// from them its file ID
+func (f *par2File) hashFile(sliceSize int64) error {
+	in, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	whole := md5.New()
+	first := md5.New()
+	r := bufio.NewReader(in)
+	slice := make([]byte, sliceSize)
+	var read int64
+	for read < f.size {
+		n, err := io.ReadFull(r, slice[:min64(sliceSize, f.size-read)])
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", f.path, err)
+		}
+		if read < 16384 {
+			first.Write(slice[:min64(int64(n), 16384-read)])
+		}
+		whole.Write(slice[:n])
+		clear(slice[n:])
+		f.slices = append(f.slices, par2Slice{md5: md5.Sum(slice), crc: crc32.ChecksumIEEE(slice)})
+		read += int64(n)
+	}
+	copy(f.hash[:], whole.Sum(nil))
+	copy(f.hash16k[:], first.Sum(nil))
+
+	id := md5.New()
+	id.Write(f.hash16k[:])
+	binary.Write(id, binary.LittleEndian, uint64(f.size))
+	id.Write([]byte(f.name))
+	copy(f.id[:], id.Sum(nil))
+	return nil
+}
+
+// descriptionBody returns the body of the file's description packet
+func (f *par2File) descriptionBody() []byte {
+	var body bytes.Buffer
+	body.Write(f.id[:])
+	body.Write(f.hash[:])
+	body.Write(f.hash16k[:])
+	binary.Write(&body, binary.LittleEndian, uint64(f.size))
+	body.Write(par2Pad([]byte(f.name)))
+	return body.Bytes()
+}
+
+// checksumBody returns the body of the file's input file slice checksum packet
+func (f *par2File) checksumBody() []byte {
+	var body bytes.Buffer
+	body.Write(f.id[:])
+	for _, s := range f.slices {
+		body.Write(s.md5[:])
+		binary.Write(&body, binary.LittleEndian, s.crc)
+	}
+	return body.Bytes()
+}
+
+// par2Packet returns a complete packet with the given type and body
+func par2Packet(setID [16]byte, packetType [16]byte, body []byte) []byte {
+	packet := make([]byte, par2HeaderBytes, par2HeaderBytes+len(body))
+	copy(packet, par2Magic)
+	binary.LittleEndian.PutUint64(packet[8:], uint64(par2HeaderBytes+len(body)))
+	copy(packet[32:], setID[:])
+	copy(packet[48:], packetType[:])
+	packet = append(packet, body...)
+	hash := md5.Sum(packet[32:])
+	copy(packet[16:], hash[:])
+	return packet
+}
+
+// par2Pad pads a string with zeros to a multiple of 4 bytes, as packets require
+func par2Pad(s []byte) []byte {
+	return append(s, make([]byte, (4-len(s)%4)%4)...)
+}
+
+// par2CompareIDs orders file IDs as 16-byte little-endian integers, as the main packet
+// lists them
+func par2CompareIDs(a, b [16]byte) int {
+	for i := 15; i >= 0; i-- {
+		if a[i] != b[i] {
+			return int(a[i]) - int(b[i])
+		}
+	}
+	return 0
+}
+
+// par2NextLogBase returns the first power of 2 from n that is coprime to 65535. Source
+// slices are given 2 raised to successive such powers as their constants, which keeps every
+// recovery slice independent of the others.
+func par2NextLogBase(n int) int {
+	for n%3 == 0 || n%5 == 0 || n%17 == 0 || n%257 == 0 {
+		n++
+	}
+	return n
+}
+
+// par2Packets returns the intact packets of a recovery set found in data, skipping damaged ones
+func par2Packets(data []byte) map[[16]byte][][]byte {
+	packets := make(map[[16]byte][][]byte)
+	for {
+		start := bytes.Index(data, []byte(par2Magic))
+		if start < 0 {
+			return packets
+		}
+		data = data[start:]
+		if len(data) < par2HeaderBytes {
+			return packets
+		}
+		length := binary.LittleEndian.Uint64(data[8:])
+		if length < par2HeaderBytes || length%4 != 0 || length > uint64(len(data)) {
+			data = data[len(par2Magic):]
+			continue
+		}
+		packet := data[:length]
+		if hash := md5.Sum(packet[32:]); !bytes.Equal(hash[:], packet[16:32]) {
+			data = data[len(par2Magic):]
+			continue
+		}
+		var packetType [16]byte
+		copy(packetType[:], packet[48:64])
+		packets[packetType] = append(packets[packetType], packet)
+		data = data[length:]
+	}
+}
+
+// VerifyPar2 checks the files of a recovery set against the checksums in indexPath and any
+// recovery volumes next to it, and counts the intact recovery slices that could repair them
+func VerifyPar2(ctx context.Context, indexPath string) (*Par2Report, error) {
+	log := trace.FromContext(ctx).WithPrefix("PAR2")
+
+	paths, _ := filepath.Glob(escapeGlob(strings.TrimSuffix(indexPath, Par2Ext)) + ".vol*" + Par2Ext)
+	paths = append([]string{indexPath}, paths...)
+	descriptions := make(map[[16]byte][]byte)
+	checksums := make(map[[16]byte][]byte)
+	exponents := make(map[uint32]bool)
+	var main []byte
+	var setID [16]byte
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PAR2 file %s: %w", path, err)
+		}
+		packets := par2Packets(data)
+		if main == nil && len(packets[par2TypeMain]) > 0 {
+			main = packets[par2TypeMain][0][par2HeaderBytes:]
+			copy(setID[:], packets[par2TypeMain][0][32:48])
+		}
+		for packetType, list := range packets {
+			for _, packet := range list {
+				if !bytes.Equal(packet[32:48], setID[:]) || len(packet) < par2HeaderBytes+16 {
+					continue
+				}
+				body := packet[par2HeaderBytes:]
+				var id [16]byte
+				copy(id[:], body)
+				switch packetType {
+				case par2TypeFileDesc:
+					descriptions[id] = body
+				case par2TypeIFSC:
+					checksums[id] = body
+				case par2TypeRecovery:
+					exponents[binary.LittleEndian.Uint32(body)] = true
+				}
+			}
+		}
+	}
+	if main == nil || len(main) < 12 {
+		return nil, fmt.Errorf("%s has no intact main packet", indexPath)
+	}
+
+	sliceSize := int64(binary.LittleEndian.Uint64(main))
+	count := int(binary.LittleEndian.Uint32(main[8:]))
+	if sliceSize == 0 || sliceSize%4 != 0 || len(main) < 12+16*count {
+		return nil, fmt.Errorf("%s has an invalid main packet", indexPath)
+	}
+	report := &Par2Report{IndexPath: indexPath, Files: count, RecoverySlices: len(exponents)}
+	for i := range count {
+		var id [16]byte
+		copy(id[:], main[12+16*i:])
+		description, checksum := descriptions[id], checksums[id]
+		if len(description) < 56 || checksum == nil {
+			return nil, fmt.Errorf("%s doesn't describe every file it protects", indexPath)
+		}
+		f := &par2File{
+			size: int64(binary.LittleEndian.Uint64(description[48:])),
+			name: string(bytes.TrimRight(description[56:], "\x00")),
+		}
+		f.path = filepath.Join(filepath.Dir(indexPath), filepath.FromSlash(f.name))
+		for s := checksum[16:]; len(s) >= 20; s = s[20:] {
+			slice := par2Slice{crc: binary.LittleEndian.Uint32(s[16:])}
+			copy(slice.md5[:], s)
+			f.slices = append(f.slices, slice)
+		}
+
+		damaged, err := f.damagedSlices(ctx, sliceSize)
+		if err != nil {
+			return nil, err
+		}
+		if damaged > 0 {
+			log.Debugf("%s: %d of %d slices damaged", f.name, damaged, len(f.slices))
+			report.Damaged = append(report.Damaged, f.name)
+			report.DamagedSlices += damaged
+		}
+	}
+	return report, nil
+}
+
+// damagedSlices returns the number of the file's slices that are missing or don't match their
+// checksums. A missing file has every slice damaged.
+func (f *par2File) damagedSlices(ctx context.Context, sliceSize int64) (int, error) {
+	in, err := os.Open(f.path)
+	if err != nil {
+		return len(f.slices), nil
+	}
+	defer in.Close()
+
+	damaged := 0
+	if info, err := in.Stat(); err == nil && info.Size() > f.size {
+		damaged++ // Extra bytes at the end must be removed too
+	}
+	r := bufio.NewReader(io.LimitReader(in, f.size))
+	slice := make([]byte, sliceSize)
+	for _, expected := range f.slices {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		clear(slice)
+		if _, err := io.ReadFull(r, slice); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return 0, fmt.Errorf("failed to read %s: %w", f.path, err)
+		}
+		if md5.Sum(slice) != expected.md5 || crc32.ChecksumIEEE(slice) != expected.crc {
+			damaged++
+		}
+	}
+	return min(damaged, max(len(f.slices), 1)), nil
+}
+
+// escapeGlob escapes the characters of path that filepath.Glob treats specially
+func escapeGlob(path string) string {
+	var b strings.Builder
+	for _, c := range path {
+		if strings.ContainsRune(`*?[\`, c) && (c != '\\' || filepath.Separator != '\\') {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// min64 returns the smaller of a and b; the package's min takes ints
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Arithmetic in GF(2^16) with the generator polynomial 0x1100B that PAR 2.0 specifies
+var (
+	gf16Exp [2 * 65535]uint16
+	gf16Log [65536]uint16
+)
+
+func init() {
+	x := uint32(1)
+	for i := range 65535 {
+		gf16Exp[i], gf16Exp[i+65535] = uint16(x), uint16(x)
+		gf16Log[x] = uint16(i)
+		x <<= 1
+		if x&0x10000 != 0 {
+			x ^= 0x1100b
+		}
+	}
+}
+
+// gf16Mul returns a times b
+func gf16Mul(a, b uint16) uint16 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gf16Exp[int(gf16Log[a])+int(gf16Log[b])]
+}
@@ -0,0 +1,118 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestPar2Constants checks the source slice constants against the ones listed in the PAR 2.0
+// specification
+func TestPar2Constants(t *testing.T) {
+	expected := []uint16{2, 4, 16, 128, 256, 2048, 8192, 16384, 0x100b}
+	logBase := 0
+	for i, want := range expected {
+		logBase = par2NextLogBase(logBase + 1)
+		if got := gf16Exp[logBase]; got != want {
+			t.Errorf("Constant %d: expected %#x, got %#x", i, want, got)
+		}
+	}
+}
+
+// TestPar2Collection writes recovery files for a collection directory, checks them, damages a
+// chunk file and a recovery file, and rebuilds a lost slice from the recovery slices
+func TestPar2Collection(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	collPath := filepath.Join(t.TempDir(), "2A3")
+	if err := os.MkdirAll(collPath, 0755); err != nil {
+		t.Fatalf("Failed to create collection directory: %v", err)
+	}
+	rng := rand.New(rand.NewSource(3))
+	for i, size := range []int{5000, 3001, 10} {
+		data := make([]byte, size)
+		rng.Read(data)
+		if err := os.WriteFile(filepath.Join(collPath, []string{"2A3_0001.bin", "2A3_0002.bin", "2A3_0003.bin"}[i]), data, 0644); err != nil {
+			t.Fatalf("Failed to write chunk: %v", err)
+		}
+	}
+	coll := Collection{Name: "2A3", Path: collPath, Format: FormatBin}
+
+	written, err := WriteCollectionPar2(ctx, coll, 10)
+	if err != nil {
+		t.Fatalf("WriteCollectionPar2 failed: %v", err)
+	}
+	if len(written) != 2 || written[0] != filepath.Join(collPath, "2A3.par2") || filepath.Base(written[1]) != "2A3.vol00+26.par2" {
+		t.Fatalf("Unexpected PAR2 files: %v", written)
+	}
+	report, err := VerifyCollectionPar2(ctx, coll)
+	if err != nil || report.Files != 3 || len(report.Damaged) != 0 || report.RecoverySlices != 26 {
+		t.Fatalf("Unexpected report for intact collection: %+v, %v", report, err)
+	}
+
+	// Rebuild the first slice of the first chunk from recovery slice 0, which is the sum of
+	// every source slice, to check the recovery data
+	index, _ := os.ReadFile(written[0])
+	volume, _ := os.ReadFile(written[1])
+	main := par2Packets(index)[par2TypeMain][0][par2HeaderBytes:]
+	sliceSize := int(binary.LittleEndian.Uint64(main))
+	var rebuilt []byte
+	for _, packet := range par2Packets(volume)[par2TypeRecovery] {
+		if binary.LittleEndian.Uint32(packet[par2HeaderBytes:]) == 0 {
+			rebuilt = bytes.Clone(packet[par2HeaderBytes+4:])
+		}
+	}
+	var target []byte
+	for i := range int(binary.LittleEndian.Uint32(main[8:])) {
+		id := main[12+16*i : 28+16*i]
+		for _, packet := range par2Packets(index)[par2TypeFileDesc] {
+			body := packet[par2HeaderBytes:]
+			if !bytes.Equal(body[:16], id) {
+				continue
+			}
+			data, _ := os.ReadFile(filepath.Join(collPath, string(bytes.TrimRight(body[56:], "\x00"))))
+			for start := 0; start < len(data); start += sliceSize {
+				slice := make([]byte, sliceSize)
+				copy(slice, data[start:])
+				if target == nil {
+					target = slice
+					continue
+				}
+				for k := range slice {
+					rebuilt[k] ^= slice[k]
+				}
+			}
+		}
+	}
+	if !bytes.Equal(rebuilt, target) {
+		t.Errorf("Recovery slice 0 doesn't rebuild the first source slice")
+	}
+
+	// Damage a chunk file, and make the recovery volume unreadable
+	chunkPath := filepath.Join(collPath, "2A3_0002.bin")
+	data, _ := os.ReadFile(chunkPath)
+	data[100] ^= 1
+	os.WriteFile(chunkPath, data, 0644)
+	report, err = VerifyCollectionPar2(ctx, coll)
+	if err != nil || len(report.Damaged) != 1 || report.Damaged[0] != "2A3_0002.bin" || report.DamagedSlices != 1 || !report.Repairable() {
+		t.Errorf("Unexpected report for damaged chunk: %+v, %v", report, err)
+	}
+	os.WriteFile(written[1], bytes.Repeat([]byte{0}, len(volume)), 0644)
+	report, err = VerifyCollectionPar2(ctx, coll)
+	if err != nil || report.RecoverySlices != 0 || report.Repairable() {
+		t.Errorf("Unexpected report without recovery slices: %+v, %v", report, err)
+	}
+
+	// A collection without recovery files has nothing to check
+	os.Remove(written[0])
+	if report, err := VerifyCollectionPar2(ctx, coll); report != nil || err != nil {
+		t.Errorf("Expected no report without PAR2 files, got %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// ParitySidecarExt is the extension appended to a chunk file name to form its parity sidecar.
+// The sidecar holds Reed-Solomon parity blocks for the chunk file as written on disk, so that
+// a few damaged bytes, such as a flipped bit on ageing media, are corrected when the chunk is
+// read instead of making the whole collection unusable.
+const ParitySidecarExt = ".parity"
+
+// DefaultParityPercent is the parity overhead, as a percentage of the chunk file size, used
+// when parity is asked for without a percentage
+const DefaultParityPercent = 5
+
+// MaxParityPercent is the largest parity overhead that can be asked for
+const MaxParityPercent = 100
+
+// ErrParityExhausted is returned, wrapped with the chunk at fault, when a chunk file has more
+// damaged blocks than its parity sidecar can correct
+var ErrParityExhausted = errors.New("too much damage to correct from parity")
+
+// The sidecar starts with a fixed header, then the CRC-32C of every data block followed by every
+// parity block, then the parity blocks themselves, then the CRC-32C of everything before it
+var parityMagic = [4]byte{'P', 'L', 'R', 'S'}
+
+const (
+	parityVersion      = 1
+	parityHeaderBytes  = 4 + 1 + 1 + 1 + 4 + 8 // magic, version, data blocks, parity blocks, block size, file size
+	maxParityDataBlock = 200                   // Data blocks a chunk file is divided into, at most
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// parityLayout is the division of a chunk file into data blocks and parity blocks
+type parityLayout struct {
+	dataBlocks   int
+	parityBlocks int
+	blockSize    int
+	fileSize     int64
+}
+
+// newParityLayout divides a file of fileSize bytes into at most maxParityDataBlock blocks, with
+// enough parity blocks for percent overhead, keeping the total within the 255 blocks the code
+// over GF(256) allows
+func newParityLayout(fileSize int64, percent int) parityLayout {
+	dataBlocks := min(maxParityDataBlock, 255*100/(100+percent))
+	if fileSize < int64(dataBlocks) {
+		dataBlocks = int(max(fileSize, 1))
+	}
+	parityBlocks := min(max(1, (dataBlocks*percent+99)/100), 255-dataBlocks)
+	blockSize := int((max(fileSize, 1) + int64(dataBlocks) - 1) / int64(dataBlocks))
+	return parityLayout{dataBlocks: dataBlocks, parityBlocks: parityBlocks, blockSize: blockSize, fileSize: fileSize}
+}
+
+// dataBlock returns data block i of data, zero-padded to the block size
+func (l parityLayout) dataBlock(data []byte, i int) []byte {
+	block := make([]byte, l.blockSize)
+	if start := i * l.blockSize; start < len(data) {
+		copy(block, data[start:min(len(data), start+l.blockSize)])
+	}
+	return block
+}
+
+// parityCoefficient is the coefficient of data block j in parity block i: an element of a
+// Cauchy matrix, every square submatrix of which is invertible, so that any damaged data blocks
+// can be solved for from as many intact parity blocks
+func (l parityLayout) parityCoefficient(i, j int) byte {
+	return gf256Inv(byte(l.dataBlocks+i) ^ byte(j))
+}
+
+// WriteParitySidecar computes Reed-Solomon parity with percent overhead for a chunk file as
+// written on disk and stores it next to the file
+func WriteParitySidecar(ctx context.Context, chunkPath string, percent int) error {
+	log := trace.FromContext(ctx).WithPrefix("PARITY")
+
+	if percent < 1 || percent > MaxParityPercent {
+		return fmt.Errorf("parity overhead must be between 1%% and %d%%, got %d%%", MaxParityPercent, percent)
+	}
+	data, err := os.ReadFile(chunkPath)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to read chunk file %s: %w", chunkPath, err))
+		return fmt.Errorf("failed to read chunk file %s: %w", chunkPath, err)
+	}
+
+	sidecarPath := chunkPath + ParitySidecarExt
+	if err := os.WriteFile(sidecarPath, encodeParity(data, percent), 0644); err != nil {
+		log.Error(fmt.Errorf("failed to write parity sidecar %s: %w", sidecarPath, err))
+		return fmt.Errorf("failed to write parity sidecar %s: %w", sidecarPath, err)
+	}
+
+	log.Debugf("Wrote parity sidecar %s", sidecarPath)
+	return nil
+}
+
+// encodeParity returns the parity sidecar for data
+func encodeParity(data []byte, percent int) []byte {
+	l := newParityLayout(int64(len(data)), percent)
+
+	blocks := make([][]byte, l.dataBlocks)
+	for j := range blocks {
+		blocks[j] = l.dataBlock(data, j)
+	}
+	parity := make([][]byte, l.parityBlocks)
+	for i := range parity {
+		parity[i] = make([]byte, l.blockSize)
+		for j, block := range blocks {
+			gf256MulAdd(parity[i], block, l.parityCoefficient(i, j))
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(parityMagic[:])
+	buf.WriteByte(parityVersion)
+	buf.WriteByte(byte(l.dataBlocks))
+	buf.WriteByte(byte(l.parityBlocks))
+	binary.Write(&buf, binary.BigEndian, uint32(l.blockSize))
+	binary.Write(&buf, binary.BigEndian, uint64(l.fileSize))
+	for _, block := range append(blocks, parity...) {
+		binary.Write(&buf, binary.BigEndian, crc32.Checksum(block, crc32c))
+	}
+	for _, block := range parity {
+		buf.Write(block)
+	}
+	binary.Write(&buf, binary.BigEndian, crc32.Checksum(buf.Bytes(), crc32c))
+	return buf.Bytes()
+}
+
+// parseParity parses a parity sidecar, returning its layout, the CRC of every data and parity
+// block, and the parity blocks
+func parseParity(sidecar []byte) (parityLayout, []uint32, [][]byte, error) {
+	if len(sidecar) < parityHeaderBytes+4 || !bytes.Equal(sidecar[:4], parityMagic[:]) {
+		return parityLayout{}, nil, nil, fmt.Errorf("not a parity sidecar")
+	}
+	body, sum := sidecar[:len(sidecar)-4], binary.BigEndian.Uint32(sidecar[len(sidecar)-4:])
+	if crc32.Checksum(body, crc32c) != sum {
+		return parityLayout{}, nil, nil, fmt.Errorf("parity sidecar is damaged")
+	}
+	if sidecar[4] != parityVersion {
+		return parityLayout{}, nil, nil, fmt.Errorf("unsupported parity sidecar version %d", sidecar[4])
+	}
+	l := parityLayout{
+		dataBlocks:   int(sidecar[5]),
+		parityBlocks: int(sidecar[6]),
+		blockSize:    int(binary.BigEndian.Uint32(sidecar[7:11])),
+		fileSize:     int64(binary.BigEndian.Uint64(sidecar[11:19])),
+	}
+	blocks := l.dataBlocks + l.parityBlocks
+	if l.dataBlocks == 0 || l.parityBlocks == 0 || blocks > 255 || l.blockSize == 0 ||
+		len(body) != parityHeaderBytes+4*blocks+l.parityBlocks*l.blockSize ||
+		l.fileSize > int64(l.dataBlocks)*int64(l.blockSize) {
+		return parityLayout{}, nil, nil, fmt.Errorf("parity sidecar layout is inconsistent")
+	}
+	crcs := make([]uint32, blocks)
+	for i := range crcs {
+		crcs[i] = binary.BigEndian.Uint32(body[parityHeaderBytes+4*i:])
+	}
+	parity := make([][]byte, l.parityBlocks)
+	offset := parityHeaderBytes + 4*blocks
+	for i := range parity {
+		parity[i] = body[offset : offset+l.blockSize]
+		offset += l.blockSize
+	}
+	return l, crcs, parity, nil
+}
+
+// CorrectWithParity checks data, read from a chunk file, against the file's parity sidecar if
+// it has one, and corrects any damaged blocks.
+//
+// Returns:
+//   - The data, corrected if it was damaged
+//   - The number of damaged blocks that were corrected
+//   - An error if the damage is more than the parity can correct. A sidecar that is missing is
+//     not an error, and one that is itself damaged is logged and ignored.
+func CorrectWithParity(ctx context.Context, chunkPath string, data []byte) ([]byte, int, error) {
+	log := trace.FromContext(ctx).WithPrefix("PARITY")
+
+	sidecarPath := chunkPath + ParitySidecarExt
+	sidecar, err := os.ReadFile(sidecarPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return data, 0, nil
+		}
+		return nil, 0, fmt.Errorf("failed to read parity sidecar %s: %w", sidecarPath, err)
+	}
+	l, crcs, parity, err := parseParity(sidecar)
+	if err != nil {
+		log.Infof("⚠️ Ignoring parity sidecar %s: %v", filepath.Base(sidecarPath), err)
+		return data, 0, nil
+	}
+	corrected, repaired, err := l.correct(data, crcs, parity)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", filepath.Base(chunkPath), err)
+	}
+	if repaired > 0 {
+		log.Infof("Corrected %d damaged blocks of chunk %s from its parity sidecar", repaired, filepath.Base(chunkPath))
+	}
+	return corrected, repaired, nil
+}
+
+// correct returns data with its damaged data blocks rebuilt from the intact parity blocks, and
+// the number of blocks rebuilt
+func (l parityLayout) correct(data []byte, crcs []uint32, parity [][]byte) ([]byte, int, error) {
+	// A file of the wrong length is damaged at least where it differs
+	blocks := make([][]byte, l.dataBlocks)
+	var damaged []int
+	for j := range blocks {
+		blocks[j] = l.dataBlock(data, j)
+		if crc32.Checksum(blocks[j], crc32c) != crcs[j] {
+			damaged = append(damaged, j)
+		}
+	}
+	if len(damaged) == 0 && int64(len(data)) == l.fileSize {
+		return data, 0, nil
+	}
+	var intact []int
+	for i, block := range parity {
+		if crc32.Checksum(block, crc32c) == crcs[l.dataBlocks+i] {
+			intact = append(intact, i)
+		}
+	}
+	if len(damaged) > len(intact) {
+		return nil, 0, fmt.Errorf("%d of %d blocks are damaged, but only %d intact parity blocks can correct them: %w",
+			len(damaged), l.dataBlocks, len(intact), ErrParityExhausted)
+	}
+
+	if len(damaged) > 0 {
+		// Each intact parity block, less the contribution of the intact data blocks, is a
+		// combination of the damaged ones; solve as many of these equations as are damaged
+		rows := intact[:len(damaged)]
+		known := make([][]byte, len(rows))
+		matrix := make([][]byte, len(rows))
+		for r, i := range rows {
+			known[r] = bytes.Clone(parity[i])
+			matrix[r] = make([]byte, len(damaged))
+			for j, block := range blocks {
+				if c := slices.Index(damaged, j); c >= 0 {
+					matrix[r][c] = l.parityCoefficient(i, j)
+				} else {
+					gf256MulAdd(known[r], block, l.parityCoefficient(i, j))
+				}
+			}
+		}
+		inverse, err := gf256Invert(matrix)
+		if err != nil {
+			return nil, 0, err
+		}
+		for c, j := range damaged {
+			blocks[j] = make([]byte, l.blockSize)
+			for r := range rows {
+				gf256MulAdd(blocks[j], known[r], inverse[c][r])
+			}
+			if crc32.Checksum(blocks[j], crc32c) != crcs[j] {
+				return nil, 0, fmt.Errorf("block %d does not match its checksum after correction: %w", j, ErrParityExhausted)
+			}
+		}
+	}
+
+	corrected := make([]byte, 0, l.dataBlocks*l.blockSize)
+	for _, block := range blocks {
+		corrected = append(corrected, block...)
+	}
+	return corrected[:l.fileSize], len(damaged), nil
+}
+
+// GF(256) arithmetic for the parity code, with the polynomial x^8 + x^4 + x^3 + x + 1, in which
+// addition is XOR
+var (
+	gf256Exp [510]byte
+	gf256Log [256]byte
+)
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gf256Exp[i], gf256Exp[i+255] = x, x
+		gf256Log[x] = byte(i)
+		// Multiply by the generator 3
+		doubled := x << 1
+		if x&0x80 != 0 {
+			doubled ^= 0x1b
+		}
+		x ^= doubled
+	}
+}
+
+// gf256Mul returns a times b
+func gf256Mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gf256Exp[int(gf256Log[a])+int(gf256Log[b])]
+}
+
+// gf256Inv returns the multiplicative inverse of a, for a != 0
+func gf256Inv(a byte) byte {
+	return gf256Exp[255-int(gf256Log[a])]
+}
+
+// gf256MulAdd adds c times src to dst
+func gf256MulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	logC := int(gf256Log[c])
+	for i, b := range src {
+		if b != 0 {
+			dst[i] ^= gf256Exp[int(gf256Log[b])+logC]
+		}
+	}
+}
+
+// gf256Invert returns the inverse of a square matrix by Gauss-Jordan elimination
+func gf256Invert(matrix [][]byte) ([][]byte, error) {
+	n := len(matrix)
+	work := make([][]byte, n)
+	inverse := make([][]byte, n)
+	for i := range matrix {
+		work[i] = bytes.Clone(matrix[i])
+		inverse[i] = make([]byte, n)
+		inverse[i][i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for pivot < n && work[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, fmt.Errorf("parity equations are singular")
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+		inverse[col], inverse[pivot] = inverse[pivot], inverse[col]
+		scale := gf256Inv(work[col][col])
+		for k := 0; k < n; k++ {
+			work[col][k] = gf256Mul(work[col][k], scale)
+			inverse[col][k] = gf256Mul(inverse[col][k], scale)
+		}
+		for row := 0; row < n; row++ {
+			if row != col && work[row][col] != 0 {
+				factor := work[row][col]
+				for k := 0; k < n; k++ {
+					work[row][k] ^= gf256Mul(work[col][k], factor)
+					inverse[row][k] ^= gf256Mul(inverse[col][k], factor)
+				}
+			}
+		}
+	}
+	return inverse, nil
+}
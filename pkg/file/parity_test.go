@@ -0,0 +1,112 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestParityCorrection verifies that damaged blocks are corrected up to the number of parity
+// blocks, and that more damage is reported rather than miscorrected
+func TestParityCorrection(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, size := range []int{1, 57, 200, 100000} {
+		data := make([]byte, size)
+		rng.Read(data)
+		l, crcs, parity, err := parseParity(encodeParity(data, 5))
+		if err != nil {
+			t.Fatalf("%d bytes: failed to parse parity: %v", size, err)
+		}
+		if got, n, err := l.correct(data, crcs, parity); err != nil || n != 0 || !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: intact data changed: %d blocks, %v", size, n, err)
+		}
+
+		// Damage one byte in each of as many blocks as there are parity blocks
+		damaged := bytes.Clone(data)
+		for i := 0; i < l.parityBlocks && i < l.dataBlocks; i++ {
+			damaged[min(size-1, i*l.blockSize)] ^= 0x5a
+		}
+		got, n, err := l.correct(damaged, crcs, parity)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: %d damaged blocks not corrected: %v", size, n, err)
+		}
+
+		// Truncation is corrected too, if it is within a block
+		if size > 1 {
+			if got, _, err := l.correct(data[:size-1], crcs, parity); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%d bytes: truncated data not corrected: %v", size, err)
+			}
+		}
+	}
+
+	// Damage to more blocks than there are parity blocks can't be corrected
+	data := make([]byte, 10000)
+	rng.Read(data)
+	l, crcs, parity, _ := parseParity(encodeParity(data, 5))
+	for i := 0; i <= l.parityBlocks; i++ {
+		data[i*l.blockSize] ^= 1
+	}
+	if _, _, err := l.correct(data, crcs, parity); !errors.Is(err, ErrParityExhausted) {
+		t.Errorf("Expected ErrParityExhausted, got %v", err)
+	}
+
+	// A damaged sidecar is recognized
+	sidecar := encodeParity(data, 10)
+	sidecar[len(sidecar)/2] ^= 1
+	if _, _, _, err := parseParity(sidecar); err == nil {
+		t.Errorf("Expected a damaged sidecar to be rejected")
+	}
+}
+
+// TestCollectionReaderParity verifies that a collection reader transparently corrects chunk
+// files written with parity sidecars
+func TestCollectionReaderParity(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+
+	payload := make([]byte, 4096)
+	rand.New(rand.NewSource(2)).Read(payload)
+	for _, format := range []Format{FormatBin, FormatPNG} {
+		collPath := filepath.Join(tempDir, string(format), "2A3")
+		if err := os.MkdirAll(collPath, 0755); err != nil {
+			t.Fatalf("Failed to create collection directory: %v", err)
+		}
+		w := &NamedChunkWriter{Ctx: ctx, Formatter: GetFormatter(format), CollPath: collPath, CollName: "2A3", ChunkNum: 1, Checksum: true, Parity: DefaultParityPercent}
+		if _, err := w.Write(payload); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		fname, _ := NamedChunkFileName(GetFormatter(format), "2A3", 1)
+		chunkPath := filepath.Join(collPath, fname)
+		if _, err := os.Stat(chunkPath + ParitySidecarExt); err != nil {
+			t.Fatalf("Expected a parity sidecar: %v", err)
+		}
+
+		// Flip a byte in the middle of the chunk file
+		contents, _ := os.ReadFile(chunkPath)
+		contents[len(contents)/2] ^= 0xff
+		if err := os.WriteFile(chunkPath, contents, 0644); err != nil {
+			t.Fatalf("Failed to damage chunk: %v", err)
+		}
+
+		reader := NewCollectionReader(Collection{Name: "2A3", Path: collPath, Format: format})
+		data, err := reader.ReadNextChunk(ctx)
+		reader.Close()
+		if err != nil || !bytes.Equal(data, payload) {
+			t.Errorf("%s: damaged chunk not corrected: %v", format, err)
+		}
+		if reader.CorrectedChunks != 1 {
+			t.Errorf("%s: expected one corrected chunk, got %d", format, reader.CorrectedChunks)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PartialSuffix is appended to the name of a collection, archive or volume while it is being
+// written. The output is renamed to its final name only once it is complete, so a collection
+// with its final name is never one that an encode left half written.
+const PartialSuffix = ".partial"
+
+// ProgressFileName is the file in a collection directory that records how far an encode got,
+// so that an encode that died part way through can be continued with -resume. It is removed
+// when the encode completes, so a directory holding one is a partial collection.
+const ProgressFileName = ".padlock-progress.json"
+
+// PartialPath returns the name that path is written under until it is complete
+func PartialPath(path string) string {
+	return path + PartialSuffix
+}
+
+// FinalPath returns the name that the partial output at path is renamed to when complete
+func FinalPath(path string) string {
+	return strings.TrimSuffix(path, PartialSuffix)
+}
+
+// IsPartialPath reports whether path names output that is still being written
+func IsPartialPath(path string) bool {
+	return strings.HasSuffix(path, PartialSuffix)
+}
+
+// IsPartialOutput reports whether path is an incomplete collection: one still named as
+// partial, or a collection directory that holds the progress of an unfinished encode
+func IsPartialOutput(path string) bool {
+	if IsPartialPath(path) {
+		return true
+	}
+	_, err := os.Lstat(filepath.Join(path, ProgressFileName))
+	return err == nil
+}
+
+// CommitPartial renames the partial output at PartialPath(path) to path, replacing nothing:
+// it fails if path already exists, rather than overwrite a collection that was there before
+func CommitPartial(path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return &os.LinkError{Op: "rename", Old: PartialPath(path), New: path, Err: os.ErrExist}
+	}
+	return os.Rename(PartialPath(path), path)
+}
@@ -0,0 +1,100 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestPartialPath(t *testing.T) {
+	path := filepath.Join("out", "3A5.tar")
+	partial := PartialPath(path)
+	if partial != path+".partial" {
+		t.Errorf("PartialPath(%s) = %s", path, partial)
+	}
+	if !IsPartialPath(partial) || IsPartialPath(path) {
+		t.Errorf("IsPartialPath doesn't tell %s from %s", partial, path)
+	}
+	if FinalPath(partial) != path {
+		t.Errorf("FinalPath(%s) = %s, want %s", partial, FinalPath(partial), path)
+	}
+}
+
+func TestCommitPartial(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "padlock-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "3A5.tar")
+	if err := os.WriteFile(PartialPath(path), []byte("archive"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := CommitPartial(path); err != nil {
+		t.Fatalf("CommitPartial failed: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected %s after commit: %v", path, err)
+	}
+	if _, err := os.Stat(PartialPath(path)); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial file to be gone after commit")
+	}
+
+	// An existing output is never replaced
+	if err := os.WriteFile(PartialPath(path), []byte("another"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := CommitPartial(path); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Expected CommitPartial over an existing file to fail, got %v", err)
+	}
+}
+
+func TestFindCollectionsIgnoresPartialOutput(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "padlock-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	// A complete collection, one still being written, and one left by an interrupted encode
+	// that predates partial names
+	for _, name := range []string{"2A3", "2B3.partial", "2C3"} {
+		dir := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create collection directory: %v", err)
+		}
+		collName := FinalPath(name)
+		if err := os.WriteFile(filepath.Join(dir, collName+"_0001.bin"), []byte("chunk"), 0644); err != nil {
+			t.Fatalf("Failed to write chunk: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "2C3", ProgressFileName), []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to write progress file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "2A3.tar.partial"), []byte("truncated"), 0644); err != nil {
+		t.Fatalf("Failed to write partial archive: %v", err)
+	}
+
+	if !IsPartialOutput(filepath.Join(tempDir, "2C3")) || IsPartialOutput(filepath.Join(tempDir, "2A3")) {
+		t.Errorf("IsPartialOutput doesn't recognize a directory with a progress file")
+	}
+
+	collections, tempExtractDir, err := FindCollections(ctx, tempDir)
+	if err != nil {
+		t.Fatalf("FindCollections failed: %v", err)
+	}
+	if tempExtractDir != "" {
+		os.RemoveAll(tempExtractDir)
+	}
+	if len(collections) != 1 || collections[0].Name != "2A3" {
+		t.Errorf("Expected only the complete collection 2A3, got %+v", collections)
+	}
+}
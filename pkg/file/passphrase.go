@@ -0,0 +1,221 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/blues/padlock/pkg/trace"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+)
+
+// A stream masked with a passphrase starts with a header holding everything but the passphrase
+// needed to unmask it, followed by the data XORed with a ChaCha20 keystream. The keystream key
+// is derived from the passphrase with Argon2id and a random salt, so the collections that
+// carry a masked stream reveal nothing without the passphrase even if K of them are combined.
+//
+// Header layout:
+//
+//	magic      8 bytes  passphraseMagic
+//	version    1 byte   passphraseVersion
+//	time       4 bytes  Argon2id passes, big-endian
+//	memory     4 bytes  Argon2id memory in KiB, big-endian
+//	threads    1 byte   Argon2id parallelism
+//	salt      16 bytes
+//	check     32 bytes  Second half of the Argon2id output, to recognize a wrong passphrase
+//
+// The first byte of the magic is NUL, which can't start a TAR stream, and neither gzip nor
+// zstd data starts with it, so a masked stream is never mistaken for the data it hides.
+const passphraseMagic = "\x00PLKPASS"
+
+// passphraseVersion is the version of the masked stream header written by this package
+const passphraseVersion = 1
+
+// Sizes of the parts of the masked stream header
+const (
+	passphraseSaltSize   = 16
+	passphraseCheckSize  = 32
+	passphraseHeaderSize = len(passphraseMagic) + 1 + 4 + 4 + 1 + passphraseSaltSize + passphraseCheckSize
+)
+
+// PassphraseParams are the Argon2id parameters used to derive the keystream key
+type PassphraseParams struct {
+	Time    uint32 // Number of passes over the memory
+	Memory  uint32 // Memory in KiB
+	Threads uint8  // Degree of parallelism
+}
+
+// DefaultPassphraseParams are the Argon2id parameters recommended by RFC 9106 for
+// memory-constrained environments
+var DefaultPassphraseParams = PassphraseParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// maxPassphraseMemory bounds the memory a masked stream header can ask for, so that a damaged
+// or hostile header can't exhaust the memory of the machine unmasking it
+const maxPassphraseMemory = 4 * 1024 * 1024
+
+// ErrPassphraseRequired is returned when a stream is masked with a passphrase and none was given.
+var ErrPassphraseRequired = errors.New("data is protected with a passphrase; a passphrase is required")
+
+// ErrWrongPassphrase is returned when a masked stream is unmasked with the wrong passphrase.
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// IsPassphraseStream reports whether data starts like a stream masked with a passphrase
+func IsPassphraseStream(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(passphraseMagic))
+}
+
+// passphraseKeys derives the keystream key and the check value from a passphrase
+func passphraseKeys(passphrase, salt []byte, params PassphraseParams) (key, check []byte) {
+	derived := argon2.IDKey(passphrase, salt, params.Time, params.Memory, params.Threads, chacha20.KeySize+passphraseCheckSize)
+	return derived[:chacha20.KeySize], derived[chacha20.KeySize:]
+}
+
+// MaskStream returns a reader that yields a header followed by r XORed with a keystream derived
+// from passphrase with a new random salt
+func MaskStream(ctx context.Context, r io.Reader, passphrase []byte) (io.Reader, error) {
+	log := trace.FromContext(ctx).WithPrefix("passphrase")
+
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("the passphrase is empty")
+	}
+	salt := make([]byte, passphraseSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	params := DefaultPassphraseParams
+	key, check := passphraseKeys(passphrase, salt, params)
+	masked, err := newKeystreamReader(r, key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, passphraseHeaderSize)
+	header = append(header, passphraseMagic...)
+	header = append(header, passphraseVersion)
+	header = binary.BigEndian.AppendUint32(header, params.Time)
+	header = binary.BigEndian.AppendUint32(header, params.Memory)
+	header = append(header, params.Threads)
+	header = append(header, salt...)
+	header = append(header, check...)
+
+	log.Debugf("Masking the stream with a passphrase keystream (Argon2id t=%d m=%dKiB p=%d)", params.Time, params.Memory, params.Threads)
+	return io.MultiReader(bytes.NewReader(header), masked), nil
+}
+
+// UnmaskStream reverses MaskStream. A stream that isn't masked is returned as it is if
+// passphrase is empty; a masked stream without a passphrase fails with ErrPassphraseRequired,
+// and with the wrong one with ErrWrongPassphrase.
+func UnmaskStream(ctx context.Context, r io.Reader, passphrase []byte) (io.Reader, error) {
+	log := trace.FromContext(ctx).WithPrefix("passphrase")
+
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(passphraseMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read from input stream: %w", err)
+	}
+	if !IsPassphraseStream(magic) {
+		if len(passphrase) > 0 {
+			return nil, fmt.Errorf("a passphrase was given, but the data is not protected with one")
+		}
+		return br, nil
+	}
+	if len(passphrase) == 0 {
+		return nil, ErrPassphraseRequired
+	}
+
+	header := make([]byte, passphraseHeaderSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("failed to read passphrase header: %w", err)
+	}
+	h := header[len(passphraseMagic):]
+	if h[0] != passphraseVersion {
+		return nil, fmt.Errorf("unsupported passphrase header version %d", h[0])
+	}
+	params := PassphraseParams{
+		Time:    binary.BigEndian.Uint32(h[1:5]),
+		Memory:  binary.BigEndian.Uint32(h[5:9]),
+		Threads: h[9],
+	}
+	if params.Time == 0 || params.Threads == 0 || params.Memory > maxPassphraseMemory {
+		return nil, fmt.Errorf("malformed passphrase header")
+	}
+	salt := h[10 : 10+passphraseSaltSize]
+	key, check := passphraseKeys(passphrase, salt, params)
+	if subtle.ConstantTimeCompare(check, h[10+passphraseSaltSize:]) != 1 {
+		return nil, ErrWrongPassphrase
+	}
+	unmasked, err := newKeystreamReader(br, key)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Unmasking the stream with a passphrase keystream")
+	return unmasked, nil
+}
+
+// keystreamSegmentSize is the length of the keystream under one nonce. ChaCha20's 32-bit block
+// counter runs out after 2^32 blocks of 64 bytes, so a longer stream goes on under the next
+// nonce.
+const keystreamSegmentSize = 1 << 38
+
+// keystreamNonce returns the nonce of segment n of a keystream: n, big-endian, which makes the
+// nonce of the first segment all zeros. Every stream has its own salt and so its own key, which
+// is why fixed nonces are safe.
+func keystreamNonce(segment int64) []byte {
+	nonce := make([]byte, chacha20.NonceSize)
+	binary.BigEndian.PutUint64(nonce[chacha20.NonceSize-8:], uint64(segment))
+	return nonce
+}
+
+// keystreamReader XORs everything read from r with the ChaCha20 keystream of key, moving to
+// the nonce of the next segment every keystreamSegmentSize bytes
+type keystreamReader struct {
+	r      io.Reader
+	key    []byte
+	cipher *chacha20.Cipher
+	offset int64 // Bytes of the keystream used so far
+}
+
+// newKeystreamReader returns a keystreamReader for r and key, at the start of the keystream
+func newKeystreamReader(r io.Reader, key []byte) (*keystreamReader, error) {
+	k := &keystreamReader{r: r, key: key}
+	if err := k.seek(0); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// seek moves the keystream to offset, which must be a multiple of the ChaCha20 block size
+func (k *keystreamReader) seek(offset int64) error {
+	cipher, err := chacha20.NewUnauthenticatedCipher(k.key, keystreamNonce(offset/keystreamSegmentSize))
+	if err != nil {
+		return fmt.Errorf("failed to create keystream: %w", err)
+	}
+	cipher.SetCounter(uint32(offset % keystreamSegmentSize / 64))
+	k.cipher, k.offset = cipher, offset
+	return nil
+}
+
+func (k *keystreamReader) Read(p []byte) (int, error) {
+	n, err := k.r.Read(p)
+	for data := p[:n]; len(data) > 0; {
+		part := data[:min64(int64(len(data)), keystreamSegmentSize-k.offset%keystreamSegmentSize)]
+		k.cipher.XORKeyStream(part, part)
+		data = data[len(part):]
+		if k.offset += int64(len(part)); k.offset%keystreamSegmentSize == 0 {
+			if err := k.seek(k.offset); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, err
+}
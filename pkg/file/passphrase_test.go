@@ -0,0 +1,125 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+	"golang.org/x/crypto/chacha20"
+)
+
+func TestMaskStream(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	data := bytes.Repeat([]byte("a secret worth a second factor "), 1000)
+	passphrase := []byte("correct horse battery staple")
+
+	mask := func() []byte {
+		masked, err := MaskStream(ctx, bytes.NewReader(data), passphrase)
+		if err != nil {
+			t.Fatalf("MaskStream failed: %v", err)
+		}
+		out, err := io.ReadAll(masked)
+		if err != nil {
+			t.Fatalf("Failed to read masked stream: %v", err)
+		}
+		return out
+	}
+	masked := mask()
+	if len(masked) != passphraseHeaderSize+len(data) || !IsPassphraseStream(masked) {
+		t.Fatalf("Unexpected masked stream of %d bytes", len(masked))
+	}
+	if bytes.Contains(masked, []byte("a secret")) {
+		t.Errorf("Masked stream contains the data in the clear")
+	}
+	if bytes.Equal(masked, mask()) {
+		t.Errorf("Masking the same data twice gave the same stream; the salt should differ")
+	}
+
+	unmask := func(stream, passphrase []byte) ([]byte, error) {
+		r, err := UnmaskStream(ctx, bytes.NewReader(stream), passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+	if out, err := unmask(masked, passphrase); err != nil || !bytes.Equal(out, data) {
+		t.Errorf("Unmasking did not reproduce the data (%v)", err)
+	}
+	if _, err := unmask(masked, []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected ErrWrongPassphrase, got %v", err)
+	}
+	if _, err := unmask(masked, nil); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("Expected ErrPassphraseRequired, got %v", err)
+	}
+
+	// Streams that aren't masked pass through without a passphrase, and are refused with one
+	if out, err := unmask(data, nil); err != nil || !bytes.Equal(out, data) {
+		t.Errorf("Expected an unmasked stream to pass through (%v)", err)
+	}
+	if out, err := unmask(nil, nil); err != nil || len(out) != 0 {
+		t.Errorf("Expected an empty stream to pass through (%v)", err)
+	}
+	if _, err := unmask(data, passphrase); err == nil {
+		t.Errorf("Expected an error unmasking a stream that isn't masked")
+	}
+
+	// A header that asks for more memory than allowed is refused before deriving anything
+	hostile := bytes.Clone(masked)
+	copy(hostile[len(passphraseMagic)+5:], []byte{0xff, 0xff, 0xff, 0xff})
+	if _, err := unmask(hostile, passphrase); err == nil {
+		t.Errorf("Expected a malformed header to be refused")
+	}
+}
+
+// TestKeystreamSegments checks that a keystream runs on under the next nonce where ChaCha20's
+// block counter would run out, rather than panicking, and that its first segment is the
+// zero-nonce keystream earlier streams were masked with
+func TestKeystreamSegments(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, chacha20.KeySize)
+	keystream := func(segment int64, counter uint32, size int) []byte {
+		cipher, err := chacha20.NewUnauthenticatedCipher(key, keystreamNonce(segment))
+		if err != nil {
+			t.Fatalf("Failed to create cipher: %v", err)
+		}
+		cipher.SetCounter(counter)
+		out := make([]byte, size)
+		cipher.XORKeyStream(out, out)
+		return out
+	}
+
+	k, err := newKeystreamReader(bytes.NewReader(make([]byte, 1000)), key)
+	if err != nil {
+		t.Fatalf("newKeystreamReader failed: %v", err)
+	}
+	out, err := io.ReadAll(k)
+	if err != nil || !bytes.Equal(out, keystream(0, 0, 1000)) {
+		t.Errorf("Expected the first segment to be the zero-nonce keystream (%v)", err)
+	}
+
+	// Start two blocks before the end of the first segment, and read across the boundary
+	k, err = newKeystreamReader(bytes.NewReader(make([]byte, 1000)), key)
+	if err != nil {
+		t.Fatalf("newKeystreamReader failed: %v", err)
+	}
+	if err := k.seek(keystreamSegmentSize - 128); err != nil {
+		t.Fatalf("Failed to seek: %v", err)
+	}
+	out, err = io.ReadAll(k)
+	if err != nil {
+		t.Fatalf("Failed to read across the segment boundary: %v", err)
+	}
+	if !bytes.Equal(out[:128], keystream(0, 1<<32-2, 128)) {
+		t.Errorf("Expected the last blocks of the first segment")
+	}
+	if !bytes.Equal(out[128:], keystream(1, 0, 1000-128)) {
+		t.Errorf("Expected the second segment to start from block 0 under the next nonce")
+	}
+	if k.offset != keystreamSegmentSize-128+1000 {
+		t.Errorf("Expected the reader at offset %d, got %d", keystreamSegmentSize-128+1000, k.offset)
+	}
+}
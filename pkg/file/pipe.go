@@ -0,0 +1,171 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// PipeReader is the read half of a pipe returned by NewPipe
+type PipeReader interface {
+	io.ReadCloser
+	CloseWithError(err error) error
+}
+
+// PipeWriter is the write half of a pipe returned by NewPipe
+type PipeWriter interface {
+	io.WriteCloser
+	CloseWithError(err error) error
+}
+
+// NewPipe creates an in-memory pipe between two pipeline stages. It behaves like io.Pipe,
+// but buffers up to size bytes so the writer can run ahead of the reader. Memory use is
+// bounded by size. A size of 0 or less returns an unbuffered io.Pipe.
+func NewPipe(size int) (PipeReader, PipeWriter) {
+	if size <= 0 {
+		return io.Pipe()
+	}
+	p := &bufferedPipe{data: make([]byte, size)}
+	p.cond = sync.NewCond(&p.mu)
+	return &bufferedPipeReader{p}, &bufferedPipeWriter{p}
+}
+
+// BufferStream reads r in a separate goroutine through a pipe of the given size, so the
+// stage producing r can run ahead of its consumer. The returned reader must be closed.
+// Cancelling ctx stops the goroutine and fails the reader with ctx's error.
+func BufferStream(ctx context.Context, r io.Reader, size int) io.ReadCloser {
+	pr, pw := NewPipe(size)
+	go func() {
+		defer context.AfterFunc(ctx, func() { pw.CloseWithError(ctx.Err()) })()
+		_, err := io.Copy(pw, NewContextReader(ctx, r))
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// NewContextReader returns a reader that reads from r until ctx is cancelled, and then
+// fails with ctx's error, so that a long copy stops promptly between reads
+func NewContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// bufferedPipe is a fixed-size ring buffer shared by a reader and a writer
+type bufferedPipe struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	data  []byte
+	start int   // Index of the first unread byte
+	count int   // Number of unread bytes
+	werr  error // Set when the writer is closed; io.EOF for a normal close
+	rerr  error // Set when the reader is closed
+}
+
+func (p *bufferedPipe) write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for len(b) > 0 {
+		if p.rerr != nil {
+			return n, p.rerr
+		}
+		if p.werr != nil {
+			return n, io.ErrClosedPipe
+		}
+		if p.count == len(p.data) {
+			p.cond.Wait()
+			continue
+		}
+
+		// Copy into the free region following the unread bytes, which may wrap around
+		end := (p.start + p.count) % len(p.data)
+		free := len(p.data) - p.count
+		if end+free > len(p.data) {
+			free = len(p.data) - end
+		}
+		m := copy(p.data[end:end+free], b)
+		p.count += m
+		n += m
+		b = b[m:]
+		p.cond.Broadcast()
+	}
+	return n, nil
+}
+
+func (p *bufferedPipe) read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.count == 0 {
+		if p.rerr != nil {
+			return 0, io.ErrClosedPipe
+		}
+		if p.werr != nil {
+			return 0, p.werr
+		}
+		p.cond.Wait()
+	}
+	if p.rerr != nil {
+		return 0, io.ErrClosedPipe
+	}
+
+	avail := p.count
+	if p.start+avail > len(p.data) {
+		avail = len(p.data) - p.start
+	}
+	n := copy(b, p.data[p.start:p.start+avail])
+	p.start = (p.start + n) % len(p.data)
+	p.count -= n
+	p.cond.Broadcast()
+	return n, nil
+}
+
+func (p *bufferedPipe) closeRead(err error) {
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+	p.mu.Lock()
+	if p.rerr == nil {
+		p.rerr = err
+	}
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+func (p *bufferedPipe) closeWrite(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	p.mu.Lock()
+	if p.werr == nil {
+		p.werr = err
+	}
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+type bufferedPipeReader struct{ p *bufferedPipe }
+
+func (r *bufferedPipeReader) Read(b []byte) (int, error)     { return r.p.read(b) }
+func (r *bufferedPipeReader) Close() error                   { return r.CloseWithError(nil) }
+func (r *bufferedPipeReader) CloseWithError(err error) error { r.p.closeRead(err); return nil }
+
+type bufferedPipeWriter struct{ p *bufferedPipe }
+
+func (w *bufferedPipeWriter) Write(b []byte) (int, error)    { return w.p.write(b) }
+func (w *bufferedPipeWriter) Close() error                   { return w.CloseWithError(nil) }
+func (w *bufferedPipeWriter) CloseWithError(err error) error { w.p.closeWrite(err); return nil }
@@ -0,0 +1,104 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestBufferedPipe(t *testing.T) {
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	for _, size := range []int{0, 1, 1000, 4096, 1 << 20} {
+		pr, pw := NewPipe(size)
+		go func() {
+			// Write in uneven pieces so the ring buffer wraps at varying offsets
+			for off := 0; off < len(data); {
+				n := min(len(data)-off, 1+off%3001)
+				if _, err := pw.Write(data[off : off+n]); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+				off += n
+			}
+			pw.Close()
+		}()
+
+		got, err := io.ReadAll(pr)
+		if err != nil {
+			t.Fatalf("size %d: read failed: %v", size, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("size %d: data mismatch (%d bytes read)", size, len(got))
+		}
+	}
+}
+
+func TestBufferedPipeErrors(t *testing.T) {
+	errWriter := errors.New("writer failed")
+	pr, pw := NewPipe(16)
+	pw.Write([]byte("abc"))
+	pw.CloseWithError(errWriter)
+
+	// Buffered data is delivered before the writer's error
+	buf := make([]byte, 16)
+	if n, err := pr.Read(buf); n != 3 || err != nil {
+		t.Errorf("Expected 3 buffered bytes, got %d, %v", n, err)
+	}
+	if _, err := pr.Read(buf); !errors.Is(err, errWriter) {
+		t.Errorf("Expected writer error, got %v", err)
+	}
+
+	// Closing the reader unblocks a writer waiting for space
+	errReader := errors.New("reader failed")
+	pr, pw = NewPipe(4)
+	done := make(chan error, 1)
+	go func() {
+		_, err := pw.Write(make([]byte, 100))
+		done <- err
+	}()
+	pr.CloseWithError(errReader)
+	if err := <-done; !errors.Is(err, errReader) {
+		t.Errorf("Expected reader error, got %v", err)
+	}
+}
+
+func TestBufferStream(t *testing.T) {
+	data := bytes.Repeat([]byte("buffered stream "), 1000)
+	r := BufferStream(context.Background(), bytes.NewReader(data), 512)
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("BufferStream mismatch: %d bytes, %v", len(got), err)
+	}
+}
+
+// endlessReader yields zeros forever
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestBufferStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := BufferStream(ctx, endlessReader{}, 512)
+	defer r.Close()
+
+	if _, err := io.ReadFull(r, make([]byte, 4096)); err != nil {
+		t.Fatalf("Read before cancel failed: %v", err)
+	}
+	cancel()
+	if _, err := io.Copy(io.Discard, r); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled after cancel, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// ErrPNGDataNotFound is returned when a PNG has no 'rAWd' chunk before its IEND chunk
+var ErrPNGDataNotFound = errors.New("'rAWd' chunk not found")
+
+// pngChunkHeader is the length and type that precede the data of every PNG chunk
+type pngChunkHeader struct {
+	Length uint32
+	Type   string
+}
+
+// pngChunkWalker reads the chunks of a PNG stream one at a time, without holding more than
+// a chunk header in memory
+type pngChunkWalker struct {
+	r      io.Reader
+	offset int64 // Offset in the stream of the next unread byte
+}
+
+// newPNGChunkWalker reads and checks the PNG signature at the start of r
+func newPNGChunkWalker(r io.Reader) (*pngChunkWalker, error) {
+	var sig [8]byte
+	if _, err := io.ReadFull(r, sig[:]); err != nil || !bytes.Equal(sig[:], pngSignature) {
+		return nil, fmt.Errorf("invalid PNG signature")
+	}
+	return &pngChunkWalker{r: r, offset: int64(len(sig))}, nil
+}
+
+// next reads the header of the next chunk. The caller must then either skip the chunk or
+// read its data and CRC.
+func (w *pngChunkWalker) next() (pngChunkHeader, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(w.r, buf[:]); err != nil {
+		return pngChunkHeader{}, fmt.Errorf("truncated PNG chunk header at offset %d", w.offset)
+	}
+	w.offset += int64(len(buf))
+	return pngChunkHeader{Length: binary.BigEndian.Uint32(buf[:4]), Type: string(buf[4:])}, nil
+}
+
+// skip passes over the data and CRC of a chunk whose header was just read, seeking past
+// them if the stream allows it
+func (w *pngChunkWalker) skip(h pngChunkHeader) error {
+	n := int64(h.Length) + 4
+	if s, ok := w.r.(io.Seeker); ok {
+		if _, err := s.Seek(n, io.SeekCurrent); err == nil {
+			w.offset += n
+			return nil
+		}
+	}
+	copied, err := io.CopyN(io.Discard, w.r, n)
+	w.offset += copied
+	if err != nil {
+		return fmt.Errorf("PNG chunk %q at offset %d claims %d bytes, but the file ends first", h.Type, w.offset-copied-8, h.Length)
+	}
+	return nil
+}
+
+// pngDataReader reads the data of one PNG chunk, checking the CRC that follows it when the
+// data has been read in full
+type pngDataReader struct {
+	r         io.Reader
+	chunkType string
+	remaining int64
+	crc       hash.Hash32
+	done      bool
+	err       error
+}
+
+// Read implements io.Reader. After the last byte of data, it returns io.EOF if the CRC
+// matches, and an error describing the mismatch if it doesn't.
+func (d *pngDataReader) Read(p []byte) (int, error) {
+	if d.done {
+		return 0, d.err
+	}
+	if d.remaining > 0 {
+		if int64(len(p)) > d.remaining {
+			p = p[:d.remaining]
+		}
+		n, err := d.r.Read(p)
+		d.crc.Write(p[:n])
+		d.remaining -= int64(n)
+		if d.remaining > 0 {
+			if err == io.EOF {
+				err = fmt.Errorf("invalid PNG chunk length, exceeds available data: %w", io.ErrUnexpectedEOF)
+			}
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+
+	d.done = true
+	var stored [4]byte
+	if _, err := io.ReadFull(d.r, stored[:]); err != nil {
+		d.err = fmt.Errorf("invalid chunk: no CRC found")
+		return 0, d.err
+	}
+	if storedCRC, computedCRC := binary.BigEndian.Uint32(stored[:]), d.crc.Sum32(); storedCRC != computedCRC {
+		d.err = fmt.Errorf("CRC mismatch in '%s' chunk: expected 0x%08x, calculated 0x%08x: %w", d.chunkType, storedCRC, computedCRC, ErrChecksumMismatch)
+		return 0, d.err
+	}
+	d.err = io.EOF
+	return 0, d.err
+}
+
+// OpenPNGData walks the chunks of a PNG stream up to its 'rAWd' chunk, and returns a reader
+// of that chunk's data along with its length. Only the chunk headers are examined on the
+// way; the image data is skipped, or seeked past if r is an io.Seeker. The reader verifies
+// the chunk's CRC when its data has been read in full, returning an error instead of io.EOF
+// if it doesn't match.
+//
+// If the PNG has no 'rAWd' chunk, the error is ErrPNGDataNotFound.
+func OpenPNGData(r io.Reader) (io.Reader, int64, error) {
+	walker, err := newPNGChunkWalker(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	for {
+		h, err := walker.next()
+		if err != nil {
+			return nil, 0, err
+		}
+		switch h.Type {
+		case "rAWd":
+			crc := crc32.NewIEEE()
+			crc.Write([]byte(h.Type))
+			return &pngDataReader{r: r, chunkType: h.Type, remaining: int64(h.Length), crc: crc}, int64(h.Length), nil
+		case "IEND":
+			return nil, 0, ErrPNGDataNotFound
+		}
+		if err := walker.skip(h); err != nil {
+			return nil, 0, err
+		}
+	}
+}
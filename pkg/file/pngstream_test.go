@@ -0,0 +1,95 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestOpenPNGData(t *testing.T) {
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i * 17)
+	}
+	var buf bytes.Buffer
+	if err := encodePNGWithData(&buf, createSmallPNG(), data); err != nil {
+		t.Fatalf("encodePNGWithData failed: %v", err)
+	}
+
+	// Both seekable and one byte at a time from a stream that can't seek
+	for name, r := range map[string]io.Reader{
+		"seeker": bytes.NewReader(buf.Bytes()),
+		"stream": iotest.OneByteReader(bytes.NewReader(buf.Bytes())),
+	} {
+		reader, length, err := OpenPNGData(r)
+		if err != nil {
+			t.Fatalf("%s: OpenPNGData failed: %v", name, err)
+		}
+		if length != int64(len(data)) {
+			t.Errorf("%s: length is %d, want %d", name, length, len(data))
+		}
+		got, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("%s: reading chunk data failed: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: chunk data does not match the original", name)
+		}
+	}
+}
+
+func TestOpenPNGDataErrors(t *testing.T) {
+	data := bytes.Repeat([]byte("padlock"), 100)
+	var buf bytes.Buffer
+	if err := encodePNGWithData(&buf, createSmallPNG(), data); err != nil {
+		t.Fatalf("encodePNGWithData failed: %v", err)
+	}
+	png := buf.Bytes()
+	pos := findPNGChunk(png, "rAWd")
+
+	// Corrupt the chunk data; the mismatch is reported at the end of the data
+	damaged := bytes.Clone(png)
+	damaged[pos+8+10] ^= 0xFF
+	reader, _, err := OpenPNGData(bytes.NewReader(damaged))
+	if err != nil {
+		t.Fatalf("OpenPNGData failed: %v", err)
+	}
+	if _, err := io.ReadAll(reader); err == nil || !strings.Contains(err.Error(), "CRC mismatch") {
+		t.Errorf("Expected a CRC mismatch, got %v", err)
+	}
+	if _, err := ExtractDataFromPNG(bytes.NewReader(damaged)); err == nil || !strings.Contains(err.Error(), "CRC mismatch") {
+		t.Errorf("Expected ExtractDataFromPNG to report a CRC mismatch, got %v", err)
+	}
+
+	// Cut off in the middle of the chunk data
+	reader, _, err = OpenPNGData(bytes.NewReader(png[:pos+8+100]))
+	if err != nil {
+		t.Fatalf("OpenPNGData failed: %v", err)
+	}
+	if _, err := io.ReadAll(reader); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected an unexpected EOF for truncated chunk data, got %v", err)
+	}
+
+	// Cut off before the chunk, inside the image data
+	if _, _, err := OpenPNGData(iotest.OneByteReader(bytes.NewReader(png[:pos-2]))); err == nil {
+		t.Errorf("Expected an error for a PNG truncated before its data")
+	}
+
+	// An ordinary image
+	buf.Reset()
+	if err := writeMinimalPNG(&buf, createSmallPNG()); err != nil {
+		t.Fatalf("Failed to write minimal PNG: %v", err)
+	}
+	if _, _, err := OpenPNGData(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrPNGDataNotFound) {
+		t.Errorf("Expected ErrPNGDataNotFound, got %v", err)
+	}
+
+	if _, _, err := OpenPNGData(strings.NewReader("not a PNG")); err == nil {
+		t.Errorf("Expected an error for data that isn't a PNG")
+	}
+}
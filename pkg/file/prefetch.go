@@ -0,0 +1,150 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// ChunkSequence delivers the chunks of one collection in order, returning io.EOF after the
+// last one. CollectionReader is a ChunkSequence.
+type ChunkSequence interface {
+	ReadNextChunk(ctx context.Context) ([]byte, error)
+	Close() error
+}
+
+// PrefetchReader reads the chunks of a collection ahead of its consumer in a separate
+// goroutine, and presents them as a single stream like ChunkReaderAdapter. Decoding with a
+// PrefetchReader per collection fetches upcoming chunks from all collections in parallel,
+// which keeps the decoder fed when collections are on optical media, network mounts, or
+// remote backends with high latency.
+//
+// Up to depth chunks are held ahead of the consumer. If scratchDir is set, prefetched chunks
+// are cached in files there rather than in memory, so that a deep read-ahead doesn't need
+// a matching amount of memory.
+type PrefetchReader struct {
+	name    string
+	items   chan prefetchedChunk
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	source  ChunkSequence
+	scratch string
+	buffer  []byte
+	offset  int
+	err     error
+}
+
+// prefetchedChunk is a chunk held in memory or in a scratch file, or the error that ended
+// the sequence
+type prefetchedChunk struct {
+	data []byte
+	path string
+	err  error
+}
+
+// NewPrefetchReader starts reading ahead up to depth chunks of source, which is closed when
+// the reader is closed. name identifies the collection in logs and errors.
+func NewPrefetchReader(ctx context.Context, name string, source ChunkSequence, depth int, scratchDir string) (*PrefetchReader, error) {
+	log := trace.FromContext(ctx).WithPrefix("PREFETCH")
+
+	r := &PrefetchReader{
+		name:   name,
+		items:  make(chan prefetchedChunk, max(depth, 1)),
+		source: source,
+	}
+	if scratchDir != "" {
+		scratch, err := os.MkdirTemp(scratchDir, "padlock-prefetch-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create prefetch cache for collection %s: %w", name, err)
+		}
+		r.scratch = scratch
+	}
+	log.Debugf("Prefetching up to %d chunks of collection %s", cap(r.items), name)
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.wg.Add(1)
+	go r.fetch(ctx)
+	return r, nil
+}
+
+// fetch reads chunks from the source until it ends, fails, or the reader is closed
+func (r *PrefetchReader) fetch(ctx context.Context) {
+	defer r.wg.Done()
+	defer close(r.items)
+
+	for chunk := 1; ; chunk++ {
+		var item prefetchedChunk
+		data, err := r.source.ReadNextChunk(ctx)
+		switch {
+		case err != nil:
+			item.err = err
+		case r.scratch != "":
+			item.path = filepath.Join(r.scratch, fmt.Sprintf("%08d", chunk))
+			if werr := os.WriteFile(item.path, data, 0600); werr != nil {
+				item = prefetchedChunk{err: fmt.Errorf("failed to cache chunk %d of collection %s: %w", chunk, r.name, werr)}
+			}
+		default:
+			item.data = data
+		}
+
+		select {
+		case r.items <- item:
+		case <-ctx.Done():
+			return
+		}
+		if item.err != nil {
+			return
+		}
+	}
+}
+
+// Read implements io.Reader, returning the prefetched chunks as one continuous stream
+func (r *PrefetchReader) Read(p []byte) (int, error) {
+	for r.offset >= len(r.buffer) {
+		if r.err != nil {
+			return 0, r.err
+		}
+		item, ok := <-r.items
+		if !ok {
+			r.err = fmt.Errorf("prefetch of collection %s stopped: %w", r.name, context.Canceled)
+			continue
+		}
+		if item.err != nil {
+			r.err = item.err
+			continue
+		}
+		if item.path != "" {
+			data, err := os.ReadFile(item.path)
+			os.Remove(item.path)
+			if err != nil {
+				r.err = fmt.Errorf("failed to read cached chunk of collection %s: %w", r.name, err)
+				continue
+			}
+			item.data = data
+		}
+		r.buffer, r.offset = item.data, 0
+	}
+
+	n := copy(p, r.buffer[r.offset:])
+	r.offset += n
+	return n, nil
+}
+
+// Close stops prefetching, closes the source, and removes any cached chunks
+func (r *PrefetchReader) Close() error {
+	r.cancel()
+	r.wg.Wait()
+	err := r.source.Close()
+	if r.scratch != "" {
+		if rerr := os.RemoveAll(r.scratch); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
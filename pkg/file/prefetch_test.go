@@ -0,0 +1,156 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// sliceSequence is a ChunkSequence over in-memory chunks that records how far it was read
+type sliceSequence struct {
+	mu     sync.Mutex
+	chunks [][]byte
+	next   int
+	err    error // Returned instead of io.EOF after the last chunk, if set
+	closed bool
+}
+
+func (s *sliceSequence) ReadNextChunk(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next >= len(s.chunks) {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	s.next++
+	return s.chunks[s.next-1], nil
+}
+
+func (s *sliceSequence) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *sliceSequence) read() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next
+}
+
+func newSliceSequence(n int) (*sliceSequence, []byte) {
+	seq := &sliceSequence{}
+	var all []byte
+	for i := 0; i < n; i++ {
+		chunk := []byte(fmt.Sprintf("chunk %d payload;", i+1))
+		seq.chunks = append(seq.chunks, chunk)
+		all = append(all, chunk...)
+	}
+	return seq, all
+}
+
+func TestPrefetchReader(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	scratchDir, err := os.MkdirTemp("", "padlock-prefetch-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(scratchDir)
+
+	for _, dir := range []string{"", scratchDir} {
+		seq, want := newSliceSequence(20)
+		r, err := NewPrefetchReader(ctx, "2A3", seq, 4, dir)
+		if err != nil {
+			t.Fatalf("Failed to create prefetch reader: %v", err)
+		}
+
+		// Chunks are read ahead before the consumer asks for them
+		deadline := time.Now().Add(5 * time.Second)
+		for seq.read() < 4 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if seq.read() < 4 {
+			t.Errorf("Expected at least 4 chunks to be prefetched, got %d", seq.read())
+		}
+
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("Failed to read prefetched stream: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Prefetched stream doesn't match the chunks:\n got %q\nwant %q", got, want)
+		}
+
+		if err := r.Close(); err != nil {
+			t.Errorf("Failed to close prefetch reader: %v", err)
+		}
+		if !seq.closed {
+			t.Errorf("Expected the source to be closed")
+		}
+	}
+
+	// The scratch cache is removed on close
+	entries, err := os.ReadDir(scratchDir)
+	if err != nil {
+		t.Fatalf("Failed to read scratch dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected the scratch dir to be empty after close, found %d entries", len(entries))
+	}
+}
+
+func TestPrefetchReaderError(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	failure := errors.New("media error")
+	seq, want := newSliceSequence(3)
+	seq.err = failure
+	r, err := NewPrefetchReader(ctx, "2A3", seq, 2, "")
+	if err != nil {
+		t.Fatalf("Failed to create prefetch reader: %v", err)
+	}
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the source error, got %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Expected the chunks before the error, got %q", got)
+	}
+}
+
+func TestPrefetchReaderCloseEarly(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	// Closing before the stream is consumed stops the prefetch goroutine
+	seq, _ := newSliceSequence(100)
+	r, err := NewPrefetchReader(ctx, "2A3", seq, 2, "")
+	if err != nil {
+		t.Fatalf("Failed to create prefetch reader: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Failed to close prefetch reader: %v", err)
+	}
+	if seq.read() == 100 {
+		t.Errorf("Expected prefetching to stop when closed")
+	}
+}
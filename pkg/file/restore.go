@@ -0,0 +1,155 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// RestoreManifestName is the checkpoint manifest decode keeps in the output directory while
+// it restores files. It is removed when the decode completes.
+const RestoreManifestName = ".padlock-restored"
+
+// restoredFile is a line of the restore manifest: a file that was completely restored
+type restoredFile struct {
+	Name    string `json:"name"`     // Path relative to the output directory, as in the serialized stream
+	Size    int64  `json:"size"`     // Size of the restored file
+	ModTime int64  `json:"mod_time"` // Modification time of the restored file, in Unix nanoseconds
+}
+
+// RestoreManifest records the files that a decode has completely restored, one JSON line per
+// file appended as each is closed, so that a decode that was interrupted can be run again
+// and skip writing them. A file is only skipped if it still has the size and modification
+// time recorded for it, so files changed or truncated since are restored again.
+type RestoreManifest struct {
+	outputDir string
+	f         *os.File
+	restored  map[string]restoredFile
+}
+
+// OpenRestoreManifest opens the restore manifest in outputDir. If resume is set, the files
+// recorded by an earlier decode are loaded and the manifest is appended to; otherwise a new,
+// empty manifest is started.
+func OpenRestoreManifest(outputDir string, resume bool) (*RestoreManifest, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	path := filepath.Join(outputDir, RestoreManifestName)
+	m := &RestoreManifest{outputDir: outputDir, restored: make(map[string]restoredFile)}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		if err := m.load(path); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open restore manifest: %w", err)
+	}
+	m.f = f
+	return m, nil
+}
+
+// load reads the files recorded in an existing manifest. A line cut short by a crash is
+// ignored, which only means that its file is restored again.
+func (m *RestoreManifest) load(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read restore manifest: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry restoredFile
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Name == "" {
+			continue
+		}
+		m.restored[entry.Name] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read restore manifest: %w", err)
+	}
+	return nil
+}
+
+// Len returns the number of files recorded as restored
+func (m *RestoreManifest) Len() int {
+	return len(m.restored)
+}
+
+// Files returns the names of the files recorded as restored, sorted
+func (m *RestoreManifest) Files() []string {
+	names := make([]string, 0, len(m.restored))
+	for name := range m.restored {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Restored reports whether the file name, of the given size, was completely restored by an
+// earlier decode and is unchanged since
+func (m *RestoreManifest) Restored(name string, size int64) bool {
+	entry, ok := m.restored[name]
+	if !ok || entry.Size != size {
+		return false
+	}
+	info, err := os.Lstat(filepath.Join(m.outputDir, name))
+	return err == nil && info.Mode().IsRegular() && info.Size() == entry.Size && info.ModTime().UnixNano() == entry.ModTime
+}
+
+// Record appends a file that has just been completely restored
+func (m *RestoreManifest) Record(name string) error {
+	info, err := os.Stat(filepath.Join(m.outputDir, name))
+	if err != nil {
+		return fmt.Errorf("failed to record restored file: %w", err)
+	}
+	entry := restoredFile{Name: name, Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to record restored file: %w", err)
+	}
+	if _, err := m.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to record restored file: %w", err)
+	}
+	m.restored[name] = entry
+	return nil
+}
+
+// Forget forgets the files recorded so far, so that a later payload holding files of the same
+// names restores them again. They are kept in the manifest file for a resume.
+func (m *RestoreManifest) Forget() {
+	m.restored = make(map[string]restoredFile)
+}
+
+// Close closes the manifest, leaving it in place for a later resume
+func (m *RestoreManifest) Close() error {
+	if m.f == nil {
+		return nil
+	}
+	err := m.f.Close()
+	m.f = nil
+	return err
+}
+
+// Remove closes and deletes the manifest, once the decode is complete
+func (m *RestoreManifest) Remove() error {
+	m.Close()
+	if err := os.Remove(filepath.Join(m.outputDir, RestoreManifestName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove restore manifest: %w", err)
+	}
+	return nil
+}
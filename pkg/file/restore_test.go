@@ -0,0 +1,179 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestRestoreManifest(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "padlock-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for name, content := range map[string]string{"a.txt": "alpha", "b.txt": "bravo", "c.txt": "charlie"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	m, err := OpenRestoreManifest(tempDir, false)
+	if err != nil {
+		t.Fatalf("OpenRestoreManifest failed: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := m.Record(name); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	m.Close()
+
+	// A crash while appending leaves a partial line, which is ignored
+	f, err := os.OpenFile(filepath.Join(tempDir, RestoreManifestName), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open manifest: %v", err)
+	}
+	f.WriteString(`{"name":"d.txt","si`)
+	f.Close()
+
+	// b.txt is changed after it was restored
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(tempDir, "b.txt"), later, later); err != nil {
+		t.Fatalf("Failed to change modification time: %v", err)
+	}
+
+	m, err = OpenRestoreManifest(tempDir, true)
+	if err != nil {
+		t.Fatalf("OpenRestoreManifest failed: %v", err)
+	}
+	if m.Len() != 3 {
+		t.Errorf("Expected 3 restored files, got %d", m.Len())
+	}
+	if !m.Restored("a.txt", 5) {
+		t.Errorf("Expected a.txt to be restored")
+	}
+	if m.Restored("a.txt", 6) {
+		t.Errorf("Expected a.txt of a different size not to be restored")
+	}
+	if m.Restored("b.txt", 5) {
+		t.Errorf("Expected b.txt, changed since, not to be restored")
+	}
+	if m.Restored("d.txt", 0) {
+		t.Errorf("Expected d.txt, recorded only in part, not to be restored")
+	}
+	if err := m.Remove(); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, RestoreManifestName)); !os.IsNotExist(err) {
+		t.Errorf("Expected the manifest to be removed")
+	}
+
+	// Without resume, a new manifest starts empty
+	m, err = OpenRestoreManifest(tempDir, false)
+	if err != nil {
+		t.Fatalf("OpenRestoreManifest failed: %v", err)
+	}
+	defer m.Close()
+	if m.Len() != 0 || m.Restored("a.txt", 5) {
+		t.Errorf("Expected a new manifest to be empty")
+	}
+}
+
+func TestDeserializeDirectoryWithManifest(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "padlock-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	files := map[string]string{"one.txt": "first file", "sub/two.txt": "second file", "three.txt": "third file"}
+	var stream bytes.Buffer
+	tw := tar.NewWriter(&stream)
+	tw.WriteHeader(&tar.Header{Name: "sub", Typeflag: tar.TypeDir, Mode: 0755})
+	for _, name := range []string{"one.txt", "sub/two.txt", "three.txt"} {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(files[name]))})
+		tw.Write([]byte(files[name]))
+	}
+	tw.Close()
+
+	// An interrupted decode restored one.txt, and started on sub/two.txt
+	outputDir := filepath.Join(tempDir, "output")
+	if err := os.MkdirAll(filepath.Join(outputDir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create output dir: %v", err)
+	}
+	os.WriteFile(filepath.Join(outputDir, "one.txt"), []byte(files["one.txt"]), 0644)
+	os.WriteFile(filepath.Join(outputDir, "sub/two.txt"), []byte("sec"), 0644)
+	m, err := OpenRestoreManifest(outputDir, false)
+	if err != nil {
+		t.Fatalf("OpenRestoreManifest failed: %v", err)
+	}
+	m.Record("one.txt")
+	m.Close()
+	before, _ := os.Stat(filepath.Join(outputDir, "one.txt"))
+
+	m, err = OpenRestoreManifest(outputDir, true)
+	if err != nil {
+		t.Fatalf("OpenRestoreManifest failed: %v", err)
+	}
+	defer m.Close()
+	if err := DeserializeDirectoryWithManifest(ctx, outputDir, bytes.NewReader(stream.Bytes()), false, m); err != nil {
+		t.Fatalf("DeserializeDirectoryWithManifest failed: %v", err)
+	}
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil || string(got) != content {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, content)
+		}
+	}
+	after, _ := os.Stat(filepath.Join(outputDir, "one.txt"))
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("Expected one.txt, already restored, not to be rewritten")
+	}
+	if m.Len() != 3 {
+		t.Errorf("Expected all 3 files to be recorded, got %d", m.Len())
+	}
+}
+
+func TestDeserializeTruncatedFile(t *testing.T) {
+	tempDir := t.TempDir()
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	var stream bytes.Buffer
+	tw := tar.NewWriter(&stream)
+	for _, name := range []string{"one.txt", "two.txt", "three.txt"} {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: 2000})
+		tw.Write(bytes.Repeat([]byte(name[:1]), 2000))
+	}
+	tw.Close()
+
+	// The stream ends 1000 bytes into two.txt
+	m, err := OpenRestoreManifest(tempDir, false)
+	if err != nil {
+		t.Fatalf("OpenRestoreManifest failed: %v", err)
+	}
+	defer m.Close()
+	cut := bytes.NewReader(stream.Bytes()[:512+2048+512+1000])
+	err = DeserializeDirectoryWithManifest(ctx, tempDir, cut, false, m)
+	var truncated *TruncatedFileError
+	if !errors.As(err, &truncated) {
+		t.Fatalf("Expected a TruncatedFileError, got %v", err)
+	}
+	if truncated.Name != "two.txt" || truncated.Written != 1000 || truncated.Size != 2000 {
+		t.Errorf("Expected two.txt cut short after 1000 of 2000 bytes, got %s after %d of %d", truncated.Name, truncated.Written, truncated.Size)
+	}
+	if files := m.Files(); len(files) != 1 || files[0] != "one.txt" {
+		t.Errorf("Expected only one.txt to be recorded as restored, got %q", files)
+	}
+}
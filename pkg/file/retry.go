@@ -0,0 +1,114 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// RetryPolicy controls how chunk reads and writes are retried after transient IO failures.
+//
+// Only operations that can be safely repeated are retried: whole chunk files written or read
+// in files mode. Appends to a TAR stream are never retried, since a partial write cannot be
+// undone. Permanent failures (missing files, permission errors, a full disk) are returned
+// immediately so that retries never mask a real problem.
+type RetryPolicy struct {
+	MaxAttempts  int           // Total attempts including the first; values below 2 disable retries
+	InitialDelay time.Duration // Delay before the first retry
+	MaxDelay     time.Duration // Upper bound for the delay between attempts
+	Multiplier   float64       // Factor applied to the delay after each failed attempt
+}
+
+// DefaultRetryPolicy performs a single attempt with no retries.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+// NewRetryPolicy returns a policy that makes up to attempts tries, starting with the given
+// delay and doubling it after each failure up to a maximum of 30 seconds
+func NewRetryPolicy(attempts int, initialDelay time.Duration) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  attempts,
+		InitialDelay: initialDelay,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+	}
+}
+
+// IsTransientError reports whether err is likely to succeed if the operation is repeated,
+// such as a timeout or a stale handle on a network filesystem.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		switch errno {
+		case syscall.EAGAIN, syscall.EINTR, syscall.EBUSY, syscall.EIO, syscall.ETIMEDOUT,
+			syscall.ECONNRESET, syscall.ECONNABORTED, syscall.ECONNREFUSED,
+			syscall.EHOSTUNREACH, syscall.ENETUNREACH, syscall.ENETDOWN, syscall.ESTALE:
+			return true
+		}
+	}
+	return false
+}
+
+// Do runs fn, retrying with exponential backoff while it fails with a transient error.
+// The operation name is used only for logging.
+func (p RetryPolicy) Do(ctx context.Context, operation string, fn func() error) error {
+	log := trace.FromContext(ctx).WithPrefix("RETRY")
+
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := p.InitialDelay
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil {
+			if attempt > 1 {
+				log.Infof("%s succeeded on attempt %d of %d", operation, attempt, attempts)
+			}
+			return nil
+		}
+		if !IsTransientError(err) || attempt == attempts {
+			break
+		}
+
+		log.Infof("%s failed with transient error (attempt %d of %d), retrying in %s: %v", operation, attempt, attempts, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w (retry interrupted: %v)", operation, err, ctx.Err())
+		}
+
+		delay = time.Duration(float64(delay) * multiplier)
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"EIO", syscall.EIO, true},
+		{"wrapped ETIMEDOUT", &os.PathError{Op: "open", Path: "x", Err: syscall.ETIMEDOUT}, true},
+		{"deadline", fmt.Errorf("write: %w", os.ErrDeadlineExceeded), true},
+		{"not exist", os.ErrNotExist, false},
+		{"permission", &os.PathError{Op: "open", Path: "x", Err: syscall.EACCES}, false},
+		{"canceled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransientError(tt.err); got != tt.want {
+				t.Errorf("IsTransientError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	policy := NewRetryPolicy(3, time.Millisecond)
+
+	// Transient failures are retried until the operation succeeds
+	calls := 0
+	err := policy.Do(ctx, "flaky", func() error {
+		calls++
+		if calls < 3 {
+			return syscall.EIO
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("flaky operation: err=%v calls=%d, want nil and 3", err, calls)
+	}
+
+	// Attempts are bounded
+	calls = 0
+	err = policy.Do(ctx, "failing", func() error {
+		calls++
+		return syscall.EIO
+	})
+	if !errors.Is(err, syscall.EIO) || calls != 3 {
+		t.Errorf("failing operation: err=%v calls=%d, want EIO and 3", err, calls)
+	}
+
+	// Permanent errors are returned immediately
+	calls = 0
+	err = policy.Do(ctx, "missing", func() error {
+		calls++
+		return os.ErrNotExist
+	})
+	if !errors.Is(err, os.ErrNotExist) || calls != 1 {
+		t.Errorf("permanent error: err=%v calls=%d, want ErrNotExist and 1", err, calls)
+	}
+
+	// The default policy makes a single attempt
+	calls = 0
+	_ = DefaultRetryPolicy.Do(ctx, "default", func() error {
+		calls++
+		return syscall.EIO
+	})
+	if calls != 1 {
+		t.Errorf("default policy made %d attempts, want 1", calls)
+	}
+
+	// Cancellation interrupts the backoff
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	calls = 0
+	err = NewRetryPolicy(5, time.Hour).Do(cctx, "cancelled", func() error {
+		calls++
+		return syscall.EIO
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("cancelled retry: err=%v calls=%d, want error and 1", err, calls)
+	}
+}
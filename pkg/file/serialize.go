@@ -7,112 +7,295 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/blues/padlock/pkg/trace"
 )
 
 // SerializeDirectoryToStream takes an input directory path and generates an io.Reader
-// which is a 'tar' stream of the entire directory.
+// which is a 'tar' stream of the entire directory. A regular file given instead of a
+// directory is serialized as a stream holding just that file, under its name.
 func SerializeDirectoryToStream(ctx context.Context, inputDir string) (io.ReadCloser, error) {
+	return SerializeDirectoryWithFilter(ctx, inputDir, nil)
+}
+
+// SerializeDirectoryWithFilter is SerializeDirectoryToStream, leaving out the entries filter
+// doesn't select, if it is not nil
+func SerializeDirectoryWithFilter(ctx context.Context, inputDir string, filter *Filter) (io.ReadCloser, error) {
+	return SerializeDirectoriesWithFilter(ctx, []string{inputDir}, filter)
+}
+
+// SerializeDirectoriesWithFilter serializes several input directories into one tar stream,
+// each under a top-level directory named as InputRootNames names it, so that they decode
+// side by side. A single directory is serialized as SerializeDirectoryWithFilter does, with
+// its entries at the top. The filter's patterns apply within each directory.
+func SerializeDirectoriesWithFilter(ctx context.Context, inputDirs []string, filter *Filter) (io.ReadCloser, error) {
 	log := trace.FromContext(ctx).WithPrefix("serialize")
-	log.Debugf("Serializing directory to tar stream: %s", inputDir)
+	log.Debugf("Serializing to tar stream: %s", strings.Join(inputDirs, ", "))
 	pr, pw := io.Pipe()
 
 	go func() {
 		defer pw.Close()
 
+		// Cancelling ctx unblocks a write to a reader that has stopped reading
+		defer context.AfterFunc(ctx, func() { pw.CloseWithError(ctx.Err()) })()
+
 		log.Debugf("Creating tar writer")
 		tw := tar.NewWriter(pw)
 		defer tw.Close()
 
-		fileCount := 0
-		totalBytes := int64(0)
-
-		// Walk through the directory
-		err := filepath.Walk(inputDir, func(path string, info os.FileInfo, walkErr error) error {
-			if walkErr != nil {
-				log.Error(fmt.Errorf("error walking path %s: %w", path, walkErr))
-				return walkErr
+		if err := writeInputs(ctx, tw, inputDirs, filter, nil); err != nil {
+			// A reader that closed the stream stopped reading it on purpose, such as after a sample
+			if !errors.Is(err, io.ErrClosedPipe) {
+				log.Error(fmt.Errorf("error during directory serialization: %w", err))
 			}
+			pw.CloseWithError(fmt.Errorf("error during directory serialization: %w", err))
+		}
+	}()
 
-			// Skip the input directory itself
-			if path == inputDir {
-				return nil
-			}
+	return pr, nil
+}
 
-			// Skip symlinks
-			if info.Mode()&os.ModeSymlink != 0 {
-				return nil
-			}
+// writeInputs writes the entries of inputDirs that filter selects to tw, followed by the hash
+// manifest. If startEntry is not nil, it is called with the name and size of each entry,
+// including the hash manifest, before its headers are written.
+func writeInputs(ctx context.Context, tw *tar.Writer, inputDirs []string, filter *Filter, startEntry func(name string, isDir bool, size int64) error) error {
+	log := trace.FromContext(ctx).WithPrefix("serialize")
 
-			// Get the relative path for the tar entry
-			rel, err := filepath.Rel(inputDir, path)
-			if err != nil {
-				log.Error(fmt.Errorf("failed to determine relative path: %w", err))
-				return err
-			}
+	fileCount := 0
+	totalBytes := int64(0)
+	hashes := &HashManifest{Version: hashManifestVersion}
 
-			// Create a tar header
-			header, err := tar.FileInfoHeader(info, "")
-			if err != nil {
-				log.Error(fmt.Errorf("tar FileInfoHeader for %s: %w", path, err))
-				return err
-			}
-			header.Name = rel
+	// Walk through the entries of the directory the filter selects, skipping symlinks
+	err := walkInputs(inputDirs, filter, func(path, rel string, info os.FileInfo) error {
+		// Stop if the operation was cancelled or its deadline passed
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Create a tar header
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			log.Error(fmt.Errorf("tar FileInfoHeader for %s: %w", path, err))
+			return err
+		}
+		header.Name = rel
 
-			// Write the header to the tar stream
-			if err := tw.WriteHeader(header); err != nil {
-				log.Error(fmt.Errorf("tar WriteHeader for %s: %w", rel, err))
+		// Write the header to the tar stream
+		if startEntry != nil {
+			if err := startEntry(rel, info.IsDir(), header.Size); err != nil {
 				return err
 			}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			log.Error(fmt.Errorf("tar WriteHeader for %s: %w", rel, err))
+			return err
+		}
 
-			// For directories, we're done after writing the header
-			if info.IsDir() {
-				return nil
-			}
+		// For directories, we're done after writing the header
+		if info.IsDir() {
+			return nil
+		}
 
-			// Open the file to copy its contents
-			f, err := os.Open(path)
-			if err != nil {
-				log.Error(fmt.Errorf("open file for tar %s: %w", path, err))
-				return err
-			}
-			defer f.Close()
+		// Open the file to copy its contents
+		f, err := os.Open(path)
+		if err != nil {
+			log.Error(fmt.Errorf("open file for tar %s: %w", path, err))
+			return err
+		}
+		defer f.Close()
 
-			// Copy the file data to the tar stream
-			n, err := io.Copy(tw, f)
-			if err != nil {
+		// Copy the file data to the tar stream, hashing it for the manifest
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(tw, h), NewContextReader(ctx, f))
+		if err != nil {
+			if !errors.Is(err, io.ErrClosedPipe) {
 				log.Error(fmt.Errorf("io.Copy to tar for %s: %w", rel, err))
-				return err
 			}
+			return err
+		}
+		hashes.Files = append(hashes.Files, HashedFile{Name: rel, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))})
 
-			fileCount++
-			totalBytes += n
-			log.Infof("%s (%d bytes)", rel, n)
+		fileCount++
+		totalBytes += n
+		log.Infof("%s (%d bytes)", rel, n)
 
-			return nil
-		})
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
 
+	// End the stream with the hash of every file, for decode to check the restored files
+	if startEntry != nil {
+		if err := startEntry(HashManifestName, false, 0); err != nil {
+			return err
+		}
+	}
+	if err := writeHashManifest(tw, hashes); err != nil {
+		return err
+	}
+
+	log.Debugf("Directory serialization complete: %d files, %d bytes", fileCount, totalBytes)
+	return nil
+}
+
+// InputRootNames returns the top-level directory each of several input directories is
+// serialized under: its base name, with -2, -3, and so on added to names already taken, so
+// that directories with the same name in different places are kept apart. A single
+// directory has no top-level directory, so its name is empty.
+func InputRootNames(inputDirs []string) []string {
+	names := make([]string, len(inputDirs))
+	if len(inputDirs) < 2 {
+		return names
+	}
+	taken := make(map[string]bool)
+	for i, dir := range inputDirs {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		base := filepath.Base(dir)
+		if base == string(filepath.Separator) || base == "." || filepath.VolumeName(dir)+string(filepath.Separator) == dir {
+			base = "root"
+		}
+		name := base
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s-%d", base, n)
+		}
+		taken[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+// walkInputs calls fn for each entry of inputDirs that filter selects, as walkInput does, with
+// rel relative to the top of the stream: under the top-level directory InputRootNames names,
+// which is passed to fn first, when there are several. An input that is a regular file is
+// passed to fn as the one entry it contributes, under its name.
+func walkInputs(inputDirs []string, filter *Filter, fn func(path, rel string, info os.FileInfo) error) error {
+	names := InputRootNames(inputDirs)
+	for i, inputDir := range inputDirs {
+		info, err := os.Stat(inputDir)
 		if err != nil {
-			log.Error(fmt.Errorf("error during directory serialization: %w", err))
-			pw.CloseWithError(fmt.Errorf("error during directory serialization: %w", err))
-			return
+			return err
+		}
+		if !info.IsDir() {
+			name := names[i]
+			if name == "" {
+				name = filepath.Base(inputDir)
+			}
+			if err := fn(inputDir, name, info); err != nil {
+				return err
+			}
+			continue
 		}
+		if names[i] == "" {
+			if err := walkInput(inputDir, filter, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(inputDir, names[i], info); err != nil {
+			return err
+		}
+		err = walkInput(inputDir, filter, func(path, rel string, info os.FileInfo) error {
+			return fn(path, filepath.Join(names[i], rel), info)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		log.Debugf("Directory serialization complete: %d files, %d bytes", fileCount, totalBytes)
-	}()
+// writeHashManifest writes the hash manifest as the last entry of a serialized stream
+func writeHashManifest(tw *tar.Writer, hashes *HashManifest) error {
+	data, err := json.Marshal(hashes)
+	if err != nil {
+		return fmt.Errorf("failed to encode hash manifest: %w", err)
+	}
+	header := &tar.Header{
+		Name:       HashManifestName,
+		Mode:       0644,
+		Size:       int64(len(data)),
+		ModTime:    time.Unix(0, 0), // Fixed, so that serializing the same input gives the same stream, as resuming an encode needs
+		Typeflag:   tar.TypeReg,
+		PAXRecords: map[string]string{hashManifestPAXKey: fmt.Sprint(hashManifestVersion)},
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write hash manifest: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write hash manifest: %w", err)
+	}
+	return nil
+}
 
-	return pr, nil
+// EstimateSerializedSize walks inputDir without reading any files and returns roughly the
+// number of bytes SerializeDirectoryToStream would produce for it: a header for each entry,
+// the file data padded to whole blocks, the hash manifest, and the end of archive marker. Long names, which need
+// extended headers, make the estimate slightly low.
+func EstimateSerializedSize(ctx context.Context, inputDir string) (int64, error) {
+	return EstimateSerializedSizeWithFilter(ctx, inputDir, nil)
+}
+
+// EstimateSerializedSizeWithFilter is EstimateSerializedSize for the entries filter selects,
+// if it is not nil
+func EstimateSerializedSizeWithFilter(ctx context.Context, inputDir string, filter *Filter) (int64, error) {
+	return EstimateDirectoriesSizeWithFilter(ctx, []string{inputDir}, filter)
+}
+
+// EstimateDirectoriesSizeWithFilter is EstimateSerializedSizeWithFilter for the stream
+// SerializeDirectoriesWithFilter produces for several input directories
+func EstimateDirectoriesSizeWithFilter(ctx context.Context, inputDirs []string, filter *Filter) (int64, error) {
+	const block = 512
+	size := int64(2 * block)
+	manifest := int64(0)
+	err := walkInputs(inputDirs, filter, func(path, rel string, info os.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		size += block
+		if info.Mode().IsRegular() {
+			size += (info.Size() + block - 1) / block * block
+			manifest += int64(len(rel)) + 120 // Its line in the hash manifest, roughly
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan input directory: %w", err)
+	}
+	size += 3*block + (manifest+block-1)/block*block // The hash manifest with its PAX record
+	return size, nil
 }
 
 // DeserializeDirectoryFromStream takes a tar stream and extracts its contents
 // to the specified output directory. It returns errors encountered during extraction.
 func DeserializeDirectoryFromStream(ctx context.Context, outputDir string, r io.Reader, clearIfNotEmpty bool) error {
+	return DeserializeDirectoryWithManifest(ctx, outputDir, r, clearIfNotEmpty, nil)
+}
+
+// DeserializeDirectoryWithManifest is DeserializeDirectoryFromStream, recording each file it
+// restores in manifest, if not nil, and skipping files the manifest says were already
+// restored by an earlier, interrupted decode. Skipped files are still read from the stream.
+func DeserializeDirectoryWithManifest(ctx context.Context, outputDir string, r io.Reader, clearIfNotEmpty bool, manifest *RestoreManifest) error {
+	return DeserializeDirectoryWithFilter(ctx, outputDir, r, clearIfNotEmpty, manifest, nil)
+}
+
+// DeserializeDirectoryWithFilter is DeserializeDirectoryWithManifest, restoring only the
+// entries filter selects, if it is not nil. The rest are read past. The restored files are
+// checked against the hash manifest's entries for the files the filter selects.
+func DeserializeDirectoryWithFilter(ctx context.Context, outputDir string, r io.Reader, clearIfNotEmpty bool, manifest *RestoreManifest, filter *Filter) error {
 	log := trace.FromContext(ctx).WithPrefix("deserialize")
 	log.Debugf("Deserializing to directory: %s", outputDir)
 
@@ -130,6 +313,9 @@ func DeserializeDirectoryFromStream(ctx context.Context, outputDir string, r io.
 
 	log.Debugf("Directory prepared, now reading input stream")
 
+	// Stop extracting between reads once the operation is cancelled
+	r = NewContextReader(ctx, r)
+
 	// Process extraction in a streaming manner
 	done := make(chan error)
 	go func() {
@@ -181,7 +367,7 @@ func DeserializeDirectoryFromStream(ctx context.Context, outputDir string, r io.
 
 					// Process using streaming tar reader
 					tarReader := tar.NewReader(io.MultiReader(bytes.NewReader(decompBuffer[:bytesRead]), gzr))
-					if err := streamTarToDirectory(ctx, outputDir, tarReader, log); err != nil {
+					if err := streamTarToDirectory(ctx, outputDir, tarReader, manifest, filter, log); err != nil {
 						done <- err
 						return
 					}
@@ -215,8 +401,6 @@ func DeserializeDirectoryFromStream(ctx context.Context, outputDir string, r io.
 					}
 
 					log.Infof("Wrote decompressed data to %s (%d bytes)", outfile, written+int64(bytesRead))
-					fmt.Printf("\nDecoding completed successfully. Output saved to %s (%d bytes)\n",
-						outfile, written+int64(bytesRead))
 				}
 
 				done <- nil
@@ -270,7 +454,6 @@ func DeserializeDirectoryFromStream(ctx context.Context, outputDir string, r io.
 
 			totalBytes := written + int64(n)
 			log.Infof("Successfully wrote %d bytes to %s", totalBytes, outfile)
-			fmt.Printf("\nDecoding completed successfully. Output saved to %s (%d bytes)\n", outfile, totalBytes)
 
 			done <- nil
 			return
@@ -291,7 +474,7 @@ func DeserializeDirectoryFromStream(ctx context.Context, outputDir string, r io.
 
 			// Process using streaming tar reader with decompressed data
 			tarReader := tar.NewReader(gzr)
-			if err := streamTarToDirectory(ctx, outputDir, tarReader, log); err != nil {
+			if err := streamTarToDirectory(ctx, outputDir, tarReader, manifest, filter, log); err != nil {
 				done <- err
 				return
 			}
@@ -301,7 +484,7 @@ func DeserializeDirectoryFromStream(ctx context.Context, outputDir string, r io.
 
 			// Set up tar reader directly
 			tarReader := tar.NewReader(fullStream)
-			if err := streamTarToDirectory(ctx, outputDir, tarReader, log); err != nil {
+			if err := streamTarToDirectory(ctx, outputDir, tarReader, manifest, filter, log); err != nil {
 				done <- err
 				return
 			}
@@ -315,21 +498,50 @@ func DeserializeDirectoryFromStream(ctx context.Context, outputDir string, r io.
 	return err
 }
 
+// TruncatedFileError reports a file that was only partly restored because the stream ended
+// or failed while it was being written. What was written of it is left in the output
+// directory.
+type TruncatedFileError struct {
+	Name    string // Path relative to the output directory, as in the serialized stream
+	Written int64  // Bytes of the file that were restored
+	Size    int64  // Size of the file in the stream
+	Err     error  // Why the rest couldn't be restored
+}
+
+func (e *TruncatedFileError) Error() string {
+	return fmt.Sprintf("file %s was cut short after %d of %d bytes: %v", e.Name, e.Written, e.Size, e.Err)
+}
+
+func (e *TruncatedFileError) Unwrap() error {
+	return e.Err
+}
+
 // streamTarToDirectory extracts a tar stream to a directory using streaming I/O
 // This helper function processes tar entries one by one without loading the entire tar file
 // into memory, making it suitable for very large archives.
-func streamTarToDirectory(ctx context.Context, outputDir string, tr *tar.Reader, log *trace.Tracer) error {
+func streamTarToDirectory(ctx context.Context, outputDir string, tr *tar.Reader, manifest *RestoreManifest, filter *Filter, log *trace.Tracer) error {
 	fileCount := 0
+	skippedCount := 0
 	totalBytes := int64(0)
 	progressInterval := 100 // Log progress every N files
 	progressCounter := 0
 	lastProgressTime := time.Now()
 	progressUpdateInterval := 5 * time.Second // Minimum time between progress updates
+	var hashes *HashManifest
+	restored := make(map[string]HashedFile)
 
 	// Iterate through tar entries
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		header, err := tr.Next()
 		if err == io.EOF {
+			if fileCount == 0 && filter != nil {
+				log.Error(fmt.Errorf("no files in the tar archive are selected"))
+				return fmt.Errorf("no files in the tar archive are selected")
+			}
 			if fileCount == 0 {
 				log.Error(fmt.Errorf("no files found in tar archive"))
 				return fmt.Errorf("no files found in tar archive")
@@ -341,6 +553,25 @@ func streamTarToDirectory(ctx context.Context, outputDir string, tr *tar.Reader,
 			return fmt.Errorf("tar header read error: %w", err)
 		}
 
+		// The hash manifest at the end of the stream is checked against, not restored
+		if isHashManifest(header) {
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				log.Error(fmt.Errorf("failed to read hash manifest: %w", err))
+				return err
+			}
+			if hashes, err = parseHashManifest(data); err != nil {
+				log.Error(fmt.Errorf("restored files can't be verified: %w", err))
+			}
+			continue
+		}
+
+		// The chunk index only locates entries for decode, and entries that weren't selected
+		// are read past
+		if isChunkIndex(header) || !filter.Selects(header.Name, header.Typeflag == tar.TypeDir) {
+			continue
+		}
+
 		// Get the full path for extraction
 		outPath := filepath.Join(outputDir, header.Name)
 
@@ -363,6 +594,23 @@ func streamTarToDirectory(ctx context.Context, outputDir string, tr *tar.Reader,
 			return err
 		}
 
+		// Files restored completely by an earlier, interrupted decode are read past, not rewritten
+		if manifest != nil && manifest.Restored(header.Name, header.Size) {
+			h := sha256.New()
+			n, err := io.Copy(h, tr)
+			if err != nil {
+				log.Error(fmt.Errorf("failed to read file %s: %w", header.Name, err))
+				return err
+			}
+			restored[header.Name] = HashedFile{Name: header.Name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}
+			fileCount++
+			skippedCount++
+			if log.IsVerbose() {
+				log.Debugf("Already restored: %s", outPath)
+			}
+			continue
+		}
+
 		// Create the file for writing
 		if log.IsVerbose() {
 			log.Debugf("Creating file: %s", outPath)
@@ -373,12 +621,22 @@ func streamTarToDirectory(ctx context.Context, outputDir string, tr *tar.Reader,
 			return err
 		}
 
-		// Copy file contents
-		n, err := io.Copy(file, tr)
-		file.Close()
+		// Copy file contents, hashing them to check against the hash manifest
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(file, h), tr)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
 		if err != nil {
 			log.Error(fmt.Errorf("failed to write file %s: %w", outPath, err))
-			return err
+			return &TruncatedFileError{Name: header.Name, Written: n, Size: header.Size, Err: err}
+		}
+		restored[header.Name] = HashedFile{Name: header.Name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}
+		if manifest != nil {
+			if err := manifest.Record(header.Name); err != nil {
+				log.Error(err)
+				return err
+			}
 		}
 
 		fileCount++
@@ -387,7 +645,7 @@ func streamTarToDirectory(ctx context.Context, outputDir string, tr *tar.Reader,
 		// Progress logging - don't spam the logs too much for large archives
 		progressCounter++
 		if progressCounter >= progressInterval || time.Since(lastProgressTime) > progressUpdateInterval {
-			log.Infof("Extraction progress: %d files (%s)", fileCount, formatByteSize(totalBytes))
+			log.Infof("Extraction progress: %d files (%s)", fileCount, FormatSize(totalBytes))
 			progressCounter = 0
 			lastProgressTime = time.Now()
 		} else {
@@ -395,22 +653,27 @@ func streamTarToDirectory(ctx context.Context, outputDir string, tr *tar.Reader,
 		}
 	}
 
-	log.Infof("Directory deserialization complete: %d files (%s)", fileCount, formatByteSize(totalBytes))
-	return nil
-}
+	if skippedCount > 0 {
+		log.Infof("Skipped %d files already restored by an earlier decode", skippedCount)
+	}
+	log.Infof("Directory deserialization complete: %d files (%s)", fileCount, FormatSize(totalBytes))
 
-// formatByteSize formats size in bytes to a human-readable string with units
-func formatByteSize(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
+	// Streams written before hash manifests were added have none, and are trusted as before
+	if hashes == nil {
+		log.Debugf("No hash manifest in the stream; restored files not verified")
+		return nil
+	}
+	if filter != nil {
+		hashes = hashes.Select(filter)
 	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+	if mismatches := hashes.Verify(restored); len(mismatches) > 0 {
+		for _, m := range mismatches {
+			log.Error(fmt.Errorf("hash manifest mismatch: %s", m))
+		}
+		return fmt.Errorf("%d restored files don't match the stream's hash manifest: %w", len(mismatches), ErrChecksumMismatch)
 	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+	log.Infof("All %d restored files match the SHA-256 hashes in the stream's manifest", len(hashes.Files))
+	return nil
 }
 
 // prepareOutputDirectory ensures the output directory is empty for deserialization
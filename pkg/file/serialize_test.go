@@ -0,0 +1,72 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestInputRootNames checks that several input directories are named after their base names,
+// kept apart when those are the same, and that a single one isn't given a name
+func TestInputRootNames(t *testing.T) {
+	if names := InputRootNames([]string{"/data/photos"}); !slices.Equal(names, []string{""}) {
+		t.Errorf("Expected no name for a single input, got %q", names)
+	}
+	names := InputRootNames([]string{"/home/a/photos", "/mnt/docs/", "/home/b/photos", "/backup/photos-2", "/"})
+	if !slices.Equal(names, []string{"photos", "docs", "photos-2", "photos-2-2", "root"}) {
+		t.Errorf("Unexpected names %q", names)
+	}
+}
+
+// TestSerializeDirectories checks that several input directories are serialized under their
+// top-level names, and decode side by side with their files intact
+func TestSerializeDirectories(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputs := map[string]string{
+		"a/photos/beach.jpg":  "sand",
+		"a/photos/2024/x.jpg": "snow",
+		"b/docs/tax.pdf":      "forms",
+		"c/photos/other.jpg":  "another photos directory",
+	}
+	for name, content := range inputs {
+		path := filepath.Join(tempDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	inputDirs := []string{filepath.Join(tempDir, "a", "photos"), filepath.Join(tempDir, "b", "docs"), filepath.Join(tempDir, "c", "photos")}
+
+	stream, err := SerializeDirectoriesWithFilter(ctx, inputDirs, nil)
+	if err != nil {
+		t.Fatalf("SerializeDirectoriesWithFilter failed: %v", err)
+	}
+	defer stream.Close()
+	outputDir := filepath.Join(tempDir, "restored")
+	if err := DeserializeDirectoryFromStream(ctx, outputDir, stream, false); err != nil {
+		t.Fatalf("DeserializeDirectoryFromStream failed: %v", err)
+	}
+	for name, content := range map[string]string{"photos/beach.jpg": "sand", "photos/2024/x.jpg": "snow", "docs/tax.pdf": "forms", "photos-2/other.jpg": "another photos directory"} {
+		if got, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(name))); err != nil || string(got) != content {
+			t.Errorf("%s was not restored (%v)", name, err)
+		}
+	}
+
+	single, err := EstimateSerializedSize(ctx, inputDirs[0])
+	if err != nil {
+		t.Fatalf("EstimateSerializedSize failed: %v", err)
+	}
+	all, err := EstimateDirectoriesSizeWithFilter(ctx, inputDirs, nil)
+	if err != nil || all <= single {
+		t.Errorf("Expected the estimate for every input to be larger than for one, got %d and %d (%v)", all, single, err)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SizeUnits selects how byte counts are rendered in progress messages and reports.
+type SizeUnits int
+
+const (
+	// SizeUnitsBytes renders exact byte counts with thousands separators (e.g., "1,234,567 bytes").
+	SizeUnitsBytes SizeUnits = iota
+
+	// SizeUnitsIEC renders sizes in binary multiples of 1024 (e.g., "1.2 MiB").
+	SizeUnitsIEC
+
+	// SizeUnitsSI renders sizes in decimal multiples of 1000 (e.g., "1.2 MB").
+	SizeUnitsSI
+)
+
+// SizeFormat describes how byte counts are formatted.
+type SizeFormat struct {
+	Units     SizeUnits // Unit system used for rendering
+	Precision int       // Digits after the decimal point for IEC and SI units
+}
+
+// DefaultSizeFormat is used until SetSizeFormat is called.
+var DefaultSizeFormat = SizeFormat{Units: SizeUnitsBytes, Precision: 1}
+
+var sizeFormatMutex sync.RWMutex
+var currentSizeFormat = DefaultSizeFormat
+
+// ParseSizeUnits converts a unit name ("bytes", "iec", or "si") to a SizeUnits value
+func ParseSizeUnits(name string) (SizeUnits, error) {
+	switch strings.ToLower(name) {
+	case "bytes", "":
+		return SizeUnitsBytes, nil
+	case "iec":
+		return SizeUnitsIEC, nil
+	case "si":
+		return SizeUnitsSI, nil
+	}
+	return SizeUnitsBytes, fmt.Errorf("unknown size units %q (expected bytes, iec, or si)", name)
+}
+
+// ParseSize parses a byte count such as "4096", "512K", "64MiB", "1GB", or "4.7GB". Single-letter
+// suffixes and IEC suffixes (KiB, MiB, GiB, TiB) are multiples of 1024; SI suffixes (kB, MB,
+// GB, TB) are multiples of 1000.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := len(s)
+	for i > 0 && (s[i-1] < '0' || s[i-1] > '9') {
+		i--
+	}
+	number, suffix := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i:])
+
+	var multiplier int64
+	switch strings.ToLower(suffix) {
+	case "", "b":
+		multiplier = 1
+	case "k", "kib":
+		multiplier = 1 << 10
+	case "m", "mib":
+		multiplier = 1 << 20
+	case "g", "gib":
+		multiplier = 1 << 30
+	case "t", "tib":
+		multiplier = 1 << 40
+	case "kb":
+		multiplier = 1000
+	case "mb":
+		multiplier = 1000 * 1000
+	case "gb":
+		multiplier = 1000 * 1000 * 1000
+	case "tb":
+		multiplier = 1000 * 1000 * 1000 * 1000
+	default:
+		return 0, fmt.Errorf("invalid size %q: unknown suffix %q", s, suffix)
+	}
+
+	// A fractional number of units, such as 4.7GB for a DVD, is rounded down to whole bytes
+	if strings.Contains(number, ".") {
+		f, err := strconv.ParseFloat(number, 64)
+		if err != nil || f < 0 || strings.ContainsAny(number, "eEinfINF") {
+			return 0, fmt.Errorf("invalid size %q", s)
+		}
+		if f*float64(multiplier) >= 1<<63 {
+			return 0, fmt.Errorf("size %q is too large", s)
+		}
+		return int64(f * float64(multiplier)), nil
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n > (1<<63-1)/multiplier {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * multiplier, nil
+}
+
+// SetSizeFormat sets the process-wide format used by FormatSize
+func SetSizeFormat(f SizeFormat) {
+	if f.Precision < 0 {
+		f.Precision = 0
+	}
+	sizeFormatMutex.Lock()
+	currentSizeFormat = f
+	sizeFormatMutex.Unlock()
+}
+
+// GetSizeFormat returns the process-wide format used by FormatSize
+func GetSizeFormat() SizeFormat {
+	sizeFormatMutex.RLock()
+	defer sizeFormatMutex.RUnlock()
+	return currentSizeFormat
+}
+
+// FormatSize formats a byte count using the process-wide size format
+func FormatSize(bytes int64) string {
+	return GetSizeFormat().Format(bytes)
+}
+
+// Format renders a byte count, including its unit, according to the format
+func (f SizeFormat) Format(bytes int64) string {
+	if bytes < 0 {
+		return "-" + f.Format(-bytes)
+	}
+
+	switch f.Units {
+	case SizeUnitsIEC:
+		return scaledSize(bytes, 1024, []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}, f.Precision)
+	case SizeUnitsSI:
+		return scaledSize(bytes, 1000, []string{"kB", "MB", "GB", "TB", "PB", "EB"}, f.Precision)
+	default:
+		return groupThousands(bytes) + " bytes"
+	}
+}
+
+// scaledSize renders a byte count in the largest unit that keeps the value at or above 1
+func scaledSize(bytes int64, base int64, units []string, precision int) string {
+	if bytes < base {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := base, 0
+	for n := bytes / base; n >= base && exp < len(units)-1; n /= base {
+		div *= base
+		exp++
+	}
+	return fmt.Sprintf("%.*f %s", precision, float64(bytes)/float64(div), units[exp])
+}
+
+// groupThousands formats a non-negative integer with comma thousands separators
+func groupThousands(n int64) string {
+	str := fmt.Sprintf("%d", n)
+	var b strings.Builder
+	for i, ch := range str {
+		if i > 0 && (len(str)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(ch)
+	}
+	return b.String()
+}
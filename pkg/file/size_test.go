@@ -0,0 +1,75 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"testing"
+)
+
+func TestSizeFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		format SizeFormat
+		bytes  int64
+		expect string
+	}{
+		{"Bytes small", SizeFormat{Units: SizeUnitsBytes}, 999, "999 bytes"},
+		{"Bytes grouped", SizeFormat{Units: SizeUnitsBytes}, 1234567, "1,234,567 bytes"},
+		{"Bytes negative", SizeFormat{Units: SizeUnitsBytes}, -1000, "-1,000 bytes"},
+		{"IEC below unit", SizeFormat{Units: SizeUnitsIEC, Precision: 1}, 1023, "1023 B"},
+		{"IEC KiB", SizeFormat{Units: SizeUnitsIEC, Precision: 1}, 1536, "1.5 KiB"},
+		{"IEC MiB precision", SizeFormat{Units: SizeUnitsIEC, Precision: 2}, 5 * 1024 * 1024, "5.00 MiB"},
+		{"SI kB", SizeFormat{Units: SizeUnitsSI, Precision: 1}, 1500, "1.5 kB"},
+		{"SI GB no decimals", SizeFormat{Units: SizeUnitsSI, Precision: 0}, 4700000000, "5 GB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format.Format(tt.bytes); got != tt.expect {
+				t.Errorf("Format(%d) = %q, want %q", tt.bytes, got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestParseSizeUnits(t *testing.T) {
+	for name, expect := range map[string]SizeUnits{"bytes": SizeUnitsBytes, "IEC": SizeUnitsIEC, "si": SizeUnitsSI} {
+		got, err := ParseSizeUnits(name)
+		if err != nil || got != expect {
+			t.Errorf("ParseSizeUnits(%q) = (%v, %v), want (%v, nil)", name, got, err, expect)
+		}
+	}
+	if _, err := ParseSizeUnits("furlongs"); err == nil {
+		t.Errorf("Expected error for unknown units")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	valid := map[string]int64{
+		"4096":   4096,
+		"0":      0,
+		"512K":   512 * 1024,
+		"64MiB":  64 << 20,
+		"64 MiB": 64 << 20,
+		"1g":     1 << 30,
+		"1GB":    1000 * 1000 * 1000,
+		"10kB":   10000,
+		"100b":   100,
+		"1.5G":   3 << 29,
+		"4.7GB":  4700 * 1000 * 1000,
+	}
+	for input, want := range valid {
+		got, err := ParseSize(input)
+		if err != nil {
+			t.Errorf("ParseSize(%q) failed: %v", input, err)
+		} else if got != want {
+			t.Errorf("ParseSize(%q) = %d, want %d", input, got, want)
+		}
+	}
+
+	for _, input := range []string{"", "MiB", "12XB", "-5", "1.2.3G", "99999999999T", "1e3K"} {
+		if _, err := ParseSize(input); err == nil {
+			t.Errorf("ParseSize(%q) should have failed", input)
+		}
+	}
+}
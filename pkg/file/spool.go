@@ -0,0 +1,119 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// entrySpool holds an archive entry while it is written, so that its size is known before
+// the entry header is written and the entry can then be streamed into the archive. Entries
+// up to the SpoolThreshold of the TempPolicy are held in memory; larger ones are written to a
+// temporary file in dir, or if it is empty in TempDir, which is reused for every entry until
+// the spool is closed.
+type entrySpool struct {
+	dir    string
+	limit  int64 // Size above which entries are spooled to file, from the TempPolicy when first written
+	buf    bytes.Buffer
+	file   *os.File
+	onFile bool  // Whether the current entry is in file rather than buf
+	size   int64 // Size of the current entry
+}
+
+// Write appends to the current entry, moving it to the spool file once it outgrows memory
+func (s *entrySpool) Write(p []byte) (int, error) {
+	if s.limit == 0 {
+		s.limit = GetTempPolicy().SpoolThreshold
+	}
+	if !s.onFile && int64(s.buf.Len()+len(p)) > s.limit {
+		if err := s.spill(); err != nil {
+			return 0, err
+		}
+	}
+	if s.onFile {
+		n, err := s.file.Write(p)
+		s.size += int64(n)
+		return n, err
+	}
+	n, _ := s.buf.Write(p)
+	s.size += int64(n)
+	return n, nil
+}
+
+// spill moves the current entry from memory to the spool file, creating the file the first
+// time. Where the system allows it, the file is unlinked as soon as it is created, so that
+// nothing is left behind if padlock is killed.
+func (s *entrySpool) spill() error {
+	if s.file == nil {
+		dir := s.dir
+		if dir == "" {
+			dir = TempDir()
+		}
+		f, err := os.CreateTemp(dir, ".padlock-spool-*")
+		if err != nil {
+			return fmt.Errorf("failed to create spool file: %w", err)
+		}
+		os.Remove(f.Name())
+		s.file = f
+	} else if err := s.rewind(); err != nil {
+		return err
+	}
+	if _, err := s.file.Write(s.buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+	s.buf.Reset()
+	s.onFile = true
+	return nil
+}
+
+// rewind empties the spool file
+func (s *entrySpool) rewind() error {
+	if err := s.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate spool file: %w", err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind spool file: %w", err)
+	}
+	return nil
+}
+
+// Reader returns the current entry, which must not be written to while it is being read
+func (s *entrySpool) Reader() (io.Reader, error) {
+	if !s.onFile {
+		return bytes.NewReader(s.buf.Bytes()), nil
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind spool file: %w", err)
+	}
+	return io.LimitReader(s.file, s.size), nil
+}
+
+// Size returns the size of the current entry
+func (s *entrySpool) Size() int64 {
+	return s.size
+}
+
+// Reset discards the current entry so that the next one can be written
+func (s *entrySpool) Reset() {
+	s.buf.Reset()
+	s.onFile = false
+	s.size = 0
+}
+
+// Close removes the spool file, if one was created
+func (s *entrySpool) Close() error {
+	s.Reset()
+	if s.file == nil {
+		return nil
+	}
+	name := s.file.Name()
+	err := s.file.Close()
+	s.file = nil
+	if rerr := os.Remove(name); rerr != nil && !os.IsNotExist(rerr) && err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// StealthNamePrefix starts every stealth collection name. The remainder is random, so a
+// stealth name such as "share-9f2c41d7" reveals nothing about the K-of-N parameters.
+const StealthNamePrefix = "share-"
+
+// stealthNameRandomBytes is the number of random bytes, hex encoded, in a stealth name
+const stealthNameRandomBytes = 4
+
+// ErrMetadataSealed is returned when collection metadata is encrypted and no key was supplied.
+var ErrMetadataSealed = errors.New("metadata is encrypted; a metadata key is required")
+
+// NewStealthName returns a random, non-revealing collection name
+func NewStealthName() (string, error) {
+	b := make([]byte, stealthNameRandomBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate stealth name: %w", err)
+	}
+	return StealthNamePrefix + hex.EncodeToString(b), nil
+}
+
+// IsStealthName checks if a string looks like a stealth collection name (e.g. "share-9f2c41d7")
+func IsStealthName(name string) bool {
+	if len(name) != len(StealthNamePrefix)+2*stealthNameRandomBytes || name[:len(StealthNamePrefix)] != StealthNamePrefix {
+		return false
+	}
+	for _, c := range name[len(StealthNamePrefix):] {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// IsStoredCollectionName checks if a directory, TAR, or chunk file prefix names a collection,
+// either with its regular name (e.g. "3A5") or with a stealth name
+func IsStoredCollectionName(name string) bool {
+	return IsCollectionName(name) || IsStealthName(name)
+}
+
+// Parameters for deriving the metadata encryption key from a passphrase
+const (
+	sealSaltSize = 16
+	sealScryptN  = 1 << 15
+	sealScryptR  = 8
+	sealScryptP  = 1
+)
+
+// SealMetadata encrypts metadata with a key derived from passphrase using scrypt and
+// AES-256-GCM. The returned metadata exposes only its version and stored name; everything
+// else, including the real collection name and threshold parameters, is in Sealed.
+func SealMetadata(md *Metadata, passphrase []byte) (*Metadata, error) {
+	plaintext, err := json.Marshal(md)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	salt := make([]byte, sealSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	aead, err := metadataAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := append(salt, nonce...)
+	sealed = aead.Seal(sealed, nonce, plaintext, []byte(md.StoredName))
+
+	return &Metadata{
+		Version:    md.Version,
+		StoredName: md.StoredName,
+		Sealed:     base64.StdEncoding.EncodeToString(sealed),
+	}, nil
+}
+
+// OpenMetadata decrypts metadata produced by SealMetadata. Metadata that is not sealed is
+// returned unchanged.
+func OpenMetadata(md *Metadata, passphrase []byte) (*Metadata, error) {
+	if md.Sealed == "" {
+		return md, nil
+	}
+	if len(passphrase) == 0 {
+		return nil, ErrMetadataSealed
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(md.Sealed)
+	if err != nil || len(sealed) < sealSaltSize {
+		return nil, fmt.Errorf("malformed sealed metadata")
+	}
+	salt := sealed[:sealSaltSize]
+	aead, err := metadataAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	rest := sealed[sealSaltSize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("malformed sealed metadata")
+	}
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], []byte(md.StoredName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt metadata: wrong key or corrupted metadata")
+	}
+
+	var opened Metadata
+	if err := json.Unmarshal(plaintext, &opened); err != nil {
+		return nil, fmt.Errorf("failed to parse decrypted metadata: %w", err)
+	}
+	return &opened, nil
+}
+
+// metadataAEAD derives the AES-256-GCM cipher used to seal metadata
+func metadataAEAD(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, sealScryptN, sealScryptR, sealScryptP, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive metadata key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestStealthNames(t *testing.T) {
+	name, err := NewStealthName()
+	if err != nil {
+		t.Fatalf("NewStealthName failed: %v", err)
+	}
+	if !IsStealthName(name) || !IsStoredCollectionName(name) {
+		t.Errorf("Generated name %q not recognized as a stealth name", name)
+	}
+	if IsCollectionName(name) {
+		t.Errorf("Stealth name %q must not look like a regular collection name", name)
+	}
+
+	for _, bad := range []string{"share-", "share-12345", "share-1234567g", "share-ABCDEF12", "3A5", "xshare-12345678"} {
+		if IsStealthName(bad) {
+			t.Errorf("IsStealthName(%q) = true, want false", bad)
+		}
+	}
+	if !IsStoredCollectionName("3A5") {
+		t.Errorf("Regular collection names must remain valid stored names")
+	}
+}
+
+func TestSealedMetadata(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	tempDir, err := os.MkdirTemp("", "stealth-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	md := &Metadata{
+		Version:    MetadataVersion,
+		Collection: "3B5",
+		Copies:     5,
+		Required:   3,
+		Format:     FormatPNG,
+		StoredName: "share-0123abcd",
+	}
+	key := []byte("correct horse battery staple")
+
+	sealed, err := SealMetadata(md, key)
+	if err != nil {
+		t.Fatalf("SealMetadata failed: %v", err)
+	}
+	if sealed.Collection != "" || sealed.Copies != 0 || sealed.Required != 0 {
+		t.Errorf("Sealed metadata leaks parameters: %+v", sealed)
+	}
+
+	collPath := filepath.Join(tempDir, md.StoredName)
+	if err := os.MkdirAll(collPath, 0755); err != nil {
+		t.Fatalf("Failed to create collection dir: %v", err)
+	}
+	if err := WriteMetadata(ctx, collPath, sealed); err != nil {
+		t.Fatalf("WriteMetadata failed: %v", err)
+	}
+	raw, err := os.ReadFile(filepath.Join(collPath, MetadataFileName))
+	if err != nil {
+		t.Fatalf("Failed to read metadata file: %v", err)
+	}
+	if strings.Contains(string(raw), "3B5") {
+		t.Errorf("Sealed metadata file contains the real collection name")
+	}
+
+	coll := Collection{Name: md.StoredName, Path: collPath, Format: FormatPNG}
+	if _, err := ReadMetadata(ctx, coll, nil); !errors.Is(err, ErrMetadataSealed) {
+		t.Errorf("Expected ErrMetadataSealed without a key, got %v", err)
+	}
+	if _, err := ReadMetadata(ctx, coll, []byte("wrong key")); err == nil {
+		t.Errorf("Expected an error with the wrong key")
+	}
+	opened, err := ReadMetadata(ctx, coll, key)
+	if err != nil {
+		t.Fatalf("ReadMetadata with key failed: %v", err)
+	}
+	if opened.Collection != "3B5" || opened.Required != 3 || opened.Copies != 5 {
+		t.Errorf("Opened metadata mismatch: %+v", opened)
+	}
+}
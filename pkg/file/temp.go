@@ -0,0 +1,55 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"os"
+	"sync"
+)
+
+// TempPolicy says where temporary files and directories are created, such as extracted TAR
+// collections, grouped chunk files, staged remote collections, and spooled stream frames, and
+// how much data is held in memory before it is spooled to a temporary file.
+type TempPolicy struct {
+	Dir            string // Directory temporary files and directories are created in; the system's (TMPDIR) if empty
+	SpoolThreshold int64  // Size above which data held for later, such as an archive entry, is spooled to a file
+}
+
+// DefaultTempPolicy is used until SetTempPolicy is called: the system temporary directory,
+// and entries of up to 8 MiB held in memory.
+var DefaultTempPolicy = TempPolicy{SpoolThreshold: 8 << 20}
+
+var tempPolicyMutex sync.RWMutex
+var currentTempPolicy = DefaultTempPolicy
+
+// SetTempPolicy sets the process-wide temporary file policy. A threshold that isn't positive
+// selects the default.
+func SetTempPolicy(p TempPolicy) {
+	if p.SpoolThreshold <= 0 {
+		p.SpoolThreshold = DefaultTempPolicy.SpoolThreshold
+	}
+	tempPolicyMutex.Lock()
+	currentTempPolicy = p
+	tempPolicyMutex.Unlock()
+}
+
+// GetTempPolicy returns the process-wide temporary file policy
+func GetTempPolicy() TempPolicy {
+	tempPolicyMutex.RLock()
+	defer tempPolicyMutex.RUnlock()
+	return currentTempPolicy
+}
+
+// TempDir returns the directory temporary files and directories are created in
+func TempDir() string {
+	if dir := GetTempPolicy().Dir; dir != "" {
+		return dir
+	}
+	return os.TempDir()
+}
+
+// MkdirTemp creates a new temporary directory in TempDir, named with pattern as os.MkdirTemp
+// does, and returns its path. The caller removes it.
+func MkdirTemp(pattern string) (string, error) {
+	return os.MkdirTemp(TempDir(), pattern)
+}
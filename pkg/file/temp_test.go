@@ -0,0 +1,53 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// TestTempPolicy checks that temporary directories are created in the configured directory,
+// and that entries are spooled to a file above the configured threshold
+func TestTempPolicy(t *testing.T) {
+	defer SetTempPolicy(GetTempPolicy())
+
+	SetTempPolicy(TempPolicy{})
+	if got := GetTempPolicy().SpoolThreshold; got != DefaultTempPolicy.SpoolThreshold {
+		t.Errorf("Expected the default threshold for an unset one, got %d", got)
+	}
+
+	dir := t.TempDir()
+	SetTempPolicy(TempPolicy{Dir: dir, SpoolThreshold: 100})
+	if TempDir() != dir {
+		t.Errorf("Expected the temp directory to be %s, got %s", dir, TempDir())
+	}
+	created, err := MkdirTemp("padlock-collections-")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	if filepath.Dir(created) != dir {
+		t.Errorf("Expected %s to be created in %s", created, dir)
+	}
+
+	spool := &entrySpool{}
+	defer spool.Close()
+	data := bytes.Repeat([]byte("x"), 150)
+	spool.Write(data[:100])
+	if spool.onFile {
+		t.Errorf("Expected an entry at the threshold to stay in memory")
+	}
+	spool.Write(data[100:])
+	if !spool.onFile {
+		t.Errorf("Expected an entry above the threshold to be spooled to a file")
+	}
+	r, err := spool.Reader()
+	if err != nil {
+		t.Fatalf("Failed to read spool: %v", err)
+	}
+	if got, _ := io.ReadAll(r); !bytes.Equal(got, data) {
+		t.Errorf("Expected the spooled entry back, got %d bytes", len(got))
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+const (
+	// textArmorBegin and textArmorEnd enclose a text chunk, in the style of PEM
+	textArmorBegin = "-----BEGIN PADLOCK CHUNK-----"
+	textArmorEnd   = "-----END PADLOCK CHUNK-----"
+
+	// textLineLength is the number of base64 characters per body line, as in PEM
+	textLineLength = 64
+)
+
+// TextFormatter implements the Formatter interface for ASCII-armored text storage.
+//
+// This formatter writes each chunk as a PEM-like block of base64 text, with headers naming
+// the collection and chunk and recording the CRC-32 of the data, so chunks survive being
+// pasted into email, printed and retyped, or stored in systems that mangle binary data:
+//
+//	-----BEGIN PADLOCK CHUNK-----
+//	Collection: 3A5
+//	Chunk: 1
+//	Length: 2097152
+//	CRC32: 8f1c2d3e
+//
+//	<base64 data, 64 characters per line>
+//	-----END PADLOCK CHUNK-----
+//
+// The base64 encoding makes text chunks about a third larger than bin chunks.
+//
+// File naming convention: "<collectionName>_<chunkNumber>.txt"
+// Example: "3A5_0001.txt"
+type TextFormatter struct{}
+
+// WriteChunk writes a chunk to an armored text file
+func (tf *TextFormatter) WriteChunk(ctx context.Context, collectionPath string, collectionIndex int, chunkNumber int, data []byte) error {
+	log := trace.FromContext(ctx).WithPrefix("TEXT-FORMATTER")
+
+	base := filepath.Base(collectionPath)
+	fp := filepath.Join(collectionPath, fmt.Sprintf("%s_%s.txt", base, formatChunkNumber(chunkNumber)))
+
+	log.Debugf("Writing chunk %d to text file: %s", chunkNumber, fp)
+
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		log.Error(fmt.Errorf("failed to create chunk directory: %w", err))
+		return fmt.Errorf("failed to create chunk directory: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeTextArmor(&buf, base, chunkNumber, data); err != nil {
+		log.Error(fmt.Errorf("failed to encode text chunk: %w", err))
+		return fmt.Errorf("failed to encode text chunk: %w", err)
+	}
+	if err := os.WriteFile(fp, buf.Bytes(), 0644); err != nil {
+		log.Error(fmt.Errorf("failed to write text file %s: %w", fp, err))
+		return fmt.Errorf("failed to write text file %s: %w", fp, err)
+	}
+
+	log.Debugf("Successfully wrote %d bytes to text file", len(data))
+	return nil
+}
+
+// ReadChunk reads a chunk from an armored text file
+func (tf *TextFormatter) ReadChunk(ctx context.Context, collectionPath string, collectionIndex int, chunkNumber int) ([]byte, error) {
+	log := trace.FromContext(ctx).WithPrefix("TEXT-FORMATTER")
+
+	matches, err := filepath.Glob(filepath.Join(collectionPath, fmt.Sprintf("*_%s.txt", formatChunkNumber(chunkNumber))))
+	if err != nil || len(matches) == 0 {
+		log.Debugf("No chunk file found for chunk %d in %s", chunkNumber, collectionPath)
+		return nil, fmt.Errorf("chunk file not found for chunk %d", chunkNumber)
+	}
+
+	f, err := os.Open(matches[0])
+	if err != nil {
+		log.Error(fmt.Errorf("failed to open text file %s: %w", matches[0], err))
+		return nil, fmt.Errorf("failed to open text file: %w", err)
+	}
+	defer f.Close()
+
+	data, err := ExtractDataFromText(f)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to extract data from text %s: %w", matches[0], err))
+		return nil, fmt.Errorf("failed to extract data from text: %w", err)
+	}
+
+	log.Debugf("Successfully read %d bytes from text file %s", len(data), matches[0])
+	return data, nil
+}
+
+// EncodeTextArmor writes data as an armored text block for the given collection and chunk
+func EncodeTextArmor(w io.Writer, collName string, chunkNumber int, data []byte) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\n", textArmorBegin)
+	fmt.Fprintf(bw, "Collection: %s\n", collName)
+	fmt.Fprintf(bw, "Chunk: %d\n", chunkNumber)
+	fmt.Fprintf(bw, "Length: %d\n", len(data))
+	fmt.Fprintf(bw, "CRC32: %08x\n\n", crc32.ChecksumIEEE(data))
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > textLineLength {
+		fmt.Fprintf(bw, "%s\n", encoded[:textLineLength])
+		encoded = encoded[textLineLength:]
+	}
+	if len(encoded) > 0 {
+		fmt.Fprintf(bw, "%s\n", encoded)
+	}
+	fmt.Fprintf(bw, "%s\n", textArmorEnd)
+	return bw.Flush()
+}
+
+// TextPayload is the content of an armored text chunk file, as found by FindTextPayload
+type TextPayload struct {
+	Collection  string // Collection named in the header
+	Chunk       int    // Chunk number named in the header
+	Length      int    // Data length recorded in the header
+	Data        []byte // Chunk data
+	StoredCRC   uint32 // CRC recorded in the header
+	ComputedCRC uint32 // CRC of the data as read
+}
+
+// CRCValid reports whether the stored CRC and length match the data
+func (p TextPayload) CRCValid() bool {
+	return p.StoredCRC == p.ComputedCRC && p.Length == len(p.Data)
+}
+
+// FindTextPayload parses an armored text chunk. Text before the begin line and after the end
+// line is ignored, as is trailing whitespace and a "> " quoting prefix, so a chunk can be
+// recovered from an email it was pasted into. Unlike ExtractDataFromText, a CRC mismatch is
+// reported in the result rather than as an error, so a damaged chunk can still be examined.
+func FindTextPayload(all []byte) (TextPayload, error) {
+	var p TextPayload
+	var body strings.Builder
+	inBlock, inBody, ended := false, false, false
+	haveCRC, haveLength := false, false
+
+	for _, line := range strings.Split(string(all), "\n") {
+		line = strings.TrimSpace(line)
+		for strings.HasPrefix(line, ">") {
+			line = strings.TrimSpace(strings.TrimPrefix(line, ">"))
+		}
+
+		switch {
+		case !inBlock:
+			inBlock = line == textArmorBegin
+		case line == textArmorEnd:
+			ended = true
+		case inBody:
+			body.WriteString(line)
+		case line == "":
+			inBody = true
+		default:
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return p, fmt.Errorf("invalid text chunk header line %q", line)
+			}
+			value = strings.TrimSpace(value)
+			var err error
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "collection":
+				p.Collection = value
+			case "chunk":
+				p.Chunk, err = strconv.Atoi(value)
+			case "length":
+				p.Length, err = strconv.Atoi(value)
+				haveLength = true
+			case "crc32":
+				var crc uint64
+				crc, err = strconv.ParseUint(value, 16, 32)
+				p.StoredCRC = uint32(crc)
+				haveCRC = true
+			}
+			if err != nil {
+				return p, fmt.Errorf("invalid text chunk header %q: %w", line, err)
+			}
+		}
+		if ended {
+			break
+		}
+	}
+
+	if !inBlock {
+		return p, fmt.Errorf("%q not found", textArmorBegin)
+	}
+	if !ended {
+		return p, fmt.Errorf("%q not found; the text chunk is truncated", textArmorEnd)
+	}
+	if !haveCRC || !haveLength {
+		return p, fmt.Errorf("text chunk has no CRC32 or Length header")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(body.String())
+	if err != nil {
+		return p, fmt.Errorf("invalid base64 in text chunk: %w", err)
+	}
+	p.Data = data
+	p.ComputedCRC = crc32.ChecksumIEEE(data)
+	return p, nil
+}
+
+// ExtractDataFromText reads an armored text chunk and returns its data, failing if the data
+// doesn't match the CRC or length recorded in its header
+func ExtractDataFromText(r io.Reader) ([]byte, error) {
+	all, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read text chunk: %w", err)
+	}
+	p, err := FindTextPayload(all)
+	if err != nil {
+		return nil, err
+	}
+	if p.Length != len(p.Data) {
+		return nil, fmt.Errorf("text chunk length mismatch: header says %d bytes, body has %d", p.Length, len(p.Data))
+	}
+	if p.StoredCRC != p.ComputedCRC {
+		return nil, fmt.Errorf("text chunk CRC mismatch: stored 0x%08x, computed 0x%08x: %w", p.StoredCRC, p.ComputedCRC, ErrChecksumMismatch)
+	}
+	return p.Data, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestTextArmorRoundTrip(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeTextArmor(&buf, "3A5", 2, data); err != nil {
+		t.Fatalf("EncodeTextArmor failed: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if len(line) > textLineLength {
+			t.Errorf("Line is longer than %d characters: %q", textLineLength, line)
+		}
+	}
+
+	got, err := ExtractDataFromText(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ExtractDataFromText failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Extracted data does not match the original")
+	}
+
+	p, err := FindTextPayload(buf.Bytes())
+	if err != nil {
+		t.Fatalf("FindTextPayload failed: %v", err)
+	}
+	if p.Collection != "3A5" || p.Chunk != 2 || !p.CRCValid() {
+		t.Errorf("Unexpected payload: collection %q, chunk %d, CRC valid %v", p.Collection, p.Chunk, p.CRCValid())
+	}
+}
+
+func TestTextArmorFromEmail(t *testing.T) {
+	data := []byte("chunk data that went through an email client")
+	var buf bytes.Buffer
+	if err := EncodeTextArmor(&buf, "2B3", 1, data); err != nil {
+		t.Fatalf("EncodeTextArmor failed: %v", err)
+	}
+
+	// Quoted in a reply, with CRLF line endings and text around it
+	quoted := "On Monday, someone wrote:\r\n"
+	for _, line := range strings.Split(buf.String(), "\n") {
+		quoted += "> " + line + "\r\n"
+	}
+	quoted += "Thanks!\r\n"
+
+	got, err := ExtractDataFromText(strings.NewReader(quoted))
+	if err != nil {
+		t.Fatalf("ExtractDataFromText failed on a quoted chunk: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Extracted data does not match the original")
+	}
+}
+
+func TestTextArmorDetectsDamage(t *testing.T) {
+	data := bytes.Repeat([]byte("padlock"), 100)
+	var buf bytes.Buffer
+	if err := EncodeTextArmor(&buf, "2A3", 1, data); err != nil {
+		t.Fatalf("EncodeTextArmor failed: %v", err)
+	}
+	armored := buf.String()
+
+	// Change one base64 character in the body
+	body := strings.Index(armored, "\n\n") + 2
+	damaged := []byte(armored)
+	if damaged[body] == 'A' {
+		damaged[body] = 'B'
+	} else {
+		damaged[body] = 'A'
+	}
+	if _, err := ExtractDataFromText(bytes.NewReader(damaged)); err == nil || !strings.Contains(err.Error(), "CRC mismatch") {
+		t.Errorf("Expected a CRC mismatch, got %v", err)
+	}
+	p, err := FindTextPayload(damaged)
+	if err != nil {
+		t.Fatalf("FindTextPayload failed: %v", err)
+	}
+	if p.CRCValid() {
+		t.Errorf("Expected CRCValid to report the damage")
+	}
+
+	// Drop the end line
+	truncated := armored[:strings.Index(armored, textArmorEnd)]
+	if _, err := ExtractDataFromText(strings.NewReader(truncated)); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("Expected a truncation error, got %v", err)
+	}
+}
+
+func TestTextFormatter(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "padlock-text-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	collPath := tempDir + "/3C5"
+	data := []byte("formatter chunk data")
+
+	formatter := GetFormatter(FormatText)
+	if err := formatter.WriteChunk(ctx, collPath, 2, 1, data); err != nil {
+		t.Fatalf("WriteChunk failed: %v", err)
+	}
+	got, err := formatter.ReadChunk(ctx, collPath, 2, 1)
+	if err != nil {
+		t.Fatalf("ReadChunk failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Read data does not match the original")
+	}
+
+	if format, err := DetermineCollectionFormat(collPath); err != nil || format != FormatText {
+		t.Errorf("DetermineCollectionFormat = %q, %v; want %q", format, err, FormatText)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// VolumeManifestSuffix ends the name of the manifest that lists the volumes of a collection
+// split with a volume size, e.g. "3A5.volumes.json"
+const VolumeManifestSuffix = ".volumes.json"
+
+// volumeFilePattern matches volume file names such as "3A5.vol001.tar"
+var volumeFilePattern = regexp.MustCompile(`\.vol[0-9]{3,}\.(tar|zip)$`)
+
+// VolumeManifest lists, in order, the volumes a collection archive was split into so that
+// each fits on a piece of physical media. Every volume is a complete TAR or ZIP archive
+// holding whole chunks, so decode reads the volumes one after another.
+type VolumeManifest struct {
+	Version    int          `json:"version"`
+	Collection string       `json:"collection"`
+	VolumeSize int64        `json:"volume_size"`
+	Volumes    []VolumeInfo `json:"volumes"`
+}
+
+// VolumeInfo describes a single volume of a collection
+type VolumeInfo struct {
+	Name   string `json:"name"`   // File name of the volume, in the manifest's directory
+	Size   int64  `json:"size"`   // Size of the volume file in bytes
+	Chunks int    `json:"chunks"` // Number of chunks stored in the volume
+}
+
+// VolumePath returns the path of the given 1-based volume of an archive, e.g. "3A5.vol002.tar"
+// for volume 2 of "3A5.tar"
+func VolumePath(archivePath string, volume int) string {
+	ext := filepath.Ext(archivePath)
+	return fmt.Sprintf("%s.vol%03d%s", strings.TrimSuffix(archivePath, ext), volume, ext)
+}
+
+// VolumeManifestPath returns the path of the volume manifest of an archive, e.g.
+// "3A5.volumes.json" for "3A5.tar"
+func VolumeManifestPath(archivePath string) string {
+	return strings.TrimSuffix(archivePath, filepath.Ext(archivePath)) + VolumeManifestSuffix
+}
+
+// IsVolumePath reports whether path names a single volume of a collection archive
+func IsVolumePath(path string) bool {
+	return volumeFilePattern.MatchString(strings.ToLower(filepath.Base(path)))
+}
+
+// WriteVolumeManifest writes the manifest for a collection archive split into volumes
+// under its partial name first, so that a manifest is never found half written
+func WriteVolumeManifest(path string, manifest *VolumeManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal volume manifest: %w", err)
+	}
+	if err := os.WriteFile(PartialPath(path), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write volume manifest: %w", err)
+	}
+	if err := os.Rename(PartialPath(path), path); err != nil {
+		return fmt.Errorf("failed to write volume manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadVolumeManifest reads a volume manifest and returns it together with the paths of its
+// volumes, which are in the same directory as the manifest. It fails if a volume is missing
+// or its size doesn't match the manifest, naming the volume so it can be found and copied.
+func ReadVolumeManifest(path string) (*VolumeManifest, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read volume manifest: %w", err)
+	}
+	var manifest VolumeManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("invalid volume manifest %s: %w", path, err)
+	}
+	if len(manifest.Volumes) == 0 {
+		return nil, nil, fmt.Errorf("volume manifest %s lists no volumes", path)
+	}
+
+	dir := filepath.Dir(path)
+	paths := make([]string, len(manifest.Volumes))
+	for i, v := range manifest.Volumes {
+		if v.Name != filepath.Base(v.Name) || !IsArchivePath(v.Name) {
+			return nil, nil, fmt.Errorf("volume manifest %s has an invalid volume name %q", path, v.Name)
+		}
+		paths[i] = filepath.Join(dir, v.Name)
+		info, err := os.Stat(paths[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("volume %d of %d of collection %s: %w", i+1, len(manifest.Volumes), manifest.Collection, err)
+		}
+		if info.Size() != v.Size {
+			return nil, nil, fmt.Errorf("volume %s is %d bytes, but the manifest says %d", v.Name, info.Size(), v.Size)
+		}
+	}
+	return &manifest, paths, nil
+}
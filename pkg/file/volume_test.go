@@ -0,0 +1,137 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestVolumeChunkWriter(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	tempDir, err := os.MkdirTemp("", "padlock-volume-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, format := range []ArchiveFormat{ArchiveTar, ArchiveZip} {
+		archivePath := filepath.Join(tempDir, "3A5"+format.Ext())
+		const volumeSize = 10000
+
+		// Seven chunks of 3000 bytes need several volumes
+		registry := NewTarWriterRegistry()
+		var chunks [][]byte
+		for i := 1; i <= 7; i++ {
+			chunk := bytes.Repeat([]byte{byte(i)}, 3000)
+			chunks = append(chunks, chunk)
+
+			writer, err := registry.VolumeChunkWriter(ctx, archivePath, "3A5", FormatBin, volumeSize)
+			if err != nil {
+				t.Fatalf("VolumeChunkWriter failed: %v", err)
+			}
+			if i == 1 {
+				if err := writer.AddFile(MetadataFileName, []byte(`{"version":1}`)); err != nil {
+					t.Fatalf("AddFile failed: %v", err)
+				}
+			}
+			writer.ChunkNum = i
+			if _, err := writer.Write(chunk); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+		}
+		// Until finalized, the volumes only exist under their partial names
+		if _, err := os.Stat(PartialPath(VolumePath(archivePath, 1))); err != nil {
+			t.Errorf("%s: expected the first volume under its partial name: %v", format, err)
+		}
+		if _, err := os.Stat(VolumePath(archivePath, 1)); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no complete volume before finalizing", format)
+		}
+		if err := registry.FinalizeAll(ctx); err != nil {
+			t.Fatalf("FinalizeAll failed: %v", err)
+		}
+		if partials, _ := filepath.Glob(filepath.Join(tempDir, "*"+PartialSuffix)); len(partials) != 0 {
+			t.Errorf("%s: expected no partial files after finalizing, found %v", format, partials)
+		}
+
+		if _, err := os.Stat(archivePath); !os.IsNotExist(err) {
+			t.Errorf("%s: expected only volumes, but the unsplit archive exists", format)
+		}
+		manifest, volumes, err := ReadVolumeManifest(VolumeManifestPath(archivePath))
+		if err != nil {
+			t.Fatalf("ReadVolumeManifest failed: %v", err)
+		}
+		if len(volumes) < 3 || len(volumes) > 4 || volumes[1] != VolumePath(archivePath, 2) {
+			t.Fatalf("%s: unexpected volumes %v", format, volumes)
+		}
+		total := 0
+		for i, v := range manifest.Volumes {
+			if v.Size > volumeSize {
+				t.Errorf("%s: volume %d is %d bytes, more than %d", format, i+1, v.Size, volumeSize)
+			}
+			total += v.Chunks
+		}
+		if total != len(chunks) {
+			t.Errorf("%s: manifest lists %d chunks, want %d", format, total, len(chunks))
+		}
+
+		// The volumes read back as a single collection, in order
+		coll := Collection{Name: "3A5", Path: VolumeManifestPath(archivePath), Format: FormatBin, Volumes: volumes}
+		reader := NewCollectionReader(coll)
+		for i, want := range chunks {
+			data, err := reader.ReadNextChunk(ctx)
+			if err != nil {
+				t.Fatalf("%s: ReadNextChunk %d failed: %v", format, i+1, err)
+			}
+			if !bytes.Equal(data, want) {
+				t.Errorf("%s: chunk %d does not match", format, i+1)
+			}
+		}
+		if _, err := reader.ReadNextChunk(ctx); err != io.EOF {
+			t.Errorf("%s: expected io.EOF after the last chunk, got %v", format, err)
+		}
+		reader.Close()
+
+		if _, err := ReadMetadata(ctx, coll, nil); err != nil {
+			t.Errorf("%s: ReadMetadata failed: %v", format, err)
+		}
+
+		// A missing volume is reported by name
+		os.Remove(volumes[2])
+		if _, _, err := ReadVolumeManifest(coll.Path); err == nil {
+			t.Errorf("%s: expected an error for a missing volume", format)
+		}
+	}
+}
+
+func TestVolumeTooSmallForChunk(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	tempDir, err := os.MkdirTemp("", "padlock-volume-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	registry := NewTarWriterRegistry()
+	defer registry.AbortAll(ctx)
+
+	writer, err := registry.VolumeChunkWriter(ctx, filepath.Join(tempDir, "3A5.tar"), "3A5", FormatBin, 4096)
+	if err != nil {
+		t.Fatalf("VolumeChunkWriter failed: %v", err)
+	}
+	writer.ChunkNum = 1
+	writer.Write(make([]byte, 8192))
+	if err := writer.Close(); err == nil {
+		t.Errorf("Expected an error for a chunk larger than a volume")
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+const (
+	// wavSampleRate is the sample rate of the audio in a WAV chunk file
+	wavSampleRate = 8000
+
+	// wavSilenceBytes is the length of the audio in a WAV chunk file: one second of 8-bit
+	// mono silence, so that players open the file as a short recording
+	wavSilenceBytes = wavSampleRate
+)
+
+// WavFormatter implements the Formatter interface for WAV audio storage.
+//
+// This formatter embeds chunk data within WAV audio files using a custom RIFF chunk
+// ('rAWd'), so that collections look like a folder of voice recordings. Each file is a
+// valid WAV holding one second of silence, which players and audio tools open normally
+// while skipping the unknown chunk. As with PNG, the custom chunk is followed by a CRC-32
+// of its type and data, which is verified on every read.
+//
+// Like the PNG format, this is NOT cryptographic protection: tools that list RIFF chunks
+// will show the custom chunk.
+//
+// File naming convention: "REC<collectionName>_<chunkNumber>.WAV"
+// Example: "REC3A5_0001.WAV"
+type WavFormatter struct{}
+
+// WriteChunk writes a chunk to a WAV file
+func (wf *WavFormatter) WriteChunk(ctx context.Context, collectionPath string, collectionIndex int, chunkNumber int, data []byte) error {
+	log := trace.FromContext(ctx).WithPrefix("WAV-FORMATTER")
+
+	base := filepath.Base(collectionPath)
+	fp := filepath.Join(collectionPath, fmt.Sprintf("REC%s_%s.WAV", base, formatChunkNumber(chunkNumber)))
+
+	log.Debugf("Writing chunk %d to WAV file: %s", chunkNumber, fp)
+
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		log.Error(fmt.Errorf("failed to create chunk directory: %w", err))
+		return fmt.Errorf("failed to create chunk directory: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeWAVWithData(&buf, data); err != nil {
+		log.Error(fmt.Errorf("failed to encode WAV with data for %s: %w", fp, err))
+		return fmt.Errorf("failed to encode WAV with data for %s: %w", fp, err)
+	}
+	if err := os.WriteFile(fp, buf.Bytes(), 0644); err != nil {
+		log.Error(fmt.Errorf("failed to write WAV file %s: %w", fp, err))
+		return fmt.Errorf("failed to write WAV file %s: %w", fp, err)
+	}
+
+	log.Debugf("Successfully wrote %d bytes to WAV file", len(data))
+	return nil
+}
+
+// ReadChunk reads a chunk from a WAV file
+func (wf *WavFormatter) ReadChunk(ctx context.Context, collectionPath string, collectionIndex int, chunkNumber int) ([]byte, error) {
+	log := trace.FromContext(ctx).WithPrefix("WAV-FORMATTER")
+
+	var foundPath string
+	for _, pattern := range []string{fmt.Sprintf("*_%s.WAV", formatChunkNumber(chunkNumber)), fmt.Sprintf("*_%s.wav", formatChunkNumber(chunkNumber))} {
+		if matches, err := filepath.Glob(filepath.Join(collectionPath, pattern)); err == nil && len(matches) > 0 {
+			foundPath = matches[0]
+			break
+		}
+	}
+	if foundPath == "" {
+		log.Debugf("No chunk file found for chunk %d in %s", chunkNumber, collectionPath)
+		return nil, fmt.Errorf("chunk file not found for chunk %d", chunkNumber)
+	}
+
+	f, err := os.Open(foundPath)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to open WAV file %s: %w", foundPath, err))
+		return nil, fmt.Errorf("failed to open WAV file: %w", err)
+	}
+	defer f.Close()
+
+	data, err := ExtractDataFromWAV(f)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to extract data from WAV %s: %w", foundPath, err))
+		return nil, fmt.Errorf("failed to extract data from WAV: %w", err)
+	}
+
+	log.Debugf("Successfully read %d bytes from WAV file %s", len(data), foundPath)
+	return data, nil
+}
+
+// encodeWAVWithData writes a WAV file of silence with data in a custom 'rAWd' chunk.
+//
+// The file is laid out as a RIFF 'WAVE' form holding, in order:
+//   - a 'fmt ' chunk describing 8 kHz, 8-bit, mono PCM audio
+//   - the 'rAWd' chunk: the data followed by the big-endian CRC-32 of "rAWd" and the data,
+//     exactly as in the PNG format
+//   - a 'data' chunk of silence
+//
+// RIFF chunks are padded to an even length, so a pad byte follows an odd-length 'rAWd' chunk.
+func encodeWAVWithData(w io.Writer, data []byte) error {
+	rawdSize := int64(len(data)) + 4
+	riffSize := 4 + (8 + 16) + (8 + rawdSize + rawdSize%2) + (8 + wavSilenceBytes)
+	if riffSize > 0xFFFFFFFF {
+		return fmt.Errorf("chunk of %d bytes is too large for a WAV file", len(data))
+	}
+
+	bw := bufio.NewWriter(w)
+	le := binary.LittleEndian
+
+	bw.WriteString("RIFF")
+	binary.Write(bw, le, uint32(riffSize))
+	bw.WriteString("WAVE")
+
+	bw.WriteString("fmt ")
+	binary.Write(bw, le, uint32(16))
+	binary.Write(bw, le, uint16(1)) // PCM
+	binary.Write(bw, le, uint16(1)) // Mono
+	binary.Write(bw, le, uint32(wavSampleRate))
+	binary.Write(bw, le, uint32(wavSampleRate)) // Bytes per second
+	binary.Write(bw, le, uint16(1))             // Bytes per sample frame
+	binary.Write(bw, le, uint16(8))             // Bits per sample
+
+	chunkType := []byte("rAWd")
+	bw.Write(chunkType)
+	binary.Write(bw, le, uint32(rawdSize))
+	bw.Write(data)
+	crc := crc32.NewIEEE()
+	crc.Write(chunkType)
+	crc.Write(data)
+	binary.Write(bw, binary.BigEndian, crc.Sum32())
+	if rawdSize%2 == 1 {
+		bw.WriteByte(0)
+	}
+
+	// 8-bit PCM samples are unsigned, so silence is 0x80
+	bw.WriteString("data")
+	binary.Write(bw, le, uint32(wavSilenceBytes))
+	bw.Write(bytes.Repeat([]byte{0x80}, wavSilenceBytes))
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writing WAV: %w", err)
+	}
+	return nil
+}
+
+// ExtractDataFromWAV extracts embedded data from a WAV file's custom 'rAWd' chunk,
+// verifying its CRC
+func ExtractDataFromWAV(r io.Reader) ([]byte, error) {
+	all, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read WAV data: %w", err)
+	}
+	p, err := FindWAVPayload(all)
+	if err != nil {
+		return nil, err
+	}
+	if !p.CRCValid() {
+		return nil, fmt.Errorf("CRC mismatch in 'rAWd' chunk: expected 0x%08x, calculated 0x%08x: %w", p.StoredCRC, p.ComputedCRC, ErrChecksumMismatch)
+	}
+	return p.Data, nil
+}
+
+// WAVPayload is the 'rAWd' chunk of a WAV chunk file, as found by FindWAVPayload
+type WAVPayload struct {
+	Data        []byte // Chunk data
+	StoredCRC   uint32 // CRC recorded in the file
+	ComputedCRC uint32 // CRC of the chunk type and data as read
+}
+
+// CRCValid reports whether the stored CRC matches the data
+func (p WAVPayload) CRCValid() bool {
+	return p.StoredCRC == p.ComputedCRC
+}
+
+// IsWAV reports whether data starts like a RIFF WAVE file
+func IsWAV(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE"
+}
+
+// FindWAVPayload walks the chunks of a WAV file and returns its 'rAWd' chunk. Unlike
+// ExtractDataFromWAV, a CRC mismatch is reported in the result rather than as an error,
+// so that the contents of a damaged chunk file can still be examined.
+func FindWAVPayload(all []byte) (WAVPayload, error) {
+	if !IsWAV(all) {
+		return WAVPayload{}, fmt.Errorf("invalid WAV header")
+	}
+
+	for pos := 12; pos < len(all); {
+		if pos+8 > len(all) {
+			return WAVPayload{}, fmt.Errorf("truncated WAV chunk header at offset %d", pos)
+		}
+		chunkType := all[pos : pos+4]
+		length := int64(binary.LittleEndian.Uint32(all[pos+4 : pos+8]))
+		dataEnd := int64(pos) + 8 + length
+		if dataEnd > int64(len(all)) {
+			return WAVPayload{}, fmt.Errorf("WAV chunk %q at offset %d claims %d bytes, but the file ends first", chunkType, pos, length)
+		}
+
+		if string(chunkType) == "rAWd" {
+			if length < 4 {
+				return WAVPayload{}, fmt.Errorf("'rAWd' chunk is too short to hold a CRC")
+			}
+			data := all[pos+8 : dataEnd-4]
+			crc := crc32.NewIEEE()
+			crc.Write(chunkType)
+			crc.Write(data)
+			return WAVPayload{
+				Data:        data,
+				StoredCRC:   binary.BigEndian.Uint32(all[dataEnd-4 : dataEnd]),
+				ComputedCRC: crc.Sum32(),
+			}, nil
+		}
+		pos = int(dataEnd + length%2)
+	}
+	return WAVPayload{}, fmt.Errorf("'rAWd' chunk not found")
+}
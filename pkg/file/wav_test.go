@@ -0,0 +1,102 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestWAVRoundTrip(t *testing.T) {
+	// Both even and odd lengths, since odd RIFF chunks are padded
+	for _, size := range []int{0, 1, 1000, 1001} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i * 13)
+		}
+
+		var buf bytes.Buffer
+		if err := encodeWAVWithData(&buf, data); err != nil {
+			t.Fatalf("encodeWAVWithData(%d bytes) failed: %v", size, err)
+		}
+		wav := buf.Bytes()
+		if !IsWAV(wav) {
+			t.Fatalf("Encoded file does not start with a RIFF WAVE header")
+		}
+		if riffSize := binary.LittleEndian.Uint32(wav[4:8]); int(riffSize) != len(wav)-8 {
+			t.Errorf("RIFF size is %d, but the file has %d bytes after the header", riffSize, len(wav)-8)
+		}
+
+		got, err := ExtractDataFromWAV(bytes.NewReader(wav))
+		if err != nil {
+			t.Fatalf("ExtractDataFromWAV(%d bytes) failed: %v", size, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Extracted %d bytes do not match the original", size)
+		}
+	}
+}
+
+func TestWAVDetectsCorruption(t *testing.T) {
+	data := bytes.Repeat([]byte("padlock"), 100)
+	var buf bytes.Buffer
+	if err := encodeWAVWithData(&buf, data); err != nil {
+		t.Fatalf("encodeWAVWithData failed: %v", err)
+	}
+	wav := buf.Bytes()
+
+	// The payload starts after the RIFF header, the 'fmt ' chunk, and the 'rAWd' chunk header
+	wav[12+24+8+10] ^= 0xFF
+
+	if _, err := ExtractDataFromWAV(bytes.NewReader(wav)); err == nil {
+		t.Errorf("Expected a CRC mismatch for a corrupted WAV")
+	}
+	p, err := FindWAVPayload(wav)
+	if err != nil {
+		t.Fatalf("FindWAVPayload failed: %v", err)
+	}
+	if p.CRCValid() {
+		t.Errorf("Expected CRCValid to report the corruption")
+	}
+
+	if _, err := ExtractDataFromWAV(bytes.NewReader(wav[:100])); err == nil {
+		t.Errorf("Expected an error for a truncated WAV")
+	}
+}
+
+func TestWavFormatter(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "padlock-wav-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	collPath := filepath.Join(tempDir, "3C5")
+	data := []byte("formatter chunk data")
+
+	formatter := GetFormatter(FormatWAV)
+	if err := formatter.WriteChunk(ctx, collPath, 2, 1, data); err != nil {
+		t.Fatalf("WriteChunk failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(collPath, "REC3C5_0001.WAV")); err != nil {
+		t.Fatalf("Expected REC3C5_0001.WAV: %v", err)
+	}
+	got, err := formatter.ReadChunk(ctx, collPath, 2, 1)
+	if err != nil {
+		t.Fatalf("ReadChunk failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Read data does not match the original")
+	}
+
+	if format, err := DetermineCollectionFormat(collPath); err != nil || format != FormatWAV {
+		t.Errorf("DetermineCollectionFormat = %q, %v; want %q", format, err, FormatWAV)
+	}
+}
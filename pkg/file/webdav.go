@@ -0,0 +1,298 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// Environment variables that supply WebDAV credentials not given in the URL, so that
+// passwords needn't appear on the command line
+const (
+	webdavUserEnv     = "PADLOCK_WEBDAV_USER"
+	webdavPasswordEnv = "PADLOCK_WEBDAV_PASSWORD"
+	webdavTokenEnv    = "PADLOCK_WEBDAV_TOKEN"
+)
+
+// webdavClient talks to a WebDAV server such as Nextcloud or ownCloud, using only the
+// MKCOL, PUT, PROPFIND, and GET methods
+type webdavClient struct {
+	base     *url.URL // Collection that the padlock files are stored in
+	user     string
+	password string
+	token    string // Bearer token, used instead of the user and password if set
+	http     *http.Client
+}
+
+// newWebDAVDestination delivers to webdavs://[user[:password]@]host[:port]/path over HTTPS,
+// or webdav:// over plain HTTP. For Nextcloud, the path is the user's files endpoint, e.g.
+// webdavs://cloud.example.com/remote.php/dav/files/alice/padlock/share2.
+//
+// Credentials not given in the URL are taken from PADLOCK_WEBDAV_USER and
+// PADLOCK_WEBDAV_PASSWORD (an app password, for Nextcloud), or a bearer token from
+// PADLOCK_WEBDAV_TOKEN.
+func newWebDAVDestination(ctx context.Context, u *url.URL) (Destination, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("%s destination %s has no host", u.Scheme, u.Redacted())
+	}
+
+	c := &webdavClient{
+		user:     os.Getenv(webdavUserEnv),
+		password: os.Getenv(webdavPasswordEnv),
+		token:    os.Getenv(webdavTokenEnv),
+		http:     http.DefaultClient,
+	}
+	if u.User != nil {
+		c.user = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			c.password = password
+		}
+	}
+
+	scheme := "https"
+	if strings.EqualFold(u.Scheme, "webdav") {
+		scheme = "http"
+	}
+	c.base = &url.URL{Scheme: scheme, Host: u.Host, Path: "/" + strings.Trim(u.Path, "/")}
+
+	// The destination is reported, logged, and cataloged without the password
+	shown := *u
+	if u.User != nil {
+		shown.User = url.User(u.User.Username())
+	}
+
+	dest, err := NewStagedDestination(shown.String(), c.upload)
+	if err != nil {
+		return nil, err
+	}
+	dest.Download = c.download
+	return dest, nil
+}
+
+// url returns the URL of a file or collection below the base collection
+func (c *webdavClient) url(rel string) string {
+	u := *c.base
+	u.Path = path.Join(c.base.Path, rel)
+	return u.String()
+}
+
+// do sends an authenticated request, returning an error if the status isn't one of ok
+func (c *webdavClient) do(ctx context.Context, method, rel string, body io.Reader, size int64, header http.Header, ok ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url(rel), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.user != "":
+		req.SetBasicAuth(c.user, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%s %s: %s (check the credentials in the URL or %s and %s)",
+			method, c.url(rel), resp.Status, webdavUserEnv, webdavPasswordEnv)
+	}
+	return nil, fmt.Errorf("%s %s: %s", method, c.url(rel), resp.Status)
+}
+
+// mkcol creates a collection, and any missing parents, succeeding if it already exists
+func (c *webdavClient) mkcol(ctx context.Context, rel string) error {
+	// 405 means the collection exists; 409 means its parent doesn't, so create that first
+	resp, err := c.do(ctx, "MKCOL", rel, nil, 0, nil,
+		http.StatusCreated, http.StatusMethodNotAllowed, http.StatusConflict)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		return nil
+	}
+
+	if parent := path.Dir(path.Join(c.base.Path, rel)); parent == "/" {
+		return fmt.Errorf("MKCOL %s: %s", c.url(rel), resp.Status)
+	}
+	if err := c.mkcol(ctx, path.Join(rel, "..")); err != nil {
+		return err
+	}
+	resp, err = c.do(ctx, "MKCOL", rel, nil, 0, nil, http.StatusCreated, http.StatusMethodNotAllowed)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// upload copies the files and directories in localDir to the base collection
+func (c *webdavClient) upload(ctx context.Context, localDir string) error {
+	log := trace.FromContext(ctx).WithPrefix("WEBDAV")
+
+	return filepath.WalkDir(localDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			log.Debugf("Creating collection %s", c.url(rel))
+			return c.mkcol(ctx, rel)
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		log.Debugf("Uploading %s (%d bytes) to %s", p, info.Size(), c.url(rel))
+		header := http.Header{"Content-Type": {"application/octet-stream"}}
+		resp, err := c.do(ctx, http.MethodPut, rel, f, info.Size(), header,
+			http.StatusOK, http.StatusCreated, http.StatusNoContent)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	})
+}
+
+// davMultistatus is the part of a PROPFIND response that padlock uses
+type davMultistatus struct {
+	Responses []struct {
+		Href       string    `xml:"href"`
+		Collection *struct{} `xml:"propstat>prop>resourcetype>collection"`
+	} `xml:"response"`
+}
+
+// davEntry is a file or collection listed by PROPFIND
+type davEntry struct {
+	name  string
+	isDir bool
+}
+
+// list returns the files and collections directly inside a collection
+func (c *webdavClient) list(ctx context.Context, rel string) ([]davEntry, error) {
+	const body = `<?xml version="1.0" encoding="utf-8"?><d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/></d:prop></d:propfind>`
+	header := http.Header{"Depth": {"1"}, "Content-Type": {"application/xml; charset=utf-8"}}
+	resp, err := c.do(ctx, "PROPFIND", rel, strings.NewReader(body), int64(len(body)), header, http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("PROPFIND %s: invalid response: %w", c.url(rel), err)
+	}
+
+	self := strings.TrimSuffix(path.Join(c.base.Path, rel), "/")
+	var entries []davEntry
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, fmt.Errorf("PROPFIND %s: invalid href %q", c.url(rel), r.Href)
+		}
+		p := strings.TrimSuffix(href.Path, "/")
+		if p == self {
+			continue
+		}
+		// Only direct children are expected; anything else is ignored rather than trusted
+		if strings.TrimSuffix(path.Dir(p), "/") != self {
+			continue
+		}
+		name := path.Base(p)
+		if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			continue
+		}
+		entries = append(entries, davEntry{name: name, isDir: r.Collection != nil})
+	}
+	return entries, nil
+}
+
+// download copies the files and collections in the base collection to localDir
+func (c *webdavClient) download(ctx context.Context, localDir string) error {
+	return c.downloadDir(ctx, ".", localDir)
+}
+
+func (c *webdavClient) downloadDir(ctx context.Context, rel, localDir string) error {
+	log := trace.FromContext(ctx).WithPrefix("WEBDAV")
+
+	entries, err := c.list(ctx, rel)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entryRel := path.Join(rel, entry.name)
+		localPath := filepath.Join(localDir, entry.name)
+
+		if entry.isDir {
+			if err := os.MkdirAll(localPath, 0755); err != nil {
+				return err
+			}
+			if err := c.downloadDir(ctx, entryRel, localPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		log.Debugf("Downloading %s to %s", c.url(entryRel), localPath)
+		resp, err := c.do(ctx, http.MethodGet, entryRel, nil, 0, nil, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		err = writeDownload(localPath, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("GET %s: %w", c.url(entryRel), err)
+		}
+	}
+	return nil
+}
+
+// writeDownload writes a downloaded file
+func writeDownload(localPath string, r io.Reader) error {
+	f, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,187 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// memDAV is a minimal in-memory WebDAV server that requires basic authentication
+type memDAV struct {
+	mutex sync.Mutex
+	dirs  map[string]bool
+	files map[string][]byte
+}
+
+func newMemDAV() *memDAV {
+	return &memDAV{dirs: map[string]bool{"/": true, "/dav": true}, files: map[string][]byte{}}
+}
+
+func (m *memDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, password, ok := r.BasicAuth(); !ok || user != "alice" || password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	p := strings.TrimSuffix(r.URL.Path, "/")
+	switch r.Method {
+	case "MKCOL":
+		switch {
+		case m.dirs[p]:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case !m.dirs[path.Dir(p)]:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			m.dirs[p] = true
+			w.WriteHeader(http.StatusCreated)
+		}
+	case http.MethodPut:
+		if !m.dirs[path.Dir(p)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		m.files[p] = data
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		data, ok := m.files[p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case "PROPFIND":
+		if !m.dirs[p] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var names []string
+		for d := range m.dirs {
+			if path.Dir(d) == p && d != p {
+				names = append(names, d+"/")
+			}
+		}
+		for f := range m.files {
+			if path.Dir(f) == p {
+				names = append(names, f)
+			}
+		}
+		sort.Strings(names)
+
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+		fmt.Fprintf(w, `<d:response><d:href>%s/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop></d:propstat></d:response>`, p)
+		for _, name := range names {
+			resourceType := ""
+			if strings.HasSuffix(name, "/") {
+				resourceType = "<d:collection/>"
+			}
+			fmt.Fprintf(w, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype>%s</d:resourcetype></d:prop></d:propstat></d:response>`,
+				strings.ReplaceAll(name, " ", "%20"), resourceType)
+		}
+		fmt.Fprintf(w, `</d:multistatus>`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestWebDAVDestination(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	server := newMemDAV()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	dest, err := ParseDestination(ctx, "webdav://alice:secret@"+host+"/dav/padlock/share2")
+	if err != nil {
+		t.Fatalf("ParseDestination failed: %v", err)
+	}
+	defer dest.Cleanup()
+	if strings.Contains(dest.String(), "secret") {
+		t.Errorf("Destination %q shows the password", dest.String())
+	}
+
+	// A collection directory holding a file with a space in its name, and an archive
+	collDir := filepath.Join(dest.LocalDir(), "2A3")
+	if err := os.MkdirAll(collDir, 0755); err != nil {
+		t.Fatalf("Failed to create staged collection: %v", err)
+	}
+	staged := map[string]string{
+		"2A3/IMG2A3_0001.PNG":  "chunk one",
+		"2A3/padlock one.json": "metadata",
+		"2B3.tar":              "archive",
+	}
+	for name, content := range staged {
+		if err := os.WriteFile(filepath.Join(dest.LocalDir(), name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write staged file: %v", err)
+		}
+	}
+
+	if err := dest.Publish(ctx); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	for name, content := range staged {
+		if got := string(server.files["/dav/padlock/share2/"+name]); got != content {
+			t.Errorf("Uploaded %s = %q, want %q", name, got, content)
+		}
+	}
+
+	// Read it all back through a second destination, with credentials from the environment
+	t.Setenv(webdavUserEnv, "alice")
+	t.Setenv(webdavPasswordEnv, "secret")
+	source, err := ParseDestination(ctx, "webdav://"+host+"/dav/padlock/share2/")
+	if err != nil {
+		t.Fatalf("ParseDestination failed: %v", err)
+	}
+	defer source.Cleanup()
+	if err := source.(Source).Fetch(ctx); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	for name, content := range staged {
+		got, err := os.ReadFile(filepath.Join(source.LocalDir(), name))
+		if err != nil || string(got) != content {
+			t.Errorf("Downloaded %s = %q, %v; want %q", name, got, err, content)
+		}
+	}
+}
+
+func TestWebDAVDestinationErrors(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	ts := httptest.NewServer(newMemDAV())
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	dest, err := ParseDestination(ctx, "webdav://alice:wrong@"+host+"/dav/share2")
+	if err != nil {
+		t.Fatalf("ParseDestination failed: %v", err)
+	}
+	defer dest.Cleanup()
+	if err := os.WriteFile(filepath.Join(dest.LocalDir(), "2B3.tar"), []byte("archive"), 0644); err != nil {
+		t.Fatalf("Failed to write staged file: %v", err)
+	}
+	if err := dest.Publish(ctx); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an authentication error, got %v", err)
+	}
+	if err := dest.(Source).Fetch(ctx); err == nil {
+		t.Errorf("Expected Fetch to fail without valid credentials")
+	}
+
+	if _, err := ParseDestination(ctx, "webdavs:///no/host"); err == nil {
+		t.Errorf("Expected an error for a URL without a host")
+	}
+}
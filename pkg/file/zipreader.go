@@ -0,0 +1,119 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// ZipCollectionReader streams the chunks of a ZIP collection one entry at a time, in archive
+// order, without extracting the archive. Only the ZIP central directory and the entry being
+// read are held in memory.
+type ZipCollectionReader struct {
+	Collection    Collection
+	zipReader     *zip.ReadCloser // Open ZIP file, or nil before the first read and after the last
+	nextEntry     int             // Index in the central directory of the next entry to examine
+	done          bool            // Set once every entry has been examined
+	lastChunkName string          // Entry name of the most recently read chunk
+}
+
+// NewZipCollectionReader creates a reader for the chunks of a ZIP collection. The file is
+// opened on the first read.
+func NewZipCollectionReader(collection Collection) *ZipCollectionReader {
+	return &ZipCollectionReader{Collection: collection}
+}
+
+// ReadNextChunk returns the payload of the next chunk entry, with any PNG wrapping removed,
+// or io.EOF after the last one
+func (zr *ZipCollectionReader) ReadNextChunk(ctx context.Context) ([]byte, error) {
+	log := trace.FromContext(ctx).WithPrefix("ZIP-READER")
+
+	if zr.done {
+		return nil, io.EOF
+	}
+
+	// If this is the first time accessing the ZIP file, open it and read its central directory
+	if zr.zipReader == nil {
+		log.Debugf("Opening ZIP file for streaming: %s", zr.Collection.Path)
+		r, err := zip.OpenReader(zr.Collection.Path)
+		if err != nil {
+			log.Error(fmt.Errorf("failed to open ZIP file: %w", err))
+			return nil, fmt.Errorf("failed to open ZIP file: %w", err)
+		}
+		zr.zipReader = r
+		zr.nextEntry = 0
+	}
+
+	for zr.nextEntry < len(zr.zipReader.File) {
+		f := zr.zipReader.File[zr.nextEntry]
+		zr.nextEntry++
+
+		// Get the file name and extension
+		name := f.Name
+		ext := strings.ToUpper(filepath.Ext(name))
+
+		// Skip anything that isn't a chunk, such as the collection metadata
+		if !f.Mode().IsRegular() || !isChunkFile(zr.Collection.Format, name) {
+			log.Debugf("Skipping non-chunk file in ZIP: %s", name)
+			continue
+		}
+
+		log.Debugf("Reading chunk (file: %s) from ZIP for collection %s", name, zr.Collection.Name)
+
+		data, err := readZipChunk(f, ext, zr.Collection.PNGEmbedding)
+		if err != nil {
+			log.Error(fmt.Errorf("failed to read chunk %s from ZIP: %w", name, err))
+			return nil, fmt.Errorf("failed to read chunk %s from ZIP: %w", name, err)
+		}
+
+		log.Debugf("Successfully read %d bytes from ZIP chunk %s", len(data), name)
+		zr.lastChunkName = name
+		return data, nil
+	}
+
+	log.Debugf("Reached end of ZIP file %s", zr.Collection.Path)
+	zr.done = true
+	zr.Close()
+	return nil, io.EOF
+}
+
+// readZipChunk streams a single chunk entry out of a ZIP file
+func readZipChunk(f *zip.File, ext string, embedding PNGEmbedding) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	switch ext {
+	case ".PNG":
+		return ExtractPNGChunkData(rc, embedding)
+	case ".TXT":
+		return ExtractDataFromText(rc)
+	case ".WAV":
+		return ExtractDataFromWAV(rc)
+	}
+	return ExtractDataFromBin(rc)
+}
+
+// LastChunkName returns the entry name of the chunk most recently returned by ReadNextChunk
+func (zr *ZipCollectionReader) LastChunkName() string {
+	return zr.lastChunkName
+}
+
+// Close releases the ZIP file, if it is open
+func (zr *ZipCollectionReader) Close() error {
+	if zr.zipReader == nil {
+		return nil
+	}
+	err := zr.zipReader.Close()
+	zr.zipReader = nil
+	return err
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package file
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestRenamedZipCollection(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	tempDir, err := os.MkdirTemp("", "padlock-zipreader-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A custodian may rename the ZIP, so the collection is identified by its entries
+	zipPath := filepath.Join(tempDir, "share for alice.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatalf("Failed to create zip file: %v", err)
+	}
+	zw := zip.NewWriter(f)
+	entries := []struct{ name, data string }{
+		{MetadataFileName, `{"version":1}`},
+		{"2B3_0001.bin", "first chunk"},
+		{"2B3_0002.bin", "second chunk"},
+	}
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		if _, err := w.Write([]byte(e.data)); err != nil {
+			t.Fatalf("Failed to write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close zip writer: %v", err)
+	}
+	f.Close()
+
+	collections, extractDir, err := FindCollections(ctx, tempDir)
+	if err != nil {
+		t.Fatalf("FindCollections failed: %v", err)
+	}
+	if extractDir != "" {
+		os.RemoveAll(extractDir)
+		t.Errorf("FindCollections extracted the ZIP file to %s", extractDir)
+	}
+	if len(collections) != 1 || collections[0].Name != "2B3" || collections[0].Path != zipPath {
+		t.Fatalf("Unexpected collections %+v", collections)
+	}
+
+	reader := NewZipCollectionReader(collections[0])
+	defer reader.Close()
+	for _, want := range entries[1:] {
+		data, err := reader.ReadNextChunk(ctx)
+		if err != nil {
+			t.Fatalf("ReadNextChunk failed: %v", err)
+		}
+		if string(data) != want.data || reader.LastChunkName() != want.name {
+			t.Errorf("Read %s %q, want %s %q", reader.LastChunkName(), data, want.name, want.data)
+		}
+	}
+	if _, err := reader.ReadNextChunk(ctx); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last chunk, got %v", err)
+	}
+	if _, err := reader.ReadNextChunk(ctx); err != io.EOF {
+		t.Errorf("Expected io.EOF to repeat after the last chunk, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package pad
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnresolvedAlias is returned for a chunk whose header names its collection by an alias
+// that the pad wasn't given the collection name of. Collections stored under stealth names
+// are written this way, so that their chunks don't reveal the K-of-N scheme; the caller
+// resolves the alias from the collection's metadata, which may be sealed.
+var ErrUnresolvedAlias = errors.New("unresolved collection alias")
+
+// Aliases maps the opaque names written in chunk headers in place of collection names, such
+// as "share-9f2c41d7", to the collection names they stand for, such as "3A5". Encode writes
+// the alias of each collection that has one, and decode, repair, and ParseChunkHeaderWith
+// read the collection name back through it.
+type Aliases map[string]string
+
+// Resolve returns the collection name that name, taken from a chunk header, stands for: the
+// name itself unless it is an alias
+func (a Aliases) Resolve(name string) string {
+	if collName, ok := a[name]; ok {
+		return collName
+	}
+	return name
+}
+
+// aliasOf returns the name written in the chunk headers of collection collName: its alias,
+// or collName if it has none
+func (a Aliases) aliasOf(collName string) string {
+	for alias, name := range a {
+		if name == collName {
+			return alias
+		}
+	}
+	return collName
+}
+
+// parseHeaderName returns the name, K, N, and letter of the collection a chunk header names,
+// by its name or by an alias. A name that is neither is an ErrUnresolvedAlias, and, since it
+// may be a damaged collection name, an ErrCorruptChunk too.
+func (a Aliases) parseHeaderName(name string) (collName string, requiredCopies int, totalCopies int, collLetter string, err error) {
+	collName = a.Resolve(name)
+	requiredCopies, totalCopies, collLetter, err = extractFromCollectionLabel(collName)
+	switch {
+	case err == nil:
+		return collName, requiredCopies, totalCopies, collLetter, nil
+	case collName == name:
+		return "", 0, 0, "", fmt.Errorf("chunk header names collection %q, which is neither a collection name nor a known alias: %w: %w",
+			name, ErrUnresolvedAlias, ErrCorruptChunk)
+	}
+	return "", 0, 0, "", fmt.Errorf("alias %q stands for %q, which is not a collection name: %w: %w", name, collName, err, ErrCorruptChunk)
+}
@@ -18,7 +18,7 @@
 //
 // Implementation details:
 // - Data is divided into fixed-size chunks for processing
-// - Each chunk is split across N collections
+// - Each chunk is split across N collections by a Sharing scheme: OTP (the default) or Shamir
 // - Collections are generated so that any K of them can reconstruct the original data
 // - File names on disk use format "<collectionName>_<chunkNumber>.<format>" (e.g., "3A5_0001.bin")
 // - Internally within files, chunk names are stored as "<collectionName>-<chunkNumber>" (e.g., "3A5-1")
@@ -31,16 +31,48 @@ package pad
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"unicode"
 
 	"github.com/blues/padlock/pkg/trace"
 )
 
+// Errors returned, wrapped with the details, for the failures callers most often need to tell
+// apart. Test for them with errors.Is.
+var (
+	// ErrInvalidScheme is returned for K and N values that don't form a K-of-N scheme
+	ErrInvalidScheme = errors.New("invalid K-of-N scheme")
+
+	// ErrInsufficientCollections is returned when fewer collections are available than an
+	// operation needs
+	ErrInsufficientCollections = errors.New("not enough collections")
+
+	// ErrCorruptChunk is returned when a chunk is truncated, out of sequence, or has a header
+	// that can't be parsed
+	ErrCorruptChunk = errors.New("corrupt chunk")
+
+	// ErrMixedSessions is returned when the collections supplied together were not all
+	// written by the same encode
+	ErrMixedSessions = errors.New("collections are from different encodes")
+
+	// ErrNewerFormat is returned when a chunk header has a format version newer than
+	// ChunkFormatVersion
+	ErrNewerFormat = errors.New("collection was created by a newer padlock")
+)
+
+// ChunkFormatVersion is the newest chunk header format this package reads, and the one it
+// writes. A header names its format version in a last ":v<N>" part of the chunk name.
+// Version 1 headers, the only ones so far, leave it out, so that every padlock release can
+// read them; a release that changes the header writes the new version, which older releases
+// then refuse with ErrNewerFormat instead of misreading it.
+const ChunkFormatVersion = 1
+
 // NewChunkFunc defines a function type for creating new chunk files.
 // This is a callback function provided by the caller to create output files for each chunk.
 // It creates a file with the specified collection name, chunk number, and format (e.g., bin or png).
@@ -67,7 +99,21 @@ type Pad struct {
 	PermutationCount int                 // Number of unique combinations for K-of-N
 	Permutations     map[string][]string // Unique combinations for each collection (maps collection letter to array of permutations)
 	Ciphers          map[string][][]byte // Unique K-of-N combinations as byte slices (maps permutation key to array of byte slices)
+	Sharing          Sharing             // Secret sharing scheme (nil for OTP); decode and repair take it from the chunk headers
 	SizeTracker      interface{}         // Tracks file sizes during encoding and decoding operations
+	WriteThreads     int                 // Encode: collections whose chunks are written concurrently (0 or 1 = one at a time)
+	BadShares        []BadShare          // Decode: collections set aside at a bad chunk, without which the rest was decoded
+	LostChunk        int                 // Decode: the chunk that too few good collections were left to decode, if any
+	Aliases          Aliases             // Names written in chunk headers in place of collection names, such as stealth names
+}
+
+// BadShare is a collection that Decode set aside at a chunk it couldn't read, decoding that
+// chunk and the rest of the data from the other collections
+type BadShare struct {
+	Collection string // Name of the collection, or "share N" if none of its chunks could be read
+	Share      int    // Index of the collection's reader among those passed to Decode
+	Chunk      int    // Number of the bad chunk
+	Err        error  // What was wrong with it
 }
 
 // NewPadForEncode creates a new Pad instance with the specified parameters for a K-of-N threshold scheme.
@@ -90,7 +136,13 @@ type Pad struct {
 //
 // For example, with K=3, N=5, the collections would be: ["3A5", "3B5", "3C5", "3D5", "3E5"]
 func NewPadForEncode(ctx context.Context, totalCopies, requiredCopies int) (*Pad, error) {
-	p := &Pad{}
+	return NewPadForEncodeWith(ctx, totalCopies, requiredCopies, OTP)
+}
+
+// NewPadForEncodeWith is NewPadForEncode for a pad that encodes with the given secret sharing
+// scheme rather than OTP
+func NewPadForEncodeWith(ctx context.Context, totalCopies, requiredCopies int, sharing Sharing) (*Pad, error) {
+	p := &Pad{Sharing: sharing}
 	return p, PadInit(ctx, p, totalCopies, requiredCopies)
 }
 
@@ -103,6 +155,10 @@ func NewPadForEncode(ctx context.Context, totalCopies, requiredCopies int) (*Pad
 //   - A configured Pad instance that can be used until parameters can be extracted
 //   - An error if the parameters are invalid
 func NewPadForDecode(ctx context.Context, availableCopies int) (*Pad, error) {
+	// Every scheme needs at least two collections to decode
+	if availableCopies < 2 {
+		return nil, fmt.Errorf("%d collections available, but at least 2 are needed to decode: %w", availableCopies, ErrInsufficientCollections)
+	}
 	p := &Pad{}
 	return p, PadInit(ctx, p, availableCopies, availableCopies)
 }
@@ -130,13 +186,19 @@ func PadInit(ctx context.Context, p *Pad, totalCopies, requiredCopies int) error
 	log := trace.FromContext(ctx).WithPrefix("pad-init")
 	// Validate parameters to ensure they meet the requirements of the threshold scheme
 	if totalCopies < 2 || totalCopies > 26 {
-		return fmt.Errorf("totalCopies must be between 2 and 26, got %d", totalCopies)
+		return fmt.Errorf("totalCopies must be between 2 and 26, got %d: %w", totalCopies, ErrInvalidScheme)
 	}
 	if requiredCopies < 2 {
-		return fmt.Errorf("requiredCopies must be at least 2, got %d", requiredCopies)
+		return fmt.Errorf("requiredCopies must be at least 2, got %d: %w", requiredCopies, ErrInvalidScheme)
 	}
 	if requiredCopies > totalCopies {
-		return fmt.Errorf("requiredCopies cannot be greater than totalCopies, got %d > %d", requiredCopies, totalCopies)
+		return fmt.Errorf("requiredCopies cannot be greater than totalCopies, got %d > %d: %w", requiredCopies, totalCopies, ErrInvalidScheme)
+	}
+
+	if shamir, ok := p.sharing().(shamirSharing); ok {
+		if err := shamir.checkScheme(totalCopies, requiredCopies); err != nil {
+			return err
+		}
 	}
 
 	// Set up the Pad instance with the specified parameters
@@ -151,6 +213,13 @@ func PadInit(ctx context.Context, p *Pad, totalCopies, requiredCopies int) error
 		p.Collections[i] = buildCollectionLabel(requiredCopies, totalCopies, collLetter)
 	}
 
+	// Only OTP uses the key combinations, which for large K-of-N schemes are very many
+	if p.sharing() != OTP {
+		p.PermutationCount, p.Permutations, p.Ciphers = 0, nil, nil
+		log.Debugf("Pad K=%d N=%d with %s sharing", p.RequiredCopies, p.TotalCopies, SharingName(p.sharing()))
+		return nil
+	}
+
 	// Generate the key combinations for the K-of-N scheme
 	p.PermutationCount, p.Permutations, p.Ciphers = UniqueSortedCombinations(p.RequiredCopies, p.TotalCopies)
 
@@ -172,6 +241,13 @@ func buildCollectionLabel(requiredCopies, totalCopies int, collLetter string) st
 	return fmt.Sprintf("%d%s%d", requiredCopies, collLetter, totalCopies)
 }
 
+// ParseCollectionName parses a collection name like "3A5" into the K and N of its
+// distribution and its letter, so that what a set of collections needs can be known from
+// their names alone
+func ParseCollectionName(name string) (requiredCopies int, totalCopies int, letter string, err error) {
+	return extractFromCollectionLabel(name)
+}
+
 // extractFromCollectionLabel parses a label like "3A5" and returns requiredCopies, totalCopies, and collLetter
 // with full validation according to the defined rules.
 func extractFromCollectionLabel(label string) (requiredCopies int, totalCopies int, collLetter string, err error) {
@@ -260,31 +336,68 @@ func collectionLetterFromIndex(i int) string {
 	return string(rune('A' + i))
 }
 
-// Build a chunk name for a given collection name and chunk number and chunk data size
-func buildChunkName(collName string, chunkNumber, chunkDataBytes int) string {
-	return fmt.Sprintf("%s:%d:%d", collName, chunkNumber, chunkDataBytes)
+// Build a chunk name for a given collection name and chunk number and chunk data size. The
+// name of the secret sharing scheme follows unless it is OTP, whose chunk names predate it,
+// and then the format version unless it is 1.
+func buildChunkName(collName string, chunkNumber, chunkDataBytes int, sharingName string) string {
+	name := fmt.Sprintf("%s:%d:%d", collName, chunkNumber, chunkDataBytes)
+	if sharingName != "" {
+		name += ":" + sharingName
+	}
+	if ChunkFormatVersion > 1 {
+		name += fmt.Sprintf(":v%d", ChunkFormatVersion)
+	}
+	return name
+}
+
+// chunkNameVersion splits the format version off the end of a chunk name, returning the
+// parts of the name before it and the version, which is 1 if the name doesn't give one.
+// A version newer than ChunkFormatVersion is an ErrNewerFormat.
+func chunkNameVersion(parts []string) ([]string, int, error) {
+	last := parts[len(parts)-1]
+	if len(parts) < 4 || len(last) < 2 || last[0] != 'v' {
+		return parts, 1, nil
+	}
+	version, err := strconv.Atoi(last[1:])
+	if err != nil || version < 1 {
+		return nil, 0, fmt.Errorf("invalid chunk format version %q", last)
+	}
+	if version > ChunkFormatVersion {
+		return nil, 0, fmt.Errorf("chunk format version %d, but this padlock reads up to version %d: %w", version, ChunkFormatVersion, ErrNewerFormat)
+	}
+	return parts[:len(parts)-1], version, nil
 }
 
 // extractFromChunkName parses chunkName into its parts, validating each field.
-func extractFromChunkName(chunkName string) (collName string, chunkNumber int, chunkDataBytes int, err error) {
-	parts := strings.Split(chunkName, ":")
-	if len(parts) != 3 {
-		return "", 0, 0, fmt.Errorf("invalid chunk name format: expected 3 parts separated by ':'")
+func extractFromChunkName(chunkName string) (collName string, chunkNumber int, chunkDataBytes int, sharing Sharing, err error) {
+	parts, _, err := chunkNameVersion(strings.Split(chunkName, ":"))
+	if err != nil {
+		return "", 0, 0, nil, err
+	}
+	if len(parts) != 3 && len(parts) != 4 {
+		return "", 0, 0, nil, fmt.Errorf("invalid chunk name format: expected 3 or 4 parts separated by ':'")
 	}
 
 	collName = parts[0]
 
 	chunkNumber, err = strconv.Atoi(parts[1])
 	if err != nil || chunkNumber <= 0 {
-		return "", 0, 0, fmt.Errorf("invalid chunkNumber: must be positive integer")
+		return "", 0, 0, nil, fmt.Errorf("invalid chunkNumber: must be positive integer")
 	}
 
 	chunkDataBytes, err = strconv.Atoi(parts[2])
 	if err != nil || chunkDataBytes <= 0 {
-		return "", 0, 0, fmt.Errorf("invalid chunkDataBytes: must be positive integer")
+		return "", 0, 0, nil, fmt.Errorf("invalid chunkDataBytes: must be positive integer")
+	}
+
+	sharing = OTP
+	if len(parts) == 4 {
+		if sharing, err = SharingByName(parts[3]); err != nil || sharing == OTP {
+			return "", 0, 0, nil, fmt.Errorf("invalid secret sharing scheme %q", parts[3])
+		}
 	}
 
-	return collName, chunkNumber, chunkDataBytes, nil
+	return collName, chunkNumber, chunkDataBytes, sharing, nil
 }
 
 // UniqueSortedCombinations generates the combinatorial structures needed for the K-of-N threshold scheme.
@@ -403,46 +516,297 @@ func UniqueSortedCombinations(K, N int) (int, map[string][]string, map[string][]
 //     c. Distribute data across N collections according to the threshold scheme
 //     d. Write the data to each collection with proper headers
 //
+// Reading, pad generation, and writing run as overlapping stages, so input and randomSource
+// are each read from a goroutine of their own. newChunk is always called from the caller's
+// goroutine, in chunk order and then collection order, and none of them are used once
+// Encode returns.
+//
 // Security considerations:
 //   - The randomSource MUST provide cryptographically secure random numbers
 //   - The same pad must NEVER be reused
 //   - Each chunk has a unique name to ensure it's properly tracked during decoding
 func (p *Pad) Encode(ctx context.Context, outputChunkBytes int, input io.Reader, randomSource RNG, newChunk NewChunkFunc, chunkFormat string) error {
+	return p.EncodeFrom(ctx, 1, outputChunkBytes, input, randomSource, newChunk, chunkFormat)
+}
+
+// EncodeFrom is Encode with chunks numbered from firstChunk rather than 1. It is used to
+// resume an interrupted encode: the caller skips the input already encoded by the first
+// firstChunk-1 chunks, which is (firstChunk-1) * InputChunkBytes(outputChunkBytes) bytes,
+// and EncodeFrom continues with the next chunk.
+func (p *Pad) EncodeFrom(ctx context.Context, firstChunk int, outputChunkBytes int, input io.Reader, randomSource RNG, newChunk NewChunkFunc, chunkFormat string) error {
 	log := trace.FromContext(ctx).WithPrefix("encode")
 
+	if firstChunk < 1 {
+		return fmt.Errorf("invalid first chunk number %d", firstChunk)
+	}
+
 	// Compute a size of input to process in each chunk, given the number of ciphers that must fit into the chunk
-	inputChunkBytes := outputChunkBytes / p.PermutationCount
+	inputChunkBytes := p.InputChunkBytes(outputChunkBytes)
 	log.Debugf("Starting encode with inputChunkBytes=%d outputChunkBytes=%d", inputChunkBytes, outputChunkBytes)
 
-	// Process input data chunk by chunk until end of stream
-	buffer := make([]byte, inputChunkBytes)
-	for chunkIndex := 1; ; chunkIndex++ {
+	// The encode is a pipeline of three stages connected by channels, so that reading input
+	// and drawing pads from the RNG overlap with writing chunks out: a reader fills chunks of
+	// input, a generator draws the pads for each chunk and XORs them with its data, and this
+	// goroutine writes the ciphers to the collections. The channels are unbuffered, so each
+	// stage works at most one chunk ahead of the next.
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	inputs := make(chan encodeInput)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(inputs)
+		p.readChunks(ctx, firstChunk, inputChunkBytes, input, inputs)
+	}()
+
+	generated := make(chan encodeCiphers)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(generated)
+		p.generateChunks(ctx, inputs, randomSource, generated)
+	}()
+
+	for chunk := range generated {
+		if chunk.err != nil {
+			return chunk.err
+		}
+		if err := p.writeChunk(ctx, chunk, newChunk, chunkFormat); err != nil {
+			return err
+		}
+	}
+
+	// Stop if the operation was cancelled or its deadline passed
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	log.Debugf("Encode completed successfully")
+	return nil
+}
+
+// encodeInput is a chunk of input read by the first stage of the encode pipeline, or the
+// error that ended the input
+type encodeInput struct {
+	number int
+	data   []byte
+	err    error
+}
+
+// encodeCiphers is a chunk whose ciphers have been generated and are ready to be written,
+// or the error that ended the encode
+type encodeCiphers struct {
+	number    int
+	dataBytes int
+	pieces    map[string][][]byte // Pieces each collection holds, keyed by collection letter
+	err       error
+}
+
+// readChunks reads input a chunk at a time, numbering chunks from firstChunk, and sends
+// them to inputs until the input ends, fails, or ctx is done. Two buffers are used in turn:
+// a chunk's buffer is only refilled after the next chunk has been received, by which time
+// the generator has copied the data out of it.
+func (p *Pad) readChunks(ctx context.Context, firstChunk int, inputChunkBytes int, input io.Reader, inputs chan<- encodeInput) {
+	log := trace.FromContext(ctx).WithPrefix("encode")
+
+	send := func(in encodeInput) bool {
+		select {
+		case inputs <- in:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	buffers := [2][]byte{make([]byte, inputChunkBytes), make([]byte, inputChunkBytes)}
+	for chunkIndex := firstChunk; ; chunkIndex++ {
+		if ctx.Err() != nil {
+			return
+		}
 
 		// Read a chunk of data from the input stream
+		buffer := buffers[chunkIndex%2]
 		bytesRead, err := io.ReadFull(input, buffer)
-		if bytesRead > 0 {
-
-			// Create a new chunk
-			if err := p.encodeOneChunk(ctx, buffer[:bytesRead], chunkIndex, randomSource, newChunk, chunkFormat); err != nil {
-				return err
-			}
+		if bytesRead > 0 && !send(encodeInput{number: chunkIndex, data: buffer[:bytesRead]}) {
+			return
 		}
 
 		// Check for errors or EOF
 		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			// We've reached the end of the input
-			log.Debugf("Reached end of input stream after %d chunks", chunkIndex-1)
-			break
+			log.Debugf("Reached end of input stream after chunk %d", chunkIndex-1)
+			return
 		} else if err != nil {
-			return fmt.Errorf("input read error: %w", err)
+			send(encodeInput{err: fmt.Errorf("input read error: %w", err)})
+			return
 		}
 	}
+}
 
-	log.Debugf("Encode completed successfully")
-	return nil
+// generateChunks generates the ciphers for each chunk received from inputs and sends them
+// to generated, until inputs is closed, an error occurs, or ctx is done
+func (p *Pad) generateChunks(ctx context.Context, inputs <-chan encodeInput, randomSource RNG, generated chan<- encodeCiphers) {
+	for in := range inputs {
+		chunk := encodeCiphers{number: in.number, dataBytes: len(in.data), err: in.err}
+		if chunk.err == nil {
+			trace.FromContext(ctx).WithPrefix("encode").Debugf("Chunk %d: processing %d bytes of data", in.number, len(in.data))
+			chunk.pieces, chunk.err = p.sharing().Split(ctx, p, in.data, randomSource)
+		}
+		select {
+		case generated <- chunk:
+		case <-ctx.Done():
+			return
+		}
+		if chunk.err != nil {
+			return
+		}
+	}
+}
+
+// InputChunkBytes returns the number of input bytes encoded by each chunk of at most
+// outputChunkBytes, given the number of pieces that must fit into the chunk. Every chunk
+// but the last encodes exactly this many bytes.
+func (p *Pad) InputChunkBytes(outputChunkBytes int) int {
+	return outputChunkBytes / int(p.sharing().Pieces(p.TotalCopies, p.RequiredCopies))
+}
+
+// EncodedCollectionSize returns the number of bytes Encode writes to each collection of a
+// K-of-N pad when encoding inputBytes of input with the given output chunk size, without
+// creating the pad or encoding anything. Every collection receives the same number of bytes:
+// for each chunk, a length-prefixed chunk name followed by one cipher of the chunk's data
+// size per permutation the collection is in.
+func EncodedCollectionSize(totalCopies, requiredCopies, outputChunkBytes int, inputBytes int64) (int64, error) {
+	return EncodedCollectionSizeWith(OTP, totalCopies, requiredCopies, outputChunkBytes, inputBytes)
+}
+
+// EncodedCollectionSizeWith is EncodedCollectionSize for a pad that encodes with the given
+// secret sharing scheme, whose chunks hold the number of pieces the scheme needs
+func EncodedCollectionSizeWith(sharing Sharing, totalCopies, requiredCopies, outputChunkBytes int, inputBytes int64) (int64, error) {
+	if totalCopies < 2 || totalCopies > 26 || requiredCopies < 2 || requiredCopies > totalCopies {
+		return 0, fmt.Errorf("%d of %d collections: %w", requiredCopies, totalCopies, ErrInvalidScheme)
+	}
+	pieces := sharing.Pieces(totalCopies, requiredCopies)
+	inputChunkBytes := int64(outputChunkBytes) / pieces
+	if inputChunkBytes < 1 {
+		return 0, fmt.Errorf("chunk size %d is too small for %d permutations", outputChunkBytes, pieces)
+	}
+	fullChunks := inputBytes / inputChunkBytes
+	lastChunkBytes := inputBytes % inputChunkBytes
+
+	// Chunk names are "<collection>:<chunk number>:<data bytes>", then ":<scheme>" unless OTP
+	nameOverhead := int64(1 + len(buildCollectionLabel(requiredCopies, totalCopies, "A")) + 2)
+	if name := sharing.Name(); name != "" {
+		nameOverhead += int64(1 + len(name))
+	}
+	size := inputBytes * pieces
+	size += fullChunks * (nameOverhead + decimalDigits(inputChunkBytes))
+	size += decimalDigitsUpTo(fullChunks)
+	if lastChunkBytes > 0 {
+		size += nameOverhead + decimalDigits(lastChunkBytes) + decimalDigits(fullChunks+1)
+	}
+	return size, nil
+}
+
+// ChunkHeader is the header at the start of every chunk Encode writes to a collection. It
+// identifies the collection and the K-of-N scheme, so that a single chunk of a single
+// collection reveals the parameters needed to decode it.
+type ChunkHeader struct {
+	Collection     string // Name of the collection the chunk was written to (e.g., "3A5")
+	RequiredCopies int    // K: collections required for reconstruction
+	TotalCopies    int    // N: collections in the distribution
+	Number         int    // 1-based position of the chunk within the collection
+	DataBytes      int    // Size of the input data the chunk encodes
+	HeaderBytes    int    // Size of the header itself
+
+	// Sharing is the secret sharing scheme the chunk was encoded with, which the header
+	// names unless it is OTP
+	Sharing Sharing
+
+	// Version is the format version of the header, see ChunkFormatVersion
+	Version int
+}
+
+// ParseChunkHeader parses and validates the header at the start of a chunk
+func ParseChunkHeader(chunk []byte) (ChunkHeader, error) {
+	return ParseChunkHeaderWith(chunk, nil)
 }
 
-// encodeOneChunk encodes a single chunk of data using the one-time pad threshold scheme.
+// ParseChunkHeaderWith is ParseChunkHeader for a chunk whose header may name its collection
+// by one of aliases, whose Collection is then the collection name the alias stands for
+func ParseChunkHeaderWith(chunk []byte, aliases Aliases) (ChunkHeader, error) {
+	if len(chunk) < 1 || len(chunk) < 1+int(chunk[0]) {
+		return ChunkHeader{}, fmt.Errorf("chunk too short for its header: %w", ErrCorruptChunk)
+	}
+	nameLength := int(chunk[0])
+	name := string(chunk[1 : 1+nameLength])
+	collName, chunkNumber, chunkDataBytes, sharing, err := extractFromChunkName(name)
+	if errors.Is(err, ErrNewerFormat) {
+		return ChunkHeader{}, err
+	}
+	if err != nil {
+		return ChunkHeader{}, fmt.Errorf("%w: %w", err, ErrCorruptChunk)
+	}
+	_, version, _ := chunkNameVersion(strings.Split(name, ":"))
+	collName, requiredCopies, totalCopies, _, err := aliases.parseHeaderName(collName)
+	if err != nil {
+		return ChunkHeader{}, err
+	}
+	return ChunkHeader{
+		Collection:     collName,
+		RequiredCopies: requiredCopies,
+		TotalCopies:    totalCopies,
+		Number:         chunkNumber,
+		DataBytes:      chunkDataBytes,
+		HeaderBytes:    1 + nameLength,
+		Sharing:        sharing,
+		Version:        version,
+	}, nil
+}
+
+// ChunkBytes returns the size of the whole chunk the header describes: the header followed
+// by one piece of DataBytes for every piece the secret sharing scheme gives the collection,
+// which for OTP is one cipher for every permutation the collection is in
+func (h ChunkHeader) ChunkBytes() int64 {
+	sharing := h.Sharing
+	if sharing == nil {
+		sharing = OTP
+	}
+	return int64(h.HeaderBytes) + int64(h.DataBytes)*sharing.Pieces(h.TotalCopies, h.RequiredCopies)
+}
+
+// binomial returns the number of ways to choose k of n items
+func binomial(n, k int) int64 {
+	result := int64(1)
+	for i := 1; i <= k; i++ {
+		result = result * int64(n-k+i) / int64(i)
+	}
+	return result
+}
+
+// decimalDigits returns the number of decimal digits in n, for n >= 1
+func decimalDigits(n int64) int64 {
+	return int64(len(strconv.FormatInt(n, 10)))
+}
+
+// decimalDigitsUpTo returns the total number of decimal digits in the numbers 1 through n
+func decimalDigitsUpTo(n int64) int64 {
+	var total int64
+	for digits, lo := int64(1), int64(1); lo <= n; digits, lo = digits+1, lo*10 {
+		hi := lo*10 - 1
+		if hi > n {
+			hi = n
+		}
+		total += (hi - lo + 1) * digits
+	}
+	return total
+}
+
+// generateCiphers encodes a single chunk of data using the one-time pad threshold scheme,
+// returning the pieces of every permutation, keyed like Ciphers, for OTP to hand out to the
+// collections.
 //
 // This function is the core cryptographic implementation of the K-of-N threshold scheme
 // for a single chunk of data. It implements the mathematical heart of the padlock system,
@@ -477,10 +841,7 @@ func (p *Pad) Encode(ctx context.Context, outputChunkBytes int, input io.Reader,
 // Parameters:
 //   - ctx: Context for logging, cancellation, and tracing
 //   - chunkData: The input data to encode (may be less than a full chunk at the end of the stream)
-//   - chunkNumber: The sequential number of this chunk (starting at 1)
 //   - randomSource: Source of cryptographically secure random bytes
-//   - newChunk: Function to create output files for each chunk
-//   - chunkFormat: Format for output files (e.g., "bin" or "png")
 //
 // Security considerations:
 //   - The randomSource MUST provide high-quality, truly random data
@@ -490,14 +851,15 @@ func (p *Pad) Encode(ctx context.Context, outputChunkBytes int, input io.Reader,
 //   - XOR distribution creates combinatorially secure threshold guarantees
 //   - System has mathematical, not just computational, security guarantees
 //   - Security level is independent of chunk size - even 1-byte chunks have perfect secrecy
-func (p *Pad) encodeOneChunk(ctx context.Context, chunkData []byte, chunkNumber int, randomSource RNG, newChunk NewChunkFunc, chunkFormat string) error {
+func (p *Pad) generateCiphers(ctx context.Context, chunkData []byte, randomSource RNG) (map[string][][]byte, error) {
 	log := trace.FromContext(ctx).WithPrefix("encode")
 
 	// Handle the actual size of the input data, which may be less than a full chunk
 	chunkDataBytes := len(chunkData)
-	log.Debugf("Chunk %d: processing %d bytes of data", chunkNumber, chunkDataBytes)
 
-	// Generate all ciphers that will be needed for this chunk
+	// Generate all ciphers that will be needed for this chunk. They are kept apart from
+	// p.Ciphers, since the previous chunk may still be being written from its own ciphers.
+	ciphers := make(map[string][][]byte, len(p.Ciphers))
 	for key, cipher := range p.Ciphers {
 		cipher := make([][]byte, len(cipher))
 		cipher[0] = make([]byte, chunkDataBytes)
@@ -508,63 +870,102 @@ func (p *Pad) encodeOneChunk(ctx context.Context, chunkData []byte, chunkNumber
 			err := randomSource.Read(ctx, cipher[i])
 			if err != nil {
 				log.Error(fmt.Errorf("random generator error: %w", err))
-				return fmt.Errorf("random generator error: %w", err)
+				return nil, fmt.Errorf("random generator error: %w", err)
 			}
 			// XOR plaintext (chunkData) with pad to get ciphertext
-			log.Debugf("Chunk %d: %s XORing chunk data with pad[%s] to generate ciphertext[%s]", chunkNumber, key, collectionLetterFromPermutationIndex(key, i), collectionLetterFromPermutationIndex(key, 0))
-			for j := 0; j < chunkDataBytes; j++ {
-				cipher[0][j] = cipher[0][j] ^ cipher[i][j]
-			}
+			log.Debugf("%s XORing chunk data with pad[%s] to generate ciphertext[%s]", key, collectionLetterFromPermutationIndex(key, i), collectionLetterFromPermutationIndex(key, 0))
+			xorBytes(cipher[0], cipher[i])
 		}
-		p.Ciphers[key] = cipher
+		ciphers[key] = cipher
 	}
+	return ciphers, nil
+}
 
-	// Distribute the chunk across all collections
-	for _, collName := range p.Collections {
-		_, _, collLetter, err := extractFromCollectionLabel(collName)
-		if err != nil {
-			return fmt.Errorf("failed to extractFrom collection letter: %w", err)
-		}
+// writeChunk writes a chunk whose pieces have been generated to every collection.
+//
+// The chunk writers are created in collection order, so that newChunk is never called
+// concurrently, and then filled, several at a time if WriteThreads allows.
+func (p *Pad) writeChunk(ctx context.Context, chunk encodeCiphers, newChunk NewChunkFunc, chunkFormat string) error {
+	log := trace.FromContext(ctx).WithPrefix("encode")
 
-		// Create a new chunk writer for this collection
+	chunkNumber, chunkDataBytes := chunk.number, chunk.dataBytes
+	writers := make([]io.WriteCloser, len(p.Collections))
+	for i, collName := range p.Collections {
 		w, err := newChunk(collName, chunkNumber, chunkFormat)
 		if err != nil {
 			return fmt.Errorf("failed to create chunk writer for collection %s: %w", collName, err)
 		}
+		writers[i] = w
+	}
 
-		// Generate the chunk name
-		chunkName := buildChunkName(collName, chunkNumber, chunkDataBytes)
-		log.Debugf("Chunk %d: processing collection %s", chunkNumber, collName)
-
-		// Write the chunk name to the chunk
-		nameHeader := []byte{byte(len(chunkName))}
-		nameHeader = append(nameHeader, []byte(chunkName)...)
-		if _, err := w.Write(nameHeader); err != nil {
-			return fmt.Errorf("failed to write chunk header for collection %s: %w", collName, err)
-		}
-
-		// Write the ciphers for each permutations to the chunk
-		for _, perm := range p.Permutations[collLetter] {
-			collIndex, err := permutationIndex(perm, collLetter)
-			if err != nil {
-				return fmt.Errorf("failed to find permutation index in %s for collection %s: %w", perm, collLetter, err)
-			}
-			// Write the cipher data for this collection
-			cipher := p.Ciphers[perm][collIndex]
-			if _, err := w.Write(cipher); err != nil {
-				return fmt.Errorf("failed to write chunk data for collection %s: %w", collName, err)
+	errs := make([]error, len(p.Collections))
+	if p.WriteThreads <= 1 {
+		for i, collName := range p.Collections {
+			if errs[i] = p.writeCollectionChunk(ctx, writers[i], chunk.pieces, collName, chunkNumber, chunkDataBytes); errs[i] != nil {
+				break
 			}
-			log.Debugf("Chunk %d: wrote %d byte permutation %s for collection %s", chunkNumber, len(cipher), perm, collLetter)
 		}
-
-		// Close the chunk writer
-		w.Close()
+	} else {
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, p.WriteThreads)
+		for i, collName := range p.Collections {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				errs[i] = p.writeCollectionChunk(ctx, writers[i], chunk.pieces, collName, chunkNumber, chunkDataBytes)
+			}()
+		}
+		wg.Wait()
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
 
 	log.Infof("chunk %d completed successfully", chunkNumber)
 	return nil
 }
 
+// writeCollectionChunk writes the chunk header and the collection's pieces, which for OTP are
+// its cipher for each of its permutations, to w, and closes it. A chunk that fails part way is
+// left unclosed, so that no incomplete chunk is written out.
+func (p *Pad) writeCollectionChunk(ctx context.Context, w io.WriteCloser, pieces map[string][][]byte, collName string, chunkNumber int, chunkDataBytes int) error {
+	log := trace.FromContext(ctx).WithPrefix("encode")
+
+	_, _, collLetter, err := extractFromCollectionLabel(collName)
+	if err != nil {
+		return fmt.Errorf("failed to extractFrom collection letter: %w", err)
+	}
+
+	// Generate the chunk name
+	chunkName := buildChunkName(p.Aliases.aliasOf(collName), chunkNumber, chunkDataBytes, p.sharing().Name())
+	log.Debugf("Chunk %d: processing collection %s", chunkNumber, collName)
+
+	// Write the chunk name to the chunk
+	nameHeader := []byte{byte(len(chunkName))}
+	nameHeader = append(nameHeader, []byte(chunkName)...)
+	if _, err := w.Write(nameHeader); err != nil {
+		return fmt.Errorf("failed to write chunk header for collection %s: %w", collName, err)
+	}
+
+	// Write the collection's pieces to the chunk
+	for i, piece := range pieces[collLetter] {
+		if _, err := w.Write(piece); err != nil {
+			return fmt.Errorf("failed to write chunk data for collection %s: %w", collName, err)
+		}
+		log.Debugf("Chunk %d: wrote %d byte piece %d for collection %s", chunkNumber, len(piece), i+1, collLetter)
+	}
+
+	// Close the chunk writer, which formats the chunk and writes it out
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to write chunk %d of collection %s: %w", chunkNumber, collName, err)
+	}
+	return nil
+}
+
 // Decode performs the one-time pad decoding process to reconstruct the original data.
 //
 // This method takes K or more collection readers and reconstructs the original data
@@ -585,15 +986,32 @@ func (p *Pad) encodeOneChunk(ctx context.Context, chunkData []byte, chunkNumber
 //     b. Decode the chunk data using the threshold scheme
 //     c. Write the decoded data to the output
 //
+// A collection whose chunk can't be read, is corrupt, or is missing because the collection
+// ended before the others is set aside for the rest of the decode, and recorded in
+// p.BadShares. The chunk is decoded from the other collections, which works as long as K of
+// them are left, so that with more than K collections one bad chunk doesn't stop the decode.
+//
 // Security considerations:
 //   - Attempting to decode with fewer than K collections will fail completely
 //   - The collection readers must provide data from the same encoding operation
 //   - Chunk numbers and collection names are verified for consistency
 //   - The decoding process is deterministic and will produce the exact original data
 func (p *Pad) Decode(ctx context.Context, collections []io.Reader, output io.Writer) error {
+	return p.DecodeFrom(ctx, 1, collections, output)
+}
+
+// DecodeFrom is Decode starting from chunk firstChunk rather than 1, with each collection
+// reader starting at that chunk. It decodes the data from the start of that chunk for as
+// many chunks as the readers provide, which lets a decode that only needs part of the data
+// skip the chunks that don't hold it.
+func (p *Pad) DecodeFrom(ctx context.Context, firstChunk int, collections []io.Reader, output io.Writer) error {
 	log := trace.FromContext(ctx).WithPrefix("decode")
 
-	log.Debugf("Starting decode with %d collections", len(collections))
+	if firstChunk < 1 {
+		return fmt.Errorf("invalid first chunk number %d", firstChunk)
+	}
+	log.Debugf("Starting decode with %d collections from chunk %d", len(collections), firstChunk)
+	p.BadShares, p.LostChunk = nil, 0
 
 	// Create a structure to track collection state
 	type collectionState struct {
@@ -601,204 +1019,428 @@ func (p *Pad) Decode(ctx context.Context, collections []io.Reader, output io.Wri
 		nextChunkNumber  int
 		collectionName   string
 		collectionLetter string
-		done             bool
+		setAside         bool // A chunk of the collection was bad, so it is no longer read
 	}
 
 	states := make([]collectionState, len(collections))
 	for i, reader := range collections {
 		states[i] = collectionState{
 			reader:          reader,
-			nextChunkNumber: 1, // Start at chunk 1
+			nextChunkNumber: firstChunk,
 		}
 	}
 
 	// We need to reinitialize the pad when we get some real data
 	padReinitialized := false
 
+	// readChunk reads the next chunk of a collection, returning its data and the size of the
+	// input data it encodes. It returns io.EOF after the last chunk. An error wrapping
+	// ErrNewerFormat or ErrMixedSessions can't be decoded past; any other means this chunk of
+	// the collection is bad.
+	readChunk := func(i int) ([]byte, int, error) {
+		state := &states[i]
+
+		// Read the chunk name
+		lengthBuf := make([]byte, 1)
+		_, err := io.ReadFull(state.reader, lengthBuf)
+		if err == io.EOF {
+			// No more chunks in this collection
+			log.Debugf("Collection %d is done (EOF)", i)
+			return nil, 0, io.EOF
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read chunk name length: %w", err)
+		}
+
+		nameLength := int(lengthBuf[0])
+		nameBuf := make([]byte, nameLength)
+		_, err = io.ReadFull(state.reader, nameBuf)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read chunk name length %d: %w", nameLength, err)
+		}
+
+		chunkName := string(nameBuf)
+		log.Debugf("Collection %d: Chunk name: %s", i, chunkName)
+
+		// Parse the collection name and chunk number from the chunk name
+		collName, chunkNum, chunkDataBytes, sharing, err := extractFromChunkName(chunkName)
+		if errors.Is(err, ErrNewerFormat) {
+			return nil, 0, fmt.Errorf("chunk %s: %w", chunkName, err)
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid chunk name format (missing hyphen): %s: %w", chunkName, ErrCorruptChunk)
+		}
+		collName, requiredCopies, totalCopies, collLetter, err := p.Aliases.parseHeaderName(collName)
+		if err != nil {
+			return nil, 0, fmt.Errorf("chunk %s: %w", chunkName, err)
+		}
+
+		// Initialize the pad if we haven't done so
+		if !padReinitialized {
+			p.Sharing = sharing
+			err = PadInit(ctx, p, totalCopies, requiredCopies)
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid chunk name format (missing hyphen): %s: %w", chunkName, ErrCorruptChunk)
+			}
+			padReinitialized = true
+			log.Debugf("Pad initialized with totalCopies:%d requiredCopies:%d sharing:%s", p.TotalCopies, p.RequiredCopies, SharingName(sharing))
+		}
+
+		// If this is the first chunk, initialize the collection name
+		if state.collectionName == "" {
+			state.collectionName = collName
+			state.collectionLetter = collLetter
+			log.Debugf("Collection %d: Initialized collection name: %s", i, collName)
+		} else if state.collectionName != collName {
+			return nil, 0, fmt.Errorf("collection name mismatch: expected %s, got %s: %w",
+				state.collectionName, collName, ErrCorruptChunk)
+		}
+
+		// Verify the copies
+		if requiredCopies != p.RequiredCopies {
+			return nil, 0, fmt.Errorf("required copies mismatch: expected %d, got %d: %w",
+				p.RequiredCopies, requiredCopies, ErrMixedSessions)
+		}
+		if totalCopies != p.TotalCopies {
+			return nil, 0, fmt.Errorf("total copies mismatch: expected %d, got %d: %w",
+				p.TotalCopies, totalCopies, ErrMixedSessions)
+		}
+		if sharing != p.sharing() {
+			return nil, 0, fmt.Errorf("secret sharing scheme mismatch: expected %s, got %s: %w",
+				SharingName(p.sharing()), SharingName(sharing), ErrMixedSessions)
+		}
+
+		// Verify the chunk number
+		if chunkNum != state.nextChunkNumber {
+			log.Debugf("Collection %d: Chunk number mismatch: expected %d, got %d",
+				i, state.nextChunkNumber, chunkNum)
+			return nil, 0, fmt.Errorf("chunk number mismatch: expected %d, got %d: %w",
+				state.nextChunkNumber, chunkNum, ErrCorruptChunk)
+		}
+		state.nextChunkNumber++
+
+		// Compute the chunk length
+		readLength := chunkDataBytes * int(p.sharing().Pieces(p.TotalCopies, p.RequiredCopies))
+
+		// Read the chunk data
+		log.Debugf("Collection %d: Reading %d bytes of chunk data for %d byte chunk", i, readLength, chunkDataBytes)
+		chunk := make([]byte, readLength)
+		n, err := io.ReadFull(state.reader, chunk)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read chunk data: %w", err)
+		}
+		if n != readLength {
+			return nil, 0, fmt.Errorf("failed to read %d bytes of chunk data got:%d: %w", readLength, n, err)
+		}
+		log.Debugf("Collection %d: Read %d bytes of chunk data", i, len(chunk))
+		return chunk, chunkDataBytes, nil
+	}
+
+	// setAside stops reading a collection whose chunk was bad, so that the rest of the data is
+	// decoded from the others
+	setAside := func(i, chunkIndex int, err error) {
+		name := states[i].collectionName
+		if name == "" {
+			name = fmt.Sprintf("share %d", i+1)
+		}
+		states[i].setAside = true
+		p.BadShares = append(p.BadShares, BadShare{Collection: name, Share: i, Chunk: chunkIndex, Err: err})
+		log.Error(fmt.Errorf("collection %s: chunk %d is bad, decoding without it: %w", name, chunkIndex, err))
+	}
+
 	// Read chunks until we've processed all available chunks in all collections
-	var chunkDataBytes int
-	for chunkIndex := 1; ; chunkIndex++ {
+	for chunkIndex := firstChunk; ; chunkIndex++ {
+		// Stop if the operation was cancelled or its deadline passed
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		// For each collection, read the next chunk
 		chunks := make([][]byte, len(collections))
-
-		for i, state := range states {
-			state.done = false
-
-			// Read the chunk name
-			lengthBuf := make([]byte, 1)
-			_, err := io.ReadFull(state.reader, lengthBuf)
+		var ended []int
+		chunkDataBytes, reading := 0, 0
+		var badErr error
+		for i := range states {
+			if states[i].setAside {
+				continue
+			}
+			reading++
+			chunk, dataBytes, err := readChunk(i)
 			if err == io.EOF {
-				// No more chunks in this collection
-				log.Debugf("Collection %d is done (EOF)", i)
-				states[i].done = true
+				ended = append(ended, i)
 				continue
 			}
+			if errors.Is(err, ErrNewerFormat) || errors.Is(err, ErrMixedSessions) {
+				return err
+			}
 			if err != nil {
-				return fmt.Errorf("failed to read chunk name length: %w", err)
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return ctxErr
+				}
+				setAside(i, chunkIndex, err)
+				badErr = err
+				continue
 			}
+			chunks[i], chunkDataBytes = chunk, dataBytes
+		}
 
-			nameLength := int(lengthBuf[0])
-			nameBuf := make([]byte, nameLength)
-			_, err = io.ReadFull(state.reader, nameBuf)
-			if err != nil {
-				return fmt.Errorf("failed to read chunk name length %d: %w", nameLength, err)
+		// Every collection has the same number of chunks, so if some ended and others didn't,
+		// the ones that ended were cut short
+		if len(ended) == reading {
+			log.Debugf("All collections have been fully processed")
+			return nil
+		}
+		for _, i := range ended {
+			badErr = fmt.Errorf("collection ended after chunk %d, before the others: %w", chunkIndex-1, ErrCorruptChunk)
+			setAside(i, chunkIndex, badErr)
+		}
+
+		// Combine the chunks of the collections, by collection letter. With more than K good
+		// chunks, any K of them decode it.
+		chunksByLetter := make(map[string][]byte)
+		for i, state := range states {
+			if chunks[i] != nil {
+				chunksByLetter[state.collectionLetter] = chunks[i]
+			}
+		}
+		if len(chunksByLetter) == 0 && badErr != nil {
+			p.LostChunk = chunkIndex
+			return badErr
+		}
+		if len(chunksByLetter) < p.RequiredCopies {
+			if len(p.BadShares) > 0 {
+				p.LostChunk = chunkIndex
+				return fmt.Errorf("chunk %d: need %d of %d collections, but only %d good ones are left: %w",
+					chunkIndex, p.RequiredCopies, p.TotalCopies, len(chunksByLetter), p.BadShares[len(p.BadShares)-1].Err)
 			}
+			return fmt.Errorf("need %d of %d collections, found %d: %w", p.RequiredCopies, p.TotalCopies, len(chunksByLetter), ErrInsufficientCollections)
+		}
+		decodedChunk, err := p.sharing().Combine(p, chunksByLetter, chunkDataBytes)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
 
-			chunkName := string(nameBuf)
-			log.Debugf("Collection %d: Chunk name: %s", i, chunkName)
+		// Write the decoded data to the output
+		log.Debugf("chunk: %d bytes of decoded data written to output", len(decodedChunk))
+		_, err = output.Write(decodedChunk)
+		if err != nil {
+			return fmt.Errorf("failed to write decoded data: %w", err)
+		}
+	}
+}
+
+// Repair regenerates the chunks of a lost collection from the collections that survive, so
+// that a destroyed share can be replaced without decoding the data to disk.
+//
+// With OTP, each cipher the lost collection held is the XOR of the decoded chunk with the
+// ciphers the other collections hold for the same permutation, so the regenerated chunks are
+// identical to the lost ones. Because the lost collection shares a permutation with every
+// other collection, repair needs all N-1 surviving collections; for a K-of-(K+1) scheme such
+// as 2-of-3, that is just K. With Shamir, the lost share is interpolated from any K survivors.
+// Decoded data only ever exists in memory, one chunk at a time.
+//
+// Parameters:
+//   - ctx: Context for logging, cancellation, and tracing
+//   - collections: Readers for each of the surviving collections, in any order
+//   - lostCollection: Name of the collection to regenerate (e.g., "2C3"), or empty to
+//     regenerate the one collection that is not among the survivors
+//   - newChunk: Function to create output files for each regenerated chunk
+//   - chunkFormat: Format for output files (e.g., "bin" or "png")
+//
+// Returns:
+//   - The name of the regenerated collection
+//   - An error if the survivors are incomplete or inconsistent
+func (p *Pad) Repair(ctx context.Context, collections []io.Reader, lostCollection string, newChunk NewChunkFunc, chunkFormat string) (string, error) {
+	log := trace.FromContext(ctx).WithPrefix("repair")
 
-			// Parse the collection name and chunk number from the chunk name
-			var collName string
-			var chunkNum int
-			collName, chunkNum, chunkDataBytes, err = extractFromChunkName(chunkName)
+	// The pad is initialized from the first chunk header, as in Decode
+	padReinitialized := false
+	letters := make([]string, len(collections))
+	var lostLetter string
+	for chunkNumber := 1; ; chunkNumber++ {
+		// Stop if the operation was cancelled or its deadline passed
+		if err := ctx.Err(); err != nil {
+			return lostCollection, err
+		}
+
+		// Read the next chunk from every survivor
+		ciphers := make(map[string][]byte)
+		dataBytes := 0
+		ended := 0
+		for i, r := range collections {
+			header, data, err := readChunk(r, p.Aliases)
+			if err == io.EOF {
+				ended++
+				continue
+			}
 			if err != nil {
-				return fmt.Errorf("invalid chunk name format (missing hyphen): %s", chunkName)
+				return lostCollection, fmt.Errorf("collection %d, chunk %d: %w", i+1, chunkNumber, err)
 			}
-			requiredCopies, totalCopies, collLetter, err := extractFromCollectionLabel(collName)
+			_, _, letter, err := extractFromCollectionLabel(header.Collection)
 			if err != nil {
-				return fmt.Errorf("invalid chunk name format (missing hyphen): %s", chunkName)
+				return lostCollection, fmt.Errorf("collection %d, chunk %d: %w", i+1, chunkNumber, err)
 			}
 
-			// Initialize the pad if we haven't done so
 			if !padReinitialized {
 				padReinitialized = true
-				err = PadInit(ctx, p, totalCopies, requiredCopies)
-				if err != nil {
-					return fmt.Errorf("invalid chunk name format (missing hyphen): %s", chunkName)
+				p.Sharing = header.Sharing
+				if err := PadInit(ctx, p, header.TotalCopies, header.RequiredCopies); err != nil {
+					return lostCollection, err
 				}
-				log.Debugf("Pad initialized with totalCopies:%d requiredCopies:%d", p.TotalCopies, p.RequiredCopies)
 			}
-
-			// If this is the first chunk, initialize the collection name
-			if states[i].collectionName == "" {
-				states[i].collectionName = collName
-				states[i].collectionLetter = collLetter
-				log.Debugf("Collection %d: Initialized collection name: %s", i, collName)
-			} else if states[i].collectionName != collName {
-				return fmt.Errorf("collection name mismatch: expected %s, got %s",
-					states[i].collectionName, collName)
+			if header.RequiredCopies != p.RequiredCopies || header.TotalCopies != p.TotalCopies {
+				return lostCollection, fmt.Errorf("collection %s is %d of %d, but others are %d of %d: %w",
+					header.Collection, header.RequiredCopies, header.TotalCopies, p.RequiredCopies, p.TotalCopies, ErrMixedSessions)
 			}
-
-			// Verify the copies
-			if requiredCopies != p.RequiredCopies {
-				return fmt.Errorf("required copies mismatch: expected %d, got %d",
-					p.RequiredCopies, requiredCopies)
+			if header.Sharing != p.sharing() {
+				return lostCollection, fmt.Errorf("collection %s uses %s sharing, but others use %s: %w",
+					header.Collection, SharingName(header.Sharing), SharingName(p.sharing()), ErrMixedSessions)
 			}
-			if totalCopies != p.TotalCopies {
-				return fmt.Errorf("total copies mismatch: expected %d, got %d",
-					p.TotalCopies, totalCopies)
+			if letters[i] == "" {
+				letters[i] = letter
+			} else if letters[i] != letter {
+				return lostCollection, fmt.Errorf("collection name mismatch: expected %s, got %s: %w",
+					buildCollectionLabel(p.RequiredCopies, p.TotalCopies, letters[i]), header.Collection, ErrCorruptChunk)
 			}
-
-			// Verify the chunk number
-			if chunkNum != states[i].nextChunkNumber {
-				log.Debugf("Collection %d: Chunk number mismatch: expected %d, got %d",
-					i, states[i].nextChunkNumber, chunkNum)
-				return fmt.Errorf("chunk number mismatch: expected %d, got %d",
-					states[i].nextChunkNumber, chunkNum)
+			if _, duplicate := ciphers[letter]; duplicate {
+				return lostCollection, fmt.Errorf("collection %s was supplied more than once", header.Collection)
 			}
-			states[i].nextChunkNumber++
-
-			// Compute the chunk length
-			readLength := chunkDataBytes * p.PermutationCount
-
-			// Read the chunk data
-			log.Debugf("Collection %d: Reading %d bytes of chunk data for %d byte chunk", i, readLength, chunkDataBytes)
-			chunk := make([]byte, readLength)
-			n, err := io.ReadFull(state.reader, chunk)
-			if err != nil {
-				return fmt.Errorf("failed to read chunk data: %w", err)
+			if header.Number != chunkNumber {
+				return lostCollection, fmt.Errorf("chunk number mismatch in collection %s: expected %d, got %d: %w",
+					header.Collection, chunkNumber, header.Number, ErrCorruptChunk)
 			}
-			if n != readLength {
-				return fmt.Errorf("failed to read %d bytes of chunk data got:%d: %w", readLength, n, err)
+			if dataBytes != 0 && header.DataBytes != dataBytes {
+				return lostCollection, fmt.Errorf("chunk %d of collection %s encodes %d bytes, but others encode %d: %w",
+					chunkNumber, header.Collection, header.DataBytes, dataBytes, ErrMixedSessions)
 			}
-			chunks[i] = chunk
-			log.Debugf("Collection %d: Read %d bytes of chunk data", i, len(chunk))
+			dataBytes = header.DataBytes
+			ciphers[letter] = data
 		}
 
-		// Check if all collections have been fully processed
-		allDone := true
-		anyDone := false
-		for _, state := range states {
-			if state.done {
-				anyDone = true
+		if ended == len(collections) {
+			if chunkNumber == 1 {
+				return lostCollection, fmt.Errorf("no chunks found in the surviving collections")
 			}
-			if !state.done {
-				allDone = false
-				break
-			}
-		}
-		if allDone {
-			log.Debugf("All collections have been fully processed")
-			return nil
+			log.Infof("Regenerated %d chunks of collection %s", chunkNumber-1, lostCollection)
+			return lostCollection, nil
 		}
-		if anyDone {
-			log.Debugf("Some collections have been processed while others are fully processed")
-			return nil
+		if ended > 0 {
+			return lostCollection, fmt.Errorf("%d of %d collections ended before chunk %d - collections are incomplete",
+				ended, len(collections), chunkNumber)
 		}
 
-		// Loop through all the collections to find the first permutation that matches
-		chunkLetters := []string{}
-		for _, state := range states {
-			chunkLetters = append(chunkLetters, state.collectionLetter)
+		// Once the scheme is known, check that every survivor is present
+		if chunkNumber == 1 {
+			var err error
+			if lostLetter, err = p.lostCollectionLetter(ciphers, lostCollection); err != nil {
+				log.Error(err)
+				return lostCollection, err
+			}
+			lostCollection = buildCollectionLabel(p.RequiredCopies, p.TotalCopies, lostLetter)
+			log.Infof("Regenerating collection %s from %d surviving collections", lostCollection, len(collections))
 		}
-		if len(chunkLetters) < p.RequiredCopies {
-			return fmt.Errorf("not enough copies to decode: %d < %d", len(chunkLetters), p.RequiredCopies)
+
+		// Regenerate the lost collection's pieces in memory
+		pieces, err := p.sharing().Regenerate(p, ciphers, lostLetter, dataBytes)
+		if err != nil {
+			return lostCollection, err
 		}
-		sort.Strings(chunkLetters)
-		chunkLetters = chunkLetters[0:p.RequiredCopies]
-		permutation := strings.Join(chunkLetters, "")
-		log.Debugf("Permutation %s will be used for decode", permutation)
 
-		// Generate the final data
-		decodedChunk := make([]byte, chunkDataBytes)
-		for i := 0; i < len(chunkLetters); i++ {
-			// Find the permutations for this collectionLetter such as B: [ABC ABD ABE BCD BCE BDE]
-			perm, found := p.Permutations[chunkLetters[i]]
-			if !found {
-				return fmt.Errorf("failed to find permutation for collection %s", chunkLetters[i])
-			}
-			// Find the index of the desired permutation in that list
-			permIndex := -1
-			for j, p := range perm {
-				if p == permutation {
-					permIndex = j
-					break
-				}
-			}
-			if permIndex == -1 {
-				return fmt.Errorf("failed to find permutation index for collection %s", chunkLetters[i])
-			}
-			log.Debugf("Collection %s: XORing data from permutation %d for %s", chunkLetters[i], permIndex, permutation)
-
-			// Add defensive check to ensure chunks have expected size
-			permBase := permIndex * chunkDataBytes
-			if len(chunks[i]) < permBase+chunkDataBytes {
-				log.Error(fmt.Errorf("chunk data is truncated: expected at least %d bytes, but only have %d bytes",
-					permBase+chunkDataBytes, len(chunks[i])))
-				return fmt.Errorf("chunk data truncated in collection %s - possible corruption detected", chunkLetters[i])
+		// Write the lost collection's chunk, with the same header and piece order as Encode
+		w, err := newChunk(lostCollection, chunkNumber, chunkFormat)
+		if err != nil {
+			return lostCollection, fmt.Errorf("failed to create chunk writer for collection %s: %w", lostCollection, err)
+		}
+		chunkName := buildChunkName(lostCollection, chunkNumber, dataBytes, p.sharing().Name())
+		nameHeader := append([]byte{byte(len(chunkName))}, chunkName...)
+		if _, err := w.Write(nameHeader); err != nil {
+			w.Close()
+			return lostCollection, fmt.Errorf("failed to write chunk header for collection %s: %w", lostCollection, err)
+		}
+		for _, piece := range pieces {
+			if _, err := w.Write(piece); err != nil {
+				w.Close()
+				return lostCollection, fmt.Errorf("failed to write chunk data for collection %s: %w", lostCollection, err)
 			}
+		}
+		if err := w.Close(); err != nil {
+			return lostCollection, fmt.Errorf("failed to close chunk %d of collection %s: %w", chunkNumber, lostCollection, err)
+		}
+		log.Debugf("Chunk %d: regenerated %d pieces for collection %s", chunkNumber, len(pieces), lostCollection)
+	}
+}
 
-			// Debugging information to trace chunk XOR operations
-			log.Debugf("XORing chunk data: collection=%s, permBase=%d, chunkDataBytes=%d, chunkSize=%d",
-				chunkLetters[i], permBase, chunkDataBytes, len(chunks[i]))
+// lostCollectionLetter returns the letter of the collection to repair, given the letters of
+// the survivors, and checks that enough of the others survive for the secret sharing scheme
+func (p *Pad) lostCollectionLetter(survivors map[string][]byte, lostCollection string) (string, error) {
+	if p.RequiredCopies == p.TotalCopies {
+		return "", fmt.Errorf("a %d of %d collection can't be repaired, as every collection is needed to decode",
+			p.RequiredCopies, p.TotalCopies)
+	}
 
-			// Perform the XOR operation with boundary checks
-			for j := 0; j < chunkDataBytes; j++ {
-				if permBase+j >= len(chunks[i]) {
-					log.Error(fmt.Errorf("buffer overflow during XOR at index %d (max: %d)",
-						permBase+j, len(chunks[i])-1))
-					return fmt.Errorf("buffer overflow during XOR operation - corrupt or incomplete collection")
-				}
-				decodedChunk[j] = decodedChunk[j] ^ chunks[i][permBase+j]
-			}
+	var missing []string
+	for i := 0; i < p.TotalCopies; i++ {
+		if letter := collectionLetterFromIndex(i); survivors[letter] == nil {
+			missing = append(missing, buildCollectionLabel(p.RequiredCopies, p.TotalCopies, letter))
 		}
+	}
 
-		// Write the decoded data to the output
-		log.Debugf("chunk: %d bytes of decoded data written to output", len(decodedChunk))
-		_, err := output.Write(decodedChunk)
-		if err != nil {
-			return fmt.Errorf("failed to write decoded data: %w", err)
+	if lostCollection == "" {
+		if len(missing) != 1 && p.sharing() != OTP {
+			return "", fmt.Errorf("%d collections are missing (%s), so the one to regenerate must be named",
+				len(missing), strings.Join(missing, ", "))
 		}
+		if len(missing) != 1 {
+			return "", fmt.Errorf("repair needs all but one of the %d collections, but %d are missing (%s): %w",
+				p.TotalCopies, len(missing), strings.Join(missing, ", "), ErrInsufficientCollections)
+		}
+		lostCollection = missing[0]
+	}
+	requiredCopies, totalCopies, lostLetter, err := extractFromCollectionLabel(lostCollection)
+	if err != nil {
+		return "", fmt.Errorf("invalid collection name %q: %w", lostCollection, err)
+	}
+	if requiredCopies != p.RequiredCopies || totalCopies != p.TotalCopies {
+		return "", fmt.Errorf("collection %s is not part of this %d of %d distribution", lostCollection, p.RequiredCopies, p.TotalCopies)
+	}
+	if survivors[lostLetter] != nil {
+		return "", fmt.Errorf("collection %s is among the surviving collections", lostCollection)
+	}
+	if needed := p.sharing().RepairCopies(p.TotalCopies, p.RequiredCopies); len(survivors) < needed {
+		if p.sharing() == OTP {
+			return "", fmt.Errorf("repairing %s needs every other collection, because each shares a permutation with it, but %d are missing (%s): %w",
+				lostCollection, len(missing)-1, strings.Join(missing, ", "), ErrInsufficientCollections)
+		}
+		return "", fmt.Errorf("repairing %s needs %d surviving collections, but only %d were supplied: %w",
+			lostCollection, needed, len(survivors), ErrInsufficientCollections)
+	}
+	return lostLetter, nil
+}
 
+// readChunk reads the next whole chunk from a collection stream, returning its header, read
+// through aliases, and the cipher data that follows it, or io.EOF if the stream ended cleanly
+// between chunks
+func readChunk(r io.Reader, aliases Aliases) (ChunkHeader, []byte, error) {
+	lengthBuf := make([]byte, 1)
+	if _, err := io.ReadFull(r, lengthBuf); err != nil {
+		if err == io.EOF {
+			return ChunkHeader{}, nil, io.EOF
+		}
+		return ChunkHeader{}, nil, fmt.Errorf("failed to read chunk name length: %w", err)
+	}
+	header := make([]byte, 1+int(lengthBuf[0]))
+	header[0] = lengthBuf[0]
+	if _, err := io.ReadFull(r, header[1:]); err != nil {
+		return ChunkHeader{}, nil, fmt.Errorf("failed to read chunk name: %w", err)
+	}
+	h, err := ParseChunkHeaderWith(header, aliases)
+	if err != nil {
+		return ChunkHeader{}, nil, err
+	}
+	data := make([]byte, h.ChunkBytes()-int64(h.HeaderBytes))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return ChunkHeader{}, nil, fmt.Errorf("failed to read chunk data: %w", err)
 	}
+	return h, data, nil
 }
@@ -5,11 +5,17 @@ package pad
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/blues/padlock/pkg/trace"
 )
@@ -175,6 +181,201 @@ func TestPadStreamEncodeDecode(t *testing.T) {
 	}
 }
 
+// TestPadDecodeCollectionOrder verifies that decoding doesn't depend on the order
+// in which the collections are supplied
+func TestPadDecodeCollectionOrder(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	input := make([]byte, 300)
+	for i := range input {
+		input[i] = byte((i * 7) % 256)
+	}
+
+	pad, err := NewPadForEncode(ctx, 4, 2)
+	if err != nil {
+		t.Fatalf("Failed to create pad: %v", err)
+	}
+	buffers := make(map[string]*bytes.Buffer)
+	for _, collName := range pad.Collections {
+		buffers[collName] = new(bytes.Buffer)
+	}
+	newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		return &nopCloser{buffers[collectionName]}, nil
+	}
+	if err := pad.Encode(ctx, 128, bytes.NewReader(input), NewTestRNG(0), newChunkFunc, "bin"); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	for _, order := range [][]string{{"2B4", "2D4"}, {"2D4", "2B4"}, {"2C4", "2A4", "2D4"}} {
+		var readers []io.Reader
+		for _, collName := range order {
+			readers = append(readers, bytes.NewReader(buffers[collName].Bytes()))
+		}
+		decoder, err := NewPadForDecode(ctx, len(readers))
+		if err != nil {
+			t.Fatalf("Failed to create decode pad: %v", err)
+		}
+		output := new(bytes.Buffer)
+		if err := decoder.Decode(ctx, readers, output); err != nil {
+			t.Fatalf("Failed to decode %v: %v", order, err)
+		}
+		if !bytes.Equal(output.Bytes(), input) {
+			t.Errorf("Decoding collections in order %v did not reproduce the input", order)
+		}
+	}
+}
+
+// TestPadEncodeWriteThreads verifies that collections written concurrently decode, and that a
+// failed chunk write is returned
+func TestPadEncodeWriteThreads(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	input := make([]byte, 5000)
+	for i := range input {
+		input[i] = byte((i * 11) % 256)
+	}
+	encode := func(threads int, failCollection string) (map[string][]byte, error) {
+		p, err := NewPadForEncode(ctx, 5, 3)
+		if err != nil {
+			t.Fatalf("Failed to create pad: %v", err)
+		}
+		p.WriteThreads = threads
+		var mu sync.Mutex
+		buffers := make(map[string]*bytes.Buffer)
+		for _, collName := range p.Collections {
+			buffers[collName] = new(bytes.Buffer)
+		}
+		newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+			return &lockedChunk{mu: &mu, buf: buffers[collectionName], fail: collectionName == failCollection}, nil
+		}
+		err = p.Encode(ctx, 600, bytes.NewReader(input), NewTestRNG(0), newChunkFunc, "bin")
+		collections := make(map[string][]byte)
+		for name, buf := range buffers {
+			collections[name] = buf.Bytes()
+		}
+		return collections, err
+	}
+
+	collections, err := encode(4, "")
+	if err != nil {
+		t.Fatalf("Concurrent encode failed: %v", err)
+	}
+	readers := []io.Reader{
+		bytes.NewReader(collections["3A5"]),
+		bytes.NewReader(collections["3C5"]),
+		bytes.NewReader(collections["3E5"]),
+	}
+	output := new(bytes.Buffer)
+	if err := (&Pad{}).Decode(ctx, readers, output); err != nil {
+		t.Fatalf("Failed to decode collections written concurrently: %v", err)
+	}
+	if !bytes.Equal(output.Bytes(), input) {
+		t.Errorf("Collections written concurrently did not reproduce the input")
+	}
+
+	if _, err := encode(4, "3C5"); err == nil || !strings.Contains(err.Error(), "3C5") {
+		t.Errorf("Expected the failed write to collection 3C5 to be returned, got %v", err)
+	}
+}
+
+// lockedChunk is a chunk writer that appends to a shared buffer on Close, and can be made to fail
+type lockedChunk struct {
+	bytes.Buffer
+	mu   *sync.Mutex
+	buf  *bytes.Buffer
+	fail bool
+}
+
+func (c *lockedChunk) Close() error {
+	if c.fail {
+		return errors.New("disk full")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf.Write(c.Bytes())
+	return nil
+}
+
+// TestPadEncodePipeline verifies that an error in any stage of the encode pipeline is
+// returned, and that the other stages have stopped by the time Encode returns
+func TestPadEncodePipeline(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	input := bytes.Repeat([]byte("pipelined encode "), 200)
+	encode := func(input io.Reader, rng RNG, failChunk int) (int, error) {
+		p, err := NewPadForEncode(ctx, 3, 2)
+		if err != nil {
+			t.Fatalf("Failed to create pad: %v", err)
+		}
+		written := 0
+		newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+			if chunkNumber == failChunk {
+				return nil, errors.New("disk full")
+			}
+			if collectionName == p.Collections[0] {
+				written++
+			}
+			return &nopCloser{new(bytes.Buffer)}, nil
+		}
+		err = p.Encode(ctx, 200, input, rng, newChunkFunc, "bin")
+		return written, err
+	}
+
+	// A failed write stops the reader and generator before Encode returns
+	reader := &countedReader{r: bytes.NewReader(input)}
+	rng := &countedRNG{RNG: NewTestRNG(0)}
+	if _, err := encode(reader, rng, 3); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Expected the failed write to be returned, got %v", err)
+	}
+	reads, rngReads := reader.reads.Load(), rng.reads.Load()
+	if reads == 0 || rngReads == 0 {
+		t.Fatalf("Expected input and RNG to have been read")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if reader.reads.Load() != reads || rng.reads.Load() != rngReads {
+		t.Errorf("Input or RNG was read after Encode returned")
+	}
+
+	// RNG and input errors reach the caller from their stages, after the chunks before them
+	failing := &countedRNG{RNG: NewTestRNG(0), failAt: 5}
+	if _, err := encode(bytes.NewReader(input), failing, 0); err == nil || !strings.Contains(err.Error(), "random generator error") {
+		t.Errorf("Expected the RNG error to be returned, got %v", err)
+	}
+	broken := io.MultiReader(bytes.NewReader(input[:1000]), iotest.ErrReader(errors.New("device gone")))
+	written, err := encode(broken, NewTestRNG(0), 0)
+	if err == nil || !strings.Contains(err.Error(), "device gone") {
+		t.Errorf("Expected the input error to be returned, got %v", err)
+	}
+	if written != 10 {
+		t.Errorf("Expected the 10 chunks read before the input error to be written, got %d", written)
+	}
+}
+
+// countedReader counts reads of the reader it wraps
+type countedReader struct {
+	r     io.Reader
+	reads atomic.Int64
+}
+
+func (c *countedReader) Read(p []byte) (int, error) {
+	c.reads.Add(1)
+	return c.r.Read(p)
+}
+
+// countedRNG counts reads of the RNG it wraps, and fails read failAt if it is nonzero
+type countedRNG struct {
+	RNG
+	reads  atomic.Int64
+	failAt int64
+}
+
+func (c *countedRNG) Read(ctx context.Context, p []byte) error {
+	if c.reads.Add(1) == c.failAt {
+		return errors.New("entropy exhausted")
+	}
+	return c.RNG.Read(ctx, p)
+}
+
 // nopCloser wraps a Buffer with a no-op Close method
 type nopCloser struct {
 	*bytes.Buffer
@@ -451,3 +652,462 @@ func (r *TestRNG) Read(ctx context.Context, p []byte) (err error) {
 	}
 	return nil
 }
+
+// countingWriteCloser counts bytes written to a collection
+type countingWriteCloser struct {
+	sizes map[string]int64
+	coll  string
+}
+
+func (c *countingWriteCloser) Write(p []byte) (int, error) {
+	c.sizes[c.coll] += int64(len(p))
+	return len(p), nil
+}
+
+func (c *countingWriteCloser) Close() error { return nil }
+
+// TestEncodedCollectionSize verifies that the computed collection size matches what Encode writes
+func TestEncodedCollectionSize(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	for _, tc := range []struct {
+		n, k, chunk int
+		input       int64
+	}{
+		{3, 2, 128, 0},
+		{3, 2, 128, 1},
+		{3, 2, 128, 42},
+		{3, 2, 128, 4200},
+		{5, 3, 100, 1234},
+		{7, 4, 350, 12345},
+		{2, 2, 64, 64 * 11},
+	} {
+		p, err := NewPadForEncode(ctx, tc.n, tc.k)
+		if err != nil {
+			t.Fatalf("Failed to create pad: %v", err)
+		}
+
+		sizes := make(map[string]int64)
+		newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+			return &countingWriteCloser{sizes: sizes, coll: collectionName}, nil
+		}
+		if err := p.Encode(ctx, tc.chunk, bytes.NewReader(make([]byte, tc.input)), NewTestRNG(0), newChunkFunc, "bin"); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+
+		want, err := EncodedCollectionSize(tc.n, tc.k, tc.chunk, tc.input)
+		if err != nil {
+			t.Fatalf("EncodedCollectionSize failed: %v", err)
+		}
+		for _, coll := range p.Collections {
+			if sizes[coll] != want {
+				t.Errorf("%d of %d, chunk %d, input %d: collection %s has %d bytes, computed %d",
+					tc.k, tc.n, tc.chunk, tc.input, coll, sizes[coll], want)
+			}
+		}
+	}
+
+	if _, err := EncodedCollectionSize(10, 5, 100, 100); err == nil {
+		t.Errorf("Expected an error for a chunk size smaller than the number of permutations")
+	}
+	if _, err := EncodedCollectionSize(3, 4, 1024, 100); err == nil {
+		t.Errorf("Expected an error for K greater than N")
+	}
+}
+
+// chunkCapture collects every chunk written by Encode, by collection
+type chunkCapture struct {
+	bytes.Buffer
+	chunks map[string][][]byte
+	coll   string
+}
+
+func (c *chunkCapture) Close() error {
+	c.chunks[c.coll] = append(c.chunks[c.coll], c.Bytes())
+	return nil
+}
+
+// TestParseChunkHeader verifies that the header of every encoded chunk describes the chunk
+func TestParseChunkHeader(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	p, err := NewPadForEncode(ctx, 5, 3)
+	if err != nil {
+		t.Fatalf("Failed to create pad: %v", err)
+	}
+	chunks := make(map[string][][]byte)
+	newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		return &chunkCapture{chunks: chunks, coll: collectionName}, nil
+	}
+	if err := p.Encode(ctx, 120, bytes.NewReader(make([]byte, 1000)), NewTestRNG(0), newChunkFunc, "bin"); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	for coll, collChunks := range chunks {
+		for i, chunk := range collChunks {
+			h, err := ParseChunkHeader(chunk)
+			if err != nil {
+				t.Fatalf("Collection %s chunk %d: %v", coll, i+1, err)
+			}
+			if h.Collection != coll || h.RequiredCopies != 3 || h.TotalCopies != 5 || h.Number != i+1 {
+				t.Errorf("Collection %s chunk %d: unexpected header %+v", coll, i+1, h)
+			}
+			if h.ChunkBytes() != int64(len(chunk)) {
+				t.Errorf("Collection %s chunk %d: header describes %d bytes, chunk has %d", coll, i+1, h.ChunkBytes(), len(chunk))
+			}
+		}
+	}
+
+	for _, bad := range [][]byte{nil, {5, '3'}, append([]byte{9}, "3A5:x:100"...), append([]byte{9}, "9A5:1:100"...)} {
+		if _, err := ParseChunkHeader(bad); err == nil {
+			t.Errorf("Expected an error parsing header %q", bad)
+		}
+	}
+}
+
+// TestChunkFormatVersion verifies that chunk headers may name their format version, and that
+// a version newer than this package reads is refused as such rather than as corruption
+func TestChunkFormatVersion(t *testing.T) {
+	header := func(name string) []byte {
+		return append([]byte{byte(len(name))}, name...)
+	}
+	for _, name := range []string{"3A5:1:100", "3A5:1:100:v1", "3A5:1:100:shamir:v1"} {
+		h, err := ParseChunkHeader(header(name))
+		if err != nil || h.Version != 1 || h.DataBytes != 100 {
+			t.Errorf("%s: unexpected header %+v, %v", name, h, err)
+		}
+	}
+	for _, name := range []string{"3A5:1:100:v2", "3A5:1:100:shamir:v9"} {
+		_, err := ParseChunkHeader(header(name))
+		if !errors.Is(err, ErrNewerFormat) || errors.Is(err, ErrCorruptChunk) {
+			t.Errorf("%s: expected ErrNewerFormat, got %v", name, err)
+		}
+	}
+	if _, err := ParseChunkHeader(header("3A5:1:100:v0")); !errors.Is(err, ErrCorruptChunk) {
+		t.Errorf("Expected an invalid version to be a corrupt chunk, got %v", err)
+	}
+}
+
+// TestChunkAliases verifies that chunks written with aliases name their collections by them,
+// and that they decode only once the aliases are resolved
+func TestChunkAliases(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	p, err := NewPadForEncode(ctx, 3, 2)
+	if err != nil {
+		t.Fatalf("Failed to create pad: %v", err)
+	}
+	p.Aliases = Aliases{"share-0000000a": "2A3", "share-0000000b": "2B3", "share-0000000c": "2C3"}
+	chunks := make(map[string][][]byte)
+	newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		return &chunkCapture{chunks: chunks, coll: collectionName}, nil
+	}
+	input := bytes.Repeat([]byte("alias"), 100)
+	if err := p.Encode(ctx, 120, bytes.NewReader(input), NewTestRNG(0), newChunkFunc, "bin"); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	for alias, coll := range p.Aliases {
+		chunk := chunks[coll][0]
+		if name := string(chunk[1 : 1+int(chunk[0])]); !strings.HasPrefix(name, alias+":") {
+			t.Errorf("Collection %s: expected its chunk to be named by %s, got %q", coll, alias, name)
+		}
+		if _, err := ParseChunkHeader(chunk); !errors.Is(err, ErrUnresolvedAlias) {
+			t.Errorf("Collection %s: expected an unresolved alias without the aliases, got %v", coll, err)
+		}
+		if h, err := ParseChunkHeaderWith(chunk, p.Aliases); err != nil || h.Collection != coll || h.RequiredCopies != 2 || h.TotalCopies != 3 {
+			t.Errorf("Collection %s: unexpected header %+v, %v", coll, h, err)
+		}
+	}
+
+	readers := func() []io.Reader {
+		var r []io.Reader
+		for _, coll := range []string{"2C3", "2A3"} {
+			r = append(r, bytes.NewReader(bytes.Join(chunks[coll], nil)))
+		}
+		return r
+	}
+	decoder, err := NewPadForDecode(ctx, 2)
+	if err != nil {
+		t.Fatalf("Failed to create pad: %v", err)
+	}
+	if err := decoder.Decode(ctx, readers(), io.Discard); !errors.Is(err, ErrUnresolvedAlias) {
+		t.Errorf("Expected decoding without the aliases to fail with ErrUnresolvedAlias, got %v", err)
+	}
+	decoder, err = NewPadForDecode(ctx, 2)
+	if err != nil {
+		t.Fatalf("Failed to create pad: %v", err)
+	}
+	decoder.Aliases = p.Aliases
+	var output bytes.Buffer
+	if err := decoder.Decode(ctx, readers(), &output); err != nil || !bytes.Equal(output.Bytes(), input) {
+		t.Errorf("Expected decoding with the aliases to restore the input (%v)", err)
+	}
+}
+
+// TestPadRepair verifies that a lost collection is regenerated byte for byte from the others
+func TestPadRepair(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	for _, scheme := range []struct{ n, k int }{{3, 2}, {5, 3}, {4, 4}} {
+		p, err := NewPadForEncode(ctx, scheme.n, scheme.k)
+		if err != nil {
+			t.Fatalf("Failed to create pad: %v", err)
+		}
+		buffers := make(map[string]*bytes.Buffer)
+		for _, collName := range p.Collections {
+			buffers[collName] = new(bytes.Buffer)
+		}
+		newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+			return &nopCloser{buffers[collectionName]}, nil
+		}
+		if err := p.Encode(ctx, 100, bytes.NewReader(make([]byte, 777)), NewTestRNG(0), newChunkFunc, "bin"); err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+
+		lost := p.Collections[1]
+		var readers []io.Reader
+		for _, collName := range p.Collections {
+			if collName != lost {
+				readers = append([]io.Reader{bytes.NewReader(buffers[collName].Bytes())}, readers...)
+			}
+		}
+		repaired := new(bytes.Buffer)
+		repairChunk := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+			if collectionName != lost {
+				t.Errorf("Repair wrote to collection %s, expected %s", collectionName, lost)
+			}
+			return &nopCloser{repaired}, nil
+		}
+		decoder, err := NewPadForDecode(ctx, len(readers))
+		if err != nil {
+			t.Fatalf("Failed to create repair pad: %v", err)
+		}
+		name, err := decoder.Repair(ctx, readers, "", repairChunk, "bin")
+		if scheme.k == scheme.n {
+			if err == nil {
+				t.Errorf("Expected an error repairing a %d of %d collection", scheme.k, scheme.n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Failed to repair %s: %v", lost, err)
+		}
+		if name != lost || !bytes.Equal(repaired.Bytes(), buffers[lost].Bytes()) {
+			t.Errorf("Repaired collection %s does not match the lost collection %s", name, lost)
+		}
+	}
+
+	// Repair refuses to run without every survivor
+	p, err := NewPadForEncode(ctx, 4, 2)
+	if err != nil {
+		t.Fatalf("Failed to create pad: %v", err)
+	}
+	buffers := make(map[string]*bytes.Buffer)
+	for _, collName := range p.Collections {
+		buffers[collName] = new(bytes.Buffer)
+	}
+	newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		return &nopCloser{buffers[collectionName]}, nil
+	}
+	if err := p.Encode(ctx, 100, bytes.NewReader(make([]byte, 300)), NewTestRNG(0), newChunkFunc, "bin"); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	readers := []io.Reader{bytes.NewReader(buffers["2A4"].Bytes()), bytes.NewReader(buffers["2B4"].Bytes())}
+	discard := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		return &nopCloser{new(bytes.Buffer)}, nil
+	}
+	if _, err := (&Pad{}).Repair(ctx, readers, "2D4", discard, "bin"); err == nil || !strings.Contains(err.Error(), "2C4") {
+		t.Errorf("Expected an error naming the other missing collection, got %v", err)
+	} else if !errors.Is(err, ErrInsufficientCollections) {
+		t.Errorf("Expected ErrInsufficientCollections, got %v", err)
+	}
+}
+
+// TestPadDecodeErrors verifies that decode failures can be told apart with errors.Is
+func TestPadDecodeErrors(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	encode := func(n, k int) map[string][]byte {
+		p, err := NewPadForEncode(ctx, n, k)
+		if err != nil {
+			t.Fatalf("Failed to create pad: %v", err)
+		}
+		buffers := make(map[string]*bytes.Buffer)
+		for _, collName := range p.Collections {
+			buffers[collName] = new(bytes.Buffer)
+		}
+		newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+			return &nopCloser{buffers[collectionName]}, nil
+		}
+		if err := p.Encode(ctx, 100, bytes.NewReader(make([]byte, 300)), NewTestRNG(0), newChunkFunc, "bin"); err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		collections := make(map[string][]byte)
+		for name, buf := range buffers {
+			collections[name] = buf.Bytes()
+		}
+		return collections
+	}
+	decode := func(collections ...[]byte) error {
+		readers := make([]io.Reader, len(collections))
+		for i, c := range collections {
+			readers[i] = bytes.NewReader(c)
+		}
+		return (&Pad{}).Decode(ctx, readers, io.Discard)
+	}
+	twoOfThree := encode(3, 2)
+	twoOfFour := encode(4, 2)
+
+	if err := decode(twoOfThree["2A3"]); !errors.Is(err, ErrInsufficientCollections) {
+		t.Errorf("Expected ErrInsufficientCollections decoding one collection, got %v", err)
+	}
+	threeOfFour := encode(4, 3)
+	if err := decode(threeOfFour["3A4"], threeOfFour["3C4"]); !errors.Is(err, ErrInsufficientCollections) || !strings.Contains(err.Error(), "need 3 of 4 collections, found 2") {
+		t.Errorf("Expected ErrInsufficientCollections naming K decoding two of 3 collections, got %v", err)
+	}
+	if k, n, letter, err := ParseCollectionName("3C4"); err != nil || k != 3 || n != 4 || letter != "C" {
+		t.Errorf("Unexpected parse of 3C4: %d of %d, %q, %v", k, n, letter, err)
+	}
+	if err := decode(twoOfThree["2A3"], twoOfFour["2B4"]); !errors.Is(err, ErrMixedSessions) {
+		t.Errorf("Expected ErrMixedSessions decoding collections of different encodes, got %v", err)
+	}
+	corrupt := append([]byte(nil), twoOfThree["2B3"]...)
+	corrupt[1] = '#'
+	if err := decode(twoOfThree["2A3"], corrupt); !errors.Is(err, ErrCorruptChunk) {
+		t.Errorf("Expected ErrCorruptChunk decoding a damaged chunk header, got %v", err)
+	}
+	if _, err := NewPadForEncode(ctx, 3, 4); !errors.Is(err, ErrInvalidScheme) {
+		t.Errorf("Expected ErrInvalidScheme for 4 of 3, got %v", err)
+	}
+}
+
+// TestPadDecodeBadShares verifies that with more than K collections, a collection with a bad
+// chunk is set aside and the data decoded from the others
+func TestPadDecodeBadShares(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	p, err := NewPadForEncode(ctx, 3, 2)
+	if err != nil {
+		t.Fatalf("Failed to create pad: %v", err)
+	}
+	chunks := make(map[string][]*bytes.Buffer)
+	newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		buf := new(bytes.Buffer)
+		chunks[collectionName] = append(chunks[collectionName], buf)
+		return &nopCloser{buf}, nil
+	}
+	input := make([]byte, 500)
+	NewTestRNG(7).Read(ctx, input)
+	if err := p.Encode(ctx, 100, bytes.NewReader(input), NewTestRNG(0), newChunkFunc, "bin"); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	stream := func(name string, change func(chunks [][]byte) [][]byte) io.Reader {
+		var all [][]byte
+		for _, buf := range chunks[name] {
+			all = append(all, bytes.Clone(buf.Bytes()))
+		}
+		if change != nil {
+			all = change(all)
+		}
+		return bytes.NewReader(bytes.Join(all, nil))
+	}
+	badHeader := func(all [][]byte) [][]byte {
+		all[1][1] = '#'
+		return all
+	}
+	truncated := func(all [][]byte) [][]byte {
+		return all[:len(all)-1]
+	}
+	decode := func(collections ...io.Reader) (*Pad, []byte, error) {
+		var out bytes.Buffer
+		p := &Pad{}
+		err := p.Decode(ctx, collections, &out)
+		return p, out.Bytes(), err
+	}
+
+	// A bad header in 2A3 and a missing last chunk in 2B3 each leave two good collections
+	for _, tc := range []struct {
+		name   string
+		shares []io.Reader
+		bad    BadShare
+	}{
+		{"bad header", []io.Reader{stream("2A3", badHeader), stream("2B3", nil), stream("2C3", nil)}, BadShare{Collection: "2A3", Chunk: 2}},
+		{"truncated", []io.Reader{stream("2A3", nil), stream("2B3", truncated), stream("2C3", nil)}, BadShare{Collection: "2B3", Chunk: len(chunks["2B3"])}},
+	} {
+		p, out, err := decode(tc.shares...)
+		if err != nil || !bytes.Equal(out, input) {
+			t.Errorf("%s: decoding around the bad chunk failed: %v", tc.name, err)
+			continue
+		}
+		if len(p.BadShares) != 1 || p.BadShares[0].Collection != tc.bad.Collection || p.BadShares[0].Chunk != tc.bad.Chunk || !errors.Is(p.BadShares[0].Err, ErrCorruptChunk) {
+			t.Errorf("%s: expected %s to be set aside at chunk %d, got %+v", tc.name, tc.bad.Collection, tc.bad.Chunk, p.BadShares)
+		}
+	}
+
+	// With only K collections, a bad chunk can't be decoded around
+	if _, _, err := decode(stream("2A3", badHeader), stream("2B3", nil)); !errors.Is(err, ErrCorruptChunk) || !strings.Contains(err.Error(), "only 1 good ones are left") {
+		t.Errorf("Expected a bad chunk in one of K collections to fail the decode, got %v", err)
+	}
+	if _, _, err := decode(stream("2A3", nil), stream("2B3", truncated)); !errors.Is(err, ErrCorruptChunk) {
+		t.Errorf("Expected a truncated collection of K to fail the decode, got %v", err)
+	}
+}
+
+// TestPadEncodeFrom verifies that an encode continued with EncodeFrom decodes like one that
+// was never interrupted
+func TestPadEncodeFrom(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	input := make([]byte, 1000)
+	for i := range input {
+		input[i] = byte((i * 13) % 256)
+	}
+
+	p, err := NewPadForEncode(ctx, 3, 2)
+	if err != nil {
+		t.Fatalf("Failed to create pad: %v", err)
+	}
+	buffers := make(map[string]*bytes.Buffer)
+	for _, collName := range p.Collections {
+		buffers[collName] = new(bytes.Buffer)
+	}
+	var numbers []int
+	newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		if collectionName == p.Collections[0] {
+			numbers = append(numbers, chunkNumber)
+		}
+		return &nopCloser{buffers[collectionName]}, nil
+	}
+
+	// The first three chunks, then the rest as if resumed after them
+	split := 3 * p.InputChunkBytes(120)
+	if err := p.Encode(ctx, 120, bytes.NewReader(input[:split]), NewTestRNG(0), newChunkFunc, "bin"); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if err := p.EncodeFrom(ctx, 4, 120, bytes.NewReader(input[split:]), NewTestRNG(1), newChunkFunc, "bin"); err != nil {
+		t.Fatalf("EncodeFrom failed: %v", err)
+	}
+	for i, n := range numbers {
+		if n != i+1 {
+			t.Fatalf("Chunks were numbered %v", numbers)
+		}
+	}
+
+	readers := []io.Reader{bytes.NewReader(buffers["2A3"].Bytes()), bytes.NewReader(buffers["2C3"].Bytes())}
+	decoder, err := NewPadForDecode(ctx, len(readers))
+	if err != nil {
+		t.Fatalf("Failed to create decode pad: %v", err)
+	}
+	output := new(bytes.Buffer)
+	if err := decoder.Decode(ctx, readers, output); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if !bytes.Equal(output.Bytes(), input) {
+		t.Errorf("Resumed encode did not decode to the input")
+	}
+
+	if err := p.EncodeFrom(ctx, 0, 120, bytes.NewReader(input), NewTestRNG(0), newChunkFunc, "bin"); err == nil {
+		t.Errorf("Expected an error for chunk number 0")
+	}
+}
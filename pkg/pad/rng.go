@@ -126,9 +126,7 @@ func (m *MultiRNG) Read(ctx context.Context, p []byte) error {
 		}
 
 		// XOR this source's output into the accumulator
-		for j := 0; j < len(p); j++ {
-			acc[j] ^= tmp[j]
-		}
+		xorBytes(acc, tmp)
 	}
 
 	// Ensure we had at least one successful source
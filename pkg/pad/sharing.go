@@ -0,0 +1,462 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package pad
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Sharing is a secret sharing scheme: the way a Pad splits each chunk of data into the pieces
+// held by the N collections of a K-of-N distribution, and combines the pieces of any K of them
+// back into the data. The scheme an encode used is recorded in every chunk header, so decode
+// and repair select it without being told.
+type Sharing interface {
+	// Name identifies the scheme in chunk headers and metadata. The one-time pad scheme, which
+	// predates the choice, is recorded by leaving the name out.
+	Name() string
+
+	// Pieces returns the number of pieces, each the size of the chunk's data, that every
+	// collection of a K-of-N distribution holds for each chunk
+	Pieces(totalCopies, requiredCopies int) int64
+
+	// Split splits a chunk of data into the pieces each collection holds, keyed by collection
+	// letter, in the order they are written to the collection's chunk
+	Split(ctx context.Context, p *Pad, data []byte, randomSource RNG) (map[string][][]byte, error)
+
+	// Combine reconstructs dataBytes of data from the chunks of at least K collections, keyed
+	// by collection letter, each holding the collection's pieces one after another
+	Combine(p *Pad, chunks map[string][]byte, dataBytes int) ([]byte, error)
+
+	// RepairCopies returns the number of surviving collections needed to regenerate a lost one
+	RepairCopies(totalCopies, requiredCopies int) int
+
+	// Regenerate returns the pieces a lost collection held, from the chunks of the survivors,
+	// keyed and laid out as for Combine
+	Regenerate(p *Pad, chunks map[string][]byte, lostLetter string, dataBytes int) ([][]byte, error)
+}
+
+var (
+	// OTP is the combinatorial one-time pad scheme, and the default. Every collection holds a
+	// one-time pad cipher for each of the C(N-1,K-1) permutations of K collections it is in,
+	// so collections grow quickly with N and K.
+	OTP Sharing = otpSharing{}
+
+	// Shamir is Shamir's secret sharing over GF(256). Every collection holds a single share the
+	// size of the data, whatever N and K are, so collections are far smaller than with OTP for
+	// all but the smallest schemes. Fewer than K shares still reveal nothing about the data,
+	// but the data is protected by polynomial arithmetic rather than one-time pads.
+	Shamir Sharing = shamirSharing{}
+)
+
+// ShamirMandatory returns Shamir sharing in which the collections with the given letters are
+// mandatory: any K collections reconstruct the data only if every mandatory collection is
+// among them, so whoever holds a mandatory collection can veto reconstruction. Each mandatory
+// collection holds a random pad, and the data XORed with every pad is shared among the other
+// collections with a threshold of K less the number of mandatory collections. A mandatory
+// collection can't be regenerated by repair, as that would take its veto away.
+func ShamirMandatory(letters ...string) (Sharing, error) {
+	var mandatory []string
+	for _, letter := range letters {
+		letter = strings.ToUpper(strings.TrimSpace(letter))
+		if len(letter) != 1 || letter[0] < 'A' || letter[0] > 'Z' {
+			return nil, fmt.Errorf("invalid mandatory collection letter %q", letter)
+		}
+		if !slices.Contains(mandatory, letter) {
+			mandatory = append(mandatory, letter)
+		}
+	}
+	if len(mandatory) == 0 {
+		return nil, fmt.Errorf("no mandatory collections given")
+	}
+	sort.Strings(mandatory)
+	return shamirSharing{mandatory: strings.Join(mandatory, "")}, nil
+}
+
+// MandatoryCollections returns the letters of the collections a scheme makes mandatory, in
+// order, which are none unless it came from ShamirMandatory
+func MandatoryCollections(s Sharing) []string {
+	if shamir, ok := s.(shamirSharing); ok && shamir.mandatory != "" {
+		return strings.Split(shamir.mandatory, "")
+	}
+	return nil
+}
+
+// sharings are the schemes that can be named in chunk headers
+var sharings = []Sharing{OTP, Shamir}
+
+// SharingByName returns the scheme with the given name, with "otp" or "" naming OTP, and
+// "shamir+AB" naming Shamir with collections A and B mandatory
+func SharingByName(name string) (Sharing, error) {
+	if name == "otp" {
+		return OTP, nil
+	}
+	if base, mandatory, found := strings.Cut(name, "+"); found && base == Shamir.Name() {
+		s, err := ShamirMandatory(strings.Split(mandatory, "")...)
+		if err != nil || s.Name() != name {
+			return nil, fmt.Errorf("unknown secret sharing scheme %q", name)
+		}
+		return s, nil
+	}
+	for _, s := range sharings {
+		if s.Name() == name {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown secret sharing scheme %q", name)
+}
+
+// SharingName returns the name the user selects a scheme by, which for OTP is "otp" rather than
+// the empty name recorded in chunk headers
+func SharingName(s Sharing) string {
+	if s == nil || s.Name() == "" {
+		return "otp"
+	}
+	return s.Name()
+}
+
+// sharing returns the scheme the pad encodes with
+func (p *Pad) sharing() Sharing {
+	if p.Sharing == nil {
+		return OTP
+	}
+	return p.Sharing
+}
+
+// otpSharing implements OTP with the permutations PadInit generates
+type otpSharing struct{}
+
+func (otpSharing) Name() string { return "" }
+
+func (otpSharing) Pieces(totalCopies, requiredCopies int) int64 {
+	// Each collection is in one permutation for every way of choosing the other K-1 collections
+	return binomial(totalCopies-1, requiredCopies-1)
+}
+
+func (otpSharing) Split(ctx context.Context, p *Pad, data []byte, randomSource RNG) (map[string][][]byte, error) {
+	ciphers, err := p.generateCiphers(ctx, data, randomSource)
+	if err != nil {
+		return nil, err
+	}
+	pieces := make(map[string][][]byte, len(p.Collections))
+	for letter, perms := range p.Permutations {
+		for _, perm := range perms {
+			collIndex, err := permutationIndex(perm, letter)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find permutation index in %s for collection %s: %w", perm, letter, err)
+			}
+			pieces[letter] = append(pieces[letter], ciphers[perm][collIndex])
+		}
+	}
+	return pieces, nil
+}
+
+func (otpSharing) Combine(p *Pad, chunks map[string][]byte, dataBytes int) ([]byte, error) {
+	// The permutation of the first K collections is decoded from the cipher each holds for it
+	letters := sortedLetters(chunks)[:p.RequiredCopies]
+	permutation := strings.Join(letters, "")
+	decoded := make([]byte, dataBytes)
+	for _, letter := range letters {
+		cipher, err := otpCipher(p, chunks, letter, permutation, dataBytes)
+		if err != nil {
+			return nil, err
+		}
+		xorBytes(decoded, cipher)
+	}
+	return decoded, nil
+}
+
+func (otpSharing) RepairCopies(totalCopies, requiredCopies int) int {
+	// The lost collection shares a permutation with every other collection
+	return totalCopies - 1
+}
+
+func (o otpSharing) Regenerate(p *Pad, chunks map[string][]byte, lostLetter string, dataBytes int) ([][]byte, error) {
+	decoded, err := o.Combine(p, chunks, dataBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each cipher the lost collection held is the XOR of the data with the ciphers the other
+	// collections hold for the same permutation
+	pieces := make([][]byte, 0, len(p.Permutations[lostLetter]))
+	for _, perm := range p.Permutations[lostLetter] {
+		lost := make([]byte, dataBytes)
+		copy(lost, decoded)
+		for _, letter := range perm {
+			if string(letter) == lostLetter {
+				continue
+			}
+			cipher, err := otpCipher(p, chunks, string(letter), perm, dataBytes)
+			if err != nil {
+				return nil, err
+			}
+			xorBytes(lost, cipher)
+		}
+		pieces = append(pieces, lost)
+	}
+	return pieces, nil
+}
+
+// otpCipher returns the cipher a collection's chunk holds for a permutation
+func otpCipher(p *Pad, chunks map[string][]byte, letter string, perm string, dataBytes int) ([]byte, error) {
+	perms := p.Permutations[letter]
+	index := sort.SearchStrings(perms, perm)
+	if index == len(perms) || perms[index] != perm {
+		return nil, fmt.Errorf("failed to find permutation %s for collection %s", perm, letter)
+	}
+	base := index * dataBytes
+	if len(chunks[letter]) < base+dataBytes {
+		return nil, fmt.Errorf("chunk data truncated in collection %s - possible corruption detected: %w", letter, ErrCorruptChunk)
+	}
+	return chunks[letter][base : base+dataBytes], nil
+}
+
+// shamirSharing implements Shamir and ShamirMandatory. Each byte of data is the constant term
+// of its own random polynomial of degree K-1, and the collection with letter index i holds the
+// polynomials' values at x = i+1. With mandatory collections, each of them holds a pad instead,
+// and the polynomials, of degree K-1 less the number of pads, share the data XORed with them.
+type shamirSharing struct {
+	mandatory string // Letters of the mandatory collections, in order
+}
+
+func (s shamirSharing) Name() string {
+	if s.mandatory != "" {
+		return "shamir+" + s.mandatory
+	}
+	return "shamir"
+}
+
+func (shamirSharing) Pieces(totalCopies, requiredCopies int) int64 { return 1 }
+
+// checkScheme checks that the mandatory collections suit a K-of-N scheme
+func (s shamirSharing) checkScheme(totalCopies, requiredCopies int) error {
+	for _, letter := range s.mandatory {
+		if int(letter-'A') >= totalCopies {
+			return fmt.Errorf("mandatory collection %s is not one of the %d collections: %w", string(letter), totalCopies, ErrInvalidScheme)
+		}
+	}
+	if len(s.mandatory) >= requiredCopies {
+		return fmt.Errorf("%d mandatory collections leave none of the %d required to be chosen freely: %w", len(s.mandatory), requiredCopies, ErrInvalidScheme)
+	}
+	return nil
+}
+
+// isMandatory returns whether the collection with the given letter is mandatory
+func (s shamirSharing) isMandatory(letter string) bool {
+	return strings.Contains(s.mandatory, letter)
+}
+
+// sharedLetters returns those of letters whose collections hold shares rather than pads
+func (s shamirSharing) sharedLetters(letters []string) []string {
+	var shared []string
+	for _, letter := range letters {
+		if !s.isMandatory(letter) {
+			shared = append(shared, letter)
+		}
+	}
+	return shared
+}
+
+func (s shamirSharing) Split(ctx context.Context, p *Pad, data []byte, randomSource RNG) (map[string][][]byte, error) {
+	letters := make([]string, p.TotalCopies)
+	for i := range letters {
+		letters[i] = collectionLetterFromIndex(i)
+	}
+
+	// Mask the data with a pad for each mandatory collection, and share what's left
+	masked := make([]byte, len(data))
+	copy(masked, data)
+	pads := make(map[string][]byte, len(s.mandatory))
+	for _, letter := range s.mandatory {
+		pad := make([]byte, len(data))
+		if err := randomSource.Read(ctx, pad); err != nil {
+			return nil, fmt.Errorf("random generator error: %w", err)
+		}
+		xorBytes(masked, pad)
+		pads[string(letter)] = pad
+	}
+	pieces, err := shamirSplit(ctx, masked, p.RequiredCopies-len(s.mandatory), s.sharedLetters(letters), randomSource)
+	if err != nil {
+		return nil, err
+	}
+	for letter, pad := range pads {
+		pieces[letter] = [][]byte{pad}
+	}
+	return pieces, nil
+}
+
+func (s shamirSharing) Combine(p *Pad, chunks map[string][]byte, dataBytes int) ([]byte, error) {
+	shared, err := s.sharesFor(p, chunks)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := shamirInterpolate(chunks, shared, 0, dataBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every pad must be present to unmask the data the shares reconstruct
+	for _, letter := range s.mandatory {
+		pad := chunks[string(letter)]
+		if pad == nil {
+			return nil, fmt.Errorf("collection %s is mandatory, but was not supplied: %w",
+				buildCollectionLabel(p.RequiredCopies, p.TotalCopies, string(letter)), ErrInsufficientCollections)
+		}
+		if len(pad) < dataBytes {
+			return nil, fmt.Errorf("chunk data truncated in collection %s - possible corruption detected: %w", string(letter), ErrCorruptChunk)
+		}
+		xorBytes(decoded, pad[:dataBytes])
+	}
+	return decoded, nil
+}
+
+// sharesFor returns the letters of the collections among chunks whose shares are interpolated,
+// which are just enough of those that aren't mandatory
+func (s shamirSharing) sharesFor(p *Pad, chunks map[string][]byte) ([]string, error) {
+	threshold := p.RequiredCopies - len(s.mandatory)
+	shared := s.sharedLetters(sortedLetters(chunks))
+	if len(shared) < threshold {
+		return nil, fmt.Errorf("%d collections that aren't mandatory are needed, but only %d were supplied: %w",
+			threshold, len(shared), ErrInsufficientCollections)
+	}
+	return shared[:threshold], nil
+}
+
+func (s shamirSharing) RepairCopies(totalCopies, requiredCopies int) int {
+	// A lost share is interpolated from the other shares alone
+	return requiredCopies - len(s.mandatory)
+}
+
+func (s shamirSharing) Regenerate(p *Pad, chunks map[string][]byte, lostLetter string, dataBytes int) ([][]byte, error) {
+	if s.isMandatory(lostLetter) {
+		return nil, fmt.Errorf("collection %s is mandatory, so it can't be regenerated from the others",
+			buildCollectionLabel(p.RequiredCopies, p.TotalCopies, lostLetter))
+	}
+	shared, err := s.sharesFor(p, chunks)
+	if err != nil {
+		return nil, err
+	}
+	share, err := shamirInterpolate(chunks, shared, shamirX(lostLetter), dataBytes)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{share}, nil
+}
+
+// shamirX returns the x at which a collection's share is evaluated
+func shamirX(letter string) byte {
+	return letter[0] - 'A' + 1
+}
+
+// shamirSplit returns the shares of data for the collections with the given letters, any
+// threshold of which reconstruct it
+func shamirSplit(ctx context.Context, data []byte, threshold int, letters []string, randomSource RNG) (map[string][][]byte, error) {
+	// The threshold-1 random coefficients of every byte's polynomial
+	coefficients := make([][]byte, threshold-1)
+	for i := range coefficients {
+		coefficients[i] = make([]byte, len(data))
+		if err := randomSource.Read(ctx, coefficients[i]); err != nil {
+			return nil, fmt.Errorf("random generator error: %w", err)
+		}
+	}
+
+	// Evaluate the polynomials at each collection's x by Horner's method
+	pieces := make(map[string][][]byte, len(letters))
+	for _, letter := range letters {
+		mul := &gfMulTable[shamirX(letter)]
+		share := make([]byte, len(data))
+		for d := len(coefficients) - 1; d >= 0; d-- {
+			for j, c := range coefficients[d] {
+				share[j] = mul[share[j]] ^ c
+			}
+		}
+		for j, c := range data {
+			share[j] = mul[share[j]] ^ c
+		}
+		pieces[letter] = [][]byte{share}
+	}
+	return pieces, nil
+}
+
+// shamirInterpolate evaluates the polynomials through the shares of the collections with the
+// given letters at x, which at 0 gives the data and at a collection's x gives its share
+func shamirInterpolate(chunks map[string][]byte, letters []string, x byte, dataBytes int) ([]byte, error) {
+	xs := make([]byte, len(letters))
+	for i, letter := range letters {
+		if len(chunks[letter]) < dataBytes {
+			return nil, fmt.Errorf("chunk data truncated in collection %s - possible corruption detected: %w", letter, ErrCorruptChunk)
+		}
+		xs[i] = shamirX(letter)
+	}
+
+	result := make([]byte, dataBytes)
+	for i, letter := range letters {
+		// The Lagrange basis polynomial of this share, evaluated at x
+		basis := byte(1)
+		for j, xj := range xs {
+			if j != i {
+				basis = gfMul(basis, gfDiv(x^xj, xs[i]^xj))
+			}
+		}
+		mul := &gfMulTable[basis]
+		for j, b := range chunks[letter][:dataBytes] {
+			result[j] ^= mul[b]
+		}
+	}
+	return result, nil
+}
+
+// sortedLetters returns the collection letters of chunks in order
+func sortedLetters(chunks map[string][]byte) []string {
+	letters := make([]string, 0, len(chunks))
+	for letter := range chunks {
+		letters = append(letters, letter)
+	}
+	sort.Strings(letters)
+	return letters
+}
+
+// GF(256) arithmetic with the AES polynomial x^8 + x^4 + x^3 + x + 1, in which addition is XOR
+var (
+	gfExp      [510]byte
+	gfLog      [256]byte
+	gfMulTable [256][256]byte // gfMulTable[a][b] is a times b
+)
+
+func init() {
+	// 3 generates the multiplicative group
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfExp[i+255] = x
+		gfLog[x] = byte(i)
+		// Multiply by 3: x*2 reduced by the polynomial, plus x
+		doubled := x << 1
+		if x&0x80 != 0 {
+			doubled ^= 0x1b
+		}
+		x ^= doubled
+	}
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			gfMulTable[a][b] = gfExp[int(gfLog[a])+int(gfLog[b])]
+		}
+	}
+}
+
+// gfMul returns a times b in GF(256)
+func gfMul(a, b byte) byte {
+	return gfMulTable[a][b]
+}
+
+// gfDiv returns a divided by b in GF(256), for b != 0
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
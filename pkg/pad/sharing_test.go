@@ -0,0 +1,289 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package pad
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// encodeShamir encodes input with Shamir sharing and returns each collection's stream
+func encodeShamir(t *testing.T, ctx context.Context, n, k, chunkSize int, input []byte) map[string][]byte {
+	t.Helper()
+	p, err := NewPadForEncodeWith(ctx, n, k, Shamir)
+	if err != nil {
+		t.Fatalf("Failed to create pad: %v", err)
+	}
+	buffers := make(map[string]*bytes.Buffer)
+	for _, collName := range p.Collections {
+		buffers[collName] = new(bytes.Buffer)
+	}
+	newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		return &nopCloser{buffers[collectionName]}, nil
+	}
+	if err := p.Encode(ctx, chunkSize, bytes.NewReader(input), NewTestRNG(0), newChunkFunc, "bin"); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	collections := make(map[string][]byte)
+	for name, buf := range buffers {
+		collections[name] = buf.Bytes()
+	}
+	return collections
+}
+
+// TestShamirDecode verifies that every K of the N collections decode to the input, and that
+// each collection is about the size of the input whatever K and N are
+func TestShamirDecode(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	input := make([]byte, 1000)
+	for i := range input {
+		input[i] = byte((i * 17) % 256)
+	}
+	collections := encodeShamir(t, ctx, 5, 3, 128, input)
+
+	for _, subset := range [][]string{{"3A5", "3B5", "3C5"}, {"3E5", "3C5", "3A5"}, {"3B5", "3D5", "3E5"}, {"3A5", "3B5", "3C5", "3D5", "3E5"}} {
+		var readers []io.Reader
+		for _, name := range subset {
+			readers = append(readers, bytes.NewReader(collections[name]))
+		}
+		output := new(bytes.Buffer)
+		if err := (&Pad{}).Decode(ctx, readers, output); err != nil {
+			t.Fatalf("Failed to decode %v: %v", subset, err)
+		}
+		if !bytes.Equal(output.Bytes(), input) {
+			t.Errorf("Decoding %v did not reproduce the input", subset)
+		}
+	}
+
+	want, err := EncodedCollectionSizeWith(Shamir, 5, 3, 128, int64(len(input)))
+	if err != nil {
+		t.Fatalf("EncodedCollectionSizeWith failed: %v", err)
+	}
+	for name, data := range collections {
+		if int64(len(data)) != want {
+			t.Errorf("Collection %s has %d bytes, computed %d", name, len(data), want)
+		}
+	}
+	if otp, _ := EncodedCollectionSize(5, 3, 128, int64(len(input))); want*4 > otp {
+		t.Errorf("Expected Shamir collections of %d bytes to be far smaller than OTP ones of %d", want, otp)
+	}
+
+	// A collection's chunks name the scheme, and too few collections don't decode
+	h, err := ParseChunkHeader(collections["3A5"])
+	if err != nil || h.Sharing != Shamir {
+		t.Errorf("Expected a Shamir chunk header, got %+v, %v", h, err)
+	}
+	readers := []io.Reader{bytes.NewReader(collections["3A5"]), bytes.NewReader(collections["3D5"])}
+	if err := (&Pad{}).Decode(ctx, readers, io.Discard); !errors.Is(err, ErrInsufficientCollections) {
+		t.Errorf("Expected ErrInsufficientCollections decoding two collections, got %v", err)
+	}
+}
+
+// TestShamirMixedSessions verifies that Shamir and OTP collections aren't decoded together
+func TestShamirMixedSessions(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	shamir := encodeShamir(t, ctx, 3, 2, 100, make([]byte, 300))
+	p, err := NewPadForEncode(ctx, 3, 2)
+	if err != nil {
+		t.Fatalf("Failed to create pad: %v", err)
+	}
+	otp := new(bytes.Buffer)
+	newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		if collectionName == "2B3" {
+			return &nopCloser{otp}, nil
+		}
+		return &nopCloser{new(bytes.Buffer)}, nil
+	}
+	if err := p.Encode(ctx, 100, bytes.NewReader(make([]byte, 300)), NewTestRNG(0), newChunkFunc, "bin"); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	readers := []io.Reader{bytes.NewReader(shamir["2A3"]), bytes.NewReader(otp.Bytes())}
+	if err := (&Pad{}).Decode(ctx, readers, io.Discard); !errors.Is(err, ErrMixedSessions) {
+		t.Errorf("Expected ErrMixedSessions decoding Shamir and OTP collections together, got %v", err)
+	}
+}
+
+// TestShamirRepair verifies that a lost collection is regenerated byte for byte from any K
+// survivors
+func TestShamirRepair(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	collections := encodeShamir(t, ctx, 5, 3, 100, make([]byte, 777))
+	repair := func(lost string, survivors ...string) ([]byte, error) {
+		var readers []io.Reader
+		for _, name := range survivors {
+			readers = append(readers, bytes.NewReader(collections[name]))
+		}
+		repaired := new(bytes.Buffer)
+		repairChunk := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+			return &nopCloser{repaired}, nil
+		}
+		_, err := (&Pad{}).Repair(ctx, readers, lost, repairChunk, "bin")
+		return repaired.Bytes(), err
+	}
+
+	repaired, err := repair("3B5", "3E5", "3A5", "3D5")
+	if err != nil {
+		t.Fatalf("Failed to repair 3B5: %v", err)
+	}
+	if !bytes.Equal(repaired, collections["3B5"]) {
+		t.Errorf("Repaired collection 3B5 does not match the lost collection")
+	}
+
+	if _, err := repair("", "3A5", "3B5", "3C5"); err == nil {
+		t.Errorf("Expected an error when the collection to repair is ambiguous")
+	}
+	if _, err := repair("3B5", "3A5", "3C5"); !errors.Is(err, ErrInsufficientCollections) {
+		t.Errorf("Expected ErrInsufficientCollections repairing from K-1 collections, got %v", err)
+	}
+}
+
+// TestShamirMandatory verifies that K collections decode only if the mandatory ones are among
+// them, and that the others can be repaired but the mandatory ones can't
+func TestShamirMandatory(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+
+	sharing, err := ShamirMandatory("b", "A", "B")
+	if err != nil || sharing.Name() != "shamir+AB" {
+		t.Fatalf("ShamirMandatory = %v, %v", sharing, err)
+	}
+	input := make([]byte, 500)
+	for i := range input {
+		input[i] = byte((i * 31) % 256)
+	}
+	p, err := NewPadForEncodeWith(ctx, 5, 3, sharing)
+	if err != nil {
+		t.Fatalf("Failed to create pad: %v", err)
+	}
+	buffers := make(map[string]*bytes.Buffer)
+	for _, collName := range p.Collections {
+		buffers[collName] = new(bytes.Buffer)
+	}
+	newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		return &nopCloser{buffers[collectionName]}, nil
+	}
+	if err := p.Encode(ctx, 128, bytes.NewReader(input), NewTestRNG(0), newChunkFunc, "bin"); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	decode := func(names ...string) ([]byte, error) {
+		var readers []io.Reader
+		for _, name := range names {
+			readers = append(readers, bytes.NewReader(buffers[name].Bytes()))
+		}
+		output := new(bytes.Buffer)
+		err := (&Pad{}).Decode(ctx, readers, output)
+		return output.Bytes(), err
+	}
+
+	for _, subset := range [][]string{{"3A5", "3B5", "3C5"}, {"3E5", "3B5", "3A5"}, {"3A5", "3B5", "3C5", "3D5", "3E5"}} {
+		if output, err := decode(subset...); err != nil || !bytes.Equal(output, input) {
+			t.Errorf("Decoding %v did not reproduce the input: %v", subset, err)
+		}
+	}
+	for _, subset := range [][]string{{"3A5", "3C5", "3D5"}, {"3B5", "3C5", "3D5", "3E5"}} {
+		if _, err := decode(subset...); !errors.Is(err, ErrInsufficientCollections) {
+			t.Errorf("Expected ErrInsufficientCollections decoding %v without a mandatory collection, got %v", subset, err)
+		}
+	}
+
+	// The header names the mandatory collections, and repair regenerates only the others
+	if h, err := ParseChunkHeader(buffers["3C5"].Bytes()); err != nil || h.Sharing != sharing {
+		t.Errorf("Expected the chunk header to name the mandatory collections, got %+v, %v", h, err)
+	}
+	repair := func(lost string, survivors ...string) ([]byte, error) {
+		var readers []io.Reader
+		for _, name := range survivors {
+			readers = append(readers, bytes.NewReader(buffers[name].Bytes()))
+		}
+		repaired := new(bytes.Buffer)
+		repairChunk := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+			return &nopCloser{repaired}, nil
+		}
+		_, err := (&Pad{}).Repair(ctx, readers, lost, repairChunk, "bin")
+		return repaired.Bytes(), err
+	}
+	if repaired, err := repair("3E5", "3D5"); err != nil || !bytes.Equal(repaired, buffers["3E5"].Bytes()) {
+		t.Errorf("Failed to repair 3E5 from 3D5: %v", err)
+	}
+	if _, err := repair("3A5", "3B5", "3C5", "3D5", "3E5"); err == nil {
+		t.Errorf("Expected a mandatory collection not to be repairable")
+	}
+}
+
+// TestShamirMandatoryScheme verifies that mandatory collections must suit the K-of-N scheme
+func TestShamirMandatoryScheme(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		letters []string
+		n, k    int
+		valid   bool
+	}{
+		{[]string{"A"}, 3, 2, true},
+		{[]string{"A", "C"}, 5, 3, true},
+		{[]string{"D"}, 3, 2, false},
+		{[]string{"A", "B"}, 3, 2, false},
+	} {
+		sharing, err := ShamirMandatory(tt.letters...)
+		if err != nil {
+			t.Fatalf("ShamirMandatory(%v) failed: %v", tt.letters, err)
+		}
+		if _, err := NewPadForEncodeWith(ctx, tt.n, tt.k, sharing); (err == nil) != tt.valid {
+			t.Errorf("%v mandatory in %d of %d: got %v", tt.letters, tt.k, tt.n, err)
+		} else if err != nil && !errors.Is(err, ErrInvalidScheme) {
+			t.Errorf("Expected ErrInvalidScheme, got %v", err)
+		}
+	}
+	for _, letters := range [][]string{nil, {"AB"}, {"1"}} {
+		if _, err := ShamirMandatory(letters...); err == nil {
+			t.Errorf("Expected ShamirMandatory(%q) to fail", letters)
+		}
+	}
+}
+
+// TestGF256 verifies the field arithmetic Shamir sharing is built on
+func TestGF256(t *testing.T) {
+	for a := 0; a < 256; a++ {
+		if gfMul(byte(a), 1) != byte(a) || gfMul(byte(a), 0) != 0 {
+			t.Fatalf("%d is not multiplied by 0 and 1 correctly", a)
+		}
+		for b := 1; b < 256; b++ {
+			if gfDiv(gfMul(byte(a), byte(b)), byte(b)) != byte(a) {
+				t.Fatalf("(%d * %d) / %d != %d", a, b, b, a)
+			}
+		}
+	}
+	// The AES field's worked example: {57} * {83} = {c1}
+	if got := gfMul(0x57, 0x83); got != 0xc1 {
+		t.Errorf("0x57 * 0x83 = %#x, want 0xc1", got)
+	}
+}
+
+// TestSharingByName verifies that schemes are found by the names users select them with
+func TestSharingByName(t *testing.T) {
+	for name, want := range map[string]Sharing{"": OTP, "otp": OTP, "shamir": Shamir} {
+		if got, err := SharingByName(name); err != nil || got != want {
+			t.Errorf("SharingByName(%q) = %v, %v", name, got, err)
+		}
+		if SharingName(want) == "" {
+			t.Errorf("Scheme %q has no name to select it by", name)
+		}
+	}
+	for _, name := range []string{"rot13", "shamir+", "shamir+BA", "otp+A"} {
+		if _, err := SharingByName(name); err == nil {
+			t.Errorf("Expected the unknown scheme %q to be rejected", name)
+		}
+	}
+	if s, err := SharingByName("shamir+AC"); err != nil || SharingName(s) != "shamir+AC" || len(MandatoryCollections(s)) != 2 {
+		t.Errorf("SharingByName(\"shamir+AC\") = %v, %v", s, err)
+	}
+	if _, err := ParseChunkHeader(append([]byte{14}, "3A5:1:100:otp2"...)); !errors.Is(err, ErrCorruptChunk) {
+		t.Errorf("Expected a chunk naming an unknown scheme to be corrupt, got %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package pad
+
+import "encoding/binary"
+
+// XOR of pads and data is the inner loop of every encode and decode, so it is done a word
+// at a time rather than a byte at a time. On amd64, xorBytes uses AVX2 when the CPU
+// supports it; build with the purego tag to use the portable word loop everywhere.
+
+// xorWords XORs src into dst eight bytes at a time, then finishes the remaining bytes
+// one at a time. src must be at least as long as dst.
+func xorWords(dst, src []byte) {
+	src = src[:len(dst)]
+	for len(dst) >= 8 {
+		v := binary.LittleEndian.Uint64(dst) ^ binary.LittleEndian.Uint64(src)
+		binary.LittleEndian.PutUint64(dst, v)
+		dst, src = dst[8:], src[8:]
+	}
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+//go:build amd64 && !purego
+
+package pad
+
+// xorAccelerated reports whether xorBytes uses SIMD instructions
+var xorAccelerated = cpuHasAVX2()
+
+// cpuHasAVX2 reports whether the CPU supports AVX2 and the OS saves the YMM registers
+func cpuHasAVX2() bool
+
+// xorAVX2 XORs n bytes of src into dst, 32 bytes at a time. n must be a multiple of 32.
+//
+//go:noescape
+func xorAVX2(dst, src *byte, n int)
+
+// xorBytes XORs src into dst. src must be at least as long as dst.
+func xorBytes(dst, src []byte) {
+	src = src[:len(dst)]
+	if xorAccelerated && len(dst) >= 32 {
+		n := len(dst) &^ 31
+		xorAVX2(&dst[0], &src[0], n)
+		dst, src = dst[n:], src[n:]
+	}
+	xorWords(dst, src)
+}
@@ -0,0 +1,13 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+//go:build !amd64 || purego
+
+package pad
+
+// xorAccelerated reports whether xorBytes uses SIMD instructions
+const xorAccelerated = false
+
+// xorBytes XORs src into dst. src must be at least as long as dst.
+func xorBytes(dst, src []byte) {
+	xorWords(dst, src)
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package pad
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// xorBytewise is the byte-at-a-time XOR that xorBytes replaces, used as a reference
+func xorBytewise(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+func TestXorBytes(t *testing.T) {
+	t.Logf("SIMD XOR: %v", xorAccelerated)
+	rng := rand.New(rand.NewSource(1))
+
+	// Cover every tail length around the word and vector sizes, at unaligned offsets, with
+	// src longer than dst
+	for _, size := range []int{0, 1, 7, 8, 9, 31, 32, 33, 127, 128, 129, 255, 1000, 4096 + 17} {
+		for _, offset := range []int{0, 1, 3} {
+			buf := make([]byte, size+offset)
+			src := make([]byte, size+offset+5)
+			rng.Read(buf)
+			rng.Read(src)
+
+			want := append([]byte(nil), buf[offset:]...)
+			xorBytewise(want, src[offset:])
+
+			got := buf[offset:]
+			xorBytes(got, src[offset:])
+			if !bytes.Equal(got, want) {
+				t.Errorf("xorBytes mismatch for %d bytes at offset %d", size, offset)
+			}
+
+			got = append([]byte(nil), buf[offset:]...)
+			xorWords(got, src[offset:])
+			xorWords(got, src[offset:])
+			if !bytes.Equal(got, buf[offset:]) {
+				t.Errorf("xorWords twice is not the identity for %d bytes at offset %d", size, offset)
+			}
+		}
+	}
+
+	// XOR never writes past the end of dst
+	backing := make([]byte, 100)
+	xorBytes(backing[:64], bytes.Repeat([]byte{0xff}, 100))
+	if !bytes.Equal(backing[64:], make([]byte, 36)) {
+		t.Errorf("xorBytes wrote past the end of dst")
+	}
+}
+
+func BenchmarkXor(b *testing.B) {
+	impls := []struct {
+		name string
+		xor  func(dst, src []byte)
+	}{
+		{"bytewise", xorBytewise},
+		{"words", xorWords},
+		{"xorBytes", xorBytes},
+	}
+	for _, size := range []int{1 << 10, 64 << 10, 1 << 20} {
+		dst := make([]byte, size)
+		src := make([]byte, size)
+		rand.New(rand.NewSource(1)).Read(src)
+		for _, impl := range impls {
+			b.Run(fmt.Sprintf("%s/%d", impl.name, size), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				for b.Loop() {
+					impl.xor(dst, src)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,447 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// An encode with Append adds its input to collections that already exist, rather than
+// writing new ones, so that a periodic backup can grow a set of collections. The input is
+// serialized and compressed as a payload of its own, and encoded as further chunks of every
+// collection, numbered on from the last chunk they hold; the scheme, format, and chunk size
+// are the collections' own. Each append is recorded in the metadata as a file.Segment. A
+// decode restores every payload in turn to the output directory, so that files in a later
+// payload replace those of the same name in an earlier one; files that were removed from
+// the input since an earlier payload are still restored from it.
+
+// appendTarget is the collections an encode with Append adds to, as they were found
+type appendTarget struct {
+	collections []file.Collection
+	metadata    []*file.Metadata  // Metadata of each collection before the append
+	entries     []map[string]bool // Files in each collection directory before the append; nil for an archive
+	chunks      int               // Chunks each collection held before the append
+}
+
+// checkAppend refuses an encode with Append that can't add to existing collections: one of a
+// stream, or to a sink, and one with options that only apply when collections are created
+func checkAppend(cfg EncodeConfig) error {
+	if !cfg.Append {
+		return nil
+	}
+	switch {
+	case cfg.RawInput != nil || cfg.InputStream != nil:
+		return fmt.Errorf("only input directories can be appended to collections, not a stream")
+	case cfg.ChunkSink != nil:
+		return fmt.Errorf("chunks can't be appended to a sink")
+	case cfg.SizeOnly:
+		return fmt.Errorf("an append can't be a dry run")
+	case cfg.Resume:
+		return fmt.Errorf("an append can't be resumed; if it fails, the collections are left as they were, so run it again")
+	case cfg.KeepPartial:
+		return fmt.Errorf("an append that fails always leaves the collections as they were, so there is no partial output to keep")
+	case cfg.ClearIfNotEmpty:
+		return fmt.Errorf("an append adds to the collections in the output directory, which can't be cleared")
+	case cfg.VolumeSize > 0:
+		return fmt.Errorf("collections split into volumes can't be appended to")
+	case cfg.ChunkIndex:
+		return fmt.Errorf("appended data can't have a chunk index")
+	case len(cfg.Passphrase) > 0 || len(cfg.EnvelopeKey) > 0:
+		return fmt.Errorf("appended data can't be encrypted with a passphrase or envelope key")
+	case len(cfg.MACKey) > 0:
+		return fmt.Errorf("appended chunks can't be authenticated with MACs")
+	case cfg.PadTo.Mode != PadNone || cfg.HiddenDir != "":
+		return fmt.Errorf("appended data can't be padded or hold a hidden volume")
+	case cfg.StealthNames || len(cfg.Labels) > 0 || len(cfg.Notes) > 0 || len(cfg.Custodians) > 0 || !cfg.ReviewBy.IsZero():
+		return fmt.Errorf("an append keeps the names, labels, notes, custodians, and review date the collections were encoded with")
+	}
+	return nil
+}
+
+// loadAppendTarget finds the collections in the output directories of cfg, checks that they
+// are a complete set that data can be appended to, and sets the scheme, format, chunk size,
+// and layout of cfg to theirs
+func loadAppendTarget(ctx context.Context, cfg *EncodeConfig, destinations []file.Destination) (*appendTarget, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	for _, dest := range destinations {
+		if dest.LocalDir() != dest.String() {
+			return nil, fmt.Errorf("collections in %s can't be appended to; only collections in local directories can", dest)
+		}
+	}
+
+	// Collection directories and archives are in the output directory, or are the output directories
+	var found []file.Collection
+	for _, dir := range encodeOutputDirs(*cfg) {
+		colls, err := appendableCollections(dir, len(cfg.OutputDirs) > 1)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, colls...)
+	}
+
+	target := &appendTarget{}
+	var first *file.Metadata
+	var archived bool
+	cfg.PNGEmbedding = ""
+	for _, coll := range found {
+		md, err := file.ReadMetadata(ctx, coll, cfg.MetadataKey)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't append to collection %s: %w", coll.Name, err)
+		}
+		switch {
+		case len(coll.Volumes) > 0:
+			return nil, fmt.Errorf("collection %s is split into volumes, which can't be appended to", md.Collection)
+		case file.ArchiveFormatOf(coll.Path) == file.ArchiveZip:
+			return nil, fmt.Errorf("collection %s is a ZIP archive; only TAR archives and collection directories can be appended to", md.Collection)
+		case md.Chunks == 0:
+			return nil, fmt.Errorf("collection %s doesn't record its chunks, because it wasn't completely encoded or was encoded by an older padlock, so it can't be appended to", md.Collection)
+		case md.Stream != "":
+			return nil, fmt.Errorf("collection %s holds a stream rather than files, so nothing can be appended to it", md.Collection)
+		case md.Envelope != nil:
+			return nil, fmt.Errorf("collection %s is encrypted with an envelope key, so nothing can be appended to it", md.Collection)
+		case md.Index != nil:
+			return nil, fmt.Errorf("collection %s has a chunk index, so nothing can be appended to it", md.Collection)
+		}
+		if _, err := file.ReadChunkMACs(ctx, coll, nil); !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("the chunks of collection %s are authenticated with MACs, so nothing can be appended to it", md.Collection)
+		}
+		if first == nil {
+			first = md
+			archived = file.IsArchivePath(coll.Path)
+		} else if md.Session != first.Session || md.Chunks != first.Chunks {
+			return nil, fmt.Errorf("collections %s and %s are from different encodes, so they can't be appended to together: %w", first.Collection, md.Collection, ErrMixedSessions)
+		} else if file.IsArchivePath(coll.Path) != archived {
+			return nil, fmt.Errorf("collections %s and %s aren't all archives or all directories, so they can't be appended to together", first.Collection, md.Collection)
+		}
+
+		coll.Name = md.Collection
+		coll.StoredName = md.StoredName
+		coll.Format = md.Format
+		if md.PNGEmbedding != "" {
+			cfg.PNGEmbedding = md.PNGEmbedding
+		}
+		if archived && len(cfg.OutputDirs) > 1 {
+			// Chunks for an archive in an output directory of its own are written to
+			// the archive named after the collection in that directory
+			if filepath.Base(coll.Path) != coll.DiskName()+file.ArchiveTar.Ext() {
+				return nil, fmt.Errorf("the archive of collection %s isn't named after it, so it can't be appended to", md.Collection)
+			}
+			coll.Path = filepath.Dir(coll.Path)
+		}
+		target.collections = append(target.collections, coll)
+		target.metadata = append(target.metadata, md)
+	}
+	if first == nil {
+		return nil, fmt.Errorf("no collections to append to were found in %s", strings.Join(encodeOutputDirs(*cfg), ", "))
+	}
+	if len(target.collections) != first.Copies {
+		return nil, fmt.Errorf("%d of the %d collections were found; every collection is needed to append to them: %w",
+			len(target.collections), first.Copies, ErrInsufficientCollections)
+	}
+	if len(cfg.OutputDirs) > 1 && len(cfg.OutputDirs) != first.Copies {
+		return nil, fmt.Errorf("%d output directories given for %d collections", len(cfg.OutputDirs), first.Copies)
+	}
+	sharing := pad.OTP
+	if first.Sharing != "" {
+		var err error
+		if sharing, err = pad.SharingByName(first.Sharing); err != nil {
+			return nil, err
+		}
+	}
+
+	// Directory collections lose whatever the append adds to them if it fails
+	for _, coll := range target.collections {
+		var names map[string]bool
+		if !archived {
+			entries, err := os.ReadDir(coll.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read collection %s: %w", coll.Name, err)
+			}
+			names = make(map[string]bool, len(entries))
+			for _, entry := range entries {
+				names[entry.Name()] = true
+			}
+		}
+		target.entries = append(target.entries, names)
+	}
+
+	// The new chunks are written the way the existing ones were
+	cfg.N, cfg.K = first.Copies, first.Required
+	cfg.Sharing = sharing
+	// The new chunks of each collection are written in its own format
+	cfg.Format = first.Format
+	cfg.ChunkSize = first.ChunkSize
+	cfg.ArchiveCollections = archived
+	cfg.ArchiveFormat = file.ArchiveTar
+	cfg.session = first.Session
+	target.chunks = first.Chunks
+
+	log.Infof("Appending to %d collections after chunk %d", len(target.collections), target.chunks)
+	return target, nil
+}
+
+// appendableCollections returns the collection directories and archives in dir, or dir itself
+// if it is a collection directory of its own. Those without metadata are weeded out by the
+// caller.
+func appendableCollections(dir string, own bool) ([]file.Collection, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output directory: %w", err)
+	}
+	var collections []file.Collection
+	if _, err := os.Stat(filepath.Join(dir, file.MetadataFileName)); own && err == nil {
+		collections = append(collections, file.Collection{Name: filepath.Base(dir), Path: dir})
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if file.IsPartialOutput(path) {
+			continue
+		}
+		switch {
+		case entry.IsDir():
+			if _, err := os.Stat(filepath.Join(path, file.MetadataFileName)); err == nil {
+				collections = append(collections, file.Collection{Name: entry.Name(), Path: path})
+			}
+		case strings.HasSuffix(entry.Name(), file.VolumeManifestSuffix):
+			_, volumes, err := file.ReadVolumeManifest(path)
+			if err != nil {
+				return nil, err
+			}
+			collections = append(collections, file.Collection{Name: entry.Name(), Path: path, Volumes: volumes})
+		case file.IsArchivePath(entry.Name()) && !file.IsVolumePath(entry.Name()):
+			collections = append(collections, file.Collection{Name: entry.Name(), Path: path})
+		}
+	}
+	return collections, nil
+}
+
+// open returns the collections of the target in the order of names, and starts the writers
+// that add chunks to their archives
+func (a *appendTarget) open(ctx context.Context, cfg EncodeConfig, names []string, tarWriters *file.TarWriterRegistry) ([]file.Collection, error) {
+	collections := make([]file.Collection, len(names))
+	for i, name := range names {
+		j := slices.IndexFunc(a.collections, func(coll file.Collection) bool { return coll.Name == name })
+		if j < 0 {
+			return nil, fmt.Errorf("collection %s wasn't found, so nothing can be appended", name)
+		}
+		collections[i] = a.collections[j]
+		if cfg.ArchiveCollections {
+			tarPath := collectionTarPath(cfg, collections[i].Path, collections[i].DiskName())
+			if _, err := tarWriters.AppendChunkWriter(ctx, tarPath, collections[i].DiskName(), collections[i].Format); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return collections, nil
+}
+
+// rollBack leaves the collections as they were before an append that returned err. Archives
+// are left alone when their writers are aborted; collection directories lose the files the
+// append added, as well as files, such as PAR2 recovery files, that it wrote elsewhere, and
+// get their metadata back.
+func (a *appendTarget) rollBack(ctx context.Context, cfg EncodeConfig, err error, files []string) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+	if err == nil {
+		return
+	}
+
+	var removed []string
+	for i, coll := range a.collections {
+		if a.entries[i] == nil {
+			continue
+		}
+		entries, err := os.ReadDir(coll.Path)
+		if err != nil {
+			log.Error(fmt.Errorf("failed to roll back collection %s: %w", coll.Name, err))
+			continue
+		}
+		for _, entry := range entries {
+			if a.entries[i][entry.Name()] || entry.Name() == file.LockFileName {
+				continue
+			}
+			files = append(files, filepath.Join(coll.Path, entry.Name()))
+		}
+		if err := storeCollectionMetadata(ctx, cfg, coll, a.metadata[i], nil); err != nil {
+			log.Error(fmt.Errorf("failed to restore the metadata of collection %s: %w", coll.Name, err))
+		}
+	}
+	for _, path := range files {
+		if err := os.RemoveAll(path); err != nil {
+			log.Error(fmt.Errorf("failed to remove appended output %s: %w", path, err))
+			continue
+		}
+		removed = append(removed, path)
+	}
+	log.Infof("Rolled back the append; the collections hold what they did before it")
+	if cfg.Result != nil {
+		cfg.Result.RolledBack = removed
+	}
+}
+
+// recordAppend adds the payload the append encoded, as the chunks after those the collections
+// held, to the metadata of every collection, with its hash if the metadata is sealed
+func recordAppend(ctx context.Context, cfg EncodeConfig, a *appendTarget, collections []file.Collection, sum string, chunks int, tarWriters *file.TarWriterRegistry) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	segment := file.Segment{
+		FirstChunk:       a.chunks + 1,
+		Chunks:           chunks - a.chunks,
+		Compression:      cfg.Compression.effective().String(),
+		CompressionLevel: cfg.compressionLevel(),
+		CompressionAuto:  cfg.autoCompressed,
+		Appended:         time.Now().UTC().Truncate(time.Second),
+	}
+	if len(cfg.MetadataKey) > 0 {
+		segment.PayloadSHA256 = sum
+	}
+	for _, coll := range collections {
+		i := slices.IndexFunc(a.collections, func(c file.Collection) bool { return c.Name == coll.Name })
+		md := *a.metadata[i]
+		md.Segments = append(slices.Clone(md.Segments), segment)
+		md.Chunks = chunks
+		if err := storeCollectionMetadata(ctx, cfg, coll, &md, tarWriters); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Appended chunks %d to %d to %d collections", segment.FirstChunk, chunks, len(collections))
+	return nil
+}
+
+// collectionSegments returns the metadata of the first collection that records appended
+// data, or nil if none does
+func collectionSegments(ctx context.Context, collections []file.Collection, key []byte) *file.Metadata {
+	for _, coll := range collections {
+		md, err := file.ReadMetadata(ctx, coll, key)
+		if err == nil && len(md.Segments) > 0 {
+			return md
+		}
+	}
+	return nil
+}
+
+// payloadRange is the chunks that encode one payload of a collection, and the hash of it
+type payloadRange struct {
+	first, last int
+	sum         string
+}
+
+// payloadRanges returns the chunks of each payload of a collection with appended data, the
+// first payload first
+func payloadRanges(md *file.Metadata) []payloadRange {
+	segments := slices.Clone(md.Segments)
+	sort.Slice(segments, func(i, j int) bool { return segments[i].FirstChunk < segments[j].FirstChunk })
+	ranges := []payloadRange{{first: 1, last: segments[0].FirstChunk - 1, sum: md.PayloadSHA256}}
+	for _, segment := range segments {
+		ranges = append(ranges, payloadRange{first: segment.FirstChunk, last: segment.FirstChunk + segment.Chunks - 1, sum: segment.PayloadSHA256})
+	}
+	return ranges
+}
+
+// decodeSegments restores every payload of collections with appended data to the output
+// directory in turn, each from its own chunks, and checks it against its hash. Any passphrase,
+// padding, or hidden volume is in the first payload, which is all that is decoded with a
+// hidden key. It returns the pad that decoded the last payload.
+func decodeSegments(ctx context.Context, cfg DecodeConfig, collections []file.Collection, md *file.Metadata, macs []*file.ChunkMACs,
+	manifest *file.RestoreManifest, counter *resultCounter) (*pad.Pad, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if cfg.OutputTar {
+		err := fmt.Errorf("the collections hold data appended after they were encoded, so they can only be decoded to an output directory, not as a TAR")
+		log.Error(err)
+		return nil, err
+	}
+
+	ranges := payloadRanges(md)
+	if len(cfg.HiddenKey) > 0 {
+		ranges = ranges[:1]
+	}
+	var p *pad.Pad
+	for i, r := range ranges {
+		log.Infof("Restoring payload %d of %d, from chunks %d to %d", i+1, len(ranges), r.first, r.last)
+
+		// Files of a later payload replace those restored from an earlier one
+		if i > 0 && manifest != nil {
+			manifest.Forget()
+		}
+
+		var err error
+		p, err = decodeChunks(ctx, cfg, collections, macs, counter, r.first, r.last, func(stream io.Reader) error {
+			payloadHash := sha256.New()
+			payload := io.TeeReader(stream, payloadHash)
+			var err error
+			output := payload
+			if i == 0 {
+				if output, err = file.UnmaskStream(ctx, output, cfg.Passphrase); err != nil {
+					return err
+				}
+				if len(cfg.HiddenKey) > 0 {
+					output, err = file.RevealHidden(ctx, output, cfg.HiddenKey)
+				} else {
+					output, err = file.UnpadStream(ctx, output)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			unpadded := output
+			if cfg.Compression.effective() != CompressionNone {
+				if output, err = file.DecompressStreamToStream(ctx, output); err != nil {
+					return fmt.Errorf("failed to create decompression stream: %w", err)
+				}
+			}
+			undeduped, err := file.UndedupStream(ctx, output)
+			if err != nil {
+				return err
+			}
+			defer undeduped.Close()
+			output = undeduped
+			if cfg.SizeOnly {
+				_, err = io.Copy(io.Discard, output)
+			} else {
+				err = file.DeserializeDirectoryWithFilter(ctx, cfg.OutputDir, output, false, manifest, cfg.Filter)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to deserialize directory: %w", err)
+			}
+			if _, err := io.Copy(io.Discard, unpadded); err != nil {
+				return err
+			}
+			if _, err := io.Copy(io.Discard, payload); err != nil {
+				return err
+			}
+			if sum := hex.EncodeToString(payloadHash.Sum(nil)); r.sum != "" && sum != r.sum {
+				return fmt.Errorf("decoded data has SHA-256 %s, but payload %d was encoded from data with SHA-256 %s: %w", sum, i+1, r.sum, ErrChecksumMismatch)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Error(fmt.Errorf("decoding failed: %w", err))
+			return nil, fmt.Errorf("decoding failed: %w", err)
+		}
+	}
+
+	if md.PayloadSHA256 != "" {
+		log.Infof("Decoded data matches the SHA-256 recorded for each of the %d payloads", len(ranges))
+	}
+	return p, nil
+}
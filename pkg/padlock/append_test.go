@@ -0,0 +1,236 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// writeFiles writes files, by path relative to dir, with the given contents
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+}
+
+// TestAppendRoundTrip checks that data appended to collections, as TARs or as directories,
+// continues their chunk numbering and decodes along with what they held, later files replacing
+// earlier ones of the same name
+func TestAppendRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	for _, archive := range []ArchiveFormat{ArchiveTar, ""} {
+		t.Run("archive="+string(archive), func(t *testing.T) {
+			tempDir := t.TempDir()
+			inputDir := filepath.Join(tempDir, "input")
+			encodeDir := filepath.Join(tempDir, "encoded")
+			writeFiles(t, inputDir, map[string]string{"a.txt": "first", "keep.txt": strings.Repeat("kept ", 500)})
+
+			cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(encodeDir), WithScheme(2, 3), WithFormat(FormatBin),
+				WithChunkSize(1024), WithArchive(archive), WithRNG(pad.NewDefaultRand(ctx)))
+			if err != nil {
+				t.Fatalf("NewEncodeConfig failed: %v", err)
+			}
+			if err := EncodeDirectory(ctx, cfg); err != nil {
+				t.Fatalf("Failed to encode: %v", err)
+			}
+			collections, _, err := file.FindCollections(ctx, encodeDir)
+			if err != nil {
+				t.Fatalf("Failed to find collections: %v", err)
+			}
+			before, err := file.ReadMetadata(ctx, collections[0], nil)
+			if err != nil {
+				t.Fatalf("Failed to read metadata: %v", err)
+			}
+
+			// Append twice, changing a file to contents of the same size, and adding others
+			appendDir := filepath.Join(tempDir, "append")
+			for i, files := range []map[string]string{{"a.txt": "secnd", "b.txt": "new"}, {"a.txt": "third", "c.txt": "newer"}} {
+				os.RemoveAll(appendDir)
+				writeFiles(t, appendDir, files)
+				cfg, err := NewEncodeConfig(WithInput(appendDir), WithOutputs(encodeDir), WithAppend(), WithChunkSize(4096),
+					WithRNG(pad.NewDefaultRand(ctx)))
+				if err != nil {
+					t.Fatalf("NewEncodeConfig failed: %v", err)
+				}
+				if err := EncodeDirectory(ctx, cfg); err != nil {
+					t.Fatalf("Failed to append %d: %v", i+1, err)
+				}
+			}
+
+			collections, _, err = file.FindCollections(ctx, encodeDir)
+			if err != nil || len(collections) != 3 {
+				t.Fatalf("Expected the 3 collections to remain, got %d (%v)", len(collections), err)
+			}
+			md, err := file.ReadMetadata(ctx, collections[0], nil)
+			if err != nil {
+				t.Fatalf("Failed to read metadata: %v", err)
+			}
+			if len(md.Segments) != 2 || md.Segments[0].FirstChunk != before.Chunks+1 || md.Session != before.Session || md.ChunkSize != before.ChunkSize {
+				t.Fatalf("Expected 2 segments after chunk %d of session %s, got %+v", before.Chunks, before.Session, md)
+			}
+			last := md.Segments[1]
+			if last.FirstChunk != md.Segments[0].FirstChunk+md.Segments[0].Chunks || md.Chunks != last.FirstChunk+last.Chunks-1 {
+				t.Errorf("Expected the chunks to be numbered on from each payload, got %+v", md)
+			}
+			numbers, err := file.ChunkNumbers(collections[0])
+			if err != nil || len(numbers) != md.Chunks || numbers[len(numbers)-1] != md.Chunks {
+				t.Errorf("Expected chunks 1 to %d in the collection, got %v (%v)", md.Chunks, numbers, err)
+			}
+
+			// Any two collections restore the files of every payload
+			decodeDir := filepath.Join(tempDir, "decoded")
+			decodeCfg, err := NewDecodeConfig(WithInputs(collections[0].Path, collections[2].Path), WithOutput(decodeDir))
+			if err != nil {
+				t.Fatalf("NewDecodeConfig failed: %v", err)
+			}
+			if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+				t.Fatalf("Failed to decode: %v", err)
+			}
+			expected := map[string]string{"a.txt": "third", "b.txt": "new", "c.txt": "newer", "keep.txt": strings.Repeat("kept ", 500)}
+			for name, content := range expected {
+				if got, err := os.ReadFile(filepath.Join(decodeDir, name)); err != nil || string(got) != content {
+					t.Errorf("Expected %s to be restored as %q, got %q (%v)", name, content, got, err)
+				}
+			}
+		})
+	}
+}
+
+// TestAppendRollBack checks that an append that fails leaves the collections as they were
+func TestAppendRollBack(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	for _, archive := range []ArchiveFormat{ArchiveTar, ""} {
+		t.Run("archive="+string(archive), func(t *testing.T) {
+			tempDir := t.TempDir()
+			inputDir := filepath.Join(tempDir, "input")
+			encodeDir := filepath.Join(tempDir, "encoded")
+			writeFiles(t, inputDir, map[string]string{"a.txt": "first"})
+			cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(encodeDir), WithScheme(2, 3), WithFormat(FormatBin),
+				WithChunkSize(1024), WithArchive(archive), WithRNG(pad.NewDefaultRand(ctx)))
+			if err != nil {
+				t.Fatalf("NewEncodeConfig failed: %v", err)
+			}
+			if err := EncodeDirectory(ctx, cfg); err != nil {
+				t.Fatalf("Failed to encode: %v", err)
+			}
+			snapshot := func() map[string]int64 {
+				sizes := make(map[string]int64)
+				filepath.Walk(encodeDir, func(path string, info os.FileInfo, err error) error {
+					if err == nil && !info.IsDir() {
+						sizes[path] = info.Size()
+					}
+					return nil
+				})
+				return sizes
+			}
+			before := snapshot()
+
+			appendDir := filepath.Join(tempDir, "append")
+			writeFiles(t, appendDir, map[string]string{"b.txt": strings.Repeat("appended ", 2000)})
+			cfg, err = NewEncodeConfig(WithInput(appendDir), WithOutputs(encodeDir), WithAppend(), WithCompression(CompressionNone, 0),
+				WithRNG(&failingRNG{RNG: pad.NewDefaultRand(ctx), reads: 6}))
+			if err != nil {
+				t.Fatalf("NewEncodeConfig failed: %v", err)
+			}
+			if err := EncodeDirectory(ctx, cfg); err == nil || !strings.Contains(err.Error(), "entropy source failed") {
+				t.Fatalf("Expected the append to fail, got %v", err)
+			}
+
+			after := snapshot()
+			if len(after) != len(before) {
+				t.Errorf("Expected %d files after the failed append, got %d: %v", len(before), len(after), after)
+			}
+			for path, size := range before {
+				if after[path] != size {
+					t.Errorf("Expected %s to be left as it was", path)
+				}
+			}
+			decodeDir := filepath.Join(tempDir, "decoded")
+			if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputDir: decodeDir, Compression: CompressionGzip}); err != nil {
+				t.Fatalf("Failed to decode after the failed append: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(decodeDir, "b.txt")); !os.IsNotExist(err) {
+				t.Errorf("Expected nothing of the failed append to be restored")
+			}
+		})
+	}
+}
+
+// TestAppendRefused checks that data isn't appended to collections it couldn't be decoded
+// from, or when there are none
+func TestAppendRefused(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	writeFiles(t, inputDir, map[string]string{"a.txt": "first"})
+
+	appendTo := func(encodeDir string) error {
+		cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(encodeDir), WithAppend(), WithRNG(pad.NewDefaultRand(ctx)))
+		if err != nil {
+			t.Fatalf("NewEncodeConfig failed: %v", err)
+		}
+		return EncodeDirectory(ctx, cfg)
+	}
+	os.MkdirAll(filepath.Join(tempDir, "empty"), 0755)
+	if err := appendTo(filepath.Join(tempDir, "empty")); err == nil || !strings.Contains(err.Error(), "no collections") {
+		t.Errorf("Expected an append without collections to fail, got %v", err)
+	}
+
+	// Collections with a chunk index
+	indexedDir := filepath.Join(tempDir, "indexed")
+	cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(indexedDir), WithChunkIndex(), WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if err := appendTo(indexedDir); err == nil || !strings.Contains(err.Error(), "chunk index") {
+		t.Errorf("Expected an append to collections with a chunk index to fail, got %v", err)
+	}
+
+	// A missing collection
+	collections, _, err := file.FindCollections(ctx, indexedDir)
+	if err != nil {
+		t.Fatalf("Failed to find collections: %v", err)
+	}
+	plainDir := filepath.Join(tempDir, "plain")
+	cfg, err = NewEncodeConfig(WithInput(inputDir), WithOutputs(plainDir), WithScheme(2, 3), WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if collections, _, err = file.FindCollections(ctx, plainDir); err != nil {
+		t.Fatalf("Failed to find collections: %v", err)
+	}
+	os.Remove(collections[1].Path)
+	if err := appendTo(plainDir); err == nil || !strings.Contains(err.Error(), "every collection") {
+		t.Errorf("Expected an append with a collection missing to fail, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+const (
+	// autoCompressionSample is how much of the start of the serialized input is compressed to
+	// decide whether compressing the whole input is worthwhile
+	autoCompressionSample = 1024 * 1024
+
+	// autoCompressionRatio is the largest compressed to original size ratio of the sample for
+	// which the input is compressed. Above it, compression costs CPU for little or no saving.
+	autoCompressionRatio = 0.95
+)
+
+// resolveAutoCompression decides the compression for a stream encoded with CompressionAuto by
+// compressing a sample from its start with gzip at its fastest level. It returns gzip if the
+// sample compresses, and none if the input appears to be already compressed media such as
+// JPEGs or MP4s. The returned stream must be read instead of stream, since the sample is
+// buffered from it.
+func resolveAutoCompression(ctx context.Context, stream io.Reader) (io.Reader, Compression, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	buffered := bufio.NewReaderSize(stream, autoCompressionSample)
+	sample, err := buffered.Peek(autoCompressionSample)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		log.Error(fmt.Errorf("failed to sample input: %w", err))
+		return nil, CompressionNone, fmt.Errorf("failed to sample input: %w", err)
+	}
+
+	ratio, err := sampleCompressionRatio(sample)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to compress input sample: %w", err))
+		return nil, CompressionNone, fmt.Errorf("failed to compress input sample: %w", err)
+	}
+	if ratio > autoCompressionRatio {
+		log.Infof("Input does not compress (sample of %s compresses to %.0f%%), encoding without compression",
+			FormatByteSize(int64(len(sample))), ratio*100)
+		return buffered, CompressionNone, nil
+	}
+	log.Debugf("Input sample of %d bytes compresses to %.0f%%, using gzip", len(sample), ratio*100)
+	return buffered, CompressionGzip, nil
+}
+
+// sampleCompressionRatio returns the size of sample after fast gzip compression, relative to
+// its original size
+func sampleCompressionRatio(sample []byte) (float64, error) {
+	if len(sample) == 0 {
+		return 0, nil
+	}
+	var compressed byteCount
+	gzw, err := gzip.NewWriterLevel(&compressed, gzip.BestSpeed)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := gzw.Write(sample); err != nil {
+		return 0, err
+	}
+	if err := gzw.Close(); err != nil {
+		return 0, err
+	}
+	return float64(compressed) / float64(len(sample)), nil
+}
+
+// byteCount counts the bytes written to it and discards them
+type byteCount int64
+
+func (c *byteCount) Write(p []byte) (int, error) {
+	*c += byteCount(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestResolveAutoCompression(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	random := make([]byte, 3*autoCompressionSample/2)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatalf("Failed to generate random data: %v", err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want Compression
+	}{
+		{"text", bytes.Repeat([]byte("compressible "), 10000), CompressionGzip},
+		{"random", random, CompressionNone},
+		{"empty", nil, CompressionGzip},
+	}
+	for _, tt := range tests {
+		stream, got, err := resolveAutoCompression(ctx, bytes.NewReader(tt.data))
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %v, %v; want %v", tt.name, got, err, tt.want)
+			continue
+		}
+		// The sample is not lost from the stream
+		data, err := io.ReadAll(stream)
+		if err != nil || !bytes.Equal(data, tt.data) {
+			t.Errorf("%s: stream changed after sampling (%v)", tt.name, err)
+		}
+	}
+}
+
+func TestEncodeAutoCompression(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-autocompress-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Already compressed media, here random data, is encoded without compression
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	media := make([]byte, 200*1024)
+	if _, err := rand.Read(media); err != nil {
+		t.Fatalf("Failed to generate random data: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "video.mp4"), media, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	outputDir := filepath.Join(tempDir, "output")
+	var result Result
+	cfg := EncodeConfig{
+		InputDir:    inputDir,
+		OutputDir:   outputDir,
+		N:           2,
+		K:           2,
+		Format:      FormatBin,
+		ChunkSize:   64 * 1024,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionAuto,
+		Result:      &result,
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if result.Compression != "none" || result.CompressedBytes != 0 {
+		t.Errorf("Expected the encode to skip compression, got %+v", result)
+	}
+
+	// The decision is recorded in the metadata
+	md, err := file.ReadMetadata(ctx, file.Collection{Name: "2A2", Path: filepath.Join(outputDir, "2A2")}, nil)
+	if err != nil || md.Compression != "none" || !md.CompressionAuto || md.CompressionLevel != 0 {
+		t.Errorf("Unexpected metadata: %+v, %v", md, err)
+	}
+
+	decodedDir := filepath.Join(tempDir, "decoded")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDirs: []string{outputDir}, OutputDir: decodedDir, Compression: CompressionGzip}); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	decoded, err := os.ReadFile(filepath.Join(decodedDir, "video.mp4"))
+	if err != nil || !bytes.Equal(decoded, media) {
+		t.Errorf("Decoding did not reproduce the input (%v)", err)
+	}
+
+	// A size matrix makes the same choice
+	matrix, err := EstimateSizeMatrix(ctx, cfg, []Scheme{{K: 2, N: 3}})
+	if err != nil || matrix.CompressedInputSize != 0 || matrix.InputSize != result.InputBytes {
+		t.Errorf("Unexpected size matrix: %+v, %v", matrix, err)
+	}
+}
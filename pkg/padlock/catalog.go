@@ -0,0 +1,369 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// CatalogVersion is the version of the catalog document layout written by WriteCatalog.
+const CatalogVersion = 1
+
+// Catalog is a single document describing a whole share distribution: the threshold
+// parameters and, for every collection, where it was written and how to recognize it.
+//
+// A catalog contains no share data and cannot be used to reconstruct anything, so it is
+// intended to be kept by the coordinator of a distribution. When written with a key it
+// carries an HMAC-SHA256 over its contents, allowing later tampering to be detected.
+type Catalog struct {
+	Version     int            `json:"version"`
+	Created     time.Time      `json:"created"`
+	Copies      int            `json:"copies"`
+	Required    int            `json:"required"`
+	Format      string         `json:"format"`
+	Compression string         `json:"compression"`
+	Level       int            `json:"compression_level,omitempty"`
+	ReviewBy    time.Time      `json:"review_by,omitzero"`
+	Collections []CatalogEntry `json:"collections"`
+	HMAC        string         `json:"hmac,omitempty"`
+}
+
+// CatalogEntry describes one collection within a Catalog.
+type CatalogEntry struct {
+	Name        string `json:"name"`                  // Collection name (e.g., "3A5")
+	StoredName  string `json:"stored_name,omitempty"` // Stealth name the collection is stored under, if any
+	Label       string `json:"label,omitempty"`       // Free-form label supplied at encode time
+	Custodian   string `json:"custodian,omitempty"`   // Name of the designated custodian
+	Contact     string `json:"contact,omitempty"`     // How to reach the custodian
+	Notes       string `json:"notes,omitempty"`       // Free-form notes supplied at encode time
+	Destination string `json:"destination"`           // Directory, TAR file, or URL the collection was delivered to
+	Chunks      int    `json:"chunks"`                // Number of chunks in the collection
+	Size        int64  `json:"size"`                  // Bytes occupied by the collection on disk
+	Fingerprint string `json:"fingerprint"`           // SHA-256 over the collection's chunk payloads, in order
+}
+
+// String returns a short description of a compression mode for reports and catalogs.
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	case CompressionAuto:
+		return "auto"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(c))
+	}
+}
+
+// effective returns the compression an encode actually applies: anything but a known
+// algorithm is encoded without compression. CompressionAuto is resolved by the encode itself
+// once it has sampled the input.
+func (c Compression) effective() Compression {
+	if c == CompressionGzip || c == CompressionZstd {
+		return c
+	}
+	return CompressionNone
+}
+
+// ParseCompression parses a compression mode written as "none" or "ALGORITHM[:LEVEL]", e.g.
+// "gzip", "auto", or "zstd:19", and returns the mode and level. A missing level is returned as 0,
+// which selects the algorithm's default. The algorithm must be available in this build.
+func ParseCompression(s string) (Compression, int, error) {
+	name, levelStr, hasLevel := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+	var c Compression
+	switch name {
+	case "none":
+		if hasLevel {
+			return 0, 0, fmt.Errorf("compression none doesn't take a level")
+		}
+		return CompressionNone, 0, nil
+	case "gzip":
+		c = CompressionGzip
+	case "zstd":
+		c = CompressionZstd
+	case "auto":
+		// The level applies to gzip, if the input turns out to compress
+		c = CompressionAuto
+		name = "gzip"
+	default:
+		return 0, 0, fmt.Errorf("unknown compression %q: expected none, auto[:LEVEL], gzip[:LEVEL], or zstd[:LEVEL]", s)
+	}
+
+	compressor, err := file.LookupCompressor(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	level := 0
+	if hasLevel {
+		level, err = strconv.Atoi(levelStr)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid compression level %q", levelStr)
+		}
+		if err := compressor.CheckLevel(level); err != nil {
+			return 0, 0, err
+		}
+	}
+	return c, level, nil
+}
+
+// ParseCompressionLevel parses a level for compression c, given as a number in the
+// algorithm's range or as "fast", "best", or "default". "default" is returned as 0.
+func ParseCompressionLevel(c Compression, s string) (int, error) {
+	name := c.String()
+	if c == CompressionAuto {
+		name = "gzip"
+	} else if c.effective() == CompressionNone {
+		return 0, fmt.Errorf("compression %s doesn't take a level", c)
+	}
+	compressor, err := file.LookupCompressor(name)
+	if err != nil {
+		return 0, err
+	}
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "fast":
+		return compressor.FastLevel, nil
+	case "best":
+		return compressor.BestLevel, nil
+	case "default":
+		return 0, nil
+	}
+	level, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid compression level %q: expected a number, fast, best, or default", s)
+	}
+	if err := compressor.CheckLevel(level); err != nil {
+		return 0, err
+	}
+	return level, nil
+}
+
+// compressionLevel returns the compression level an encode records in its metadata: the level
+// actually used, or cfg.CompressionLevel as given for an input stream compressed by the caller
+func (cfg EncodeConfig) compressionLevel() int {
+	if cfg.InputStream != nil {
+		return cfg.CompressionLevel
+	}
+	if cfg.Compression.effective() == CompressionNone {
+		return 0
+	}
+	compressor, err := file.LookupCompressor(cfg.Compression.String())
+	if err != nil {
+		return cfg.CompressionLevel
+	}
+	return compressor.ResolveLevel(cfg.CompressionLevel)
+}
+
+// BuildCatalog reads back every collection of a finished encode and describes it in a Catalog.
+// cfg.Labels and cfg.Custodians, if set, are matched to collections by position.
+func BuildCatalog(ctx context.Context, cfg EncodeConfig, collections []file.Collection) (*Catalog, error) {
+	log := trace.FromContext(ctx).WithPrefix("catalog")
+
+	catalog := &Catalog{
+		Version:     CatalogVersion,
+		Created:     time.Now().UTC().Truncate(time.Second),
+		Copies:      len(collections),
+		Required:    cfg.K,
+		Format:      cfg.formatDescription(),
+		Compression: cfg.Compression.String(),
+		Level:       cfg.compressionLevel(),
+		ReviewBy:    cfg.ReviewBy,
+	}
+
+	for i, coll := range collections {
+		entry, err := catalogEntry(ctx, coll)
+		if err != nil {
+			log.Error(fmt.Errorf("failed to catalog collection %s: %w", coll.Name, err))
+			return nil, fmt.Errorf("failed to catalog collection %s: %w", coll.Name, err)
+		}
+		if i < len(cfg.Labels) {
+			entry.Label = cfg.Labels[i]
+		}
+		if i < len(cfg.Notes) {
+			entry.Notes = cfg.Notes[i]
+		}
+		if i < len(cfg.Custodians) {
+			entry.Custodian = cfg.Custodians[i].Name
+			entry.Contact = cfg.Custodians[i].Contact
+		}
+		log.Debugf("Cataloged collection %s: %d chunks, %s, fingerprint %s", entry.Name, entry.Chunks, FormatByteSize(entry.Size), entry.Fingerprint)
+		catalog.Collections = append(catalog.Collections, entry)
+	}
+
+	return catalog, nil
+}
+
+// catalogEntry fingerprints a single collection by reading every chunk back from disk
+func catalogEntry(ctx context.Context, coll file.Collection) (CatalogEntry, error) {
+	entry := CatalogEntry{
+		Name:        coll.Name,
+		StoredName:  coll.StoredName,
+		Destination: coll.Path,
+	}
+	if abs, err := filepath.Abs(coll.Path); err == nil {
+		entry.Destination = abs
+	}
+
+	size, err := collectionDiskSize(coll)
+	if err != nil {
+		return entry, err
+	}
+	entry.Size = size
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	h := sha256.New()
+	for chunk := range file.NewCollectionReader(coll).Chunks(ctx) {
+		if chunk.Err != nil {
+			return entry, chunk.Err
+		}
+		h.Write(chunk.Data)
+		entry.Chunks++
+	}
+	entry.Fingerprint = hex.EncodeToString(h.Sum(nil))
+
+	return entry, nil
+}
+
+// collectionDiskSize returns the size of a collection on disk, including every volume of a
+// collection split into volumes
+func collectionDiskSize(coll file.Collection) (int64, error) {
+	total, err := diskSize(coll.Path)
+	for _, volume := range coll.Volumes {
+		if err != nil {
+			break
+		}
+		var size int64
+		size, err = diskSize(volume)
+		total += size
+	}
+	return total, err
+}
+
+// diskSize returns the size of a file, or the total size of the regular files below a directory,
+// not counting the lock file of the operation writing them
+func diskSize(path string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && d.Name() != file.LockFileName {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// Sign sets the catalog's HMAC using key. An empty key leaves the catalog unsigned.
+func (c *Catalog) Sign(key []byte) error {
+	c.HMAC = ""
+	if len(key) == 0 {
+		return nil
+	}
+	mac, err := c.computeHMAC(key)
+	if err != nil {
+		return err
+	}
+	c.HMAC = mac
+	return nil
+}
+
+// Verify checks the catalog's HMAC against key.
+func (c *Catalog) Verify(key []byte) error {
+	if c.HMAC == "" {
+		return fmt.Errorf("catalog is not signed")
+	}
+	want, err := c.computeHMAC(key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(want), []byte(c.HMAC)) {
+		return fmt.Errorf("catalog HMAC mismatch: the catalog was modified or the key is wrong: %w", ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// computeHMAC returns the hex HMAC-SHA256 of the catalog's JSON encoding with the HMAC field cleared
+func (c *Catalog) computeHMAC(key []byte) (string, error) {
+	unsigned := *c
+	unsigned.HMAC = ""
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode catalog: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// WriteCatalog signs the catalog with key (if non-empty) and writes it to path as indented JSON.
+func WriteCatalog(ctx context.Context, path string, catalog *Catalog, key []byte) error {
+	log := trace.FromContext(ctx).WithPrefix("catalog")
+
+	if err := catalog.Sign(key); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode catalog: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		log.Error(fmt.Errorf("failed to write catalog %s: %w", path, err))
+		return fmt.Errorf("failed to write catalog %s: %w", path, err)
+	}
+
+	log.Infof("Wrote catalog of %d collections to %s", len(catalog.Collections), path)
+	return nil
+}
+
+// ReadCatalog loads a catalog from path. If key is non-empty the catalog's HMAC is verified
+// and an error is returned when it is missing or does not match.
+func ReadCatalog(ctx context.Context, path string, key []byte) (*Catalog, error) {
+	log := trace.FromContext(ctx).WithPrefix("catalog")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog %s: %w", path, err)
+	}
+
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog %s: %w", path, err)
+	}
+	if catalog.Version > CatalogVersion {
+		return nil, fmt.Errorf("catalog %s has unsupported version %d", path, catalog.Version)
+	}
+
+	if len(key) > 0 {
+		if err := catalog.Verify(key); err != nil {
+			log.Error(fmt.Errorf("%s: %w", path, err))
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		log.Debugf("Catalog HMAC verified")
+	}
+
+	return &catalog, nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestEncodeWritesCatalog(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-catalog-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	outputDir := filepath.Join(tempDir, "output")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte("catalog test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	catalogPath := filepath.Join(tempDir, "catalog.json")
+	key := []byte("coordinator secret")
+
+	cfg := EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          outputDir,
+		N:                  3,
+		K:                  2,
+		Format:             FormatBin,
+		ChunkSize:          64,
+		RNG:                pad.NewDefaultRand(ctx),
+		ClearIfNotEmpty:    true,
+		Compression:        CompressionNone,
+		ArchiveCollections: true,
+		CatalogPath:        catalogPath,
+		CatalogKey:         key,
+		Labels:             []string{"home safe", "bank", "attorney"},
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	catalog, err := ReadCatalog(ctx, catalogPath, key)
+	if err != nil {
+		t.Fatalf("Failed to read catalog: %v", err)
+	}
+	if catalog.Copies != 3 || catalog.Required != 2 || len(catalog.Collections) != 3 {
+		t.Fatalf("Unexpected catalog parameters: copies=%d required=%d collections=%d",
+			catalog.Copies, catalog.Required, len(catalog.Collections))
+	}
+
+	seen := make(map[string]bool)
+	for i, entry := range catalog.Collections {
+		if entry.Label != cfg.Labels[i] {
+			t.Errorf("Collection %s: expected label %q, got %q", entry.Name, cfg.Labels[i], entry.Label)
+		}
+		if _, err := os.Stat(entry.Destination); err != nil {
+			t.Errorf("Collection %s: destination %s not found: %v", entry.Name, entry.Destination, err)
+		}
+		if entry.Chunks == 0 || entry.Size == 0 || len(entry.Fingerprint) != 64 {
+			t.Errorf("Collection %s: incomplete entry %+v", entry.Name, entry)
+		}
+		if seen[entry.Fingerprint] {
+			t.Errorf("Collection %s: fingerprint duplicates another collection", entry.Name)
+		}
+		seen[entry.Fingerprint] = true
+	}
+
+	// A wrong key must be rejected
+	if _, err := ReadCatalog(ctx, catalogPath, []byte("wrong key")); err == nil {
+		t.Errorf("Expected catalog verification to fail with the wrong key")
+	}
+
+	// Any modification must invalidate the HMAC
+	catalog.Collections[0].Label = "tampered"
+	if err := catalog.Verify(key); err == nil {
+		t.Errorf("Expected catalog verification to fail after modification")
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  Compression
+		level int
+	}{
+		{"none", CompressionNone, 0},
+		{"gzip", CompressionGzip, 0},
+		{" GZIP:9 ", CompressionGzip, 9},
+		{"gzip:1", CompressionGzip, 1},
+	}
+	for _, tt := range tests {
+		c, level, err := ParseCompression(tt.in)
+		if err != nil || c != tt.want || level != tt.level {
+			t.Errorf("ParseCompression(%q) = %v, %d, %v; want %v, %d", tt.in, c, level, err, tt.want, tt.level)
+		}
+	}
+	for _, in := range []string{"", "lzma", "none:1", "gzip:x", "gzip:10"} {
+		if _, _, err := ParseCompression(in); err == nil {
+			t.Errorf("Expected ParseCompression(%q) to fail", in)
+		}
+	}
+
+	levels := map[string]int{"fast": 1, "Best": 9, "default": 0, " 4 ": 4}
+	for in, want := range levels {
+		if level, err := ParseCompressionLevel(CompressionGzip, in); err != nil || level != want {
+			t.Errorf("ParseCompressionLevel(gzip, %q) = %d, %v; want %d", in, level, err, want)
+		}
+	}
+	if _, err := ParseCompressionLevel(CompressionGzip, "10"); err == nil {
+		t.Errorf("Expected an out of range gzip level to fail")
+	}
+	if _, err := ParseCompressionLevel(CompressionNone, "best"); err == nil {
+		t.Errorf("Expected a level without compression to fail")
+	}
+}
+
+func TestCompressionLevelRecorded(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-compression-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(strings.Repeat("level ", 1000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	for _, level := range []int{0, 1, 9} {
+		outputDir := filepath.Join(tempDir, fmt.Sprintf("level%d", level))
+		catalogPath := outputDir + ".json"
+		cfg := EncodeConfig{
+			InputDir:         inputDir,
+			OutputDir:        outputDir,
+			N:                2,
+			K:                2,
+			Format:           FormatBin,
+			ChunkSize:        1024,
+			RNG:              pad.NewDefaultRand(ctx),
+			Compression:      CompressionGzip,
+			CompressionLevel: level,
+			CatalogPath:      catalogPath,
+		}
+		if err := EncodeDirectory(ctx, cfg); err != nil {
+			t.Fatalf("Failed to encode at level %d: %v", level, err)
+		}
+
+		// The default level is recorded as the level gzip actually uses
+		want := level
+		if level == 0 {
+			want = 6
+		}
+		md, err := file.ReadMetadata(ctx, file.Collection{Name: "2A2", Path: filepath.Join(outputDir, "2A2")}, nil)
+		if err != nil || md.Compression != "gzip" || md.CompressionLevel != want {
+			t.Errorf("Level %d: unexpected metadata %+v, %v", level, md, err)
+		}
+		catalog, err := ReadCatalog(ctx, catalogPath, nil)
+		if err != nil || catalog.Level != want {
+			t.Errorf("Level %d: unexpected catalog level %v, %v", level, catalog, err)
+		}
+
+		decodeCfg := DecodeConfig{
+			InputDirs:   []string{outputDir},
+			OutputDir:   filepath.Join(tempDir, fmt.Sprintf("decoded%d", level)),
+			Compression: CompressionGzip,
+		}
+		if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+			t.Errorf("Failed to decode level %d: %v", level, err)
+		}
+	}
+}
+
+func TestEncodeWithZstd(t *testing.T) {
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	content := strings.Repeat("zstd level ", 1000)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	compression, level, err := ParseCompression("zstd:19")
+	if err != nil || compression != CompressionZstd || level != 19 {
+		t.Fatalf("Unexpected parse of zstd:19: %v, %d, %v", compression, level, err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	outputDir := filepath.Join(tempDir, "output")
+	cfg := EncodeConfig{
+		InputDir:         inputDir,
+		OutputDir:        outputDir,
+		N:                2,
+		K:                2,
+		Format:           FormatBin,
+		ChunkSize:        1024,
+		RNG:              pad.NewDefaultRand(ctx),
+		Compression:      compression,
+		CompressionLevel: level,
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode with zstd: %v", err)
+	}
+	md, err := file.ReadMetadata(ctx, file.Collection{Name: "2A2", Path: filepath.Join(outputDir, "2A2")}, nil)
+	if err != nil || md.Compression != "zstd" || md.CompressionLevel != 19 {
+		t.Errorf("Unexpected metadata %+v, %v", md, err)
+	}
+
+	// Decode detects zstd from the data, as it does gzip
+	decodedDir := filepath.Join(tempDir, "decoded")
+	decodeCfg := DecodeConfig{
+		InputDirs:   []string{outputDir},
+		OutputDir:   decodedDir,
+		Compression: CompressionGzip,
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode zstd collections: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(decodedDir, "test.txt")); err != nil || string(got) != content {
+		t.Errorf("Expected the data to be restored, got %d bytes (%v)", len(got), err)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// ChunkSizeAuto as EncodeConfig.ChunkSize chooses the chunk size from the size of the input,
+// so that each collection has a number of chunks within EncodeConfig.ChunkCount. The choice is
+// made when encoding starts and recorded in collection metadata.
+const ChunkSizeAuto = -1
+
+const (
+	// minAutoChunkSize and maxAutoChunkSize bound the chunk size ChunkSizeAuto chooses, so
+	// that tiny inputs don't produce chunks of a few bytes and huge ones chunks that can't
+	// be held in memory
+	minAutoChunkSize = 64 << 10
+	maxAutoChunkSize = 64 << 20
+
+	// autoChunkSizeAlign is the multiple chosen chunk sizes are rounded up to
+	autoChunkSizeAlign = 4 << 10
+)
+
+// ChunkRange is the number of chunks per collection that ChunkSizeAuto aims for
+type ChunkRange struct {
+	Min int // Fewest chunks wanted in each collection
+	Max int // Most chunks wanted in each collection
+}
+
+// DefaultChunkCount is the chunk count range ChunkSizeAuto aims for unless another is given
+var DefaultChunkCount = ChunkRange{Min: 16, Max: 1024}
+
+// String formats the range as "MIN-MAX"
+func (r ChunkRange) String() string {
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// check reports why the range can't be aimed for, if it can't
+func (r ChunkRange) check() error {
+	if r.Min < 1 || r.Max < r.Min {
+		return fmt.Errorf("invalid chunk count range %s: need 1 <= MIN <= MAX", r)
+	}
+	return nil
+}
+
+// ParseChunkRange parses a chunk count range given as "MIN-MAX"
+func ParseChunkRange(s string) (ChunkRange, error) {
+	lo, hi, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return ChunkRange{}, fmt.Errorf("invalid chunk count range %q: expected MIN-MAX", s)
+	}
+	var r ChunkRange
+	var err error
+	if r.Min, err = strconv.Atoi(strings.TrimSpace(lo)); err != nil {
+		return ChunkRange{}, fmt.Errorf("invalid chunk count range %q: expected MIN-MAX", s)
+	}
+	if r.Max, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+		return ChunkRange{}, fmt.Errorf("invalid chunk count range %q: expected MIN-MAX", s)
+	}
+	return r, r.check()
+}
+
+// chunkCount returns the chunk count range the encode aims for
+func (cfg *EncodeConfig) chunkCount() ChunkRange {
+	if cfg.ChunkCount == (ChunkRange{}) {
+		return DefaultChunkCount
+	}
+	return cfg.ChunkCount
+}
+
+// resolveAutoChunkSize replaces ChunkSizeAuto in cfg with a chunk size chosen from a scan of
+// the input directory. A serialized input stream can't be scanned, so it gets DefaultChunkSize.
+func resolveAutoChunkSize(ctx context.Context, cfg *EncodeConfig) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if cfg.ChunkSize != ChunkSizeAuto {
+		return nil
+	}
+	count := cfg.chunkCount()
+	if err := count.check(); err != nil {
+		return err
+	}
+	if cfg.InputStream != nil || cfg.RawInput != nil {
+		log.Infof("The size of an input stream isn't known, using the default chunk size of %s", FormatByteSize(DefaultChunkSize))
+		cfg.ChunkSize = DefaultChunkSize
+		return nil
+	}
+
+	inputBytes, err := file.EstimateDirectoriesSizeWithFilter(ctx, cfg.inputDirs(), cfg.Filter)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	chunkSize, err := autoChunkSize(cfg.sharing(), cfg.N, cfg.K, inputBytes, count)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	log.Infof("Chose a chunk size of %s for about %s of input, aiming for %s chunks per collection",
+		FormatByteSize(int64(chunkSize)), FormatByteSize(inputBytes), count)
+	cfg.ChunkSize = chunkSize
+	cfg.autoChunkSize = true
+	return nil
+}
+
+// autoChunkSize returns the chunk size that gives each collection of a K-of-N encode of
+// inputBytes of serialized input a number of chunks within count. DefaultChunkSize is kept if
+// it does; otherwise the size is the nearest to it that does, within the sizes ChunkSizeAuto
+// may choose. Compression is not known in advance, so inputBytes is taken as it is, which can
+// only make the chunks fewer than intended.
+func autoChunkSize(sharing pad.Sharing, n, k int, inputBytes int64, count ChunkRange) (int, error) {
+	// Every collection holds inputBytes once per piece it is given, whatever the chunk size
+	collectionBytes, err := pad.EncodedCollectionSizeWith(sharing, n, k, maxAutoChunkSize, inputBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	size := int64(DefaultChunkSize)
+	if chunks := (collectionBytes + size - 1) / size; chunks > int64(count.Max) {
+		size = (collectionBytes + int64(count.Max) - 1) / int64(count.Max)
+	} else if chunks < int64(count.Min) {
+		size = collectionBytes / int64(count.Min)
+	}
+	size = min(max(size, minAutoChunkSize), maxAutoChunkSize)
+	size = (size + autoChunkSizeAlign - 1) / autoChunkSizeAlign * autoChunkSizeAlign
+
+	// Each chunk needs room for at least one byte of input per piece
+	if _, err := pad.EncodedCollectionSizeWith(sharing, n, k, int(size), inputBytes); err != nil {
+		return 0, fmt.Errorf("no automatic chunk size suits a %d-of-%d scheme: %w", k, n, err)
+	}
+	return int(size), nil
+}
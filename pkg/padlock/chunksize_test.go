@@ -0,0 +1,133 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestAutoChunkSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		n, k       int
+		inputBytes int64
+		count      ChunkRange
+		want       int
+	}{
+		{"default fits", 2, 2, 100 << 20, DefaultChunkCount, DefaultChunkSize},
+		{"tiny input", 2, 2, 10 << 10, DefaultChunkCount, minAutoChunkSize},
+		{"few chunks", 2, 2, 16 << 20, DefaultChunkCount, 1 << 20},
+		// Chunk names take the collections just past a whole number of aligned chunks
+		{"many chunks", 2, 2, 10 << 30, DefaultChunkCount, 10<<20 + autoChunkSizeAlign},
+		{"huge input", 2, 2, 1 << 40, DefaultChunkCount, maxAutoChunkSize},
+		{"narrow range", 2, 2, 100 << 20, ChunkRange{Min: 4, Max: 10}, 10<<20 + autoChunkSizeAlign},
+		// Each 3-of-5 collection is in 6 permutations, so holds the input 6 times
+		{"permutations", 5, 3, 1 << 30, DefaultChunkCount, 6<<20 + autoChunkSizeAlign},
+	}
+	for _, tt := range tests {
+		got, err := autoChunkSize(pad.OTP, tt.n, tt.k, tt.inputBytes, tt.count)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got a chunk size of %d, want %d", tt.name, got, tt.want)
+		}
+		if got%autoChunkSizeAlign != 0 {
+			t.Errorf("%s: chunk size %d is not aligned", tt.name, got)
+		}
+	}
+
+	if _, err := autoChunkSize(pad.OTP, 2, 3, 1<<20, DefaultChunkCount); err == nil {
+		t.Errorf("Expected an invalid scheme to fail")
+	}
+
+	// A Shamir collection holds the input once, however many permutations OTP would need
+	if got, err := autoChunkSize(pad.Shamir, 5, 3, 1<<30, DefaultChunkCount); err != nil || got != DefaultChunkSize {
+		t.Errorf("Got a Shamir chunk size of %d, %v", got, err)
+	}
+}
+
+func TestParseChunkRange(t *testing.T) {
+	got, err := ParseChunkRange("8-64")
+	if err != nil || got != (ChunkRange{Min: 8, Max: 64}) {
+		t.Errorf("Got %v, %v", got, err)
+	}
+	if got, err := ParseChunkRange(DefaultChunkCount.String()); err != nil || got != DefaultChunkCount {
+		t.Errorf("The default range doesn't round trip: %v, %v", got, err)
+	}
+	for _, bad := range []string{"", "8", "64-8", "0-8", "a-b"} {
+		if _, err := ParseChunkRange(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestEncodeAutoChunkSize(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	data := make([]byte, 3<<20)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("Failed to generate random data: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "data.bin"), data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// At the default chunk size the input would make only 2 chunks per collection
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	outputDir := filepath.Join(tempDir, "output")
+	var result Result
+	err := EncodeDirectory(ctx, EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          outputDir,
+		N:                  2,
+		K:                  2,
+		Format:             FormatBin,
+		ChunkSize:          ChunkSizeAuto,
+		RNG:                pad.NewDefaultRand(ctx),
+		Compression:        CompressionNone,
+		ArchiveCollections: true,
+		Result:             &result,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if result.ChunkSize >= DefaultChunkSize || result.ChunkSize < minAutoChunkSize {
+		t.Errorf("Unexpected chunk size %d", result.ChunkSize)
+	}
+	if result.Chunks < DefaultChunkCount.Min-1 || result.Chunks > DefaultChunkCount.Min+1 {
+		t.Errorf("Expected about %d chunks per collection, got %d", DefaultChunkCount.Min, result.Chunks)
+	}
+
+	// The choice is recorded in the metadata
+	coll := file.Collection{Name: "2A2", Path: filepath.Join(outputDir, "2A2.tar")}
+	md, err := file.ReadMetadata(ctx, coll, nil)
+	if err != nil || md.ChunkSize != result.ChunkSize || !md.ChunkSizeAuto {
+		t.Errorf("Unexpected metadata: %+v, %v", md, err)
+	}
+
+	decodedDir := filepath.Join(tempDir, "decoded")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDirs: []string{outputDir}, OutputDir: decodedDir, Compression: CompressionNone}); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	decoded, err := os.ReadFile(filepath.Join(decodedDir, "data.bin"))
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("Decoding did not reproduce the input (%v)", err)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// leftoverKinds maps the name prefixes of the temporary directories padlock creates to a
+// description of what they hold. A run that is killed, or that can't clean up after itself,
+// leaves these behind.
+var leftoverKinds = []struct {
+	prefix string
+	kind   string
+}{
+	{"padlock-collections-", "extracted collections"},
+	{"padlock-staging-", "staged remote collections"},
+	{"padlock-frames-", "spooled stream frames"},
+	{"padlock-prefetch-", "prefetched chunks"},
+	{"padlock-dedup-", "blocks of deduplicated streams"},
+}
+
+// staleLockKind describes a lock file left by an encode or decode that is no longer running
+const staleLockKind = "stale lock"
+
+// Leftover is a temporary directory, or a lock file, left behind by an earlier padlock run
+type Leftover struct {
+	Path    string    // Location of the directory or lock file
+	Kind    string    // What the directory holds
+	Size    int64     // Total size of the files in the directory
+	ModTime time.Time // Most recent modification of the directory or anything in it
+}
+
+// FindLeftovers lists the padlock temporary directories directly within dirs that have not
+// been modified for at least minAge, so that those of runs still in progress are left alone.
+// Only directories whose names padlock generates are considered, and symbolic links are never
+// followed, so nothing else in dirs can be mistaken for a leftover. A lock file in one of dirs
+// is a leftover if the process that held it is no longer running, however recent it is.
+func FindLeftovers(ctx context.Context, dirs []string, minAge time.Duration) ([]Leftover, error) {
+	log := trace.FromContext(ctx).WithPrefix("clean")
+
+	var leftovers []Leftover
+	cutoff := time.Now().Add(-minAge)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Error(fmt.Errorf("failed to read directory %s: %w", dir, err))
+			return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+		}
+		if leftover, ok := findStaleLock(ctx, dir); ok {
+			leftovers = append(leftovers, leftover)
+		}
+		for _, entry := range entries {
+			kind := leftoverKind(entry.Name())
+			if kind == "" || entry.Type()&fs.ModeType != fs.ModeDir {
+				continue
+			}
+			leftover, err := measureLeftover(filepath.Join(dir, entry.Name()), kind)
+			if err != nil {
+				// It may have been removed by the run that owns it
+				log.Debugf("Skipping %s: %v", entry.Name(), err)
+				continue
+			}
+			if leftover.ModTime.After(cutoff) {
+				log.Debugf("Skipping %s: modified %s ago, it may be in use", leftover.Path, time.Since(leftover.ModTime).Round(time.Second))
+				continue
+			}
+			leftovers = append(leftovers, leftover)
+		}
+	}
+
+	sort.Slice(leftovers, func(i, j int) bool {
+		return leftovers[i].Path < leftovers[j].Path
+	})
+	return leftovers, nil
+}
+
+// findStaleLock returns the lock file in dir as a leftover if the operation that held it
+// died without releasing it
+func findStaleLock(ctx context.Context, dir string) (Leftover, bool) {
+	log := trace.FromContext(ctx).WithPrefix("clean")
+
+	holder, stale, err := file.ReadLock(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Debugf("Skipping lock in %s: %v", dir, err)
+		}
+		return Leftover{}, false
+	}
+	if !stale {
+		log.Debugf("Skipping lock in %s: held by %s", dir, holder)
+		return Leftover{}, false
+	}
+	path := filepath.Join(dir, file.LockFileName)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return Leftover{}, false
+	}
+	return Leftover{Path: path, Kind: staleLockKind, Size: info.Size(), ModTime: info.ModTime()}, true
+}
+
+// leftoverKind returns what a padlock temporary directory with the given name holds, or ""
+// if the name is not one padlock generates
+func leftoverKind(name string) string {
+	for _, k := range leftoverKinds {
+		if strings.HasPrefix(name, k.prefix) && len(name) > len(k.prefix) {
+			return k.kind
+		}
+	}
+	return ""
+}
+
+// measureLeftover totals the size and finds the latest modification within a directory
+func measureLeftover(path string, kind string) (Leftover, error) {
+	leftover := Leftover{Path: path, Kind: kind}
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			leftover.Size += info.Size()
+		}
+		if info.ModTime().After(leftover.ModTime) {
+			leftover.ModTime = info.ModTime()
+		}
+		return nil
+	})
+	return leftover, err
+}
+
+// RemoveLeftovers removes the given leftovers, returning how many bytes were freed. It
+// continues past failures and reports the first one.
+func RemoveLeftovers(ctx context.Context, leftovers []Leftover) (int64, error) {
+	log := trace.FromContext(ctx).WithPrefix("clean")
+
+	var freed int64
+	var firstErr error
+	for _, leftover := range leftovers {
+		if err := os.RemoveAll(leftover.Path); err != nil {
+			log.Error(fmt.Errorf("failed to remove %s: %w", leftover.Path, err))
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to remove %s: %w", leftover.Path, err)
+			}
+			continue
+		}
+		log.Debugf("Removed %s (%s)", leftover.Path, FormatByteSize(leftover.Size))
+		freed += leftover.Size
+	}
+	return freed, firstErr
+}
+
+// PrintLeftovers writes a listing of leftovers as a human-readable report
+func PrintLeftovers(w io.Writer, leftovers []Leftover) {
+	if len(leftovers) == 0 {
+		fmt.Fprintln(w, "No padlock leftovers found")
+		return
+	}
+	var total int64
+	locks := 0
+	for _, leftover := range leftovers {
+		fmt.Fprintf(w, "%18s  %-16s  %-24s  %s\n", FormatByteSize(leftover.Size),
+			leftover.ModTime.Format("2006-01-02 15:04"), leftover.Kind, leftover.Path)
+		total += leftover.Size
+		if leftover.Kind == staleLockKind {
+			locks++
+		}
+	}
+	if locks > 0 {
+		fmt.Fprintf(w, "Total: %s in %d directories and %d stale locks\n", FormatByteSize(total), len(leftovers)-locks, locks)
+		return
+	}
+	fmt.Fprintf(w, "Total: %s in %d directories\n", FormatByteSize(total), len(leftovers))
+}
@@ -0,0 +1,146 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestFindAndRemoveLeftovers(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	tempDir, err := os.MkdirTemp("", "padlock-clean-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// makeDir creates a directory holding a file of the given size, last modified age ago
+	makeDir := func(name string, size int, age time.Duration) string {
+		dir := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		path := filepath.Join(dir, "data")
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatalf("Failed to create file in %s: %v", name, err)
+		}
+		when := time.Now().Add(-age)
+		for _, p := range []string{path, dir} {
+			if err := os.Chtimes(p, when, when); err != nil {
+				t.Fatalf("Failed to set time of %s: %v", p, err)
+			}
+		}
+		return dir
+	}
+	collections := makeDir("padlock-collections-123", 1000, 2*time.Hour)
+	staging := makeDir("padlock-staging-456", 500, 3*time.Hour)
+	recent := makeDir("padlock-frames-789", 100, time.Minute)
+	unrelated := makeDir("other-collections-123", 100, 2*time.Hour)
+
+	// A link to a directory elsewhere is never followed, even with a padlock name
+	target := makeDir("target", 100, 2*time.Hour)
+	if err := os.Symlink(target, filepath.Join(tempDir, "padlock-prefetch-link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	leftovers, err := FindLeftovers(ctx, []string{tempDir}, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to find leftovers: %v", err)
+	}
+	if len(leftovers) != 2 || leftovers[0].Path != collections || leftovers[1].Path != staging {
+		t.Fatalf("Expected the two stale padlock directories, got %+v", leftovers)
+	}
+	if leftovers[0].Size != 1000 || leftovers[0].Kind != "extracted collections" {
+		t.Errorf("Unexpected leftover %+v", leftovers[0])
+	}
+
+	var out bytes.Buffer
+	PrintLeftovers(&out, leftovers)
+	if !strings.Contains(out.String(), "2 directories") || !strings.Contains(out.String(), staging) {
+		t.Errorf("Unexpected listing:\n%s", out.String())
+	}
+
+	freed, err := RemoveLeftovers(ctx, leftovers)
+	if err != nil {
+		t.Fatalf("Failed to remove leftovers: %v", err)
+	}
+	if freed != 1500 {
+		t.Errorf("Expected 1500 bytes freed, got %d", freed)
+	}
+	for _, path := range []string{collections, staging} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", path)
+		}
+	}
+	for _, path := range []string{recent, unrelated, target} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to be kept: %v", path, err)
+		}
+	}
+
+	// Without a minimum age, the recent directory is found too
+	leftovers, err = FindLeftovers(ctx, []string{tempDir}, 0)
+	if err != nil || len(leftovers) != 1 || leftovers[0].Path != recent {
+		t.Errorf("Expected only the recent directory, got %+v, %v", leftovers, err)
+	}
+}
+
+func TestFindStaleLocks(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	tempDir, err := os.MkdirTemp("", "padlock-clean-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A lock held by this process is in use, however old
+	held := filepath.Join(tempDir, "held")
+	lock, err := file.AcquireLock(held, "encode")
+	if err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+	defer lock.Release()
+
+	// One left by a process that died is a leftover, however recent
+	dead := filepath.Join(tempDir, "dead")
+	if err := os.MkdirAll(dead, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	host, _ := os.Hostname()
+	data, _ := json.Marshal(file.LockInfo{PID: 0x7ffffff0, Host: host, Operation: "decode", Started: time.Now()})
+	if err := os.WriteFile(filepath.Join(dead, file.LockFileName), data, 0644); err != nil {
+		t.Fatalf("Failed to write lock: %v", err)
+	}
+
+	leftovers, err := FindLeftovers(ctx, []string{held, dead}, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to find leftovers: %v", err)
+	}
+	if len(leftovers) != 1 || leftovers[0].Path != filepath.Join(dead, file.LockFileName) || leftovers[0].Kind != staleLockKind {
+		t.Fatalf("Expected only the stale lock, got %+v", leftovers)
+	}
+
+	var out bytes.Buffer
+	PrintLeftovers(&out, leftovers)
+	if !strings.Contains(out.String(), "1 stale locks") {
+		t.Errorf("Unexpected listing:\n%s", out.String())
+	}
+	if _, err := RemoveLeftovers(ctx, leftovers); err != nil {
+		t.Fatalf("Failed to remove leftovers: %v", err)
+	}
+	if err := file.CheckLock(dead); err != nil {
+		t.Errorf("Expected the stale lock to be removed: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// interrupted reports whether an operation failed because its context was cancelled or
+// its deadline passed, rather than for some other reason
+func interrupted(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() != nil
+}
+
+// removePartialOutput empties output directories after an encode or decode failed or was
+// interrupted, so that partially written collections or files can't be mistaken for complete
+// ones. The directories were empty, or cleared, when the operation started, so everything in
+// them was written by the failed operation. Each path removed is logged and returned, so the
+// caller can report exactly what was rolled back.
+func removePartialOutput(ctx context.Context, dirs []string) []string {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	var removed []string
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Error(fmt.Errorf("failed to remove partial output in %s: %w", dir, err))
+			}
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Name() == file.LockFileName {
+				continue // Released when the operation returns
+			}
+			path := filepath.Join(dir, entry.Name())
+			if err := os.RemoveAll(path); err != nil {
+				log.Error(fmt.Errorf("failed to remove partial output %s: %w", path, err))
+				continue
+			}
+			log.Infof("Rolled back partial output: %s", path)
+			removed = append(removed, path)
+		}
+	}
+	return removed
+}
+
+// rollBack handles the partial output of an encode or decode that returned err: the contents
+// of dirs, and any other files it wrote. Unless keep is set, the output is removed and listed
+// in result, if there is one; a resumed operation always keeps it, since it also holds the
+// work of the runs before it.
+func rollBack(ctx context.Context, err error, resume bool, keep bool, dirs []string, files []string, result *Result) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	switch {
+	case err == nil:
+		return
+	case resume:
+		log.Infof("Keeping the partial output, which can be resumed again with -resume")
+		return
+	case keep:
+		log.Infof("Keeping the partial output in %s", strings.Join(dirs, ", "))
+		return
+	}
+
+	removed := removePartialOutput(ctx, dirs)
+	for _, path := range files {
+		if err := os.Remove(path); err != nil {
+			if !os.IsNotExist(err) {
+				log.Error(fmt.Errorf("failed to remove partial output %s: %w", path, err))
+			}
+			continue
+		}
+		log.Infof("Rolled back partial output: %s", path)
+		removed = append(removed, path)
+	}
+
+	if len(removed) == 0 {
+		log.Infof("No partial output to roll back")
+	} else {
+		log.Infof("Rolled back %d partial outputs after the failure", len(removed))
+	}
+	if result != nil {
+		result.RolledBack = removed
+	}
+}
+
+// isEmptyDir reports whether dir is empty or doesn't exist yet, so that everything written
+// to it afterwards can be rolled back
+func isEmptyDir(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return true
+	}
+	for _, entry := range entries {
+		if entry.Name() != file.LockFileName {
+			return false
+		}
+	}
+	return err == nil
+}
+
+// encodeOutputDirs returns the directories an encode writes collections to
+func encodeOutputDirs(cfg EncodeConfig) []string {
+	if len(cfg.OutputDirs) > 1 {
+		return cfg.OutputDirs
+	}
+	return []string{cfg.OutputDir}
+}
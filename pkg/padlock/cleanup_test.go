@@ -0,0 +1,224 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// cancellingRNG cancels its context after a number of reads, simulating an interrupt
+// arriving in the middle of an encode
+type cancellingRNG struct {
+	pad.RNG
+	reads  int
+	cancel context.CancelFunc
+}
+
+func (r *cancellingRNG) Read(ctx context.Context, p []byte) error {
+	r.reads--
+	if r.reads == 0 {
+		r.cancel()
+	}
+	return r.RNG.Read(ctx, p)
+}
+
+func TestInterruptedEncodeRemovesPartialOutput(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-cleanup-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(strings.Repeat("interrupt ", 5000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	for _, archive := range []bool{false, true} {
+		ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+		ctx, cancel := context.WithCancel(ctx)
+
+		outputDir := filepath.Join(tempDir, "output")
+		catalogPath := filepath.Join(tempDir, "catalog.json")
+		cfg := EncodeConfig{
+			InputDir:           inputDir,
+			OutputDir:          outputDir,
+			N:                  3,
+			K:                  2,
+			Format:             FormatBin,
+			ChunkSize:          256,
+			RNG:                &cancellingRNG{RNG: pad.NewDefaultRand(ctx), reads: 5, cancel: cancel},
+			ClearIfNotEmpty:    true,
+			Compression:        CompressionNone,
+			ArchiveCollections: archive,
+			CatalogPath:        catalogPath,
+		}
+
+		err := EncodeDirectory(ctx, cfg)
+		cancel()
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected encode (archive=%v) to fail with context.Canceled, got %v", archive, err)
+		}
+
+		entries, err := os.ReadDir(outputDir)
+		if err != nil {
+			t.Fatalf("Failed to read output dir: %v", err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("Expected interrupted encode (archive=%v) to leave an empty output dir, found %d entries", archive, len(entries))
+		}
+		if _, err := os.Stat(catalogPath); !os.IsNotExist(err) {
+			t.Errorf("Expected no catalog after interrupted encode (archive=%v)", archive)
+		}
+	}
+}
+
+func TestFailedEncodeRollsBackPartialOutput(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-cleanup-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(strings.Repeat("rollback ", 5000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	for _, keep := range []bool{false, true} {
+		ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+		outputDir := filepath.Join(tempDir, "output")
+		var result Result
+		cfg := EncodeConfig{
+			InputDir:        inputDir,
+			OutputDir:       outputDir,
+			N:               3,
+			K:               2,
+			Format:          FormatBin,
+			ChunkSize:       256,
+			RNG:             &failingRNG{RNG: pad.NewDefaultRand(ctx), reads: 20},
+			ClearIfNotEmpty: true,
+			Compression:     CompressionNone,
+			Result:          &result,
+			KeepPartial:     keep,
+		}
+		if err := EncodeDirectory(ctx, cfg); err == nil || !strings.Contains(err.Error(), "entropy source failed") {
+			t.Fatalf("Expected the encode (keep=%v) to fail, got %v", keep, err)
+		}
+
+		entries, err := os.ReadDir(outputDir)
+		if err != nil {
+			t.Fatalf("Failed to read output dir: %v", err)
+		}
+		if keep {
+			if len(entries) != 3 || len(result.RolledBack) != 0 {
+				t.Errorf("Expected the partial collections to be kept, found %d and rolled back %v", len(entries), result.RolledBack)
+			}
+			continue
+		}
+		if len(entries) != 0 {
+			t.Errorf("Expected the failed encode to leave an empty output dir, found %d entries", len(entries))
+		}
+		if len(result.RolledBack) != 3 {
+			t.Errorf("Expected the 3 partial collections to be reported as rolled back, got %v", result.RolledBack)
+		}
+		for _, path := range result.RolledBack {
+			if !file.IsPartialPath(path) {
+				t.Errorf("Expected only partial collections to be rolled back, got %s", path)
+			}
+		}
+	}
+}
+
+func TestFailedDecodeRollsBackRestoredFiles(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-cleanup-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(inputDir, name), []byte(strings.Repeat(name, 2000)), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	encodedDir := filepath.Join(tempDir, "encoded")
+	if err := EncodeDirectory(ctx, EncodeConfig{
+		InputDir:        inputDir,
+		OutputDir:       encodedDir,
+		N:               2,
+		K:               2,
+		Format:          FormatBin,
+		ChunkSize:       1024,
+		RNG:             pad.NewDefaultRand(ctx),
+		ClearIfNotEmpty: true,
+		Compression:     CompressionNone,
+	}); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	// Losing the end of a collection that's required makes the decode fail part way through
+	chunks, err := filepath.Glob(filepath.Join(encodedDir, "2A2", "2A2_*.bin"))
+	if err != nil || len(chunks) < 4 {
+		t.Fatalf("Expected several chunks in collection 2A2: %v %v", chunks, err)
+	}
+	for _, chunk := range chunks[len(chunks)/2:] {
+		os.Remove(chunk)
+	}
+
+	for _, keep := range []bool{false, true} {
+		outputDir := filepath.Join(tempDir, "output")
+		var result Result
+		cfg := DecodeConfig{InputDir: encodedDir, OutputDir: outputDir, ClearIfNotEmpty: true, Result: &result, KeepPartial: keep}
+		if err := DecodeDirectory(ctx, cfg); err == nil {
+			t.Fatalf("Expected the decode (keep=%v) to fail", keep)
+		}
+
+		entries, err := os.ReadDir(outputDir)
+		if err != nil {
+			t.Fatalf("Failed to read output dir: %v", err)
+		}
+		if keep {
+			if len(entries) == 0 || len(result.RolledBack) != 0 {
+				t.Errorf("Expected the restored files to be kept, found %d and rolled back %v", len(entries), result.RolledBack)
+			}
+			continue
+		}
+		if len(entries) != 0 {
+			t.Errorf("Expected the failed decode to leave an empty output dir, found %d entries", len(entries))
+		}
+		if len(result.RolledBack) == 0 {
+			t.Errorf("Expected the restored files to be reported as rolled back")
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// Encoder splits an arbitrary stream, such as a database dump or a network stream, into K-of-N
+// collections of chunks written to a ChunkSink, without staging anything on disk.
+//
+// Unlike EncodeDirectory, the payload is not serialized as a directory: a Decoder reading
+// the chunks back returns exactly the bytes the Encoder read.
+type Encoder struct {
+	cfg         EncodeConfig
+	compression Compression
+}
+
+// NewEncoder returns an Encoder for the threshold, chunk size, RNG, compression, and
+// ChunkSink settings of cfg; the input and output directory settings are not used. A nil
+// RNG selects the default source of randomness.
+func NewEncoder(cfg EncodeConfig) (*Encoder, error) {
+	if cfg.ChunkSink == nil {
+		return nil, fmt.Errorf("an encoder needs a chunk sink to write chunks to")
+	}
+	if cfg.K < 2 || cfg.K > cfg.N || cfg.N > 26 {
+		return nil, fmt.Errorf("%d-of-%d, need 2 <= K <= N <= 26: %w", cfg.K, cfg.N, ErrInvalidScheme)
+	}
+	if cfg.ChunkSize == ChunkSizeAuto {
+		return nil, fmt.Errorf("an encoder can't choose the chunk size of a stream; give a chunk size")
+	}
+	if cfg.ChunkSize <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive, got %d", cfg.ChunkSize)
+	}
+	if cfg.Compression.effective() != CompressionNone {
+		c, err := file.LookupCompressor(cfg.Compression.String())
+		if err == nil {
+			err = c.CheckLevel(cfg.CompressionLevel)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Format == "" {
+		cfg.Format = FormatBin
+	}
+	return &Encoder{cfg: cfg}, nil
+}
+
+// Encode reads r to the end and writes its chunks to the encoder's sink. It may be called
+// again to encode another stream, which must then be written to a different sink.
+func (e *Encoder) Encode(ctx context.Context, r io.Reader) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+	log.Infof("Starting stream encode to chunk sink")
+
+	cfg := e.cfg
+	if cfg.RNG == nil {
+		cfg.RNG = pad.NewDefaultRand(ctx)
+	}
+	compression, err := encodeStreamToSink(ctx, cfg, r, cfg.ChunkSink)
+	if err != nil {
+		return err
+	}
+	e.compression = compression
+	return nil
+}
+
+// Compression returns the compression the last Encode applied, which a Decoder must be
+// configured with. It differs from the configured compression only for CompressionAuto.
+func (e *Encoder) Compression() Compression {
+	return e.compression
+}
+
+// Decoder reconstructs a stream written by an Encoder from the chunks in a ChunkSource.
+// At least K of the N collections must be available.
+type Decoder struct {
+	cfg DecodeConfig
+}
+
+// NewDecoder returns a Decoder for the ChunkSource, compression, and pipeline settings of
+// cfg; the input and output directory settings are not used. The compression must be the
+// one the encode applied, as returned by Encoder.Compression, so that a payload which is
+// itself compressed is returned as it was rather than decompressed.
+func NewDecoder(cfg DecodeConfig) (*Decoder, error) {
+	if cfg.ChunkSource == nil {
+		return nil, fmt.Errorf("a decoder needs a chunk source to read chunks from")
+	}
+	if cfg.Compression == CompressionAuto {
+		return nil, fmt.Errorf("a decoder needs the compression the encode applied, not auto")
+	}
+	return &Decoder{cfg: cfg}, nil
+}
+
+// Decode reconstructs the stream from the decoder's source and writes it to w
+func (d *Decoder) Decode(ctx context.Context, w io.Writer) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+	log.Infof("Starting stream decode from chunk source")
+
+	shares, closeShares, err := sourceShares(ctx, d.cfg.ChunkSource, d.cfg)
+	if err != nil {
+		return err
+	}
+	defer closeShares()
+
+	if err := DecodeStreams(ctx, shares, w, StreamOptions{Compression: d.cfg.Compression.effective()}); err != nil {
+		log.Error(err)
+		return err
+	}
+	log.Infof("Stream decode complete")
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestEncoderDecoderStream(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	payload := make([]byte, 100000)
+	rand.Read(payload)
+
+	store := newMemoryStore()
+	enc, err := NewEncoder(EncodeConfig{N: 3, K: 2, ChunkSize: 4096, Compression: CompressionAuto, ChunkSink: store})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	if err := enc.Encode(ctx, bytes.NewReader(payload)); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if len(store.names) != 3 {
+		t.Fatalf("Expected chunks for 3 collections, got %d", len(store.names))
+	}
+
+	// Random data doesn't compress, so auto leaves it alone
+	if enc.Compression() != CompressionNone {
+		t.Errorf("Expected no compression for random data, got %v", enc.Compression())
+	}
+
+	// Lose one collection; the remaining two are enough
+	delete(store.names, "2C3")
+
+	dec, err := NewDecoder(DecodeConfig{ChunkSource: store, Compression: enc.Compression()})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := dec.Decode(ctx, &out); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), payload) {
+		t.Errorf("Decoded stream mismatch: got %d bytes, want %d", out.Len(), len(payload))
+	}
+
+	// A compressible payload round-trips through gzip
+	text := bytes.Repeat([]byte("streaming encoder test "), 2000)
+	store = newMemoryStore()
+	enc, err = NewEncoder(EncodeConfig{N: 2, K: 2, ChunkSize: 1024, Compression: CompressionGzip, ChunkSink: store})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	if err := enc.Encode(ctx, bytes.NewReader(text)); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	dec, err = NewDecoder(DecodeConfig{ChunkSource: store, Compression: enc.Compression(), Pipeline: PipelineConfig{PrefetchChunks: 2}})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	out.Reset()
+	if err := dec.Decode(ctx, &out); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), text) {
+		t.Errorf("Decoded gzip stream mismatch: got %d bytes, want %d", out.Len(), len(text))
+	}
+}
+
+func TestEncoderDecoderConfig(t *testing.T) {
+	store := newMemoryStore()
+	if _, err := NewEncoder(EncodeConfig{N: 3, K: 2, ChunkSize: 1024}); err == nil {
+		t.Errorf("Expected an error for an encoder without a chunk sink")
+	}
+	if _, err := NewEncoder(EncodeConfig{N: 2, K: 3, ChunkSize: 1024, ChunkSink: store}); err == nil {
+		t.Errorf("Expected an error for K greater than N")
+	}
+	if _, err := NewEncoder(EncodeConfig{N: 3, K: 2, ChunkSink: store}); err == nil {
+		t.Errorf("Expected an error for a zero chunk size")
+	}
+	if _, err := NewDecoder(DecodeConfig{}); err == nil {
+		t.Errorf("Expected an error for a decoder without a chunk source")
+	}
+	if _, err := NewDecoder(DecodeConfig{ChunkSource: store, Compression: CompressionAuto}); err == nil {
+		t.Errorf("Expected an error for a decoder configured with auto compression")
+	}
+}
+
+func TestEncoderCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal)))
+	defer cancel()
+
+	// Cancel part way through an endless stream; the encode must stop rather than run forever
+	store := newMemoryStore()
+	sink := ChunkSinkFunc(func(ctx context.Context, collection string, chunkNumber int) (io.WriteCloser, error) {
+		if chunkNumber == 3 {
+			cancel()
+		}
+		return store.NewChunk(ctx, collection, chunkNumber)
+	})
+	enc, err := NewEncoder(EncodeConfig{N: 2, K: 2, ChunkSize: 1024, Compression: CompressionGzip, ChunkSink: sink})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	if err := enc.Encode(ctx, rand.Reader); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// ErrNewerFormat is returned when a collection was written in a format newer than this
+// padlock reads
+var ErrNewerFormat = pad.ErrNewerFormat
+
+// formatCompatibility is what this padlock can do with collections of one format version
+type formatCompatibility struct {
+	Read    bool   // Decode, verify, and repair read it
+	Current bool   // It is the format encode writes
+	Note    string // What changed in it, or how to migrate from it
+}
+
+// collectionFormats is the compatibility matrix: every collection format version this padlock
+// knows about. A version missing from it, because it is newer than file.CollectionFormatVersion,
+// is refused with ErrNewerFormat. Older versions that are still read, but not written, say how
+// to migrate them; `padlock reshare` rewrites collections in the current format.
+var collectionFormats = map[int]formatCompatibility{
+	0: {Read: true, Note: "written before format versions were recorded; the same as version 1"},
+	1: {Read: true, Current: true, Note: "versioned chunk headers and collection metadata"},
+}
+
+// checkCollectionFormats checks that this padlock can read the format of every collection,
+// as recorded in its metadata, before anything is decoded. Collections whose metadata can't
+// be read are left to the chunk headers, which record their own version. Collections in an
+// older format that is still read are only reported.
+func checkCollectionFormats(ctx context.Context, collections []file.Collection, key []byte) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	for _, coll := range collections {
+		md, err := file.ReadMetadata(ctx, coll, key)
+		if errors.Is(err, file.ErrNewerFormat) {
+			err := fmt.Errorf("%w: %w", ErrNewerFormat, err)
+			log.Error(err)
+			return err
+		}
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				log.Debugf("No format version from collection %s: %v", coll.DiskName(), err)
+			}
+			continue
+		}
+		compat, ok := collectionFormats[md.FormatVersion]
+		if !ok || !compat.Read {
+			err := fmt.Errorf("collection %s has format version %d, but this padlock reads up to version %d: %w",
+				coll.Name, md.FormatVersion, file.CollectionFormatVersion, ErrNewerFormat)
+			log.Error(err)
+			return err
+		}
+		if !compat.Current && md.FormatVersion != 0 {
+			log.Infof("Collection %s is in format version %d (%s); reshare it to migrate it to version %d",
+				coll.Name, md.FormatVersion, compat.Note, file.CollectionFormatVersion)
+		}
+	}
+	return nil
+}
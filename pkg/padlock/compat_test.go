@@ -0,0 +1,90 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestCollectionFormatVersion checks that collections record the format they were written in,
+// that a collection from a newer padlock is refused before decoding starts, and that one
+// written before format versions were recorded still decodes
+func TestCollectionFormatVersion(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "data.txt"), []byte(strings.Repeat("format ", 2000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	encodeDir := filepath.Join(tempDir, "encoded")
+	err := EncodeDirectory(ctx, EncodeConfig{
+		InputDir:    inputDir,
+		OutputDir:   encodeDir,
+		N:           3,
+		K:           2,
+		Format:      FormatBin,
+		ChunkSize:   4096,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	coll := file.Collection{Name: "2A3", Path: filepath.Join(encodeDir, "2A3")}
+	md, err := file.ReadMetadata(ctx, coll, nil)
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if md.FormatVersion != file.CollectionFormatVersion {
+		t.Errorf("Collection records format version %d, expected %d", md.FormatVersion, file.CollectionFormatVersion)
+	}
+	if compat, ok := collectionFormats[file.CollectionFormatVersion]; !ok || !compat.Read || !compat.Current {
+		t.Errorf("The current format version is not in the compatibility matrix as read and current")
+	}
+
+	decode := func(name string, change func(md *file.Metadata)) error {
+		edited := *md
+		change(&edited)
+		if err := file.WriteMetadata(ctx, coll.Path, &edited); err != nil {
+			t.Fatalf("Failed to write metadata: %v", err)
+		}
+		decodeDir := filepath.Join(tempDir, name)
+		err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputDir: decodeDir, Compression: CompressionGzip})
+		if err != nil {
+			if entries, _ := os.ReadDir(decodeDir); len(entries) > 0 {
+				t.Errorf("%s: a refused decode left %d entries in the output directory", name, len(entries))
+			}
+		}
+		return err
+	}
+
+	// A newer collection format, or a newer metadata layout, is refused as such
+	if err := decode("newer-format", func(md *file.Metadata) { md.FormatVersion = file.CollectionFormatVersion + 1 }); !errors.Is(err, ErrNewerFormat) {
+		t.Errorf("Expected ErrNewerFormat for a newer collection format, got %v", err)
+	}
+	if err := decode("newer-metadata", func(md *file.Metadata) { md.Version = file.MetadataVersion + 1 }); !errors.Is(err, ErrNewerFormat) {
+		t.Errorf("Expected ErrNewerFormat for a newer metadata version, got %v", err)
+	}
+
+	// A collection from before format versions were recorded reads as version 1
+	if err := decode("unversioned", func(md *file.Metadata) { md.FormatVersion = 0 }); err != nil {
+		t.Errorf("Failed to decode a collection without a format version: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// CustodianPlan describes who holds each collection of a distribution, for use in
+// organizational recovery runbooks.
+type CustodianPlan struct {
+	Copies      int         // Total number of collections in the distribution
+	Required    int         // Collections required for reconstruction
+	ReviewBy    time.Time   // Review-by date of the distribution, if one was set
+	Collections []string    // Names of all known collections, sorted
+	Custodians  []Custodian // Designated custodians, sorted by collection
+}
+
+// CustodianPlanFromCatalog extracts the custodian plan recorded in a catalog.
+func CustodianPlanFromCatalog(catalog *Catalog) *CustodianPlan {
+	plan := &CustodianPlan{
+		Copies:   catalog.Copies,
+		Required: catalog.Required,
+		ReviewBy: catalog.ReviewBy,
+	}
+	for _, entry := range catalog.Collections {
+		plan.Collections = append(plan.Collections, entry.Name)
+		if entry.Custodian != "" {
+			plan.Custodians = append(plan.Custodians, Custodian{
+				Collection: entry.Name,
+				Name:       entry.Custodian,
+				Contact:    entry.Contact,
+			})
+		}
+	}
+	plan.sort()
+	return plan
+}
+
+// ReadCustodianPlan assembles the custodian plan from the metadata of the collections found
+// in the input directories, using the same discovery rules as DecodeDirectory. Any single
+// collection carries the plan for the whole distribution; plans from several collections
+// are merged so that collections encoded without metadata do not hide the others.
+// key decrypts metadata sealed at encode time.
+func ReadCustodianPlan(ctx context.Context, inputDir string, inputDirs []string, key []byte) (*CustodianPlan, error) {
+	log := trace.FromContext(ctx).WithPrefix("custodians")
+
+	collections, tempDir, err := findInputCollections(ctx, inputDir, inputDirs, 0)
+	if err != nil {
+		return nil, err
+	}
+	if tempDir != "" {
+		defer os.RemoveAll(tempDir)
+	}
+
+	plan := &CustodianPlan{}
+	known := make(map[string]bool)
+	seen := make(map[string]bool)
+	found := 0
+
+	for _, coll := range collections {
+		md, err := file.ReadMetadata(ctx, coll, key)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Infof("Collection %s has no metadata", coll.Name)
+			if !known[coll.Name] {
+				known[coll.Name] = true
+				plan.Collections = append(plan.Collections, coll.Name)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found++
+
+		// Stealth collections are listed under their real names
+		if !known[md.Collection] {
+			known[md.Collection] = true
+			plan.Collections = append(plan.Collections, md.Collection)
+		}
+
+		if plan.Copies == 0 {
+			plan.Copies = md.Copies
+			plan.Required = md.Required
+			plan.ReviewBy = md.ReviewBy
+		} else if md.Copies != plan.Copies || md.Required != plan.Required {
+			return nil, fmt.Errorf("collection %s belongs to a different distribution (%d of %d, expected %d of %d): %w",
+				coll.Name, md.Required, md.Copies, plan.Required, plan.Copies, ErrMixedSessions)
+		}
+
+		for _, c := range md.Custodians {
+			if !seen[c.Collection] {
+				seen[c.Collection] = true
+				plan.Custodians = append(plan.Custodians, c)
+			}
+			if !known[c.Collection] {
+				known[c.Collection] = true
+				plan.Collections = append(plan.Collections, c.Collection)
+			}
+		}
+	}
+
+	if found == 0 {
+		return nil, fmt.Errorf("none of the %d collections found contain metadata", len(collections))
+	}
+
+	plan.sort()
+	return plan, nil
+}
+
+// sort orders collections and custodians by collection name
+func (p *CustodianPlan) sort() {
+	sort.Strings(p.Collections)
+	sort.Slice(p.Custodians, func(i, j int) bool {
+		return p.Custodians[i].Collection < p.Custodians[j].Collection
+	})
+}
+
+// Print writes the plan as a human-readable table.
+func (p *CustodianPlan) Print(w io.Writer) {
+	fmt.Fprintf(w, "Custodian plan: any %d of %d collections reconstruct the data\n", p.Required, p.Copies)
+	if !p.ReviewBy.IsZero() {
+		overdue := ""
+		if time.Now().After(p.ReviewBy) {
+			overdue = " (OVERDUE - re-encode onto fresh media)"
+		}
+		fmt.Fprintf(w, "Review by: %s%s\n", p.ReviewBy.Format(time.DateOnly), overdue)
+	}
+	fmt.Fprintln(w)
+
+	byCollection := make(map[string]Custodian)
+	for _, c := range p.Custodians {
+		byCollection[c.Collection] = c
+	}
+	for _, name := range p.Collections {
+		if c, ok := byCollection[name]; ok {
+			fmt.Fprintf(w, "  %-6s  %s\n", name, c)
+		} else {
+			fmt.Fprintf(w, "  %-6s  (no custodian recorded)\n", name)
+		}
+	}
+	if len(p.Collections) < p.Copies {
+		fmt.Fprintf(w, "\n%d of %d collections are not described by the collections provided\n", p.Copies-len(p.Collections), p.Copies)
+	}
+}
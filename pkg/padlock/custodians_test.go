@@ -0,0 +1,96 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestCustodianPlan(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-custodians-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	outputDir := filepath.Join(tempDir, "output")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte("custodian test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	catalogPath := filepath.Join(tempDir, "catalog.json")
+
+	cfg := EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          outputDir,
+		N:                  3,
+		K:                  2,
+		Format:             FormatBin,
+		ChunkSize:          64,
+		RNG:                pad.NewDefaultRand(ctx),
+		ClearIfNotEmpty:    true,
+		Compression:        CompressionNone,
+		ArchiveCollections: true,
+		CatalogPath:        catalogPath,
+		Custodians: []Custodian{
+			{Name: "Alice", Contact: "alice@example.com"},
+			{Name: "Bob"},
+			{Name: "Carol"},
+		},
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	// The full plan is available from the collections themselves
+	plan, err := ReadCustodianPlan(ctx, outputDir, nil, nil)
+	if err != nil {
+		t.Fatalf("ReadCustodianPlan failed: %v", err)
+	}
+	if plan.Required != 2 || plan.Copies != 3 || len(plan.Custodians) != 3 {
+		t.Fatalf("Unexpected plan: %+v", plan)
+	}
+	if plan.Custodians[0].Collection != "2A3" || plan.Custodians[0].Contact != "alice@example.com" {
+		t.Errorf("Unexpected first custodian: %+v", plan.Custodians[0])
+	}
+
+	// ... and from the catalog
+	catalog, err := ReadCatalog(ctx, catalogPath, nil)
+	if err != nil {
+		t.Fatalf("ReadCatalog failed: %v", err)
+	}
+	catalogPlan := CustodianPlanFromCatalog(catalog)
+
+	var fromColls, fromCatalog bytes.Buffer
+	plan.Print(&fromColls)
+	catalogPlan.Print(&fromCatalog)
+	if fromColls.String() != fromCatalog.String() {
+		t.Errorf("Plans differ:\n%s\n%s", fromColls.String(), fromCatalog.String())
+	}
+	if !strings.Contains(fromColls.String(), "Bob") {
+		t.Errorf("Plan output missing custodian: %s", fromColls.String())
+	}
+
+	// A mismatched custodian count is rejected
+	cfg.Custodians = cfg.Custodians[:2]
+	cfg.CatalogPath = ""
+	if err := EncodeDirectory(ctx, cfg); err == nil {
+		t.Errorf("Expected encode to fail with too few custodians")
+	}
+}
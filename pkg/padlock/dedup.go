@@ -0,0 +1,56 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// An encode with Dedup stores each distinct block of the serialized input once, before it is
+// compressed and split, as a file.DedupStream. Repeated data, such as copies of a file or
+// several versions of one that differ only in places, then takes up the space of one copy in
+// every collection. The stream describes itself, so decode rebuilds the TAR from it whenever
+// it finds one. The metadata records Dedup so that info can report it, and so that decode
+// refuses to write the TAR still compressed, which would leave it deduplicated too.
+
+// checkDedup refuses an encode with Dedup whose input isn't a TAR of input directories, or
+// whose payload is decoded in parts through a chunk index, which deduplication would make
+// depend on blocks anywhere before them
+func checkDedup(cfg EncodeConfig) error {
+	if !cfg.Dedup {
+		return nil
+	}
+	switch {
+	case cfg.RawInput != nil:
+		return fmt.Errorf("only input directories can be deduplicated, not a stream")
+	case cfg.ChunkIndex:
+		return fmt.Errorf("deduplicated data can't have a chunk index, since a file's blocks may be stored with any file before it")
+	}
+	return nil
+}
+
+// collectionDedup reports whether the metadata of any of the collections records that their
+// payload is deduplicated
+func collectionDedup(ctx context.Context, collections []file.Collection, key []byte) bool {
+	for _, coll := range collections {
+		if md, err := file.ReadMetadata(ctx, coll, key); err == nil && md.Dedup {
+			return true
+		}
+	}
+	return false
+}
+
+// logDedup reports how much of the serialized input deduplication found to be repeated
+func logDedup(ctx context.Context, stats *file.DedupStats) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+	if stats.Bytes == 0 {
+		return
+	}
+	log.Infof("Deduplication stored %s of repeated data once, of %s in %d blocks (%.1f%%)",
+		FormatByteSize(stats.DuplicateBytes), FormatByteSize(stats.Bytes), stats.Blocks,
+		float64(stats.DuplicateBytes)/float64(stats.Bytes)*100)
+}
@@ -0,0 +1,112 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestDedupRoundTrip checks that an encode with Dedup stores files that repeat each other
+// once, and that decode rebuilds them all
+func TestDedupRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+
+	// Random data doesn't compress, so only deduplication makes the copies smaller. It is
+	// seeded, since where blocks are cut depends on the data.
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	files := map[string]string{"a.bin": string(data), "copy/a.bin": string(data), "b.txt": "different"}
+	writeFiles(t, inputDir, files)
+
+	encode := func(name string, options ...Option) (string, Result) {
+		var result Result
+		outputDir := filepath.Join(tempDir, name)
+		options = append(options, WithInput(inputDir), WithOutputs(outputDir), WithScheme(2, 3), WithFormat(FormatBin),
+			WithCompression(CompressionNone, 0), WithRNG(pad.NewDefaultRand(ctx)))
+		cfg, err := NewEncodeConfig(options...)
+		if err != nil {
+			t.Fatalf("NewEncodeConfig failed: %v", err)
+		}
+		cfg.Result = &result
+		if err := EncodeDirectory(ctx, cfg); err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		return outputDir, result
+	}
+	plainDir, plain := encode("plain")
+	dedupDir, dedup := encode("dedup", WithDedup())
+
+	if plain.DuplicateBytes != 0 || dedup.DuplicateBytes < int64(len(data))*3/4 {
+		t.Errorf("Expected most of the copy to be found repeated, got %d bytes", dedup.DuplicateBytes)
+	}
+	plainSize, dedupSize := dirSize(t, plainDir), dirSize(t, dedupDir)
+	if dedupSize > plainSize-int64(len(data))/2 {
+		t.Errorf("Expected the deduplicated collections to be smaller: %d bytes, against %d", dedupSize, plainSize)
+	}
+	collections, _, err := file.FindCollections(ctx, dedupDir)
+	if err != nil {
+		t.Fatalf("Failed to find collections: %v", err)
+	}
+	if md, err := file.ReadMetadata(ctx, collections[0], nil); err != nil || !md.Dedup {
+		t.Errorf("Expected the metadata to record deduplication (%v)", err)
+	}
+
+	decodeDir := filepath.Join(tempDir, "decoded")
+	decodeCfg, err := NewDecodeConfig(WithInputs(collections[0].Path, collections[2].Path), WithOutput(decodeDir))
+	if err != nil {
+		t.Fatalf("NewDecodeConfig failed: %v", err)
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(decodeDir, filepath.FromSlash(name)))
+		if err != nil || !bytes.Equal(got, []byte(content)) {
+			t.Errorf("Expected %s to be restored (%v)", name, err)
+		}
+	}
+
+	// The TAR is rebuilt when it is written out, and can't be kept compressed
+	var tar bytes.Buffer
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: dedupDir, OutputStream: &tar, OutputTar: true, RNG: pad.NewDefaultRand(ctx)}); err != nil {
+		t.Fatalf("Failed to decode to a TAR: %v", err)
+	}
+	if !bytes.Contains(tar.Bytes(), data[:1024]) || file.IsDedupStream(tar.Bytes()) {
+		t.Errorf("Expected the TAR to be rebuilt")
+	}
+	err = DecodeDirectory(ctx, DecodeConfig{InputDir: dedupDir, OutputStream: &tar, OutputTar: true, KeepCompressed: true,
+		RNG: pad.NewDefaultRand(ctx)})
+	if err == nil {
+		t.Errorf("Expected a deduplicated TAR to be refused when kept compressed")
+	}
+}
+
+// dirSize returns the total size of the files under dir
+func dirSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to measure %s: %v", dir, err)
+	}
+	return size
+}
@@ -0,0 +1,154 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// resolveDestinations parses the configured output directories, which may mix local paths
+// and URLs such as s3://bucket/share2, and rewrites cfg so that encoding writes each
+// collection to a local directory. The returned destinations are in the same order as
+// cfg.OutputDirs, or hold a single entry for cfg.OutputDir.
+func resolveDestinations(ctx context.Context, cfg *EncodeConfig) ([]file.Destination, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if cfg.SizeOnly {
+		return nil, nil
+	}
+
+	outputs := cfg.OutputDirs
+	if len(outputs) == 0 {
+		outputs = []string{cfg.OutputDir}
+	}
+
+	destinations := make([]file.Destination, 0, len(outputs))
+	localDirs := make([]string, 0, len(outputs))
+	for _, output := range outputs {
+		dest, err := file.ParseDestination(ctx, output)
+		if err != nil {
+			cleanupDestinations(ctx, destinations)
+			log.Error(err)
+			return nil, err
+		}
+		if dest.LocalDir() != dest.String() {
+			log.Debugf("Staging collection for %s in %s", dest, dest.LocalDir())
+		}
+		destinations = append(destinations, dest)
+		localDirs = append(localDirs, dest.LocalDir())
+	}
+
+	if len(cfg.OutputDirs) > 0 {
+		cfg.OutputDirs = localDirs
+	}
+	if cfg.OutputDir != "" {
+		cfg.OutputDir = localDirs[0]
+	}
+	return destinations, nil
+}
+
+// fetchSources downloads the collections at any remote input directories, such as
+// webdavs://cloud.example.com/remote.php/dav/files/alice/share2, and rewrites cfg so that
+// decoding reads them from local staging directories. The returned sources must be
+// cleaned up when decoding has finished.
+func fetchSources(ctx context.Context, cfg *DecodeConfig) ([]file.Destination, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	inputs := cfg.InputDirs
+	if len(inputs) == 0 {
+		inputs = []string{cfg.InputDir}
+	}
+
+	var sources []file.Destination
+	localDirs := make([]string, len(inputs))
+	for i, input := range inputs {
+		localDirs[i] = input
+		if !file.IsDestinationURL(input) {
+			continue
+		}
+
+		dest, err := file.ParseDestination(ctx, input)
+		if err != nil {
+			cleanupDestinations(ctx, sources)
+			log.Error(err)
+			return nil, err
+		}
+		sources = append(sources, dest)
+		if source, ok := dest.(file.Source); ok {
+			err = source.Fetch(ctx)
+		} else if dest.LocalDir() != dest.String() {
+			err = fmt.Errorf("collections can't be read back from %s; copy them to a local directory first", dest)
+		}
+		if err != nil {
+			cleanupDestinations(ctx, sources)
+			return nil, err
+		}
+		localDirs[i] = dest.LocalDir()
+	}
+
+	if len(cfg.InputDirs) > 0 {
+		cfg.InputDirs = localDirs
+	}
+	if cfg.InputDir != "" {
+		cfg.InputDir = localDirs[0]
+	}
+	return sources, nil
+}
+
+// publishDestinations delivers every staged collection to its remote destination
+func publishDestinations(ctx context.Context, destinations []file.Destination) error {
+	for _, dest := range destinations {
+		if err := dest.Publish(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanupDestinations removes the staging directories of remote destinations
+func cleanupDestinations(ctx context.Context, destinations []file.Destination) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+	for _, dest := range destinations {
+		if err := dest.Cleanup(); err != nil {
+			log.Debugf("Warning: failed to clean up staging for %s: %v", dest, err)
+		}
+	}
+}
+
+// catalogRemoteDestinations replaces staging paths in a catalog with the remote URLs the
+// collections are delivered to
+func catalogRemoteDestinations(catalog *Catalog, destinations []file.Destination) {
+	for i, entry := range catalog.Collections {
+		catalog.Collections[i].Destination = remoteDestination(destinations, entry.Destination)
+	}
+}
+
+// remoteDestination returns the remote URL a staged path is delivered to, or the path
+// itself if it isn't staged for a remote destination
+func remoteDestination(destinations []file.Destination, path string) string {
+	for _, dest := range destinations {
+		if dest.LocalDir() == dest.String() {
+			continue
+		}
+		staging, err := filepath.Abs(dest.LocalDir())
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(staging, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		remote := strings.TrimSuffix(dest.String(), "/")
+		if rel != "." {
+			remote = fmt.Sprintf("%s/%s", remote, filepath.ToSlash(rel))
+		}
+		return remote
+	}
+	return path
+}
@@ -0,0 +1,116 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestEncodeToMixedDestinations(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-destination-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	remoteDir := filepath.Join(tempDir, "remote")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte("destination test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// A fake remote scheme that "uploads" by copying into remoteDir/<host>, and "downloads"
+	// by copying back
+	var staging []string
+	file.RegisterDestinationScheme("fakeremote", func(ctx context.Context, u *url.URL) (file.Destination, error) {
+		target := filepath.Join(remoteDir, u.Host)
+		dest, err := file.NewStagedDestination(u.String(), func(ctx context.Context, localDir string) error {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			return os.CopyFS(target, os.DirFS(localDir))
+		})
+		if err != nil {
+			return nil, err
+		}
+		dest.Download = func(ctx context.Context, localDir string) error {
+			return os.CopyFS(localDir, os.DirFS(target))
+		}
+		staging = append(staging, dest.LocalDir())
+		return dest, nil
+	})
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	catalogPath := filepath.Join(tempDir, "catalog.json")
+	outputDirs := []string{
+		filepath.Join(tempDir, "usb1"),
+		"fakeremote://bucket2/share2",
+		"file://" + filepath.Join(tempDir, "usb3"),
+	}
+
+	cfg := EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          outputDirs[0],
+		OutputDirs:         outputDirs,
+		N:                  3,
+		K:                  2,
+		Format:             FormatBin,
+		ChunkSize:          64,
+		RNG:                pad.NewDefaultRand(ctx),
+		ClearIfNotEmpty:    true,
+		Compression:        CompressionNone,
+		ArchiveCollections: true,
+		CatalogPath:        catalogPath,
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(remoteDir, "bucket2", "2B3.tar")); err != nil {
+		t.Errorf("Expected collection to be uploaded to the remote destination: %v", err)
+	}
+	if _, err := os.Stat(staging[0]); !os.IsNotExist(err) {
+		t.Errorf("Expected staging directory %s to be removed", staging[0])
+	}
+
+	catalog, err := ReadCatalog(ctx, catalogPath, nil)
+	if err != nil {
+		t.Fatalf("Failed to read catalog: %v", err)
+	}
+	if got := catalog.Collections[1].Destination; got != "fakeremote://bucket2/share2/2B3.tar" {
+		t.Errorf("Expected remote destination in catalog, got %s", got)
+	}
+
+	// The collections decode once fetched from their destinations, which decode does itself
+	// for a destination it can read back from
+	outputDir := filepath.Join(tempDir, "output")
+	decodeCfg := DecodeConfig{
+		InputDirs:       []string{filepath.Join(tempDir, "usb1"), "fakeremote://bucket2/share2"},
+		OutputDir:       outputDir,
+		ClearIfNotEmpty: true,
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode directory: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "test.txt"))
+	if err != nil || string(data) != "destination test content" {
+		t.Errorf("Decoded content mismatch: %q, %v", data, err)
+	}
+	if _, err := os.Stat(staging[1]); !os.IsNotExist(err) {
+		t.Errorf("Expected download directory %s to be removed", staging[1])
+	}
+}
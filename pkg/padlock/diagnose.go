@@ -0,0 +1,145 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// diagnoseDecode explains why a decode of collections by p failed: which collection and
+// chunk failed and where that chunk is stored, how many chunks each collection has against
+// how many were written, and which collections or chunk files to restore, repair, or add.
+// Each finding is logged and returned, so that it can also be reported in the result.
+func diagnoseDecode(ctx context.Context, collections []file.Collection, p *pad.Pad, key []byte) []string {
+	log := trace.FromContext(ctx).WithPrefix("diagnose")
+
+	var findings []string
+	report := func(format string, args ...any) {
+		finding := fmt.Sprintf(format, args...)
+		log.Infof("%s", finding)
+		findings = append(findings, finding)
+	}
+
+	// The chunks that failed, and where each is stored
+	failed := make(map[int]bool)
+	for _, bad := range p.BadShares {
+		failed[bad.Share] = true
+		var chunkErr *file.ChunkError
+		if errors.As(bad.Err, &chunkErr) {
+			report("Collection %s, chunk %d: %s: %v", bad.Collection, bad.Chunk, chunkErr.Path, chunkErr.Err)
+		} else if bad.Share < len(collections) {
+			report("Collection %s, chunk %d (in %s): %v", bad.Collection, bad.Chunk, collections[bad.Share].Path, bad.Err)
+		} else {
+			report("Collection %s, chunk %d: %v", bad.Collection, bad.Chunk, bad.Err)
+		}
+	}
+
+	// The chunks each collection has, against the number that were written, which the
+	// metadata records, or failing that the most any collection has
+	expected := 0
+	counts := make([][]int, len(collections))
+	for i, coll := range collections {
+		if md, err := file.ReadMetadata(ctx, coll, key); err == nil {
+			expected = max(expected, md.Chunks)
+		}
+		numbers, err := file.ChunkNumbers(coll)
+		if err != nil {
+			log.Debugf("Can't count the chunks of collection %s: %v", coll.DiskName(), err)
+			continue
+		}
+		counts[i] = numbers
+	}
+	recorded := expected > 0
+	for _, numbers := range counts {
+		if !recorded {
+			expected = max(expected, len(numbers))
+		}
+	}
+	var summary []string
+	for i, coll := range collections {
+		if counts[i] != nil {
+			summary = append(summary, fmt.Sprintf("%s %d", coll.DiskName(), len(counts[i])))
+		}
+	}
+	if len(summary) > 0 {
+		source := "the most any collection has"
+		if recorded {
+			source = "as recorded in the metadata"
+		}
+		report("Chunks per collection: %s; expected %d, %s", strings.Join(summary, ", "), expected, source)
+	}
+	for i, coll := range collections {
+		numbers := counts[i]
+		if numbers == nil || len(numbers) == expected {
+			continue
+		}
+		failed[i] = true
+		if len(numbers) > expected {
+			report("Collection %s (%s) has %d chunks, but only %d were written; remove any chunk files that don't belong to it", coll.DiskName(), coll.Path, len(numbers), expected)
+			continue
+		}
+		line := fmt.Sprintf("Collection %s (%s) has %d of its %d chunks", coll.DiskName(), coll.Path, len(numbers), expected)
+		if missing := missingChunks(numbers, expected); missing != "" {
+			line += "; missing chunks " + missing
+		}
+		report("%s", line)
+	}
+
+	// What to do about it: restore or regenerate each collection that failed, and if too few
+	// good ones are left, add others
+	for i, coll := range collections {
+		if failed[i] {
+			report("Restore %s from another copy of collection %s if there is one, or regenerate it with padlock repair", coll.Path, coll.DiskName())
+		}
+	}
+	k, n := p.RequiredCopies, p.TotalCopies
+	good := make(map[string]bool)
+	for i, coll := range collections {
+		if !failed[i] {
+			good[coll.Name] = true
+		}
+	}
+	if k > 0 && len(failed) > 0 && len(good) < k {
+		report("Too few good collections are left to decode: %s", missingCollections(k, n, good))
+	}
+	if len(findings) == 0 {
+		report("No chunk was found missing or corrupt; run padlock verify on the collections to check every chunk")
+	}
+	return findings
+}
+
+// missingChunks describes the chunks from 1 to expected that numbers doesn't have, as ranges
+// such as "3, 7-9", or "" if they can't be told because some chunks have no number
+func missingChunks(numbers []int, expected int) string {
+	have := make(map[int]bool, len(numbers))
+	for _, number := range numbers {
+		if number == 0 {
+			return ""
+		}
+		have[number] = true
+	}
+	var ranges []string
+	for first := 1; first <= expected; first++ {
+		if have[first] {
+			continue
+		}
+		last := first
+		for last < expected && !have[last+1] {
+			last++
+		}
+		if last == first {
+			ranges = append(ranges, fmt.Sprint(first))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", first, last))
+		}
+		first = last
+	}
+	return strings.Join(ranges, ", ")
+}
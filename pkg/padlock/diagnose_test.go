@@ -0,0 +1,107 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestDiagnoseDecode checks that a failed decode reports the collection, chunk, and file that
+// failed, the chunks each collection has against the number written, and what to restore
+func TestDiagnoseDecode(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "data.txt"), bytes.Repeat([]byte("d"), 10000), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	encodedDir := filepath.Join(tempDir, "encoded")
+	err := EncodeDirectory(ctx, EncodeConfig{
+		InputDir:    inputDir,
+		OutputDir:   encodedDir,
+		N:           3,
+		K:           2,
+		Format:      FormatBin,
+		ChunkSize:   512,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionNone,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	md, err := file.ReadMetadata(ctx, file.Collection{Name: "2A3", Path: filepath.Join(encodedDir, "2A3")}, nil)
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	chunks := md.Chunks
+
+	// 2C3 is gone, chunk 3 of 2A3 is corrupt, and 2B3 lost its last two chunks
+	os.RemoveAll(filepath.Join(encodedDir, "2C3"))
+	badChunk := filepath.Join(encodedDir, "2A3", "2A3_0003.bin")
+	data, err := os.ReadFile(badChunk)
+	if err != nil {
+		t.Fatalf("Failed to read chunk: %v", err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(badChunk, data, 0644); err != nil {
+		t.Fatalf("Failed to write chunk: %v", err)
+	}
+	for _, number := range []int{chunks - 1, chunks} {
+		os.Remove(filepath.Join(encodedDir, "2B3", fmt.Sprintf("2B3_%04d.bin", number)))
+	}
+
+	var result Result
+	err = DecodeDirectory(ctx, DecodeConfig{InputDir: encodedDir, OutputDir: filepath.Join(tempDir, "decoded"), Compression: CompressionNone, Result: &result})
+	if err == nil {
+		t.Fatalf("Expected the decode to fail")
+	}
+	diagnosis := strings.Join(result.Diagnosis, "\n")
+	for _, want := range []string{
+		fmt.Sprintf("Collection 2A3, chunk 3: %s", badChunk),
+		fmt.Sprintf("Chunks per collection: 2A3 %d, 2B3 %d; expected %d, as recorded in the metadata", chunks, chunks-2, chunks),
+		fmt.Sprintf("has %d of its %d chunks; missing chunks %d-%d", chunks-2, chunks, chunks-1, chunks),
+		"Restore " + filepath.Join(encodedDir, "2A3"),
+		"Restore " + filepath.Join(encodedDir, "2B3"),
+		"need 2 of 3 collections, found 0; add any 2 of 2A3, 2B3, 2C3",
+	} {
+		if !strings.Contains(diagnosis, want) {
+			t.Errorf("Expected the diagnosis to mention %q:\n%s", want, diagnosis)
+		}
+	}
+}
+
+func TestMissingChunks(t *testing.T) {
+	tests := []struct {
+		numbers  []int
+		expected int
+		want     string
+	}{
+		{[]int{1, 2, 3}, 3, ""},
+		{[]int{1, 2}, 5, "3-5"},
+		{[]int{2, 5, 6}, 8, "1, 3-4, 7-8"},
+		{[]int{1, 0, 3}, 3, ""},
+		{nil, 1, "1"},
+	}
+	for _, tt := range tests {
+		if got := missingChunks(tt.numbers, tt.expected); got != tt.want {
+			t.Errorf("missingChunks(%v, %d) = %q, want %q", tt.numbers, tt.expected, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+const (
+	// chunkFileOverhead is the space each chunk file takes beyond its data: its name in the
+	// directory, its TAR or ZIP header and padding, and its checksum sidecar, if any
+	chunkFileOverhead = 1024
+
+	// collectionOverhead is the space each collection takes beyond its chunks: its metadata,
+	// MACs, README, and the progress an encode records in it
+	collectionOverhead = 64 * 1024
+)
+
+// freeSpace returns the bytes free to an unprivileged user on the filesystem holding dir, and
+// an identifier of that filesystem, so that directories on the same one can be told apart
+// from those on others. It is a variable so that tests can simulate a full disk.
+var freeSpace = diskFreeSpace
+
+// spaceNeed is the space an operation needs in one of its output directories
+type spaceNeed struct {
+	dir   string
+	bytes int64
+}
+
+// checkEncodeSpace refuses an encode whose collections, as estimated from the size of the
+// input, won't fit in the free space of their output directories, so that it fails before
+// anything is written rather than when a disk fills up. The estimate assumes the input doesn't
+// compress; if that doesn't fit and the input is compressed, it is compressed once to measure
+// it. Encodes whose output size can't be told in advance, such as those from a stream or
+// with cover images, aren't checked.
+func checkEncodeSpace(ctx context.Context, cfg EncodeConfig) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if cfg.SkipSpaceCheck || cfg.SizeOnly || cfg.Resume || cfg.InputStream != nil || cfg.RawInput != nil || cfg.ChunkSink != nil ||
+		cfg.CoverDir != "" || cfg.GeneratedCovers {
+		return nil
+	}
+
+	inputBytes, err := file.EstimateDirectoriesSizeWithFilter(ctx, cfg.inputDirs(), cfg.Filter)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	needs, err := encodeSpaceNeeds(cfg, inputBytes)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	err = checkFreeSpace(ctx, "encode", needs)
+	if err == nil {
+		return nil
+	}
+	if cfg.Compression == CompressionNone {
+		log.Error(err)
+		return err
+	}
+
+	// The input may compress enough to fit, which only compressing it can tell
+	log.Infof("Measuring the compressed size of the input, since it won't fit uncompressed")
+	_, compressedBytes, merr := measureInput(ctx, cfg.inputDirs(), cfg.Filter, cfg.Compression, cfg.CompressionLevel)
+	if merr != nil {
+		return merr
+	}
+	if compressedBytes == 0 {
+		log.Error(err)
+		return err
+	}
+	if needs, err = encodeSpaceNeeds(cfg, compressedBytes); err != nil {
+		log.Error(err)
+		return err
+	}
+	if err = checkFreeSpace(ctx, "encode", needs); err != nil {
+		log.Error(err)
+	}
+	return err
+}
+
+// encodeSpaceNeeds returns the space each output directory of cfg needs for an encode of
+// inputBytes of serialized input: every collection when there is one output directory, and
+// one collection in each when there are several, or as many as its weight
+func encodeSpaceNeeds(cfg EncodeConfig, inputBytes int64) ([]spaceNeed, error) {
+	if cfg.PadTo.Mode != PadNone {
+		padded, err := cfg.PadTo.Target(inputBytes)
+		if err != nil {
+			// A fixed padding the estimate overshoots is still the size of the data
+			padded = cfg.PadTo.Size
+		}
+		inputBytes = padded
+	}
+	sizes := make([]int64, cfg.N)
+	for i := range sizes {
+		size, err := estimateCollectionSpace(cfg, cfg.collectionFormat(i), inputBytes)
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = size
+	}
+	if len(cfg.OutputDirs) > 1 {
+		outputDirs := cfg.collectionOutputDirs()
+		needs := make([]spaceNeed, len(outputDirs))
+		for i, dir := range outputDirs {
+			needs[i] = spaceNeed{dir: dir, bytes: sizes[i]}
+		}
+		return needs, nil
+	}
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	return []spaceNeed{{dir: cfg.OutputDir, bytes: total}}, nil
+}
+
+// estimateCollectionSpace returns roughly the space one collection of an encode of cfg,
+// written in format, takes on disk for inputBytes of serialized input: the chunk data the dry
+// run reports, grown by the format, with room for each chunk file and its sidecars and for
+// the collection's own files. It errs on the side of too much.
+func estimateCollectionSpace(cfg EncodeConfig, format Format, inputBytes int64) (int64, error) {
+	sharing := cfg.sharing()
+	data, err := pad.EncodedCollectionSizeWith(sharing, cfg.N, cfg.K, cfg.ChunkSize, inputBytes)
+	if err != nil {
+		return 0, err
+	}
+	inputChunkBytes := int64(cfg.ChunkSize) / sharing.Pieces(cfg.N, cfg.K)
+	chunks := (inputBytes + inputChunkBytes - 1) / inputChunkBytes
+
+	// Text is base64 with a newline every 64 characters, and each audio file holds a second
+	// of silence besides its data
+	perChunk := int64(chunkFileOverhead)
+	switch format {
+	case FormatText:
+		data = data * 136 / 100
+	case FormatWAV:
+		perChunk += 8 * 1024
+	}
+	sidecars := max(cfg.ParityPercent, 0) + max(cfg.Par2Percent, 0)
+	size := data + data*int64(sidecars)/100 + data/100
+	size += chunks*perChunk + collectionOverhead
+	return size, nil
+}
+
+// checkDecodeSpace refuses a decode whose output won't fit in the free space of its output
+// directory. The collections' metadata records how many chunks they have and how large, from
+// which the size of the serialized data follows. Compressed data restores to at least that
+// much, so the check errs on the side of letting a decode start; data that was padded
+// restores to less, so -no-space-check may be needed to decode it onto a nearly full disk.
+// A decode of a hidden volume, one being resumed, one restoring only some files, or one
+// written to an output stream isn't checked.
+func checkDecodeSpace(ctx context.Context, cfg DecodeConfig, collections []file.Collection) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if cfg.SkipSpaceCheck || cfg.SizeOnly || cfg.Resume || cfg.OutputStream != nil || cfg.Filter != nil || len(cfg.HiddenKey) > 0 || len(collections) == 0 {
+		return nil
+	}
+	need := decodeOutputSize(ctx, collections, cfg.MetadataKey)
+	if need == 0 {
+		log.Debugf("The size of the decoded data isn't recorded; not checking free space")
+		return nil
+	}
+	err := checkFreeSpace(ctx, "decode", []spaceNeed{{dir: cfg.OutputDir, bytes: need}})
+	if err != nil {
+		log.Error(err)
+	}
+	return err
+}
+
+// decodeOutputSize returns the size of the serialized data the collections encode, not
+// counting their last chunk, which may be short, or 0 if no metadata records it or the data
+// was deduplicated
+func decodeOutputSize(ctx context.Context, collections []file.Collection, key []byte) int64 {
+	for _, coll := range collections {
+		md, err := file.ReadMetadata(ctx, coll, key)
+		if err != nil || md.Chunks == 0 || md.ChunkSize == 0 || md.Copies == 0 || md.Required == 0 {
+			continue
+		}
+		if md.Dedup {
+			// Repeated blocks are stored once, so the data decodes to more than the chunks hold
+			return 0
+		}
+		sharing, err := pad.SharingByName(md.Sharing)
+		if err != nil {
+			continue
+		}
+		inputChunkBytes := int64(md.ChunkSize) / sharing.Pieces(md.Copies, md.Required)
+		return int64(md.Chunks-1) * inputChunkBytes
+	}
+	return 0
+}
+
+// checkFreeSpace checks that each filesystem has the space the needs of the directories on it
+// add up to, and returns an error wrapping ErrInsufficientSpace with the shortfall of the
+// first that doesn't. Filesystems whose free space can't be told are assumed to have enough.
+func checkFreeSpace(ctx context.Context, operation string, needs []spaceNeed) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	type volume struct {
+		dirs []string
+		need int64
+		free int64
+	}
+	var order []string
+	volumes := make(map[string]*volume)
+	for _, need := range needs {
+		free, id, err := freeSpace(need.dir)
+		if err != nil {
+			log.Debugf("Can't tell the free space in %s: %v", need.dir, err)
+			continue
+		}
+		v, ok := volumes[id]
+		if !ok {
+			v = &volume{free: free}
+			volumes[id] = v
+			order = append(order, id)
+		}
+		v.dirs = append(v.dirs, need.dir)
+		v.need += need.bytes
+	}
+
+	for _, id := range order {
+		v := volumes[id]
+		log.Debugf("The %s needs about %s in %s, which has %s free", operation, FormatByteSize(v.need),
+			strings.Join(v.dirs, ", "), FormatByteSize(v.free))
+		if v.need > v.free {
+			return fmt.Errorf("not enough free space in %s to %s: it needs about %s, but only %s is free, %s short; free some space or use -no-space-check: %w",
+				strings.Join(v.dirs, ", "), operation, FormatByteSize(v.need), FormatByteSize(v.free),
+				FormatByteSize(v.need-v.free), ErrInsufficientSpace)
+		}
+	}
+	return nil
+}
+
+// existingParent returns the absolute path of dir, or of its nearest parent that exists if it
+// doesn't exist yet, which is on the filesystem dir will be created on
+func existingParent(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil || dir == filepath.Dir(dir) {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+}
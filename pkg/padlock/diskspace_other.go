@@ -0,0 +1,12 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+//go:build !linux && !darwin && !freebsd && !windows
+
+package padlock
+
+import "errors"
+
+// diskFreeSpace can't tell the free space on this platform, so free space isn't checked
+func diskFreeSpace(dir string) (int64, string, error) {
+	return 0, "", errors.ErrUnsupported
+}
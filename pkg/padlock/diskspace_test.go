@@ -0,0 +1,200 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// withFreeSpace makes every directory appear to be on one filesystem with free bytes free
+func withFreeSpace(t *testing.T, free int64) {
+	saved := freeSpace
+	freeSpace = func(dir string) (int64, string, error) { return free, "disk", nil }
+	t.Cleanup(func() { freeSpace = saved })
+}
+
+// TestDiskFreeSpace checks that the free space of a directory, and of one not yet created in
+// it, can be told on this platform
+func TestDiskFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	free, id, err := diskFreeSpace(dir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("free space can't be told on this platform")
+	}
+	if err != nil || free <= 0 || id == "" {
+		t.Fatalf("Expected the free space of %s, got %d on %q (%v)", dir, free, id, err)
+	}
+	if _, missingID, err := diskFreeSpace(filepath.Join(dir, "not", "yet")); err != nil || missingID != id {
+		t.Errorf("Expected a directory not yet created to be on %q, got %q (%v)", id, missingID, err)
+	}
+}
+
+// TestEstimateCollectionSpace checks that the space estimated for a collection is at least
+// what an encode of each format writes
+func TestEstimateCollectionSpace(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	data := make([]byte, 200000)
+	rand.Read(data)
+	if err := os.WriteFile(filepath.Join(inputDir, "random.bin"), data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	for _, format := range []Format{FormatBin, FormatText, FormatPNG, FormatWAV} {
+		outputDir := filepath.Join(tempDir, string(format))
+		cfg := EncodeConfig{
+			InputDir:    inputDir,
+			OutputDir:   outputDir,
+			N:           3,
+			K:           2,
+			Format:      format,
+			ChunkSize:   16 * 1024,
+			RNG:         pad.NewDefaultRand(ctx),
+			Compression: CompressionNone,
+		}
+		if err := EncodeDirectory(ctx, cfg); err != nil {
+			t.Fatalf("Failed to encode %s: %v", format, err)
+		}
+		needs, err := encodeSpaceNeeds(cfg, int64(len(data))+16*1024)
+		if err != nil {
+			t.Fatalf("Failed to estimate %s: %v", format, err)
+		}
+		var written int64
+		filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				written += info.Size()
+			}
+			return nil
+		})
+		if len(needs) != 1 || needs[0].bytes < written {
+			t.Errorf("Expected at least the %d bytes written for %s, estimated %+v", written, format, needs)
+		}
+	}
+}
+
+// TestEncodeInsufficientSpace checks that an encode that won't fit is refused before any chunk
+// is written, with the shortfall, that one whose input compresses enough to fit isn't, and that
+// the check can be skipped
+func TestEncodeInsufficientSpace(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "zeros.bin"), bytes.Repeat([]byte{0}, 4<<20), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	encode := func(outputDirs []string, compression Compression, skip bool) error {
+		return EncodeDirectory(ctx, EncodeConfig{
+			InputDir:        inputDir,
+			OutputDir:       outputDirs[0],
+			OutputDirs:      outputDirs,
+			N:               3,
+			K:               2,
+			Format:          FormatBin,
+			ChunkSize:       64 * 1024,
+			RNG:             pad.NewDefaultRand(ctx),
+			Compression:     compression,
+			ClearIfNotEmpty: true,
+			SkipSpaceCheck:  skip,
+		})
+	}
+
+	// 4 MiB of zeros needs about 24 MiB uncompressed, and much less compressed
+	withFreeSpace(t, 8<<20)
+	outputDir := filepath.Join(tempDir, "output")
+	err := encode([]string{outputDir}, CompressionNone, false)
+	if !errors.Is(err, ErrInsufficientSpace) || !strings.Contains(err.Error(), "short") {
+		t.Fatalf("Expected the encode to be refused with the shortfall, got %v", err)
+	}
+	if entries, _ := os.ReadDir(outputDir); len(entries) != 0 {
+		t.Errorf("Expected nothing to be written, found %d entries", len(entries))
+	}
+
+	// Directories on one filesystem share its free space
+	dirs := []string{filepath.Join(tempDir, "a"), filepath.Join(tempDir, "b"), filepath.Join(tempDir, "c")}
+	withFreeSpace(t, 20<<20)
+	if err := encode(dirs, CompressionNone, false); !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("Expected three collections on one full filesystem to be refused, got %v", err)
+	}
+
+	withFreeSpace(t, 8<<20)
+	if err := encode([]string{outputDir}, CompressionGzip, false); err != nil {
+		t.Errorf("Expected the compressed encode to fit, got %v", err)
+	}
+	if err := encode([]string{outputDir}, CompressionNone, true); err != nil {
+		t.Errorf("Expected the encode to start without the check, got %v", err)
+	}
+}
+
+// TestDecodeInsufficientSpace checks that a decode whose data won't fit is refused before
+// anything is restored, and that the check can be skipped
+func TestDecodeInsufficientSpace(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	if err := os.WriteFile(filepath.Join(inputDir, "random.bin"), data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	encodedDir := filepath.Join(tempDir, "encoded")
+	err := EncodeDirectory(ctx, EncodeConfig{
+		InputDir:    inputDir,
+		OutputDir:   encodedDir,
+		N:           3,
+		K:           2,
+		Format:      FormatBin,
+		ChunkSize:   64 * 1024,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	withFreeSpace(t, 512*1024)
+	outputDir := filepath.Join(tempDir, "decoded")
+	err = DecodeDirectory(ctx, DecodeConfig{InputDir: encodedDir, OutputDir: outputDir, Compression: CompressionGzip})
+	if !errors.Is(err, ErrInsufficientSpace) {
+		t.Fatalf("Expected the decode to be refused, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "random.bin")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be restored, got %v", err)
+	}
+
+	err = DecodeDirectory(ctx, DecodeConfig{InputDir: encodedDir, OutputDir: outputDir, Compression: CompressionGzip, ClearIfNotEmpty: true, SkipSpaceCheck: true})
+	if err != nil {
+		t.Fatalf("Expected the decode to start without the check, got %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(outputDir, "random.bin")); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("random.bin was not restored (%v)", err)
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+//go:build linux || darwin || freebsd
+
+package padlock
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// diskFreeSpace returns the bytes free to an unprivileged user on the filesystem holding dir,
+// and its device number as the identifier of the filesystem
+func diskFreeSpace(dir string) (int64, string, error) {
+	dir = existingParent(dir)
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return 0, "", err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != nil {
+		return 0, "", err
+	}
+	return int64(fs.Bavail) * int64(fs.Bsize), fmt.Sprint(uint64(st.Dev)), nil
+}
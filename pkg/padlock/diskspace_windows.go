@@ -0,0 +1,29 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+//go:build windows
+
+package padlock
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// diskFreeSpace returns the bytes free to the current user on the volume holding dir, and
+// the volume name, such as C: or \\server\share, as the identifier of the volume
+func diskFreeSpace(dir string) (int64, string, error) {
+	dir = existingParent(dir)
+	path, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, "", err
+	}
+	var free uint64
+	if ok, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(&free)), 0, 0); ok == 0 {
+		return 0, "", err
+	}
+	return int64(free), strings.ToUpper(filepath.VolumeName(dir)), nil
+}
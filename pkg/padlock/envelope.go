@@ -0,0 +1,71 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// ErrEnvelopeKeyRequired is returned when the collections record that the data was encrypted
+// in an envelope and no envelope key was given.
+var ErrEnvelopeKeyRequired = errors.New("data is encrypted in an envelope; an envelope key is required")
+
+// collectionEnvelope returns the envelope recorded in the metadata of the collections, or nil
+// if the data wasn't encrypted in one. An envelope needs envelopeKey, and envelopeKey needs an
+// envelope, which sealed metadata only reveals with metadataKey. Collections that record
+// different envelopes were encoded separately and can't be decoded together.
+func collectionEnvelope(ctx context.Context, collections []file.Collection, metadataKey, envelopeKey []byte) (*file.Envelope, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	var envelope *file.Envelope
+	var from string
+	sealed := false
+	for _, coll := range collections {
+		md, err := file.ReadMetadata(ctx, coll, metadataKey)
+		if errors.Is(err, file.ErrMetadataSealed) {
+			sealed = true
+		}
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				log.Debugf("No envelope from collection %s: %v", coll.DiskName(), err)
+			}
+			continue
+		}
+		if md.Envelope == nil {
+			continue
+		}
+		if envelope == nil {
+			envelope, from = md.Envelope, coll.Name
+			continue
+		}
+		if !md.Envelope.Equal(envelope) {
+			err := fmt.Errorf("collections %s and %s were encrypted in different envelopes: %w", from, coll.Name, ErrMixedSessions)
+			log.Error(err)
+			return nil, err
+		}
+	}
+
+	var err error
+	switch {
+	case envelope != nil && len(envelopeKey) == 0:
+		err = ErrEnvelopeKeyRequired
+	case envelope == nil && len(envelopeKey) > 0 && sealed:
+		err = fmt.Errorf("an envelope key was given, but the envelope is recorded in encrypted metadata: %w", file.ErrMetadataSealed)
+	case envelope == nil && len(envelopeKey) > 0:
+		err = fmt.Errorf("an envelope key was given, but the collections record no envelope")
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if envelope != nil {
+		log.Infof("Decrypting the %s envelope of the data", envelope.Cipher)
+	}
+	return envelope, nil
+}
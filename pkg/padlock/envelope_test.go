@@ -0,0 +1,113 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestEnvelope encodes data in an AES-256-GCM envelope, and checks that its parameters are
+// recorded in the metadata and that decode and reshare need and keep them
+func TestEnvelope(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	testContent := strings.Repeat("defense in depth ", 5000)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(testContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	envelopeKey := []byte("envelope key")
+	metadataKey := []byte("metadata key")
+
+	decode := func(encodedDir, name string, cfg DecodeConfig) error {
+		cfg.InputDirs = []string{encodedDir}
+		cfg.OutputDir = filepath.Join(tempDir, name)
+		cfg.Compression = CompressionGzip
+		err := DecodeDirectory(ctx, cfg)
+		if err == nil {
+			if decoded, err := os.ReadFile(filepath.Join(cfg.OutputDir, "test.txt")); err != nil || string(decoded) != testContent {
+				t.Errorf("%s: decoded content does not match the original (%v)", name, err)
+			}
+		}
+		return err
+	}
+
+	for _, archive := range []bool{false, true} {
+		encodedDir := filepath.Join(tempDir, "encoded", map[bool]string{false: "files", true: "tar"}[archive])
+		err := EncodeDirectory(ctx, EncodeConfig{
+			InputDir:           inputDir,
+			OutputDir:          encodedDir,
+			N:                  3,
+			K:                  2,
+			Format:             FormatBin,
+			ChunkSize:          4096,
+			RNG:                pad.NewDefaultRand(ctx),
+			Compression:        CompressionGzip,
+			ArchiveCollections: archive,
+			EnvelopeKey:        envelopeKey,
+		})
+		if err != nil {
+			t.Fatalf("archive=%v: failed to encode: %v", archive, err)
+		}
+		name := filepath.Base(encodedDir)
+		if err := decode(encodedDir, name, DecodeConfig{EnvelopeKey: envelopeKey}); err != nil {
+			t.Errorf("archive=%v: failed to decode: %v", archive, err)
+		}
+	}
+
+	encodedDir := filepath.Join(tempDir, "encoded", "files")
+	md, err := file.ReadMetadata(ctx, file.Collection{Name: "2A3", Path: filepath.Join(encodedDir, "2A3")}, nil)
+	if err != nil || md.Envelope == nil || md.Envelope.Cipher != file.EnvelopeCipher || md.Envelope.Nonce == "" || md.Envelope.Salt == "" {
+		t.Fatalf("Expected the metadata to record the envelope: %+v, %v", md, err)
+	}
+	if err := decode(encodedDir, "missing", DecodeConfig{}); !errors.Is(err, ErrEnvelopeKeyRequired) {
+		t.Errorf("Expected ErrEnvelopeKeyRequired without the key, got %v", err)
+	}
+	if err := decode(encodedDir, "wrong", DecodeConfig{EnvelopeKey: []byte("wrong")}); !errors.Is(err, file.ErrEnvelopeAuth) {
+		t.Errorf("Expected ErrEnvelopeAuth with the wrong key, got %v", err)
+	}
+
+	// Re-sharing keeps the envelope, and its record in the metadata
+	resharedDir := filepath.Join(tempDir, "reshared")
+	err = ReshareCollections(ctx, ReshareConfig{
+		InputDirs: []string{encodedDir},
+		Encode:    EncodeConfig{OutputDir: resharedDir, N: 2, K: 2, Format: FormatBin, ChunkSize: 4096, RNG: pad.NewDefaultRand(ctx), MetadataKey: metadataKey},
+	})
+	if err != nil {
+		t.Fatalf("Failed to reshare: %v", err)
+	}
+	reshared, err := file.ReadMetadata(ctx, file.Collection{Name: "2B2", Path: filepath.Join(resharedDir, "2B2")}, metadataKey)
+	if err != nil || !reshared.Envelope.Equal(md.Envelope) || reshared.Compression != "gzip" {
+		t.Errorf("Expected the reshared metadata to keep the envelope and compression: %+v, %v", reshared, err)
+	}
+
+	// With sealed metadata the envelope is only found with the metadata key
+	if err := decode(resharedDir, "sealed", DecodeConfig{EnvelopeKey: envelopeKey}); !errors.Is(err, file.ErrMetadataSealed) {
+		t.Errorf("Expected ErrMetadataSealed without the metadata key, got %v", err)
+	}
+	if err := decode(resharedDir, "unsealed", DecodeConfig{EnvelopeKey: envelopeKey, MetadataKey: metadataKey}); err != nil {
+		t.Errorf("Failed to decode the reshared collections: %v", err)
+	}
+	err = ReshareCollections(ctx, ReshareConfig{
+		InputDirs: []string{resharedDir},
+		Encode:    EncodeConfig{OutputDir: filepath.Join(tempDir, "reshared-again"), N: 3, K: 2, Format: FormatBin, ChunkSize: 4096, RNG: pad.NewDefaultRand(ctx)},
+	})
+	if !errors.Is(err, file.ErrMetadataSealed) {
+		t.Errorf("Expected reshare of sealed metadata without its key to fail, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+)
+
+// An encode with Formats writes each collection in a chunk format of its own, such as PNG for
+// a collection kept with cloud photos and bin for one kept on a NAS, in place of the single
+// Format. Each collection's metadata records its format, as it always has, and decode reads
+// every collection in the format it finds, so collections of one session may be in different
+// formats.
+
+// ParseFormats parses a comma-separated list of chunk formats, such as png,bin,png
+func ParseFormats(s string) ([]Format, error) {
+	var formats []Format
+	for _, part := range strings.Split(s, ",") {
+		format := Format(strings.ToLower(strings.TrimSpace(part)))
+		switch format {
+		case FormatBin, FormatPNG, FormatText, FormatWAV:
+			formats = append(formats, format)
+		default:
+			return nil, fmt.Errorf("unknown format %q: expected bin, png, txt, or wav", part)
+		}
+	}
+	return formats, nil
+}
+
+// checkFormats refuses Formats that don't give one format for each collection, or for each
+// output directory of an encode with Weights, or an encode whose collections can't each be
+// written in a format of their own
+func checkFormats(cfg EncodeConfig) error {
+	if len(cfg.Formats) == 0 {
+		return nil
+	}
+	switch {
+	case cfg.ChunkSink != nil:
+		return fmt.Errorf("the chunks of a sink aren't written in a format")
+	case cfg.Resume:
+		return fmt.Errorf("an encode with a format for each collection can't be resumed")
+	case len(cfg.Weights) > 0 && !cfg.weighted && len(cfg.Formats) != len(cfg.OutputDirs):
+		return fmt.Errorf("%d formats given for %d weighted output directories", len(cfg.Formats), len(cfg.OutputDirs))
+	case (len(cfg.Weights) == 0 || cfg.weighted) && len(cfg.Formats) != cfg.N:
+		return fmt.Errorf("%d formats given for %d collections", len(cfg.Formats), cfg.N)
+	}
+	return nil
+}
+
+// collectionFormat returns the chunk format collection i of an encode of cfg is written in
+func (cfg EncodeConfig) collectionFormat(i int) Format {
+	if i < len(cfg.Formats) {
+		return cfg.Formats[i]
+	}
+	return cfg.Format
+}
+
+// usesFormat reports whether any collection of an encode of cfg is written in format
+func (cfg EncodeConfig) usesFormat(format Format) bool {
+	if len(cfg.Formats) > 0 {
+		return slices.Contains(cfg.Formats, format)
+	}
+	return cfg.Format == format
+}
+
+// formatDescription names the chunk format of an encode of cfg, or the format of each of its
+// collections, such as png,bin,png, if they differ
+func (cfg EncodeConfig) formatDescription() string {
+	if len(cfg.Formats) == 0 || !slices.ContainsFunc(cfg.Formats, func(f Format) bool { return f != cfg.Formats[0] }) {
+		return string(cfg.collectionFormat(0))
+	}
+	names := make([]string, len(cfg.Formats))
+	for i, format := range cfg.Formats {
+		names[i] = string(format)
+	}
+	return strings.Join(names, ",")
+}
+
+// verifyCollectionFormats runs VerifyCollectionIntegrity over the collections of each format
+func verifyCollectionFormats(ctx context.Context, collections []file.Collection) error {
+	var formats []Format
+	for _, coll := range collections {
+		if !slices.Contains(formats, coll.Format) {
+			formats = append(formats, coll.Format)
+		}
+	}
+	var errs []error
+	for _, format := range formats {
+		same := slices.DeleteFunc(slices.Clone(collections), func(coll file.Collection) bool { return coll.Format != format })
+		if err := VerifyCollectionIntegrity(ctx, same, format); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
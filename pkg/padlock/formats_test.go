@@ -0,0 +1,82 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestParseFormats(t *testing.T) {
+	if got, err := ParseFormats("png, BIN,txt,wav"); err != nil || !slices.Equal(got, []Format{FormatPNG, FormatBin, FormatText, FormatWAV}) {
+		t.Errorf("ParseFormats = %v, %v", got, err)
+	}
+	for _, s := range []string{"png,gif", "png,,bin", ""} {
+		if got, err := ParseFormats(s); err == nil {
+			t.Errorf("ParseFormats(%q) = %v, expected an error", s, got)
+		}
+	}
+}
+
+// TestMixedFormatsRoundTrip checks that each collection is written in its own format, and that
+// collections in different formats restore the data together
+func TestMixedFormatsRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	writeFiles(t, inputDir, map[string]string{"a.txt": "mixed"})
+
+	dirs := []string{filepath.Join(tempDir, "photos"), filepath.Join(tempDir, "nas"), filepath.Join(tempDir, "print")}
+	formats := []Format{FormatPNG, FormatBin, FormatText}
+	var result Result
+	cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(dirs...), WithScheme(2, 3), WithFormats(formats...),
+		WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	cfg.Result = &result
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if result.Format != "png,bin,txt" {
+		t.Errorf("Expected the result to name each format, got %q", result.Format)
+	}
+	for i, dir := range dirs {
+		collections, _, err := file.FindCollections(ctx, dir)
+		if err != nil || len(collections) != 1 {
+			t.Fatalf("Expected a collection in %s, got %d (%v)", dir, len(collections), err)
+		}
+		md, err := file.ReadMetadata(ctx, collections[0], nil)
+		if err != nil {
+			t.Fatalf("Failed to read metadata: %v", err)
+		}
+		if md.Format != formats[i] {
+			t.Errorf("Expected the collection in %s to be written as %s, got %s", dir, formats[i], md.Format)
+		}
+	}
+
+	// Any two of the collections restore the data, whatever their formats
+	for _, pair := range [][]string{{dirs[0], dirs[1]}, {dirs[1], dirs[2]}} {
+		decodeDir := filepath.Join(tempDir, "decoded-"+filepath.Base(pair[0])+"-"+filepath.Base(pair[1]))
+		decodeCfg, err := NewDecodeConfig(WithInputs(pair...), WithOutput(decodeDir))
+		if err != nil {
+			t.Fatalf("NewDecodeConfig failed: %v", err)
+		}
+		if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+			t.Fatalf("Failed to decode from %v: %v", pair, err)
+		}
+		if got, err := os.ReadFile(filepath.Join(decodeDir, "a.txt")); err != nil || string(got) != "mixed" {
+			t.Errorf("Expected the data to be restored from %v, got %q (%v)", pair, got, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// checkHidden checks that a hidden volume, if one is asked for, has a secret and padding to
+// hide in
+func checkHidden(ctx context.Context, cfg EncodeConfig) error {
+	if cfg.HiddenDir == "" {
+		if len(cfg.HiddenKey) > 0 {
+			return fmt.Errorf("a hidden volume key was given without a hidden directory to encode")
+		}
+		return nil
+	}
+	if len(cfg.HiddenKey) == 0 {
+		return fmt.Errorf("a hidden volume needs a key to hide it with")
+	}
+	if cfg.PadTo.Mode == PadNone {
+		return fmt.Errorf("a hidden volume is carried in the padding of the data, so it needs padding")
+	}
+	return file.ValidateInputDirectory(ctx, cfg.HiddenDir)
+}
+
+// padStream pads r as cfg.PadTo says, with cfg.HiddenDir serialized, compressed like the
+// data, and hidden in the padding if it is set. The returned function discards the hidden
+// volume once the stream has been read.
+func padStream(ctx context.Context, cfg EncodeConfig, r io.Reader) (io.Reader, func(), error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if cfg.PadTo.Mode == PadNone {
+		return r, func() {}, nil
+	}
+	log.Debugf("Padding the stream to %s", cfg.PadTo)
+	if cfg.HiddenDir == "" {
+		return file.PadStream(ctx, r, cfg.PadTo.Target), func() {}, nil
+	}
+
+	log.Infof("Hiding %s in the padding", cfg.HiddenDir)
+	tarStream, err := file.SerializeDirectoryToStream(ctx, cfg.HiddenDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to serialize hidden directory: %w", err)
+	}
+	defer tarStream.Close()
+	var serialized io.Reader = tarStream
+	if compression := cfg.Compression.effective(); compression != CompressionNone {
+		if serialized, err = file.CompressStream(ctx, tarStream, compression.String(), cfg.CompressionLevel); err != nil {
+			return nil, nil, fmt.Errorf("failed to compress hidden directory: %w", err)
+		}
+	}
+	hidden, err := file.NewHiddenVolume(ctx, serialized, cfg.HiddenKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file.PadStreamHiding(ctx, r, cfg.PadTo.Target, hidden), func() { hidden.Close() }, nil
+}
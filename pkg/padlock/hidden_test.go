@@ -0,0 +1,114 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestHiddenVolume(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	write := func(dir, name, content string) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	decoyDir := filepath.Join(tempDir, "decoy")
+	hiddenDir := filepath.Join(tempDir, "hidden")
+	write(decoyDir, "shopping.txt", "eggs, milk, bread")
+	write(hiddenDir, "secret.txt", "the real secret")
+	hiddenKey := []byte("hidden volume secret")
+	encodeDir := filepath.Join(tempDir, "encoded")
+
+	encodeCfg := EncodeConfig{
+		InputDir:    decoyDir,
+		OutputDir:   encodeDir,
+		N:           3,
+		K:           2,
+		Format:      FormatBin,
+		ChunkSize:   4096,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+		PadTo:       Padding{Mode: PadFixed, Size: 64 * 1024},
+		HiddenDir:   hiddenDir,
+		HiddenKey:   hiddenKey,
+	}
+
+	// A hidden volume needs both a key and padding to hide in
+	for _, cfg := range []EncodeConfig{
+		{InputDir: decoyDir, OutputDir: encodeDir, N: 3, K: 2, Format: FormatBin, HiddenDir: hiddenDir, HiddenKey: hiddenKey},
+		{InputDir: decoyDir, OutputDir: encodeDir, N: 3, K: 2, Format: FormatBin, HiddenDir: hiddenDir, PadTo: encodeCfg.PadTo},
+	} {
+		if err := EncodeDirectory(ctx, cfg); err == nil {
+			t.Errorf("Expected an error encoding a hidden volume without a key or padding")
+		}
+	}
+
+	if err := EncodeDirectory(ctx, encodeCfg); err != nil {
+		t.Fatalf("Failed to encode with a hidden volume: %v", err)
+	}
+
+	decode := func(name string, hiddenKey []byte) (string, error) {
+		decodeDir := filepath.Join(tempDir, name)
+		return decodeDir, DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputDir: decodeDir, Compression: CompressionGzip, HiddenKey: hiddenKey})
+	}
+	check := func(dir, name, want string) {
+		if got, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(got) != want {
+			t.Errorf("%s: got %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	// Without the key, the collections decode to the decoy, and nothing else is restored
+	decoded, err := decode("decoded", nil)
+	if err != nil {
+		t.Fatalf("Failed to decode the decoy: %v", err)
+	}
+	check(decoded, "shopping.txt", "eggs, milk, bread")
+	if _, err := os.Stat(filepath.Join(decoded, "secret.txt")); !os.IsNotExist(err) {
+		t.Errorf("The hidden volume was restored without its key")
+	}
+
+	// With it, to the hidden volume
+	revealed, err := decode("revealed", hiddenKey)
+	if err != nil {
+		t.Fatalf("Failed to decode the hidden volume: %v", err)
+	}
+	check(revealed, "secret.txt", "the real secret")
+	if _, err := os.Stat(filepath.Join(revealed, "shopping.txt")); !os.IsNotExist(err) {
+		t.Errorf("The decoy was restored with the hidden volume")
+	}
+
+	if _, err := decode("wrong", []byte("wrong")); !errors.Is(err, file.ErrNoHiddenVolume) {
+		t.Errorf("Expected ErrNoHiddenVolume with the wrong key, got %v", err)
+	}
+
+	// Re-sharing keeps the hidden volume, without being given its key
+	newDir := filepath.Join(tempDir, "reshared")
+	err = ReshareCollections(ctx, ReshareConfig{
+		InputDirs: []string{encodeDir},
+		Encode:    EncodeConfig{OutputDir: newDir, N: 2, K: 2, Format: FormatBin, ChunkSize: 4096, RNG: pad.NewDefaultRand(ctx)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to reshare: %v", err)
+	}
+	reshared := filepath.Join(tempDir, "reshared-revealed")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: newDir, OutputDir: reshared, Compression: CompressionGzip, HiddenKey: hiddenKey}); err != nil {
+		t.Fatalf("Failed to decode the hidden volume of the reshared collections: %v", err)
+	}
+	check(reshared, "secret.txt", "the real secret")
+}
@@ -0,0 +1,264 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// An encode with a chunk index compresses the serialized input in blocks and ends it with an
+// index of which chunks hold each block and where each entry is in its block, as described in
+// pkg/file/index.go. A decode that restores only the files its filter selects then reads the
+// index from the last chunks, and decodes just the chunks holding the blocks of the selected
+// files, rather than every chunk of the collections. The whole payload isn't decoded, so it
+// can't be checked against the payload hash; each restored file is checked against the hash
+// manifest instead, which is decoded along with them.
+
+// checkChunkIndex refuses an encode with a chunk index whose payload can't be decoded in
+// parts: one that isn't a TAR of input directories, that is encrypted or padded as a whole,
+// or whose chunks go to a sink, which is read from start to end
+func checkChunkIndex(cfg EncodeConfig) error {
+	if !cfg.ChunkIndex {
+		return nil
+	}
+	switch {
+	case cfg.RawInput != nil || cfg.InputStream != nil:
+		return fmt.Errorf("a chunk index can only be written for input directories, not for a stream")
+	case cfg.ChunkSink != nil:
+		return fmt.Errorf("a chunk index can't be written when chunks go to a sink")
+	case len(cfg.Passphrase) > 0 || len(cfg.EnvelopeKey) > 0:
+		return fmt.Errorf("a chunk index can't be combined with a passphrase or envelope key, which encrypt the data as a whole")
+	case cfg.PadTo.Mode != PadNone:
+		return fmt.Errorf("a chunk index can't be combined with padding, which hides where the data ends")
+	case cfg.Resume:
+		return fmt.Errorf("an encode with a chunk index can't be resumed")
+	}
+	return nil
+}
+
+// serializeIndexed serializes the input directories of cfg compressed in blocks, ending with
+// a chunk index for chunks that each encode chunkBytes of the stream. CompressionAuto is
+// resolved first, from a sample of a plain serialization of the input.
+func serializeIndexed(ctx context.Context, cfg *EncodeConfig, chunkBytes int) (*file.IndexedStream, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if cfg.Compression == CompressionAuto {
+		sample, err := file.SerializeDirectoriesWithFilter(ctx, cfg.inputDirs(), cfg.Filter)
+		if err != nil {
+			log.Error(fmt.Errorf("failed to create tar stream: %w", err))
+			return nil, fmt.Errorf("failed to create tar stream: %w", err)
+		}
+		_, cfg.Compression, err = resolveAutoCompression(ctx, sample)
+		sample.Close()
+		if err != nil {
+			return nil, err
+		}
+		cfg.autoCompressed = true
+		if cfg.Result != nil {
+			cfg.Result.Compression = cfg.Compression.String()
+			cfg.Result.CompressionLevel = cfg.compressionLevel()
+		}
+	}
+
+	log.Debugf("Creating tar stream with a chunk index from input directory: %s", strings.Join(cfg.inputDirs(), ", "))
+	stream, err := file.SerializeIndexed(ctx, cfg.inputDirs(), cfg.Filter, cfg.Compression.effective().String(), cfg.CompressionLevel, int64(chunkBytes))
+	if err != nil {
+		log.Error(fmt.Errorf("failed to create tar stream: %w", err))
+		return nil, fmt.Errorf("failed to create tar stream: %w", err)
+	}
+	return stream, nil
+}
+
+// collectionIndex returns the metadata of the first collection that records a chunk index,
+// or nil if none does
+func collectionIndex(ctx context.Context, collections []file.Collection, key []byte) *file.Metadata {
+	for _, coll := range collections {
+		md, err := file.ReadMetadata(ctx, coll, key)
+		if err == nil && md.Index != nil && md.Index.ChunkBytes > 0 {
+			return md
+		}
+	}
+	return nil
+}
+
+// decodeIndexed restores the files cfg.Filter selects from the collections, decoding only the
+// chunks that hold the chunk index and the blocks of those files. It returns the pad that
+// decoded the last of them, which describes the scheme the collections were encoded with.
+func decodeIndexed(ctx context.Context, cfg DecodeConfig, collections []file.Collection, md *file.Metadata, macs []*file.ChunkMACs,
+	manifest *file.RestoreManifest, counter *resultCounter) (*pad.Pad, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	// The index is in the last chunks
+	location := *md.Index
+	var index *file.ChunkIndex
+	p, err := decodeChunks(ctx, cfg, collections, macs, counter, location.Chunk(), 0, func(r io.Reader) error {
+		if _, err := io.CopyN(io.Discard, r, location.Offset-int64(location.Chunk()-1)*location.ChunkBytes); err != nil {
+			return fmt.Errorf("failed to read chunk index: %w", err)
+		}
+		var err error
+		index, err = file.ReadChunkIndex(r, md.Compression)
+		return err
+	})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	selected := index.Select(cfg.Filter)
+	if len(selected) == 1 {
+		err := fmt.Errorf("no files in the collections are selected")
+		log.Error(err)
+		return nil, err
+	}
+
+	// Blocks whose chunks overlap or follow one another are decoded together
+	type run struct {
+		first, last int
+		blocks      []int
+	}
+	var runs []run
+	entries := make(map[int][]file.IndexEntry)
+	for _, entry := range selected {
+		if _, ok := entries[entry.Block]; !ok {
+			block := index.Blocks[entry.Block]
+			if n := len(runs); n > 0 && block.FirstChunk <= runs[n-1].last+1 {
+				runs[n-1].last = max(runs[n-1].last, block.LastChunk)
+				runs[n-1].blocks = append(runs[n-1].blocks, entry.Block)
+			} else {
+				runs = append(runs, run{first: block.FirstChunk, last: block.LastChunk, blocks: []int{entry.Block}})
+			}
+		}
+		entries[entry.Block] = append(entries[entry.Block], entry)
+	}
+	chunks := 0
+	for _, r := range runs {
+		chunks += r.last - r.first + 1
+	}
+	log.Infof("Decoding %d of %d chunks for the %d selected entries", chunks+md.Chunks-location.Chunk()+1, md.Chunks, len(selected)-1)
+
+	// Deserialize the selected entries, as a TAR of their own, while they are decoded
+	pr, pw := file.NewPipe(cfg.Pipeline.PipeBufferSize)
+	done := make(chan error, 1)
+	go func() {
+		err := file.DeserializeDirectoryWithFilter(ctx, cfg.OutputDir, pr, false, manifest, cfg.Filter)
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	for _, r := range runs {
+		p, err = decodeChunks(ctx, cfg, collections, macs, counter, r.first, r.last, func(stream io.Reader) error {
+			at := int64(r.first-1) * index.ChunkBytes
+			for _, b := range r.blocks {
+				block := index.Blocks[b]
+				if _, err := io.CopyN(io.Discard, stream, block.Offset-at); err != nil {
+					return err
+				}
+				data := io.LimitReader(stream, block.Length)
+				decompressed, err := index.OpenBlock(data, b)
+				if err != nil {
+					return err
+				}
+				var skip int64
+				for _, entry := range entries[b] {
+					if _, err := io.CopyN(io.Discard, decompressed, entry.Skip-skip); err != nil {
+						return err
+					}
+					if _, err := io.CopyN(pw, decompressed, entry.Length); err != nil {
+						return fmt.Errorf("failed to read %s: %w", entry.Name, err)
+					}
+					skip = entry.Skip + entry.Length
+				}
+				if _, err := io.Copy(io.Discard, data); err != nil {
+					return err
+				}
+				at = block.Offset + block.Length
+			}
+			return nil
+		})
+		if err != nil {
+			break
+		}
+	}
+
+	// End the TAR of the selected entries
+	if err == nil {
+		_, err = pw.Write(make([]byte, 1024))
+	}
+	pw.CloseWithError(err)
+	deserializeErr := <-done
+	if err != nil {
+		log.Error(fmt.Errorf("decoding failed: %w", err))
+		return nil, fmt.Errorf("decoding failed: %w", err)
+	}
+	if deserializeErr != nil {
+		log.Error(fmt.Errorf("failed to deserialize directory: %w", deserializeErr))
+		return nil, deserializeErr
+	}
+	log.Infof("Restored the selected files from %d of %d chunks", chunks+md.Chunks-location.Chunk()+1, md.Chunks)
+	return p, nil
+}
+
+// decodeChunks decodes the chunks first to last of the collections, or to their end if last
+// is 0, and passes the decoded stream to fn. Whatever fn leaves unread is read past.
+func decodeChunks(ctx context.Context, cfg DecodeConfig, collections []file.Collection, macs []*file.ChunkMACs, counter *resultCounter,
+	first, last int, fn func(io.Reader) error) (*pad.Pad, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+	log.Debugf("Decoding chunks %d to %d", first, last)
+
+	readers := make([]io.Reader, len(collections))
+	for i, coll := range collections {
+		collReader := file.NewCollectionReader(coll)
+		collReader.Retry = cfg.Retry
+		if macs != nil {
+			collReader.MACs = macs[i]
+		}
+		chunks := &file.ChunkRange{Reader: collReader, First: first, Last: last}
+		prefetcher, err := file.NewPrefetchReader(ctx, coll.Name, chunks, cfg.Pipeline.prefetchDepth(), cfg.Pipeline.PrefetchDir)
+		if err != nil {
+			return nil, err
+		}
+		defer prefetcher.Close()
+		readers[i] = prefetcher
+	}
+	p, err := pad.NewPadForDecode(ctx, len(collections))
+	if err != nil {
+		return nil, err
+	}
+	p.Aliases = metadataAliases(ctx, collections, cfg.MetadataKey)
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := fn(pr)
+		if err == nil {
+			_, err = io.Copy(io.Discard, pr)
+		}
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	var output io.Writer = pw
+	if counter != nil {
+		output = counter.wrapOutput(output)
+	}
+	err = p.DecodeFrom(ctx, first, readers, output)
+	pw.CloseWithError(err)
+	fnErr := <-done
+	if err != nil {
+		return nil, err
+	}
+	if fnErr != nil {
+		return nil, fnErr
+	}
+	for _, bad := range p.BadShares {
+		log.Infof("Decoded chunk %d without collection %s, whose chunk is bad; verify and repair it", bad.Chunk, bad.Collection)
+	}
+	return p, nil
+}
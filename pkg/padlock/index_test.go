@@ -0,0 +1,146 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestChunkIndexSelectiveDecode checks that a decode with a filter restores only the files it
+// selects, from fewer chunks than the collections hold when they have a chunk index, and by
+// decoding every chunk when they don't
+func TestChunkIndexSelectiveDecode(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	rng := rand.New(rand.NewSource(1))
+	files := make(map[string][]byte)
+	for i := 0; i < 8; i++ {
+		data := make([]byte, 300*1024)
+		rng.Read(data)
+		name := fmt.Sprintf("set%d/file%d.bin", i%2, i)
+		files[name] = data
+		path := filepath.Join(inputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	filter, err := NewFilter(nil, []string{"file5.bin"})
+	if err != nil {
+		t.Fatalf("NewFilter failed: %v", err)
+	}
+
+	for _, indexed := range []bool{true, false} {
+		t.Run(fmt.Sprintf("indexed=%v", indexed), func(t *testing.T) {
+			encodeDir := filepath.Join(t.TempDir(), "encoded")
+			opts := []Option{WithInput(inputDir), WithOutputs(encodeDir), WithScheme(2, 3), WithFormat(FormatBin),
+				WithChunkSize(64 * 1024), WithArchive(""), WithRNG(pad.NewDefaultRand(ctx))}
+			if indexed {
+				opts = append(opts, WithChunkIndex())
+			}
+			cfg, err := NewEncodeConfig(opts...)
+			if err != nil {
+				t.Fatalf("NewEncodeConfig failed: %v", err)
+			}
+			if err := EncodeDirectory(ctx, cfg); err != nil {
+				t.Fatalf("Failed to encode: %v", err)
+			}
+
+			var result Result
+			decodeDir := filepath.Join(t.TempDir(), "decoded")
+			decodeCfg, err := NewDecodeConfig(WithInputs(encodeDir), WithOutput(decodeDir), WithFilter(filter), WithResult(&result))
+			if err != nil {
+				t.Fatalf("NewDecodeConfig failed: %v", err)
+			}
+			if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+				t.Fatalf("Failed to decode the selected files: %v", err)
+			}
+			for name, data := range files {
+				got, err := os.ReadFile(filepath.Join(decodeDir, filepath.FromSlash(name)))
+				if name == "set1/file5.bin" {
+					if err != nil || string(got) != string(data) {
+						t.Errorf("Expected %s to be restored (%v)", name, err)
+					}
+				} else if err == nil {
+					t.Errorf("Expected %s not to be restored", name)
+				}
+			}
+
+			collections, _, err := file.FindCollections(ctx, encodeDir)
+			if err != nil {
+				t.Fatalf("Failed to find collections: %v", err)
+			}
+			md := collectionIndex(ctx, collections, nil)
+			if indexed != (md != nil) {
+				t.Fatalf("Expected a chunk index to be recorded to be %v", indexed)
+			}
+			if indexed && result.Chunks >= md.Chunks {
+				t.Errorf("Expected fewer than the %d chunks to be decoded with the chunk index, decoded %d", md.Chunks, result.Chunks)
+			}
+		})
+	}
+}
+
+// TestChunkIndexRoundTrip checks that collections with a chunk index still decode in full,
+// and that a chunk index is refused with data that can't be decoded in parts
+func TestChunkIndexRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(filepath.Join(inputDir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	content := strings.Repeat("indexed ", 1000)
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		if err := os.WriteFile(filepath.Join(inputDir, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	encodeDir := filepath.Join(tempDir, "encoded")
+	cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(encodeDir), WithFormat(FormatBin), WithChunkIndex(),
+		WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputDir: decodeDir, Compression: CompressionGzip, RNG: pad.NewDefaultRand(ctx)}); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		if got, err := os.ReadFile(filepath.Join(decodeDir, filepath.FromSlash(name))); err != nil || string(got) != content {
+			t.Errorf("Expected %s to be restored (%v)", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(decodeDir, file.IndexName)); !os.IsNotExist(err) {
+		t.Errorf("Expected the chunk index not to be restored")
+	}
+
+	cfg.OutputDir, cfg.OutputDirs = filepath.Join(tempDir, "encrypted"), nil
+	cfg.EnvelopeKey = []byte("envelope key")
+	if err := EncodeDirectory(ctx, cfg); err == nil || !strings.Contains(err.Error(), "chunk index") {
+		t.Errorf("Expected a chunk index with an envelope key to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// CollectionInfo describes a single collection, from its chunk headers and its metadata
+type CollectionInfo struct {
+	CollectionCheck                // Name, K, N, and chunk count from the chunk headers, and any problems found
+	DiskSize        int64          // Size of the collection's files or TAR on disk
+	Metadata        *file.Metadata // Metadata recorded at encode time, or nil if it is unavailable
+	MetadataErr     error          // Why the metadata is unavailable, if it is
+}
+
+// Compression returns the compression mode recorded in the metadata, or "unknown" for
+// collections encoded before it was recorded
+func (c *CollectionInfo) Compression() string {
+	if c.Metadata == nil || c.Metadata.Compression == "" {
+		return "unknown"
+	}
+	return c.Metadata.Compression
+}
+
+// ReadCollectionInfo describes every collection found in the input directories, using the
+// same discovery rules as DecodeDirectory. Any single collection reveals its K-of-N scheme
+// through its chunk headers, or, if it is stored under a stealth name, through its metadata,
+// so this tells a holder how many collections are needed without decoding anything. key
+// decrypts metadata sealed at encode time.
+func ReadCollectionInfo(ctx context.Context, inputDirs []string, key []byte) ([]CollectionInfo, error) {
+	log := trace.FromContext(ctx).WithPrefix("info")
+
+	collections, tempDir, err := findInputCollections(ctx, "", inputDirs, 0)
+	if err != nil {
+		return nil, err
+	}
+	if tempDir != "" {
+		defer os.RemoveAll(tempDir)
+	}
+
+	// Warn if the collections are overdue for review
+	CheckReviewDates(ctx, collections, key, time.Now())
+
+	var infos []CollectionInfo
+	for _, coll := range collections {
+		check, err := verifyCollection(ctx, coll, RetryPolicy{}, nil, metadataAliases(ctx, []file.Collection{coll}, key))
+		if err != nil {
+			return nil, err
+		}
+		info := CollectionInfo{CollectionCheck: check}
+
+		if info.DiskSize, err = collectionDiskSize(coll); err != nil {
+			log.Debugf("Could not measure collection %s: %v", coll.DiskName(), err)
+		}
+
+		info.Metadata, info.MetadataErr = file.ReadMetadata(ctx, coll, key)
+		if md := info.Metadata; md != nil && info.Name == "" {
+			// Without readable chunks, fall back to what the metadata records
+			info.Name, info.RequiredCopies, info.TotalCopies = md.Collection, md.Required, md.Copies
+		}
+		info.checkRecordedChunks(info.Metadata)
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// PrintCollectionInfo writes a description of each collection as a human-readable report
+func PrintCollectionInfo(w io.Writer, infos []CollectionInfo) {
+	for i := range infos {
+		info := &infos[i]
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		name := info.Name
+		if name == "" {
+			name = "unknown"
+		}
+		if stored := info.Collection.DiskName(); stored != info.Name {
+			name = fmt.Sprintf("%s (stored as %s)", name, stored)
+		}
+		fmt.Fprintf(w, "Collection:   %s\n", name)
+		fmt.Fprintf(w, "Path:         %s\n", info.Collection.Path)
+		if mandatory := pad.MandatoryCollections(info.Sharing); info.RequiredCopies > 0 && len(mandatory) > 0 {
+			for i, letter := range mandatory {
+				mandatory[i] = fmt.Sprintf("%d%s%d", info.RequiredCopies, letter, info.TotalCopies)
+			}
+			fmt.Fprintf(w, "Scheme:       %d of %d (any %d collections including %s reconstruct the data)\n",
+				info.RequiredCopies, info.TotalCopies, info.RequiredCopies, strings.Join(mandatory, " and "))
+		} else if info.RequiredCopies > 0 {
+			fmt.Fprintf(w, "Scheme:       %d of %d (any %d collections reconstruct the data)\n",
+				info.RequiredCopies, info.TotalCopies, info.RequiredCopies)
+		} else {
+			fmt.Fprintf(w, "Scheme:       unknown\n")
+		}
+		if info.Sharing != nil {
+			fmt.Fprintf(w, "Sharing:      %s\n", pad.SharingName(info.Sharing))
+		}
+		fmt.Fprintf(w, "Format:       %s\n", info.Collection.Format)
+		fmt.Fprintf(w, "Chunks:       %d\n", info.Chunks)
+		if md := info.Metadata; md != nil && md.ChunkSize > 0 {
+			chunkSize := FormatByteSize(int64(md.ChunkSize))
+			if md.ChunkSizeAuto {
+				chunkSize += ", chosen automatically"
+			}
+			fmt.Fprintf(w, "Chunk size:   %s\n", chunkSize)
+		}
+		fmt.Fprintf(w, "Size:         %s\n", FormatByteSize(info.DiskSize))
+		if n := len(info.Collection.Volumes); n > 0 {
+			fmt.Fprintf(w, "Volumes:      %d\n", n)
+		}
+		compression := info.Compression()
+		if md := info.Metadata; md != nil && md.CompressionLevel != 0 {
+			compression += fmt.Sprintf(" (level %d)", md.CompressionLevel)
+		}
+		if md := info.Metadata; md != nil && md.CompressionAuto {
+			compression += ", chosen automatically"
+		}
+		fmt.Fprintf(w, "Compression:  %s\n", compression)
+
+		if md := info.Metadata; md != nil {
+			if !md.Created.IsZero() {
+				fmt.Fprintf(w, "Created:      %s\n", md.Created.Format(time.RFC3339))
+			}
+			if md.FormatVersion != 0 {
+				fmt.Fprintf(w, "Version:      collection format %d\n", md.FormatVersion)
+			}
+			if md.Session != "" {
+				fmt.Fprintf(w, "Session:      %s\n", md.Session)
+			}
+			if md.PayloadSHA256 != "" {
+				fmt.Fprintf(w, "Payload:      SHA-256 %s\n", md.PayloadSHA256)
+			}
+			for _, segment := range md.Segments {
+				sum := ""
+				if segment.PayloadSHA256 != "" {
+					sum = ", SHA-256 " + segment.PayloadSHA256
+				}
+				fmt.Fprintf(w, "Appended:     chunks %d to %d on %s%s\n", segment.FirstChunk,
+					segment.FirstChunk+segment.Chunks-1, segment.Appended.Format(time.DateOnly), sum)
+			}
+			if md.Dedup {
+				fmt.Fprintf(w, "Dedup:        repeated blocks of the input are stored once\n")
+			}
+			if md.Envelope != nil {
+				fmt.Fprintf(w, "Envelope:     %s (decode needs -envelope-key)\n", md.Envelope.Cipher)
+			}
+			if !md.ReviewBy.IsZero() {
+				overdue := ""
+				if md.PastReview(time.Now()) {
+					overdue = " (OVERDUE - verify the shares and re-encode onto fresh media)"
+				}
+				fmt.Fprintf(w, "Review by:    %s%s\n", md.ReviewBy.Format(time.DateOnly), overdue)
+			}
+			if md.Label != "" {
+				fmt.Fprintf(w, "Label:        %s\n", md.Label)
+			}
+			if c, ok := md.Custodian(); ok {
+				fmt.Fprintf(w, "Custodian:    %s\n", c)
+			}
+			if md.Notes != "" {
+				fmt.Fprintf(w, "Notes:        %s\n", md.Notes)
+			}
+		} else if errors.Is(info.MetadataErr, file.ErrMetadataSealed) {
+			fmt.Fprintf(w, "Metadata:     encrypted (use -metadata-key to read it)\n")
+		} else if info.MetadataErr != nil && !errors.Is(info.MetadataErr, os.ErrNotExist) {
+			fmt.Fprintf(w, "Metadata:     %v\n", info.MetadataErr)
+		}
+
+		for _, problem := range info.Problems {
+			fmt.Fprintf(w, "Problem:      %s\n", problem)
+		}
+	}
+}
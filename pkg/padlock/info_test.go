@@ -0,0 +1,97 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestReadCollectionInfo(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-info-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	outputDir := filepath.Join(tempDir, "output")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), bytes.Repeat([]byte("info "), 500), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	cfg := EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          outputDir,
+		N:                  4,
+		K:                  3,
+		Format:             FormatPNG,
+		ChunkSize:          64,
+		RNG:                pad.NewDefaultRand(ctx),
+		ClearIfNotEmpty:    true,
+		Compression:        CompressionGzip,
+		ArchiveCollections: true,
+		Labels:             []string{"home safe", "bank", "office", "lawyer"},
+		Notes:              []string{"in the blue folder", "", "", ""},
+		Custodians:         []Custodian{{Name: "Alice", Contact: "alice@example.com"}, {Name: "Bob"}, {Name: "Carol"}, {Name: "Dan"}},
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	// A single collection TAR is enough to learn the scheme
+	infos, err := ReadCollectionInfo(ctx, []string{outputDir}, nil)
+	if err != nil {
+		t.Fatalf("Failed to read collection info: %v", err)
+	}
+	if len(infos) != 4 {
+		t.Fatalf("Expected 4 collections, got %d", len(infos))
+	}
+	info := infos[1]
+	if info.Name != "3B4" || info.RequiredCopies != 3 || info.TotalCopies != 4 {
+		t.Errorf("Unexpected collection parameters: %s, %d of %d", info.Name, info.RequiredCopies, info.TotalCopies)
+	}
+	if info.Chunks < 2 || info.DiskSize <= info.Bytes || info.Compression() != "gzip" || info.Collection.Format != FormatPNG {
+		t.Errorf("Unexpected collection info: %d chunks, %d bytes on disk, %d in chunks, compression %s, format %s",
+			info.Chunks, info.DiskSize, info.Bytes, info.Compression(), info.Collection.Format)
+	}
+	if info.Metadata == nil || info.Metadata.Chunks != info.Chunks || len(info.Problems) > 0 {
+		t.Fatalf("Expected the metadata to record the %d chunks found: %+v, %v", info.Chunks, info.Metadata, info.Problems)
+	}
+	if info.Metadata.Label != "bank" || info.Metadata.Notes != "" {
+		t.Errorf("Expected the metadata to record the label of its own collection, got %q, %q", info.Metadata.Label, info.Metadata.Notes)
+	}
+
+	var out bytes.Buffer
+	PrintCollectionInfo(&out, infos[:1])
+	for _, want := range []string{"Collection:   3A4", "3 of 4", "Compression:  gzip", "Created:", "Label:        home safe",
+		"Custodian:    Alice <alice@example.com>", "Notes:        in the blue folder"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected the report to contain %q:\n%s", want, out.String())
+		}
+	}
+
+	// A review date that has passed is flagged
+	infos[0].Metadata.ReviewBy = time.Now().AddDate(0, 0, -1).UTC()
+	out.Reset()
+	PrintCollectionInfo(&out, infos[:1])
+	want := "Review by:    " + infos[0].Metadata.ReviewBy.Format(time.DateOnly) + " (OVERDUE"
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("Expected the report to contain %q:\n%s", want, out.String())
+	}
+}
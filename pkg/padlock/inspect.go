@@ -0,0 +1,205 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// ChunkInspection describes a single chunk file in detail, for troubleshooting chunks that
+// fail to decode
+type ChunkInspection struct {
+	Path        string            // Location of the chunk file
+	Format      Format            // Format of the chunk file, from its contents
+	FileSize    int64             // Size of the chunk file
+	Payload     []byte            // Chunk as decode reads it, with any PNG, WAV, or text wrapper removed
+	PNG         *file.PNGPayload  // The PNG rAWd chunk and its CRCs, for PNG chunk files
+	Embedding   PNGEmbedding      // Where a PNG chunk file holds its data
+	Text        *file.TextPayload // The armor headers and CRCs, for text chunk files
+	WAV         *file.WAVPayload  // The WAV rAWd chunk and its CRCs, for WAV chunk files
+	Bin         *file.BinPayload  // The chunk and its CRCs, for bin chunk files that have a CRC
+	SidecarSeen bool              // Whether the chunk file has a .sha256 sidecar
+	SidecarErr  error             // Why the chunk file doesn't match its sidecar, if it doesn't
+	ParitySeen  bool              // Whether the chunk file has a .parity sidecar
+	Damaged     int               // Damaged blocks of the chunk file its parity sidecar corrects
+	ParityErr   error             // Why the chunk file can't be corrected from its parity sidecar, if it can't
+	Header      pad.ChunkHeader   // The chunk header, if it could be parsed
+	HeaderErr   error             // Why the chunk header couldn't be parsed, if it couldn't
+}
+
+// InspectChunkFile reads a single bin, PNG, text, or WAV chunk file and examines it the way decode
+// would, without stopping at the first problem
+func InspectChunkFile(ctx context.Context, path string) (*ChunkInspection, error) {
+	log := trace.FromContext(ctx).WithPrefix("inspect")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to read chunk file %s: %w", path, err))
+		return nil, fmt.Errorf("failed to read chunk file %s: %w", path, err)
+	}
+
+	c := &ChunkInspection{Path: path, Format: FormatBin, FileSize: int64(len(data)), Payload: data}
+	if bytes.HasPrefix(data, []byte("\x89PNG")) {
+		c.Format = FormatPNG
+		c.Embedding = PNGEmbedChunk
+		payload, err := file.FindPNGPayload(data)
+		if err != nil {
+			// The data may be hidden in the pixels instead
+			pixelPayload, pixelErr := file.FindPNGPixelPayload(bytes.NewReader(data))
+			if pixelErr != nil {
+				return nil, fmt.Errorf("chunk file %s: %w", path, err)
+			}
+			payload, c.Embedding = pixelPayload, PNGEmbedLSB
+		}
+		c.PNG = &payload
+		c.Payload = payload.Data
+	} else if file.IsWAV(data) {
+		c.Format = FormatWAV
+		payload, err := file.FindWAVPayload(data)
+		if err != nil {
+			return nil, fmt.Errorf("chunk file %s: %w", path, err)
+		}
+		c.WAV = &payload
+		c.Payload = payload.Data
+	} else if bytes.Contains(data[:min(len(data), 4096)], []byte("-----BEGIN PADLOCK CHUNK-----")) {
+		c.Format = FormatText
+		payload, err := file.FindTextPayload(data)
+		if err != nil {
+			return nil, fmt.Errorf("chunk file %s: %w", path, err)
+		}
+		c.Text = &payload
+		c.Payload = payload.Data
+	} else {
+		payload, err := file.FindBinPayload(data)
+		if err != nil {
+			return nil, fmt.Errorf("chunk file %s: %w", path, err)
+		}
+		if payload.Version > 1 {
+			c.Bin = &payload
+		}
+		c.Payload = payload.Data
+	}
+
+	c.SidecarSeen, c.SidecarErr = file.VerifyChecksumSidecar(ctx, path)
+	if _, err := os.Stat(path + file.ParitySidecarExt); err == nil {
+		c.ParitySeen = true
+		_, c.Damaged, c.ParityErr = file.CorrectWithParity(ctx, path, data)
+	}
+	c.Header, c.HeaderErr = pad.ParseChunkHeader(c.Payload)
+	return c, nil
+}
+
+// OK reports whether no problems were found with the chunk
+func (c *ChunkInspection) OK() bool {
+	return c.HeaderErr == nil && c.SidecarErr == nil &&
+		(c.PNG == nil || c.PNG.CRCValid()) &&
+		(c.Text == nil || c.Text.CRCValid()) &&
+		(c.WAV == nil || c.WAV.CRCValid()) &&
+		(c.Bin == nil || c.Bin.CRCValid()) &&
+		c.Header.ChunkBytes() == int64(len(c.Payload))
+}
+
+// Print writes the inspection as a human-readable report, with a hex preview of up to
+// preview bytes of the chunk's cipher data
+func (c *ChunkInspection) Print(w io.Writer, preview int) {
+	fmt.Fprintf(w, "File:        %s\n", c.Path)
+	if c.Embedding == PNGEmbedLSB {
+		fmt.Fprintf(w, "Format:      %s (data in pixels)\n", c.Format)
+	} else {
+		fmt.Fprintf(w, "Format:      %s\n", c.Format)
+	}
+	fmt.Fprintf(w, "File size:   %s\n", FormatByteSize(c.FileSize))
+
+	switch {
+	case c.PNG != nil && c.PNG.CRCValid():
+		fmt.Fprintf(w, "CRC:         ok (0x%08x)\n", c.PNG.StoredCRC)
+	case c.PNG != nil:
+		fmt.Fprintf(w, "CRC:         MISMATCH: stored 0x%08x, computed 0x%08x\n", c.PNG.StoredCRC, c.PNG.ComputedCRC)
+	case c.WAV != nil && c.WAV.CRCValid():
+		fmt.Fprintf(w, "CRC:         ok (0x%08x)\n", c.WAV.StoredCRC)
+	case c.WAV != nil:
+		fmt.Fprintf(w, "CRC:         MISMATCH: stored 0x%08x, computed 0x%08x\n", c.WAV.StoredCRC, c.WAV.ComputedCRC)
+	case c.Text != nil && c.Text.CRCValid():
+		fmt.Fprintf(w, "CRC:         ok (0x%08x)\n", c.Text.StoredCRC)
+	case c.Text != nil && c.Text.Length != len(c.Text.Data):
+		fmt.Fprintf(w, "CRC:         MISMATCH: header says %d bytes, body has %d\n", c.Text.Length, len(c.Text.Data))
+	case c.Text != nil:
+		fmt.Fprintf(w, "CRC:         MISMATCH: stored 0x%08x, computed 0x%08x\n", c.Text.StoredCRC, c.Text.ComputedCRC)
+	case c.Bin != nil && c.Bin.CRCValid():
+		fmt.Fprintf(w, "CRC:         ok (0x%08x)\n", c.Bin.StoredCRC)
+	case c.Bin != nil:
+		fmt.Fprintf(w, "CRC:         MISMATCH: stored 0x%08x, computed 0x%08x\n", c.Bin.StoredCRC, c.Bin.ComputedCRC)
+	default:
+		fmt.Fprintf(w, "CRC:         none (bin chunk written before bin chunks had a CRC)\n")
+	}
+	switch {
+	case !c.SidecarSeen:
+		fmt.Fprintf(w, "Checksum:    no %s sidecar\n", file.ChecksumSidecarExt)
+	case c.SidecarErr != nil:
+		fmt.Fprintf(w, "Checksum:    MISMATCH: %v\n", c.SidecarErr)
+	default:
+		fmt.Fprintf(w, "Checksum:    matches %s sidecar\n", file.ChecksumSidecarExt)
+	}
+	switch {
+	case !c.ParitySeen:
+		fmt.Fprintf(w, "Parity:      no %s sidecar\n", file.ParitySidecarExt)
+	case c.ParityErr != nil:
+		fmt.Fprintf(w, "Parity:      UNCORRECTABLE: %v\n", c.ParityErr)
+	case c.Damaged > 0:
+		fmt.Fprintf(w, "Parity:      %d damaged blocks, which decode corrects\n", c.Damaged)
+	default:
+		fmt.Fprintf(w, "Parity:      intact\n")
+	}
+
+	if errors.Is(c.HeaderErr, pad.ErrUnresolvedAlias) {
+		// A stealth collection's chunks name it by its stealth name, which only its metadata maps
+		fmt.Fprintf(w, "Chunk name:  %s\n", c.Payload[1:1+int(c.Payload[0])])
+		fmt.Fprintf(w, "Collection:  named by an alias, such as a stealth name, that only the collection's metadata resolves\n")
+		fmt.Fprintf(w, "Payload:     %s\n", FormatByteSize(int64(len(c.Payload))))
+		c.printPreview(w, c.Payload, preview)
+		return
+	}
+	if c.HeaderErr != nil {
+		fmt.Fprintf(w, "Chunk name:  INVALID: %v\n", c.HeaderErr)
+		fmt.Fprintf(w, "Payload:     %s\n", FormatByteSize(int64(len(c.Payload))))
+		c.printPreview(w, c.Payload, preview)
+		return
+	}
+	h := c.Header
+	fmt.Fprintf(w, "Chunk name:  %s\n", c.Payload[1:h.HeaderBytes])
+	fmt.Fprintf(w, "Collection:  %s (%d of %d)\n", h.Collection, h.RequiredCopies, h.TotalCopies)
+	fmt.Fprintf(w, "Sharing:     %s\n", pad.SharingName(h.Sharing))
+	fmt.Fprintf(w, "Sequence:    %d\n", h.Number)
+	fmt.Fprintf(w, "Data size:   %s per piece\n", FormatByteSize(int64(h.DataBytes)))
+	switch actual := int64(len(c.Payload)); {
+	case actual == h.ChunkBytes():
+		fmt.Fprintf(w, "Payload:     %s, as the header describes\n", FormatByteSize(actual))
+	case actual < h.ChunkBytes():
+		fmt.Fprintf(w, "Payload:     TRUNCATED: %s, but the header describes %s; decode fails with unexpected EOF\n",
+			FormatByteSize(actual), FormatByteSize(h.ChunkBytes()))
+	default:
+		fmt.Fprintf(w, "Payload:     TOO LONG: %s, but the header describes %s\n", FormatByteSize(actual), FormatByteSize(h.ChunkBytes()))
+	}
+	c.printPreview(w, c.Payload[h.HeaderBytes:], preview)
+}
+
+// printPreview writes a hex dump of the start of data
+func (c *ChunkInspection) printPreview(w io.Writer, data []byte, preview int) {
+	if preview <= 0 || len(data) == 0 {
+		return
+	}
+	if len(data) > preview {
+		data = data[:preview]
+	}
+	fmt.Fprintf(w, "Preview:\n%s", hex.Dump(data))
+}
@@ -0,0 +1,111 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestInspectChunkFile(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-inspect-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), bytes.Repeat([]byte("inspect me "), 200), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	encode := func(outputDir string, format Format) {
+		cfg := EncodeConfig{
+			InputDir:        inputDir,
+			OutputDir:       outputDir,
+			N:               3,
+			K:               2,
+			Format:          format,
+			ChunkSize:       256,
+			RNG:             pad.NewDefaultRand(ctx),
+			ClearIfNotEmpty: true,
+			Compression:     CompressionNone,
+		}
+		if err := EncodeDirectory(ctx, cfg); err != nil {
+			t.Fatalf("Failed to encode directory: %v", err)
+		}
+	}
+
+	// An intact PNG chunk
+	pngDir := filepath.Join(tempDir, "png")
+	encode(pngDir, FormatPNG)
+	chunkPath := filepath.Join(pngDir, "2B3", "IMG2B3_0002.PNG")
+	c, err := InspectChunkFile(ctx, chunkPath)
+	if err != nil {
+		t.Fatalf("Failed to inspect chunk: %v", err)
+	}
+	if !c.OK() || c.Format != FormatPNG || c.Header.Collection != "2B3" || c.Header.Number != 2 {
+		t.Errorf("Unexpected inspection of an intact chunk: %+v", c)
+	}
+	var out bytes.Buffer
+	c.Print(&out, 32)
+	for _, want := range []string{"Chunk name:  2B3:2:", "Sequence:    2", "CRC:         ok", "Preview:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected the report to contain %q:\n%s", want, out.String())
+		}
+	}
+
+	// A damaged PNG chunk is still inspected, and its CRC mismatch reported
+	data, err := os.ReadFile(chunkPath)
+	if err != nil {
+		t.Fatalf("Failed to read chunk: %v", err)
+	}
+	data[len(data)-20] ^= 0xff // Inside the rAWd payload, before its CRC and the IEND chunk
+	if err := os.WriteFile(chunkPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write chunk: %v", err)
+	}
+	c, err = InspectChunkFile(ctx, chunkPath)
+	if err != nil {
+		t.Fatalf("Failed to inspect damaged chunk: %v", err)
+	}
+	out.Reset()
+	c.Print(&out, 32)
+	if c.OK() || !strings.Contains(out.String(), "CRC:         MISMATCH") {
+		t.Errorf("Expected a CRC mismatch:\n%s", out.String())
+	}
+
+	// A truncated bin chunk
+	binDir := filepath.Join(tempDir, "bin")
+	encode(binDir, FormatBin)
+	chunkPath = filepath.Join(binDir, "2A3", "2A3_0001.bin")
+	data, err = os.ReadFile(chunkPath)
+	if err != nil {
+		t.Fatalf("Failed to read chunk: %v", err)
+	}
+	if err := os.WriteFile(chunkPath, data[:len(data)-10], 0644); err != nil {
+		t.Fatalf("Failed to write chunk: %v", err)
+	}
+	c, err = InspectChunkFile(ctx, chunkPath)
+	if err != nil {
+		t.Fatalf("Failed to inspect truncated chunk: %v", err)
+	}
+	out.Reset()
+	c.Print(&out, 0)
+	if c.OK() || !strings.Contains(out.String(), "TRUNCATED") || !strings.Contains(out.String(), "CRC:         MISMATCH") || strings.Contains(out.String(), "Preview:") {
+		t.Errorf("Expected a truncated chunk without a preview:\n%s", out.String())
+	}
+}
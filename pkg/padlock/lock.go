@@ -0,0 +1,70 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// lockDirs takes the advisory lock on every directory an operation writes to, so that a
+// second encode or decode into any of them fails fast instead of interleaving its output.
+// The returned function releases the locks.
+func lockDirs(ctx context.Context, dirs []string, operation string) (func(), error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	var locks []*file.Lock
+	release := func() {
+		for _, lock := range locks {
+			if err := lock.Release(); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+	for _, dir := range dirs {
+		lock, err := file.AcquireLock(dir, operation)
+		if err != nil {
+			release()
+			log.Error(fmt.Errorf("cannot %s: %w", operation, err))
+			return nil, fmt.Errorf("cannot %s: %w", operation, err)
+		}
+		log.Debugf("Locked %s", dir)
+		locks = append(locks, lock)
+	}
+	return release, nil
+}
+
+// checkInputLocks fails if an operation that is still running is writing to any of the
+// directories a decode reads from, or that hold the archives or chunk files it reads, since
+// its collections aren't complete yet
+func checkInputLocks(ctx context.Context, dirs []string) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+		if err := file.CheckLock(dir); err != nil {
+			log.Error(fmt.Errorf("cannot decode: %w", err))
+			return fmt.Errorf("cannot decode: %w", err)
+		}
+	}
+	return nil
+}
+
+// localOutputDirs returns the local directories among destinations; remote ones are staged
+// in temporary directories of their own, whose contents are uploaded, so they aren't locked
+func localOutputDirs(destinations []file.Destination) []string {
+	var dirs []string
+	for _, dest := range destinations {
+		if dest.LocalDir() == dest.String() {
+			dirs = append(dirs, dest.LocalDir())
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,97 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestConcurrentOperationsAreLockedOut(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-lock-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte("locked out"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	encodedDir := filepath.Join(tempDir, "encoded")
+	encodeCfg := EncodeConfig{
+		InputDir:        inputDir,
+		OutputDir:       encodedDir,
+		N:               3,
+		K:               2,
+		Format:          FormatBin,
+		ChunkSize:       1024,
+		RNG:             pad.NewDefaultRand(ctx),
+		ClearIfNotEmpty: true,
+		Compression:     CompressionGzip,
+	}
+
+	// Another operation holding the output directory stops the encode before it clears anything
+	lock, err := file.AcquireLock(encodedDir, "encode")
+	if err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(encodedDir, "other.txt"), []byte("in progress"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := EncodeDirectory(ctx, encodeCfg); !errors.Is(err, file.ErrLocked) {
+		t.Fatalf("Expected the encode to fail with ErrLocked, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(encodedDir, "other.txt")); err != nil {
+		t.Errorf("Expected the locked output directory to be left alone: %v", err)
+	}
+
+	// A decode can't read collections that are still being written
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodedDir, OutputDir: filepath.Join(tempDir, "decoded")}); !errors.Is(err, file.ErrLocked) {
+		t.Errorf("Expected the decode to fail with ErrLocked, got %v", err)
+	}
+	lock.Release()
+
+	// Once released, the encode clears the directory, but not the lock file it holds
+	if err := EncodeDirectory(ctx, encodeCfg); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if err := file.CheckLock(encodedDir); err != nil {
+		t.Errorf("Expected the encode to release its lock: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(encodedDir, file.LockFileName)); !os.IsNotExist(err) {
+		t.Errorf("Expected no lock file after the encode")
+	}
+
+	// The decode output is locked too
+	decodedDir := filepath.Join(tempDir, "decoded")
+	lock, err = file.AcquireLock(decodedDir, "decode")
+	if err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodedDir, OutputDir: decodedDir}); !errors.Is(err, file.ErrLocked) {
+		t.Errorf("Expected the decode to fail with ErrLocked, got %v", err)
+	}
+	lock.Release()
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodedDir, OutputDir: decodedDir}); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(decodedDir, file.LockFileName)); !os.IsNotExist(err) {
+		t.Errorf("Expected no lock file in the restored directory")
+	}
+}
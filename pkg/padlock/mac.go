@@ -0,0 +1,119 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// chunkAuthenticator computes the MAC of every chunk an encode writes, for the chunk MAC file
+// of its collection
+type chunkAuthenticator struct {
+	macs map[string]*file.ChunkMACs // Chunk MACs of each collection, by collection name
+}
+
+// newChunkAuthenticator derives a MAC key for each collection from passphrase
+func newChunkAuthenticator(passphrase []byte, collections []file.Collection) (*chunkAuthenticator, error) {
+	a := &chunkAuthenticator{macs: make(map[string]*file.ChunkMACs, len(collections))}
+	for _, coll := range collections {
+		m, err := file.NewChunkMACs(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		a.macs[coll.Name] = m
+	}
+	return a, nil
+}
+
+// wrap returns a chunk function whose writers compute the MAC of each chunk as it is written
+func (a *chunkAuthenticator) wrap(newChunk pad.NewChunkFunc) pad.NewChunkFunc {
+	return func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		w, err := newChunk(collectionName, chunkNumber, chunkFormat)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := a.macs[collectionName]
+		if !ok {
+			return nil, fmt.Errorf("collection not found: %s", collectionName)
+		}
+		return &macWriter{w: w, macs: m, chunkNum: chunkNumber, h: m.NewHash(chunkNumber)}, nil
+	}
+}
+
+// store writes the chunk MAC file of every collection, into the collection directory or at
+// the end of the collection archive
+func (a *chunkAuthenticator) store(ctx context.Context, cfg EncodeConfig, collections []file.Collection, tarWriters *file.TarWriterRegistry) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	for _, coll := range collections {
+		m := a.macs[coll.Name]
+		if !cfg.ArchiveCollections {
+			if err := file.WriteChunkMACs(ctx, coll.Path, m); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := m.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := addCollectionEntry(ctx, cfg, coll, file.ChunkMACFileName, data, tarWriters); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Authenticated the chunks of %d collections with MACs", len(collections))
+	return nil
+}
+
+// macWriter passes a chunk through to its writer, computing the chunk's MAC
+type macWriter struct {
+	w        io.WriteCloser
+	macs     *file.ChunkMACs
+	chunkNum int
+	h        hash.Hash
+}
+
+func (mw *macWriter) Write(p []byte) (int, error) {
+	n, err := mw.w.Write(p)
+	mw.h.Write(p[:n])
+	return n, err
+}
+
+// Close closes the chunk's writer, and records the chunk's MAC if it was written completely
+func (mw *macWriter) Close() error {
+	if err := mw.w.Close(); err != nil {
+		return err
+	}
+	mw.macs.Set(mw.chunkNum, mw.h)
+	return nil
+}
+
+// readCollectionMACs reads the chunk MACs of every collection, failing if any collection has
+// none, since chunks without MACs can't be trusted when authentication was asked for
+func readCollectionMACs(ctx context.Context, collections []file.Collection, passphrase []byte) ([]*file.ChunkMACs, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	macs := make([]*file.ChunkMACs, len(collections))
+	for i, coll := range collections {
+		m, err := file.ReadChunkMACs(ctx, coll, passphrase)
+		if errors.Is(err, os.ErrNotExist) {
+			err = fmt.Errorf("collection %s has no chunk MACs, so its chunks can't be authenticated: %w", coll.DiskName(), ErrChecksumMismatch)
+		}
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		macs[i] = m
+	}
+	return macs, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestChunkAuthentication encodes collections with chunk MACs, and checks that decode, verify,
+// and repair authenticate their chunks, catching a modification that a CRC doesn't
+func TestChunkAuthentication(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	testData := bytes.Repeat([]byte("authentic "), 300)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), testData, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	macKey := []byte("mac passphrase")
+
+	for _, archive := range []bool{false, true} {
+		encodedDir := filepath.Join(tempDir, "encoded", map[bool]string{false: "files", true: "tar"}[archive])
+		err := EncodeDirectory(ctx, EncodeConfig{
+			InputDir:           inputDir,
+			OutputDir:          encodedDir,
+			N:                  3,
+			K:                  2,
+			Format:             FormatBin,
+			ChunkSize:          512,
+			RNG:                pad.NewDefaultRand(ctx),
+			Compression:        CompressionNone,
+			ArchiveCollections: archive,
+			MACKey:             macKey,
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		outputDir := filepath.Join(tempDir, "decoded", filepath.Base(encodedDir))
+		if err := DecodeDirectory(ctx, DecodeConfig{InputDirs: []string{encodedDir}, OutputDir: outputDir, Compression: CompressionNone, MACKey: macKey}); err != nil {
+			t.Fatalf("archive=%v: failed to decode: %v", archive, err)
+		}
+		if got, err := os.ReadFile(filepath.Join(outputDir, "test.txt")); err != nil || !bytes.Equal(got, testData) {
+			t.Errorf("archive=%v: decoding did not reproduce the input (%v)", archive, err)
+		}
+	}
+
+	encodedDir := filepath.Join(tempDir, "encoded", "files")
+	verify := func(key []byte) *VerifyReport {
+		report, err := VerifyCollections(ctx, VerifyConfig{InputDirs: []string{encodedDir}, MACKey: key})
+		if err != nil {
+			t.Fatalf("VerifyCollections failed: %v", err)
+		}
+		return report
+	}
+	if report := verify(macKey); !report.Passed() {
+		t.Fatalf("Expected intact collections to pass: %+v", report.Collections)
+	}
+
+	// Modify a chunk and fix up its CRC, as someone tampering with it would
+	chunkPath := filepath.Join(encodedDir, "2A3", "2A3_0002.bin")
+	original, _ := os.ReadFile(chunkPath)
+	tampered := bytes.Clone(original)
+	tampered[len(tampered)-8] ^= 1
+	payload := tampered[5 : len(tampered)-4]
+	binary.BigEndian.PutUint32(tampered[len(tampered)-4:], crc32.Checksum(payload, crc32.MakeTable(crc32.Castagnoli)))
+	if err := os.WriteFile(chunkPath, tampered, 0644); err != nil {
+		t.Fatalf("Failed to modify chunk: %v", err)
+	}
+	if report := verify(nil); !report.Passed() {
+		t.Errorf("Expected the modification to go unnoticed without the MAC key")
+	}
+	report := verify(macKey)
+	if report.Failed() != 1 || !strings.Contains(strings.Join(report.Collections[0].Problems, "\n"), "chunk 2 failed authentication") {
+		t.Errorf("Expected 2A3 to fail authentication: %+v", report.Collections)
+	}
+	// With a third collection to take its place, the modified chunk is decoded without; with
+	// only K collections, it fails the decode
+	var result Result
+	err := DecodeDirectory(ctx, DecodeConfig{InputDirs: []string{encodedDir}, OutputDir: filepath.Join(tempDir, "tampered"), Compression: CompressionNone, MACKey: macKey, Result: &result})
+	if err != nil {
+		t.Errorf("Expected decode of a modified chunk to use the other collections, got %v", err)
+	} else if got, err := os.ReadFile(filepath.Join(tempDir, "tampered", "test.txt")); err != nil || !bytes.Equal(got, testData) {
+		t.Errorf("Decoding around a modified chunk did not reproduce the input (%v)", err)
+	}
+	if len(result.BadChunks) != 1 || result.BadChunks[0].Collection != "2A3" || result.BadChunks[0].Chunk != 2 {
+		t.Errorf("Expected the result to report chunk 2 of 2A3 as bad, got %+v", result.BadChunks)
+	}
+	err = DecodeDirectory(ctx, DecodeConfig{
+		InputDirs:   []string{filepath.Join(encodedDir, "2A3"), filepath.Join(encodedDir, "2B3")},
+		OutputDir:   filepath.Join(tempDir, "tampered-k"),
+		Compression: CompressionNone,
+		MACKey:      macKey,
+	})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected decode of a modified chunk from K collections to fail with ErrChecksumMismatch, got %v", err)
+	}
+	os.WriteFile(chunkPath, original, 0644)
+
+	// Removing the last chunk of a collection is detected, and so is removing its MACs
+	chunks, _ := filepath.Glob(filepath.Join(encodedDir, "2C3", "*.bin"))
+	lastChunk, _ := os.ReadFile(chunks[len(chunks)-1])
+	os.Remove(chunks[len(chunks)-1])
+	report = verify(macKey)
+	if !strings.Contains(strings.Join(report.Collections[2].Problems, "\n"), "has MACs for") {
+		t.Errorf("Expected 2C3 to be reported as missing chunks: %+v", report.Collections[2])
+	}
+	os.WriteFile(chunks[len(chunks)-1], lastChunk, 0644)
+	os.Rename(filepath.Join(encodedDir, "2C3", file.ChunkMACFileName), filepath.Join(tempDir, "2C3.mac"))
+	err = DecodeDirectory(ctx, DecodeConfig{InputDirs: []string{encodedDir}, OutputDir: filepath.Join(tempDir, "unauthenticated"), Compression: CompressionNone, MACKey: macKey})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected decode without chunk MACs to fail with ErrChecksumMismatch, got %v", err)
+	}
+	os.Rename(filepath.Join(tempDir, "2C3.mac"), filepath.Join(encodedDir, "2C3", file.ChunkMACFileName))
+
+	// A repaired collection gets chunk MACs of its own
+	os.Rename(filepath.Join(encodedDir, "2B3"), filepath.Join(tempDir, "lost"))
+	repairedDir := filepath.Join(tempDir, "repaired")
+	coll, err := RepairCollection(ctx, RepairConfig{InputDirs: []string{encodedDir}, OutputDir: repairedDir, MACKey: macKey})
+	if err != nil {
+		t.Fatalf("Failed to repair: %v", err)
+	}
+	if _, err := file.ReadChunkMACs(ctx, coll, macKey); err != nil {
+		t.Errorf("Expected the repaired collection to have chunk MACs: %v", err)
+	}
+	report, err = VerifyCollections(ctx, VerifyConfig{InputDirs: []string{coll.Path}, MACKey: macKey})
+	if err != nil || !report.Passed() {
+		t.Errorf("Expected the repaired collection to pass authentication: %+v, %v", report, err)
+	}
+}
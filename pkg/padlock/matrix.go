@@ -0,0 +1,200 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// Scheme is a K-of-N threshold configuration
+type Scheme struct {
+	K int `json:"required"` // Collections required for reconstruction
+	N int `json:"copies"`   // Total number of collections
+}
+
+// String returns the scheme in the form accepted by ParseScheme, e.g. "2of3"
+func (s Scheme) String() string {
+	return fmt.Sprintf("%dof%d", s.K, s.N)
+}
+
+// ParseScheme parses a scheme written as "KofN", e.g. "3of5"
+func ParseScheme(s string) (Scheme, error) {
+	k, n, ok := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "of")
+	if !ok {
+		return Scheme{}, fmt.Errorf("invalid scheme %q: expected KofN, e.g. 3of5", s)
+	}
+	scheme := Scheme{}
+	var errK, errN error
+	scheme.K, errK = strconv.Atoi(k)
+	scheme.N, errN = strconv.Atoi(n)
+	if errK != nil || errN != nil {
+		return Scheme{}, fmt.Errorf("invalid scheme %q: expected KofN, e.g. 3of5", s)
+	}
+	if scheme.N < 2 || scheme.N > 26 || scheme.K < 2 || scheme.K > scheme.N {
+		return Scheme{}, fmt.Errorf("%q, need 2 <= K <= N <= 26: %w", s, ErrInvalidScheme)
+	}
+	return scheme, nil
+}
+
+// ParseSchemes parses a comma-separated list of schemes, e.g. "2of3,3of5,4of7"
+func ParseSchemes(s string) ([]Scheme, error) {
+	var schemes []Scheme
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		scheme, err := ParseScheme(part)
+		if err != nil {
+			return nil, err
+		}
+		schemes = append(schemes, scheme)
+	}
+	if len(schemes) == 0 {
+		return nil, fmt.Errorf("no schemes given")
+	}
+	return schemes, nil
+}
+
+// SchemeEstimate is the storage an encode with one scheme would need
+type SchemeEstimate struct {
+	Scheme
+	CollectionSize int64 `json:"collection_bytes"` // Bytes in each collection
+	TotalSize      int64 `json:"total_bytes"`      // Bytes in all collections together
+}
+
+// SizeMatrix compares the storage needed by several schemes for the same input
+type SizeMatrix struct {
+	InputSize           int64            `json:"input_bytes"`                // Size of the serialized input
+	CompressedInputSize int64            `json:"compressed_bytes,omitempty"` // Size of the input after compression, if enabled
+	ChunkSize           int              `json:"chunk_size"`                 // Chunk size the estimates are for
+	Estimates           []SchemeEstimate `json:"estimates"`                  // One estimate per scheme, in the order requested
+}
+
+// EstimateScheme returns the storage that a dry run of an encode with the given scheme and
+// chunk size would report for encodedInputSize bytes of serialized, and possibly compressed,
+// input
+func EstimateScheme(scheme Scheme, chunkSize int, encodedInputSize int64) (SchemeEstimate, error) {
+	return estimateScheme(pad.OTP, scheme, chunkSize, encodedInputSize)
+}
+
+// estimateScheme is EstimateScheme for an encode with the given secret sharing scheme
+func estimateScheme(sharing pad.Sharing, scheme Scheme, chunkSize int, encodedInputSize int64) (SchemeEstimate, error) {
+	size, err := pad.EncodedCollectionSizeWith(sharing, scheme.N, scheme.K, chunkSize, encodedInputSize)
+	if err != nil {
+		return SchemeEstimate{}, fmt.Errorf("scheme %s: %w", scheme, err)
+	}
+	return SchemeEstimate{Scheme: scheme, CollectionSize: size, TotalSize: size * int64(scheme.N)}, nil
+}
+
+// EstimateSizeMatrix reads the input of cfg once and computes, for each scheme, the storage
+// that a dry run of an encode with that scheme would report. The input, chunk size, secret
+// sharing, and compression settings of cfg are used.
+func EstimateSizeMatrix(ctx context.Context, cfg EncodeConfig, schemes []Scheme) (*SizeMatrix, error) {
+	// Check every scheme before reading the input, so a bad one fails fast
+	if cfg.ChunkSize == ChunkSizeAuto {
+		return nil, fmt.Errorf("comparing schemes needs a fixed chunk size, since an automatic one depends on the scheme")
+	}
+	for _, scheme := range schemes {
+		if _, err := estimateScheme(cfg.sharing(), scheme, cfg.ChunkSize, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	inputSize, compressedSize, err := measureInput(ctx, cfg.inputDirs(), cfg.Filter, cfg.Compression, cfg.CompressionLevel)
+	if err != nil {
+		return nil, err
+	}
+	encodedSize := inputSize
+	if compressedSize > 0 {
+		encodedSize = compressedSize
+	}
+
+	matrix := &SizeMatrix{InputSize: inputSize, CompressedInputSize: compressedSize, ChunkSize: cfg.ChunkSize}
+	for _, scheme := range schemes {
+		estimate, err := estimateScheme(cfg.sharing(), scheme, cfg.ChunkSize, encodedSize)
+		if err != nil {
+			return nil, err
+		}
+		matrix.Estimates = append(matrix.Estimates, estimate)
+	}
+	return matrix, nil
+}
+
+// measureInput serializes the entries of inputDirs that filter selects in a single pass and
+// returns their size, and their size after compression if compression is enabled, or 0 if it
+// isn't
+func measureInput(ctx context.Context, inputDirs []string, filter *file.Filter, compression Compression, level int) (int64, int64, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if err := validateInputDirs(ctx, inputDirs); err != nil {
+		return 0, 0, err
+	}
+
+	tarStream, err := file.SerializeDirectoriesWithFilter(ctx, inputDirs, filter)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to create tar stream: %w", err))
+		return 0, 0, fmt.Errorf("failed to create tar stream: %w", err)
+	}
+	defer tarStream.Close()
+
+	input := NewSizeTrackingReader(tarStream, nil, true)
+	var stream io.Reader = input
+	if compression == CompressionAuto {
+		stream, compression, err = resolveAutoCompression(ctx, stream)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if compression.effective() != CompressionNone {
+		stream, err = file.CompressStream(ctx, input, compression.String(), level)
+		if err != nil {
+			log.Error(fmt.Errorf("failed to compress input: %w", err))
+			return 0, 0, fmt.Errorf("failed to compress input: %w", err)
+		}
+	}
+	encoded := NewSizeTrackingReader(stream, nil, true)
+	if _, err := io.Copy(io.Discard, encoded); err != nil {
+		log.Error(fmt.Errorf("failed to read input: %w", err))
+		return 0, 0, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	if compression.effective() == CompressionNone {
+		return input.Size, 0, nil
+	}
+	return input.Size, encoded.Size, nil
+}
+
+// Print writes the comparison as a human-readable table
+func (m *SizeMatrix) Print(w io.Writer) {
+	fmt.Fprintf(w, "Original input size:   %s\n", FormatByteSize(m.InputSize))
+	if m.CompressedInputSize > 0 {
+		fmt.Fprintf(w, "Compressed input size: %s\n", FormatByteSize(m.CompressedInputSize))
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "  %-8s %-10s %18s %18s %10s\n", "Scheme", "Survives", "Each collection", "Total", "Expansion")
+	for _, e := range m.Estimates {
+		expansion := 0.0
+		if m.InputSize > 0 {
+			expansion = float64(e.TotalSize) / float64(m.InputSize) * 100.0
+		}
+		fmt.Fprintf(w, "  %-8s %-10s %18s %18s %9.0f%%\n", e.Scheme, fmt.Sprintf("%d lost", e.N-e.K),
+			FormatByteSize(e.CollectionSize), FormatByteSize(e.TotalSize), expansion)
+	}
+}
+
+// WriteJSON writes the comparison as indented JSON
+func (m *SizeMatrix) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
@@ -0,0 +1,110 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestParseSchemes(t *testing.T) {
+	schemes, err := ParseSchemes("2of3, 3OF5,4of7,")
+	if err != nil {
+		t.Fatalf("Failed to parse schemes: %v", err)
+	}
+	want := []Scheme{{K: 2, N: 3}, {K: 3, N: 5}, {K: 4, N: 7}}
+	if len(schemes) != len(want) {
+		t.Fatalf("Expected %d schemes, got %d", len(want), len(schemes))
+	}
+	for i := range want {
+		if schemes[i] != want[i] {
+			t.Errorf("Scheme %d: expected %v, got %v", i, want[i], schemes[i])
+		}
+	}
+
+	for _, bad := range []string{"", "3", "3of", "of5", "1of3", "4of3", "2of27", "twoofthree"} {
+		if _, err := ParseSchemes(bad); err == nil {
+			t.Errorf("Expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestEstimateSizeMatrixMatchesEncode(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "padlock-matrix-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := os.WriteFile(filepath.Join(tempDir, "test.txt"), []byte(strings.Repeat("what if ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	cfg := EncodeConfig{
+		InputDir:    tempDir,
+		Format:      FormatBin,
+		ChunkSize:   1000,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+	}
+	schemes := []Scheme{{K: 2, N: 3}, {K: 3, N: 5}}
+	matrix, err := EstimateSizeMatrix(ctx, cfg, schemes)
+	if err != nil {
+		t.Fatalf("Failed to estimate sizes: %v", err)
+	}
+	if matrix.InputSize == 0 || matrix.CompressedInputSize == 0 || matrix.CompressedInputSize >= matrix.InputSize {
+		t.Errorf("Unexpected input sizes: %d, compressed %d", matrix.InputSize, matrix.CompressedInputSize)
+	}
+
+	// Each estimate matches the bytes actually produced by an encode with that scheme
+	for i, scheme := range schemes {
+		store := newMemoryStore()
+		cfg.N, cfg.K, cfg.ChunkSink = scheme.N, scheme.K, store
+		if err := EncodeDirectory(ctx, cfg); err != nil {
+			t.Fatalf("Failed to encode %s: %v", scheme, err)
+		}
+
+		sizes := make(map[string]int64)
+		for key, data := range store.chunks {
+			collection, _, _ := strings.Cut(key, "/")
+			sizes[collection] += int64(len(data))
+		}
+		if len(sizes) != scheme.N {
+			t.Fatalf("Expected %d collections for %s, got %d", scheme.N, scheme, len(sizes))
+		}
+		var total int64
+		for collection, size := range sizes {
+			if size != matrix.Estimates[i].CollectionSize {
+				t.Errorf("%s collection %s: estimated %d bytes, encoded %d", scheme, collection, matrix.Estimates[i].CollectionSize, size)
+			}
+			total += size
+		}
+		if total != matrix.Estimates[i].TotalSize {
+			t.Errorf("%s: estimated %d bytes in total, encoded %d", scheme, matrix.Estimates[i].TotalSize, total)
+		}
+	}
+
+	var out bytes.Buffer
+	matrix.Print(&out)
+	if !strings.Contains(out.String(), "3of5") || !strings.Contains(out.String(), "2 lost") {
+		t.Errorf("Unexpected table:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := matrix.WriteJSON(&out); err != nil {
+		t.Fatalf("Failed to write JSON: %v", err)
+	}
+	var decoded SizeMatrix
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded.Estimates) != len(schemes) || decoded.Estimates[1] != matrix.Estimates[1] {
+		t.Errorf("JSON did not read back: %v\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// PipelineConfig controls the buffering between pipeline stages and bounds the memory used
+// by encode and decode, so that padlock can run on small recovery machines.
+//
+// Resident memory is dominated by chunks held in memory at once. Encoding holds the pieces
+// of every collection for the current chunk and for the next, which is generated while the
+// current one is written, so about 2N chunks' worth, plus the two input buffers they are
+// split from and a buffered and a formatted copy of each of the N collection chunks;
+// decoding holds a read-ahead and a decoded copy of each available collection chunk plus
+// the reconstructed chunk, and the chunks prefetched in memory. EstimateEncodeMemory and
+// EstimateDecodeMemory give the resulting bound. When encoding with a memory limit, the
+// chunk size is chosen so that decoding all N collections later fits within the same limit.
+type PipelineConfig struct {
+	PipeBufferSize int    // Bytes buffered between the stream and pad stages (0 = unbuffered hand-off)
+	MaxMemory      int64  // If nonzero, the estimated resident memory must not exceed this many bytes
+	PrefetchChunks int    // Decode: chunks read ahead of the decoder from each collection, in parallel (0 = DefaultPrefetchChunks from disk, none from a ChunkSource)
+	PrefetchDir    string // Decode: if set, prefetched chunks are cached in files here instead of in memory
+	WriteThreads   int    // Encode: collections whose chunks are written concurrently to output directories (0 or 1 = one at a time)
+}
+
+// DefaultPrefetchChunks is how many chunks of each collection on disk are read ahead of the
+// decoder when PrefetchChunks is 0, so that reading and extracting the next chunk of every
+// collection overlaps with combining the current ones
+const DefaultPrefetchChunks = 1
+
+// pipelineBaseMemory covers memory that doesn't scale with the chunk size: the Go runtime,
+// gzip state, TAR headers, and bookkeeping
+const pipelineBaseMemory = 32 << 20
+
+// minEncodeChunkSize is the smallest chunk size encode will reduce to in order to fit a
+// memory bound
+const minEncodeChunkSize = 64 << 10
+
+// EstimateEncodeMemory returns the approximate peak resident memory of an encode that splits
+// its data with sharing (pad.OTP if nil) into n collections, k required, with the given chunk
+// size and pipeline configuration
+func EstimateEncodeMemory(sharing pad.Sharing, n, k, chunkSize int, pipeline PipelineConfig) int64 {
+	if sharing == nil {
+		sharing = pad.OTP
+	}
+
+	// Each chunk encodes chunkSize/pieces bytes of input, split into pieces of that size for
+	// each of the n collections, for the chunk being written and the next
+	pieces := sharing.Pieces(n, k)
+	inputChunkBytes := int64(chunkSize) / pieces
+	splitBytes := 2 * int64(n) * pieces * inputChunkBytes
+	return pipelineBaseMemory + 2*inputChunkBytes + splitBytes + int64(2*n)*int64(chunkSize) + int64(max(pipeline.PipeBufferSize, 0))
+}
+
+// EstimateDecodeMemory returns the approximate peak resident memory of a decode reading n
+// collections whose chunks are chunkSize bytes, with the given pipeline configuration
+func EstimateDecodeMemory(n, chunkSize int, pipeline PipelineConfig) int64 {
+	chunks := int64(3*n + 1)
+	if pipeline.PrefetchDir == "" {
+		chunks += int64(n * pipeline.prefetchDepth())
+	}
+	return pipelineBaseMemory + chunks*int64(chunkSize) + int64(max(pipeline.PipeBufferSize, 0))
+}
+
+// prefetchDepth returns how many chunks of each collection on disk are read ahead of the decoder
+func (pipeline PipelineConfig) prefetchDepth() int {
+	if pipeline.PrefetchChunks > 0 {
+		return pipeline.PrefetchChunks
+	}
+	return DefaultPrefetchChunks
+}
+
+// chunkHeaderAllowance covers the chunk name header stored with each chunk payload
+const chunkHeaderAllowance = 256
+
+// fitEncodeMemory returns the chunk size to encode with so that both the encode and a later
+// decode of all n collections stay within pipeline.MaxMemory, reducing chunkSize if necessary
+func fitEncodeMemory(ctx context.Context, sharing pad.Sharing, n, k, chunkSize int, pipeline PipelineConfig) (int, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	estimate := func(chunkSize int) int64 {
+		return max(EstimateEncodeMemory(sharing, n, k, chunkSize, pipeline), EstimateDecodeMemory(n, chunkSize+chunkHeaderAllowance, pipeline))
+	}
+	if pipeline.MaxMemory == 0 || estimate(chunkSize) <= pipeline.MaxMemory {
+		log.Debugf("Estimated encode memory: %s", file.FormatSize(estimate(chunkSize)))
+		return chunkSize, nil
+	}
+
+	// Either estimate may be the larger, depending on the sharing scheme, but both grow with
+	// the chunk size, so search for the largest chunk size under which both fit
+	fitted := minEncodeChunkSize - 1 + sort.Search(chunkSize-minEncodeChunkSize+1, func(i int) bool {
+		return estimate(minEncodeChunkSize+i) > pipeline.MaxMemory
+	})
+	if fitted < minEncodeChunkSize {
+		err := fmt.Errorf("memory limit of %s is too small to encode %d collections (at least %s needed)",
+			file.FormatSize(pipeline.MaxMemory), n, file.FormatSize(estimate(minEncodeChunkSize)))
+		log.Error(err)
+		return 0, err
+	}
+
+	log.Infof("Reducing chunk size from %d to %d bytes to stay within memory limit of %s",
+		chunkSize, fitted, file.FormatSize(pipeline.MaxMemory))
+	return fitted, nil
+}
+
+// checkDecodeMemory verifies that decoding the collections fits within pipeline.MaxMemory,
+// using the size of the first chunk of the first collection as the chunk size
+func checkDecodeMemory(ctx context.Context, collections []file.Collection, pipeline PipelineConfig) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if pipeline.MaxMemory == 0 || len(collections) == 0 {
+		return nil
+	}
+
+	reader := file.NewCollectionReader(collections[0])
+	defer reader.Close()
+	chunk, err := reader.ReadNextChunk(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read first chunk of collection %s: %w", collections[0].Name, err)
+	}
+
+	estimate := EstimateDecodeMemory(len(collections), len(chunk), pipeline)
+	log.Debugf("Estimated decode memory: %s for %d collections with %d byte chunks", file.FormatSize(estimate), len(collections), len(chunk))
+	if estimate > pipeline.MaxMemory {
+		err := fmt.Errorf("decoding %d collections with %d byte chunks needs about %s, above the memory limit of %s; decode with fewer collections or a higher limit",
+			len(collections), len(chunk), file.FormatSize(estimate), file.FormatSize(pipeline.MaxMemory))
+		log.Error(err)
+		return err
+	}
+	return nil
+}
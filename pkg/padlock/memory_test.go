@@ -0,0 +1,198 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestFitEncodeMemory(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	// No limit leaves the chunk size alone
+	size, err := fitEncodeMemory(ctx, nil, 5, 3, 2<<20, PipelineConfig{})
+	if err != nil || size != 2<<20 {
+		t.Errorf("Expected unchanged chunk size, got %d, %v", size, err)
+	}
+
+	// A limit reduces the chunk size so that decoding every collection fits
+	pipeline := PipelineConfig{PipeBufferSize: 1 << 20, MaxMemory: 64 << 20}
+	size, err = fitEncodeMemory(ctx, nil, 5, 3, 8<<20, pipeline)
+	if err != nil {
+		t.Fatalf("fitEncodeMemory failed: %v", err)
+	}
+	if size >= 8<<20 || size < minEncodeChunkSize {
+		t.Errorf("Unexpected fitted chunk size %d", size)
+	}
+	if estimate := EstimateEncodeMemory(nil, 5, 3, size, pipeline); estimate > pipeline.MaxMemory {
+		t.Errorf("Encode estimate %d exceeds limit %d", estimate, pipeline.MaxMemory)
+	}
+	if estimate := EstimateDecodeMemory(5, size+chunkHeaderAllowance, pipeline); estimate > pipeline.MaxMemory {
+		t.Errorf("Decode estimate %d exceeds limit %d", estimate, pipeline.MaxMemory)
+	}
+
+	// In-memory prefetch counts toward decode memory, but a scratch cache doesn't
+	prefetch := pipeline
+	prefetch.PrefetchChunks = 4
+	if EstimateDecodeMemory(5, size, prefetch) <= EstimateDecodeMemory(5, size, pipeline) {
+		t.Errorf("Expected in-memory prefetch to increase the decode estimate")
+	}
+	prefetch.PrefetchDir = os.TempDir()
+	shallow := prefetch
+	shallow.PrefetchChunks = 1
+	if EstimateDecodeMemory(5, size, prefetch) != EstimateDecodeMemory(5, size, shallow) {
+		t.Errorf("Expected the depth of prefetch to a scratch dir not to change the decode estimate")
+	}
+	if EstimateDecodeMemory(5, size, prefetch) >= EstimateDecodeMemory(5, size, pipeline) {
+		t.Errorf("Expected the default in-memory read-ahead to count toward the decode estimate")
+	}
+
+	// A limit below the fixed overhead is rejected
+	if _, err := fitEncodeMemory(ctx, nil, 5, 3, 2<<20, PipelineConfig{MaxMemory: 1 << 20}); err == nil {
+		t.Errorf("Expected an error for a memory limit that is too small")
+	}
+}
+
+// zeroRNG fills buffers with zeros without allocating, so that only the split's own buffers
+// are measured
+type zeroRNG struct{}
+
+func (zeroRNG) Name() string { return "zero" }
+
+func (zeroRNG) Read(ctx context.Context, p []byte) error {
+	clear(p)
+	return nil
+}
+
+// TestEstimateEncodeMemory checks the encode estimate against what a 3-of-5 OTP encode
+// actually allocates to split a chunk, of which it holds two at once
+func TestEstimateEncodeMemory(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	const chunkSize = 1 << 20
+
+	p, err := pad.NewPadForEncodeWith(ctx, 5, 3, pad.OTP)
+	if err != nil {
+		t.Fatalf("NewPadForEncodeWith failed: %v", err)
+	}
+	data := make([]byte, p.InputChunkBytes(chunkSize))
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	pieces, err := pad.OTP.Split(ctx, p, data, zeroRNG{})
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	allocated := int64(after.TotalAlloc - before.TotalAlloc)
+	if len(pieces) != 5 || allocated < 5*chunkSize*9/10 {
+		t.Fatalf("Expected splitting a chunk to allocate about 5 chunks, got %d bytes in %d collections", allocated, len(pieces))
+	}
+
+	// The current and next chunk's pieces, and the buffered and formatted collection chunks
+	estimate := EstimateEncodeMemory(pad.OTP, 5, 3, chunkSize, PipelineConfig{}) - pipelineBaseMemory
+	if want := 2*allocated + 2*5*chunkSize; estimate < want {
+		t.Errorf("Encode estimate %d is below the %d bytes a 3-of-5 encode allocates", estimate, want)
+	}
+	if estimate > 2*(2*allocated+2*5*chunkSize) {
+		t.Errorf("Encode estimate %d is far above the %d bytes a 3-of-5 encode allocates", estimate, 2*allocated+2*5*chunkSize)
+	}
+}
+
+func TestEncodeDecodeWithMemoryLimit(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-memory-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	outputDir := filepath.Join(tempDir, "output")
+	decodedDir := filepath.Join(tempDir, "decoded")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	content := make([]byte, 300000)
+	rand.Read(content)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.bin"), content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	pipeline := PipelineConfig{PipeBufferSize: 64 << 10, MaxMemory: 40 << 20}
+
+	cfg := EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          outputDir,
+		N:                  3,
+		K:                  2,
+		Format:             FormatBin,
+		ChunkSize:          16 << 20,
+		RNG:                pad.NewDefaultRand(ctx),
+		ClearIfNotEmpty:    true,
+		Compression:        CompressionGzip,
+		ArchiveCollections: true,
+		Pipeline:           pipeline,
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	decodeCfg := DecodeConfig{
+		InputDir:        outputDir,
+		OutputDir:       decodedDir,
+		Compression:     CompressionGzip,
+		ClearIfNotEmpty: true,
+		Pipeline:        pipeline,
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode within the memory limit it was encoded for: %v", err)
+	}
+	decoded, err := os.ReadFile(filepath.Join(decodedDir, "test.bin"))
+	if err != nil || len(decoded) != len(content) {
+		t.Fatalf("Decoded content mismatch: %d bytes, %v", len(decoded), err)
+	}
+
+	// Prefetching chunks ahead of the decoder, in memory or through a scratch cache, decodes the same
+	for _, prefetchDir := range []string{"", filepath.Join(tempDir, "scratch")} {
+		if prefetchDir != "" {
+			if err := os.MkdirAll(prefetchDir, 0755); err != nil {
+				t.Fatalf("Failed to create scratch dir: %v", err)
+			}
+		}
+		prefetchCfg := decodeCfg
+		prefetchCfg.Pipeline.MaxMemory = 0 // In-memory prefetch would exceed the limit the chunks were fitted to
+		prefetchCfg.Pipeline.PrefetchChunks = 4
+		prefetchCfg.Pipeline.PrefetchDir = prefetchDir
+		if err := DecodeDirectory(ctx, prefetchCfg); err != nil {
+			t.Fatalf("Failed to decode with prefetch: %v", err)
+		}
+		decoded, err := os.ReadFile(filepath.Join(decodedDir, "test.bin"))
+		if err != nil || !bytes.Equal(decoded, content) {
+			t.Fatalf("Prefetched decode content mismatch: %d bytes, %v", len(decoded), err)
+		}
+		if prefetchDir != "" {
+			if entries, _ := os.ReadDir(prefetchDir); len(entries) != 0 {
+				t.Errorf("Expected the prefetch cache to be removed, found %d entries", len(entries))
+			}
+		}
+	}
+
+	// A tighter limit than the collections were encoded for is refused up front
+	decodeCfg.Pipeline.MaxMemory = pipelineBaseMemory + 1
+	if err := DecodeDirectory(ctx, decodeCfg); err == nil {
+		t.Errorf("Expected decode to be refused under a tighter memory limit")
+	}
+}
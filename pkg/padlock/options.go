@@ -0,0 +1,844 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+)
+
+// ConfigError reports an option, or a combination of options, that NewEncodeConfig or
+// NewDecodeConfig rejected. Callers can find it with errors.As to tell a configuration
+// mistake from a failure of the operation itself.
+type ConfigError struct {
+	Option string // Name of the option at fault, e.g. "WithScheme"
+	Err    error  // What is wrong with it
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Option, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// configErrorf returns a ConfigError for option with a formatted reason
+func configErrorf(option string, format string, args ...any) error {
+	return &ConfigError{Option: option, Err: fmt.Errorf(format, args...)}
+}
+
+// Option sets part of an EncodeConfig or DecodeConfig. Options that only make sense for one
+// operation are rejected with a ConfigError when given to the other.
+type Option struct {
+	name   string
+	encode func(cfg *EncodeConfig) error
+	decode func(cfg *DecodeConfig) error
+}
+
+// DefaultChunkSize is the chunk size NewEncodeConfig uses unless WithChunkSize is given
+const DefaultChunkSize = 2 * 1024 * 1024
+
+// NewEncodeConfig returns an EncodeConfig built from opts, with the command line's defaults
+// for anything not set: a 2-of-2 scheme, or N-of-N for N output directories, PNG chunks of
+// DefaultChunkSize, automatic compression, and TAR archives. Combinations of options are
+// checked before it returns, so that mistakes surface as a ConfigError rather than part way
+// through an encode.
+func NewEncodeConfig(opts ...Option) (EncodeConfig, error) {
+	cfg := EncodeConfig{
+		Format:             FormatPNG,
+		ChunkSize:          DefaultChunkSize,
+		Compression:        CompressionAuto,
+		ArchiveCollections: true,
+		ArchiveFormat:      ArchiveTar,
+	}
+	for _, opt := range opts {
+		if opt.encode == nil {
+			return EncodeConfig{}, configErrorf(opt.name, "not an encode option")
+		}
+		if err := opt.encode(&cfg); err != nil {
+			return EncodeConfig{}, err
+		}
+	}
+
+	// Several output directories imply one collection each, unless a scheme says otherwise
+	if cfg.N == 0 {
+		cfg.N, cfg.K = max(len(cfg.OutputDirs), 2), max(len(cfg.OutputDirs), 2)
+	}
+	if len(cfg.OutputDirs) > 1 && len(cfg.OutputDirs) != cfg.N {
+		return EncodeConfig{}, configErrorf("WithOutputs", "%d output directories given for %d collections", len(cfg.OutputDirs), cfg.N)
+	}
+
+	switch {
+	case cfg.InputDir == "" && cfg.InputStream == nil && cfg.RawInput == nil:
+		return EncodeConfig{}, configErrorf("WithInput", "an input directory or stream is required")
+	case cfg.RawInput != nil && cfg.ChunkSink != nil:
+		return EncodeConfig{}, configErrorf("WithRawInput", "cannot be combined with a chunk sink")
+	case cfg.ChunkSink != nil && len(cfg.OutputDirs) > 0:
+		return EncodeConfig{}, configErrorf("WithChunkSink", "cannot be combined with output directories")
+	case cfg.ChunkSink == nil && len(cfg.OutputDirs) == 0:
+		if !cfg.SizeOnly {
+			return EncodeConfig{}, configErrorf("WithOutputs", "at least one output directory is required")
+		}
+		// A dry run writes nothing, so a placeholder will do
+		cfg.OutputDir = "dryrun-output"
+		cfg.OutputDirs = []string{cfg.OutputDir}
+	}
+
+	if !cfg.usesFormat(FormatPNG) {
+		if cfg.CoverDir != "" || cfg.GeneratedCovers {
+			return EncodeConfig{}, configErrorf("WithCovers", "covers can only be used with PNG chunks")
+		}
+		if cfg.PNGEmbedding != "" {
+			return EncodeConfig{}, configErrorf("WithPNGEmbedding", "can only be used with PNG chunks")
+		}
+	}
+	if cfg.VolumeSize > 0 && (!cfg.ArchiveCollections || cfg.ChunkSink != nil) {
+		return EncodeConfig{}, configErrorf("WithVolumeSize", "volumes can only be used when collections are written as archives")
+	}
+	if cfg.ChunkIndex && (cfg.RawInput != nil || cfg.InputStream != nil || cfg.ChunkSink != nil) {
+		return EncodeConfig{}, configErrorf("WithChunkIndex", "can only be used when input directories are encoded to output directories")
+	}
+	if len(cfg.Weights) > 0 {
+		if _, _, err := weightedScheme(cfg); err != nil {
+			return EncodeConfig{}, configErrorf("WithWeights", "%w", err)
+		}
+	}
+	if err := checkFormats(cfg); err != nil {
+		return EncodeConfig{}, configErrorf("WithFormats", "%v", err)
+	}
+	if err := checkRecoveryNotes(cfg); err != nil {
+		return EncodeConfig{}, configErrorf("WithRecoveryNotes", "%v", err)
+	}
+	if cfg.Dedup && (cfg.RawInput != nil || cfg.ChunkIndex) {
+		return EncodeConfig{}, configErrorf("WithDedup", "can only be used for input directories, without WithChunkIndex")
+	}
+	if cfg.Resume && cfg.ClearIfNotEmpty {
+		return EncodeConfig{}, configErrorf("WithResume", "cannot be combined with WithClear, which would remove the output to resume")
+	}
+	if cfg.Append && (cfg.Resume || cfg.ClearIfNotEmpty) {
+		return EncodeConfig{}, configErrorf("WithAppend", "cannot be combined with WithResume or WithClear")
+	}
+	if cfg.SnapshotsPath != "" && cfg.ChunkSink != nil {
+		return EncodeConfig{}, configErrorf("WithSnapshots", "the chunks of a sink have no location to record")
+	}
+	if len(cfg.Labels) > 0 && len(cfg.Labels) != cfg.N {
+		return EncodeConfig{}, configErrorf("WithLabels", "%d labels given for %d collections", len(cfg.Labels), cfg.N)
+	}
+	if len(cfg.Notes) > 0 && len(cfg.Notes) != cfg.N {
+		return EncodeConfig{}, configErrorf("WithNotes", "%d notes given for %d collections", len(cfg.Notes), cfg.N)
+	}
+	if len(cfg.Custodians) > 0 && len(cfg.Custodians) != cfg.N {
+		return EncodeConfig{}, configErrorf("WithCustodians", "%d custodians given for %d collections", len(cfg.Custodians), cfg.N)
+	}
+	return cfg, nil
+}
+
+// NewDecodeConfig returns a DecodeConfig built from opts. The collections are read from the
+// directories given with WithInputs, or from a WithChunkSource, and restored to the
+// directory given with WithOutput, or to the stream given with WithOutputStream or
+// WithTarOutput; a dry run may leave both out.
+func NewDecodeConfig(opts ...Option) (DecodeConfig, error) {
+	cfg := DecodeConfig{Compression: CompressionGzip}
+	for _, opt := range opts {
+		if opt.decode == nil {
+			return DecodeConfig{}, configErrorf(opt.name, "not a decode option")
+		}
+		if err := opt.decode(&cfg); err != nil {
+			return DecodeConfig{}, err
+		}
+	}
+
+	switch {
+	case cfg.ChunkSource != nil && len(cfg.InputDirs) > 0:
+		return DecodeConfig{}, configErrorf("WithChunkSource", "cannot be combined with input directories")
+	case cfg.ChunkSource == nil && len(cfg.InputDirs) == 0:
+		return DecodeConfig{}, configErrorf("WithInputs", "at least one input directory is required")
+	}
+	if cfg.OutputDir == "" && cfg.OutputStream == nil {
+		if !cfg.SizeOnly {
+			return DecodeConfig{}, configErrorf("WithOutput", "an output directory is required")
+		}
+		cfg.OutputDir = "dryrun-output"
+	}
+	if cfg.Pipeline.PrefetchDir != "" && cfg.Pipeline.PrefetchChunks == 0 {
+		return DecodeConfig{}, configErrorf("WithPipeline", "a prefetch directory requires prefetched chunks")
+	}
+	if cfg.Filter != nil && cfg.OutputStream != nil {
+		return DecodeConfig{}, configErrorf("WithFilter", "files can only be selected when decoding to an output directory")
+	}
+	return cfg, nil
+}
+
+// WithInput sets the directory to encode, or several directories to encode together into
+// one set of collections, each under a top-level directory named after it
+func WithInput(dirs ...string) Option {
+	return Option{
+		name: "WithInput",
+		encode: func(cfg *EncodeConfig) error {
+			if len(dirs) == 0 {
+				return configErrorf("WithInput", "no input directory")
+			}
+			for _, dir := range dirs {
+				if dir == "" {
+					return configErrorf("WithInput", "empty input directory")
+				}
+			}
+			cfg.InputDir = dirs[0]
+			cfg.InputDirs = nil
+			if len(dirs) > 1 {
+				cfg.InputDirs = append([]string(nil), dirs...)
+			}
+			return nil
+		},
+	}
+}
+
+// WithRawInput encodes the bytes read from r, such as stdin, as they are instead of an input
+// directory. Decode restores them to a file called name, or DefaultStreamName if name is
+// empty, or writes them to the stream given with WithOutputStream.
+func WithRawInput(r io.Reader, name string) Option {
+	return Option{
+		name: "WithRawInput",
+		encode: func(cfg *EncodeConfig) error {
+			if r == nil {
+				return configErrorf("WithRawInput", "no input stream")
+			}
+			cfg.RawInput, cfg.RawInputName = r, name
+			return nil
+		},
+	}
+}
+
+// WithFilter leaves the entries of the input directory that filter excludes out of an encode,
+// or if it has include patterns, everything they don't match. In a decode, only the entries
+// it selects are restored. Use NewFilter to make one.
+func WithFilter(filter *Filter) Option {
+	return Option{
+		name: "WithFilter",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.Filter = filter
+			return nil
+		},
+		decode: func(cfg *DecodeConfig) error {
+			cfg.Filter = filter
+			return nil
+		},
+	}
+}
+
+// WithChunkIndex compresses the input of an encode in blocks and ends it with an index of the
+// chunks holding each file, so that a decode restoring some of the files with WithFilter
+// decodes only the chunks that hold them
+func WithChunkIndex() Option {
+	return Option{
+		name: "WithChunkIndex",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.ChunkIndex = true
+			return nil
+		},
+	}
+}
+
+// WithOutputs sets the directories an encode writes its collections to: one directory to
+// hold them all, or one directory per collection
+func WithOutputs(dirs ...string) Option {
+	return Option{
+		name: "WithOutputs",
+		encode: func(cfg *EncodeConfig) error {
+			for _, dir := range dirs {
+				if dir == "" {
+					return configErrorf("WithOutputs", "empty output directory")
+				}
+			}
+			if len(dirs) > 0 {
+				cfg.OutputDir = dirs[0]
+			}
+			cfg.OutputDirs = append([]string(nil), dirs...)
+			return nil
+		},
+	}
+}
+
+// WithInputs sets the directories or archives a decode reads collections from
+func WithInputs(dirs ...string) Option {
+	return Option{
+		name: "WithInputs",
+		decode: func(cfg *DecodeConfig) error {
+			for _, dir := range dirs {
+				if dir == "" {
+					return configErrorf("WithInputs", "empty input directory")
+				}
+			}
+			if len(dirs) > 0 {
+				cfg.InputDir = dirs[0]
+			}
+			cfg.InputDirs = append([]string(nil), dirs...)
+			return nil
+		},
+	}
+}
+
+// WithOutput sets the directory a decode restores the original files to
+func WithOutput(dir string) Option {
+	return Option{
+		name: "WithOutput",
+		decode: func(cfg *DecodeConfig) error {
+			if dir == "" {
+				return configErrorf("WithOutput", "empty output directory")
+			}
+			cfg.OutputDir = dir
+			return nil
+		},
+	}
+}
+
+// WithOutputStream writes the raw stream the collections of a decode encode, such as one read
+// from stdin by WithRawInput, to w instead of to a file in an output directory. Collections
+// of a directory can only be written to a stream as a TAR, with WithTarOutput.
+func WithOutputStream(w io.Writer) Option {
+	return Option{
+		name: "WithOutputStream",
+		decode: func(cfg *DecodeConfig) error {
+			if w == nil {
+				return configErrorf("WithOutputStream", "no output stream")
+			}
+			cfg.OutputStream = w
+			return nil
+		},
+	}
+}
+
+// WithTarOutput writes the TAR the collections of a decode encode to w as it is, instead of
+// extracting it to an output directory, so that other tools can extract or inspect it. If
+// compressed is set, the TAR is left compressed as it was encoded.
+func WithTarOutput(w io.Writer, compressed bool) Option {
+	return Option{
+		name: "WithTarOutput",
+		decode: func(cfg *DecodeConfig) error {
+			if w == nil {
+				return configErrorf("WithTarOutput", "no output stream")
+			}
+			cfg.OutputStream, cfg.OutputTar, cfg.KeepCompressed = w, true, compressed
+			return nil
+		},
+	}
+}
+
+// WithScheme sets an encode to create n collections, any k of which restore the data
+func WithScheme(k, n int) Option {
+	return Option{
+		name: "WithScheme",
+		encode: func(cfg *EncodeConfig) error {
+			if k < 2 || k > n || n > 26 {
+				return configErrorf("WithScheme", "%d-of-%d, need 2 <= K <= N <= 26: %w", k, n, ErrInvalidScheme)
+			}
+			cfg.K, cfg.N = k, n
+			return nil
+		},
+	}
+}
+
+// WithSharing sets the secret sharing scheme an encode splits the data with; pad.OTP is the
+// default
+func WithSharing(sharing pad.Sharing) Option {
+	return Option{
+		name: "WithSharing",
+		encode: func(cfg *EncodeConfig) error {
+			if sharing == nil {
+				return configErrorf("WithSharing", "no secret sharing scheme given")
+			}
+			cfg.Sharing = sharing
+			return nil
+		},
+	}
+}
+
+// WithFormat sets the format chunks are written in
+func WithFormat(format Format) Option {
+	return Option{
+		name: "WithFormat",
+		encode: func(cfg *EncodeConfig) error {
+			switch format {
+			case FormatBin, FormatPNG, FormatText, FormatWAV:
+				cfg.Format = format
+				return nil
+			}
+			return configErrorf("WithFormat", "unknown format %q: expected bin, png, txt, or wav", format)
+		},
+	}
+}
+
+// WithFormats sets the format the chunks of each collection are written in, in order, in
+// place of WithFormat; with WithWeights, the format of each output directory's collections
+func WithFormats(formats ...Format) Option {
+	return Option{
+		name: "WithFormats",
+		encode: func(cfg *EncodeConfig) error {
+			for _, format := range formats {
+				switch format {
+				case FormatBin, FormatPNG, FormatText, FormatWAV:
+				default:
+					return configErrorf("WithFormats", "unknown format %q: expected bin, png, txt, or wav", format)
+				}
+			}
+			cfg.Formats = append([]Format(nil), formats...)
+			return nil
+		},
+	}
+}
+
+// WithChunkSize sets the maximum size of each chunk in bytes, or ChunkSizeAuto to choose it
+// from the size of the input
+func WithChunkSize(size int) Option {
+	return Option{
+		name: "WithChunkSize",
+		encode: func(cfg *EncodeConfig) error {
+			if size <= 0 && size != ChunkSizeAuto {
+				return configErrorf("WithChunkSize", "chunk size must be positive, got %d", size)
+			}
+			cfg.ChunkSize = size
+			return nil
+		},
+	}
+}
+
+// WithChunkCount sets the range of chunks per collection that ChunkSizeAuto aims for
+func WithChunkCount(count ChunkRange) Option {
+	return Option{
+		name: "WithChunkCount",
+		encode: func(cfg *EncodeConfig) error {
+			if err := count.check(); err != nil {
+				return &ConfigError{Option: "WithChunkCount", Err: err}
+			}
+			cfg.ChunkCount = count
+			return nil
+		},
+	}
+}
+
+// WithCompression sets the compression applied before encoding, and level, or 0 for the
+// algorithm's default. For a decode, it is the compression the encode applied; level is
+// ignored.
+func WithCompression(c Compression, level int) Option {
+	check := func() error {
+		name := c.String()
+		switch c {
+		case CompressionNone:
+			if level != 0 {
+				return configErrorf("WithCompression", "compression none doesn't take a level")
+			}
+			return nil
+		case CompressionAuto:
+			name = CompressionGzip.String()
+		case CompressionGzip, CompressionZstd:
+		default:
+			return configErrorf("WithCompression", "unknown compression %s", c)
+		}
+		compressor, err := file.LookupCompressor(name)
+		if err == nil {
+			err = compressor.CheckLevel(level)
+		}
+		if err != nil {
+			return &ConfigError{Option: "WithCompression", Err: err}
+		}
+		return nil
+	}
+	return Option{
+		name: "WithCompression",
+		encode: func(cfg *EncodeConfig) error {
+			if err := check(); err != nil {
+				return err
+			}
+			cfg.Compression, cfg.CompressionLevel = c, level
+			return nil
+		},
+		decode: func(cfg *DecodeConfig) error {
+			if err := check(); err != nil {
+				return err
+			}
+			cfg.Compression = c
+			return nil
+		},
+	}
+}
+
+// WithArchive packs each collection into an archive of the given format. An empty format
+// writes each collection as a directory of individual chunk files instead.
+func WithArchive(format ArchiveFormat) Option {
+	return Option{
+		name: "WithArchive",
+		encode: func(cfg *EncodeConfig) error {
+			if format == "" {
+				cfg.ArchiveCollections, cfg.ArchiveFormat = false, ""
+				return nil
+			}
+			if _, err := file.ParseArchiveFormat(string(format)); err != nil {
+				return &ConfigError{Option: "WithArchive", Err: err}
+			}
+			cfg.ArchiveCollections, cfg.ArchiveFormat = true, format
+			return nil
+		},
+	}
+}
+
+// WithVolumeSize splits each collection archive into volumes of at most size bytes
+func WithVolumeSize(size int64) Option {
+	return Option{
+		name: "WithVolumeSize",
+		encode: func(cfg *EncodeConfig) error {
+			if size <= 0 {
+				return configErrorf("WithVolumeSize", "volume size must be positive, got %d", size)
+			}
+			cfg.VolumeSize = size
+			return nil
+		},
+	}
+}
+
+// WithRNG sets the source of randomness for the one-time pad
+func WithRNG(rng pad.RNG) Option {
+	return Option{
+		name: "WithRNG",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.RNG = rng
+			return nil
+		},
+	}
+}
+
+// WithCovers shows the photos in dir as the visible images of PNG chunks, or generated
+// images if dir is empty
+func WithCovers(dir string) Option {
+	return Option{
+		name: "WithCovers",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.CoverDir, cfg.GeneratedCovers = dir, dir == ""
+			return nil
+		},
+	}
+}
+
+// WithPNGEmbedding sets how chunk data is hidden in PNG chunks
+func WithPNGEmbedding(embedding PNGEmbedding) Option {
+	return Option{
+		name: "WithPNGEmbedding",
+		encode: func(cfg *EncodeConfig) error {
+			if _, err := file.ParsePNGEmbedding(string(embedding)); err != nil {
+				return &ConfigError{Option: "WithPNGEmbedding", Err: err}
+			}
+			cfg.PNGEmbedding = embedding
+			return nil
+		},
+	}
+}
+
+// WithCatalog writes a catalog describing every collection to path, signed with key if it
+// isn't empty
+func WithCatalog(path string, key []byte) Option {
+	return Option{
+		name: "WithCatalog",
+		encode: func(cfg *EncodeConfig) error {
+			if path == "" {
+				return configErrorf("WithCatalog", "empty catalog path")
+			}
+			cfg.CatalogPath, cfg.CatalogKey = path, key
+			return nil
+		},
+	}
+}
+
+// WithSnapshots records the encode in the snapshot log at path, under label if it isn't empty
+func WithSnapshots(path string, label string) Option {
+	return Option{
+		name: "WithSnapshots",
+		encode: func(cfg *EncodeConfig) error {
+			if path == "" {
+				return configErrorf("WithSnapshots", "empty snapshot log path")
+			}
+			cfg.SnapshotsPath, cfg.SnapshotLabel = path, label
+			return nil
+		},
+	}
+}
+
+// WithLabels records a label for each collection in its metadata and in the catalog
+func WithLabels(labels ...string) Option {
+	return Option{
+		name: "WithLabels",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.Labels = append([]string(nil), labels...)
+			return nil
+		},
+	}
+}
+
+// WithNotes records notes about each collection, such as who holds it and where, in its
+// metadata and in the catalog
+func WithNotes(notes ...string) Option {
+	return Option{
+		name: "WithNotes",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.Notes = append([]string(nil), notes...)
+			return nil
+		},
+	}
+}
+
+// WithCustodians records a custodian for each collection in its metadata
+func WithCustodians(custodians ...Custodian) Option {
+	return Option{
+		name: "WithCustodians",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.Custodians = append([]Custodian(nil), custodians...)
+			return nil
+		},
+	}
+}
+
+// WithStealthNames stores collections under random names that don't reveal K and N
+func WithStealthNames() Option {
+	return Option{
+		name: "WithStealthNames",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.StealthNames = true
+			return nil
+		},
+	}
+}
+
+// WithRecoveryNotes stores a RECOVERY.txt in each collection, telling whoever holds it what
+// it is, how many other collections are needed, and the command that restores the data
+func WithRecoveryNotes() Option {
+	return Option{
+		name: "WithRecoveryNotes",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.RecoveryNotes = true
+			return nil
+		},
+	}
+}
+
+// WithChunkSink writes an encode's chunks to sink instead of to output directories
+func WithChunkSink(sink ChunkSink) Option {
+	return Option{
+		name: "WithChunkSink",
+		encode: func(cfg *EncodeConfig) error {
+			if sink == nil {
+				return configErrorf("WithChunkSink", "nil chunk sink")
+			}
+			cfg.ChunkSink = sink
+			return nil
+		},
+	}
+}
+
+// WithChunkSource reads a decode's chunks from source instead of from input directories
+func WithChunkSource(source ChunkSource) Option {
+	return Option{
+		name: "WithChunkSource",
+		decode: func(cfg *DecodeConfig) error {
+			if source == nil {
+				return configErrorf("WithChunkSource", "nil chunk source")
+			}
+			cfg.ChunkSource = source
+			return nil
+		},
+	}
+}
+
+// WithMetadataKey sets the passphrase collection metadata is encrypted with
+func WithMetadataKey(key []byte) Option {
+	return Option{
+		name: "WithMetadataKey",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.MetadataKey = key
+			return nil
+		},
+		decode: func(cfg *DecodeConfig) error {
+			cfg.MetadataKey = key
+			return nil
+		},
+	}
+}
+
+// WithPipeline sets the pipe buffer size, memory bound, and decode prefetching
+func WithPipeline(pipeline PipelineConfig) Option {
+	return Option{
+		name: "WithPipeline",
+		encode: func(cfg *EncodeConfig) error {
+			if pipeline.PrefetchChunks != 0 || pipeline.PrefetchDir != "" {
+				return configErrorf("WithPipeline", "prefetching only applies to decode")
+			}
+			if pipeline.WriteThreads < 0 {
+				return configErrorf("WithPipeline", "write threads must not be negative, got %d", pipeline.WriteThreads)
+			}
+			cfg.Pipeline = pipeline
+			return nil
+		},
+		decode: func(cfg *DecodeConfig) error {
+			if pipeline.PrefetchChunks < 0 {
+				return configErrorf("WithPipeline", "prefetch must not be negative, got %d", pipeline.PrefetchChunks)
+			}
+			if pipeline.WriteThreads != 0 {
+				return configErrorf("WithPipeline", "write threads only apply to encode")
+			}
+			cfg.Pipeline = pipeline
+			return nil
+		},
+	}
+}
+
+// WithRetry sets the retry policy for transient chunk write or read failures
+func WithRetry(retry RetryPolicy) Option {
+	return Option{
+		name: "WithRetry",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.Retry = retry
+			return nil
+		},
+		decode: func(cfg *DecodeConfig) error {
+			cfg.Retry = retry
+			return nil
+		},
+	}
+}
+
+// WithClear clears the output directory if it isn't empty
+func WithClear() Option {
+	return Option{
+		name: "WithClear",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.ClearIfNotEmpty = true
+			return nil
+		},
+		decode: func(cfg *DecodeConfig) error {
+			cfg.ClearIfNotEmpty = true
+			return nil
+		},
+	}
+}
+
+// WithDryRun calculates sizes without writing any output
+func WithDryRun() Option {
+	return Option{
+		name: "WithDryRun",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.SizeOnly = true
+			return nil
+		},
+		decode: func(cfg *DecodeConfig) error {
+			cfg.SizeOnly = true
+			return nil
+		},
+	}
+}
+
+// WithResume continues an interrupted encode, or skips the files an interrupted decode
+// already restored
+func WithResume() Option {
+	return Option{
+		name: "WithResume",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.Resume = true
+			return nil
+		},
+		decode: func(cfg *DecodeConfig) error {
+			cfg.Resume = true
+			return nil
+		},
+	}
+}
+
+// WithWeights gives each output directory of WithOutputs as many collections as its weight,
+// rather than one each; the scheme given with WithScheme then counts output directories, any
+// k of which restore the data. The data is split with Shamir sharing unless WithSharing gives
+// another scheme, and weights are refused with pad.OTP.
+func WithWeights(weights ...int) Option {
+	return Option{
+		name: "WithWeights",
+		encode: func(cfg *EncodeConfig) error {
+			for _, weight := range weights {
+				if weight < 1 {
+					return configErrorf("WithWeights", "weight %d is less than 1", weight)
+				}
+			}
+			cfg.Weights = append([]int(nil), weights...)
+			return nil
+		},
+	}
+}
+
+// WithDedup stores each distinct block of the serialized input once, before it is compressed
+// and split, so that repeated data takes up the space of one copy
+func WithDedup() Option {
+	return Option{
+		name: "WithDedup",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.Dedup = true
+			return nil
+		},
+	}
+}
+
+// WithAppend adds the input to the collections already in the output directories, as further
+// chunks of each, rather than writing new collections. The scheme, format, and chunk size are
+// those of the existing collections.
+func WithAppend() Option {
+	return Option{
+		name: "WithAppend",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.Append = true
+			return nil
+		},
+	}
+}
+
+// WithKeepPartial keeps the partial output of a failed operation rather than rolling it back
+func WithKeepPartial() Option {
+	return Option{
+		name: "WithKeepPartial",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.KeepPartial = true
+			return nil
+		},
+		decode: func(cfg *DecodeConfig) error {
+			cfg.KeepPartial = true
+			return nil
+		},
+	}
+}
+
+// WithoutSpaceCheck starts the operation even if its output is estimated not to fit in the
+// free space of its output directories
+func WithoutSpaceCheck() Option {
+	return Option{
+		name: "WithoutSpaceCheck",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.SkipSpaceCheck = true
+			return nil
+		},
+		decode: func(cfg *DecodeConfig) error {
+			cfg.SkipSpaceCheck = true
+			return nil
+		},
+	}
+}
+
+// WithResult fills in result with a summary of the operation
+func WithResult(result *Result) Option {
+	return Option{
+		name: "WithResult",
+		encode: func(cfg *EncodeConfig) error {
+			cfg.Result = result
+			return nil
+		},
+		decode: func(cfg *DecodeConfig) error {
+			cfg.Result = result
+			return nil
+		},
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNewEncodeConfig(t *testing.T) {
+	// Defaults match the command line
+	cfg, err := NewEncodeConfig(WithInput("in"), WithOutputs("out"))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if cfg.N != 2 || cfg.K != 2 || cfg.Format != FormatPNG || cfg.ChunkSize != DefaultChunkSize ||
+		cfg.Compression != CompressionAuto || !cfg.ArchiveCollections || cfg.ArchiveFormat != ArchiveTar {
+		t.Errorf("Unexpected defaults: %+v", cfg)
+	}
+	if cfg.OutputDir != "out" || len(cfg.OutputDirs) != 1 {
+		t.Errorf("Unexpected outputs %q %v", cfg.OutputDir, cfg.OutputDirs)
+	}
+
+	// Several output directories imply N-of-N
+	cfg, err = NewEncodeConfig(WithInput("in"), WithOutputs("a", "b", "c"), WithFormat(FormatBin), WithArchive(""))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if cfg.N != 3 || cfg.K != 3 || cfg.OutputDir != "a" || cfg.ArchiveCollections {
+		t.Errorf("Unexpected config for three outputs: %+v", cfg)
+	}
+
+	// A dry run fills in a placeholder output
+	cfg, err = NewEncodeConfig(WithInput("in"), WithScheme(3, 5), WithDryRun())
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if !cfg.SizeOnly || cfg.OutputDir == "" || cfg.N != 5 || cfg.K != 3 {
+		t.Errorf("Unexpected dry run config: %+v", cfg)
+	}
+
+	invalid := []struct {
+		name   string
+		option string
+		opts   []Option
+	}{
+		{"no input", "WithInput", []Option{WithOutputs("out")}},
+		{"empty inputs", "WithInput", []Option{WithInput(), WithOutputs("out")}},
+		{"no output", "WithOutputs", []Option{WithInput("in")}},
+		{"bad scheme", "WithScheme", []Option{WithInput("in"), WithOutputs("out"), WithScheme(4, 3)}},
+		{"outputs mismatch scheme", "WithOutputs", []Option{WithInput("in"), WithOutputs("a", "b"), WithScheme(2, 3)}},
+		{"bad format", "WithFormat", []Option{WithFormat("gif")}},
+		{"zero chunk size", "WithChunkSize", []Option{WithChunkSize(0)}},
+		{"covers without png", "WithCovers", []Option{WithInput("in"), WithOutputs("out"), WithFormat(FormatBin), WithCovers("")}},
+		{"volumes without archives", "WithVolumeSize", []Option{WithInput("in"), WithOutputs("out"), WithArchive(""), WithVolumeSize(1 << 30)}},
+		{"sink and outputs", "WithChunkSink", []Option{WithInput("in"), WithOutputs("out"), WithChunkSink(newMemoryStore())}},
+		{"raw input and sink", "WithRawInput", []Option{WithRawInput(strings.NewReader("x"), ""), WithChunkSink(newMemoryStore())}},
+		{"no raw input", "WithRawInput", []Option{WithRawInput(nil, "")}},
+		{"chunk index of a stream", "WithChunkIndex", []Option{WithRawInput(strings.NewReader("x"), ""), WithOutputs("out"), WithChunkIndex()}},
+		{"wrong notes count", "WithNotes", []Option{WithInput("in"), WithOutputs("out"), WithNotes("a")}},
+		{"wrong label count", "WithLabels", []Option{WithInput("in"), WithOutputs("out"), WithCatalog("c.json", nil), WithLabels("a")}},
+		{"snapshots of a sink", "WithSnapshots", []Option{WithInput("in"), WithChunkSink(newMemoryStore()), WithSnapshots("s.json", "")}},
+		{"weights without outputs", "WithWeights", []Option{WithInput("in"), WithOutputs("out"), WithWeights(1)}},
+		{"weights as files", "WithWeights", []Option{WithInput("in"), WithOutputs("a", "b"), WithWeights(1, 2), WithArchive("")}},
+		{"formats count", "WithFormats", []Option{WithInput("in"), WithOutputs("a", "b"), WithFormats(FormatPNG)}},
+		{"formats of a sink", "WithFormats", []Option{WithInput("in"), WithChunkSink(newMemoryStore()), WithFormats(FormatPNG, FormatBin)}},
+		{"recovery notes of stealth names", "WithRecoveryNotes", []Option{WithInput("in"), WithOutputs("out"), WithStealthNames(), WithRecoveryNotes()}},
+		{"dedup of a stream", "WithDedup", []Option{WithRawInput(strings.NewReader("x"), ""), WithOutputs("out"), WithDedup()}},
+		{"dedup with chunk index", "WithDedup", []Option{WithInput("in"), WithOutputs("out"), WithChunkIndex(), WithDedup()}},
+		{"resume and clear", "WithResume", []Option{WithInput("in"), WithOutputs("out"), WithResume(), WithClear()}},
+		{"decode option", "WithOutput", []Option{WithOutput("out")}},
+		{"compression level", "WithCompression", []Option{WithCompression(CompressionNone, 5)}},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewEncodeConfig(tc.opts...)
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("Expected a ConfigError, got %v", err)
+			}
+			if configErr.Option != tc.option {
+				t.Errorf("Expected the error to name %s, got %v", tc.option, err)
+			}
+		})
+	}
+}
+
+func TestNewDecodeConfig(t *testing.T) {
+	cfg, err := NewDecodeConfig(WithInputs("a", "b"), WithOutput("out"), WithPipeline(PipelineConfig{PrefetchChunks: 2}))
+	if err != nil {
+		t.Fatalf("NewDecodeConfig failed: %v", err)
+	}
+	if cfg.InputDir != "a" || len(cfg.InputDirs) != 2 || cfg.OutputDir != "out" ||
+		cfg.Compression != CompressionGzip || cfg.Pipeline.PrefetchChunks != 2 {
+		t.Errorf("Unexpected decode config: %+v", cfg)
+	}
+
+	invalid := []struct {
+		name   string
+		option string
+		opts   []Option
+	}{
+		{"no inputs", "WithInputs", []Option{WithOutput("out")}},
+		{"no output", "WithOutput", []Option{WithInputs("a")}},
+		{"source and inputs", "WithChunkSource", []Option{WithInputs("a"), WithChunkSource(newMemoryStore()), WithOutput("out")}},
+		{"prefetch dir alone", "WithPipeline", []Option{WithInputs("a"), WithOutput("out"), WithPipeline(PipelineConfig{PrefetchDir: "cache"})}},
+		{"no output stream", "WithOutputStream", []Option{WithInputs("a"), WithOutputStream(nil)}},
+		{"no tar output", "WithTarOutput", []Option{WithInputs("a"), WithTarOutput(nil, false)}},
+		{"filter with tar output", "WithFilter", []Option{WithInputs("a"), WithTarOutput(io.Discard, false), WithFilter(&Filter{})}},
+		{"encode option", "WithScheme", []Option{WithScheme(2, 3)}},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewDecodeConfig(tc.opts...)
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("Expected a ConfigError, got %v", err)
+			}
+			if configErr.Option != tc.option {
+				t.Errorf("Expected the error to name %s, got %v", tc.option, err)
+			}
+		})
+	}
+
+	// A dry run needs no output directory
+	if cfg, err := NewDecodeConfig(WithInputs("a"), WithDryRun()); err != nil || cfg.OutputDir == "" {
+		t.Errorf("Expected a dry run decode config with a placeholder output, got %+v, %v", cfg, err)
+	}
+
+	// An output stream takes the place of the output directory
+	if cfg, err := NewDecodeConfig(WithInputs("a"), WithOutputStream(io.Discard)); err != nil || cfg.OutputDir != "" {
+		t.Errorf("Expected a decode config writing to the output stream, got %+v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+)
+
+// checkOutputOverlap refuses an operation whose output directories are, are inside, or contain
+// any of its inputs: writing into an input, or clearing an output with -clear, would destroy
+// what is being read, and an encode would read back its own output. Paths are compared after
+// resolving symbolic links, so a link to an input counts as the input. URLs are staged in
+// directories of their own, so they are skipped.
+func checkOutputOverlap(operation string, inputs, outputs []string) error {
+	for _, output := range outputs {
+		if output == "" || file.IsDestinationURL(output) {
+			continue
+		}
+		out, err := resolvePath(output)
+		if err != nil {
+			return err
+		}
+		for _, input := range inputs {
+			if input == "" || file.IsDestinationURL(input) {
+				continue
+			}
+			in, err := resolvePath(input)
+			if err != nil {
+				return err
+			}
+			switch {
+			case in == out:
+				return fmt.Errorf("cannot %s into %s, which is also an input: %w", operation, output, ErrOutputOverlapsInput)
+			case isWithin(out, in):
+				return fmt.Errorf("cannot %s into %s, which is inside the input %s: %w", operation, output, input, ErrOutputOverlapsInput)
+			case isWithin(in, out):
+				return fmt.Errorf("cannot %s into %s, which contains the input %s: %w", operation, output, input, ErrOutputOverlapsInput)
+			}
+		}
+	}
+	return nil
+}
+
+// checkInputOverlap refuses input directories encoded together of which one is, or is inside,
+// another, whose entries would otherwise be encoded twice
+func checkInputOverlap(inputs []string) error {
+	resolved := make([]string, len(inputs))
+	for i, input := range inputs {
+		path, err := resolvePath(input)
+		if err != nil {
+			return err
+		}
+		resolved[i] = path
+		for j := range i {
+			switch {
+			case resolved[j] == path:
+				return fmt.Errorf("input %s is given more than once", input)
+			case isWithin(path, resolved[j]):
+				return fmt.Errorf("input %s is inside the input %s", input, inputs[j])
+			case isWithin(resolved[j], path):
+				return fmt.Errorf("input %s contains the input %s", input, inputs[j])
+			}
+		}
+	}
+	return nil
+}
+
+// isWithin reports whether path is inside dir; both must be clean absolute paths
+func isWithin(path, dir string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// resolvePath returns the absolute path of path with symbolic links resolved. The part of a
+// path that doesn't exist yet, such as an output directory about to be created, is kept as is
+// below its nearest existing parent.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, rest), nil
+		} else if !os.IsNotExist(err) || dir == filepath.Dir(dir) {
+			return abs, nil
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestCheckOutputOverlap checks that outputs that are, are inside, or contain an input are
+// refused, also through a symbolic link, and that outputs beside the inputs are not
+func TestCheckOutputOverlap(t *testing.T) {
+	root := t.TempDir()
+	input := filepath.Join(root, "input")
+	if err := os.MkdirAll(filepath.Join(input, "3A5"), 0755); err != nil {
+		t.Fatalf("Failed to create input: %v", err)
+	}
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(input, link); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	tests := []struct {
+		output  string
+		overlap bool
+	}{
+		{input, true},
+		{filepath.Join(input, "3A5"), true},
+		{filepath.Join(input, "restored", "new"), true},
+		{root, true},
+		{link, true},
+		{filepath.Join(link, "restored"), true},
+		{filepath.Join(root, "restored"), false},
+		{filepath.Join(root, "input-restored"), false},
+		{"webdavs://cloud.example.com/share", false},
+	}
+	for _, tt := range tests {
+		err := checkOutputOverlap("decode", []string{input}, []string{tt.output})
+		if got := errors.Is(err, ErrOutputOverlapsInput); got != tt.overlap {
+			t.Errorf("checkOutputOverlap(%s) = %v, want overlap %v", tt.output, err, tt.overlap)
+		}
+	}
+}
+
+// TestCheckInputOverlap checks that inputs encoded together are refused when one is given
+// twice or is inside another, and not when they are side by side
+func TestCheckInputOverlap(t *testing.T) {
+	root := t.TempDir()
+	photos, docs := filepath.Join(root, "photos"), filepath.Join(root, "docs")
+	for _, dir := range []string{photos, docs, filepath.Join(photos, "2024")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create input: %v", err)
+		}
+	}
+	if err := checkInputOverlap([]string{photos, docs}); err != nil {
+		t.Errorf("Expected inputs side by side to be accepted, got %v", err)
+	}
+	for _, inputs := range [][]string{{photos, docs, photos}, {photos, filepath.Join(photos, "2024")}, {filepath.Join(photos, "2024"), root}} {
+		if err := checkInputOverlap(inputs); err == nil {
+			t.Errorf("Expected inputs %v to be refused", inputs)
+		}
+	}
+}
+
+// TestDecodeIntoInputRefused checks that decoding with -clear into a directory holding the
+// collections being decoded, and encoding into the input, are refused without touching them
+func TestDecodeIntoInputRefused(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "data.txt"), []byte(strings.Repeat("overlap ", 500)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	encodedDir := filepath.Join(tempDir, "encoded")
+	encode := func(outputDir string) error {
+		return EncodeDirectory(ctx, EncodeConfig{
+			InputDir:        inputDir,
+			OutputDir:       outputDir,
+			N:               3,
+			K:               2,
+			Format:          FormatBin,
+			ChunkSize:       4096,
+			RNG:             pad.NewDefaultRand(ctx),
+			Compression:     CompressionGzip,
+			ClearIfNotEmpty: true,
+		})
+	}
+	if err := encode(encodedDir); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if err := encode(filepath.Join(inputDir, "encoded")); !errors.Is(err, ErrOutputOverlapsInput) {
+		t.Errorf("Expected an encode into its input to be refused, got %v", err)
+	}
+
+	for _, outputDir := range []string{encodedDir, filepath.Join(encodedDir, "2A3")} {
+		err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodedDir, OutputDir: outputDir, Compression: CompressionGzip, ClearIfNotEmpty: true})
+		if !errors.Is(err, ErrOutputOverlapsInput) {
+			t.Errorf("Expected a decode into %s to be refused, got %v", outputDir, err)
+		}
+	}
+	for _, coll := range []string{"2A3", "2B3", "2C3"} {
+		if entries, err := os.ReadDir(filepath.Join(encodedDir, coll)); err != nil || len(entries) == 0 {
+			t.Errorf("Collection %s was damaged by a refused decode (%v)", coll, err)
+		}
+	}
+}
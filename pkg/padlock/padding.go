@@ -0,0 +1,93 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+)
+
+// PaddingMode is how EncodeConfig.PadTo chooses the size the data is padded to
+type PaddingMode string
+
+const (
+	// PadNone leaves the data unpadded, so the collections reveal its compressed size
+	PadNone PaddingMode = ""
+
+	// PadFixed pads the data to exactly Padding.Size, which it must fit in
+	PadFixed PaddingMode = "fixed"
+
+	// PadPowerOfTwo pads the data to the next power of two, so its size is only revealed
+	// to within a factor of two
+	PadPowerOfTwo PaddingMode = "pow2"
+
+	// PadBucket pads the data to the next multiple of Padding.Size
+	PadBucket PaddingMode = "bucket"
+)
+
+// Padding conceals the size of the data by padding the stream with random bytes before it is
+// split. The true length is recorded within the stream, where decode finds it and trims the
+// padding; nothing outside the encoded data records it.
+type Padding struct {
+	Mode PaddingMode
+	Size int64 // The fixed size or bucket size, for PadFixed and PadBucket
+}
+
+// ParsePadding parses a padding given as a size such as "4G" for PadFixed, "pow2" for
+// PadPowerOfTwo, or "bucket:SIZE" for PadBucket
+func ParsePadding(s string) (Padding, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case s == "" || s == "none":
+		return Padding{}, nil
+	case s == string(PadPowerOfTwo):
+		return Padding{Mode: PadPowerOfTwo}, nil
+	case strings.HasPrefix(s, string(PadBucket)+":"):
+		size, err := file.ParseSize(strings.TrimPrefix(s, string(PadBucket)+":"))
+		if err != nil || size <= 0 {
+			return Padding{}, fmt.Errorf("invalid padding %q: expected bucket:SIZE with a positive SIZE", s)
+		}
+		return Padding{Mode: PadBucket, Size: size}, nil
+	}
+	size, err := file.ParseSize(s)
+	if err != nil || size <= 0 {
+		return Padding{}, fmt.Errorf("invalid padding %q: expected a size, pow2, or bucket:SIZE", s)
+	}
+	return Padding{Mode: PadFixed, Size: size}, nil
+}
+
+// String formats the padding as ParsePadding accepts it
+func (p Padding) String() string {
+	switch p.Mode {
+	case PadFixed:
+		return fmt.Sprint(p.Size)
+	case PadBucket:
+		return fmt.Sprintf("%s:%d", PadBucket, p.Size)
+	}
+	return string(p.Mode)
+}
+
+// Target returns the size a padded stream of size bytes, before its padding, is padded to
+func (p Padding) Target(size int64) (int64, error) {
+	switch p.Mode {
+	case PadNone:
+		return size, nil
+	case PadFixed:
+		if size > p.Size {
+			return 0, fmt.Errorf("the data needs %s, more than the padded size of %s; choose a larger one",
+				FormatByteSize(size), FormatByteSize(p.Size))
+		}
+		return p.Size, nil
+	case PadPowerOfTwo:
+		if size <= 1 {
+			return 1, nil
+		}
+		return 1 << bits.Len64(uint64(size-1)), nil
+	case PadBucket:
+		return (size + p.Size - 1) / p.Size * p.Size, nil
+	}
+	return 0, fmt.Errorf("unknown padding mode %q", p.Mode)
+}
@@ -0,0 +1,146 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestParsePadding(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Padding
+		size  int64 // Size to pad
+		padTo int64 // What it is padded to, or 0 if it doesn't fit
+	}{
+		{"", Padding{}, 1000, 1000},
+		{"none", Padding{}, 1000, 1000},
+		{"64K", Padding{Mode: PadFixed, Size: 64 * 1024}, 1000, 64 * 1024},
+		{"1K", Padding{Mode: PadFixed, Size: 1024}, 2000, 0},
+		{"pow2", Padding{Mode: PadPowerOfTwo}, 1000, 1024},
+		{"POW2", Padding{Mode: PadPowerOfTwo}, 1024, 1024},
+		{"bucket:1M", Padding{Mode: PadBucket, Size: 1024 * 1024}, 1500000, 2 * 1024 * 1024},
+	}
+	for _, tt := range tests {
+		got, err := ParsePadding(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("ParsePadding(%q) = %+v, %v; want %+v", tt.value, got, err, tt.want)
+			continue
+		}
+		if reparsed, err := ParsePadding(got.String()); err != nil || reparsed != got {
+			t.Errorf("ParsePadding(%q.String()) = %+v, %v", tt.value, reparsed, err)
+		}
+		padTo, err := got.Target(tt.size)
+		if tt.padTo == 0 {
+			if err == nil {
+				t.Errorf("%q: expected %d bytes not to fit", tt.value, tt.size)
+			}
+		} else if err != nil || padTo != tt.padTo {
+			t.Errorf("%q: padded %d bytes to %d, %v; want %d", tt.value, tt.size, padTo, err, tt.padTo)
+		}
+	}
+
+	for _, value := range []string{"bucket:", "bucket:0", "pow3", "-5"} {
+		if _, err := ParsePadding(value); err == nil {
+			t.Errorf("ParsePadding(%q) should have failed", value)
+		}
+	}
+}
+
+func TestPaddingRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+
+	// Inputs of different sizes padded to the same size give collections of the same size
+	encode := func(name string, size int, padTo Padding) (string, []byte, error) {
+		inputDir := filepath.Join(tempDir, name+"-input")
+		encodeDir := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(inputDir, 0755); err != nil {
+			t.Fatalf("Failed to create input dir: %v", err)
+		}
+		data := make([]byte, size)
+		pad.NewDefaultRand(ctx).Read(ctx, data)
+		if err := os.WriteFile(filepath.Join(inputDir, "data.bin"), data, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		return encodeDir, data, EncodeDirectory(ctx, EncodeConfig{
+			InputDir:    inputDir,
+			OutputDir:   encodeDir,
+			N:           3,
+			K:           2,
+			Format:      FormatBin,
+			ChunkSize:   4096,
+			RNG:         pad.NewDefaultRand(ctx),
+			Compression: CompressionNone,
+			PadTo:       padTo,
+		})
+	}
+	collectionSize := func(encodeDir string) int64 {
+		chunks, _ := filepath.Glob(filepath.Join(encodeDir, "2A3", "2A3_*.bin"))
+		var size int64
+		for _, chunk := range chunks {
+			if info, err := os.Stat(chunk); err == nil {
+				size += info.Size()
+			}
+		}
+		return size
+	}
+	decode := func(name, encodeDir string, data []byte) {
+		decodeDir := filepath.Join(tempDir, name+"-decoded")
+		if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputDir: decodeDir, Compression: CompressionNone}); err != nil {
+			t.Fatalf("%s: failed to decode: %v", name, err)
+		}
+		if decoded, err := os.ReadFile(filepath.Join(decodeDir, "data.bin")); err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("%s: decoded content does not match the original (%v)", name, err)
+		}
+	}
+
+	fixed := Padding{Mode: PadFixed, Size: 256 * 1024}
+	smallDir, smallData, err := encode("small", 10000, fixed)
+	if err != nil {
+		t.Fatalf("Failed to encode the small input: %v", err)
+	}
+	largeDir, largeData, err := encode("large", 150000, fixed)
+	if err != nil {
+		t.Fatalf("Failed to encode the large input: %v", err)
+	}
+	if small, large := collectionSize(smallDir), collectionSize(largeDir); small != large {
+		t.Errorf("Padded collections differ in size: %d and %d", small, large)
+	}
+	decode("small", smallDir, smallData)
+	decode("large", largeDir, largeData)
+
+	pow2Dir, pow2Data, err := encode("pow2", 70000, Padding{Mode: PadPowerOfTwo})
+	if err != nil {
+		t.Fatalf("Failed to encode with pow2 padding: %v", err)
+	}
+	decode("pow2", pow2Dir, pow2Data)
+
+	if _, _, err := encode("too-small", 300000, fixed); err == nil {
+		t.Errorf("Expected an error padding more data than the fixed size")
+	}
+
+	// Re-sharing keeps the padding, and the data still decodes
+	newDir := filepath.Join(tempDir, "reshared")
+	err = ReshareCollections(ctx, ReshareConfig{
+		InputDirs: []string{smallDir},
+		Encode:    EncodeConfig{OutputDir: newDir, N: 3, K: 2, Format: FormatBin, ChunkSize: 4096, RNG: pad.NewDefaultRand(ctx)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to reshare: %v", err)
+	}
+	if reshared := collectionSize(newDir); reshared != collectionSize(smallDir) {
+		t.Errorf("Reshared collections are %d bytes, not the padded %d", reshared, collectionSize(smallDir))
+	}
+	decode("reshared", newDir, smallData)
+}
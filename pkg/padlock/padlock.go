@@ -38,10 +38,11 @@
 package padlock
 
 import (
-	"archive/tar"
 	"bytes"
-	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -74,23 +75,40 @@ type SizeTracker struct {
 	DecodeOutputSize int64
 }
 
-// FormatByteSize formats a byte count with thousands separators for better readability
+// FormatByteSize formats a byte count, including its unit, using the configured size format.
+// By default sizes are shown as exact byte counts with thousands separators; see SetSizeFormat.
 func FormatByteSize(bytes int64) string {
-	// Handle negative values
-	if bytes < 0 {
-		return "-" + FormatByteSize(-bytes)
-	}
+	return file.FormatSize(bytes)
+}
 
-	// Format number with commas
-	str := fmt.Sprintf("%d", bytes)
-	result := ""
-	for i, ch := range str {
-		if i > 0 && (len(str)-i)%3 == 0 {
-			result += ","
-		}
-		result += string(ch)
-	}
-	return result
+// SizeFormat is a type alias for file.SizeFormat, controlling how sizes are reported.
+type SizeFormat = file.SizeFormat
+
+// SetSizeFormat selects the units and precision used for all size reporting
+// (dry-run reports, progress messages, and summaries).
+func SetSizeFormat(f SizeFormat) {
+	file.SetSizeFormat(f)
+}
+
+// Filter is a type alias for file.Filter, selecting the entries of the input directory that
+// are encoded with .gitignore-style exclude and include patterns
+type Filter = file.Filter
+
+// NewFilter returns a filter that leaves the entries matching exclude out of an encode, and if
+// include is not empty, everything that doesn't match include
+func NewFilter(exclude, include []string) (*Filter, error) {
+	return file.NewFilter(exclude, include)
+}
+
+// TempPolicy is a type alias for file.TempPolicy, controlling where temporary files go and
+// how much is held in memory before it is spooled to one.
+type TempPolicy = file.TempPolicy
+
+// SetTempPolicy selects the directory for temporary files and directories (extracted TARs,
+// grouped chunk files, staged remote collections, and spooled frames), and the size above
+// which data held for later, such as an archive entry, is spooled to disk rather than memory.
+func SetTempPolicy(p TempPolicy) {
+	file.SetTempPolicy(p)
 }
 
 // SizeTrackingWriter is an io.Writer implementation that counts bytes without writing them.
@@ -197,7 +215,7 @@ type SizeTrackingReadCloser interface {
 
 // compressForDryRun performs a complete in-memory compression of the input data
 // to accurately measure the size of compressed data during a dry run.
-func compressForDryRun(ctx context.Context, inputStream io.Reader, sizeTracker *SizeTracker) (io.Reader, error) {
+func compressForDryRun(ctx context.Context, inputStream io.Reader, compression Compression, level int, sizeTracker *SizeTracker) (io.Reader, error) {
 	log := trace.FromContext(ctx).WithPrefix("padlock")
 
 	// Read all the uncompressed data
@@ -215,16 +233,28 @@ func compressForDryRun(ctx context.Context, inputStream io.Reader, sizeTracker *
 	var compressedBuf bytes.Buffer
 
 	// Compress the data
-	gzw := gzip.NewWriter(&compressedBuf)
-	_, err = gzw.Write(uncompressedData)
+	c, err := file.LookupCompressor(compression.String())
+	if err == nil {
+		err = c.CheckLevel(level)
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	cw, err := c.NewWriter(&compressedBuf, level)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to create %s writer: %w", c.Name, err))
+		return nil, err
+	}
+	_, err = cw.Write(uncompressedData)
 	if err != nil {
 		log.Error(fmt.Errorf("failed to compress data: %w", err))
 		return nil, err
 	}
 
-	// Close the gzip writer to flush any remaining data
-	if err := gzw.Close(); err != nil {
-		log.Error(fmt.Errorf("failed to close gzip writer: %w", err))
+	// Close the compressing writer to flush any remaining data
+	if err := cw.Close(); err != nil {
+		log.Error(fmt.Errorf("failed to close %s writer: %w", c.Name, err))
 		return nil, err
 	}
 
@@ -240,6 +270,84 @@ func compressForDryRun(ctx context.Context, inputStream io.Reader, sizeTracker *
 // A Format determines how data chunks are written to and read from the filesystem.
 type Format = file.Format
 
+// Custodian is a type alias for file.Custodian, the designated holder of a collection.
+type Custodian = file.Custodian
+
+// RetryPolicy is a type alias for file.RetryPolicy, controlling retries of transient IO failures.
+type RetryPolicy = file.RetryPolicy
+
+// ArchiveFormat is a type alias for file.ArchiveFormat, the kind of archive collections are packed into.
+type ArchiveFormat = file.ArchiveFormat
+
+const (
+	// ArchiveTar packs each collection into a TAR file
+	ArchiveTar = file.ArchiveTar
+
+	// ArchiveZip packs each collection into a store-only ZIP file
+	ArchiveZip = file.ArchiveZip
+)
+
+// Errors returned, wrapped with the details, by encode, decode, and the commands built on
+// them. Test for them with errors.Is rather than matching error text.
+var (
+	// ErrInvalidScheme is returned for K and N values that don't form a K-of-N scheme
+	ErrInvalidScheme = pad.ErrInvalidScheme
+
+	// ErrInsufficientCollections is returned when fewer collections are available than the
+	// operation needs, including when none are found at all
+	ErrInsufficientCollections = pad.ErrInsufficientCollections
+
+	// ErrCorruptChunk is returned when a chunk is truncated, out of sequence, or unreadable
+	ErrCorruptChunk = pad.ErrCorruptChunk
+
+	// ErrMixedSessions is returned when collections from different encodes are used together
+	ErrMixedSessions = pad.ErrMixedSessions
+
+	// ErrChecksumMismatch is returned when a chunk or catalog doesn't match its checksum
+	ErrChecksumMismatch = file.ErrChecksumMismatch
+
+	// ErrLocked is returned when a directory is in use by another padlock operation
+	ErrLocked = file.ErrLocked
+
+	// ErrMetadataSealed is returned when collection metadata is encrypted and no key was given
+	ErrMetadataSealed = file.ErrMetadataSealed
+
+	// ErrUnresolvedAlias is returned when the chunks of a collection stored under a stealth
+	// name can't be matched to its name, because its metadata is missing or sealed
+	ErrUnresolvedAlias = pad.ErrUnresolvedAlias
+
+	// ErrOutputOverlapsInput is returned when an output directory is, is inside, or contains
+	// an input, which writing or clearing the output would destroy
+	ErrOutputOverlapsInput = errors.New("output overlaps input")
+
+	// ErrInsufficientSpace is returned when an output directory doesn't have the free space
+	// the operation is estimated to need
+	ErrInsufficientSpace = errors.New("insufficient free space")
+)
+
+// FormatText stores data chunks as ASCII-armored text that can be pasted into email or printed.
+// It and FormatWAV are declared apart from FormatBin and FormatPNG, whose block also numbers
+// Compression.
+const FormatText = file.FormatText
+
+// FormatWAV stores data chunks inside WAV audio files, so collections look like recordings.
+const FormatWAV = file.FormatWAV
+
+// PNGEmbedding is how chunk data is hidden in PNG chunk files
+type PNGEmbedding = file.PNGEmbedding
+
+const (
+	// PNGEmbedChunk stores chunk data in a custom PNG chunk after the image, the default
+	PNGEmbedChunk = file.PNGEmbedChunk
+
+	// PNGEmbedLSB hides chunk data in the low-order bits of the image's pixels
+	PNGEmbedLSB = file.PNGEmbedLSB
+)
+
+// minVolumeOverhead is the room a volume needs beyond one chunk, for PNG wrapping, archive
+// headers, and the collection metadata
+const minVolumeOverhead = 64 * 1024
+
 // Compression represents the compression mode used when serializing directories.
 // This allows for space-efficient storage while maintaining the security properties
 // of the threshold scheme.
@@ -262,37 +370,145 @@ const (
 	// CompressionGzip indicates gzip compression will be applied to reduce storage requirements.
 	// This is the default compression mode, providing good compression ratios with reasonable speed.
 	CompressionGzip
+
+	// CompressionZstd indicates zstd compression, which is much faster than gzip on large inputs
+	CompressionZstd
+
+	// CompressionAuto indicates gzip compression unless a sample from the start of the input
+	// shows that it doesn't compress, as with already compressed media. The choice is made
+	// when encoding starts and recorded in collection metadata.
+	CompressionAuto
 )
 
 // EncodeConfig holds configuration parameters for the encoding operation.
 // This structure is created by the command-line interface and passed to EncodeDirectory.
 type EncodeConfig struct {
-	InputDir           string      // Path to the directory containing data to encode
-	OutputDir          string      // Path where the encoded collections will be created (for backward compatibility)
-	OutputDirs         []string    // List of output directories, one for each collection when multiple dirs are specified
-	N                  int         // Total number of collections to create (N value)
-	K                  int         // Minimum collections required for reconstruction (K value)
-	Format             Format      // Output format (binary or PNG)
-	ChunkSize          int         // Maximum size for data chunks in bytes
-	RNG                pad.RNG     // Random number generator for one-time pad creation
-	ClearIfNotEmpty    bool        // Whether to clear the output directory if not empty
-	Verbose            bool        // Enable verbose logging
-	Compression        Compression // Compression mode for the serialized data
-	ArchiveCollections bool        // Whether to create TAR archives for collections
-	SizeOnly           bool        // Whether to only calculate sizes without writing output files (dryrun mode)
+	InputDir           string         // Path to the directory containing data to encode, or a single file (the first of InputDirs, if set)
+	InputDirs          []string       // Directories encoded together, each under a top-level directory named after it
+	OutputDir          string         // Path where the encoded collections will be created (for backward compatibility)
+	OutputDirs         []string       // List of output directories, one for each collection when multiple dirs are specified
+	Weights            []int          // Collections each of OutputDirs receives, in place of one each; N and K then count OutputDirs, and Sharing defaults to pad.Shamir
+	N                  int            // Total number of collections to create (N value)
+	K                  int            // Minimum collections required for reconstruction (K value)
+	Sharing            pad.Sharing    // Secret sharing scheme the data is split with; pad.OTP if nil
+	Format             Format         // Output format (binary or PNG)
+	Formats            []Format       // Format of each collection, in place of Format; of each of OutputDirs with Weights
+	ChunkSize          int            // Maximum size for data chunks in bytes, or ChunkSizeAuto
+	ChunkCount         ChunkRange     // Chunks per collection aimed for by ChunkSizeAuto; DefaultChunkCount if zero
+	RNG                pad.RNG        // Random number generator for one-time pad creation
+	ClearIfNotEmpty    bool           // Whether to clear the output directory if not empty
+	Verbose            bool           // Enable verbose logging
+	Compression        Compression    // Compression mode for the serialized data
+	CompressionLevel   int            // Compression level, or 0 for the algorithm's default; recorded in collection metadata
+	ArchiveCollections bool           // Whether to create TAR archives for collections
+	ArchiveFormat      ArchiveFormat  // Archive format used when ArchiveCollections is set; tar if empty
+	VolumeSize         int64          // If positive, split each collection archive into volumes of at most this many bytes
+	SizeOnly           bool           // Whether to only calculate sizes without writing output files (dryrun mode)
+	ChecksumSidecars   bool           // Whether to write a .sha256 sidecar file per chunk (files mode only)
+	ParityPercent      int            // If positive, write a Reed-Solomon .parity sidecar per chunk with this percentage overhead (files mode only)
+	Par2Percent        int            // If positive, write PAR2 recovery files with this percentage redundancy for each collection
+	Retry              RetryPolicy    // Retry policy for transient chunk write failures (files mode only)
+	CatalogPath        string         // If set, write a catalog describing every collection to this path
+	CatalogKey         []byte         // Optional HMAC key used to sign the catalog
+	SnapshotsPath      string         // If set, record the encode in the snapshot log at this path
+	SnapshotLabel      string         // Optional label of the encode in the snapshot log
+	Labels             []string       // Optional label for each collection, recorded in its metadata and in the catalog
+	Notes              []string       // Optional notes about each collection, recorded in its metadata and in the catalog
+	Custodians         []Custodian    // Optional custodian for each collection, recorded in collection metadata
+	ReviewBy           time.Time      // Optional date by which the collections should be reviewed or re-encoded
+	StealthNames       bool           // Store collections under random names that don't reveal K and N
+	RecoveryNotes      bool           // Store notes in each collection telling its holder what it is and how to restore the data
+	CoverDir           string         // If set, PNG chunks use the photos in this directory as their visible images
+	GeneratedCovers    bool           // If set without CoverDir, PNG chunks show synthesized images
+	PNGEmbedding       PNGEmbedding   // How chunk data is hidden in PNG chunks; empty means PNGEmbedChunk
+	MetadataKey        []byte         // Optional passphrase used to encrypt collection metadata
+	MACKey             []byte         // Optional passphrase from which the keys that authenticate every chunk with a MAC are derived
+	Passphrase         []byte         // Optional passphrase whose keystream masks the data before it is split, so decoding needs it too
+	EnvelopeKey        []byte         // Optional key from which the key that encrypts the data with AES-256-GCM before it is split is derived
+	PadTo              Padding        // Optional padding of the data before it is split, so the collections don't reveal its size
+	HiddenDir          string         // Optional directory to encode as a hidden volume in the padding, which decodes only with HiddenKey
+	HiddenKey          []byte         // Secret from which the key of the hidden volume is derived
+	ChunkSink          ChunkSink      // If set, chunks are written to this sink instead of to output directories
+	Pipeline           PipelineConfig // Pipe buffer size and memory bound
+	InputStream        io.Reader      // If set, this already serialized stream is encoded instead of InputDir
+	RawInput           io.Reader      // If set, these bytes, such as stdin, are encoded as they are instead of InputDir, and decode back to them
+	RawInputName       string         // Name of the file RawInput is restored to when decoded to a directory; DefaultStreamName if empty
+	Filter             *Filter        // If set, only the entries of the input directories it selects are encoded
+	ChunkIndex         bool           // Compress the input in blocks and end it with an index of the chunks holding each file, for decoding some files alone
+	Dedup              bool           // Store each distinct block of the serialized input once, before it is compressed; with InputStream, the stream already is
+	Result             *Result        // If set, filled in with a summary of the encode
+	Resume             bool           // Continue an interrupted encode from the progress recorded in its collections
+	Append             bool           // Add the input to the collections already in the output directories, as further chunks
+	KeepPartial        bool           // Keep the partial output of a failed encode rather than rolling it back
+	SkipSpaceCheck     bool           // Don't check that the output directories have room for the collections
+
+	autoCompressed bool           // Set by the encode when Compression was chosen from CompressionAuto
+	autoChunkSize  bool           // Set by the encode when ChunkSize was chosen for ChunkSizeAuto
+	envelope       *file.Envelope // Envelope the data is encrypted in, recorded in collection metadata
+	session        string         // Identifier of the encode, recorded in collection metadata
+	weighted       bool           // Weights have been applied, so N and K count collections
+}
+
+// sharing returns the secret sharing scheme the encode splits the data with
+func (cfg EncodeConfig) sharing() pad.Sharing {
+	if cfg.Sharing == nil {
+		return pad.OTP
+	}
+	return cfg.Sharing
+}
+
+// inputDirs returns the directories the encode serializes: InputDirs, or InputDir alone
+func (cfg EncodeConfig) inputDirs() []string {
+	if len(cfg.InputDirs) > 0 {
+		return cfg.InputDirs
+	}
+	return []string{cfg.InputDir}
+}
+
+// validateInputDirs checks that each of dirs is a directory or regular file that can be read,
+// and that none of them is inside another
+func validateInputDirs(ctx context.Context, dirs []string) error {
+	if err := checkInputOverlap(dirs); err != nil {
+		trace.FromContext(ctx).WithPrefix("padlock").Error(err)
+		return err
+	}
+	for _, dir := range dirs {
+		if err := file.ValidateInput(ctx, dir); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // DecodeConfig holds configuration parameters for the decoding operation.
 // This structure is created by the command-line interface and passed to DecodeDirectory.
 type DecodeConfig struct {
-	InputDir        string      // Path to the directory containing collections to decode (for backward compatibility)
-	InputDirs       []string    // List of input directories, each containing a collection to decode
-	OutputDir       string      // Path where the decoded data will be written
-	RNG             pad.RNG     // Random number generator (unused for decoding, but maintained for consistency)
-	Verbose         bool        // Enable verbose logging
-	Compression     Compression // Compression mode used when the data was encoded
-	ClearIfNotEmpty bool        // Whether to clear the output directory if not empty
-	SizeOnly        bool        // Whether to only calculate sizes without writing output files (dryrun mode)
+	InputDir        string         // Path to the directory containing collections to decode (for backward compatibility)
+	InputDirs       []string       // List of input directories, each containing a collection to decode
+	OutputDir       string         // Path where the decoded data will be written
+	RNG             pad.RNG        // Random number generator (unused for decoding, but maintained for consistency)
+	Verbose         bool           // Enable verbose logging
+	Compression     Compression    // Compression mode used when the data was encoded
+	ClearIfNotEmpty bool           // Whether to clear the output directory if not empty
+	SizeOnly        bool           // Whether to only calculate sizes without writing output files (dryrun mode)
+	Retry           RetryPolicy    // Retry policy for transient chunk read failures (directory collections only)
+	MetadataKey     []byte         // Passphrase for encrypted collection metadata, used for review-date checks and to name stealth collections
+	MACKey          []byte         // If set, every chunk must pass authentication with the MACs derived from this passphrase
+	Passphrase      []byte         // Passphrase the data was masked with at encode, if any
+	EnvelopeKey     []byte         // Key the data was encrypted with at encode, if the collections record an envelope
+	HiddenKey       []byte         // If set, the hidden volume this secret opens is decoded instead of the data
+	ChunkSource     ChunkSource    // If set, chunks are read from this source instead of from input directories
+	Pipeline        PipelineConfig // Pipe buffer size and memory bound
+	Result          *Result        // If set, filled in with a summary of the decode
+	Resume          bool           // Skip the files an interrupted decode to OutputDir already restored
+	KeepPartial     bool           // Keep the files restored by a failed decode rather than rolling them back
+	Salvage         bool           // If part of the data can't be decoded, keep and report the files restored before it
+	SearchDepth     int            // Levels of subdirectories of the input directories to search for collections
+	SkipSpaceCheck  bool           // Don't check that the output directory has room for the decoded data
+	OutputStream    io.Writer      // If set, a raw stream the collections encode is written here instead of to OutputDir
+	OutputTar       bool           // With OutputStream, write the TAR the collections encode to it instead of extracting it
+	KeepCompressed  bool           // With OutputTar, leave the TAR compressed as it was encoded
+	Filter          *Filter        // If set, only the entries it selects are restored, decoding just the chunks holding them if the collections have a chunk index
 }
 
 // EncodeDirectory encodes a directory using the padlock K-of-N threshold scheme.
@@ -317,30 +533,207 @@ type DecodeConfig struct {
 // The encoding process ensures that the resulting collections have the following property:
 // Any K or more collections can be used to reconstruct the original data, while
 // K-1 or fewer collections reveal absolutely nothing about the original data.
-func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
+func EncodeDirectory(ctx context.Context, cfg EncodeConfig) (retErr error) {
 	log := trace.FromContext(ctx).WithPrefix("padlock")
 	start := time.Now()
 
+	// Weighted output directories each receive several collections
+	if err := applyWeights(ctx, &cfg); err != nil {
+		return err
+	}
+	if err := checkFormats(cfg); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// Summarize the encode for the caller, if asked to
+	var counter *resultCounter
+	if cfg.Result != nil {
+		*cfg.Result = Result{
+			Operation:        "encode",
+			DryRun:           cfg.SizeOnly,
+			Copies:           cfg.N,
+			Required:         cfg.K,
+			Sharing:          cfg.sharing().Name(),
+			Format:           Format(cfg.formatDescription()),
+			Compression:      cfg.Compression.effective().String(),
+			CompressionLevel: cfg.compressionLevel(),
+			Started:          start,
+		}
+		counter = newResultCounter()
+		defer func() { cfg.Result.finish(start, retErr) }()
+	}
+	if counter == nil && cfg.SnapshotsPath != "" {
+		// The snapshot log records the size of the input, as the result does
+		counter = newResultCounter()
+	}
+
+	// Choose the chunk size from the size of the input, if asked to
+	if err := resolveAutoChunkSize(ctx, &cfg); err != nil {
+		return err
+	}
+
+	// Volumes hold whole chunks, so each must have room for at least one
+	if cfg.VolumeSize > 0 {
+		var err error
+		if !cfg.ArchiveCollections || cfg.ChunkSink != nil {
+			err = fmt.Errorf("a volume size can only be used when collections are written as archives")
+		} else if cfg.VolumeSize < int64(cfg.ChunkSize)+minVolumeOverhead {
+			err = fmt.Errorf("volume size %s is too small for chunks of %s; use a smaller chunk size",
+				FormatByteSize(cfg.VolumeSize), FormatByteSize(int64(cfg.ChunkSize)))
+		}
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	// A hidden volume needs a secret and padding to hide in
+	if err := checkHidden(ctx, cfg); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// A chunk index needs a payload that can be decoded in parts
+	if err := checkChunkIndex(cfg); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// Deduplication needs a TAR of input directories, decoded from start to end
+	if err := checkDedup(cfg); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// Recovery notes need collections to hold them, and mustn't reveal a hidden scheme
+	if err := checkRecoveryNotes(cfg); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// An append adds to existing collections, keeping how they were written
+	if err := checkAppend(cfg); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// Chunks routed to a sink bypass all output directory handling
+	if cfg.ChunkSink != nil {
+		log.Infof("Starting encode: InputDir=%s to chunk sink", cfg.inputDescription())
+		return encodeToSink(ctx, cfg, cfg.ChunkSink)
+	}
+
 	// Log differently depending on whether using single or multiple output directories
 	if len(cfg.OutputDirs) <= 1 {
-		log.Infof("Starting encode: InputDir=%s OutputDir=%s", cfg.InputDir, cfg.OutputDir)
+		log.Infof("Starting encode: InputDir=%s OutputDir=%s", cfg.inputDescription(), cfg.OutputDir)
 	} else {
-		log.Infof("Starting encode: InputDir=%s with %d output directories", cfg.InputDir, len(cfg.OutputDirs))
+		log.Infof("Starting encode: InputDir=%s with %d output directories", cfg.inputDescription(), len(cfg.OutputDirs))
 		for i, dir := range cfg.OutputDirs {
 			log.Debugf("  OutputDir[%d]=%s", i, dir)
 		}
 	}
 	log.Debugf("Encode parameters: copies=%d, required=%d, Format=%s, ChunkSize=%d", cfg.N, cfg.K, cfg.Format, cfg.ChunkSize)
 
-	// Validate input directory to ensure it exists and is accessible
-	if err := file.ValidateInputDirectory(ctx, cfg.InputDir); err != nil {
+	// Validate the input directories to ensure they exist and are accessible
+	if cfg.InputStream == nil {
+		if cfg.RawInput == nil {
+			if err := validateInputDirs(ctx, cfg.inputDirs()); err != nil {
+				return err
+			}
+		}
+
+		// Make sure the compression is available before anything is written
+		if cfg.Compression.effective() != CompressionNone {
+			c, err := file.LookupCompressor(cfg.Compression.String())
+			if err == nil {
+				err = c.CheckLevel(cfg.CompressionLevel)
+			}
+			if err != nil {
+				log.Error(err)
+				return err
+			}
+		}
+	}
+
+	// Keep the pipeline within the memory limit, if one was set
+	chunkSize, err := fitEncodeMemory(ctx, cfg.sharing(), cfg.N, cfg.K, cfg.ChunkSize, cfg.Pipeline)
+	if err != nil {
+		return err
+	}
+	cfg.ChunkSize = chunkSize
+	if cfg.Result != nil {
+		cfg.Result.ChunkSize = cfg.ChunkSize
+	}
+
+	// Resolve the output destinations; remote ones are staged locally and uploaded at the end
+	destinations, err := resolveDestinations(ctx, &cfg)
+	if err != nil {
 		return err
 	}
+	defer cleanupDestinations(ctx, destinations)
+	var target *appendTarget
+	if cfg.Append {
+		if target, err = loadAppendTarget(ctx, &cfg, destinations); err != nil {
+			log.Error(err)
+			return err
+		}
+		if cfg.Result != nil {
+			cfg.Result.Copies, cfg.Result.Required = cfg.N, cfg.K
+			cfg.Result.Sharing = cfg.sharing().Name()
+			cfg.Result.Format = cfg.Format
+			cfg.Result.ChunkSize = cfg.ChunkSize
+			cfg.Result.Session = cfg.session
+		}
+	}
+	if cfg.Resume {
+		if err := checkResumable(cfg, destinations); err != nil {
+			log.Error(err)
+			return err
+		}
+		if len(cfg.MACKey) > 0 {
+			err := fmt.Errorf("chunk MACs can't be added when resuming an encode, since the chunks written before it was interrupted weren't authenticated")
+			log.Error(err)
+			return err
+		}
+		if len(cfg.Passphrase) > 0 || len(cfg.EnvelopeKey) > 0 {
+			err := fmt.Errorf("an encode with a passphrase or envelope key can't be resumed, since the data is encrypted with a new salt every time")
+			log.Error(err)
+			return err
+		}
+		if cfg.PadTo.Mode != PadNone {
+			err := fmt.Errorf("a padded encode can't be resumed, since its padding is random every time")
+			log.Error(err)
+			return err
+		}
+	}
+
+	// Refuse to write into the input, or to clear it, before anything is written
+	if !cfg.SizeOnly && cfg.InputStream == nil {
+		if err := checkOutputOverlap("encode", append(cfg.inputDirs(), cfg.HiddenDir), localOutputDirs(destinations)); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	// Lock the output directories before anything in them is cleared or written
+	if !cfg.SizeOnly {
+		release, err := lockDirs(ctx, localOutputDirs(destinations), "encode")
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
 
 	// In dry run mode, we don't need to prepare output directories
 	if !cfg.SizeOnly {
 		// Prepare all output directories, clearing them if requested and they're not empty
-		if len(cfg.OutputDirs) > 1 {
+		if cfg.Resume {
+			// The output of the interrupted encode is kept, and continued
+			log.Debugf("Resuming - skipping output directory preparation")
+		} else if cfg.Append {
+			log.Debugf("Appending - skipping output directory preparation")
+		} else if len(cfg.OutputDirs) > 1 {
 			// When using multiple output directories - prepare each one individually
 			for _, dir := range cfg.OutputDirs {
 				if err := file.PrepareOutputDirectory(ctx, dir, cfg.ClearIfNotEmpty); err != nil {
@@ -357,15 +750,51 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 		log.Infof("Running in dry run mode - skipping output directory preparation")
 	}
 
+	// Fail now, rather than part way through, if the collections won't fit
+	if err := checkEncodeSpace(ctx, cfg); err != nil {
+		return err
+	}
+
+	// The archives of this encode, which are only complete once they are finalized
+	tarWriters := file.NewTarWriterRegistry()
+
+	// If the encode fails, is interrupted or times out from here on, roll back the partial
+	// output so that it can't be mistaken for valid collections
+	var writtenCatalog string
+	var writtenPar2 []string
+	if !cfg.SizeOnly {
+		defer func() {
+			// Archives that were never finalized can't be read or resumed, so they never are kept
+			if retErr != nil {
+				tarWriters.AbortAll(ctx)
+			}
+			var files []string
+			if writtenCatalog != "" {
+				files = append(files, writtenCatalog)
+			}
+			files = append(files, writtenPar2...)
+			if target != nil {
+				target.rollBack(ctx, cfg, retErr, files)
+				return
+			}
+			rollBack(ctx, retErr, cfg.Resume, cfg.KeepPartial, encodeOutputDirs(cfg), files, cfg.Result)
+		}()
+	}
+
 	// Create a new pad instance with the specified N and K parameters
 	// This is the core cryptographic component that implements the threshold scheme
 	log.Debugf("Creating pad instance with N=%d, K=%d", cfg.N, cfg.K)
-	p, err := pad.NewPadForEncode(ctx, cfg.N, cfg.K)
+	p, err := pad.NewPadForEncodeWith(ctx, cfg.N, cfg.K, cfg.sharing())
 	if err != nil {
 		log.Error(fmt.Errorf("failed to create pad instance: %w", err))
 		return err
 	}
 
+	// Formatting and writing each collection's chunk can overlap; a dry run writes nothing
+	if !cfg.SizeOnly {
+		p.WriteThreads = cfg.Pipeline.WriteThreads
+	}
+
 	// Initialize size tracker if we're in size-only mode
 	var sizeTracker *SizeTracker
 	if cfg.SizeOnly {
@@ -379,26 +808,62 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 		p.SizeTracker = sizeTracker
 	}
 
+	// Choose the names used on disk: the collection names themselves, or random
+	// stealth names that don't reveal the K-of-N parameters
+	diskNames := p.Collections
+	if cfg.StealthNames && !cfg.SizeOnly && !cfg.Resume {
+		diskNames = make([]string, len(p.Collections))
+		for i := range p.Collections {
+			if diskNames[i], err = file.NewStealthName(); err != nil {
+				return err
+			}
+			log.Debugf("Collection %s will be stored as %s", p.Collections[i], diskNames[i])
+		}
+		if len(cfg.MetadataKey) == 0 {
+			log.Infof("Warning: the collection metadata isn't sealed, so it still names each collection and the K-of-N scheme; seal it with a metadata key to hide them")
+		}
+	}
+
 	// Create collections based on the configuration
 	var collections []file.Collection
 
-	// In dry run mode, we don't need to actually create collection directories
-	if cfg.SizeOnly {
+	// A resumed encode continues the collections of the interrupted one, with the compression it used
+	var resumeFrom *encodeProgress
+	if target != nil {
+		if collections, err = target.open(ctx, cfg, p.Collections, tarWriters); err != nil {
+			log.Error(err)
+			return err
+		}
+	} else if cfg.Resume {
+		collections, resumeFrom, err = loadEncodeProgress(ctx, &cfg, p.Collections)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		if cfg.Result != nil {
+			cfg.Result.Compression = cfg.Compression.effective().String()
+			cfg.Result.CompressionLevel = cfg.compressionLevel()
+			cfg.Result.ChunkSize = cfg.ChunkSize
+		}
+	} else if cfg.SizeOnly {
+		// In dry run mode, we don't need to actually create collection directories
 		// Just set up virtual collections for dry run
 		collections = make([]file.Collection, len(p.Collections))
 		for i, collName := range p.Collections {
 			collections[i] = file.Collection{
 				Name:   collName,
 				Path:   "dryrun-" + collName, // Use a placeholder path
-				Format: cfg.Format,
+				Format: cfg.collectionFormat(i),
 			}
 			log.Debugf("Created virtual collection %d for dry run: %s", i+1, collName)
 		}
 	} else if len(cfg.OutputDirs) > 1 {
-		// Use multiple output directories - one collection per directory
-		if len(cfg.OutputDirs) != len(p.Collections) {
+		// Use multiple output directories - one collection per directory, or several in a
+		// weighted one
+		outputDirs := cfg.collectionOutputDirs()
+		if len(outputDirs) != len(p.Collections) {
 			return fmt.Errorf("number of output directories (%d) does not match number of collections (%d)",
-				len(cfg.OutputDirs), len(p.Collections))
+				len(outputDirs), len(p.Collections))
 		}
 
 		// Create collections in individual directories
@@ -408,22 +873,34 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 			// (not a subdirectory like in the traditional approach)
 			collections[i] = file.Collection{
 				Name:   collName,
-				Path:   cfg.OutputDirs[i],
-				Format: cfg.Format,
+				Path:   outputDirs[i],
+				Format: cfg.collectionFormat(i),
 			}
-			log.Debugf("Created collection %d: %s at %s", i+1, collName, cfg.OutputDirs[i])
+			if diskNames[i] != collName {
+				collections[i].StoredName = diskNames[i]
+			}
+			log.Debugf("Created collection %d: %s at %s", i+1, collName, outputDirs[i])
 		}
 	} else if !cfg.ArchiveCollections {
-		// For directory-based output, create collection subdirectories
+		// For directory-based output, create collection subdirectories, under their partial
+		// names until the encode completes
+		partialNames := make([]string, len(diskNames))
+		for i := range diskNames {
+			partialNames[i] = file.PartialPath(diskNames[i])
+		}
 		var err error
-		collections, err = file.CreateCollections(ctx, cfg.OutputDir, p.Collections)
+		collections, err = file.CreateCollections(ctx, cfg.OutputDir, partialNames)
 		if err != nil {
 			return err
 		}
 
-		// Set format for all collections
+		// Set format and real names for all collections
 		for i := range collections {
-			collections[i].Format = cfg.Format
+			collections[i].Name = p.Collections[i]
+			collections[i].Format = cfg.collectionFormat(i)
+			if diskNames[i] != p.Collections[i] {
+				collections[i].StoredName = diskNames[i]
+			}
 		}
 	} else {
 		// For TAR-based output in a single directory, just create collection references
@@ -432,44 +909,185 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 		for i, collName := range p.Collections {
 			collections[i] = file.Collection{
 				Name:   collName,
-				Path:   filepath.Join(cfg.OutputDir, collName),
-				Format: cfg.Format,
+				Path:   filepath.Join(cfg.OutputDir, diskNames[i]),
+				Format: cfg.collectionFormat(i),
+			}
+			if diskNames[i] != collName {
+				collections[i].StoredName = diskNames[i]
 			}
 			log.Debugf("Created virtual collection %d: %s at %s", i+1, collName, collections[i].Path)
 		}
 	}
 
-	// Get the formatter for the specified format (binary or PNG)
+	// Collections stored under stealth names carry them in their chunk headers too
+	p.Aliases = stealthAliases(collections)
+
+	// Get the formatter for the format of each collection (binary or PNG)
 	// This determines how data chunks are written to and read from disk
-	formatter := file.GetFormatter(cfg.Format)
+	formatters := make(map[Format]file.Formatter)
+	for _, coll := range collections {
+		if formatters[coll.Format] == nil {
+			formatters[coll.Format] = file.GetFormatter(coll.Format)
+		}
+	}
 
-	// Create a tar stream from the input directory
-	// This serializes all files and directories into a single stream for processing
-	log.Debugf("Creating tar stream from input directory: %s", cfg.InputDir)
-	tarStream, err := file.SerializeDirectoryToStream(ctx, cfg.InputDir)
-	if err != nil {
-		log.Error(fmt.Errorf("failed to create tar stream: %w", err))
-		return fmt.Errorf("failed to create tar stream: %w", err)
+	// Show the user's own photos or generated images in PNG chunks, rather than a single
+	// transparent pixel
+	var covers *file.CoverImages
+	if (cfg.CoverDir != "" || cfg.GeneratedCovers) && !cfg.SizeOnly {
+		if !cfg.usesFormat(FormatPNG) {
+			err := fmt.Errorf("cover images can only be used with the png format")
+			log.Error(err)
+			return err
+		}
+		if cfg.CoverDir != "" {
+			var err error
+			if covers, err = file.LoadCoverImages(cfg.CoverDir); err != nil {
+				log.Error(err)
+				return err
+			}
+			log.Debugf("Using %d cover images from %s", covers.Len(), cfg.CoverDir)
+		} else {
+			covers = file.GeneratedCoverImages()
+			log.Debugf("Using generated cover images")
+		}
+		if png, ok := formatters[FormatPNG].(*file.PngFormatter); ok {
+			png.Covers = covers
+		}
 	}
-	defer tarStream.Close()
 
-	// Add compression if configured (typically GZIP)
-	// This reduces storage requirements without affecting security
-	var inputStream io.Reader = tarStream
-	if cfg.Compression == CompressionGzip {
-		log.Debugf("Adding gzip compression to stream")
+	// Hide chunk data in the pixels of PNG chunks, rather than in a chunk that is easily stripped
+	if cfg.PNGEmbedding != "" && cfg.PNGEmbedding != PNGEmbedChunk {
+		if !cfg.usesFormat(FormatPNG) {
+			err := fmt.Errorf("-embed %s can only be used with the png format", cfg.PNGEmbedding)
+			log.Error(err)
+			return err
+		}
+		if png, ok := formatters[FormatPNG].(*file.PngFormatter); ok && !cfg.SizeOnly {
+			png.Embedding = cfg.PNGEmbedding
+		}
+	}
 
-		// If we're in size-only mode, use in-memory compression to track sizes accurately
-		if cfg.SizeOnly && sizeTracker != nil {
+	// A stream that is already serialized, and compressed if cfg.Compression says so, is
+	// encoded as it is; otherwise the input directory is serialized here
+	inputStream := cfg.InputStream
+	var indexed *file.IndexedStream
+	var dedupStats *file.DedupStats
+	if inputStream != nil {
+		log.Debugf("Encoding a serialized input stream")
+	} else if cfg.ChunkIndex && !cfg.SizeOnly {
+		// Serialize and compress the input in blocks, ending with an index of the chunks
+		// holding each block, so that some of the files can be decoded alone
+		if indexed, err = serializeIndexed(ctx, &cfg, p.InputChunkBytes(cfg.ChunkSize)); err != nil {
+			return err
+		}
+		defer indexed.Close()
+		inputStream = indexed
+	} else {
+		// Create a tar stream from the input directory
+		// This serializes all files and directories into a single stream for processing
+		// A raw stream is encoded as it is, and decodes back to the same bytes
+		var tarStream io.ReadCloser
+		if cfg.RawInput != nil {
+			log.Debugf("Encoding the stream %s as it is", cfg.rawStreamName())
+			tarStream = io.NopCloser(cfg.RawInput)
+		} else {
+			log.Debugf("Creating tar stream from input directory: %s", strings.Join(cfg.inputDirs(), ", "))
 			var err error
-			inputStream, err = compressForDryRun(ctx, tarStream, sizeTracker)
+			tarStream, err = file.SerializeDirectoriesWithFilter(ctx, cfg.inputDirs(), cfg.Filter)
 			if err != nil {
-				log.Error(fmt.Errorf("failed to compress for dry run: %w", err))
-				return fmt.Errorf("failed to compress for dry run: %w", err)
+				log.Error(fmt.Errorf("failed to create tar stream: %w", err))
+				return fmt.Errorf("failed to create tar stream: %w", err)
 			}
-		} else {
-			inputStream = file.CompressStreamToStream(ctx, tarStream)
 		}
+		defer tarStream.Close()
+		var serialized io.Reader = tarStream
+		if counter != nil {
+			serialized = counter.serialized.wrap(tarStream)
+		}
+
+		// Store repeated blocks once, before compression, which only finds repeats close together
+		if cfg.Dedup {
+			dedupStats = &file.DedupStats{}
+			serialized = file.DedupStream(ctx, serialized, dedupStats)
+		}
+
+		// Choose the compression from a sample of the input, if asked to
+		if cfg.Compression == CompressionAuto {
+			var err error
+			serialized, cfg.Compression, err = resolveAutoCompression(ctx, serialized)
+			if err != nil {
+				return err
+			}
+			cfg.autoCompressed = true
+			if cfg.Result != nil {
+				cfg.Result.Compression = cfg.Compression.String()
+				cfg.Result.CompressionLevel = cfg.compressionLevel()
+			}
+		}
+
+		// Add compression if configured (typically GZIP)
+		// This reduces storage requirements without affecting security
+		inputStream = serialized
+		if cfg.Compression.effective() != CompressionNone {
+			log.Debugf("Adding %s compression to stream", cfg.Compression)
+
+			// If we're in size-only mode, use in-memory compression to track sizes accurately
+			var err error
+			if cfg.SizeOnly && sizeTracker != nil {
+				inputStream, err = compressForDryRun(ctx, serialized, cfg.Compression, cfg.CompressionLevel, sizeTracker)
+				if err != nil {
+					log.Error(fmt.Errorf("failed to compress for dry run: %w", err))
+					return fmt.Errorf("failed to compress for dry run: %w", err)
+				}
+			} else {
+				inputStream, err = file.CompressStream(ctx, serialized, cfg.Compression.String(), cfg.CompressionLevel)
+				if err != nil {
+					log.Error(fmt.Errorf("failed to compress input: %w", err))
+					return fmt.Errorf("failed to compress input: %w", err)
+				}
+			}
+		}
+	}
+
+	// Pad the data to conceal its size, after compression since that's the size it reveals;
+	// the true length is recorded within the padded stream, where only decode can find it,
+	// and any hidden volume goes at the start of the padding
+	inputStream, discardHidden, err := padStream(ctx, cfg, inputStream)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer discardHidden()
+
+	// Encrypt the data in an AES-256-GCM envelope, after compression since encrypted data
+	// doesn't compress; the envelope is recorded in the collection metadata
+	if len(cfg.EnvelopeKey) > 0 {
+		if cfg.envelope, err = file.NewEnvelope(); err != nil {
+			log.Error(err)
+			return err
+		}
+		if inputStream, err = file.EncryptStream(ctx, inputStream, cfg.envelope, cfg.EnvelopeKey); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	// Mask the data with the keystream of a passphrase, after compression since masked data
+	// doesn't compress, so that K collections alone don't reveal it
+	if len(cfg.Passphrase) > 0 {
+		if inputStream, err = file.MaskStream(ctx, inputStream, cfg.Passphrase); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	// Let serialization and compression run ahead of the pad by up to the pipe buffer size
+	if cfg.Pipeline.PipeBufferSize > 0 && !cfg.SizeOnly {
+		log.Debugf("Buffering %d bytes between the input stream and the pad", cfg.Pipeline.PipeBufferSize)
+		buffered := file.BufferStream(ctx, inputStream, cfg.Pipeline.PipeBufferSize)
+		defer buffered.Close()
+		inputStream = buffered
 	}
 
 	// Define a callback function that creates chunk writers for the encoding process
@@ -484,12 +1102,15 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 		}
 
 		// Find the collection path for the given collection name
-		var collPath string
+		var collPath, diskName string
+		var collFormat Format
 		var found bool
 
 		for _, c := range collections {
 			if c.Name == collectionName {
 				collPath = c.Path
+				diskName = c.DiskName()
+				collFormat = c.Format
 				found = true
 				break
 			}
@@ -501,27 +1122,16 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 
 		// If archive collections is enabled, create TarChunkWriter
 		if cfg.ArchiveCollections {
-			// Handle TAR path differently based on single vs multiple output dirs
-			var tarPath string
-
-			if len(cfg.OutputDirs) > 1 {
-				// For multiple output directories, put the TAR inside the directory
-				tarPath = filepath.Join(collPath, collectionName+".tar")
-			} else {
-				// For single output directory, put TAR next to the collection directory
-				tarPath = collPath
-				if !strings.HasSuffix(tarPath, ".tar") {
-					tarPath = tarPath + ".tar"
-				}
-			}
-
+			tarPath := collectionTarPath(cfg, collPath, diskName)
 			log.Debugf("Preparing to write to TAR file at: %s", tarPath)
 
 			// Create the TarChunkWriter for this chunk if it doesn't exist yet
-			tarWriter, err := file.NewTarChunkWriter(ctx, tarPath, collectionName, cfg.Format)
+			tarWriter, err := tarWriters.VolumeChunkWriter(ctx, tarPath, diskName, collFormat, cfg.VolumeSize)
 			if err != nil {
 				return nil, fmt.Errorf("failed to create tar chunk writer: %w", err)
 			}
+			tarWriter.Covers = covers
+			tarWriter.PNGEmbedding = cfg.PNGEmbedding
 
 			// Set the chunk number for this write operation
 			tarWriter.ChunkNum = chunkNumber
@@ -532,31 +1142,168 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 		// Otherwise use the standard NamedChunkWriter for directory output
 		return &file.NamedChunkWriter{
 			Ctx:       ctx,
-			Formatter: formatter,
+			Formatter: formatters[collFormat],
 			CollPath:  collPath,
-			CollName:  collectionName,
+			CollName:  diskName,
 			ChunkNum:  chunkNumber,
+			Checksum:  cfg.ChecksumSidecars,
+			Parity:    cfg.ParityPercent,
+			Retry:     cfg.Retry,
 		}, nil
 	}
 
+	// Record metadata in every collection before any chunks are written, with a new session
+	// identifier that tells these collections from those of any other encode
+	var metadata []*file.Metadata
+	if !cfg.SizeOnly && !cfg.Resume && target == nil {
+		if cfg.session, err = file.NewSession(); err != nil {
+			log.Error(err)
+			return err
+		}
+		if cfg.Result != nil {
+			cfg.Result.Session = cfg.session
+		}
+		if metadata, err = writeCollectionMetadata(ctx, cfg, collections, tarWriters); err != nil {
+			return err
+		}
+		if cfg.RecoveryNotes {
+			if err := writeRecoveryNotes(ctx, cfg, collections, tarWriters); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Hash the whole payload as the pad reads it, including any part a resumed encode skips,
+	// so that decode can check that it rebuilt the payload exactly
+	payloadHash := sha256.New()
+	if !cfg.SizeOnly {
+		inputStream = io.TeeReader(inputStream, payloadHash)
+	}
+
+	// Authenticate every chunk with a MAC, if asked to
+	var authenticator *chunkAuthenticator
+	if len(cfg.MACKey) > 0 && !cfg.SizeOnly {
+		if authenticator, err = newChunkAuthenticator(cfg.MACKey, collections); err != nil {
+			log.Error(err)
+			return err
+		}
+		newChunkFunc = authenticator.wrap(newChunkFunc)
+	}
+
 	// Run the actual encoding process, which:
 	// 1. Reads data from the input stream in chunks
 	// 2. Generates random one-time pads for each chunk
 	// 3. XORs input data with pads to create ciphertext
 	// 4. Distributes the results across collections according to the threshold scheme
+	// In verbose runs, stats collects timing and size distributions for the final report
 	log.Debugf("Starting encode process with chunk size: %d", cfg.ChunkSize)
-	err = p.Encode(
-		ctx,
-		cfg.ChunkSize,
-		inputStream,
-		cfg.RNG,
-		newChunkFunc,
-		string(cfg.Format),
-	)
-	if err != nil {
-		log.Error(fmt.Errorf("encoding failed: %w", err))
+
+	// Collections written as files to local directories record their progress after every
+	// chunk, so that the encode can be resumed if it dies; a resumed encode first skips the
+	// input that is already encoded
+	var checkpointer *encodeCheckpointer
+	firstChunk := 1
+	if target != nil {
+		firstChunk = target.chunks + 1
+	} else if !cfg.SizeOnly && checkResumable(cfg, destinations) == nil {
+		hasher := newStreamHasher(inputStream, p.InputChunkBytes(cfg.ChunkSize))
+		inputStream = hasher
+		checkpointer = &encodeCheckpointer{
+			ctx:         ctx,
+			collections: collections,
+			hasher:      hasher,
+			inputBytes:  int64(p.InputChunkBytes(cfg.ChunkSize)),
+			progress: encodeProgress{
+				Copies:           cfg.N,
+				Required:         cfg.K,
+				Sharing:          cfg.sharing().Name(),
+				Format:           cfg.Format,
+				ChunkSize:        cfg.ChunkSize,
+				Compression:      cfg.Compression.effective().String(),
+				CompressionLevel: cfg.CompressionLevel,
+				CompressionAuto:  cfg.autoCompressed,
+			},
+		}
+		if resumeFrom != nil {
+			if err := hasher.skip(resumeFrom.StreamOffset, resumeFrom.StreamSHA256); err != nil {
+				log.Error(err)
+				return err
+			}
+			firstChunk = resumeFrom.Chunks + 1
+		}
+		if err := checkpointer.save(firstChunk - 1); err != nil {
+			log.Error(err)
+			return err
+		}
+		newChunkFunc = checkpointer.wrap(newChunkFunc)
+	}
+
+	// Every collection gets one chunk per chunk number, so the highest number written, or the
+	// last one a resumed encode had written, is how many chunks each collection holds
+	chunks := firstChunk - 1
+	countChunks := newChunkFunc
+	newChunkFunc = func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		chunks = max(chunks, chunkNumber)
+		return countChunks(collectionName, chunkNumber, chunkFormat)
+	}
+
+	stats := newEncodeStats(ctx)
+	if counter != nil {
+		inputStream = counter.encoded.wrap(inputStream)
+		newChunkFunc = counter.wrapChunks(newChunkFunc)
+	}
+	err = p.EncodeFrom(
+		ctx,
+		firstChunk,
+		cfg.ChunkSize,
+		stats.input(inputStream),
+		stats.rng(cfg.RNG),
+		stats.chunks(newChunkFunc),
+		string(cfg.Format),
+	)
+	if err != nil {
+		log.Error(fmt.Errorf("encoding failed: %w", err))
 		return fmt.Errorf("encoding failed: %w", err)
 	}
+	stats.report(ctx)
+	if !cfg.SizeOnly {
+		var index *file.IndexLocation
+		if indexed != nil {
+			location := indexed.Location()
+			index = &location
+		}
+		if target != nil {
+			if err := recordAppend(ctx, cfg, target, collections, hex.EncodeToString(payloadHash.Sum(nil)), chunks, tarWriters); err != nil {
+				return err
+			}
+		} else if err := recordPayload(ctx, cfg, collections, metadata, hex.EncodeToString(payloadHash.Sum(nil)), chunks, index, tarWriters); err != nil {
+			return err
+		}
+		if authenticator != nil {
+			if err := authenticator.store(ctx, cfg, collections, tarWriters); err != nil {
+				return err
+			}
+		}
+	}
+	if checkpointer != nil {
+		if err := checkpointer.finish(); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	// Collection directories written under their partial names are now complete
+	for i := range collections {
+		if !file.IsPartialPath(collections[i].Path) {
+			continue
+		}
+		finalPath := file.FinalPath(collections[i].Path)
+		if err := file.CommitPartial(finalPath); err != nil {
+			log.Error(fmt.Errorf("failed to rename collection %s: %w", collections[i].Name, err))
+			return fmt.Errorf("failed to rename collection %s: %w", collections[i].Name, err)
+		}
+		collections[i].Path = finalPath
+	}
 
 	// Skip archive finalization in dry run mode
 	if cfg.SizeOnly {
@@ -566,7 +1313,7 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 		// We need to finalize the TAR writers to ensure they're properly closed
 		// Finalize all TAR writers to ensure proper closing
 		log.Debugf("Finalizing all TAR writers created during encoding")
-		if err := file.FinalizeAllTarWriters(ctx); err != nil {
+		if err := tarWriters.FinalizeAll(ctx); err != nil {
 			log.Error(fmt.Errorf("failed to finalize TAR writers: %w", err))
 			return err
 		}
@@ -577,8 +1324,8 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 		if len(cfg.OutputDirs) <= 1 {
 			log.Debugf("Cleaning up empty collection directories after creating TAR files")
 			for _, coll := range collections {
-				// Only remove if it's a directory and not a TAR file
-				if !strings.HasSuffix(coll.Path, ".tar") {
+				// Only remove if it's a directory and not an archive file
+				if !file.IsArchivePath(coll.Path) {
 					info, err := os.Stat(coll.Path)
 					if err == nil && info.IsDir() {
 						if err := os.RemoveAll(coll.Path); err != nil {
@@ -598,7 +1345,7 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 		// For multiple output directories with archive mode, create tar archives in each directory
 		// but don't delete the directories (just archive the contents)
 		for _, coll := range collections {
-			tarPath, err := file.TarDirectoryContents(ctx, coll.Path, coll.Name)
+			tarPath, err := file.TarDirectoryContents(ctx, coll.Path, coll.DiskName())
 			if err != nil {
 				log.Error(fmt.Errorf("failed to create tar archive for collection %s: %w", coll.Name, err))
 				return err
@@ -617,29 +1364,102 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 		}
 	}
 
-	// Perform verification for PNG collections if not in dry run mode
-	if !cfg.SizeOnly && cfg.Format == FormatPNG {
-		log.Infof("Starting verification pass to ensure PNG data integrity...")
+	// If we're using TAR archives, the collection paths need to be updated to point to the TAR files
+	if !cfg.SizeOnly && cfg.ArchiveCollections {
+		for i := range collections {
+			if !file.IsArchivePath(collections[i].Path) {
+				// For multiple output directories, the TAR files are named differently (collection name inside the dir)
+				if len(cfg.OutputDirs) > 1 {
+					collections[i].Path = filepath.Join(collections[i].Path, collections[i].DiskName()+cfg.ArchiveFormat.Ext())
+				} else {
+					collections[i].Path = collections[i].Path + cfg.ArchiveFormat.Ext()
+				}
+			}
 
-		// If we're using TAR archives, the collection paths need to be updated to point to the TAR files
-		if cfg.ArchiveCollections {
-			for i := range collections {
-				if !strings.HasSuffix(collections[i].Path, ".tar") {
-					// For multiple output directories, the TAR files are named differently (collection name inside the dir)
-					if len(cfg.OutputDirs) > 1 {
-						collections[i].Path = filepath.Join(collections[i].Path, collections[i].Name+".tar")
-					} else {
-						collections[i].Path = collections[i].Path + ".tar"
-					}
+			// Collections split into volumes are described by their volume manifest
+			if cfg.VolumeSize > 0 {
+				manifestPath := file.VolumeManifestPath(collections[i].Path)
+				manifest, volumes, err := file.ReadVolumeManifest(manifestPath)
+				if err != nil {
+					log.Error(err)
+					return err
 				}
+				collections[i].Path = manifestPath
+				collections[i].Volumes = volumes
+				log.Infof("Collection %s was split into %d volumes of at most %s", collections[i].Name, len(volumes), FormatByteSize(manifest.VolumeSize))
 			}
 		}
+	}
+
+	// Verify the CRC of every chunk if not in dry run mode
+	if !cfg.SizeOnly {
+		log.Infof("Starting verification pass to ensure %s data integrity...", cfg.formatDescription())
 
-		if err := VerifyCollectionIntegrity(ctx, collections, cfg.Format); err != nil {
+		if err := verifyCollectionFormats(ctx, collections); err != nil {
 			log.Error(fmt.Errorf("verification completed with errors: %w", err))
 			// We continue despite errors - we want to return the encoded data anyway
 		} else {
-			log.Infof("Verification completed successfully - all PNG files passed integrity checks")
+			log.Infof("Verification completed successfully - all %s files passed integrity checks", cfg.formatDescription())
+		}
+	}
+
+	if cfg.ParityPercent > 0 && cfg.ArchiveCollections && !cfg.SizeOnly {
+		log.Infof("Parity sidecars are only written in files mode, none were created for TAR archives")
+	}
+
+	// Verify checksum sidecars for individual-file collections
+	if cfg.ChecksumSidecars && !cfg.SizeOnly {
+		if cfg.ArchiveCollections {
+			log.Infof("Checksum sidecars are only written in files mode, none were created for TAR archives")
+		} else if err := VerifyChecksumSidecars(ctx, collections); err != nil {
+			log.Error(fmt.Errorf("checksum verification completed with errors: %w", err))
+		} else {
+			log.Infof("Checksum verification completed successfully")
+		}
+	}
+
+	// Write PAR2 recovery files so custodians can repair media errors with standard tools
+	if cfg.Par2Percent > 0 && !cfg.SizeOnly {
+		for _, coll := range collections {
+			written, err := file.WriteCollectionPar2(ctx, coll, cfg.Par2Percent)
+			writtenPar2 = append(writtenPar2, written...)
+			if err != nil {
+				log.Error(fmt.Errorf("failed to write PAR2 recovery files for collection %s: %w", coll.Name, err))
+				return err
+			}
+		}
+		log.Infof("Wrote PAR2 recovery files with %d%% redundancy for %d collections", cfg.Par2Percent, len(collections))
+	}
+
+	// Write the distribution catalog now that every collection is finalized
+	if cfg.CatalogPath != "" && !cfg.SizeOnly {
+		catalog, err := BuildCatalog(ctx, cfg, collections)
+		if err != nil {
+			return err
+		}
+		catalogRemoteDestinations(catalog, destinations)
+		if err := WriteCatalog(ctx, cfg.CatalogPath, catalog, cfg.CatalogKey); err != nil {
+			return err
+		}
+		writtenCatalog = cfg.CatalogPath
+	}
+
+	// Measure the collections before any staged for remote destinations are delivered
+	if cfg.Result != nil {
+		cfg.Result.setEncodeCollections(collections, counter, sizeTracker, destinations)
+	}
+
+	// Deliver collections staged for remote destinations
+	if err := publishDestinations(ctx, destinations); err != nil {
+		return err
+	}
+
+	// Record the encode in the snapshot log once its collections are where they will be kept.
+	// They are complete by now, so they aren't rolled back if it can't be recorded.
+	if cfg.SnapshotsPath != "" && !cfg.SizeOnly {
+		snapshot := newSnapshot(cfg, collections, counter, destinations)
+		if err := RecordSnapshot(ctx, cfg.SnapshotsPath, &snapshot); err != nil {
+			log.Infof("Warning: the encode is complete, but isn't recorded in the snapshot log: %v", err)
 		}
 	}
 
@@ -651,10 +1471,10 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 		// Output the size report with asterisk lines at beginning and end
 		log.Infof("*** DRY RUN SIZE REPORT ***")
 
-		log.Infof("Original input size:              %s bytes", FormatByteSize(sizeTracker.InputSize))
+		log.Infof("Original input size:              %s", FormatByteSize(sizeTracker.InputSize))
 
-		if cfg.Compression == CompressionGzip && sizeTracker.CompressedInputSize > 0 {
-			log.Infof("Compressed input size:            %s bytes", FormatByteSize(sizeTracker.CompressedInputSize))
+		if cfg.Compression.effective() != CompressionNone && sizeTracker.CompressedInputSize > 0 {
+			log.Infof("Compressed input size:            %s", FormatByteSize(sizeTracker.CompressedInputSize))
 
 			// Calculate compression ratio
 			compressionRatio := 0.0
@@ -671,8 +1491,8 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 				eachCollectionSize = sizeTracker.EncodeCollectionsTotalSize / int64(len(sizeTracker.EncodeCollectionsSizes))
 			}
 
-			log.Infof("Each collection size:             %s bytes", FormatByteSize(eachCollectionSize))
-			log.Infof("Total size of all collections:    %s bytes", FormatByteSize(sizeTracker.EncodeCollectionsTotalSize))
+			log.Infof("Each collection size:             %s", FormatByteSize(eachCollectionSize))
+			log.Infof("Total size of all collections:    %s", FormatByteSize(sizeTracker.EncodeCollectionsTotalSize))
 
 			// Calculate expansion ratio (total collections size / original input size)
 			expansionRatio := 0.0
@@ -686,22 +1506,281 @@ func EncodeDirectory(ctx context.Context, cfg EncodeConfig) error {
 		log.Infof("***")
 	}
 
+	if dedupStats != nil {
+		logDedup(ctx, dedupStats)
+		if cfg.Result != nil {
+			cfg.Result.DuplicateBytes = dedupStats.DuplicateBytes
+		}
+	}
+
 	// Log differently depending on whether using single or multiple output directories
 	if len(cfg.OutputDirs) <= 1 {
-		log.Infof("Encode complete (%s) -copies %d -required %d -format %s", elapsed, cfg.N, cfg.K, cfg.Format)
+		log.Infof("Encode complete (%s) -copies %d -required %d -format %s", elapsed, cfg.N, cfg.K, cfg.formatDescription())
+	} else if cfg.weighted {
+		log.Infof("Encode complete (%s) with %d weighted output directories, %d of %d collections required -format %s",
+			elapsed, len(cfg.OutputDirs), cfg.K, cfg.N, cfg.formatDescription())
 	} else {
 		log.Infof("Encode complete (%s) with %d output directories -required %d -format %s",
-			elapsed, len(cfg.OutputDirs), cfg.K, cfg.Format)
+			elapsed, len(cfg.OutputDirs), cfg.K, cfg.formatDescription())
 	}
 
 	return nil
 }
 
+// collectionTarPath returns the TAR or ZIP file that chunks for a collection are streamed into
+func collectionTarPath(cfg EncodeConfig, collPath string, collName string) string {
+	if len(cfg.OutputDirs) > 1 {
+		// For multiple output directories, put the TAR inside the directory
+		return filepath.Join(collPath, collName+cfg.ArchiveFormat.Ext())
+	}
+
+	// For single output directory, put TAR next to the collection directory
+	if !file.IsArchivePath(collPath) {
+		return collPath + cfg.ArchiveFormat.Ext()
+	}
+	return collPath
+}
+
+// writeCollectionMetadata stores a metadata file in each collection describing the distribution;
+// archived collections get it as their first entry, through the encode's tarWriters. It returns
+// the metadata of each collection, before it was sealed.
+func writeCollectionMetadata(ctx context.Context, cfg EncodeConfig, collections []file.Collection, tarWriters *file.TarWriterRegistry) ([]*file.Metadata, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if len(cfg.Custodians) > 0 && len(cfg.Custodians) != len(collections) {
+		return nil, fmt.Errorf("%d custodians specified for %d collections", len(cfg.Custodians), len(collections))
+	}
+	custodians := make([]Custodian, len(cfg.Custodians))
+	for i, c := range cfg.Custodians {
+		c.Collection = collections[i].Name
+		custodians[i] = c
+	}
+
+	compression := cfg.Compression.effective()
+	created := time.Now().UTC().Truncate(time.Second)
+	metadata := make([]*file.Metadata, len(collections))
+	for i, coll := range collections {
+		md := &file.Metadata{
+			Version:          file.MetadataVersion,
+			FormatVersion:    file.CollectionFormatVersion,
+			Collection:       coll.Name,
+			Copies:           len(collections),
+			Required:         cfg.K,
+			Format:           coll.Format,
+			Compression:      compression.String(),
+			CompressionLevel: cfg.compressionLevel(),
+			CompressionAuto:  cfg.autoCompressed,
+			ChunkSize:        cfg.ChunkSize,
+			ChunkSizeAuto:    cfg.autoChunkSize,
+			Sharing:          cfg.sharing().Name(),
+			Session:          cfg.session,
+			Created:          created,
+			ReviewBy:         cfg.ReviewBy,
+			Custodians:       custodians,
+			StoredName:       coll.StoredName,
+			Envelope:         cfg.envelope,
+			Stream:           cfg.rawStreamName(),
+			Dedup:            cfg.Dedup,
+		}
+		if coll.Format == FormatPNG {
+			md.PNGEmbedding = cfg.PNGEmbedding
+		}
+		if i < len(cfg.Labels) {
+			md.Label = cfg.Labels[i]
+		}
+		if i < len(cfg.Notes) {
+			md.Notes = cfg.Notes[i]
+		}
+		if err := storeCollectionMetadata(ctx, cfg, coll, md, tarWriters); err != nil {
+			return nil, err
+		}
+		metadata[i] = md
+	}
+
+	log.Debugf("Wrote metadata to %d collections", len(collections))
+	return metadata, nil
+}
+
+// storeCollectionMetadata seals a collection's metadata if there is a metadata key, and writes
+// it to the collection directory or adds it to the collection archive
+func storeCollectionMetadata(ctx context.Context, cfg EncodeConfig, coll file.Collection, md *file.Metadata, tarWriters *file.TarWriterRegistry) error {
+	if len(cfg.MetadataKey) > 0 {
+		sealed, err := file.SealMetadata(md, cfg.MetadataKey)
+		if err != nil {
+			return err
+		}
+		md = sealed
+	}
+
+	if !cfg.ArchiveCollections {
+		return file.WriteMetadata(ctx, coll.Path, md)
+	}
+
+	data, err := file.MarshalMetadata(md)
+	if err != nil {
+		return err
+	}
+	return addCollectionEntry(ctx, cfg, coll, file.MetadataFileName, data, tarWriters)
+}
+
+// addCollectionEntry adds a file other than a chunk to a collection archive, through the
+// encode's tarWriters
+func addCollectionEntry(ctx context.Context, cfg EncodeConfig, coll file.Collection, name string, data []byte, tarWriters *file.TarWriterRegistry) error {
+	tarWriter, err := tarWriters.VolumeChunkWriter(ctx, collectionTarPath(cfg, coll.Path, coll.DiskName()), coll.DiskName(), coll.Format, cfg.VolumeSize)
+	if err != nil {
+		return fmt.Errorf("failed to create tar chunk writer: %w", err)
+	}
+	return tarWriter.AddFile(name, data)
+}
+
+// findInputCollections locates the collections to read, either all collections within a single
+// input directory or one collection per directory when several input directories are given.
+// Directories that aren't collections are searched to depth levels of subdirectories.
+// The returned temporary directory, if not empty, holds extracted TAR files and must be removed by the caller.
+func findInputCollections(ctx context.Context, inputDir string, inputDirs []string, depth int) ([]file.Collection, string, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	// Variable to hold all collected collections and a tempDir if needed
+	var allCollections []file.Collection
+	var collTempDir string
+
+	if len(inputDirs) == 0 {
+		inputDirs = []string{inputDir}
+	}
+
+	// Collection archives and chunk files given as inputs are gathered apart from directories
+	var inputFiles, dirs []string
+	for _, path := range inputDirs {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			inputFiles = append(inputFiles, path)
+		} else {
+			dirs = append(dirs, path)
+		}
+	}
+	inputDirs = dirs
+	if len(inputDirs) > 0 {
+		inputDir = inputDirs[0]
+	}
+
+	// Handle single input dir or multiple input dirs. A single input directory normally
+	// holds several collections, unless it is itself a collection directory.
+	if len(inputDirs) == 1 && !isValidCollectionDir(ctx, inputDir) {
+		// Traditional approach - single input directory containing multiple collections
+		// Validate input directory to ensure it exists and is accessible
+		if err := file.ValidateInputDirectory(ctx, inputDir); err != nil {
+			return nil, "", err
+		}
+
+		// Find collections (directories or zips) in the input directory
+		// This identifies all available collections, extracting ZIP files if necessary
+		collections, tempDir, err := file.FindCollectionsDepth(ctx, inputDir, depth)
+		if err != nil {
+			return nil, "", err
+		}
+
+		// Use the results
+		allCollections = collections
+		collTempDir = tempDir
+	} else {
+		// Multiple input directory mode - each input directory is treated as a collection
+		for _, inputDir := range inputDirs {
+			// Validate each input directory
+			if err := file.ValidateInputDirectory(ctx, inputDir); err != nil {
+				return nil, "", err
+			}
+
+			// First check if this directory contains a collection directly
+			// (it might be a directory containing a collection like '3A5')
+			if isValidCollectionDir(ctx, inputDir) {
+				// The directory itself is a valid collection
+				format, err := file.DetermineCollectionFormat(inputDir)
+				if err != nil {
+					log.Infof("Could not determine collection format for %s, skipping: %v", inputDir, err)
+					continue
+				}
+
+				collName := filepath.Base(inputDir)
+				if !file.IsStoredCollectionName(collName) {
+					// If the directory name is not a valid collection name,
+					// try to find a valid collection inside by examining files
+					collName, err = determineCollectionNameFromContent(ctx, inputDir)
+					if err != nil {
+						log.Infof("Could not determine collection name for %s, skipping: %v", inputDir, err)
+						continue
+					}
+				}
+
+				collection := file.Collection{
+					Name:   collName,
+					Path:   inputDir,
+					Format: format,
+				}
+				collection.UseMetadata(ctx)
+				allCollections = append(allCollections, collection)
+				log.Debugf("Found direct collection in %s, name=%s, format=%s", inputDir, collName, format)
+			} else {
+				// Check if the directory contains collections or zip files
+				collections, tempDir, err := file.FindCollectionsDepth(ctx, inputDir, depth)
+				if err != nil {
+					log.Infof("Failed to find collections in %s: %v", inputDir, err)
+					continue
+				}
+
+				// Add these collections to our master list
+				allCollections = append(allCollections, collections...)
+
+				// Remember the tempDir for cleanup if it exists
+				if tempDir != "" && collTempDir == "" {
+					collTempDir = tempDir
+				}
+
+				log.Debugf("Found %d collections in directory %s", len(collections), inputDir)
+			}
+		}
+	}
+
+	if len(inputFiles) > 0 {
+		collections, tempDir, err := file.FindCollectionFiles(ctx, inputFiles, collTempDir)
+		if err != nil {
+			if collTempDir != "" {
+				os.RemoveAll(collTempDir)
+			}
+			return nil, "", err
+		}
+		allCollections = append(allCollections, collections...)
+		collTempDir = tempDir
+		log.Debugf("Found %d collections in %d input files", len(collections), len(inputFiles))
+	}
+
+	// Ensure we found at least some collections
+	if len(allCollections) == 0 {
+		if collTempDir != "" {
+			os.RemoveAll(collTempDir)
+		}
+		if len(inputDirs) <= 1 {
+			err := fmt.Errorf("no collections found in input directory: %w", ErrInsufficientCollections)
+			log.Error(err)
+			return nil, "", err
+		} else {
+			err := fmt.Errorf("no valid collections found in any of the input directories: %w", ErrInsufficientCollections)
+			log.Error(err)
+			return nil, "", err
+		}
+	}
+	return allCollections, collTempDir, nil
+}
+
 // isValidCollectionDir checks if a directory is likely to contain a valid collection
 func isValidCollectionDir(ctx context.Context, dirPath string) bool {
 	log := trace.FromContext(ctx).WithPrefix("padlock")
 	log.Debugf("Checking if %s is a valid collection directory", dirPath)
 
+	// A collection an encode hasn't finished writing can't be decoded
+	if file.IsPartialOutput(dirPath) {
+		log.Infof("Ignoring partial output %s", dirPath)
+		return false
+	}
+
 	// Try to determine collection format
 	format, err := file.DetermineCollectionFormat(dirPath)
 	if err != nil {
@@ -709,6 +1788,12 @@ func isValidCollectionDir(ctx context.Context, dirPath string) bool {
 		return false
 	}
 
+	// Chunks of several collections copied into one directory are grouped by collection
+	if names, err := file.ChunkCollectionNames(dirPath); err == nil && len(names) > 1 {
+		log.Debugf("%s holds the chunks of collections %s", dirPath, strings.Join(names, ", "))
+		return false
+	}
+
 	log.Debugf("%s appears to be a valid collection directory with format %s", dirPath, format)
 	return true
 }
@@ -723,7 +1808,7 @@ func determineCollectionNameFromContent(ctx context.Context, dirPath string) (st
 		return "", fmt.Errorf("failed to read directory: %w", err)
 	}
 
-	// Look for files with pattern like "IMG3A5_0001.PNG" or "3A5_0001.bin"
+	// Look for files with pattern like "IMG3A5_0001.PNG", "REC3A5_0001.WAV", "3A5_0001.bin" or "3A5_0001.txt"
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
@@ -735,17 +1820,27 @@ func determineCollectionNameFromContent(ctx context.Context, dirPath string) (st
 		if strings.HasSuffix(strings.ToUpper(name), ".PNG") && strings.HasPrefix(name, "IMG") {
 			// Extract the collection name after "IMG" and before "_"
 			parts := strings.Split(strings.TrimPrefix(name, "IMG"), "_")
-			if len(parts) > 0 && file.IsCollectionName(parts[0]) {
+			if len(parts) > 0 && file.IsStoredCollectionName(parts[0]) {
 				log.Debugf("Determined collection name '%s' from file %s", parts[0], name)
 				return parts[0], nil
 			}
 		}
 
-		// Check for bin files
-		if strings.HasSuffix(name, ".bin") {
+		// Check for WAV files
+		if strings.HasSuffix(strings.ToUpper(name), ".WAV") && strings.HasPrefix(name, "REC") {
+			// Extract the collection name after "REC" and before "_"
+			parts := strings.Split(strings.TrimPrefix(name, "REC"), "_")
+			if len(parts) > 0 && file.IsStoredCollectionName(parts[0]) {
+				log.Debugf("Determined collection name '%s' from file %s", parts[0], name)
+				return parts[0], nil
+			}
+		}
+
+		// Check for bin and text files
+		if strings.HasSuffix(name, ".bin") || strings.HasSuffix(name, ".txt") {
 			// Extract the collection name before "_"
 			parts := strings.Split(name, "_")
-			if len(parts) > 0 && file.IsCollectionName(parts[0]) {
+			if len(parts) > 0 && file.IsStoredCollectionName(parts[0]) {
 				log.Debugf("Determined collection name '%s' from file %s", parts[0], name)
 				return parts[0], nil
 			}
@@ -777,107 +1872,116 @@ func determineCollectionNameFromContent(ctx context.Context, dirPath string) (st
 // N collections are provided. With fewer than K collections, the function will fail
 // and no information about the original data can be recovered due to the information-theoretic
 // security properties of the threshold scheme.
-func DecodeDirectory(ctx context.Context, cfg DecodeConfig) error {
+func DecodeDirectory(ctx context.Context, cfg DecodeConfig) (retErr error) {
 	log := trace.FromContext(ctx).WithPrefix("padlock")
 	start := time.Now()
 
+	// Summarize the decode for the caller, if asked to
+	var counter *resultCounter
+	if cfg.Result != nil {
+		*cfg.Result = Result{
+			Operation:   "decode",
+			DryRun:      cfg.SizeOnly,
+			Compression: cfg.Compression.effective().String(),
+			Started:     start,
+		}
+		if !cfg.SizeOnly && cfg.OutputStream == nil {
+			cfg.Result.OutputDir = cfg.OutputDir
+		}
+		counter = newResultCounter()
+		defer func() { cfg.Result.finish(start, retErr) }()
+	}
+
+	if cfg.Resume && (cfg.ClearIfNotEmpty || cfg.SizeOnly) {
+		err := fmt.Errorf("resuming a decode cannot be combined with clearing the output directory or a dry run")
+		log.Error(err)
+		return err
+	}
+	if cfg.Salvage && cfg.SizeOnly {
+		err := fmt.Errorf("salvaging a decode cannot be combined with a dry run")
+		log.Error(err)
+		return err
+	}
+	if cfg.Filter != nil && cfg.OutputStream != nil {
+		err := fmt.Errorf("files can only be selected when decoding to an output directory")
+		log.Error(err)
+		return err
+	}
+
+	// Chunks supplied by a source bypass all input directory discovery
+	if cfg.ChunkSource != nil {
+		log.Infof("Starting decode from chunk source: OutputDir=%s", cfg.outputDescription())
+		return decodeFromSource(ctx, cfg.ChunkSource, cfg)
+	}
+
+	// Download the collections in any remote input directories to local staging directories
+	sources, err := fetchSources(ctx, &cfg)
+	if err != nil {
+		return err
+	}
+	defer cleanupDestinations(ctx, sources)
+
 	// Log differently depending on whether using single or multiple input directories
 	if len(cfg.InputDirs) <= 1 {
-		log.Infof("Starting decode: InputDir=%s OutputDir=%s", cfg.InputDir, cfg.OutputDir)
+		log.Infof("Starting decode: InputDir=%s OutputDir=%s", cfg.InputDir, cfg.outputDescription())
 	} else {
-		log.Infof("Starting decode with %d input directories, OutputDir=%s", len(cfg.InputDirs), cfg.OutputDir)
+		log.Infof("Starting decode with %d input directories, OutputDir=%s", len(cfg.InputDirs), cfg.outputDescription())
 		for i, dir := range cfg.InputDirs {
 			log.Debugf("  InputDir[%d]=%s", i, dir)
 		}
 	}
 
-	// In dry run mode, we don't need to prepare output directories
-	if !cfg.SizeOnly {
-		// Prepare the output directory, clearing it if requested and it's not empty
-		if err := file.PrepareOutputDirectory(ctx, cfg.OutputDir, cfg.ClearIfNotEmpty); err != nil {
-			return err
-		}
-	} else {
-		log.Infof("Running in dry run mode - skipping output directory preparation")
+	// Collections still being written by an encode can't be decoded, and the output directory
+	// is locked before anything in it is cleared or written
+	inputDirs := cfg.InputDirs
+	if len(inputDirs) == 0 {
+		inputDirs = []string{cfg.InputDir}
 	}
-
-	// Variable to hold all collected collections and a tempDir if needed
-	var allCollections []file.Collection
-	var collTempDir string
-
-	// Handle single input dir or multiple input dirs
-	if len(cfg.InputDirs) <= 1 {
-		// Traditional approach - single input directory containing multiple collections
-		// Validate input directory to ensure it exists and is accessible
-		if err := file.ValidateInputDirectory(ctx, cfg.InputDir); err != nil {
+	if err := checkInputLocks(ctx, inputDirs); err != nil {
+		return err
+	}
+	if !cfg.SizeOnly && cfg.OutputStream == nil {
+		if err := checkOutputOverlap("decode", inputDirs, []string{cfg.OutputDir}); err != nil {
+			log.Error(err)
 			return err
 		}
-
-		// Find collections (directories or zips) in the input directory
-		// This identifies all available collections, extracting ZIP files if necessary
-		collections, tempDir, err := file.FindCollections(ctx, cfg.InputDir)
+		release, err := lockDirs(ctx, []string{cfg.OutputDir}, "decode")
 		if err != nil {
 			return err
 		}
+		defer release()
+	}
 
-		// Use the results
-		allCollections = collections
-		collTempDir = tempDir
-	} else {
-		// Multiple input directory mode - each input directory is treated as a collection
-		for _, inputDir := range cfg.InputDirs {
-			// Validate each input directory
-			if err := file.ValidateInputDirectory(ctx, inputDir); err != nil {
+	// In dry run mode, or when writing to an output stream, we don't need to prepare output directories
+	var manifest *file.RestoreManifest
+	if !cfg.SizeOnly && cfg.OutputStream == nil {
+		// Prepare the output directory, clearing it if requested and it's not empty; a resumed
+		// decode continues in the output directory of the interrupted one
+		if !cfg.Resume {
+			if err := file.PrepareOutputDirectory(ctx, cfg.OutputDir, cfg.ClearIfNotEmpty); err != nil {
 				return err
 			}
+		}
 
-			// First check if this directory contains a collection directly
-			// (it might be a directory containing a collection like '3A5')
-			if isValidCollectionDir(ctx, inputDir) {
-				// The directory itself is a valid collection
-				format, err := file.DetermineCollectionFormat(inputDir)
-				if err != nil {
-					log.Infof("Could not determine collection format for %s, skipping: %v", inputDir, err)
-					continue
-				}
-
-				collName := filepath.Base(inputDir)
-				if !file.IsCollectionName(collName) {
-					// If the directory name is not a valid collection name,
-					// try to find a valid collection inside by examining files
-					collName, err = determineCollectionNameFromContent(ctx, inputDir)
-					if err != nil {
-						log.Infof("Could not determine collection name for %s, skipping: %v", inputDir, err)
-						continue
-					}
-				}
-
-				collection := file.Collection{
-					Name:   collName,
-					Path:   inputDir,
-					Format: format,
-				}
-				allCollections = append(allCollections, collection)
-				log.Debugf("Found direct collection in %s, name=%s, format=%s", inputDir, collName, format)
-			} else {
-				// Check if the directory contains collections or zip files
-				collections, tempDir, err := file.FindCollections(ctx, inputDir)
-				if err != nil {
-					log.Infof("Failed to find collections in %s: %v", inputDir, err)
-					continue
-				}
-
-				// Add these collections to our master list
-				allCollections = append(allCollections, collections...)
+		// Record each file as it is restored, so that the decode can be resumed if it dies
+		if manifest, err = openRestoreManifest(ctx, cfg); err != nil {
+			return err
+		}
+		defer manifest.Close()
 
-				// Remember the tempDir for cleanup if it exists
-				if tempDir != "" && collTempDir == "" {
-					collTempDir = tempDir
-				}
+		// If the decode fails, is interrupted or times out from here on, roll back the
+		// partially restored files so that they can't be mistaken for a complete restore
+		defer func() {
+			rollBack(ctx, retErr, cfg.Resume, cfg.KeepPartial || cfg.Salvage, []string{cfg.OutputDir}, nil, cfg.Result)
+		}()
+	} else if cfg.SizeOnly {
+		log.Infof("Running in dry run mode - skipping output directory preparation")
+	}
 
-				log.Debugf("Found %d collections in directory %s", len(collections), inputDir)
-			}
-		}
+	// Locate the collections in the input directories
+	allCollections, collTempDir, err := findInputCollections(ctx, cfg.InputDir, cfg.InputDirs, cfg.SearchDepth)
+	if err != nil {
+		return err
 	}
 
 	// If we extracted zip files, clean up the temporary directory when done
@@ -888,30 +1992,151 @@ func DecodeDirectory(ctx context.Context, cfg DecodeConfig) error {
 		}()
 	}
 
-	// Ensure we found at least some collections
-	if len(allCollections) == 0 {
-		if len(cfg.InputDirs) <= 1 {
-			log.Error(fmt.Errorf("no collections found in input directory"))
-			return fmt.Errorf("no collections found in input directory")
-		} else {
-			log.Error(fmt.Errorf("no valid collections found in any of the input directories"))
-			return fmt.Errorf("no valid collections found in any of the input directories")
+	log.Debugf("Found total of %d collections", len(allCollections))
+
+	// A collection given twice, such as a directory and its TAR, is decoded once
+	allCollections, duplicates := dedupeCollections(ctx, allCollections, cfg.MetadataKey, cfg.Retry)
+	if cfg.Result != nil {
+		cfg.Result.Duplicates = duplicates
+	}
+
+	// Read PNG chunks the way the metadata says they were written. Without metadata, each
+	// chunk file is searched for its data.
+	for i, coll := range allCollections {
+		if coll.Format != FormatPNG {
+			continue
+		}
+		if md, err := file.ReadMetadata(ctx, coll, cfg.MetadataKey); err == nil {
+			allCollections[i].PNGEmbedding = md.PNGEmbedding
 		}
 	}
-	log.Debugf("Found total of %d collections", len(allCollections))
+
+	// Warn if the collections are overdue for review
+	CheckReviewDates(ctx, allCollections, cfg.MetadataKey, time.Now())
+
+	// Refuse collections written by a newer padlock before reading any chunks
+	if err := checkCollectionFormats(ctx, allCollections, cfg.MetadataKey); err != nil {
+		return err
+	}
+
+	// Check that the collections are from the same encode, agree with each other, and are
+	// enough to decode, before anything is decoded
+	if err := preflightDecode(ctx, allCollections, cfg.MetadataKey, cfg.Retry); err != nil {
+		return err
+	}
+
+	// The payload hash recorded at encode, to check the decoded stream against
+	expectedPayload, err := expectedPayloadHash(ctx, allCollections, cfg.MetadataKey)
+	if err != nil {
+		return err
+	}
+
+	// The envelope the data was encrypted in, if any, which needs the envelope key
+	envelope, err := collectionEnvelope(ctx, allCollections, cfg.MetadataKey, cfg.EnvelopeKey)
+	if err != nil {
+		return err
+	}
+
+	// A raw stream decodes back to its bytes, rather than to the files of a TAR; a hidden
+	// volume always holds a TAR
+	stream, streamCompressed, err := collectionStream(ctx, allCollections, cfg.MetadataKey)
+	if err != nil {
+		return err
+	}
+	if len(cfg.HiddenKey) > 0 {
+		stream = ""
+	}
+	if err := checkOutputStream(cfg, stream, collectionDedup(ctx, allCollections, cfg.MetadataKey)); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// Selected files are decoded from just the chunks that hold them, if the collections
+	// have a chunk index; otherwise every chunk is decoded, and the rest read past
+	var indexed *file.Metadata
+	if cfg.Filter != nil && !cfg.SizeOnly && !cfg.Salvage && len(cfg.HiddenKey) == 0 {
+		if indexed = collectionIndex(ctx, allCollections, cfg.MetadataKey); indexed == nil {
+			log.Infof("The collections have no chunk index, so every chunk is decoded to restore the selected files")
+		}
+	}
+
+	// Refuse to start if decoding would exceed the memory limit, if one was set
+	if err := checkDecodeMemory(ctx, allCollections, cfg.Pipeline); err != nil {
+		return err
+	}
+
+	// Fail now, rather than part way through, if the decoded data won't fit
+	if err := checkDecodeSpace(ctx, cfg, allCollections); err != nil {
+		return err
+	}
 
 	// Create collection readers for each collection
 	// These readers handle the format-specific details of reading chunks
 	readers := make([]io.Reader, len(allCollections))
 	collReaders := make([]*file.CollectionReader, len(allCollections))
 
+	// Authenticate every chunk as it is read, if asked to
+	var macs []*file.ChunkMACs
+	if len(cfg.MACKey) > 0 {
+		if macs, err = readCollectionMACs(ctx, allCollections, cfg.MACKey); err != nil {
+			return err
+		}
+		log.Infof("Authenticating the chunks of %d collections with their MACs", len(allCollections))
+	}
+
+	// Collections with appended data are decoded a payload at a time, each from its own chunks
+	if segmented := collectionSegments(ctx, allCollections, cfg.MetadataKey); segmented != nil && indexed == nil {
+		p, err := decodeSegments(ctx, cfg, allCollections, segmented, macs, manifest, counter)
+		if err != nil {
+			return err
+		}
+		if manifest != nil {
+			if err := manifest.Remove(); err != nil {
+				log.Error(err)
+				return err
+			}
+		}
+		if cfg.Result != nil {
+			cfg.Result.setDecodeCollections(allCollections, p, counter, nil)
+		}
+		log.Infof("Decode complete (%s)", time.Since(start))
+		return nil
+	}
+
+	if indexed != nil {
+		p, err := decodeIndexed(ctx, cfg, allCollections, indexed, macs, manifest, counter)
+		if err != nil {
+			return err
+		}
+		if manifest != nil {
+			if err := manifest.Remove(); err != nil {
+				log.Error(err)
+				return err
+			}
+		}
+		if cfg.Result != nil {
+			cfg.Result.setDecodeCollections(allCollections, p, counter, nil)
+		}
+		log.Infof("Decode complete (%s)", time.Since(start))
+		return nil
+	}
+
 	for i, coll := range allCollections {
 		collReader := file.NewCollectionReader(coll)
+		collReader.Retry = cfg.Retry
+		if macs != nil {
+			collReader.MACs = macs[i]
+		}
 		collReaders[i] = collReader
 
-		// Create an adapter that converts the CollectionReader to an io.Reader
-		// This adapter handles the details of reading chunks sequentially
-		readers[i] = file.NewChunkReaderAdapter(ctx, collReader)
+		// Read upcoming chunks of every collection in parallel, so that reading and extracting
+		// them overlaps with decoding and slow media don't stall the decoder
+		prefetcher, err := file.NewPrefetchReader(ctx, coll.Name, collReader, cfg.Pipeline.prefetchDepth(), cfg.Pipeline.PrefetchDir)
+		if err != nil {
+			return err
+		}
+		defer prefetcher.Close()
+		readers[i] = prefetcher
 	}
 
 	// Get the number of available collections (important for pad initialization)
@@ -927,6 +2152,7 @@ func DecodeDirectory(ctx context.Context, cfg DecodeConfig) error {
 		log.Error(fmt.Errorf("failed to create pad instance: %w", err))
 		return err
 	}
+	p.Aliases = metadataAliases(ctx, allCollections, cfg.MetadataKey)
 
 	// Initialize size tracker if we're in size-only mode
 	var sizeTracker *SizeTracker
@@ -944,7 +2170,7 @@ func DecodeDirectory(ctx context.Context, cfg DecodeConfig) error {
 	// Create a pipe for transferring decoded data between goroutines
 	// This allows parallel processing of decoding and deserialization
 	log.Debugf("Creating pipe for decoded data")
-	pr, pw := io.Pipe()
+	pr, pw := file.NewPipe(cfg.Pipeline.PipeBufferSize)
 
 	// Channel to signal completion of the deserialization goroutine
 	done := make(chan struct{})
@@ -958,13 +2184,52 @@ func DecodeDirectory(ctx context.Context, cfg DecodeConfig) error {
 
 		deserializeCtx := trace.WithContext(ctx, log.WithPrefix("deserialize"))
 
+		// Remove any passphrase mask, failing the decode if the passphrase is missing or wrong
+		outputStream, err := file.UnmaskStream(deserializeCtx, pr, cfg.Passphrase)
+		if err != nil {
+			log.Error(err)
+			deserializeErr = err
+			pr.CloseWithError(err)
+			return
+		}
+
+		// Decrypt the envelope, which fails at the first segment that was modified
+		if envelope != nil {
+			if outputStream, err = file.DecryptStream(deserializeCtx, outputStream, envelope, cfg.EnvelopeKey); err != nil {
+				log.Error(err)
+				deserializeErr = err
+				pr.CloseWithError(err)
+				return
+			}
+		}
+
+		// Trim any padding, which records the true length of the data, or decode the hidden
+		// volume in it instead
+		if len(cfg.HiddenKey) > 0 {
+			outputStream, err = file.RevealHidden(deserializeCtx, outputStream, cfg.HiddenKey)
+		} else {
+			outputStream, err = file.UnpadStream(deserializeCtx, outputStream)
+		}
+		if err != nil {
+			log.Error(err)
+			deserializeErr = err
+			pr.CloseWithError(err)
+			return
+		}
+		unpadded := outputStream
+
 		// Create decompression stream if needed
 		// This reverses any compression applied during encoding
-		var outputStream io.Reader = pr
-		if cfg.Compression == CompressionGzip {
+		decompress := cfg.Compression.effective() != CompressionNone
+		if stream != "" {
+			decompress = streamCompressed
+		} else if cfg.OutputTar && cfg.KeepCompressed {
+			decompress = false
+		}
+		if decompress {
 			log.Debugf("Creating decompression stream")
 			var err error
-			outputStream, err = file.DecompressStreamToStream(deserializeCtx, pr)
+			outputStream, err = file.DecompressStreamToStream(deserializeCtx, outputStream)
 			if err != nil {
 				log.Error(fmt.Errorf("failed to create decompression stream: %w", err))
 				deserializeErr = err
@@ -972,6 +2237,18 @@ func DecodeDirectory(ctx context.Context, cfg DecodeConfig) error {
 			}
 		}
 
+		// Rebuild a deduplicated TAR from its blocks, unless it is written as it was encoded
+		if stream == "" && !(cfg.OutputTar && cfg.KeepCompressed) {
+			undeduped, err := file.UndedupStream(deserializeCtx, outputStream)
+			if err != nil {
+				log.Error(err)
+				deserializeErr = err
+				return
+			}
+			defer undeduped.Close()
+			outputStream = undeduped
+		}
+
 		// Deserialize the tar stream to the output directory
 		// This reconstructs the original directory structure and files
 		log.Debugf("Deserializing to output directory: %s", cfg.OutputDir)
@@ -992,15 +2269,25 @@ func DecodeDirectory(ctx context.Context, cfg DecodeConfig) error {
 			}
 		} else {
 			// Normal processing mode - actually deserialize to disk
-			err := file.DeserializeDirectoryFromStream(deserializeCtx, cfg.OutputDir, outputStream, cfg.ClearIfNotEmpty)
+			// The output directory was prepared above, and now holds the restore manifest
+			if stream != "" {
+				err = restoreStream(deserializeCtx, cfg, stream, outputStream)
+			} else if cfg.OutputTar {
+				err = writeTarStream(deserializeCtx, cfg, outputStream)
+			} else {
+				err = file.DeserializeDirectoryWithFilter(deserializeCtx, cfg.OutputDir, outputStream, false, manifest, cfg.Filter)
+			}
 			if err != nil {
-				// Special case: Don't treat "too small" tar file as an error for small inputs
-				if strings.Contains(err.Error(), "too small to be a valid tar file") {
-					log.Infof("Input data appears to be a small raw file rather than a tar archive")
-				} else {
-					log.Error(fmt.Errorf("failed to deserialize directory: %w", err))
-					deserializeErr = err
-				}
+				log.Error(fmt.Errorf("failed to deserialize directory: %w", err))
+				deserializeErr = err
+				return
+			}
+
+			// A TAR stream ends before the data it was padded with, so read the rest, which
+			// checks the recorded length and keeps the decoder from writing to a closed pipe
+			if _, err := io.Copy(io.Discard, unpadded); err != nil {
+				log.Error(err)
+				deserializeErr = err
 			}
 		}
 	}()
@@ -1017,26 +2304,54 @@ func DecodeDirectory(ctx context.Context, cfg DecodeConfig) error {
 	// Decode the collections
 	// This combines the chunks from different collections using the threshold scheme
 	// The result is written to the pipe writer (pw)
-	err = p.Decode(ctx, readers, pw)
+	payloadHash := sha256.New()
+	var decodeOutput io.Writer = io.MultiWriter(pw, payloadHash)
+	if counter != nil {
+		decodeOutput = counter.wrapOutput(decodeOutput)
+	}
+	err = p.Decode(ctx, readers, decodeOutput)
 	if err != nil {
-		// Enhanced error handling for the unexpected EOF error
-		if err == io.ErrUnexpectedEOF || err.Error() == "unexpected EOF" {
-			log.Error(fmt.Errorf("decode failed with unexpected EOF - this is typically caused by corrupt PNG files or incomplete collections: %w", err))
+		// Stop the deserialization goroutine, which would otherwise wait for more data
+		pw.CloseWithError(err)
+
+		// Say which collection, chunk, and file failed, and what to restore
+		if !interrupted(ctx, err) {
+			findings := diagnoseDecode(ctx, allCollections, p, cfg.MetadataKey)
+			if cfg.Result != nil {
+				cfg.Result.Diagnosis = findings
+			}
+		}
 
-			// Provide more detailed troubleshooting information
-			log.Infof("Troubleshooting suggestions:")
-			log.Infof("1. Ensure all collection files are intact and not corrupted")
-			log.Infof("2. Verify you have at least K complete collections out of the original N")
-			log.Infof("3. Check if all chunks in the collections have matching chunk numbers")
-			log.Infof("4. Try using a different combination of K collections if more are available")
+		// Keep the files restored before the chunk that couldn't be decoded, if asked to
+		if cfg.Salvage && !interrupted(ctx, err) {
+			<-done
+			return salvageDecode(ctx, cfg, manifest, p.LostChunk, err, deserializeErr)
+		}
 
-			return fmt.Errorf("decode failed: unexpected EOF - one or more collections may be corrupt or incomplete: %w", err)
+		// Enhanced error handling for the unexpected EOF error
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			log.Error(fmt.Errorf("decode failed with unexpected EOF - this is typically caused by corrupt PNG files or incomplete collections: %w", err))
+			return fmt.Errorf("decode failed: unexpected EOF - one or more collections may be corrupt or incomplete: %w: %w", err, ErrCorruptChunk)
+		} else if errors.Is(err, ErrUnresolvedAlias) {
+			err = fmt.Errorf("decoding failed: only the metadata of a collection stored under a stealth name names it, so give the metadata key if it is sealed: %w", err)
+			log.Error(err)
+			return err
 		} else {
 			log.Error(fmt.Errorf("decoding failed: %w", err))
 			return fmt.Errorf("decoding failed: %w", err)
 		}
 	}
 
+	// Chunks that were bad in one collection were decoded from the others, but the
+	// collections holding them need attention before they are needed again
+	if len(p.BadShares) > 0 {
+		var names []string
+		for _, bad := range p.BadShares {
+			names = append(names, fmt.Sprintf("%s (chunk %d)", bad.Collection, bad.Chunk))
+		}
+		log.Infof("Decoded without the bad chunks of %s; verify those collections, and repair any that are damaged", strings.Join(names, ", "))
+	}
+
 	// Close the pipe writer to signal the end of data to the deserialization goroutine
 	err = pw.Close()
 	if err != nil {
@@ -1050,6 +2365,10 @@ func DecodeDirectory(ctx context.Context, cfg DecodeConfig) error {
 	select {
 	case <-done:
 		log.Debugf("Deserialization goroutine completed")
+	case <-ctx.Done():
+		pw.CloseWithError(ctx.Err())
+		log.Error(fmt.Errorf("decode interrupted while waiting for deserialization: %w", ctx.Err()))
+		return fmt.Errorf("decode interrupted while waiting for deserialization: %w", ctx.Err())
 	case <-time.After(timeoutDuration):
 		// Avoid panic on pipe error
 		pw.CloseWithError(fmt.Errorf("timeout waiting for deserialization to complete"))
@@ -1057,10 +2376,31 @@ func DecodeDirectory(ctx context.Context, cfg DecodeConfig) error {
 		return fmt.Errorf("timeout waiting for deserialization to complete after %v", timeoutDuration)
 	}
 
+	// A decoded payload that differs from the one encoded is reported as such, rather than by
+	// whatever error it causes in decompression or deserialization
+	if expectedPayload == "" {
+		log.Debugf("The collections record no payload hash, so the decoded data can't be checked against it")
+	} else if sum := hex.EncodeToString(payloadHash.Sum(nil)); sum != expectedPayload {
+		err := fmt.Errorf("decoded data has SHA-256 %s, but the collections were encoded from data with SHA-256 %s: %w", sum, expectedPayload, ErrChecksumMismatch)
+		log.Error(err)
+		return err
+	} else {
+		log.Infof("Decoded data matches the SHA-256 recorded when it was encoded")
+	}
+
 	// Check if there was an error in the deserialization
 	if deserializeErr != nil {
+		if cfg.Salvage && !interrupted(ctx, deserializeErr) {
+			return salvageDecode(ctx, cfg, manifest, 0, deserializeErr, deserializeErr)
+		}
 		return deserializeErr
 	}
+	if manifest != nil {
+		if err := manifest.Remove(); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
 
 	// Log completion information including elapsed time
 	elapsed := time.Since(start)
@@ -1099,37 +2439,50 @@ func DecodeDirectory(ctx context.Context, cfg DecodeConfig) error {
 			}
 		}
 
-		log.Infof("Total size of input collections:  %s bytes", FormatByteSize(totalInputSize))
+		log.Infof("Total size of input collections:  %s", FormatByteSize(totalInputSize))
 
 		// Report output size if available
 		if sizeTracker.DecodeOutputSize > 0 {
-			log.Infof("Decompressed output size:        %s bytes", FormatByteSize(sizeTracker.DecodeOutputSize))
+			log.Infof("Decompressed output size:        %s", FormatByteSize(sizeTracker.DecodeOutputSize))
 		}
 
 		// End the report with an asterisk line
 		log.Infof("***")
 	}
 
+	if cfg.Result != nil {
+		cfg.Result.setDecodeCollections(allCollections, p, counter, sizeTracker)
+	}
+
 	log.Infof("Decode complete (%s)", elapsed)
 	return nil
 }
 
 // VerifyCollectionIntegrity performs a verification pass on all collections to ensure data integrity
-// For PNG collections, this verifies each chunk's CRC to detect any corruption
+// For PNG, text, WAV, and bin collections, this verifies each chunk's CRC to detect any corruption
 func VerifyCollectionIntegrity(ctx context.Context, collections []file.Collection, format Format) error {
 	log := trace.FromContext(ctx).WithPrefix("verify")
 
-	// If not PNG format, verification is not needed
-	if format != FormatPNG {
-		log.Debugf("Verification only needed for PNG format, skipping for %s format", format)
+	// Bin chunks written before they carried a CRC pass as they are
+	extract, label, pattern := func(r io.Reader) ([]byte, error) { return file.ExtractPNGChunkData(r, "") }, "PNG", "IMG*.PNG"
+	switch format {
+	case FormatPNG:
+	case FormatText:
+		extract, label, pattern = file.ExtractDataFromText, "text", "*_*.txt"
+	case FormatWAV:
+		extract, label, pattern = file.ExtractDataFromWAV, "WAV", "REC*.WAV"
+	case FormatBin:
+		extract, label, pattern = file.ExtractDataFromBin, "bin", "*_*.bin"
+	default:
+		log.Debugf("No chunk CRCs to verify for %s format", format)
 		return nil
 	}
+	chunkExt := "." + string(format)
 
 	// Count of chunks verified across all collections
 	totalFiles := 0
 	totalVerified := 0
 	totalErrors := 0
-	dotPrinted := false
 
 	// Process each collection
 	for i, coll := range collections {
@@ -1142,75 +2495,63 @@ func VerifyCollectionIntegrity(ctx context.Context, collections []file.Collectio
 		collErrors := 0
 
 		// Handle different storage approaches
-		if strings.HasSuffix(coll.Path, ".tar") {
-			// For TAR files
-			collLog.Debugf("Collection is in TAR format, verifying: %s", coll.Path)
-
-			// Open the TAR file
-			tarFile, err := os.Open(coll.Path)
-			if err != nil {
-				collLog.Error(fmt.Errorf("failed to open TAR file: %w", err))
-				continue
+		if file.IsArchivePath(coll.Path) || len(coll.Volumes) > 0 {
+			// For TAR and ZIP files, and collections split into volumes of them
+			collLog.Debugf("Collection is an archive, verifying: %s", coll.Path)
+			archives := coll.Volumes
+			if len(archives) == 0 {
+				archives = []string{coll.Path}
 			}
-			defer tarFile.Close()
-
-			// Create TAR reader
-			tr := tar.NewReader(tarFile)
 
 			// Process each entry
-			for {
-				header, err := tr.Next()
-				if err == io.EOF {
-					break // End of archive
-				}
-				if err != nil {
-					collLog.Error(fmt.Errorf("error reading TAR header: %w", err))
-					totalErrors++
-					collErrors++
-					continue
-				}
+			for _, archive := range archives {
+				err := file.WalkArchive(archive, func(name string, r io.Reader) error {
+					// Skip if not a chunk file
+					if !strings.EqualFold(filepath.Ext(name), chunkExt) || filepath.Base(name) == file.RecoveryFileName {
+						return nil
+					}
 
-				// Skip if not a PNG file
-				if !strings.HasSuffix(strings.ToUpper(header.Name), ".PNG") {
-					continue
-				}
+					collFiles++
+					totalFiles++
 
-				collFiles++
-				totalFiles++
+					// Get the chunk number for better reporting
+					chunkNum := "?"
+					parts := strings.Split(strings.TrimSuffix(name, filepath.Ext(name)), "_")
+					if len(parts) >= 2 {
+						chunkNum = parts[1]
+					}
 
-				// Get the chunk number for better reporting
-				chunkNum := "?"
-				parts := strings.Split(strings.TrimSuffix(header.Name, ".PNG"), "_")
-				if len(parts) >= 2 {
-					chunkNum = parts[1]
-				}
+					// Read chunk data
+					var buf bytes.Buffer
+					if _, err := io.Copy(&buf, r); err != nil {
+						collLog.Error(fmt.Errorf("failed to read %s data from archive (chunk %s): %w", label, chunkNum, err))
+						totalErrors++
+						collErrors++
+						return nil
+					}
 
-				// Read PNG data
-				var buf bytes.Buffer
-				if _, err := io.Copy(&buf, tr); err != nil {
-					collLog.Error(fmt.Errorf("failed to read PNG data from TAR (chunk %s): %w", chunkNum, err))
-					totalErrors++
-					collErrors++
-					continue
-				}
+					// Try to extract data which verifies CRC
+					if _, err := extract(&buf); err != nil {
+						collLog.Error(fmt.Errorf("%s verification failed for chunk %s: %w", label, chunkNum, err))
+						totalErrors++
+						collErrors++
+						return nil
+					}
 
-				// Try to extract data which verifies CRC
-				_, err = file.ExtractDataFromPNG(&buf)
+					// Count successful verification
+					collVerified++
+					totalVerified++
+
+					// Progress goes to the log, since stdout may carry a JSON result
+					if collVerified%20 == 0 {
+						collLog.Debugf("Verified %d chunks so far", collVerified)
+					}
+					return nil
+				})
 				if err != nil {
-					collLog.Error(fmt.Errorf("PNG verification failed for chunk %s: %w", chunkNum, err))
+					collLog.Error(fmt.Errorf("error reading archive %s: %w", archive, err))
 					totalErrors++
 					collErrors++
-					continue
-				}
-
-				// Count successful verification
-				collVerified++
-				totalVerified++
-
-				// Progress indicator (using dots for conciseness)
-				if collVerified%20 == 0 {
-					dotPrinted = true
-					fmt.Printf(".")
 				}
 			}
 
@@ -1218,26 +2559,25 @@ func VerifyCollectionIntegrity(ctx context.Context, collections []file.Collectio
 			// For directory-based collections
 			collLog.Debugf("Collection is directory-based, verifying: %s", coll.Path)
 
-			// Find all PNG files
-			pngPattern := filepath.Join(coll.Path, "IMG*.PNG")
-			pngFiles, err := filepath.Glob(pngPattern)
+			// Find all chunk files
+			chunkFiles, err := filepath.Glob(filepath.Join(coll.Path, pattern))
 			if err != nil {
-				collLog.Error(fmt.Errorf("failed to find PNG files: %w", err))
+				collLog.Error(fmt.Errorf("failed to find %s files: %w", label, err))
 				continue
 			}
 
-			collFiles = len(pngFiles)
+			collFiles = len(chunkFiles)
 			totalFiles += collFiles
 
 			// Check each file
-			for _, filePath := range pngFiles {
+			for _, filePath := range chunkFiles {
 				// Get filename for reporting
 				fileName := filepath.Base(filePath)
 
 				// Open the file
 				f, err := os.Open(filePath)
 				if err != nil {
-					collLog.Error(fmt.Errorf("failed to open PNG file %s: %w", fileName, err))
+					collLog.Error(fmt.Errorf("failed to open %s file %s: %w", label, fileName, err))
 					totalErrors++
 					collErrors++
 					continue
@@ -1248,7 +2588,7 @@ func VerifyCollectionIntegrity(ctx context.Context, collections []file.Collectio
 				f.Close() // Close immediately after reading
 
 				if err != nil {
-					collLog.Error(fmt.Errorf("failed to read PNG file %s: %w", fileName, err))
+					collLog.Error(fmt.Errorf("failed to read %s file %s: %w", label, fileName, err))
 					totalErrors++
 					collErrors++
 					continue
@@ -1256,10 +2596,10 @@ func VerifyCollectionIntegrity(ctx context.Context, collections []file.Collectio
 
 				// Try to extract data which verifies CRC
 				buf := bytes.NewBuffer(fileData)
-				_, err = file.ExtractDataFromPNG(buf)
+				_, err = extract(buf)
 
 				if err != nil {
-					collLog.Error(fmt.Errorf("PNG verification failed for %s: %w", fileName, err))
+					collLog.Error(fmt.Errorf("%s verification failed for %s: %w", label, fileName, err))
 					totalErrors++
 					collErrors++
 					continue
@@ -1269,19 +2609,15 @@ func VerifyCollectionIntegrity(ctx context.Context, collections []file.Collectio
 				collVerified++
 				totalVerified++
 
-				// Progress indicator (using dots for conciseness)
+				// Progress goes to the log, since stdout may carry a JSON result
 				if collVerified%20 == 0 {
-					dotPrinted = true
-					fmt.Printf(".")
+					collLog.Debugf("Verified %d of %d chunks", collVerified, collFiles)
 				}
 
 			}
 		}
 
 		// Report collection results
-		if dotPrinted {
-			fmt.Printf("\n") // Newline after progress dots
-		}
 		if collErrors > 0 {
 			collLog.Infof("Verified %d/%d files - found %d errors", collVerified, collFiles, collErrors)
 		} else if collVerified > 0 {
@@ -1294,7 +2630,7 @@ func VerifyCollectionIntegrity(ctx context.Context, collections []file.Collectio
 	// Report overall results
 	if totalErrors > 0 {
 		log.Infof("Verification complete: %d/%d files verified, %d errors detected", totalVerified, totalFiles, totalErrors)
-		return fmt.Errorf("PNG verification found %d integrity errors in %d files", totalErrors, totalFiles)
+		return fmt.Errorf("%s verification found %d integrity errors in %d files", label, totalErrors, totalFiles)
 	} else if totalVerified > 0 {
 		log.Infof("Verification complete: All %d files passed integrity checks", totalVerified)
 		return nil
@@ -1304,16 +2640,61 @@ func VerifyCollectionIntegrity(ctx context.Context, collections []file.Collectio
 	}
 }
 
+// VerifyChecksumSidecars checks every chunk file in directory-based collections against its
+// .sha256 sidecar. Chunk files without a sidecar, and TAR-based collections, are skipped.
+func VerifyChecksumSidecars(ctx context.Context, collections []file.Collection) error {
+	log := trace.FromContext(ctx).WithPrefix("verify")
+
+	totalVerified := 0
+	totalErrors := 0
+
+	for _, coll := range collections {
+		if file.IsArchivePath(coll.Path) || len(coll.Volumes) > 0 {
+			log.Debugf("Skipping checksum sidecars for archive collection %s", coll.Name)
+			continue
+		}
+
+		entries, err := os.ReadDir(coll.Path)
+		if err != nil {
+			log.Error(fmt.Errorf("failed to read collection directory %s: %w", coll.Path, err))
+			totalErrors++
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasSuffix(entry.Name(), file.ChecksumSidecarExt) {
+				continue
+			}
+			found, err := file.VerifyChecksumSidecar(ctx, filepath.Join(coll.Path, entry.Name()))
+			if err != nil {
+				log.Error(fmt.Errorf("collection %s: %w", coll.Name, err))
+				totalErrors++
+				continue
+			}
+			if found {
+				totalVerified++
+			}
+		}
+	}
+
+	if totalErrors > 0 {
+		log.Infof("Checksum verification: %d files verified, %d errors detected", totalVerified, totalErrors)
+		return fmt.Errorf("checksum verification found %d errors: %w", totalErrors, ErrChecksumMismatch)
+	}
+	log.Infof("Checksum verification: all %d files with sidecars matched", totalVerified)
+	return nil
+}
+
 // getTimeoutDuration returns an appropriate timeout duration based on the execution environment
 // In test environments, it returns a shorter timeout (3 seconds)
 // In production environments, it returns a longer timeout (30 seconds)
 func getTimeoutDuration(ctx context.Context) time.Duration {
 	// Default timeout for production environments
 	timeoutDuration := 30 * time.Second
-	
+
 	// Check if we're in a test environment
 	isTestEnv := os.Getenv("GO_TEST") != ""
-	
+
 	// Also check if the context contains a tracer with a TEST prefix
 	if !isTestEnv && ctx.Value(trace.TracerKey{}) != nil {
 		tracer, ok := ctx.Value(trace.TracerKey{}).(*trace.Tracer)
@@ -1321,11 +2702,11 @@ func getTimeoutDuration(ctx context.Context) time.Duration {
 			isTestEnv = strings.Contains(tracer.GetPrefix(), "TEST")
 		}
 	}
-	
+
 	// Use shorter timeout for test environments
 	if isTestEnv {
 		timeoutDuration = 3 * time.Second
 	}
-	
+
 	return timeoutDuration
 }
@@ -4,11 +4,15 @@ package padlock
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/blues/padlock/pkg/file"
 	"github.com/blues/padlock/pkg/pad"
 	"github.com/blues/padlock/pkg/trace"
 )
@@ -133,7 +137,864 @@ func TestEncodeOnly(t *testing.T) {
 	t.Logf("Encode test completed successfully")
 }
 
+func TestStealthNamesRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-stealth-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	encodeDir := filepath.Join(tempDir, "encoded")
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	testContent := strings.Repeat("stealth test content ", 50)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(testContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	err = EncodeDirectory(ctx, EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          encodeDir,
+		N:                  4,
+		K:                  2,
+		Format:             FormatBin,
+		ChunkSize:          256,
+		RNG:                pad.NewDefaultRand(ctx),
+		Compression:        CompressionGzip,
+		ArchiveCollections: true,
+		StealthNames:       true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	entries, err := os.ReadDir(encodeDir)
+	if err != nil {
+		t.Fatalf("Failed to read encoded collections: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 collections, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if !file.IsStealthName(strings.TrimSuffix(entry.Name(), ".tar")) {
+			t.Errorf("Collection %s is not stored under a stealth name", entry.Name())
+		}
+	}
+
+	err = DecodeDirectory(ctx, DecodeConfig{
+		InputDir:    encodeDir,
+		OutputDir:   decodeDir,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+	})
+	if err != nil {
+		t.Fatalf("Failed to decode directory: %v", err)
+	}
+	decoded, err := os.ReadFile(filepath.Join(decodeDir, "test.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read decoded file: %v", err)
+	}
+	if string(decoded) != testContent {
+		t.Errorf("Decoded content does not match the original")
+	}
+}
+
+func TestZipArchiveRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-zip-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	encodeDir := filepath.Join(tempDir, "encoded")
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	testContent := strings.Repeat("zip test content ", 50)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(testContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	err = EncodeDirectory(ctx, EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          encodeDir,
+		N:                  3,
+		K:                  2,
+		Format:             FormatPNG,
+		ChunkSize:          256,
+		RNG:                pad.NewDefaultRand(ctx),
+		Compression:        CompressionGzip,
+		ArchiveCollections: true,
+		ArchiveFormat:      ArchiveZip,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	for _, name := range []string{"2A3.zip", "2B3.zip", "2C3.zip"} {
+		coll := file.Collection{Name: strings.TrimSuffix(name, ".zip"), Path: filepath.Join(encodeDir, name)}
+		md, err := file.ReadMetadata(ctx, coll, nil)
+		if err != nil {
+			t.Fatalf("Failed to read metadata from %s: %v", name, err)
+		}
+		if md.Collection != coll.Name {
+			t.Errorf("Metadata in %s is for collection %s", name, md.Collection)
+		}
+	}
+
+	// Any two of the three ZIP files reconstruct the data
+	if err := os.Remove(filepath.Join(encodeDir, "2B3.zip")); err != nil {
+		t.Fatalf("Failed to remove collection: %v", err)
+	}
+	err = DecodeDirectory(ctx, DecodeConfig{
+		InputDir:    encodeDir,
+		OutputDir:   decodeDir,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+	})
+	if err != nil {
+		t.Fatalf("Failed to decode directory: %v", err)
+	}
+	decoded, err := os.ReadFile(filepath.Join(decodeDir, "test.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read decoded file: %v", err)
+	}
+	if string(decoded) != testContent {
+		t.Errorf("Decoded content does not match the original")
+	}
+}
+
+func TestConcurrentArchiveEncodes(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-concurrent-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	testContent := strings.Repeat("concurrent test content ", 500)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(testContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Several encodes in one process write archives with the same collection names, and one
+	// of them fails part way through; the others must still finalize their own archives
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	const encodes = 4
+	errs := make([]error, encodes)
+	var wg sync.WaitGroup
+	for i := 0; i < encodes; i++ {
+		var rng pad.RNG = pad.NewDefaultRand(ctx)
+		if i == 0 {
+			rng = &failingRNG{RNG: rng, reads: 10}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = EncodeDirectory(ctx, EncodeConfig{
+				InputDir:           inputDir,
+				OutputDir:          filepath.Join(tempDir, fmt.Sprintf("encoded-%d", i)),
+				N:                  3,
+				K:                  2,
+				Format:             FormatBin,
+				ChunkSize:          256,
+				RNG:                rng,
+				Compression:        CompressionNone,
+				ArchiveCollections: true,
+			})
+		}()
+	}
+	wg.Wait()
+
+	if errs[0] == nil {
+		t.Errorf("Expected the encode with a failing entropy source to fail")
+	}
+	for i := 1; i < encodes; i++ {
+		if errs[i] != nil {
+			t.Fatalf("Encode %d failed: %v", i, errs[i])
+		}
+		encodeDir := filepath.Join(tempDir, fmt.Sprintf("encoded-%d", i))
+		decodeDir := filepath.Join(tempDir, fmt.Sprintf("decoded-%d", i))
+		if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputDir: decodeDir}); err != nil {
+			t.Fatalf("Failed to decode encode %d: %v", i, err)
+		}
+		decoded, err := os.ReadFile(filepath.Join(decodeDir, "test.txt"))
+		if err != nil || string(decoded) != testContent {
+			t.Errorf("Decoded content of encode %d does not match the original: %v", i, err)
+		}
+	}
+}
+
+func TestVolumeSplitRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-volume-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	encodeDir := filepath.Join(tempDir, "encoded")
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	testContent := strings.Repeat("volume test content ", 10000)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.bin"), []byte(testContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	cfg := EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          encodeDir,
+		N:                  2,
+		K:                  2,
+		Format:             FormatBin,
+		ChunkSize:          16 * 1024,
+		RNG:                pad.NewDefaultRand(ctx),
+		Compression:        CompressionNone,
+		ArchiveCollections: true,
+		VolumeSize:         100 * 1024,
+	}
+
+	// Volumes only apply to archives
+	filesCfg := cfg
+	filesCfg.ArchiveCollections = false
+	if err := EncodeDirectory(ctx, filesCfg); err == nil {
+		t.Fatalf("Expected an error for a volume size in files mode")
+	}
+
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+	_, volumes, err := file.ReadVolumeManifest(filepath.Join(encodeDir, "2A2"+file.VolumeManifestSuffix))
+	if err != nil {
+		t.Fatalf("Failed to read volume manifest: %v", err)
+	}
+	if len(volumes) < 2 {
+		t.Fatalf("Expected the collection to be split into volumes, got %d", len(volumes))
+	}
+	for _, volume := range volumes {
+		info, err := os.Stat(volume)
+		if err != nil {
+			t.Fatalf("Missing volume: %v", err)
+		}
+		if info.Size() > cfg.VolumeSize {
+			t.Errorf("Volume %s is %d bytes, larger than %d", volume, info.Size(), cfg.VolumeSize)
+		}
+	}
+
+	err = DecodeDirectory(ctx, DecodeConfig{
+		InputDir:  encodeDir,
+		OutputDir: decodeDir,
+		RNG:       pad.NewDefaultRand(ctx),
+	})
+	if err != nil {
+		t.Fatalf("Failed to decode directory: %v", err)
+	}
+	decoded, err := os.ReadFile(filepath.Join(decodeDir, "test.bin"))
+	if err != nil {
+		t.Fatalf("Failed to read decoded file: %v", err)
+	}
+	if string(decoded) != testContent {
+		t.Errorf("Decoded content does not match the original")
+	}
+}
+
+func TestTextFormatRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-text-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	encodeDir := filepath.Join(tempDir, "encoded")
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	testContent := strings.Repeat("text test content ", 50)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(testContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	err = EncodeDirectory(ctx, EncodeConfig{
+		InputDir:    inputDir,
+		OutputDir:   encodeDir,
+		N:           3,
+		K:           2,
+		Format:      FormatText,
+		ChunkSize:   256,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	chunkFiles, err := filepath.Glob(filepath.Join(encodeDir, "2A3", "2A3_*.txt"))
+	if err != nil || len(chunkFiles) == 0 {
+		t.Fatalf("No text chunk files written for collection 2A3")
+	}
+	chunk, err := os.ReadFile(chunkFiles[0])
+	if err != nil {
+		t.Fatalf("Failed to read chunk file: %v", err)
+	}
+	if !strings.HasPrefix(string(chunk), "-----BEGIN PADLOCK CHUNK-----\nCollection: 2A3\n") {
+		t.Errorf("Chunk file does not start with the armor header: %.60q", chunk)
+	}
+
+	collections, _, err := file.FindCollections(ctx, encodeDir)
+	if err != nil {
+		t.Fatalf("Failed to find collections: %v", err)
+	}
+	if err := VerifyCollectionIntegrity(ctx, collections, FormatText); err != nil {
+		t.Errorf("Verification failed: %v", err)
+	}
+
+	// Any two of the three collections reconstruct the data
+	if err := os.RemoveAll(filepath.Join(encodeDir, "2B3")); err != nil {
+		t.Fatalf("Failed to remove collection: %v", err)
+	}
+	err = DecodeDirectory(ctx, DecodeConfig{
+		InputDir:    encodeDir,
+		OutputDir:   decodeDir,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+	})
+	if err != nil {
+		t.Fatalf("Failed to decode directory: %v", err)
+	}
+	decoded, err := os.ReadFile(filepath.Join(decodeDir, "test.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read decoded file: %v", err)
+	}
+	if string(decoded) != testContent {
+		t.Errorf("Decoded content does not match the original")
+	}
+}
+
+func TestShamirRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	encodeDir := filepath.Join(tempDir, "encoded")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	testContent := strings.Repeat("shamir test content ", 200)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(testContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	var result Result
+	err := EncodeDirectory(ctx, EncodeConfig{
+		InputDir:    inputDir,
+		OutputDir:   encodeDir,
+		N:           5,
+		K:           3,
+		Sharing:     pad.Shamir,
+		Format:      FormatBin,
+		ChunkSize:   1024,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionNone,
+		Result:      &result,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	// Each collection holds the input once, where OTP would hold it once per permutation
+	if otp, _ := EstimateScheme(Scheme{K: 3, N: 5}, 1024, result.InputBytes); result.Sharing != "shamir" || result.OutputBytes*4 > otp.TotalSize {
+		t.Errorf("Shamir collections total %d bytes, not far less than the %d OTP would need", result.OutputBytes, otp.TotalSize)
+	}
+	md, err := file.ReadMetadata(ctx, file.Collection{Name: "3A5", Path: filepath.Join(encodeDir, "3A5")}, nil)
+	if err != nil || md.Sharing != "shamir" {
+		t.Errorf("Expected the metadata to record Shamir sharing: %+v, %v", md, err)
+	}
+
+	// Any three of the five collections reconstruct the data, and regenerate the others
+	for _, lost := range []string{"3B5", "3D5"} {
+		if err := os.Rename(filepath.Join(encodeDir, lost), filepath.Join(tempDir, lost)); err != nil {
+			t.Fatalf("Failed to remove collection: %v", err)
+		}
+	}
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputDir: decodeDir, Compression: CompressionNone}); err != nil {
+		t.Fatalf("Failed to decode directory: %v", err)
+	}
+	decoded, err := os.ReadFile(filepath.Join(decodeDir, "test.txt"))
+	if err != nil || string(decoded) != testContent {
+		t.Errorf("Decoded content does not match the original (%v)", err)
+	}
+
+	repairDir := filepath.Join(tempDir, "repaired")
+	coll, err := RepairCollection(ctx, RepairConfig{InputDirs: []string{encodeDir}, OutputDir: repairDir, Collection: "3D5"})
+	if err != nil {
+		t.Fatalf("Failed to repair collection 3D5: %v", err)
+	}
+	chunks, _ := filepath.Glob(filepath.Join(tempDir, "3D5", "3D5_*.bin"))
+	for _, chunk := range chunks {
+		want, _ := os.ReadFile(chunk)
+		got, err := os.ReadFile(filepath.Join(coll.Path, filepath.Base(chunk)))
+		if err != nil || string(got) != string(want) {
+			t.Errorf("Repaired chunk %s does not match the lost one (%v)", filepath.Base(chunk), err)
+		}
+	}
+	if len(chunks) == 0 {
+		t.Errorf("No chunks found in the lost collection")
+	}
+}
+
+func TestWAVFormatVerifyAndDecode(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-wav-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	encodeDir := filepath.Join(tempDir, "encoded")
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	testContent := strings.Repeat("wav test content ", 50)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(testContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	err = EncodeDirectory(ctx, EncodeConfig{
+		InputDir:    inputDir,
+		OutputDir:   encodeDir,
+		N:           3,
+		K:           2,
+		Format:      FormatWAV,
+		ChunkSize:   256,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	collections, _, err := file.FindCollections(ctx, encodeDir)
+	if err != nil {
+		t.Fatalf("Failed to find collections: %v", err)
+	}
+	if err := VerifyCollectionIntegrity(ctx, collections, FormatWAV); err != nil {
+		t.Errorf("Verification failed: %v", err)
+	}
+
+	// Corrupt a byte of chunk data in one collection, which verification must catch
+	chunkPath := filepath.Join(encodeDir, "2B3", "REC2B3_0001.WAV")
+	wav, err := os.ReadFile(chunkPath)
+	if err != nil {
+		t.Fatalf("Failed to read chunk file: %v", err)
+	}
+	wav[12+24+8+10] ^= 0xFF
+	if err := os.WriteFile(chunkPath, wav, 0644); err != nil {
+		t.Fatalf("Failed to write chunk file: %v", err)
+	}
+	if err := VerifyCollectionIntegrity(ctx, collections, FormatWAV); err == nil {
+		t.Errorf("Verification did not detect the corrupted WAV chunk")
+	}
+
+	// The two undamaged collections reconstruct the data
+	if err := os.RemoveAll(filepath.Join(encodeDir, "2B3")); err != nil {
+		t.Fatalf("Failed to remove collection: %v", err)
+	}
+	err = DecodeDirectory(ctx, DecodeConfig{
+		InputDir:    encodeDir,
+		OutputDir:   decodeDir,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+	})
+	if err != nil {
+		t.Fatalf("Failed to decode directory: %v", err)
+	}
+	decoded, err := os.ReadFile(filepath.Join(decodeDir, "test.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read decoded file: %v", err)
+	}
+	if string(decoded) != testContent {
+		t.Errorf("Decoded content does not match the original")
+	}
+}
+
 func TestPartialDecoding(t *testing.T) {
 	// Skip this test for now while we focus on the basic round-trip test
 	t.Skip("Skipping partial decoding test to focus on basic functionality")
 }
+
+func TestDeadlineStopsEncodeAndDecode(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-deadline-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	outputDir := filepath.Join(tempDir, "output")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(strings.Repeat("deadline ", 1000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	cfg := EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          outputDir,
+		N:                  3,
+		K:                  2,
+		Format:             FormatBin,
+		ChunkSize:          256,
+		RNG:                pad.NewDefaultRand(ctx),
+		ClearIfNotEmpty:    true,
+		Compression:        CompressionGzip,
+		ArchiveCollections: true,
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	// An expired deadline stops both operations with the context's error
+	expired, cancel := context.WithTimeout(ctx, 0)
+	defer cancel()
+
+	cfg.OutputDir = filepath.Join(tempDir, "output2")
+	if err := EncodeDirectory(expired, cfg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected encode to fail with context.DeadlineExceeded, got %v", err)
+	}
+
+	decodeCfg := DecodeConfig{
+		InputDir:        outputDir,
+		OutputDir:       filepath.Join(tempDir, "decoded"),
+		Compression:     CompressionGzip,
+		ClearIfNotEmpty: true,
+	}
+	if err := DecodeDirectory(expired, decodeCfg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected decode to fail with context.DeadlineExceeded, got %v", err)
+	}
+}
+
+// TestPassphraseRoundTrip encodes with a passphrase, and checks that decoding needs the
+// collections and the passphrase, and that reshare keeps it
+func TestPassphraseRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	encodeDir := filepath.Join(tempDir, "encoded")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	testContent := strings.Repeat("second factor ", 500)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(testContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	passphrase := []byte("correct horse battery staple")
+
+	err := EncodeDirectory(ctx, EncodeConfig{
+		InputDir:    inputDir,
+		OutputDir:   encodeDir,
+		N:           3,
+		K:           2,
+		Format:      FormatBin,
+		ChunkSize:   1024,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+		Passphrase:  passphrase,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	decode := func(name string, passphrase []byte) error {
+		decodeDir := filepath.Join(tempDir, name)
+		err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputDir: decodeDir, Compression: CompressionGzip, Passphrase: passphrase})
+		if err == nil {
+			if decoded, err := os.ReadFile(filepath.Join(decodeDir, "test.txt")); err != nil || string(decoded) != testContent {
+				t.Errorf("%s: decoded content does not match the original (%v)", name, err)
+			}
+		}
+		return err
+	}
+	if err := decode("decoded", passphrase); err != nil {
+		t.Fatalf("Failed to decode with the passphrase: %v", err)
+	}
+	if err := decode("missing", nil); !errors.Is(err, file.ErrPassphraseRequired) {
+		t.Errorf("Expected ErrPassphraseRequired without the passphrase, got %v", err)
+	}
+	if err := decode("wrong", []byte("wrong")); !errors.Is(err, file.ErrWrongPassphrase) {
+		t.Errorf("Expected ErrWrongPassphrase with the wrong passphrase, got %v", err)
+	}
+
+	// Re-sharing keeps the passphrase, without being given it
+	newDir := filepath.Join(tempDir, "reshared")
+	err = ReshareCollections(ctx, ReshareConfig{
+		InputDirs: []string{encodeDir},
+		Encode:    EncodeConfig{OutputDir: newDir, N: 2, K: 2, Format: FormatBin, ChunkSize: 1024, RNG: pad.NewDefaultRand(ctx)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to reshare: %v", err)
+	}
+	md, err := file.ReadMetadata(ctx, file.Collection{Name: "2A2", Path: filepath.Join(newDir, "2A2")}, nil)
+	if err != nil || md.Compression != "gzip" {
+		t.Errorf("Expected the reshared collections to keep gzip compression: %+v, %v", md, err)
+	}
+	err = DecodeDirectory(ctx, DecodeConfig{InputDir: newDir, OutputDir: filepath.Join(tempDir, "reshared-missing"), Compression: CompressionGzip})
+	if !errors.Is(err, file.ErrPassphraseRequired) {
+		t.Errorf("Expected the reshared collections to need the passphrase, got %v", err)
+	}
+	reshareDir := filepath.Join(tempDir, "reshared-decoded")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: newDir, OutputDir: reshareDir, Compression: CompressionGzip, Passphrase: passphrase}); err != nil {
+		t.Errorf("Failed to decode the reshared collections: %v", err)
+	}
+}
+
+// TestDecodeInputFiles checks that collection archives, and chunk files of several collections
+// mixed together in one directory, can be given to decode as inputs
+func TestDecodeInputFiles(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	content := []byte(strings.Repeat("loose ", 3000))
+	if err := os.WriteFile(filepath.Join(inputDir, "data.txt"), content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	encode := func(name string, archive bool) string {
+		outputDir := filepath.Join(tempDir, name)
+		err := EncodeDirectory(ctx, EncodeConfig{
+			InputDir:           inputDir,
+			OutputDir:          outputDir,
+			N:                  3,
+			K:                  2,
+			Format:             FormatBin,
+			ChunkSize:          1024,
+			RNG:                pad.NewDefaultRand(ctx),
+			Compression:        CompressionGzip,
+			ArchiveCollections: archive,
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		return outputDir
+	}
+	decode := func(name string, inputs ...string) {
+		t.Helper()
+		decodeDir := filepath.Join(tempDir, name)
+		if err := DecodeDirectory(ctx, DecodeConfig{InputDirs: inputs, OutputDir: decodeDir, Compression: CompressionGzip}); err != nil {
+			t.Fatalf("%s: failed to decode: %v", name, err)
+		}
+		if got, err := os.ReadFile(filepath.Join(decodeDir, "data.txt")); err != nil || string(got) != string(content) {
+			t.Errorf("%s: data.txt was not restored (%v)", name, err)
+		}
+	}
+
+	// Two collection TARs given as files
+	archived := encode("archived", true)
+	decode("from-tars", filepath.Join(archived, "2A3.tar"), filepath.Join(archived, "2C3.tar"))
+
+	// The chunks of two collections copied into one directory
+	loose := encode("loose", false)
+	mixed := filepath.Join(tempDir, "mixed")
+	if err := os.MkdirAll(mixed, 0755); err != nil {
+		t.Fatalf("Failed to create mixed dir: %v", err)
+	}
+	for _, coll := range []string{"2A3", "2B3"} {
+		chunks, _ := filepath.Glob(filepath.Join(loose, coll, "*.bin"))
+		for _, chunk := range chunks {
+			data, err := os.ReadFile(chunk)
+			if err != nil {
+				t.Fatalf("Failed to read chunk: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(mixed, filepath.Base(chunk)), data, 0644); err != nil {
+				t.Fatalf("Failed to copy chunk: %v", err)
+			}
+		}
+	}
+	decode("from-mixed", mixed)
+}
+
+// TestFilterRoundTrip checks that the entries a filter excludes are left out of an encode, and
+// that the rest decode unchanged
+func TestFilterRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	for name, content := range map[string]string{"keep.txt": "kept", "scratch.tmp": "temporary", "node_modules/dep/index.js": "dependency"} {
+		path := filepath.Join(inputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create input dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	filter, err := NewFilter([]string{"*.tmp", "node_modules/"}, nil)
+	if err != nil {
+		t.Fatalf("NewFilter failed: %v", err)
+	}
+	encodeDir := filepath.Join(tempDir, "encoded")
+	cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(encodeDir), WithFormat(FormatBin),
+		WithChunkSize(1024), WithRNG(pad.NewDefaultRand(ctx)), WithFilter(filter))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputDir: decodeDir, RNG: pad.NewDefaultRand(ctx)}); err != nil {
+		t.Fatalf("Failed to decode directory: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(decodeDir, "keep.txt")); err != nil || string(got) != "kept" {
+		t.Errorf("keep.txt was not restored (%v)", err)
+	}
+	for _, name := range []string{"scratch.tmp", "node_modules"} {
+		if _, err := os.Stat(filepath.Join(decodeDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be left out of the encode, got %v", name, err)
+		}
+	}
+}
+
+// TestMultipleInputsRoundTrip checks that several input directories encode into one set of
+// collections, and decode side by side under their names
+func TestMultipleInputsRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	photosDir := filepath.Join(tempDir, "home", "photos")
+	docsDir := filepath.Join(tempDir, "mnt", "docs")
+	for dir, name := range map[string]string{photosDir: "beach.jpg", docsDir: "tax.pdf"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create input dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Repeat(name, 100)), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	encodeDir := filepath.Join(tempDir, "encoded")
+	cfg, err := NewEncodeConfig(WithInput(photosDir, docsDir), WithOutputs(encodeDir), WithScheme(2, 3),
+		WithFormat(FormatBin), WithChunkSize(1024), WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directories: %v", err)
+	}
+
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputDir: decodeDir, RNG: pad.NewDefaultRand(ctx)}); err != nil {
+		t.Fatalf("Failed to decode directory: %v", err)
+	}
+	for _, name := range []string{"photos/beach.jpg", "docs/tax.pdf"} {
+		got, err := os.ReadFile(filepath.Join(decodeDir, filepath.FromSlash(name)))
+		if err != nil || string(got) != strings.Repeat(filepath.Base(name), 100) {
+			t.Errorf("%s was not restored (%v)", name, err)
+		}
+	}
+
+	cfg.InputDirs = []string{photosDir, filepath.Join(photosDir, "..", "photos")}
+	cfg.ClearIfNotEmpty = true
+	if err := EncodeDirectory(ctx, cfg); err == nil {
+		t.Errorf("Expected an input given twice to be refused")
+	}
+}
+
+// TestSingleFileRoundTrip checks that a regular file given as the input is encoded, and
+// restored by decode as that file in the output directory
+func TestSingleFileRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	imagePath := filepath.Join(tempDir, "disk.img")
+	content := strings.Repeat("disk image block ", 500)
+	if err := os.WriteFile(imagePath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	encodeDir := filepath.Join(tempDir, "encoded")
+	cfg, err := NewEncodeConfig(WithInput(imagePath), WithOutputs(encodeDir), WithScheme(2, 3),
+		WithFormat(FormatBin), WithChunkSize(1024), WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode file: %v", err)
+	}
+
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputDir: decodeDir, RNG: pad.NewDefaultRand(ctx)}); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	entries, err := os.ReadDir(decodeDir)
+	if err != nil || len(entries) != 1 || entries[0].Name() != "disk.img" {
+		t.Fatalf("Expected only disk.img to be restored, got %v (%v)", entries, err)
+	}
+	info, err := os.Stat(filepath.Join(decodeDir, "disk.img"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected disk.img to keep its permissions, got %v (%v)", info, err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(decodeDir, "disk.img")); string(got) != content {
+		t.Errorf("Decoded content does not match the original")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// The payload is the serialized and compressed stream that the chunks of a distribution
+// encode. Encode records its SHA-256 in the metadata of every collection once the whole
+// stream has been read, and decode hashes the stream it rebuilds and checks it against the
+// recorded one. A mismatch can only come from a bug in combining the chunks, or from chunks
+// that were damaged in a way no other check caught, so it is reported as an error rather
+// than leaving the output to be trusted.
+//
+// The hash is only recorded in sealed metadata. In the clear, it would let anyone holding a
+// single collection test guesses of the data against it, which fewer than K collections must
+// not allow, so collections whose metadata isn't sealed are decoded without the check.
+
+// recordPayload adds the payload hash, if the metadata is sealed, the number of chunks each
+// collection holds, and where the chunk index is, if the payload has one, to the metadata of
+// every collection. Directory collections have their metadata file
+// rewritten; archived collections, whose metadata was their first entry, get it again as
+// their last, which is the one read. metadata holds the metadata written when the encode
+// started, or is nil if it was resumed, in which case it is read back from the collection
+// directories.
+func recordPayload(ctx context.Context, cfg EncodeConfig, collections []file.Collection, metadata []*file.Metadata, sum string, chunks int, index *file.IndexLocation, tarWriters *file.TarWriterRegistry) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	for i, coll := range collections {
+		var md *file.Metadata
+		if metadata != nil {
+			md = metadata[i]
+		} else {
+			var err error
+			if md, err = file.ReadMetadata(ctx, coll, cfg.MetadataKey); err != nil {
+				log.Error(fmt.Errorf("failed to record the payload hash: %w", err))
+				return fmt.Errorf("failed to record the payload hash: %w", err)
+			}
+		}
+		if len(cfg.MetadataKey) > 0 {
+			md.PayloadSHA256 = sum
+		}
+		md.Chunks = chunks
+		md.Index = index
+		if err := storeCollectionMetadata(ctx, cfg, coll, md, tarWriters); err != nil {
+			return err
+		}
+	}
+
+	if len(cfg.MetadataKey) > 0 {
+		log.Debugf("Recorded payload SHA-256 %s and %d chunks in %d collections", sum, chunks, len(collections))
+	} else {
+		log.Debugf("Recorded %d chunks in %d collections; the payload hash is only recorded in sealed metadata", chunks, len(collections))
+	}
+	return nil
+}
+
+// expectedPayloadHash returns the payload hash recorded in the metadata of the collections,
+// or "" if none of them has one, because they were encoded before it was recorded, their
+// metadata isn't sealed, or it is sealed and no key was given. Collections that record different hashes were
+// encoded from different data and can't be decoded together.
+func expectedPayloadHash(ctx context.Context, collections []file.Collection, key []byte) (string, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	var sum, from string
+	for _, coll := range collections {
+		md, err := file.ReadMetadata(ctx, coll, key)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				log.Debugf("No payload hash from collection %s: %v", coll.DiskName(), err)
+			}
+			continue
+		}
+		if md.PayloadSHA256 == "" {
+			continue
+		}
+		if sum == "" {
+			sum, from = md.PayloadSHA256, coll.Name
+			continue
+		}
+		if md.PayloadSHA256 != sum {
+			err := fmt.Errorf("collections %s and %s were encoded from different data: %w", from, coll.Name, ErrMixedSessions)
+			log.Error(err)
+			return "", err
+		}
+	}
+	return sum, nil
+}
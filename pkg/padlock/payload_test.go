@@ -0,0 +1,119 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestPayloadHash checks that encode records the payload hash in the sealed metadata of every
+// collection, and never in metadata that isn't sealed, and that decode checks the decoded
+// data against it
+func TestPayloadHash(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "data.txt"), []byte(strings.Repeat("payload ", 2000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	key := []byte("metadata key")
+	for _, archive := range []bool{false, true} {
+		outputDir := filepath.Join(tempDir, "output", map[bool]string{false: "files", true: "tar"}[archive])
+		err := EncodeDirectory(ctx, EncodeConfig{
+			InputDir:           inputDir,
+			OutputDir:          outputDir,
+			N:                  3,
+			K:                  2,
+			Format:             FormatBin,
+			ChunkSize:          4096,
+			RNG:                pad.NewDefaultRand(ctx),
+			Compression:        CompressionGzip,
+			ArchiveCollections: archive,
+			MetadataKey:        key,
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+
+		// Every collection records the same hash; archives record it in their last metadata
+		var collections []file.Collection
+		for _, name := range []string{"2A3", "2B3", "2C3"} {
+			coll := file.Collection{Name: name, Path: filepath.Join(outputDir, name), Format: FormatBin}
+			if archive {
+				coll.Path += ".tar"
+			}
+			collections = append(collections, coll)
+		}
+		sum, err := expectedPayloadHash(ctx, collections, key)
+		if err != nil || len(sum) != 64 {
+			t.Fatalf("archive=%v: unexpected payload hash %q, %v", archive, sum, err)
+		}
+
+		if err := DecodeDirectory(ctx, DecodeConfig{InputDirs: []string{outputDir}, OutputDir: filepath.Join(tempDir, "decoded", filepath.Base(outputDir)),
+			Compression: CompressionGzip, MetadataKey: key}); err != nil {
+			t.Errorf("archive=%v: failed to decode: %v", archive, err)
+		}
+	}
+
+	// Metadata in the clear doesn't record the hash, which would let a single collection's
+	// holder test guesses of the data against it
+	clearDir := filepath.Join(tempDir, "output", "clear")
+	err := EncodeDirectory(ctx, EncodeConfig{InputDir: inputDir, OutputDir: clearDir, N: 3, K: 2, Format: FormatBin, ChunkSize: 4096,
+		RNG: pad.NewDefaultRand(ctx), Compression: CompressionGzip})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	md, err := file.ReadMetadata(ctx, file.Collection{Name: "2A3", Path: filepath.Join(clearDir, "2A3")}, nil)
+	if err != nil || md.PayloadSHA256 != "" || md.Chunks == 0 {
+		t.Errorf("Expected unsealed metadata to record the chunks but no payload hash, got %+v, %v", md, err)
+	}
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDirs: []string{clearDir}, OutputDir: filepath.Join(tempDir, "decoded", "clear"), Compression: CompressionGzip}); err != nil {
+		t.Errorf("Failed to decode collections without a payload hash: %v", err)
+	}
+
+	// Change the recorded hash in one directory collection, and then in all of them
+	outputDir := filepath.Join(tempDir, "output", "files")
+	setHash := func(name, sum string) {
+		coll := file.Collection{Name: name, Path: filepath.Join(outputDir, name)}
+		md, err := file.ReadMetadata(ctx, coll, key)
+		if err != nil {
+			t.Fatalf("Failed to read metadata: %v", err)
+		}
+		md.PayloadSHA256 = sum
+		sealed, err := file.SealMetadata(md, key)
+		if err != nil {
+			t.Fatalf("Failed to seal metadata: %v", err)
+		}
+		if err := file.WriteMetadata(ctx, coll.Path, sealed); err != nil {
+			t.Fatalf("Failed to write metadata: %v", err)
+		}
+	}
+	wrong := strings.Repeat("0", 64)
+	setHash("2B3", wrong)
+	err = DecodeDirectory(ctx, DecodeConfig{InputDirs: []string{outputDir}, OutputDir: filepath.Join(tempDir, "mixed"), Compression: CompressionGzip, MetadataKey: key})
+	if !errors.Is(err, ErrMixedSessions) {
+		t.Errorf("Expected ErrMixedSessions for collections with different hashes, got %v", err)
+	}
+	setHash("2A3", wrong)
+	setHash("2C3", wrong)
+	err = DecodeDirectory(ctx, DecodeConfig{InputDirs: []string{outputDir}, OutputDir: filepath.Join(tempDir, "mismatch"), Compression: CompressionGzip, MetadataKey: key})
+	if !errors.Is(err, ErrChecksumMismatch) || !strings.Contains(err.Error(), wrong) {
+		t.Errorf("Expected ErrChecksumMismatch for the wrong hash, got %v", err)
+	}
+}
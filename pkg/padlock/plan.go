@@ -0,0 +1,158 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// PlanRequest describes what a distribution must achieve, for RecommendScheme
+type PlanRequest struct {
+	SurviveLoss int   // Number of collections that may be lost while the data stays recoverable
+	Custodians  int   // Number of custodians available to hold one collection each (0 = no limit)
+	Budget      int64 // Storage available for all collections together, in bytes (0 = no limit)
+}
+
+// PlanCandidate is one scheme that survives the requested loss
+type PlanCandidate struct {
+	SchemeEstimate
+	FitsBudget bool // Whether the total size is within the budget
+}
+
+// Plan is the result of RecommendScheme: every candidate scheme with its storage estimate,
+// and the recommended scheme, format, and compression
+type Plan struct {
+	Request             PlanRequest
+	InputSize           int64           // Size of the serialized input
+	CompressedInputSize int64           // Size of the input after gzip compression
+	ChunkSize           int             // Chunk size the estimates are for
+	Compression         Compression     // Recommended compression
+	Format              Format          // Recommended format
+	Candidates          []PlanCandidate // Schemes surviving the loss, by increasing K
+	Recommended         int             // Index of the recommended candidate, or -1 if none fits the budget
+	Notes               []string        // Reasons for the recommendation
+}
+
+// RecommendScheme recommends K, N, format, and compression for encoding cfg.InputDir so that
+// the data survives the loss of req.SurviveLoss collections.
+//
+// Every scheme with N - K = SurviveLoss and N no more than the number of custodians is a
+// candidate. Larger K means more custodians must collude to reconstruct the data, but each
+// collection grows with the number of permutations it is part of, so the recommendation is the
+// candidate with the largest K whose total size fits the budget. The sizes are those a dry run
+// would report, from a single pass over the input.
+func RecommendScheme(ctx context.Context, cfg EncodeConfig, req PlanRequest) (*Plan, error) {
+	if req.SurviveLoss < 0 {
+		return nil, fmt.Errorf("the number of collections that may be lost cannot be negative")
+	}
+	maxN := 26
+	if req.Custodians > 0 {
+		maxN = min(maxN, req.Custodians)
+	}
+	if maxN < req.SurviveLoss+2 {
+		return nil, fmt.Errorf("surviving the loss of %d collections needs at least %d custodians, since at least 2 collections are always required",
+			req.SurviveLoss, req.SurviveLoss+2)
+	}
+
+	inputSize, compressedSize, err := measureInput(ctx, cfg.inputDirs(), cfg.Filter, CompressionGzip, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Request:             req,
+		InputSize:           inputSize,
+		CompressedInputSize: compressedSize,
+		ChunkSize:           cfg.ChunkSize,
+		Compression:         CompressionGzip,
+		Format:              FormatPNG,
+		Recommended:         -1,
+	}
+
+	// Compression only helps if the input isn't already compressed
+	encodedSize := compressedSize
+	if compressedSize >= inputSize {
+		plan.Compression = CompressionNone
+		encodedSize = inputSize
+		plan.Notes = append(plan.Notes, "The input does not compress, so compression is not recommended")
+	}
+
+	for k := 2; k+req.SurviveLoss <= maxN; k++ {
+		estimate, err := estimateScheme(cfg.sharing(), Scheme{K: k, N: k + req.SurviveLoss}, cfg.ChunkSize, encodedSize)
+		if err != nil {
+			// Larger schemes have more permutations than fit in a chunk
+			plan.Notes = append(plan.Notes, fmt.Sprintf("Schemes from %s up need a larger -chunk size", Scheme{K: k, N: k + req.SurviveLoss}))
+			break
+		}
+		fits := req.Budget == 0 || estimate.TotalSize <= req.Budget
+		plan.Candidates = append(plan.Candidates, PlanCandidate{SchemeEstimate: estimate, FitsBudget: fits})
+		if fits {
+			plan.Recommended = len(plan.Candidates) - 1
+		}
+	}
+	if len(plan.Candidates) == 0 {
+		return nil, fmt.Errorf("chunk size %d is too small for any scheme surviving the loss of %d collections", cfg.ChunkSize, req.SurviveLoss)
+	}
+
+	if plan.Recommended < 0 {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("No scheme fits the budget of %s; the smallest needs %s",
+			FormatByteSize(req.Budget), FormatByteSize(plan.Candidates[0].TotalSize)))
+		return plan, nil
+	}
+
+	rec := plan.Candidates[plan.Recommended]
+	plan.Notes = append(plan.Notes, fmt.Sprintf("Any %d collections reconstruct the data, and up to %d collections may be lost", rec.K, req.SurviveLoss))
+	if req.Custodians > rec.N {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("%d of the %d custodians will not hold a collection", req.Custodians-rec.N, req.Custodians))
+	}
+
+	// PNG adds about 100 bytes per chunk for a CRC-checked image wrapper, so it only matters
+	// when the recommended scheme barely fits
+	pngOverhead := int64(100) * int64(rec.N) * (rec.CollectionSize/int64(cfg.ChunkSize) + 1)
+	if req.Budget > 0 && rec.TotalSize+pngOverhead > req.Budget {
+		plan.Format = FormatBin
+		plan.Notes = append(plan.Notes, "The bin format is recommended because the PNG wrapper would exceed the budget")
+	}
+	return plan, nil
+}
+
+// RecommendedScheme returns the recommended candidate, if any scheme fits the budget
+func (p *Plan) RecommendedScheme() (PlanCandidate, bool) {
+	if p.Recommended < 0 {
+		return PlanCandidate{}, false
+	}
+	return p.Candidates[p.Recommended], true
+}
+
+// Print writes the plan as a human-readable report
+func (p *Plan) Print(w io.Writer) {
+	fmt.Fprintf(w, "Original input size:   %s\n", FormatByteSize(p.InputSize))
+	fmt.Fprintf(w, "Compressed input size: %s\n", FormatByteSize(p.CompressedInputSize))
+	if p.Request.Budget > 0 {
+		fmt.Fprintf(w, "Storage budget:        %s\n", FormatByteSize(p.Request.Budget))
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "    %-8s %18s %18s\n", "Scheme", "Each collection", "Total")
+	for i, c := range p.Candidates {
+		mark := " "
+		if i == p.Recommended {
+			mark = "*"
+		} else if !c.FitsBudget {
+			mark = "x"
+		}
+		fmt.Fprintf(w, "  %s %-8s %18s %18s\n", mark, c.Scheme, FormatByteSize(c.CollectionSize), FormatByteSize(c.TotalSize))
+	}
+	fmt.Fprintln(w)
+
+	if rec, ok := p.RecommendedScheme(); ok {
+		fmt.Fprintf(w, "Recommended: -copies %d -required %d -format %s (compression: %s)\n", rec.N, rec.K, p.Format, p.Compression)
+	} else {
+		fmt.Fprintln(w, "No scheme fits the budget")
+	}
+	for _, note := range p.Notes {
+		fmt.Fprintf(w, "  - %s\n", note)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestRecommendScheme(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "padlock-plan-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := os.WriteFile(filepath.Join(tempDir, "test.txt"), []byte(strings.Repeat("plan ", 20000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	cfg := EncodeConfig{InputDir: tempDir, ChunkSize: 64 * 1024}
+
+	// Without a budget, the scheme using every custodian is recommended
+	plan, err := RecommendScheme(ctx, cfg, PlanRequest{SurviveLoss: 2, Custodians: 6})
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if len(plan.Candidates) != 3 {
+		t.Fatalf("Expected candidates 2of4, 3of5, 4of6, got %d", len(plan.Candidates))
+	}
+	rec, ok := plan.RecommendedScheme()
+	if !ok || rec.Scheme != (Scheme{K: 4, N: 6}) {
+		t.Errorf("Expected 4of6 to be recommended, got %v", rec.Scheme)
+	}
+	if plan.Compression != CompressionGzip || plan.Format != FormatPNG {
+		t.Errorf("Expected gzip and png for compressible input, got %v and %v", plan.Compression, plan.Format)
+	}
+
+	// A budget between the sizes of 3of5 and 4of6 selects 3of5
+	budget := (plan.Candidates[1].TotalSize + plan.Candidates[2].TotalSize) / 2
+	plan, err = RecommendScheme(ctx, cfg, PlanRequest{SurviveLoss: 2, Custodians: 6, Budget: budget})
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	rec, ok = plan.RecommendedScheme()
+	if !ok || rec.Scheme != (Scheme{K: 3, N: 5}) {
+		t.Errorf("Expected 3of5 to be recommended within the budget, got %v", rec.Scheme)
+	}
+	if plan.Candidates[2].FitsBudget {
+		t.Errorf("Expected 4of6 not to fit the budget")
+	}
+
+	// Nothing fits a tiny budget
+	plan, err = RecommendScheme(ctx, cfg, PlanRequest{SurviveLoss: 1, Custodians: 4, Budget: 10})
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if _, ok := plan.RecommendedScheme(); ok {
+		t.Errorf("Expected no scheme to fit a 10 byte budget")
+	}
+	var out bytes.Buffer
+	plan.Print(&out)
+	if !strings.Contains(out.String(), "No scheme fits the budget") {
+		t.Errorf("Unexpected report:\n%s", out.String())
+	}
+
+	// Too few custodians to survive the loss
+	if _, err := RecommendScheme(ctx, cfg, PlanRequest{SurviveLoss: 3, Custodians: 4}); err == nil {
+		t.Errorf("Expected an error when there are too few custodians to survive the loss")
+	}
+}
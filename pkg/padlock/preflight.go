@@ -0,0 +1,300 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// PreflightError lists everything found wrong with a set of collections before decoding
+// started: collections from different encodes, of different formats or chunk counts, or too
+// few of them. It wraps ErrMixedSessions or ErrInsufficientCollections, or both, so callers
+// can still test for those with errors.Is.
+type PreflightError struct {
+	Problems []string // Each problem found, as a sentence naming the collections involved
+	errs     []error  // The sentinel errors the problems amount to
+}
+
+func (e *PreflightError) Error() string {
+	return "collections can't be decoded: " + strings.Join(e.Problems, "; ")
+}
+
+func (e *PreflightError) Unwrap() []error {
+	return e.errs
+}
+
+func (e *PreflightError) problem(sentinel error, format string, args ...any) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+	if !slices.Contains(e.errs, sentinel) {
+		e.errs = append(e.errs, sentinel)
+	}
+}
+
+// preflightCollection is what the pre-flight check learns about a collection without decoding
+// it, from the header of its first chunk and from its metadata
+type preflightCollection struct {
+	file.Collection
+	header   *pad.ChunkHeader // Header of the first chunk, or nil if it can't be read
+	metadata *file.Metadata   // Metadata, or nil if there is none or it is sealed
+	first    []byte           // SHA-256 of the first chunk, or nil if it can't be read
+}
+
+// inspectCollection reads the header of a collection's first chunk, and its metadata
+func inspectCollection(ctx context.Context, coll file.Collection, key []byte, retry RetryPolicy) preflightCollection {
+	log := trace.FromContext(ctx).WithPrefix("preflight")
+
+	found := preflightCollection{Collection: coll}
+	if md, err := file.ReadMetadata(ctx, coll, key); err == nil {
+		found.metadata = md
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Debugf("No metadata from collection %s: %v", coll.DiskName(), err)
+	}
+
+	// The metadata names a collection whose chunks carry its stealth name
+	aliases := stealthAliases([]file.Collection{coll})
+	addMetadataAlias(aliases, found.metadata)
+	reader := file.NewCollectionReader(coll)
+	reader.Retry = retry
+	if chunk, err := reader.ReadNextChunk(ctx); err != nil {
+		log.Infof("Collection %s: can't read its first chunk: %v", coll.DiskName(), err)
+	} else if header, err := pad.ParseChunkHeaderWith(chunk, aliases); err != nil {
+		log.Infof("Collection %s: can't parse its first chunk: %v", coll.DiskName(), err)
+	} else {
+		found.header = &header
+		sum := sha256.Sum256(chunk)
+		found.first = sum[:]
+	}
+	reader.Close()
+	return found
+}
+
+// name returns the collection's name as its chunks or metadata record it, which is its real
+// name even if it is stored under a stealth name
+func (c *preflightCollection) name() string {
+	if c.header != nil {
+		return c.header.Collection
+	}
+	if c.metadata != nil && c.metadata.Collection != "" {
+		return c.metadata.Collection
+	}
+	return c.DiskName()
+}
+
+// scheme returns the collection's K and N, or zeros if neither its chunks nor its metadata
+// record them
+func (c *preflightCollection) scheme() (int, int) {
+	if c.header != nil {
+		return c.header.RequiredCopies, c.header.TotalCopies
+	}
+	if c.metadata != nil {
+		return c.metadata.Required, c.metadata.Copies
+	}
+	return 0, 0
+}
+
+// preflightDecode checks that the collections can be decoded together before any data is
+// read: that they are all from the same encode session and K-of-N scheme, that they are all
+// in the same chunk format unless they record one session, that they record the same number
+// of chunks, and that there are at least K of them, including every mandatory collection.
+// Every problem is reported at once, in a PreflightError, rather than only the first one
+// pad.Decode would trip over, and only after a large part of the data had been decoded.
+// Collections whose first chunk can't be read are left to the decoder.
+func preflightDecode(ctx context.Context, collections []file.Collection, key []byte, retry RetryPolicy) error {
+	log := trace.FromContext(ctx).WithPrefix("preflight")
+
+	found := make([]preflightCollection, len(collections))
+	for i, coll := range collections {
+		found[i] = inspectCollection(ctx, coll, key, retry)
+	}
+
+	report := &PreflightError{}
+	for _, c := range found {
+		k, n := c.scheme()
+		line := fmt.Sprintf("Collection %s: format %s", c.name(), c.Format)
+		if k > 0 {
+			line += fmt.Sprintf(", %d of %d", k, n)
+		}
+		if c.metadata != nil && c.metadata.Chunks > 0 {
+			line += fmt.Sprintf(", %d chunks", c.metadata.Chunks)
+		}
+		if c.metadata != nil && c.metadata.Session != "" {
+			line += fmt.Sprintf(", session %s", c.metadata.Session)
+		}
+		log.Infof("%s", line)
+	}
+
+	// Each of these must be the same for every collection that records it
+	preflightAgree(report, ErrMixedSessions, found, "are from different encode sessions", func(c *preflightCollection) string {
+		if c.metadata == nil {
+			return ""
+		}
+		return c.metadata.Session
+	})
+	preflightAgree(report, ErrMixedSessions, found, "are from different K-of-N schemes", func(c *preflightCollection) string {
+		if k, n := c.scheme(); k > 0 {
+			return fmt.Sprintf("%d of %d", k, n)
+		}
+		return ""
+	})
+	// Collections of one session may each be in a format of their own, so the formats of
+	// those that record it only matter if they don't all record the same one
+	sessions := make(map[string]bool)
+	for _, c := range found {
+		if c.metadata != nil && c.metadata.Session != "" {
+			sessions[c.metadata.Session] = true
+		}
+	}
+	preflightAgree(report, ErrMixedSessions, found, "are in different chunk formats", func(c *preflightCollection) string {
+		if len(sessions) == 1 && c.metadata != nil && c.metadata.Session != "" {
+			return ""
+		}
+		return string(c.Format)
+	})
+	preflightAgree(report, ErrMixedSessions, found, "record different chunk counts", func(c *preflightCollection) string {
+		if c.metadata == nil || c.metadata.Chunks == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%d chunks", c.metadata.Chunks)
+	})
+
+	// There must be K different collections, including every mandatory one. Collections
+	// whose scheme is unknown might make up the difference, so they are given the benefit of
+	// the doubt.
+	k, n, unknown := 0, 0, 0
+	var sharing pad.Sharing
+	present := make(map[string]bool)
+	for i := range found {
+		c := &found[i]
+		ck, cn := c.scheme()
+		if ck == 0 {
+			unknown++
+			continue
+		}
+		k, n = ck, cn
+		if c.header != nil && c.header.Sharing != nil {
+			sharing = c.header.Sharing
+		}
+		present[c.name()] = true
+	}
+	if k > 0 && len(present) < k && len(present)+unknown >= k {
+		log.Infof("Only %d of the %d collections needed have a readable scheme", len(present), k)
+	} else if k > 0 && len(present) < k {
+		report.problem(ErrInsufficientCollections, "%s", missingCollections(k, n, present))
+	}
+	for _, letter := range pad.MandatoryCollections(sharing) {
+		if name := fmt.Sprintf("%d%s%d", k, letter, n); !present[name] {
+			report.problem(ErrInsufficientCollections, "mandatory collection %s is missing", name)
+		}
+	}
+
+	if len(report.Problems) > 0 {
+		for _, problem := range report.Problems {
+			log.Error(errors.New(problem))
+		}
+		return report
+	}
+	log.Debugf("%d collections passed the pre-flight check", len(found))
+	return nil
+}
+
+// missingCollections describes how many more collections of a K-of-N distribution are
+// needed than those in present, and which ones could make up the difference
+func missingCollections(k, n int, present map[string]bool) string {
+	var missing []string
+	for i := range n {
+		if name := fmt.Sprintf("%d%c%d", k, 'A'+i, n); !present[name] {
+			missing = append(missing, name)
+		}
+	}
+	return fmt.Sprintf("need %d of %d collections, found %d; add any %d of %s",
+		k, n, len(present), k-len(present), strings.Join(missing, ", "))
+}
+
+// checkCollectionNames checks that collections with these names are enough to decode, when
+// the names tell what they belong to. Names that aren't collection names, such as stealth
+// names, are left to the decoder.
+func checkCollectionNames(names []string) error {
+	k, n := 0, 0
+	present := make(map[string]bool)
+	for _, name := range names {
+		ck, cn, _, err := pad.ParseCollectionName(name)
+		if err != nil {
+			return nil
+		}
+		k, n = ck, cn
+		present[name] = true
+	}
+	if k > 0 && len(present) < k {
+		return fmt.Errorf("%s: %w", missingCollections(k, n, present), ErrInsufficientCollections)
+	}
+	return nil
+}
+
+// preflightAgree reports collections that disagree on what value returns for them, saying
+// that the collections differ as differ says. Collections for which value returns "" don't
+// record it and are skipped.
+func preflightAgree(report *PreflightError, sentinel error, found []preflightCollection, differ string, value func(c *preflightCollection) string) {
+	var values []string
+	groups := make(map[string][]string)
+	for i := range found {
+		v := value(&found[i])
+		if v == "" {
+			continue
+		}
+		if _, ok := groups[v]; !ok {
+			values = append(values, v)
+		}
+		groups[v] = append(groups[v], found[i].name())
+	}
+	if len(values) < 2 {
+		return
+	}
+	var parts []string
+	for _, v := range values {
+		parts = append(parts, fmt.Sprintf("%s (%s)", strings.Join(groups[v], ", "), v))
+	}
+	report.problem(sentinel, "collections %s: %s", differ, strings.Join(parts, ", "))
+}
+
+// dedupeCollections drops collections that are copies of one given earlier, such as a
+// collection directory given along with its TAR, which would otherwise be decoded as two
+// different shares. Copies have the same name and were written by the same encode session,
+// or, for collections whose metadata doesn't record a session, start with the same chunk. The
+// first of each is kept, and the paths of the others are returned along with a warning for each.
+func dedupeCollections(ctx context.Context, collections []file.Collection, key []byte, retry RetryPolicy) ([]file.Collection, []string) {
+	log := trace.FromContext(ctx).WithPrefix("preflight")
+
+	kept := collections[:0:0]
+	var dropped []string
+	first := make(map[string]string)
+	for _, coll := range collections {
+		c := inspectCollection(ctx, coll, key, retry)
+		identity := ""
+		if c.metadata != nil && c.metadata.Session != "" {
+			identity = c.name() + " session " + c.metadata.Session
+		} else if c.first != nil {
+			identity = c.name() + " chunk " + hex.EncodeToString(c.first)
+		}
+		if identity != "" {
+			if path, ok := first[identity]; ok {
+				log.Infof("WARNING: collection %s was given twice, as %s and %s; decoding it from %s only", c.name(), path, coll.Path, path)
+				dropped = append(dropped, coll.Path)
+				continue
+			}
+			first[identity] = coll.Path
+		}
+		kept = append(kept, coll)
+	}
+	return kept, dropped
+}
@@ -0,0 +1,211 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestPreflightDecode checks that collections that can't be decoded together are refused
+// before decoding starts, with every problem with them reported at once
+func TestPreflightDecode(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "data.txt"), []byte(strings.Repeat("preflight ", 2000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	encode := func(name string, format Format, chunkSize int) string {
+		outputDir := filepath.Join(tempDir, name)
+		err := EncodeDirectory(ctx, EncodeConfig{
+			InputDir:    inputDir,
+			OutputDir:   outputDir,
+			N:           4,
+			K:           3,
+			Format:      format,
+			ChunkSize:   chunkSize,
+			RNG:         pad.NewDefaultRand(ctx),
+			Compression: CompressionNone,
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		return outputDir
+	}
+	decode := func(name string, inputDirs ...string) error {
+		decodeDir := filepath.Join(tempDir, name)
+		err := DecodeDirectory(ctx, DecodeConfig{InputDirs: inputDirs, OutputDir: decodeDir, Compression: CompressionNone})
+		if entries, _ := os.ReadDir(decodeDir); err != nil && len(entries) > 0 {
+			t.Errorf("%s: a refused decode left %d entries in the output directory", name, len(entries))
+		}
+		return err
+	}
+
+	first := encode("first", FormatBin, 4096)
+	second := encode("second", FormatText, 2048)
+
+	// Too few collections name how many more are needed, and which
+	for _, name := range []string{"3C4", "3D4"} {
+		os.RemoveAll(filepath.Join(first, name))
+	}
+	err := decode("too-few", filepath.Join(first, "3A4"), filepath.Join(first, "3B4"))
+	if !errors.Is(err, ErrInsufficientCollections) || !strings.Contains(err.Error(), "need 3 of 4 collections, found 2; add any 1 of 3C4, 3D4") {
+		t.Errorf("Expected too few collections to be refused, got %v", err)
+	}
+
+	// Collections of two encodes are reported for everything they disagree on
+	err = decode("mixed", filepath.Join(first, "3A4"), filepath.Join(first, "3B4"), filepath.Join(second, "3C4"))
+	var preflight *PreflightError
+	if !errors.As(err, &preflight) || !errors.Is(err, ErrMixedSessions) || errors.Is(err, ErrInsufficientCollections) {
+		t.Fatalf("Expected mixed collections to be refused as a PreflightError, got %v", err)
+	}
+	for _, want := range []string{"different encode sessions", "in different chunk formats: 3A4, 3B4 (bin), 3C4 (txt)", "different chunk counts"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the report to mention %q: %v", want, err)
+		}
+	}
+	if len(preflight.Problems) != 3 {
+		t.Errorf("Expected 3 problems, got %q", preflight.Problems)
+	}
+
+	// The three collections of one encode pass
+	if err := decode("decoded", second); err != nil {
+		t.Errorf("Failed to decode: %v", err)
+	}
+}
+
+// TestSession checks that every collection of an encode records the same session, and that
+// collections of two encodes of the same data are refused before decoding starts
+func TestSession(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "data.txt"), []byte(strings.Repeat("session ", 2000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	encode := func(name string) (string, string) {
+		outputDir := filepath.Join(tempDir, name)
+		var result Result
+		err := EncodeDirectory(ctx, EncodeConfig{
+			InputDir:    inputDir,
+			OutputDir:   outputDir,
+			N:           3,
+			K:           2,
+			Format:      FormatBin,
+			ChunkSize:   4096,
+			RNG:         pad.NewDefaultRand(ctx),
+			Compression: CompressionGzip,
+			Result:      &result,
+		})
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		for _, coll := range []string{"2A3", "2B3", "2C3"} {
+			md, err := file.ReadMetadata(ctx, file.Collection{Name: coll, Path: filepath.Join(outputDir, coll)}, nil)
+			if err != nil {
+				t.Fatalf("Failed to read metadata: %v", err)
+			}
+			if result.Session == "" || md.Session != result.Session {
+				t.Fatalf("Collection %s records session %q; the encode reported %q", coll, md.Session, result.Session)
+			}
+		}
+		return outputDir, result.Session
+	}
+	first, firstSession := encode("first")
+	second, secondSession := encode("second")
+	if firstSession == secondSession {
+		t.Fatalf("Two encodes have the same session %s", firstSession)
+	}
+
+	// 2A3 of the first encode and 2B3 of the second are a quorum of mismatched collections
+	for _, name := range []string{"2B3", "2C3"} {
+		os.RemoveAll(filepath.Join(first, name))
+	}
+	for _, name := range []string{"2A3", "2C3"} {
+		os.RemoveAll(filepath.Join(second, name))
+	}
+	decodeDir := filepath.Join(tempDir, "decoded")
+	err := DecodeDirectory(ctx, DecodeConfig{InputDirs: []string{first, second}, OutputDir: decodeDir, Compression: CompressionGzip})
+	if !errors.Is(err, ErrMixedSessions) || !strings.Contains(err.Error(), "different encode sessions") {
+		t.Errorf("Expected the mixed collections to be refused as different sessions, got %v", err)
+	}
+	if entries, _ := os.ReadDir(decodeDir); len(entries) > 0 {
+		t.Errorf("Mixed collections left %d entries in the output directory", len(entries))
+	}
+}
+
+// TestDuplicateCollections checks that a collection given twice, as a directory and as its
+// TAR, is decoded once rather than as two shares
+func TestDuplicateCollections(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	content := []byte(strings.Repeat("duplicate ", 2000))
+	if err := os.WriteFile(filepath.Join(inputDir, "data.txt"), content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	encodedDir := filepath.Join(tempDir, "encoded")
+	err := EncodeDirectory(ctx, EncodeConfig{
+		InputDir:    inputDir,
+		OutputDir:   encodedDir,
+		N:           3,
+		K:           2,
+		Format:      FormatBin,
+		ChunkSize:   4096,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	os.RemoveAll(filepath.Join(encodedDir, "2C3"))
+	tarPath, err := file.TarCollection(ctx, filepath.Join(encodedDir, "2A3"))
+	if err != nil {
+		t.Fatalf("Failed to create tar: %v", err)
+	}
+
+	var result Result
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodedDir, OutputDir: decodeDir, Compression: CompressionGzip, Result: &result}); err != nil {
+		t.Fatalf("Failed to decode a collection given twice: %v", err)
+	}
+	if len(result.Duplicates) != 1 || result.Duplicates[0] != tarPath {
+		t.Errorf("Expected %s to be skipped as a duplicate, got %q", tarPath, result.Duplicates)
+	}
+	if len(result.Collections) != 2 {
+		t.Errorf("Expected 2 collections to be decoded, got %d", len(result.Collections))
+	}
+	if got, err := os.ReadFile(filepath.Join(decodeDir, "data.txt")); err != nil || string(got) != string(content) {
+		t.Errorf("data.txt was not restored (%v)", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// A raw stream, such as the output of pg_dump piped to padlock encode -, is encoded as it is
+// rather than as a TAR of an input directory, since its length isn't known until it ends and
+// a TAR entry needs it up front. Its collections record the name it was given in their
+// metadata, which tells decode to write the decoded bytes back out as they are: to a file
+// of that name in the output directory, or to an OutputStream such as stdout.
+
+// DefaultStreamName is the name a raw stream is restored under if the encode didn't name it
+const DefaultStreamName = "stdin"
+
+// rawStreamName returns the name the encode records for its raw input, or "" if it encodes
+// input directories
+func (cfg EncodeConfig) rawStreamName() string {
+	switch {
+	case cfg.RawInput == nil:
+		return ""
+	case cfg.RawInputName == "":
+		return DefaultStreamName
+	}
+	return filepath.Base(cfg.RawInputName)
+}
+
+// inputDescription names the input of the encode for its log
+func (cfg EncodeConfig) inputDescription() string {
+	if name := cfg.rawStreamName(); name != "" {
+		return "stream " + name
+	}
+	return strings.Join(cfg.inputDirs(), ", ")
+}
+
+// collectionStream returns the name of the raw stream the collections encode, as their
+// metadata records it, or "" if they encode a TAR of an input directory or record nothing,
+// with whether the stream was compressed. Unlike a TAR, a raw stream may itself start like
+// compressed data, so the metadata rather than the data decides whether it is decompressed.
+// Collections that record different names are from different encodes.
+func collectionStream(ctx context.Context, collections []file.Collection, key []byte) (string, bool, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	var name, from string
+	var compressed bool
+	for _, coll := range collections {
+		md, err := file.ReadMetadata(ctx, coll, key)
+		if err != nil || md.Stream == "" {
+			continue
+		}
+		if name != "" && md.Stream != name {
+			err := fmt.Errorf("collections %s and %s encode different streams, %s and %s: %w", from, coll.Name, name, md.Stream, ErrMixedSessions)
+			log.Error(err)
+			return "", false, err
+		}
+		name, from = md.Stream, coll.Name
+		compressed = md.Compression != "" && md.Compression != CompressionNone.String()
+	}
+	return name, compressed, nil
+}
+
+// restoreStream writes a decoded raw stream to cfg.OutputStream, or if that isn't set, to a
+// file named after the stream in cfg.OutputDir
+func restoreStream(ctx context.Context, cfg DecodeConfig, name string, r io.Reader) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if cfg.OutputStream != nil {
+		n, err := io.Copy(cfg.OutputStream, r)
+		if err != nil {
+			return fmt.Errorf("failed to write the decoded stream: %w", err)
+		}
+		log.Infof("Wrote the decoded stream %s (%s) to the output stream", name, FormatByteSize(n))
+		return nil
+	}
+
+	path := filepath.Join(cfg.OutputDir, filepath.Base(name))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	n, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	log.Infof("Restored the stream %s (%s)", path, FormatByteSize(n))
+	return nil
+}
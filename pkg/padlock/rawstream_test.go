@@ -0,0 +1,156 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestRawStreamRoundTrip checks that a stream encoded as it is decodes back to the same bytes,
+// both to a file named after it in an output directory and to an output stream
+func TestRawStreamRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	content := strings.Repeat("INSERT INTO accounts VALUES (1, 'x');\n", 200)
+
+	encodeDir := filepath.Join(tempDir, "encoded")
+	cfg, err := NewEncodeConfig(WithRawInput(strings.NewReader(content), "dumps/db.sql"), WithOutputs(encodeDir),
+		WithScheme(2, 3), WithFormat(FormatBin), WithChunkSize(1024), WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode stream: %v", err)
+	}
+
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputDir: decodeDir, RNG: pad.NewDefaultRand(ctx)}); err != nil {
+		t.Fatalf("Failed to decode to a directory: %v", err)
+	}
+	entries, err := os.ReadDir(decodeDir)
+	if err != nil || len(entries) != 1 || entries[0].Name() != "db.sql" {
+		t.Fatalf("Expected only db.sql to be restored, got %v (%v)", entries, err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(decodeDir, "db.sql")); string(got) != content {
+		t.Errorf("Restored file does not match the stream")
+	}
+
+	var out bytes.Buffer
+	decodeCfg, err := NewDecodeConfig(WithInputs(encodeDir), WithOutputStream(&out))
+	if err != nil {
+		t.Fatalf("NewDecodeConfig failed: %v", err)
+	}
+	decodeCfg.RNG = pad.NewDefaultRand(ctx)
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode to an output stream: %v", err)
+	}
+	if out.String() != content {
+		t.Errorf("Decoded stream does not match the original")
+	}
+}
+
+// TestRawStreamDefaultName checks that an unnamed stream is restored as DefaultStreamName
+func TestRawStreamDefaultName(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	encodeDir := filepath.Join(tempDir, "encoded")
+	cfg, err := NewEncodeConfig(WithRawInput(strings.NewReader("payload"), ""), WithOutputs(encodeDir),
+		WithFormat(FormatBin), WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode stream: %v", err)
+	}
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputDir: decodeDir, RNG: pad.NewDefaultRand(ctx)}); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(decodeDir, DefaultStreamName)); err != nil || string(got) != "payload" {
+		t.Errorf("Expected the stream to be restored as %s, got %q (%v)", DefaultStreamName, got, err)
+	}
+}
+
+// TestRawStreamCompressedPayload checks that a stream that is itself compressed, such as a
+// gzipped dump, decodes back to the compressed bytes rather than being decompressed
+func TestRawStreamCompressedPayload(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	var payload bytes.Buffer
+	zw := gzip.NewWriter(&payload)
+	zw.Write([]byte(strings.Repeat("already compressed ", 100)))
+	zw.Close()
+
+	for _, compression := range []Compression{CompressionNone, CompressionAuto, CompressionGzip} {
+		t.Run(compression.String(), func(t *testing.T) {
+			encodeDir := filepath.Join(t.TempDir(), "encoded")
+			cfg, err := NewEncodeConfig(WithRawInput(bytes.NewReader(payload.Bytes()), "dump.gz"), WithOutputs(encodeDir),
+				WithFormat(FormatBin), WithCompression(compression, 0), WithRNG(pad.NewDefaultRand(ctx)))
+			if err != nil {
+				t.Fatalf("NewEncodeConfig failed: %v", err)
+			}
+			if err := EncodeDirectory(ctx, cfg); err != nil {
+				t.Fatalf("Failed to encode stream: %v", err)
+			}
+			var out bytes.Buffer
+			err = DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputStream: &out, Compression: CompressionGzip, RNG: pad.NewDefaultRand(ctx)})
+			if err != nil {
+				t.Fatalf("Failed to decode: %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), payload.Bytes()) {
+				t.Errorf("Expected the compressed payload back, got %d bytes instead of %d", out.Len(), payload.Len())
+			}
+		})
+	}
+}
+
+// TestOutputStreamRefusesDirectory checks that collections of a directory aren't decoded to an
+// output stream, which can only carry a raw stream
+func TestOutputStreamRefusesDirectory(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	encodeDir := filepath.Join(tempDir, "encoded")
+	cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(encodeDir), WithFormat(FormatBin), WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	var out bytes.Buffer
+	err = DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputStream: &out, RNG: pad.NewDefaultRand(ctx)})
+	if err == nil || !strings.Contains(err.Error(), "output directory") {
+		t.Errorf("Expected decoding a directory to an output stream to fail, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected nothing to be written to the output stream, got %d bytes", out.Len())
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// An encode with RecoveryNotes stores a RECOVERY.txt in each collection, beside its metadata,
+// for whoever is handed the collection without any context: what it is, how many of the other
+// collections are needed with it, who holds them if custodians were named, and the decode
+// command that restores the data. The notes are plain text that anyone holding the collection
+// can read, so they are refused where they would give away what the encode hides: stealth
+// names and sealed metadata hide the scheme.
+
+// checkRecoveryNotes refuses an encode with RecoveryNotes whose collections have nowhere to
+// hold them, or whose scheme they would reveal
+func checkRecoveryNotes(cfg EncodeConfig) error {
+	if !cfg.RecoveryNotes {
+		return nil
+	}
+	switch {
+	case cfg.ChunkSink != nil:
+		return fmt.Errorf("the chunks of a sink have no collection to hold recovery notes")
+	case cfg.StealthNames || len(cfg.MetadataKey) > 0:
+		return fmt.Errorf("recovery notes would reveal the scheme that stealth names and sealed metadata hide")
+	}
+	return nil
+}
+
+// writeRecoveryNotes stores the recovery notes of each collection in its directory, or adds
+// them to its archive, through the encode's tarWriters
+func writeRecoveryNotes(ctx context.Context, cfg EncodeConfig, collections []file.Collection, tarWriters *file.TarWriterRegistry) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	for i, coll := range collections {
+		notes := recoveryNotes(cfg, collections, i, time.Now())
+		var err error
+		if cfg.ArchiveCollections {
+			err = addCollectionEntry(ctx, cfg, coll, file.RecoveryFileName, notes, tarWriters)
+		} else {
+			err = os.WriteFile(filepath.Join(coll.Path, file.RecoveryFileName), notes, 0644)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to write the recovery notes of collection %s: %w", coll.Name, err)
+			log.Error(err)
+			return err
+		}
+	}
+
+	log.Debugf("Wrote recovery notes to %d collections", len(collections))
+	return nil
+}
+
+// recoveryNotes returns the recovery notes of collection i of an encode of cfg, written at now
+func recoveryNotes(cfg EncodeConfig, collections []file.Collection, i int, now time.Time) []byte {
+	coll := collections[i]
+	var b bytes.Buffer
+
+	title := "PADLOCK COLLECTION " + coll.Name
+	if i < len(cfg.Labels) && cfg.Labels[i] != "" {
+		title += " (" + cfg.Labels[i] + ")"
+	}
+	fmt.Fprintf(&b, "%s\n%s\n\n", title, strings.Repeat("=", len(title)))
+
+	fmt.Fprintf(&b, "This is one of %d collections that a set of files was split into with padlock,\n", len(collections))
+	fmt.Fprintf(&b, "https://github.com/blues/padlock. On its own it reveals nothing about the files:\n")
+	if mandatory := pad.MandatoryCollections(cfg.sharing()); len(mandatory) > 0 {
+		for j, letter := range mandatory {
+			mandatory[j] = fmt.Sprintf("%d%s%d", cfg.K, letter, len(collections))
+		}
+		fmt.Fprintf(&b, "any %d of the %d collections, including %s, are needed to restore them.\n",
+			cfg.K, len(collections), strings.Join(mandatory, " and "))
+	} else {
+		fmt.Fprintf(&b, "any %d of the %d collections are needed to restore them.\n", cfg.K, len(collections))
+	}
+	fmt.Fprintf(&b, "Keep it safe, and don't store it with the other collections.\n\n")
+
+	fmt.Fprintf(&b, "Collection:  %s\n", coll.Name)
+	if sharing := cfg.sharing().Name(); sharing != "" {
+		fmt.Fprintf(&b, "Scheme:      %d of %d (%s)\n", cfg.K, len(collections), sharing)
+	} else {
+		fmt.Fprintf(&b, "Scheme:      %d of %d\n", cfg.K, len(collections))
+	}
+	fmt.Fprintf(&b, "Session:     %s\n", cfg.session)
+	fmt.Fprintf(&b, "Written:     %s\n", now.UTC().Format(time.DateOnly))
+	if !cfg.ReviewBy.IsZero() {
+		fmt.Fprintf(&b, "Review by:   %s\n", cfg.ReviewBy.Format(time.DateOnly))
+	}
+	if i < len(cfg.Notes) && cfg.Notes[i] != "" {
+		fmt.Fprintf(&b, "Notes:       %s\n", cfg.Notes[i])
+	}
+
+	// The holders of the other collections, if they were named
+	if len(cfg.Custodians) == len(collections) {
+		plan := &CustodianPlan{Copies: len(collections), Required: cfg.K}
+		for j, c := range cfg.Custodians {
+			c.Collection = collections[j].Name
+			plan.Collections = append(plan.Collections, c.Collection)
+			plan.Custodians = append(plan.Custodians, c)
+		}
+		plan.sort()
+		fmt.Fprintf(&b, "\n")
+		plan.Print(&b)
+	}
+
+	// The decode command, naming this collection and the next ones as they will be named once
+	// the encode completes
+	var inputs []string
+	for j := range cfg.K {
+		c := collections[(i+j)%len(collections)]
+		path := c.Path
+		if cfg.ArchiveCollections {
+			path = collectionTarPath(cfg, c.Path, c.DiskName())
+		}
+		inputs = append(inputs, filepath.Base(file.FinalPath(path)))
+	}
+	command := "padlock decode " + strings.Join(inputs, " ") + " restored"
+	if len(cfg.Passphrase) > 0 {
+		command += " -passphrase"
+	}
+	if len(cfg.EnvelopeKey) > 0 {
+		command += " -envelope-key KEYFILE"
+	}
+
+	fmt.Fprintf(&b, "\nTO RESTORE THE FILES\n\n")
+	fmt.Fprintf(&b, "1. Install padlock, from https://github.com/blues/padlock or with Go:\n\n")
+	fmt.Fprintf(&b, "     go install github.com/blues/padlock/cmd/padlock@latest\n\n")
+	fmt.Fprintf(&b, "2. Copy this collection and at least %d of the others to one computer, as they\n", cfg.K-1)
+	fmt.Fprintf(&b, "   are. Archives don't need to be unpacked.\n\n")
+	fmt.Fprintf(&b, "3. Run decode, naming the folder or archive of each collection you have, and a\n")
+	fmt.Fprintf(&b, "   new folder to restore the files into, such as:\n\n")
+	fmt.Fprintf(&b, "     %s\n\n", command)
+	if len(cfg.Passphrase) > 0 {
+		fmt.Fprintf(&b, "   The files were also protected with a passphrase, which decode asks for.\n")
+	}
+	if len(cfg.EnvelopeKey) > 0 {
+		fmt.Fprintf(&b, "   The files were also encrypted with a key, which KEYFILE must hold.\n")
+	}
+	if len(cfg.MACKey) > 0 {
+		fmt.Fprintf(&b, "   Add -mac-key PASSFILE to check that no chunk was tampered with.\n")
+	}
+	fmt.Fprintf(&b, "   Add -dryrun to check that the collections are enough without writing anything.\n")
+	return b.Bytes()
+}
@@ -0,0 +1,79 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestRecoveryNotes checks that each collection holds recovery notes describing it, and that
+// the notes, whose name ends in .txt, aren't taken for a text chunk
+func TestRecoveryNotes(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	for _, archive := range []ArchiveFormat{"", ArchiveTar, ArchiveZip} {
+		t.Run("archive="+string(archive), func(t *testing.T) {
+			tempDir := t.TempDir()
+			inputDir := filepath.Join(tempDir, "input")
+			encodeDir := filepath.Join(tempDir, "encoded")
+			writeFiles(t, inputDir, map[string]string{"a.txt": "noted"})
+
+			cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(encodeDir), WithScheme(2, 3), WithFormat(FormatText),
+				WithArchive(archive), WithRecoveryNotes(), WithCustodians(Custodian{Name: "Alice", Contact: "alice@example.com"},
+					Custodian{Name: "Bob"}, Custodian{Name: "Carol"}), WithRNG(pad.NewDefaultRand(ctx)))
+			if err != nil {
+				t.Fatalf("NewEncodeConfig failed: %v", err)
+			}
+			if err := EncodeDirectory(ctx, cfg); err != nil {
+				t.Fatalf("Failed to encode: %v", err)
+			}
+
+			var notes []byte
+			if archive == "" {
+				notes, err = os.ReadFile(filepath.Join(encodeDir, "2B3", file.RecoveryFileName))
+			} else {
+				err = file.WalkArchive(filepath.Join(encodeDir, "2B3"+archive.Ext()), func(name string, r io.Reader) error {
+					if name == file.RecoveryFileName {
+						notes, err = io.ReadAll(r)
+					}
+					return err
+				})
+			}
+			if err != nil {
+				t.Fatalf("Failed to read the recovery notes: %v", err)
+			}
+			wantCommand := "padlock decode 2B3 2C3 restored"
+			if archive != "" {
+				wantCommand = "padlock decode 2B3" + archive.Ext() + " 2C3" + archive.Ext() + " restored"
+			}
+			for _, want := range []string{"PADLOCK COLLECTION 2B3", "any 2 of the 3 collections", "Alice <alice@example.com>", wantCommand} {
+				if !strings.Contains(string(notes), want) {
+					t.Errorf("Expected the recovery notes to contain %q:\n%s", want, notes)
+				}
+			}
+
+			decodeDir := filepath.Join(tempDir, "decoded")
+			decodeCfg, err := NewDecodeConfig(WithInputs(encodeDir), WithOutput(decodeDir))
+			if err != nil {
+				t.Fatalf("NewDecodeConfig failed: %v", err)
+			}
+			if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+				t.Fatalf("Failed to decode: %v", err)
+			}
+			if got, err := os.ReadFile(filepath.Join(decodeDir, "a.txt")); err != nil || string(got) != "noted" {
+				t.Errorf("Expected the data to be restored, got %q (%v)", got, err)
+			}
+		})
+	}
+}
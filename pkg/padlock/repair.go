@@ -0,0 +1,235 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// RepairConfig holds the configuration for regenerating a lost collection
+type RepairConfig struct {
+	InputDirs          []string      // The surviving collections, or directories containing them
+	OutputDir          string        // Directory the regenerated collection is written to
+	Collection         string        // Name of the collection to regenerate, or empty for the one that is missing
+	Format             Format        // Format of the regenerated chunks (default: the format of the survivors)
+	ArchiveCollections bool          // Whether to write the regenerated collection as a TAR archive
+	ArchiveFormat      ArchiveFormat // Archive format used when ArchiveCollections is set; tar if empty
+	ClearIfNotEmpty    bool          // Whether to clear the output directory if not empty
+	ChecksumSidecars   bool          // Whether to write a .sha256 sidecar file per chunk (files mode only)
+	ParityPercent      int           // If positive, write a Reed-Solomon .parity sidecar per chunk with this percentage overhead (files mode only)
+	Par2Percent        int           // If positive, write PAR2 recovery files with this percentage redundancy for the collection
+	Retry              RetryPolicy   // Retry policy for transient chunk read and write failures (files mode only)
+	MetadataKey        []byte        // Passphrase for encrypted collection metadata, used to copy it to the new collection and to name stealth collections
+	MACKey             []byte        // If set, the survivors' chunks are authenticated, and the new collection's chunks get MACs, with this passphrase
+}
+
+// RepairCollection regenerates a lost or destroyed collection from the surviving ones and
+// writes it to cfg.OutputDir, without decoding the data to disk. The regenerated collection
+// is identical to the lost one, so it can be handed to a custodian as a replacement.
+//
+// With OTP sharing every collection shares a permutation with every other, so repair needs all
+// N-1 surviving collections, which for a K-of-(K+1) distribution such as 2-of-3 is just K. With
+// Shamir sharing any K survivors will do, but the collection to regenerate must be named if
+// more than one is missing. The metadata of the first survivor that has readable metadata is
+// copied to the regenerated collection.
+//
+// Returns the regenerated collection.
+func RepairCollection(ctx context.Context, cfg RepairConfig) (coll file.Collection, retErr error) {
+	log := trace.FromContext(ctx).WithPrefix("repair")
+	start := time.Now()
+
+	collections, tempDir, err := findInputCollections(ctx, "", cfg.InputDirs, 0)
+	if err != nil {
+		return coll, err
+	}
+	if tempDir != "" {
+		defer os.RemoveAll(tempDir)
+	}
+	if cfg.Format == "" {
+		cfg.Format = collections[0].Format
+	}
+
+	if err := file.PrepareOutputDirectory(ctx, cfg.OutputDir, cfg.ClearIfNotEmpty); err != nil {
+		return coll, err
+	}
+
+	// A partially regenerated collection must not be mistaken for a replacement
+	tarWriters := file.NewTarWriterRegistry()
+	defer func() {
+		if retErr != nil {
+			tarWriters.AbortAll(ctx)
+			removePartialOutput(ctx, []string{cfg.OutputDir})
+		}
+	}()
+
+	// Authenticate the survivors' chunks, and those of the regenerated collection, if asked to
+	var survivorMACs []*file.ChunkMACs
+	var macs *file.ChunkMACs
+	if len(cfg.MACKey) > 0 {
+		if survivorMACs, err = readCollectionMACs(ctx, collections, cfg.MACKey); err != nil {
+			return coll, err
+		}
+		if macs, err = file.NewChunkMACs(cfg.MACKey); err != nil {
+			return coll, err
+		}
+	}
+
+	readers := make([]io.Reader, len(collections))
+	for i, c := range collections {
+		collReader := file.NewCollectionReader(c)
+		collReader.Retry = cfg.Retry
+		if survivorMACs != nil {
+			collReader.MACs = survivorMACs[i]
+		}
+		defer collReader.Close()
+		readers[i] = file.NewChunkReaderAdapter(ctx, collReader)
+	}
+
+	// The lost collection's name is only known once the survivors' chunk headers are read,
+	// so its directory or TAR file is created with its first chunk
+	formatter := file.GetFormatter(cfg.Format)
+	var newChunkFunc pad.NewChunkFunc = func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		if coll.Name == "" {
+			coll = file.Collection{Name: collectionName, Path: filepath.Join(cfg.OutputDir, collectionName), Format: cfg.Format}
+			if !cfg.ArchiveCollections {
+				if _, err := file.CreateCollectionDirectory(ctx, cfg.OutputDir, collectionName); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if cfg.ArchiveCollections {
+			tarWriter, err := tarWriters.TarChunkWriter(ctx, coll.Path+cfg.ArchiveFormat.Ext(), collectionName, cfg.Format)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create tar chunk writer: %w", err)
+			}
+			tarWriter.ChunkNum = chunkNumber
+			return tarWriter, nil
+		}
+		return &file.NamedChunkWriter{
+			Ctx:       ctx,
+			Formatter: formatter,
+			CollPath:  coll.Path,
+			CollName:  collectionName,
+			ChunkNum:  chunkNumber,
+			Checksum:  cfg.ChecksumSidecars,
+			Parity:    cfg.ParityPercent,
+			Retry:     cfg.Retry,
+		}, nil
+	}
+
+	if macs != nil {
+		newChunk := newChunkFunc
+		newChunkFunc = func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+			w, err := newChunk(collectionName, chunkNumber, chunkFormat)
+			if err != nil {
+				return nil, err
+			}
+			return &macWriter{w: w, macs: macs, chunkNum: chunkNumber, h: macs.NewHash(chunkNumber)}, nil
+		}
+	}
+
+	log.Infof("Repairing from %d surviving collections", len(collections))
+	p := &pad.Pad{Aliases: metadataAliases(ctx, collections, cfg.MetadataKey)}
+	if _, err := p.Repair(ctx, readers, cfg.Collection, newChunkFunc, string(cfg.Format)); err != nil {
+		log.Error(fmt.Errorf("repair failed: %w", err))
+		return coll, fmt.Errorf("repair failed: %w", err)
+	}
+
+	if err := writeRepairedMetadata(ctx, cfg, collections, coll, tarWriters); err != nil {
+		return coll, err
+	}
+	if macs != nil {
+		if err := writeRepairedMACs(ctx, cfg, coll, macs, tarWriters); err != nil {
+			return coll, err
+		}
+	}
+
+	if cfg.ArchiveCollections {
+		if err := tarWriters.FinalizeAll(ctx); err != nil {
+			log.Error(fmt.Errorf("failed to finalize TAR writers: %w", err))
+			return coll, err
+		}
+		coll.Path += cfg.ArchiveFormat.Ext()
+	}
+
+	if cfg.Par2Percent > 0 {
+		if _, err := file.WriteCollectionPar2(ctx, coll, cfg.Par2Percent); err != nil {
+			log.Error(fmt.Errorf("failed to write PAR2 recovery files: %w", err))
+			return coll, err
+		}
+	}
+
+	log.Infof("Repair complete (%s): regenerated collection %s at %s", time.Since(start), coll.Name, coll.Path)
+	return coll, nil
+}
+
+// writeRepairedMACs writes the chunk MAC file of the regenerated collection
+func writeRepairedMACs(ctx context.Context, cfg RepairConfig, coll file.Collection, macs *file.ChunkMACs, tarWriters *file.TarWriterRegistry) error {
+	if !cfg.ArchiveCollections {
+		return file.WriteChunkMACs(ctx, coll.Path, macs)
+	}
+	data, err := macs.Marshal()
+	if err != nil {
+		return err
+	}
+	tarWriter, err := tarWriters.TarChunkWriter(ctx, coll.Path+cfg.ArchiveFormat.Ext(), coll.Name, cfg.Format)
+	if err != nil {
+		return fmt.Errorf("failed to create tar chunk writer: %w", err)
+	}
+	return tarWriter.AddFile(file.ChunkMACFileName, data)
+}
+
+// writeRepairedMetadata copies the metadata of a surviving collection to the regenerated one,
+// so that it describes the same distribution
+func writeRepairedMetadata(ctx context.Context, cfg RepairConfig, survivors []file.Collection, coll file.Collection, tarWriters *file.TarWriterRegistry) error {
+	log := trace.FromContext(ctx).WithPrefix("repair")
+
+	var md *file.Metadata
+	for _, survivor := range survivors {
+		var err error
+		if md, err = file.ReadMetadata(ctx, survivor, cfg.MetadataKey); err == nil {
+			break
+		}
+		log.Debugf("No usable metadata in collection %s: %v", survivor.DiskName(), err)
+	}
+	if md == nil {
+		log.Infof("No readable metadata in the surviving collections, so none was written to %s", coll.Name)
+		return nil
+	}
+
+	md.Collection = coll.Name
+	md.StoredName = ""
+	md.Label, md.Notes = "", "" // The survivor's own, which don't describe the regenerated collection
+	md.Format = cfg.Format
+	md.PNGEmbedding = "" // Repaired PNG chunks always hold their data in a custom chunk
+	if len(cfg.MetadataKey) > 0 {
+		sealed, err := file.SealMetadata(md, cfg.MetadataKey)
+		if err != nil {
+			return err
+		}
+		md = sealed
+	}
+
+	if !cfg.ArchiveCollections {
+		return file.WriteMetadata(ctx, coll.Path, md)
+	}
+	data, err := file.MarshalMetadata(md)
+	if err != nil {
+		return err
+	}
+	tarWriter, err := tarWriters.TarChunkWriter(ctx, coll.Path+cfg.ArchiveFormat.Ext(), coll.Name, cfg.Format)
+	if err != nil {
+		return fmt.Errorf("failed to create tar chunk writer: %w", err)
+	}
+	return tarWriter.AddFile(file.MetadataFileName, data)
+}
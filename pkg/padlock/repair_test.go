@@ -0,0 +1,118 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestRepairCollection(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-repair-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	testData := bytes.Repeat([]byte("repair me "), 500)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), testData, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	encodedDir := filepath.Join(tempDir, "encoded")
+	cfg := EncodeConfig{
+		InputDir:        inputDir,
+		OutputDir:       encodedDir,
+		N:               3,
+		K:               2,
+		Format:          FormatPNG,
+		ChunkSize:       512,
+		RNG:             pad.NewDefaultRand(ctx),
+		ClearIfNotEmpty: true,
+		Compression:     CompressionNone,
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	// Lose collection 2B3, keeping a copy to compare against
+	lostDir := filepath.Join(tempDir, "lost")
+	if err := os.Rename(filepath.Join(encodedDir, "2B3"), lostDir); err != nil {
+		t.Fatalf("Failed to remove collection: %v", err)
+	}
+
+	repairedDir := filepath.Join(tempDir, "repaired")
+	coll, err := RepairCollection(ctx, RepairConfig{InputDirs: []string{encodedDir}, OutputDir: repairedDir})
+	if err != nil {
+		t.Fatalf("Failed to repair: %v", err)
+	}
+	if coll.Name != "2B3" || coll.Path != filepath.Join(repairedDir, "2B3") {
+		t.Fatalf("Unexpected repaired collection: %+v", coll)
+	}
+
+	// Every chunk is identical to the lost one
+	chunks, err := filepath.Glob(filepath.Join(lostDir, "*.PNG"))
+	if err != nil || len(chunks) < 2 {
+		t.Fatalf("Expected several lost chunks, got %v, %v", chunks, err)
+	}
+	for _, chunk := range chunks {
+		want, _ := os.ReadFile(chunk)
+		got, err := os.ReadFile(filepath.Join(coll.Path, filepath.Base(chunk)))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Repaired chunk %s differs from the lost one (%v)", filepath.Base(chunk), err)
+		}
+	}
+	md, err := file.ReadMetadata(ctx, coll, nil)
+	if err != nil || md.Collection != "2B3" || md.Copies != 3 || md.Required != 2 {
+		t.Errorf("Unexpected repaired metadata: %+v, %v", md, err)
+	}
+
+	// The repaired collection decodes with one of the survivors, here as a TAR archive
+	tarDir := filepath.Join(tempDir, "repaired-tar")
+	coll, err = RepairCollection(ctx, RepairConfig{
+		InputDirs:          []string{filepath.Join(encodedDir, "2A3"), filepath.Join(encodedDir, "2C3")},
+		OutputDir:          tarDir,
+		Collection:         "2B3",
+		ArchiveCollections: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to repair to a TAR archive: %v", err)
+	}
+	outputDir := filepath.Join(tempDir, "output")
+	decodeCfg := DecodeConfig{
+		InputDirs:   []string{filepath.Join(encodedDir, "2A3"), tarDir},
+		OutputDir:   outputDir,
+		Compression: CompressionNone,
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode with the repaired collection: %v", err)
+	}
+	decoded, err := os.ReadFile(filepath.Join(outputDir, "test.txt"))
+	if err != nil || !bytes.Equal(decoded, testData) {
+		t.Errorf("Decoding with the repaired collection did not reproduce the input (%v)", err)
+	}
+
+	// Repair refuses a collection that survives, and leaves no output behind
+	badDir := filepath.Join(tempDir, "bad")
+	if _, err := RepairCollection(ctx, RepairConfig{InputDirs: []string{encodedDir}, OutputDir: badDir, Collection: "2A3"}); err == nil {
+		t.Errorf("Expected an error repairing a surviving collection")
+	}
+	if entries, _ := os.ReadDir(badDir); len(entries) != 0 {
+		t.Errorf("Expected no partial output, found %d entries", len(entries))
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// ReshareConfig holds the configuration for re-sharing an existing distribution with new
+// K-of-N parameters
+type ReshareConfig struct {
+	InputDirs []string     // At least K collections of the existing distribution, or directories containing them
+	Retry     RetryPolicy  // Retry policy for transient chunk read failures (directory collections only)
+	Encode    EncodeConfig // The new distribution; InputDir, InputStream, and Compression are set by ReshareCollections
+}
+
+// ReshareCollections decodes K or more collections of an existing distribution and encodes
+// the recovered stream straight into a new distribution with the parameters in cfg.Encode,
+// for example to go from 2-of-3 to 3-of-5. The decoded stream only passes through memory, so
+// the plaintext is never written to the filesystem.
+//
+// The stream is re-encoded as it was serialized, without being decompressed, so the new
+// collections use the same compression as the old ones, and a stream masked with a passphrase
+// or padded stays masked or padded, with any hidden volume in its padding. If re-sharing
+// fails for any reason, the partially written collections are removed.
+func ReshareCollections(ctx context.Context, cfg ReshareConfig) (retErr error) {
+	log := trace.FromContext(ctx).WithPrefix("reshare")
+	start := time.Now()
+
+	if cfg.Encode.SizeOnly || cfg.Encode.ChunkSink != nil {
+		return fmt.Errorf("reshare writes new collections to output directories only")
+	}
+	if len(cfg.Encode.Passphrase) > 0 || len(cfg.Encode.EnvelopeKey) > 0 {
+		return fmt.Errorf("reshare keeps any passphrase or envelope the collections were encoded with, and can't add one")
+	}
+	if cfg.Encode.PadTo.Mode != PadNone || cfg.Encode.HiddenDir != "" {
+		return fmt.Errorf("reshare keeps any padding and hidden volume the collections were encoded with, and can't add them")
+	}
+
+	collections, tempDir, err := findInputCollections(ctx, "", cfg.InputDirs, 0)
+	if err != nil {
+		return err
+	}
+	if tempDir != "" {
+		defer os.RemoveAll(tempDir)
+	}
+	collections, _ = dedupeCollections(ctx, collections, cfg.Encode.MetadataKey, cfg.Retry)
+	if err := checkReshareOutput(collections, encodeOutputDirs(cfg.Encode)); err != nil {
+		log.Error(err)
+		return err
+	}
+	if err := checkCollectionFormats(ctx, collections, cfg.Encode.MetadataKey); err != nil {
+		return err
+	}
+	if err := preflightDecode(ctx, collections, cfg.Encode.MetadataKey, cfg.Retry); err != nil {
+		return err
+	}
+	if md := collectionSegments(ctx, collections, cfg.Encode.MetadataKey); md != nil {
+		err := fmt.Errorf("collection %s holds data appended after it was encoded, which can't be re-shared; decode it and encode the files again", md.Collection)
+		log.Error(err)
+		return err
+	}
+
+	readers := make([]io.Reader, len(collections))
+	for i, coll := range collections {
+		collReader := file.NewCollectionReader(coll)
+		collReader.Retry = cfg.Retry
+		defer collReader.Close()
+		readers[i] = file.NewChunkReaderAdapter(ctx, collReader)
+	}
+	p, err := pad.NewPadForDecode(ctx, len(collections))
+	if err != nil {
+		log.Error(fmt.Errorf("failed to create pad instance: %w", err))
+		return err
+	}
+	p.Aliases = metadataAliases(ctx, collections, cfg.Encode.MetadataKey)
+
+	// Decode into a pipe that the new encode reads from
+	pr, pw := file.NewPipe(cfg.Encode.Pipeline.PipeBufferSize)
+	decodeDone := make(chan error, 1)
+	go func() {
+		err := p.Decode(ctx, readers, pw)
+		pw.CloseWithError(err)
+		decodeDone <- err
+	}()
+
+	// The old collections' metadata records any envelope the data is encrypted in, which the
+	// new collections must record too, so it can't be skipped if it is sealed
+	md, mdErr := file.ReadMetadata(ctx, collections[0], cfg.Encode.MetadataKey)
+	if errors.Is(mdErr, file.ErrMetadataSealed) {
+		err := fmt.Errorf("the metadata of collection %s is encrypted, and is needed to re-share it: %w", collections[0].Name, mdErr)
+		log.Error(err)
+		pr.CloseWithError(err)
+		<-decodeDone
+		return err
+	}
+	if mdErr == nil && md.Dedup {
+		// The stream is passed on as it is, so it stays deduplicated
+		cfg.Encode.Dedup = true
+	}
+	if mdErr == nil && md.Envelope != nil {
+		log.Infof("The data is encrypted in an %s envelope, which the new collections keep", md.Envelope.Cipher)
+		cfg.Encode.envelope = md.Envelope
+	}
+
+	// The collections' own compression is kept, which the start of the stream reveals unless
+	// it is masked with a passphrase, padded, or encrypted, when only the old collections'
+	// metadata can tell
+	stream := bufio.NewReader(pr)
+	cfg.Encode.Compression = CompressionNone
+	magic, _ := stream.Peek(8)
+	algorithm := file.DetectCompression(magic)
+	if file.IsPassphraseStream(magic) {
+		log.Infof("The collections are protected with a passphrase, which the new collections keep")
+	}
+	if file.IsPassphraseStream(magic) || file.IsPaddedStream(magic) || cfg.Encode.envelope != nil {
+		algorithm = ""
+		if mdErr == nil {
+			algorithm = md.Compression
+		}
+	}
+	switch algorithm {
+	case "gzip":
+		cfg.Encode.Compression = CompressionGzip
+	case "zstd":
+		cfg.Encode.Compression = CompressionZstd
+	}
+	cfg.Encode.CompressionLevel = 0
+	if mdErr == nil && md.Compression == cfg.Encode.Compression.String() {
+		// The level is only known from the old collections' metadata
+		cfg.Encode.CompressionLevel = md.CompressionLevel
+	}
+	cfg.Encode.InputDir = ""
+	cfg.Encode.InputStream = stream
+	log.Infof("Re-sharing %d collections as %d of %d with %s sharing (compression: %s)",
+		len(collections), cfg.Encode.K, cfg.Encode.N, pad.SharingName(cfg.Encode.sharing()), cfg.Encode.Compression)
+
+	encodeErr := EncodeDirectory(ctx, cfg.Encode)
+
+	// Stop the decoder if the encode gave up early, then collect its result
+	pr.CloseWithError(fmt.Errorf("reshare stopped"))
+	decodeErr := <-decodeDone
+
+	if decodeErr != nil || encodeErr != nil {
+		// A new distribution built from a partial stream must not be mistaken for a complete one
+		removePartialOutput(ctx, encodeOutputDirs(cfg.Encode))
+		if decodeErr != nil {
+			log.Error(fmt.Errorf("decoding failed: %w", decodeErr))
+			return fmt.Errorf("decoding failed: %w", decodeErr)
+		}
+		return encodeErr
+	}
+
+	log.Infof("Reshare complete (%s)", time.Since(start))
+	return nil
+}
+
+// checkReshareOutput refuses output directories that contain any of the input collections,
+// which the new encode would otherwise overwrite or clear while they are being read
+func checkReshareOutput(collections []file.Collection, outputDirs []string) error {
+	for _, dir := range outputDirs {
+		out, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		for _, coll := range collections {
+			in, err := filepath.Abs(coll.Path)
+			if err != nil {
+				return err
+			}
+			if in == out || strings.HasPrefix(in, out+string(filepath.Separator)) {
+				return fmt.Errorf("output directory %s contains input collection %s; write the new collections elsewhere", dir, coll.DiskName())
+			}
+		}
+	}
+	return nil
+}
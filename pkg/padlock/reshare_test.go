@@ -0,0 +1,121 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestReshareCollections(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-reshare-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	testData := bytes.Repeat([]byte("reshare me "), 1000)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), testData, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	oldDir := filepath.Join(tempDir, "old")
+	cfg := EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          oldDir,
+		N:                  3,
+		K:                  2,
+		Format:             FormatPNG,
+		ChunkSize:          1024,
+		RNG:                pad.NewDefaultRand(ctx),
+		ClearIfNotEmpty:    true,
+		Compression:        CompressionGzip,
+		ArchiveCollections: true,
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	// Re-share two of the three collections as 3 of 5 individual bin files
+	survivors := filepath.Join(tempDir, "survivors")
+	if err := os.MkdirAll(survivors, 0755); err != nil {
+		t.Fatalf("Failed to create survivors dir: %v", err)
+	}
+	for _, name := range []string{"2A3.tar", "2C3.tar"} {
+		if err := os.Rename(filepath.Join(oldDir, name), filepath.Join(survivors, name)); err != nil {
+			t.Fatalf("Failed to move collection: %v", err)
+		}
+	}
+	newDir := filepath.Join(tempDir, "new")
+	reshareCfg := ReshareConfig{
+		InputDirs: []string{survivors},
+		Encode: EncodeConfig{
+			OutputDir: newDir,
+			N:         5,
+			K:         3,
+			Format:    FormatBin,
+			ChunkSize: 1024,
+			RNG:       pad.NewDefaultRand(ctx),
+		},
+	}
+	if err := ReshareCollections(ctx, reshareCfg); err != nil {
+		t.Fatalf("Failed to reshare: %v", err)
+	}
+
+	// Any three of the new collections reproduce the input, and keep its compression
+	md, err := file.ReadMetadata(ctx, file.Collection{Name: "3B5", Path: filepath.Join(newDir, "3B5")}, nil)
+	if err != nil || md.Compression != "gzip" || md.Required != 3 || md.Copies != 5 {
+		t.Errorf("Unexpected metadata for the new collections: %+v, %v", md, err)
+	}
+	outputDir := filepath.Join(tempDir, "output")
+	decodeCfg := DecodeConfig{
+		InputDirs:   []string{filepath.Join(newDir, "3B5"), filepath.Join(newDir, "3D5"), filepath.Join(newDir, "3E5")},
+		OutputDir:   outputDir,
+		Compression: CompressionGzip,
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode the new collections: %v", err)
+	}
+	decoded, err := os.ReadFile(filepath.Join(outputDir, "test.txt"))
+	if err != nil || !bytes.Equal(decoded, testData) {
+		t.Errorf("Decoding the new collections did not reproduce the input (%v)", err)
+	}
+
+	// The new collections can't be written over the old ones
+	reshareCfg.Encode.OutputDir = survivors
+	reshareCfg.Encode.ClearIfNotEmpty = true
+	if err := ReshareCollections(ctx, reshareCfg); err == nil {
+		t.Errorf("Expected an error writing the new collections over the old ones")
+	}
+	if _, err := os.Stat(filepath.Join(survivors, "2A3.tar")); err != nil {
+		t.Errorf("Expected the old collections to be untouched: %v", err)
+	}
+
+	// With too few collections, nothing is left behind
+	if err := os.Remove(filepath.Join(survivors, "2C3.tar")); err != nil {
+		t.Fatalf("Failed to remove collection: %v", err)
+	}
+	failedDir := filepath.Join(tempDir, "failed")
+	reshareCfg.Encode.OutputDir = failedDir
+	if err := ReshareCollections(ctx, reshareCfg); err == nil {
+		t.Errorf("Expected an error re-sharing a single collection")
+	}
+	if entries, _ := os.ReadDir(failedDir); len(entries) != 0 {
+		t.Errorf("Expected no partial output, found %d entries", len(entries))
+	}
+}
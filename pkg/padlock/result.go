@@ -0,0 +1,202 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+)
+
+// Result summarizes an encode or decode, including a dry run, for scripts and CI jobs that
+// need its outcome in a machine-readable form. Sizes are in bytes.
+type Result struct {
+	Operation        string             `json:"operation"` // "encode" or "decode"
+	DryRun           bool               `json:"dry_run"`
+	Success          bool               `json:"success"`
+	Error            string             `json:"error,omitempty"`
+	Copies           int                `json:"copies,omitempty"`   // N
+	Required         int                `json:"required,omitempty"` // K
+	Sharing          string             `json:"sharing,omitempty"`  // Secret sharing scheme, unless OTP
+	Format           Format             `json:"format,omitempty"`
+	Compression      string             `json:"compression,omitempty"`
+	CompressionLevel int                `json:"compression_level,omitempty"`
+	ChunkSize        int                `json:"chunk_size,omitempty"`       // Encode: maximum size of each chunk
+	Session          string             `json:"session,omitempty"`          // Identifier recorded in every collection of the encode
+	InputBytes       int64              `json:"input_bytes"`                // Encode: serialized input; decode: all input collections
+	CompressedBytes  int64              `json:"compressed_bytes,omitempty"` // Encode: input after compression
+	DuplicateBytes   int64              `json:"duplicate_bytes,omitempty"`  // Encode: input stored once, as a repeat of an earlier block, by deduplication
+	OutputBytes      int64              `json:"output_bytes"`               // Encode: all collections; decode: restored data
+	Chunks           int                `json:"chunks"`                     // Chunks in each collection
+	Collections      []CollectionResult `json:"collections,omitempty"`
+	BadChunks        []BadChunkResult   `json:"bad_chunks,omitempty"`  // Decode: chunks that were bad, and decoded from other collections
+	Duplicates       []string           `json:"duplicates,omitempty"`  // Decode: inputs skipped as copies of a collection given earlier
+	OutputDir        string             `json:"output_dir,omitempty"`  // Decode: where the data was restored
+	RolledBack       []string           `json:"rolled_back,omitempty"` // Partial output removed after a failure
+	Salvage          *SalvageResult     `json:"salvage,omitempty"`     // Decode: what -salvage kept when part of the data couldn't be decoded
+	Diagnosis        []string           `json:"diagnosis,omitempty"`   // Decode: why the data couldn't be decoded, and what to restore
+	Started          time.Time          `json:"started"`
+	Seconds          float64            `json:"seconds"`
+}
+
+// CollectionResult describes one collection written by an encode or read by a decode
+type CollectionResult struct {
+	Name       string `json:"name"`
+	StoredName string `json:"stored_name,omitempty"` // Stealth name the collection is stored under, if any
+	Path       string `json:"path,omitempty"`        // Local path or remote URL of the collection
+	Chunks     int    `json:"chunks"`
+	Bytes      int64  `json:"bytes"`
+}
+
+// BadChunkResult describes a bad chunk that a decode set its collection aside at, decoding
+// the rest of the data from the other collections
+type BadChunkResult struct {
+	Collection string `json:"collection"`
+	Chunk      int    `json:"chunk"`
+	Error      string `json:"error"`
+}
+
+// WriteJSON writes the result as indented JSON
+func (r *Result) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// finish records the outcome and duration of the operation
+func (r *Result) finish(start time.Time, err error) {
+	r.Seconds = time.Since(start).Seconds()
+	r.Success = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// addCollection records a collection, measuring it on disk unless size is already known
+func (r *Result) addCollection(coll file.Collection, chunks int, size int64, destinations []file.Destination) {
+	path := coll.Path
+	if abs, err := filepath.Abs(path); err == nil && path != "" {
+		path = remoteDestination(destinations, abs)
+	}
+	if size < 0 {
+		size, _ = collectionDiskSize(coll)
+	}
+	r.Collections = append(r.Collections, CollectionResult{
+		Name:       coll.Name,
+		StoredName: coll.StoredName,
+		Path:       path,
+		Chunks:     chunks,
+		Bytes:      size,
+	})
+}
+
+// setEncodeCollections records the collections an encode wrote, with their chunk counts and
+// sizes, and the size of the input
+func (r *Result) setEncodeCollections(collections []file.Collection, counter *resultCounter, tracker *SizeTracker, destinations []file.Destination) {
+	r.InputBytes = counter.serialized.n.Load()
+	if counter.serialized.r == nil {
+		// The input was serialized by the caller
+		r.InputBytes = counter.encoded.n.Load()
+	} else if r.Compression != CompressionNone.String() {
+		r.CompressedBytes = counter.encoded.n.Load()
+	}
+
+	for _, coll := range collections {
+		size := int64(-1)
+		if r.DryRun {
+			// Dry run collections are only counted, never written
+			coll.Path = ""
+			size = tracker.EncodeCollectionsSizes[coll.Name]
+		}
+		chunks := counter.chunks[coll.Name]
+		r.addCollection(coll, chunks, size, destinations)
+		r.Chunks = max(r.Chunks, chunks)
+		r.OutputBytes += r.Collections[len(r.Collections)-1].Bytes
+	}
+}
+
+// setDecodeCollections records the collections a decode read, the scheme their chunk headers
+// described, and the size of the restored data
+func (r *Result) setDecodeCollections(collections []file.Collection, p *pad.Pad, counter *resultCounter, tracker *SizeTracker) {
+	r.Copies, r.Required = p.TotalCopies, p.RequiredCopies
+	if p.Sharing != nil {
+		r.Sharing = p.Sharing.Name()
+	}
+	r.Chunks = int(counter.decoded.Load())
+	for _, bad := range p.BadShares {
+		r.BadChunks = append(r.BadChunks, BadChunkResult{Collection: bad.Collection, Chunk: bad.Chunk, Error: bad.Err.Error()})
+	}
+	for _, coll := range collections {
+		r.Format = coll.Format
+		r.addCollection(coll, r.Chunks, -1, nil)
+		r.InputBytes += r.Collections[len(r.Collections)-1].Bytes
+	}
+	if r.DryRun {
+		r.OutputBytes = tracker.DecodeOutputSize
+	} else {
+		r.OutputBytes, _ = diskSize(r.OutputDir)
+	}
+}
+
+// resultCounter counts the chunks written to each collection and the bytes read from each
+// stage of the input during an encode, or the chunks decoded during a decode
+type resultCounter struct {
+	mu         sync.Mutex
+	chunks     map[string]int
+	serialized countingReader // Encode: the serialized input directory
+	encoded    countingReader // Encode: the input to the pad, after any compression
+	decoded    atomic.Int64   // Decode: chunks written by the pad decoder
+}
+
+func newResultCounter() *resultCounter {
+	return &resultCounter{chunks: make(map[string]int)}
+}
+
+// wrapChunks wraps the function that creates collection chunk writers
+func (c *resultCounter) wrapChunks(newChunk pad.NewChunkFunc) pad.NewChunkFunc {
+	return func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		c.mu.Lock()
+		c.chunks[collectionName]++
+		c.mu.Unlock()
+		return newChunk(collectionName, chunkNumber, chunkFormat)
+	}
+}
+
+// wrapOutput wraps the stream the pad decoder writes to, which receives one write per chunk
+func (c *resultCounter) wrapOutput(w io.Writer) io.Writer {
+	return &countingWriter{w: w, chunks: &c.decoded}
+}
+
+// countingReader counts the bytes read through it. The stream it wraps is set with wrap.
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (r *countingReader) wrap(stream io.Reader) io.Reader {
+	r.r = stream
+	return r
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// countingWriter counts the writes made through it
+type countingWriter struct {
+	w      io.Writer
+	chunks *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.chunks.Add(1)
+	return w.w.Write(p)
+}
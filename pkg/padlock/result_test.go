@@ -0,0 +1,127 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestOperationResults(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-result-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	testData := bytes.Repeat([]byte("report me "), 500)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), testData, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	encodedDir := filepath.Join(tempDir, "encoded")
+	var encodeResult Result
+	cfg := EncodeConfig{
+		InputDir:        inputDir,
+		OutputDir:       encodedDir,
+		N:               3,
+		K:               2,
+		Format:          FormatBin,
+		ChunkSize:       1024,
+		RNG:             pad.NewDefaultRand(ctx),
+		ClearIfNotEmpty: true,
+		Compression:     CompressionGzip,
+		Result:          &encodeResult,
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	r := encodeResult
+	if !r.Success || r.Operation != "encode" || r.Copies != 3 || r.Required != 2 || r.Compression != "gzip" || len(r.Collections) != 3 {
+		t.Fatalf("Unexpected encode result: %+v", r)
+	}
+	if r.InputBytes <= int64(len(testData)) || r.CompressedBytes <= 0 || r.CompressedBytes >= r.InputBytes || r.Chunks < 1 {
+		t.Errorf("Unexpected encode sizes: %+v", r)
+	}
+	var total int64
+	for _, coll := range r.Collections {
+		size, err := diskSize(filepath.Join(encodedDir, coll.Name))
+		if err != nil || coll.Bytes != size || coll.Chunks != r.Chunks {
+			t.Errorf("Collection %s: reported %d bytes in %d chunks, %d on disk", coll.Name, coll.Bytes, coll.Chunks, size)
+		}
+		total += coll.Bytes
+	}
+	if r.OutputBytes != total {
+		t.Errorf("Expected output bytes %d, got %d", total, r.OutputBytes)
+	}
+
+	// The result is valid JSON that reads back the same
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatalf("Failed to write JSON: %v", err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded.OutputBytes != r.OutputBytes || len(decoded.Collections) != 3 {
+		t.Errorf("JSON did not read back: %v\n%s", err, buf.String())
+	}
+
+	// A dry run reports the same sizes without writing anything
+	var dryResult Result
+	dryCfg := cfg
+	dryCfg.OutputDir = filepath.Join(tempDir, "dryrun")
+	dryCfg.SizeOnly = true
+	dryCfg.Result = &dryResult
+	if err := EncodeDirectory(ctx, dryCfg); err != nil {
+		t.Fatalf("Failed dry run: %v", err)
+	}
+	if !dryResult.DryRun || dryResult.InputBytes != r.InputBytes || dryResult.Chunks != r.Chunks || dryResult.Collections[0].Path != "" {
+		t.Errorf("Unexpected dry run result: %+v", dryResult)
+	}
+
+	// Decode reports the scheme, the collections read, and the restored size
+	var decodeResult Result
+	outputDir := filepath.Join(tempDir, "output")
+	decodeCfg := DecodeConfig{
+		InputDirs:   []string{filepath.Join(encodedDir, "2A3"), filepath.Join(encodedDir, "2C3")},
+		OutputDir:   outputDir,
+		Compression: CompressionGzip,
+		Result:      &decodeResult,
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	r = decodeResult
+	if !r.Success || r.Operation != "decode" || r.Copies != 3 || r.Required != 2 || r.Chunks != encodeResult.Chunks || len(r.Collections) != 2 {
+		t.Errorf("Unexpected decode result: %+v", r)
+	}
+	if r.OutputBytes != int64(len(testData)) || r.InputBytes != r.Collections[0].Bytes+r.Collections[1].Bytes || r.OutputDir != outputDir {
+		t.Errorf("Unexpected decode sizes: %+v", r)
+	}
+
+	// Failures are reported in the result too
+	var failedResult Result
+	decodeCfg.InputDirs = []string{filepath.Join(tempDir, "missing")}
+	decodeCfg.Result = &failedResult
+	if err := DecodeDirectory(ctx, decodeCfg); err == nil {
+		t.Fatalf("Expected decoding a missing directory to fail")
+	}
+	if failedResult.Success || failedResult.Error == "" {
+		t.Errorf("Expected the failure in the result: %+v", failedResult)
+	}
+}
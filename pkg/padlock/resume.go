@@ -0,0 +1,317 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// encodeProgress is the checkpoint recorded in a collection directory while it is encoded.
+// Chunks are written to every collection in turn, so once chunk C+1 is started, the first C
+// chunks are complete in every collection; they encode the first StreamOffset bytes of the
+// serialized and compressed input.
+type encodeProgress struct {
+	Collection       string `json:"collection"`
+	StoredName       string `json:"stored_name,omitempty"`
+	Copies           int    `json:"copies"`
+	Required         int    `json:"required"`
+	Sharing          string `json:"sharing,omitempty"`
+	Format           Format `json:"format"`
+	ChunkSize        int    `json:"chunk_size"`
+	Compression      string `json:"compression"`
+	CompressionLevel int    `json:"compression_level,omitempty"`
+	CompressionAuto  bool   `json:"compression_auto,omitempty"`
+	Chunks           int    `json:"chunks"`        // Chunks completely written to every collection
+	StreamOffset     int64  `json:"stream_offset"` // Bytes of the input stream those chunks encode
+	StreamSHA256     string `json:"stream_sha256"` // Hash of those bytes, to detect input that changed before a resume
+}
+
+// streamMarks is the number of chunk boundaries streamHasher remembers. The pad reads input
+// up to two chunks ahead of the chunk it is writing, while a checkpoint needs the boundary
+// before that chunk.
+const streamMarks = 4
+
+// streamHasher hashes the input stream as the pad reads it, and remembers the hash at the
+// most recent chunk boundaries. Reads are split at boundaries so that the hash is known
+// at each one. The pad reads input and starts chunks on different goroutines, so the marks
+// are guarded by a mutex.
+type streamHasher struct {
+	r          io.Reader
+	h          hash.Hash
+	offset     int64
+	blockBytes int64
+	mu         sync.Mutex
+	marks      [streamMarks]streamMark // The most recent chunk boundaries, oldest first
+}
+
+// streamMark is the hash of the stream up to a chunk boundary
+type streamMark struct {
+	offset int64
+	sum    string
+}
+
+func newStreamHasher(r io.Reader, blockBytes int) *streamHasher {
+	s := &streamHasher{r: r, h: sha256.New(), blockBytes: int64(blockBytes)}
+	s.marks[streamMarks-1] = streamMark{offset: 0, sum: hex.EncodeToString(s.h.Sum(nil))}
+	return s
+}
+
+func (s *streamHasher) Read(p []byte) (int, error) {
+	if remaining := s.blockBytes - s.offset%s.blockBytes; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := s.r.Read(p)
+	s.h.Write(p[:n])
+	s.offset += int64(n)
+	if n > 0 && s.offset%s.blockBytes == 0 {
+		mark := streamMark{offset: s.offset, sum: hex.EncodeToString(s.h.Sum(nil))}
+		s.mu.Lock()
+		copy(s.marks[:], s.marks[1:])
+		s.marks[streamMarks-1] = mark
+		s.mu.Unlock()
+	}
+	return n, err
+}
+
+// sumAt returns the hash of the stream up to offset, if it is one of the most recent chunk
+// boundaries
+func (s *streamHasher) sumAt(offset int64) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.marks {
+		if m.sum != "" && m.offset == offset {
+			return m.sum, true
+		}
+	}
+	return "", false
+}
+
+// skip reads and discards the input already encoded by an interrupted encode, checking that
+// it hashes to what the interrupted encode recorded
+func (s *streamHasher) skip(offset int64, sum string) error {
+	if _, err := io.CopyN(io.Discard, s, offset); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("the input is shorter than when the encode was interrupted, so it can't be resumed")
+		}
+		return fmt.Errorf("failed to read the input already encoded: %w", err)
+	}
+	if got, _ := s.sumAt(offset); got != sum {
+		return fmt.Errorf("the input has changed since the encode was interrupted, so it can't be resumed")
+	}
+	return nil
+}
+
+// encodeCheckpointer records progress in every collection directory as chunks are completed
+type encodeCheckpointer struct {
+	ctx         context.Context
+	collections []file.Collection
+	progress    encodeProgress // Everything but the collection names and position
+	hasher      *streamHasher
+	inputBytes  int64 // Input bytes encoded by each chunk but the last
+	chunks      int   // Chunks recorded by the last checkpoint
+}
+
+// wrap returns a chunk function that records a checkpoint whenever a new chunk is started,
+// since all earlier chunks are then complete in every collection
+func (c *encodeCheckpointer) wrap(newChunk pad.NewChunkFunc) pad.NewChunkFunc {
+	return func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		if chunkNumber-1 > c.chunks {
+			if err := c.save(chunkNumber - 1); err != nil {
+				return nil, err
+			}
+		}
+		return newChunk(collectionName, chunkNumber, chunkFormat)
+	}
+}
+
+// save records that the first chunks chunks are complete
+func (c *encodeCheckpointer) save(chunks int) error {
+	offset := int64(chunks) * c.inputBytes
+	sum, ok := c.hasher.sumAt(offset)
+	if !ok {
+		return fmt.Errorf("no stream checkpoint at chunk %d", chunks)
+	}
+	progress := c.progress
+	progress.Chunks = chunks
+	progress.StreamOffset = offset
+	progress.StreamSHA256 = sum
+	for _, coll := range c.collections {
+		progress.Collection = coll.Name
+		progress.StoredName = coll.StoredName
+		if err := writeEncodeProgress(coll.Path, &progress); err != nil {
+			return err
+		}
+	}
+	c.chunks = chunks
+	trace.FromContext(c.ctx).WithPrefix("padlock").Debugf("Checkpoint: %d chunks (%d bytes of input) complete", chunks, offset)
+	return nil
+}
+
+// finish removes the progress files once the encode is complete
+func (c *encodeCheckpointer) finish() error {
+	for _, coll := range c.collections {
+		if err := os.Remove(filepath.Join(coll.Path, file.ProgressFileName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove progress file: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeEncodeProgress replaces the progress file in a collection directory, writing it
+// under a temporary name first so that a crash never leaves it half written
+func writeEncodeProgress(collPath string, progress *encodeProgress) error {
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode progress: %w", err)
+	}
+	path := filepath.Join(collPath, file.ProgressFileName)
+	if err := os.WriteFile(path+".tmp", append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write progress file: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write progress file: %w", err)
+	}
+	return nil
+}
+
+// readEncodeProgress reads the progress file in a collection directory
+func readEncodeProgress(collPath string) (*encodeProgress, error) {
+	data, err := os.ReadFile(filepath.Join(collPath, file.ProgressFileName))
+	if err != nil {
+		return nil, err
+	}
+	var progress encodeProgress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return nil, fmt.Errorf("invalid progress file in %s: %w", collPath, err)
+	}
+	return &progress, nil
+}
+
+// checkResumable reports why an encode can't be resumed, if it can't. Only collections
+// written as files to local directories keep their progress.
+func checkResumable(cfg EncodeConfig, destinations []file.Destination) error {
+	switch {
+	case cfg.SizeOnly:
+		return fmt.Errorf("-resume cannot be combined with -dryrun")
+	case cfg.ChunkSink != nil || cfg.InputStream != nil || cfg.RawInput != nil:
+		return fmt.Errorf("only an encode of an input directory to output directories can be resumed")
+	case cfg.ArchiveCollections:
+		return fmt.Errorf("only collections written as files (-files) can be resumed")
+	}
+	for _, dest := range destinations {
+		if dest.LocalDir() != dest.String() {
+			return fmt.Errorf("collections for %s can't be resumed, because they are staged and uploaded at the end", dest)
+		}
+	}
+	return nil
+}
+
+// loadEncodeProgress finds the collections of an interrupted encode and the checkpoint to
+// continue from: the one with the fewest chunks, since chunks after it may be incomplete in
+// some collections. It also restores the compression and chunk size the interrupted encode chose.
+func loadEncodeProgress(ctx context.Context, cfg *EncodeConfig, names []string) ([]file.Collection, *encodeProgress, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	// Collection directories are the output directories themselves, or inside the output directory
+	var dirs []string
+	if len(cfg.OutputDirs) > 1 {
+		dirs = cfg.OutputDirs
+	} else {
+		entries, err := os.ReadDir(cfg.OutputDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read output directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirs = append(dirs, filepath.Join(cfg.OutputDir, entry.Name()))
+			}
+		}
+	}
+
+	found := make(map[string]file.Collection)
+	var resume *encodeProgress
+	for _, dir := range dirs {
+		progress, err := readEncodeProgress(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		// An automatic chunk size is whatever the interrupted encode chose
+		chunkSize := cfg.ChunkSize
+		if cfg.autoChunkSize {
+			chunkSize = progress.ChunkSize
+		}
+		if progress.Copies != cfg.N || progress.Required != cfg.K || progress.Format != cfg.Format || progress.ChunkSize != chunkSize {
+			return nil, nil, fmt.Errorf("the interrupted encode in %s was %d-of-%d with format %s and chunk size %d; resume it with the same settings",
+				dir, progress.Required, progress.Copies, progress.Format, progress.ChunkSize)
+		}
+		if progress.Sharing != cfg.sharing().Name() {
+			sharing, err := pad.SharingByName(progress.Sharing)
+			if err != nil {
+				return nil, nil, fmt.Errorf("the interrupted encode in %s: %w", dir, err)
+			}
+			return nil, nil, fmt.Errorf("the interrupted encode in %s used %s sharing; resume it with the same settings", dir, pad.SharingName(sharing))
+		}
+		found[progress.Collection] = file.Collection{Name: progress.Collection, StoredName: progress.StoredName, Path: dir, Format: cfg.Format}
+		if resume == nil || progress.Chunks < resume.Chunks {
+			resume = progress
+		}
+	}
+	if resume == nil {
+		return nil, nil, fmt.Errorf("no interrupted encode to resume was found in %s", cfg.OutputDir)
+	}
+
+	collections := make([]file.Collection, len(names))
+	for i, name := range names {
+		coll, ok := found[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("collection %s of the interrupted encode is missing, so it can't be resumed", name)
+		}
+		collections[i] = coll
+	}
+
+	// The input must be compressed exactly as before for the checkpoint to match
+	compression, _, err := ParseCompression(resume.Compression)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.Compression = compression
+	cfg.CompressionLevel = resume.CompressionLevel
+	cfg.autoCompressed = resume.CompressionAuto
+	cfg.ChunkSize = resume.ChunkSize
+
+	log.Infof("Resuming encode after chunk %d (%s of input already encoded)", resume.Chunks, FormatByteSize(resume.StreamOffset))
+	return collections, resume, nil
+}
+
+// openRestoreManifest opens the manifest that records the files a decode has restored to
+// cfg.OutputDir, continuing the one left by an interrupted decode if cfg.Resume is set
+func openRestoreManifest(ctx context.Context, cfg DecodeConfig) (*file.RestoreManifest, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	manifest, err := file.OpenRestoreManifest(cfg.OutputDir, cfg.Resume)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if cfg.Resume {
+		log.Infof("Resuming decode: %d files were restored by the interrupted decode", manifest.Len())
+	}
+	return manifest, nil
+}
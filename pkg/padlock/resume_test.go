@@ -0,0 +1,273 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// failingRNG fails after a number of reads, simulating an encode that dies part way through
+// without cleaning up
+type failingRNG struct {
+	pad.RNG
+	reads int
+}
+
+func (r *failingRNG) Read(ctx context.Context, p []byte) error {
+	r.reads--
+	if r.reads < 0 {
+		return fmt.Errorf("entropy source failed")
+	}
+	return r.RNG.Read(ctx, p)
+}
+
+func TestResumeEncode(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-resume-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	content := make([]byte, 20000)
+	for i := range content {
+		content[i] = byte(i*i + i/7)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.bin"), content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	for _, stealth := range []bool{false, true} {
+		ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+		outputDir := filepath.Join(tempDir, fmt.Sprintf("output-%v", stealth))
+		cfg := EncodeConfig{
+			InputDir:        inputDir,
+			OutputDir:       outputDir,
+			N:               3,
+			K:               2,
+			Format:          FormatBin,
+			ChunkSize:       256,
+			RNG:             &failingRNG{RNG: pad.NewDefaultRand(ctx), reads: 40},
+			ClearIfNotEmpty: true,
+			Compression:     CompressionGzip,
+			StealthNames:    stealth,
+			KeepPartial:     true, // As a crash would, rather than roll back the failed encode
+		}
+		if err := EncodeDirectory(ctx, cfg); err == nil || !strings.Contains(err.Error(), "entropy source failed") {
+			t.Fatalf("Expected the encode to fail, got %v", err)
+		}
+
+		entries, err := os.ReadDir(outputDir)
+		if err != nil || len(entries) != 3 {
+			t.Fatalf("Expected the collections of the failed encode to remain: %v %v", entries, err)
+		}
+		for _, entry := range entries {
+			if !file.IsPartialPath(entry.Name()) {
+				t.Errorf("Expected the unfinished collection %s to have its partial name", entry.Name())
+			}
+		}
+		if err := DecodeDirectory(ctx, DecodeConfig{InputDir: outputDir, OutputDir: filepath.Join(tempDir, "partial")}); err == nil {
+			t.Errorf("Expected decode to ignore the partial collections")
+		}
+		progress, err := readEncodeProgress(filepath.Join(outputDir, entries[0].Name()))
+		if err != nil {
+			t.Fatalf("Expected a progress file: %v", err)
+		}
+		if progress.Chunks == 0 || progress.StreamOffset == 0 || progress.Compression != "gzip" {
+			t.Errorf("Unexpected progress %+v", progress)
+		}
+
+		// Resume, without asking for the compression or stealth names again
+		cfg.RNG = pad.NewDefaultRand(ctx)
+		cfg.ClearIfNotEmpty = false
+		cfg.Compression = CompressionAuto
+		cfg.StealthNames = false
+		cfg.Resume = true
+		if err := EncodeDirectory(ctx, cfg); err != nil {
+			t.Fatalf("Failed to resume encode: %v", err)
+		}
+		for _, entry := range entries {
+			finalPath := file.FinalPath(filepath.Join(outputDir, entry.Name()))
+			if _, err := os.Stat(finalPath); err != nil {
+				t.Errorf("Expected %s to be renamed when complete: %v", entry.Name(), err)
+			}
+			if _, err := os.Stat(filepath.Join(finalPath, file.ProgressFileName)); !os.IsNotExist(err) {
+				t.Errorf("Expected the progress file in %s to be removed", entry.Name())
+			}
+		}
+
+		decodedDir := filepath.Join(tempDir, fmt.Sprintf("decoded-%v", stealth))
+		if err := DecodeDirectory(ctx, DecodeConfig{InputDir: outputDir, OutputDir: decodedDir}); err != nil {
+			t.Fatalf("Failed to decode resumed encode: %v", err)
+		}
+		data, err := os.ReadFile(filepath.Join(decodedDir, "test.bin"))
+		if err != nil || !bytes.Equal(data, content) {
+			t.Errorf("Decoded content of resumed encode doesn't match the input: %v", err)
+		}
+
+		// Once complete, there's nothing left to resume
+		if err := EncodeDirectory(ctx, cfg); err == nil || !strings.Contains(err.Error(), "no interrupted encode") {
+			t.Errorf("Expected an error resuming a complete encode, got %v", err)
+		}
+	}
+}
+
+func TestResumeEncodeErrors(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-resume-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(strings.Repeat("resume ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	outputDir := filepath.Join(tempDir, "output")
+	cfg := EncodeConfig{
+		InputDir:        inputDir,
+		OutputDir:       outputDir,
+		N:               3,
+		K:               2,
+		Format:          FormatBin,
+		ChunkSize:       256,
+		RNG:             &failingRNG{RNG: pad.NewDefaultRand(ctx), reads: 40},
+		ClearIfNotEmpty: true,
+		Compression:     CompressionNone,
+		KeepPartial:     true,
+	}
+	if err := EncodeDirectory(ctx, cfg); err == nil {
+		t.Fatalf("Expected the encode to fail")
+	}
+	cfg.RNG = pad.NewDefaultRand(ctx)
+	cfg.Resume = true
+
+	// Archives keep no progress
+	archived := cfg
+	archived.ArchiveCollections = true
+	if err := EncodeDirectory(ctx, archived); err == nil || !strings.Contains(err.Error(), "-files") {
+		t.Errorf("Expected an error resuming archives, got %v", err)
+	}
+
+	// A different scheme
+	other := cfg
+	other.K = 3
+	if err := EncodeDirectory(ctx, other); err == nil || !strings.Contains(err.Error(), "same settings") {
+		t.Errorf("Expected an error resuming with different settings, got %v", err)
+	}
+
+	// Input that changed within the part already encoded
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), []byte(strings.Repeat("RESUME ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to change test file: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Errorf("Expected an error resuming with changed input, got %v", err)
+	}
+}
+
+func TestResumeDecode(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-resume-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	files := map[string][]byte{
+		"a.txt": bytes.Repeat([]byte("alpha "), 500),
+		"b.txt": bytes.Repeat([]byte("bravo "), 500),
+		"c.txt": bytes.Repeat([]byte("charlie "), 500),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(inputDir, name), content, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	encodedDir := filepath.Join(tempDir, "encoded")
+	if err := EncodeDirectory(ctx, EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          encodedDir,
+		N:                  3,
+		K:                  2,
+		Format:             FormatBin,
+		ChunkSize:          512,
+		RNG:                pad.NewDefaultRand(ctx),
+		ClearIfNotEmpty:    true,
+		Compression:        CompressionGzip,
+		ArchiveCollections: true,
+	}); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	// A decode that died after restoring a.txt and part of b.txt
+	outputDir := filepath.Join(tempDir, "output")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output dir: %v", err)
+	}
+	os.WriteFile(filepath.Join(outputDir, "a.txt"), files["a.txt"], 0644)
+	os.WriteFile(filepath.Join(outputDir, "b.txt"), files["b.txt"][:100], 0644)
+	manifest, err := file.OpenRestoreManifest(outputDir, false)
+	if err != nil {
+		t.Fatalf("Failed to open restore manifest: %v", err)
+	}
+	manifest.Record("a.txt")
+	manifest.Close()
+	before, _ := os.Stat(filepath.Join(outputDir, "a.txt"))
+
+	// Without -resume, the output directory isn't empty
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodedDir, OutputDir: outputDir}); err == nil {
+		t.Errorf("Expected decode to refuse a non-empty output directory")
+	}
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodedDir, OutputDir: outputDir, Resume: true, ClearIfNotEmpty: true}); err == nil {
+		t.Errorf("Expected an error for resume with clear")
+	}
+
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: encodedDir, OutputDir: outputDir, Resume: true}); err != nil {
+		t.Fatalf("Failed to resume decode: %v", err)
+	}
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("Restored %s doesn't match the input: %v", name, err)
+		}
+	}
+	after, _ := os.Stat(filepath.Join(outputDir, "a.txt"))
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("Expected a.txt, already restored, not to be rewritten")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, file.RestoreManifestName)); !os.IsNotExist(err) {
+		t.Errorf("Expected the restore manifest to be removed after the decode completed")
+	}
+}
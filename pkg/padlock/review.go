@@ -0,0 +1,82 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// CheckReviewDates reads the metadata of each collection and logs a prominent warning for
+// every collection whose review-by date has passed, returning the names of those collections.
+// key decrypts sealed metadata; collections whose metadata cannot be read are skipped.
+//
+// Storage media degrade and custodians change, so a review date prompts owners to confirm
+// that their shares are still readable and to re-encode onto fresh media. Collections
+// without metadata or without a review date are never reported.
+func CheckReviewDates(ctx context.Context, collections []file.Collection, key []byte, now time.Time) []string {
+	log := trace.FromContext(ctx).WithPrefix("review")
+
+	var overdue []string
+	var reviewBy time.Time
+	for _, coll := range collections {
+		md, err := file.ReadMetadata(ctx, coll, key)
+		if err != nil {
+			log.Debugf("No review date available for collection %s: %v", coll.Name, err)
+			continue
+		}
+		if md.PastReview(now) {
+			overdue = append(overdue, coll.Name)
+			if reviewBy.IsZero() || md.ReviewBy.Before(reviewBy) {
+				reviewBy = md.ReviewBy
+			}
+		}
+	}
+
+	if len(overdue) > 0 {
+		days := int(now.Sub(reviewBy).Hours() / 24)
+		log.Infof("********************************************************************")
+		log.Infof("WARNING: collections %s are past their review date", strings.Join(overdue, ", "))
+		log.Infof("WARNING: review was due %s (%d days ago)", reviewBy.Format(time.DateOnly), days)
+		log.Infof("WARNING: verify that every share is still readable and re-encode onto fresh media")
+		log.Infof("********************************************************************")
+	}
+
+	return overdue
+}
+
+// ParseReviewBy parses a review-by date given either as an absolute date (YYYY-MM-DD) or as
+// a period from now: a number followed by d (days), w (weeks), m (months), or y (years),
+// e.g. "18m". The result is midnight UTC of the resulting day.
+func ParseReviewBy(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+
+	if len(s) >= 2 {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err == nil && n > 0 {
+			now = now.UTC()
+			day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+			switch strings.ToLower(s[len(s)-1:]) {
+			case "d":
+				return day.AddDate(0, 0, n), nil
+			case "w":
+				return day.AddDate(0, 0, 7*n), nil
+			case "m":
+				return day.AddDate(0, n, 0), nil
+			case "y":
+				return day.AddDate(n, 0, 0), nil
+			}
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid review date %q: use YYYY-MM-DD or a period such as 90d, 12w, 18m, or 2y", s)
+}
@@ -0,0 +1,77 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestParseReviewBy(t *testing.T) {
+	now := time.Date(2025, 1, 31, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2026-06-30", time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC), false},
+		{"10d", time.Date(2025, 2, 10, 0, 0, 0, 0, time.UTC), false},
+		{"2w", time.Date(2025, 2, 14, 0, 0, 0, 0, time.UTC), false},
+		{"18m", time.Date(2026, 7, 31, 0, 0, 0, 0, time.UTC), false},
+		{"2Y", time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC), false},
+		{"0d", time.Time{}, true},
+		{"soon", time.Time{}, true},
+		{"2026/06/30", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseReviewBy(tt.input, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseReviewBy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !got.Equal(tt.want) {
+			t.Errorf("ParseReviewBy(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestCheckReviewDates(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	tempDir, err := os.MkdirTemp("", "padlock-review-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	reviewBy := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	var collections []file.Collection
+	for _, name := range []string{"2A3", "2B3", "2C3"} {
+		collPath := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(collPath, 0755); err != nil {
+			t.Fatalf("Failed to create collection dir: %v", err)
+		}
+		collections = append(collections, file.Collection{Name: name, Path: collPath, Format: FormatBin})
+		if name == "2C3" {
+			continue // no metadata
+		}
+		md := &file.Metadata{Version: file.MetadataVersion, Collection: name, Copies: 3, Required: 2, ReviewBy: reviewBy}
+		if err := file.WriteMetadata(ctx, collPath, md); err != nil {
+			t.Fatalf("WriteMetadata failed: %v", err)
+		}
+	}
+
+	if overdue := CheckReviewDates(ctx, collections, nil, reviewBy.Add(-time.Hour)); len(overdue) != 0 {
+		t.Errorf("Expected no overdue collections before the review date, got %v", overdue)
+	}
+	overdue := CheckReviewDates(ctx, collections, nil, reviewBy.AddDate(0, 0, 1))
+	if len(overdue) != 2 || overdue[0] != "2A3" || overdue[1] != "2B3" {
+		t.Errorf("Expected 2A3 and 2B3 to be overdue, got %v", overdue)
+	}
+}
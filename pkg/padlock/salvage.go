@@ -0,0 +1,70 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// PartialSuffix is appended to the name of a file that a salvaged decode could only restore
+// in part, so that it can't be mistaken for the complete file
+const PartialSuffix = ".partial"
+
+// SalvageResult describes what a decode with DecodeConfig.Salvage kept when part of the data
+// couldn't be decoded. The data is decoded in order, so everything before the first chunk
+// that couldn't be decoded is restored, and everything after it is lost.
+type SalvageResult struct {
+	Restored       []string `json:"restored"`                  // Files restored completely
+	Truncated      string   `json:"truncated,omitempty"`       // File that was cut short, kept with PartialSuffix
+	TruncatedBytes int64    `json:"truncated_bytes,omitempty"` // Bytes of the truncated file that were restored
+	ExpectedBytes  int64    `json:"expected_bytes,omitempty"`  // Size of the truncated file when it was encoded
+	LostChunk      int      `json:"lost_chunk,omitempty"`      // First chunk that couldn't be decoded, if known
+	Reason         string   `json:"reason"`                    // Why the rest of the data couldn't be restored
+}
+
+// salvageDecode keeps what a decode restored before it failed with err, and reports it: the
+// files restored completely, which manifest records, and the file that was being restored
+// when the data ran out, which deserializeErr names if it was cut short. The files after it
+// are missing, but can't be named, since the list of files is at the end of the data. The
+// returned error still wraps err, since the restore is incomplete.
+func salvageDecode(ctx context.Context, cfg DecodeConfig, manifest *file.RestoreManifest, lostChunk int, err, deserializeErr error) error {
+	log := trace.FromContext(ctx).WithPrefix("salvage")
+
+	report := &SalvageResult{Restored: manifest.Files(), LostChunk: lostChunk, Reason: err.Error()}
+	var truncated *file.TruncatedFileError
+	if errors.As(deserializeErr, &truncated) {
+		path := filepath.Join(cfg.OutputDir, truncated.Name)
+		if rerr := os.Rename(path, path+PartialSuffix); rerr != nil {
+			log.Error(fmt.Errorf("failed to rename truncated file %s: %w", path, rerr))
+		} else {
+			report.Truncated = truncated.Name + PartialSuffix
+			report.TruncatedBytes, report.ExpectedBytes = truncated.Written, truncated.Size
+		}
+	}
+
+	if lostChunk > 0 {
+		log.Infof("Chunk %d couldn't be decoded, so the data from there on is lost", lostChunk)
+	} else {
+		log.Infof("The data couldn't be decoded past a failure, so the rest of it is lost")
+	}
+	log.Infof("Salvaged %d files restored completely in %s", len(report.Restored), cfg.OutputDir)
+	for _, name := range report.Restored {
+		log.Debugf("  restored: %s", name)
+	}
+	if report.Truncated != "" {
+		log.Infof("Truncated: %s holds %d of its %d bytes", report.Truncated, report.TruncatedBytes, report.ExpectedBytes)
+	}
+	log.Infof("Any files after that are missing; they can't be listed, since the list of files is at the end of the data")
+
+	if cfg.Result != nil {
+		cfg.Result.Salvage = report
+	}
+	return fmt.Errorf("salvaged %d files, but the rest of the data couldn't be decoded: %w", len(report.Restored), err)
+}
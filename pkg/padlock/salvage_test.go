@@ -0,0 +1,102 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestSalvageDecode checks that a decode with Salvage keeps the files restored before a chunk
+// that can't be decoded, and the file that chunk cut short, and reports them
+func TestSalvageDecode(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	files := map[string][]byte{
+		"a.txt": bytes.Repeat([]byte("a"), 1000),
+		"b.txt": bytes.Repeat([]byte("b"), 20000),
+		"c.txt": bytes.Repeat([]byte("c"), 1000),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(inputDir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	encodedDir := filepath.Join(tempDir, "encoded")
+	err := EncodeDirectory(ctx, EncodeConfig{
+		InputDir:    inputDir,
+		OutputDir:   encodedDir,
+		N:           3,
+		K:           2,
+		Format:      FormatBin,
+		ChunkSize:   512,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionNone,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	// Chunk 15, which falls in b.txt, is bad in two of the three collections
+	for _, coll := range []string{"2A3", "2B3"} {
+		chunkPath := filepath.Join(encodedDir, coll, coll+"_0015.bin")
+		data, err := os.ReadFile(chunkPath)
+		if err != nil {
+			t.Fatalf("Failed to read chunk: %v", err)
+		}
+		data[len(data)/2] ^= 0xff
+		if err := os.WriteFile(chunkPath, data, 0644); err != nil {
+			t.Fatalf("Failed to write chunk: %v", err)
+		}
+	}
+
+	outputDir := filepath.Join(tempDir, "salvaged")
+	var result Result
+	err = DecodeDirectory(ctx, DecodeConfig{InputDir: encodedDir, OutputDir: outputDir, Compression: CompressionNone, Salvage: true, Result: &result})
+	if !errors.Is(err, ErrCorruptChunk) && !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Expected the salvaged decode to fail with the bad chunk, got %v", err)
+	}
+	salvage := result.Salvage
+	if salvage == nil {
+		t.Fatalf("Expected a salvage report")
+	}
+	if len(salvage.Restored) != 1 || salvage.Restored[0] != "a.txt" {
+		t.Errorf("Expected only a.txt to be restored completely, got %q", salvage.Restored)
+	}
+	if salvage.Truncated != "b.txt"+PartialSuffix || salvage.ExpectedBytes != 20000 || salvage.TruncatedBytes <= 0 || salvage.TruncatedBytes >= 20000 {
+		t.Errorf("Expected b.txt to be reported as cut short, got %+v", salvage)
+	}
+	if salvage.LostChunk != 15 {
+		t.Errorf("Expected chunk 15 to be reported as lost, got %d", salvage.LostChunk)
+	}
+
+	// The restored file is complete, the truncated one holds what was decoded of it, and
+	// nothing was rolled back
+	if got, err := os.ReadFile(filepath.Join(outputDir, "a.txt")); err != nil || !bytes.Equal(got, files["a.txt"]) {
+		t.Errorf("a.txt was not restored (%v)", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(outputDir, "b.txt"+PartialSuffix)); err != nil || int64(len(got)) != salvage.TruncatedBytes || !bytes.Equal(got, files["b.txt"][:len(got)]) {
+		t.Errorf("b.txt%s doesn't hold the start of b.txt (%v)", PartialSuffix, err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "c.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected c.txt to be missing, got %v", err)
+	}
+	if len(result.RolledBack) > 0 {
+		t.Errorf("Expected nothing to be rolled back, got %q", result.RolledBack)
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// ReadDestinationsFile reads a destinations config: one local path or URL per line, such as
+// /media/usb1 or webdavs://cloud.example.com/remote.php/dav/files/alice/share2. Blank lines
+// and lines starting with "#" are ignored.
+func ReadDestinationsFile(path string) ([]string, error) {
+	return readLocationsFile(path, "destinations")
+}
+
+// ReadInputsFile reads a list of decode inputs: one collection location per line, as a local
+// path or URL like those given to decode as arguments. Blank lines and lines starting with "#"
+// are ignored, and relative paths are taken relative to the directory of the list, so that the
+// same list restores from the same places wherever it is run from.
+func ReadInputsFile(path string) ([]string, error) {
+	inputs, err := readLocationsFile(path, "inputs")
+	if err != nil {
+		return nil, err
+	}
+	for i, input := range inputs {
+		if !file.IsDestinationURL(input) && !filepath.IsAbs(input) {
+			inputs[i] = filepath.Join(filepath.Dir(path), input)
+		}
+	}
+	return inputs, nil
+}
+
+// readLocationsFile reads one local path or URL per line of a file listing what, skipping
+// blank lines and lines starting with "#"
+func readLocationsFile(path string, what string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s file: %w", what, err)
+	}
+	defer f.Close()
+
+	var locations []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		locations = append(locations, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s file: %w", what, err)
+	}
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("no %s in %s", what, path)
+	}
+	return locations, nil
+}
+
+// ScatterConfig holds the configuration for distributing encoded collections
+type ScatterConfig struct {
+	InputDir     string   // Directory holding the encoded collections, as written by encode
+	Destinations []string // One local path or URL for each collection, in collection name order
+}
+
+// GatherConfig holds the configuration for collecting collections back from their destinations
+type GatherConfig struct {
+	Destinations []string // Local paths or URLs to gather collections from, in the order to try them
+	OutputDir    string   // Directory to gather the collections into, for decode
+	All          bool     // Gather from every destination, rather than stopping once enough collections are gathered
+	MetadataKey  []byte   // Passphrase for encrypted collection metadata, which names collections stored under stealth names
+}
+
+// DestinationStatus is the outcome of scattering to or gathering from one destination
+type DestinationStatus struct {
+	Destination string   // Local path or URL as configured
+	Collections []string // Collections delivered to or gathered from the destination
+	Bytes       int64    // Size of those collections
+	Skipped     bool     // The destination wasn't needed, because enough collections were already gathered
+	Err         error    // Why the destination failed, if it did
+}
+
+// DistributionReport is the result of Scatter or Gather
+type DistributionReport struct {
+	Operation    string              // "scatter" or "gather"
+	Required     int                 // K, the collections needed to decode, if known
+	Total        int                 // N, the collections in the distribution, if known
+	Destinations []DestinationStatus // One entry per configured destination
+}
+
+// Collections returns the number of collections delivered or gathered
+func (r *DistributionReport) Collections() int {
+	n := 0
+	for _, status := range r.Destinations {
+		// A failed gather may still have gathered some collections, but a failed scatter
+		// delivered none
+		if status.Err == nil || r.Operation == "gather" {
+			n += len(status.Collections)
+		}
+	}
+	return n
+}
+
+// Failed returns the number of destinations that failed
+func (r *DistributionReport) Failed() int {
+	failed := 0
+	for _, status := range r.Destinations {
+		if status.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Recoverable reports whether enough collections were delivered or gathered to decode
+func (r *DistributionReport) Recoverable() bool {
+	return r.Required > 0 && r.Collections() >= r.Required
+}
+
+// Print writes a line of status for each destination, and a summary
+func (r *DistributionReport) Print(w io.Writer) {
+	for _, status := range r.Destinations {
+		switch {
+		case status.Err != nil:
+			fmt.Fprintf(w, "FAILED   %-12s %s\n    - %v\n", strings.Join(status.Collections, ","), status.Destination, status.Err)
+		case status.Skipped:
+			fmt.Fprintf(w, "skipped  %-12s %s\n", "", status.Destination)
+		default:
+			fmt.Fprintf(w, "ok       %-12s %s (%s)\n", strings.Join(status.Collections, ","), status.Destination, FormatByteSize(status.Bytes))
+		}
+	}
+
+	verb := "delivered"
+	if r.Operation == "gather" {
+		verb = "gathered"
+	}
+	fmt.Fprintf(w, "%d of %d destinations failed; %d collections %s", r.Failed(), len(r.Destinations), r.Collections(), verb)
+	switch {
+	case r.Required == 0:
+		fmt.Fprintf(w, "\n")
+	case r.Recoverable():
+		fmt.Fprintf(w, ", %d needed to decode\n", r.Required)
+	default:
+		fmt.Fprintf(w, ", but %d are needed to decode\n", r.Required)
+	}
+}
+
+// Scatter delivers the collections in cfg.InputDir one per destination, so that each
+// custodian's destination receives a single collection. Collections are matched to
+// destinations in collection name order. A destination that fails doesn't stop the others;
+// the report tells which collections were delivered.
+func Scatter(ctx context.Context, cfg ScatterConfig) (*DistributionReport, error) {
+	log := trace.FromContext(ctx).WithPrefix("scatter")
+
+	collections, tempDir, err := file.FindCollections(ctx, cfg.InputDir)
+	if err != nil {
+		return nil, err
+	}
+	if tempDir != "" {
+		defer os.RemoveAll(tempDir)
+	}
+	if len(collections) == 0 {
+		err := fmt.Errorf("no collections found in %s: %w", cfg.InputDir, ErrInsufficientCollections)
+		log.Error(err)
+		return nil, err
+	}
+	if len(collections) != len(cfg.Destinations) {
+		err := fmt.Errorf("%d collections found in %s, but %d destinations given; each collection needs its own destination",
+			len(collections), cfg.InputDir, len(cfg.Destinations))
+		log.Error(err)
+		return nil, err
+	}
+	sort.Slice(collections, func(i, j int) bool { return collections[i].Name < collections[j].Name })
+
+	report := &DistributionReport{Operation: "scatter"}
+	if header, err := firstChunkHeader(ctx, collections[0], nil); err == nil {
+		report.Required, report.Total = header.RequiredCopies, header.TotalCopies
+	}
+
+	for i, coll := range collections {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		status := DestinationStatus{Destination: cfg.Destinations[i], Collections: []string{coll.DiskName()}}
+		log.Infof("Delivering collection %s to %s", coll.DiskName(), status.Destination)
+		status.Bytes, status.Err = scatterCollection(ctx, coll, status.Destination)
+		if status.Err != nil {
+			log.Error(fmt.Errorf("failed to deliver collection %s to %s: %w", coll.DiskName(), status.Destination, status.Err))
+		}
+		report.Destinations = append(report.Destinations, status)
+	}
+	return report, nil
+}
+
+// scatterCollection copies a collection to a destination and publishes it
+func scatterCollection(ctx context.Context, coll file.Collection, destination string) (int64, error) {
+	dest, err := file.ParseDestination(ctx, destination)
+	if err != nil {
+		return 0, err
+	}
+	defer dest.Cleanup()
+
+	if err := os.MkdirAll(dest.LocalDir(), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	size, err := copyCollection(coll, dest.LocalDir())
+	if err != nil {
+		return 0, err
+	}
+	return size, dest.Publish(ctx)
+}
+
+// Gather collects the collections at cfg.Destinations into cfg.OutputDir, so that they can
+// be decoded. Destinations are tried in order, and once K collections have been gathered the
+// rest are skipped, unless cfg.All is set. A destination that fails doesn't stop the others.
+func Gather(ctx context.Context, cfg GatherConfig) (*DistributionReport, error) {
+	log := trace.FromContext(ctx).WithPrefix("gather")
+
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		log.Error(fmt.Errorf("failed to create output directory: %w", err))
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	report := &DistributionReport{Operation: "gather"}
+	gathered := make(map[string]bool)
+	for _, destination := range cfg.Destinations {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		status := DestinationStatus{Destination: destination}
+		if !cfg.All && report.Recoverable() {
+			status.Skipped = true
+			report.Destinations = append(report.Destinations, status)
+			continue
+		}
+
+		log.Infof("Gathering collections from %s", destination)
+		status.Err = gatherDestination(ctx, cfg, destination, gathered, report, &status)
+		if status.Err != nil {
+			log.Error(fmt.Errorf("failed to gather from %s: %w", destination, status.Err))
+		}
+		report.Destinations = append(report.Destinations, status)
+	}
+	return report, nil
+}
+
+// gatherDestination fetches the collections at a destination and copies those not already
+// gathered into cfg.OutputDir
+func gatherDestination(ctx context.Context, cfg GatherConfig, destination string, gathered map[string]bool, report *DistributionReport, status *DestinationStatus) error {
+	log := trace.FromContext(ctx).WithPrefix("gather")
+
+	dest, err := file.ParseDestination(ctx, destination)
+	if err != nil {
+		return err
+	}
+	defer dest.Cleanup()
+	if source, ok := dest.(file.Source); ok {
+		if err := source.Fetch(ctx); err != nil {
+			return err
+		}
+	} else if dest.LocalDir() != dest.String() {
+		return fmt.Errorf("collections can't be read back from %s", dest)
+	}
+
+	collections, tempDir, err := file.FindCollections(ctx, dest.LocalDir())
+	if err != nil {
+		return err
+	}
+	if tempDir != "" {
+		defer os.RemoveAll(tempDir)
+	}
+	if len(collections) == 0 {
+		return fmt.Errorf("no collections found: %w", ErrInsufficientCollections)
+	}
+
+	for _, coll := range collections {
+		if gathered[coll.DiskName()] {
+			log.Debugf("Collection %s from %s was already gathered", coll.DiskName(), destination)
+			continue
+		}
+		header, err := firstChunkHeader(ctx, coll, cfg.MetadataKey)
+		if err != nil {
+			return fmt.Errorf("collection %s is unreadable: %w", coll.DiskName(), err)
+		}
+		if report.Required == 0 {
+			report.Required, report.Total = header.RequiredCopies, header.TotalCopies
+		} else if header.RequiredCopies != report.Required || header.TotalCopies != report.Total {
+			return fmt.Errorf("collection %s is %d-of-%d, but the collections already gathered are %d-of-%d: %w",
+				coll.DiskName(), header.RequiredCopies, header.TotalCopies, report.Required, report.Total, ErrMixedSessions)
+		}
+
+		size, err := copyCollection(coll, cfg.OutputDir)
+		if err != nil {
+			return err
+		}
+		gathered[coll.DiskName()] = true
+		status.Collections = append(status.Collections, coll.DiskName())
+		status.Bytes += size
+	}
+	return nil
+}
+
+// firstChunkHeader reads the header of a collection's first chunk, which records K and N, with
+// the metadata, which key opens if it is sealed, naming a collection stored under a stealth name
+func firstChunkHeader(ctx context.Context, coll file.Collection, key []byte) (pad.ChunkHeader, error) {
+	reader := file.NewCollectionReader(coll)
+	defer reader.Close()
+	chunk, err := reader.ReadNextChunk(ctx)
+	if err != nil {
+		return pad.ChunkHeader{}, fmt.Errorf("failed to read first chunk of collection %s: %w", coll.DiskName(), err)
+	}
+	return pad.ParseChunkHeaderWith(chunk, metadataAliases(ctx, []file.Collection{coll}, key))
+}
+
+// copyCollection copies a collection's directory or archive, and any volumes, into dir,
+// refusing to overwrite anything already there. It returns the number of bytes copied.
+func copyCollection(coll file.Collection, dir string) (int64, error) {
+	var total int64
+	for _, path := range append([]string{coll.Path}, coll.Volumes...) {
+		target := filepath.Join(dir, filepath.Base(path))
+		if _, err := os.Lstat(target); err == nil {
+			return total, fmt.Errorf("%s already exists", target)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return total, err
+		}
+		if info.IsDir() {
+			if err := os.CopyFS(target, os.DirFS(path)); err != nil {
+				return total, fmt.Errorf("failed to copy collection %s: %w", coll.DiskName(), err)
+			}
+		} else if err := copyFile(path, target); err != nil {
+			return total, fmt.Errorf("failed to copy collection %s: %w", coll.DiskName(), err)
+		}
+		size, err := diskSize(target)
+		if err != nil {
+			return total, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// copyFile copies a regular file to a path that must not exist yet
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,207 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestScatterAndGather(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-scatter-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	content := bytes.Repeat([]byte("scatter me "), 200)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	encodedDir := filepath.Join(tempDir, "encoded")
+	cfg := EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          encodedDir,
+		N:                  3,
+		K:                  2,
+		Format:             FormatBin,
+		ChunkSize:          256,
+		RNG:                pad.NewDefaultRand(ctx),
+		ClearIfNotEmpty:    true,
+		Compression:        CompressionNone,
+		ArchiveCollections: true,
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+
+	destinationsFile := filepath.Join(tempDir, "destinations.txt")
+	config := "# One line per custodian\n" +
+		filepath.Join(tempDir, "usb1") + "\n\n" +
+		"file://" + filepath.Join(tempDir, "usb2") + "\n" +
+		filepath.Join(tempDir, "usb3") + "\n"
+	if err := os.WriteFile(destinationsFile, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write destinations file: %v", err)
+	}
+	destinations, err := ReadDestinationsFile(destinationsFile)
+	if err != nil {
+		t.Fatalf("ReadDestinationsFile failed: %v", err)
+	}
+	if len(destinations) != 3 {
+		t.Fatalf("Expected 3 destinations, got %v", destinations)
+	}
+
+	// Each collection goes to its own destination
+	report, err := Scatter(ctx, ScatterConfig{InputDir: encodedDir, Destinations: destinations})
+	if err != nil {
+		t.Fatalf("Scatter failed: %v", err)
+	}
+	if report.Failed() != 0 || report.Collections() != 3 || report.Required != 2 || report.Total != 3 {
+		t.Errorf("Unexpected scatter report: %+v", report)
+	}
+	for i, name := range []string{"2A3.tar", "2B3.tar", "2C3.tar"} {
+		if _, err := os.Stat(filepath.Join(tempDir, "usb"+string(rune('1'+i)), name)); err != nil {
+			t.Errorf("Expected %s at destination %d: %v", name, i+1, err)
+		}
+	}
+
+	// Scattering again would overwrite the delivered collections, so every destination fails
+	report, err = Scatter(ctx, ScatterConfig{InputDir: encodedDir, Destinations: destinations})
+	if err != nil {
+		t.Fatalf("Scatter failed: %v", err)
+	}
+	if report.Failed() != 3 || report.Recoverable() {
+		t.Errorf("Expected every destination to fail, got %+v", report)
+	}
+	var out strings.Builder
+	report.Print(&out)
+	if !strings.Contains(out.String(), "already exists") {
+		t.Errorf("Expected the report to say why, got:\n%s", out.String())
+	}
+
+	if _, err := Scatter(ctx, ScatterConfig{InputDir: encodedDir, Destinations: destinations[:2]}); err == nil {
+		t.Errorf("Expected an error for fewer destinations than collections")
+	}
+
+	// With the first destination lost, gathering continues with the others, and stops once
+	// K collections are gathered
+	if err := os.RemoveAll(filepath.Join(tempDir, "usb1")); err != nil {
+		t.Fatalf("Failed to remove destination: %v", err)
+	}
+	extra := filepath.Join(tempDir, "usb4")
+	gatheredDir := filepath.Join(tempDir, "gathered")
+	report, err = Gather(ctx, GatherConfig{Destinations: append(destinations, extra), OutputDir: gatheredDir})
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	if !report.Recoverable() || report.Collections() != 2 || report.Failed() != 1 {
+		t.Errorf("Unexpected gather report: %+v", report)
+	}
+	if !report.Destinations[3].Skipped {
+		t.Errorf("Expected the last destination to be skipped once enough were gathered")
+	}
+
+	outputDir := filepath.Join(tempDir, "output")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDir: gatheredDir, OutputDir: outputDir}); err != nil {
+		t.Fatalf("Failed to decode gathered collections: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "test.txt"))
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("Decoded content mismatch: %v", err)
+	}
+
+	// Without enough destinations left, the data isn't recoverable
+	report, err = Gather(ctx, GatherConfig{Destinations: destinations[:2], OutputDir: filepath.Join(tempDir, "gathered2")})
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	if report.Recoverable() {
+		t.Errorf("Expected one collection to be too few to decode: %+v", report)
+	}
+}
+
+func TestReadDestinationsFileEmpty(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "padlock-scatter-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "destinations.txt")
+	if err := os.WriteFile(path, []byte("# nothing yet\n\n"), 0644); err != nil {
+		t.Fatalf("Failed to write destinations file: %v", err)
+	}
+	if _, err := ReadDestinationsFile(path); err == nil {
+		t.Errorf("Expected an error for a destinations file with no destinations")
+	}
+}
+
+// TestReadInputsFile checks that a list of decode inputs keeps URLs and absolute paths, takes
+// relative paths relative to the list, and decodes from the collections it lists
+func TestReadInputsFile(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	content := []byte(strings.Repeat("listed ", 1000))
+	if err := os.WriteFile(filepath.Join(inputDir, "data.txt"), content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	encodedDir := filepath.Join(tempDir, "encoded")
+	err := EncodeDirectory(ctx, EncodeConfig{
+		InputDir:    inputDir,
+		OutputDir:   encodedDir,
+		N:           3,
+		K:           2,
+		Format:      FormatBin,
+		ChunkSize:   1024,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	list := "# collections kept at home\nencoded/2A3\n\n" + filepath.Join(encodedDir, "2C3") + "\n# offsite\nwebdavs://cloud.example.com/share2\n"
+	path := filepath.Join(tempDir, "inputs.txt")
+	if err := os.WriteFile(path, []byte(list), 0644); err != nil {
+		t.Fatalf("Failed to write inputs file: %v", err)
+	}
+	inputs, err := ReadInputsFile(path)
+	if err != nil {
+		t.Fatalf("ReadInputsFile failed: %v", err)
+	}
+	want := []string{filepath.Join(encodedDir, "2A3"), filepath.Join(encodedDir, "2C3"), "webdavs://cloud.example.com/share2"}
+	if strings.Join(inputs, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("ReadInputsFile = %q, want %q", inputs, want)
+	}
+
+	decodeDir := filepath.Join(tempDir, "decoded")
+	if err := DecodeDirectory(ctx, DecodeConfig{InputDirs: inputs[:2], OutputDir: decodeDir, Compression: CompressionGzip}); err != nil {
+		t.Fatalf("Failed to decode the listed collections: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(decodeDir, "data.txt")); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("data.txt was not restored (%v)", err)
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// ChunkSink receives encoded chunks in place of collection directories or TAR files.
+//
+// Set EncodeConfig.ChunkSink to route chunks to a database, key-value store, or custom
+// service. Each chunk is the raw payload produced by the pad encoder, independent of the
+// bin or png output format, and must be stored so that ChunkSource.ReadChunk can later
+// return it unchanged.
+type ChunkSink interface {
+	// NewChunk returns a writer for one chunk of a collection. Chunk numbers start at 1
+	// and the chunk is complete when the writer is closed.
+	NewChunk(ctx context.Context, collection string, chunkNumber int) (io.WriteCloser, error)
+}
+
+// ChunkSinkFunc adapts a function to the ChunkSink interface
+type ChunkSinkFunc func(ctx context.Context, collection string, chunkNumber int) (io.WriteCloser, error)
+
+// NewChunk calls f
+func (f ChunkSinkFunc) NewChunk(ctx context.Context, collection string, chunkNumber int) (io.WriteCloser, error) {
+	return f(ctx, collection, chunkNumber)
+}
+
+// ChunkSource supplies chunks stored by a ChunkSink in place of collections on disk.
+//
+// Set DecodeConfig.ChunkSource to decode from the same backend a ChunkSink wrote to.
+// At least K of the N collections must be available.
+type ChunkSource interface {
+	// Collections returns the names of the available collections (e.g. "3A5")
+	Collections(ctx context.Context) ([]string, error)
+
+	// ReadChunk returns one chunk of a collection, or io.EOF after its last chunk
+	ReadChunk(ctx context.Context, collection string, chunkNumber int) ([]byte, error)
+}
+
+// encodeToSink encodes the input directories of cfg and writes every chunk to sink. Only the input,
+// threshold, chunk size, RNG, deduplication, compression, padding, and passphrase settings of cfg
+// are used.
+func encodeToSink(ctx context.Context, cfg EncodeConfig, sink ChunkSink) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	// A sink has no collection metadata to record that the data decodes to a stream
+	if cfg.RawInput != nil {
+		err := fmt.Errorf("a raw input stream can only be encoded to output directories")
+		log.Error(err)
+		return err
+	}
+
+	if err := validateInputDirs(ctx, cfg.inputDirs()); err != nil {
+		return err
+	}
+
+	tarStream, err := file.SerializeDirectoriesWithFilter(ctx, cfg.inputDirs(), cfg.Filter)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to create tar stream: %w", err))
+		return fmt.Errorf("failed to create tar stream: %w", err)
+	}
+	defer tarStream.Close()
+
+	var serialized io.Reader = tarStream
+	var stats file.DedupStats
+	if cfg.Dedup {
+		serialized = file.DedupStream(ctx, serialized, &stats)
+	}
+	if _, err = encodeStreamToSink(ctx, cfg, serialized, sink); err != nil {
+		return err
+	}
+	logDedup(ctx, &stats)
+	return nil
+}
+
+// encodeStreamToSink compresses stream as cfg asks, encodes it, and writes every chunk to
+// sink. It returns the compression that was applied, which CompressionAuto leaves to the
+// encode to choose.
+func encodeStreamToSink(ctx context.Context, cfg EncodeConfig, stream io.Reader, sink ChunkSink) (Compression, error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if len(cfg.EnvelopeKey) > 0 {
+		err := fmt.Errorf("an envelope key can't be used when chunks go to a sink, which has no collection metadata to record the envelope in")
+		log.Error(err)
+		return CompressionNone, err
+	}
+
+	p, err := pad.NewPadForEncodeWith(ctx, cfg.N, cfg.K, cfg.sharing())
+	if err != nil {
+		log.Error(fmt.Errorf("failed to create pad instance: %w", err))
+		return CompressionNone, err
+	}
+
+	inputStream := stream
+	if cfg.Compression == CompressionAuto {
+		inputStream, cfg.Compression, err = resolveAutoCompression(ctx, inputStream)
+		if err != nil {
+			return CompressionNone, err
+		}
+	}
+	if cfg.Compression.effective() != CompressionNone {
+		inputStream, err = file.CompressStream(ctx, inputStream, cfg.Compression.String(), cfg.CompressionLevel)
+		if err != nil {
+			log.Error(fmt.Errorf("failed to compress input: %w", err))
+			return CompressionNone, fmt.Errorf("failed to compress input: %w", err)
+		}
+	}
+	inputStream, discardHidden, err := padStream(ctx, cfg, inputStream)
+	if err != nil {
+		log.Error(err)
+		return CompressionNone, err
+	}
+	defer discardHidden()
+	if len(cfg.Passphrase) > 0 {
+		if inputStream, err = file.MaskStream(ctx, inputStream, cfg.Passphrase); err != nil {
+			log.Error(err)
+			return CompressionNone, err
+		}
+	}
+
+	newChunkFunc := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		return sink.NewChunk(ctx, collectionName, chunkNumber)
+	}
+	stats := newEncodeStats(ctx)
+	if err := p.Encode(ctx, cfg.ChunkSize, stats.input(inputStream), stats.rng(cfg.RNG), stats.chunks(newChunkFunc), string(cfg.Format)); err != nil {
+		log.Error(fmt.Errorf("encoding failed: %w", err))
+		return CompressionNone, fmt.Errorf("encoding failed: %w", err)
+	}
+	stats.report(ctx)
+
+	log.Infof("Encode complete with %d collections -required %d", cfg.N, cfg.K)
+	return cfg.Compression.effective(), nil
+}
+
+// decodeFromSource reconstructs the original directory in cfg.OutputDir from the
+// collections available in source
+func decodeFromSource(ctx context.Context, source ChunkSource, cfg DecodeConfig) error {
+	shares, closeShares, err := sourceShares(ctx, source, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeShares()
+	return decodeSharesToDirectory(ctx, shares, cfg)
+}
+
+// sourceShares opens a share stream for each collection available in source, prefetching
+// chunks only if cfg asks for it, since prefetching calls ReadChunk for every collection at
+// once. The returned function closes the streams.
+func sourceShares(ctx context.Context, source ChunkSource, cfg DecodeConfig) ([]io.Reader, func(), error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	names, err := source.Collections(ctx)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to list collections: %w", err))
+		return nil, nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	log.Infof("Collections: %d", len(names))
+	if err := checkCollectionNames(names); err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+
+	var prefetchers []*file.PrefetchReader
+	closeShares := func() {
+		for _, prefetcher := range prefetchers {
+			prefetcher.Close()
+		}
+	}
+	shares := make([]io.Reader, len(names))
+	for i, name := range names {
+		if cfg.Pipeline.PrefetchChunks > 0 {
+			seq := &sourceSequence{source: source, collection: name}
+			prefetcher, err := file.NewPrefetchReader(ctx, name, seq, cfg.Pipeline.PrefetchChunks, cfg.Pipeline.PrefetchDir)
+			if err != nil {
+				closeShares()
+				return nil, nil, err
+			}
+			prefetchers = append(prefetchers, prefetcher)
+			shares[i] = prefetcher
+			continue
+		}
+		shares[i] = &sourceReader{ctx: ctx, source: source, collection: name}
+	}
+	return shares, closeShares, nil
+}
+
+// decodeSharesToDirectory decodes share streams and deserializes the result into cfg.OutputDir,
+// or with cfg.OutputTar, writes it to cfg.OutputStream as a TAR
+func decodeSharesToDirectory(ctx context.Context, shares []io.Reader, cfg DecodeConfig) (retErr error) {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if len(cfg.EnvelopeKey) > 0 {
+		err := fmt.Errorf("an envelope key can't be used when chunks come from a source, which has no collection metadata to record the envelope in")
+		log.Error(err)
+		return err
+	}
+
+	// A TAR written to an output stream as it is needs no output directory
+	if cfg.OutputTar {
+		opts := StreamOptions{Compression: cfg.Compression, Passphrase: cfg.Passphrase, HiddenKey: cfg.HiddenKey}
+		if cfg.KeepCompressed {
+			opts.Compression = CompressionNone
+		}
+		return DecodeStreams(ctx, shares, cfg.OutputStream, opts)
+	}
+	if cfg.OutputStream != nil {
+		err := fmt.Errorf("a raw stream can't be decoded when chunks come from a source, which has no collection metadata to tell it from a TAR")
+		log.Error(err)
+		return err
+	}
+
+	release, err := lockDirs(ctx, []string{cfg.OutputDir}, "decode")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Clear the output directory first, if asked to, so that it keeps the restore manifest
+	if cfg.ClearIfNotEmpty && !cfg.Resume {
+		if err := file.PrepareOutputDirectory(ctx, cfg.OutputDir, true); err != nil {
+			return err
+		}
+	}
+
+	// The restored files can only be rolled back if nothing else was in the output directory
+	if isEmptyDir(cfg.OutputDir) {
+		defer func() {
+			rollBack(ctx, retErr, cfg.Resume, cfg.KeepPartial || cfg.Salvage, []string{cfg.OutputDir}, nil, cfg.Result)
+		}()
+	}
+	manifest, err := openRestoreManifest(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	// Deserialize the reconstructed tar stream while it is being decoded
+	pr, pw := file.NewPipe(cfg.Pipeline.PipeBufferSize)
+	done := make(chan error, 1)
+	go func() {
+		err := file.DeserializeDirectoryWithFilter(ctx, cfg.OutputDir, pr, false, manifest, cfg.Filter)
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	decodeErr := DecodeStreams(ctx, shares, pw, StreamOptions{Compression: cfg.Compression, Passphrase: cfg.Passphrase, HiddenKey: cfg.HiddenKey})
+	pw.CloseWithError(decodeErr)
+	deserializeErr := <-done
+
+	// Keep the files restored before the data that couldn't be decoded, if asked to
+	if cfg.Salvage && (decodeErr != nil || deserializeErr != nil) && ctx.Err() == nil {
+		err := decodeErr
+		if err == nil {
+			err = deserializeErr
+		}
+		return salvageDecode(ctx, cfg, manifest, 0, err, deserializeErr)
+	}
+
+	if decodeErr != nil {
+		log.Error(decodeErr)
+		return decodeErr
+	}
+	if deserializeErr != nil {
+		log.Error(fmt.Errorf("failed to deserialize directory: %w", deserializeErr))
+		return fmt.Errorf("failed to deserialize directory: %w", deserializeErr)
+	}
+	return manifest.Remove()
+}
+
+// sourceReader presents the chunks of one collection in a ChunkSource as a share stream
+type sourceReader struct {
+	ctx        context.Context
+	source     ChunkSource
+	collection string
+	chunk      int
+	buf        []byte
+	eof        bool
+}
+
+func (r *sourceReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		r.chunk++
+		data, err := r.source.ReadChunk(r.ctx, r.collection, r.chunk)
+		if err == io.EOF {
+			r.eof = true
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read chunk %d of collection %s: %w", r.chunk, r.collection, err)
+		}
+		r.buf = data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// sourceSequence presents the chunks of one collection in a ChunkSource as a
+// file.ChunkSequence, for prefetching
+type sourceSequence struct {
+	source     ChunkSource
+	collection string
+	chunk      int
+}
+
+func (s *sourceSequence) ReadNextChunk(ctx context.Context) ([]byte, error) {
+	data, err := s.source.ReadChunk(ctx, s.collection, s.chunk+1)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk %d of collection %s: %w", s.chunk+1, s.collection, err)
+	}
+	s.chunk++
+	return data, nil
+}
+
+func (s *sourceSequence) Close() error { return nil }
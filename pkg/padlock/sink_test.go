@@ -0,0 +1,175 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// memoryStore is a key-value chunk store implementing both ChunkSink and ChunkSource
+type memoryStore struct {
+	mu     sync.Mutex
+	chunks map[string][]byte
+	names  map[string]bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{chunks: make(map[string][]byte), names: make(map[string]bool)}
+}
+
+func chunkKey(collection string, chunkNumber int) string {
+	return fmt.Sprintf("%s/%d", collection, chunkNumber)
+}
+
+func (m *memoryStore) NewChunk(ctx context.Context, collection string, chunkNumber int) (io.WriteCloser, error) {
+	return &memoryChunk{store: m, key: chunkKey(collection, chunkNumber), collection: collection}, nil
+}
+
+func (m *memoryStore) Collections(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name := range m.names {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (m *memoryStore) ReadChunk(ctx context.Context, collection string, chunkNumber int) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.chunks[chunkKey(collection, chunkNumber)]
+	if !ok {
+		return nil, io.EOF
+	}
+	return data, nil
+}
+
+type memoryChunk struct {
+	bytes.Buffer
+	store      *memoryStore
+	key        string
+	collection string
+}
+
+func (c *memoryChunk) Close() error {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	c.store.chunks[c.key] = c.Bytes()
+	c.store.names[c.collection] = true
+	return nil
+}
+
+func TestChunkSinkAndSource(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	tempDir, err := os.MkdirTemp("", "padlock-sink-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	content := bytes.Repeat([]byte("chunk sink test data "), 100)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	store := newMemoryStore()
+	cfg := EncodeConfig{
+		InputDir:    inputDir,
+		N:           3,
+		K:           2,
+		Format:      FormatPNG,
+		ChunkSize:   256,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+		ChunkSink:   store,
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode to chunk sink: %v", err)
+	}
+	if len(store.names) != 3 {
+		t.Fatalf("Expected chunks for 3 collections, got %d", len(store.names))
+	}
+
+	// Lose one collection; the remaining two are enough
+	delete(store.names, "2A3")
+
+	outputDir := filepath.Join(tempDir, "output")
+	decodeCfg := DecodeConfig{
+		OutputDir:   outputDir,
+		Compression: CompressionGzip,
+		ChunkSource: store,
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode from chunk source: %v", err)
+	}
+	decoded, err := os.ReadFile(filepath.Join(outputDir, "test.txt"))
+	if err != nil || !bytes.Equal(decoded, content) {
+		t.Errorf("Decoded content mismatch: %d bytes, %v", len(decoded), err)
+	}
+
+	// Losing a second collection leaves too few to decode
+	delete(store.names, "2B3")
+	decodeCfg.ClearIfNotEmpty = true
+	err = DecodeDirectory(ctx, decodeCfg)
+	if !errors.Is(err, ErrInsufficientCollections) || !strings.Contains(err.Error(), "need 2 of 3 collections, found 1; add any 1 of 2A3, 2B3") {
+		t.Errorf("Expected ErrInsufficientCollections naming K decoding one collection, got %v", err)
+	}
+	store.names["2B3"] = true
+
+	// Prefetching from the chunk source decodes the same
+	decodeCfg.ClearIfNotEmpty = true
+	decodeCfg.Pipeline.PrefetchChunks = 3
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode from chunk source with prefetch: %v", err)
+	}
+	decoded, err = os.ReadFile(filepath.Join(outputDir, "test.txt"))
+	if err != nil || !bytes.Equal(decoded, content) {
+		t.Errorf("Prefetched decode content mismatch: %d bytes, %v", len(decoded), err)
+	}
+}
+
+func TestChunkSinkError(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	tempDir, err := os.MkdirTemp("", "padlock-sink-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	if err := os.WriteFile(filepath.Join(tempDir, "test.txt"), []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	errUnavailable := errors.New("store unavailable")
+	cfg := EncodeConfig{
+		InputDir:  tempDir,
+		N:         2,
+		K:         2,
+		ChunkSize: 256,
+		RNG:       pad.NewDefaultRand(ctx),
+		ChunkSink: ChunkSinkFunc(func(ctx context.Context, collection string, chunkNumber int) (io.WriteCloser, error) {
+			return nil, errUnavailable
+		}),
+	}
+	if err := EncodeDirectory(ctx, cfg); !errors.Is(err, errUnavailable) {
+		t.Errorf("Expected sink error to be returned, got %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// SnapshotsVersion is the version of the snapshot log layout written by RecordSnapshot.
+const SnapshotsVersion = 1
+
+// SnapshotLog is a local record of encode runs, kept so that a series of backups can be
+// listed and one of them found again for restore. Each encode given the log adds a Snapshot
+// to it; like a catalog, it holds no share data.
+type SnapshotLog struct {
+	Version   int        `json:"version"`
+	Snapshots []Snapshot `json:"snapshots"`
+}
+
+// Snapshot describes one encode run recorded in a SnapshotLog: what was encoded, when, and
+// where each of its collections was written.
+type Snapshot struct {
+	ID          int                  `json:"id"`      // Position in the log, from 1
+	Session     string               `json:"session"` // Session recorded in the metadata of the collections
+	Created     time.Time            `json:"created"`
+	Label       string               `json:"label,omitempty"`
+	Appended    bool                 `json:"appended,omitempty"` // The encode was appended to the collections of an earlier one
+	Inputs      []string             `json:"inputs,omitempty"`   // Input directories or file, or empty for a stream
+	InputBytes  int64                `json:"input_bytes"`        // Size of the serialized input
+	Copies      int                  `json:"copies"`
+	Required    int                  `json:"required"`
+	Format      Format               `json:"format"`
+	Collections []SnapshotCollection `json:"collections"`
+}
+
+// SnapshotCollection records where one collection of a Snapshot was written
+type SnapshotCollection struct {
+	Name       string `json:"name"`
+	StoredName string `json:"stored_name,omitempty"` // Stealth name the collection is stored under, if any
+	Path       string `json:"path"`                  // Absolute local path or remote URL of the collection
+}
+
+// newSnapshot describes a finished encode for the snapshot log
+func newSnapshot(cfg EncodeConfig, collections []file.Collection, counter *resultCounter, destinations []file.Destination) Snapshot {
+	snapshot := Snapshot{
+		Session:  cfg.session,
+		Created:  time.Now().UTC().Truncate(time.Second),
+		Label:    cfg.SnapshotLabel,
+		Appended: cfg.Append,
+		Copies:   len(collections),
+		Required: cfg.K,
+		Format:   Format(cfg.formatDescription()),
+	}
+	if cfg.RawInput == nil && cfg.InputStream == nil {
+		for _, dir := range cfg.inputDirs() {
+			if abs, err := filepath.Abs(dir); err == nil {
+				dir = abs
+			}
+			snapshot.Inputs = append(snapshot.Inputs, dir)
+		}
+	}
+	snapshot.InputBytes = counter.serialized.n.Load()
+	if counter.serialized.r == nil {
+		snapshot.InputBytes = counter.encoded.n.Load()
+	}
+	for _, coll := range collections {
+		path := coll.Path
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		snapshot.Collections = append(snapshot.Collections, SnapshotCollection{
+			Name:       coll.Name,
+			StoredName: coll.StoredName,
+			Path:       remoteDestination(destinations, path),
+		})
+	}
+	return snapshot
+}
+
+// RecordSnapshot adds snapshot to the log at path, creating it if it doesn't exist, and sets
+// the snapshot's ID. The log is replaced as a whole, so that it is never left half written.
+func RecordSnapshot(ctx context.Context, path string, snapshot *Snapshot) error {
+	log := trace.FromContext(ctx).WithPrefix("snapshots")
+
+	snapshots, err := ReadSnapshots(ctx, path)
+	if errors.Is(err, os.ErrNotExist) {
+		snapshots, err = &SnapshotLog{Version: SnapshotsVersion}, nil
+	}
+	if err != nil {
+		return err
+	}
+	snapshot.ID = 1
+	if n := len(snapshots.Snapshots); n > 0 {
+		snapshot.ID = snapshots.Snapshots[n-1].ID + 1
+	}
+	snapshots.Snapshots = append(snapshots.Snapshots, *snapshot)
+
+	data, err := json.MarshalIndent(snapshots, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot log: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err == nil {
+		_, err = tmp.Write(append(data, '\n'))
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}
+	if err != nil {
+		log.Error(fmt.Errorf("failed to write snapshot log %s: %w", path, err))
+		return fmt.Errorf("failed to write snapshot log %s: %w", path, err)
+	}
+
+	log.Infof("Recorded snapshot %d of session %s in %s", snapshot.ID, snapshot.Session, path)
+	return nil
+}
+
+// ReadSnapshots loads the snapshot log at path. An error wrapping os.ErrNotExist is returned
+// if there is none.
+func ReadSnapshots(ctx context.Context, path string) (*SnapshotLog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot log %s: %w", path, err)
+	}
+	var snapshots SnapshotLog
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot log %s: %w", path, err)
+	}
+	if snapshots.Version > SnapshotsVersion {
+		return nil, fmt.Errorf("snapshot log %s has unsupported version %d", path, snapshots.Version)
+	}
+	trace.FromContext(ctx).WithPrefix("snapshots").Debugf("Read %d snapshots from %s", len(snapshots.Snapshots), path)
+	return &snapshots, nil
+}
+
+// Select returns the snapshot ref names: "latest", a snapshot ID, or a label or session,
+// which may be abbreviated to a prefix of itself. A label or session of several snapshots
+// selects the most recent of them, as an append records the session of the encode it added to.
+func (l *SnapshotLog) Select(ref string) (*Snapshot, error) {
+	if len(l.Snapshots) == 0 {
+		return nil, fmt.Errorf("no snapshots have been recorded")
+	}
+	if ref == "latest" {
+		return &l.Snapshots[len(l.Snapshots)-1], nil
+	}
+	if id, err := strconv.Atoi(ref); err == nil {
+		for i := range l.Snapshots {
+			if l.Snapshots[i].ID == id {
+				return &l.Snapshots[i], nil
+			}
+		}
+		return nil, fmt.Errorf("no snapshot %d has been recorded", id)
+	}
+
+	// An exact label or session is preferred over one it is a prefix of
+	var found, prefixed *Snapshot
+	prefixes := make(map[string]bool)
+	for i := range l.Snapshots {
+		s := &l.Snapshots[i]
+		switch {
+		case s.Label == ref || s.Session == ref:
+			found = s
+		case ref != "" && strings.HasPrefix(s.Session, ref):
+			prefixed = s
+			prefixes[s.Session] = true
+		case ref != "" && s.Label != "" && strings.HasPrefix(s.Label, ref):
+			prefixed = s
+			prefixes[s.Label] = true
+		}
+	}
+	switch {
+	case found != nil:
+		return found, nil
+	case len(prefixes) > 1:
+		return nil, fmt.Errorf("%q is the start of %d different labels or sessions; give more of it", ref, len(prefixes))
+	case prefixed != nil:
+		return prefixed, nil
+	}
+	return nil, fmt.Errorf("no snapshot has the ID, label, or session %q", ref)
+}
+
+// Print writes the snapshots as a table, most recent last
+func (l *SnapshotLog) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCreated\tSession\tLabel\tScheme\tInput\tInputs")
+	for _, s := range l.Snapshots {
+		label := s.Label
+		if s.Appended {
+			label = strings.TrimSpace(label + " (appended)")
+		}
+		inputs := strings.Join(s.Inputs, ", ")
+		if inputs == "" {
+			inputs = "stream"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%dof%d\t%s\t%s\n", s.ID, s.Created.Local().Format(time.DateTime), s.Session,
+			label, s.Required, s.Copies, FormatByteSize(s.InputBytes), inputs)
+	}
+	tw.Flush()
+}
+
+// Print writes where the collections of the snapshot are, and how many of them restore it
+func (s *Snapshot) Print(w io.Writer) {
+	fmt.Fprintf(w, "Snapshot:     %d\n", s.ID)
+	fmt.Fprintf(w, "Created:      %s\n", s.Created.Local().Format(time.DateTime))
+	fmt.Fprintf(w, "Session:      %s\n", s.Session)
+	if s.Label != "" {
+		fmt.Fprintf(w, "Label:        %s\n", s.Label)
+	}
+	if s.Appended {
+		fmt.Fprintf(w, "Appended:     to the collections of an earlier snapshot, which restore both\n")
+	}
+	for _, input := range s.Inputs {
+		fmt.Fprintf(w, "Input:        %s\n", input)
+	}
+	fmt.Fprintf(w, "Input size:   %s\n", FormatByteSize(s.InputBytes))
+	fmt.Fprintf(w, "Scheme:       any %d of %d collections, format %s\n", s.Required, s.Copies, s.Format)
+	for _, coll := range s.Collections {
+		fmt.Fprintf(w, "Collection:   %s  %s\n", coll.Name, coll.Path)
+	}
+}
+
+// LocalPaths returns the paths of the snapshot's collections that are still on local disk
+func (s *Snapshot) LocalPaths() []string {
+	var paths []string
+	for _, coll := range s.Collections {
+		if _, err := os.Stat(coll.Path); err == nil {
+			paths = append(paths, coll.Path)
+		}
+	}
+	return paths
+}
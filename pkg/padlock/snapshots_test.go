@@ -0,0 +1,93 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestEncodeRecordsSnapshots checks that each encode given a snapshot log adds to it, and
+// that a snapshot selected from it restores the data of that encode
+func TestEncodeRecordsSnapshots(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	snapshotsPath := filepath.Join(tempDir, "snapshots.json")
+
+	for i, label := range []string{"monday", "tuesday"} {
+		writeFiles(t, inputDir, map[string]string{"day.txt": label})
+		cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(filepath.Join(tempDir, label)), WithScheme(2, 3),
+			WithFormat(FormatBin), WithSnapshots(snapshotsPath, label), WithRNG(pad.NewDefaultRand(ctx)))
+		if err != nil {
+			t.Fatalf("NewEncodeConfig failed: %v", err)
+		}
+		if i == 1 {
+			// A stealth name is recorded with the collection stored under it
+			cfg.StealthNames = true
+		}
+		if err := EncodeDirectory(ctx, cfg); err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+	}
+
+	snapshots, err := ReadSnapshots(ctx, snapshotsPath)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot log: %v", err)
+	}
+	if len(snapshots.Snapshots) != 2 {
+		t.Fatalf("Expected 2 snapshots, got %d", len(snapshots.Snapshots))
+	}
+	for i, s := range snapshots.Snapshots {
+		if s.ID != i+1 || s.Session == "" || s.Copies != 3 || s.Required != 2 || len(s.Collections) != 3 || s.InputBytes == 0 {
+			t.Errorf("Incomplete snapshot %+v", s)
+		}
+		if len(s.Inputs) != 1 || s.Inputs[0] != inputDir {
+			t.Errorf("Expected snapshot %d to record input %s, got %v", s.ID, inputDir, s.Inputs)
+		}
+		if len(s.LocalPaths()) != 3 {
+			t.Errorf("Expected the 3 collections of snapshot %d to be found, got %v", s.ID, s.LocalPaths())
+		}
+	}
+	if snapshots.Snapshots[1].Collections[0].StoredName == "" {
+		t.Errorf("Expected the stealth name of the collection to be recorded")
+	}
+
+	// Snapshots are selected by ID, label, session, or a prefix of one of them
+	tuesday := snapshots.Snapshots[1]
+	for _, ref := range []string{"latest", "2", "tuesday", "tue", tuesday.Session, tuesday.Session[:8]} {
+		if s, err := snapshots.Select(ref); err != nil || s.ID != 2 {
+			t.Errorf("Expected %q to select snapshot 2, got %v (%v)", ref, s, err)
+		}
+	}
+	for _, ref := range []string{"3", "wednesday", ""} {
+		if _, err := snapshots.Select(ref); err == nil {
+			t.Errorf("Expected %q to select no snapshot", ref)
+		}
+	}
+
+	// The selected snapshot restores the data encoded then
+	monday, err := snapshots.Select("monday")
+	if err != nil {
+		t.Fatalf("Failed to select snapshot: %v", err)
+	}
+	decodeDir := filepath.Join(tempDir, "decoded")
+	decodeCfg, err := NewDecodeConfig(WithInputs(monday.LocalPaths()[:2]...), WithOutput(decodeDir))
+	if err != nil {
+		t.Fatalf("NewDecodeConfig failed: %v", err)
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(decodeDir, "day.txt")); err != nil || string(got) != "monday" {
+		t.Errorf("Expected the monday snapshot to be restored, got %q (%v)", got, err)
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"io"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// histogramSubBuckets is the number of buckets per power of two, which bounds the error of
+// a reported percentile to about 1/histogramSubBuckets of its value
+const histogramSubBuckets = 16
+
+// histogram records the distribution of non-negative values in fixed-size, logarithmically
+// spaced buckets, so that memory use doesn't grow with the number of chunks encoded
+type histogram struct {
+	counts [64 * histogramSubBuckets]int64
+	count  int64
+	sum    int64
+	max    int64
+}
+
+// bucketIndex returns the bucket holding v. Values below 2*histogramSubBuckets have a bucket
+// each; above that, each power of two is split into histogramSubBuckets buckets.
+func bucketIndex(v int64) int {
+	if v < 2*histogramSubBuckets {
+		return int(max(v, 0))
+	}
+	shift := bits.Len64(uint64(v)) - bits.Len64(histogramSubBuckets)
+	return shift*histogramSubBuckets + int(v>>shift)
+}
+
+// bucketRange returns the smallest and largest values held by bucket i
+func bucketRange(i int) (int64, int64) {
+	if i < 2*histogramSubBuckets {
+		return int64(i), int64(i)
+	}
+	shift := i/histogramSubBuckets - 1
+	sub := int64(i - shift*histogramSubBuckets)
+	return sub << shift, (sub+1)<<shift - 1
+}
+
+// add records a value
+func (h *histogram) add(v int64) {
+	h.counts[bucketIndex(v)]++
+	h.count++
+	h.sum += v
+	h.max = max(h.max, v)
+}
+
+// percentile returns the approximate value below which fraction p of the recorded values fall
+func (h *histogram) percentile(p float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+	rank := max(int64(p*float64(h.count)+0.5), 1)
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			lo, hi := bucketRange(i)
+			return min(lo+(hi-lo)/2, h.max)
+		}
+	}
+	return h.max
+}
+
+// encodeStats collects per-chunk timing and size distributions during an encode, to help
+// diagnose whether a slow encode is limited by the entropy source, the CPU, the input, or
+// the destination media. The pad encoder reads input, draws the random pads, and writes
+// chunks in separate stages that overlap, so a chunk is taken to end when the last of its
+// collection chunks is written, and each stage's time is counted toward the chunk being
+// written while it was spent.
+type encodeStats struct {
+	mu sync.Mutex
+
+	chunkTime  histogram // Wall time per chunk, from the end of the previous one
+	rngWait    histogram // Time per chunk waiting for the random number generator
+	inputWait  histogram // Time per chunk waiting for serialized, compressed input
+	outputWait histogram // Time per chunk creating and writing collection chunk files
+	chunkSize  histogram // Bytes written per collection chunk
+
+	// State of the chunk in progress
+	chunk                   int       // Number of the chunk being written, or 0 before the first
+	chunkStart              time.Time // When the previous chunk ended, or input was first read
+	lastWrite               time.Time // When a collection chunk was last written
+	rngNs, inputNs, writeNs int64
+}
+
+// newEncodeStats returns a collector if verbose tracing is enabled, and nil otherwise. All
+// methods of a nil collector are no-ops that return their arguments unwrapped.
+func newEncodeStats(ctx context.Context) *encodeStats {
+	if !trace.FromContext(ctx).IsVerbose() {
+		return nil
+	}
+	return &encodeStats{}
+}
+
+// finishChunk records the chunk being written, if any, as ending when it was last written to
+func (s *encodeStats) finishChunk() {
+	if s.chunk == 0 {
+		return
+	}
+	s.chunkTime.add(int64(s.lastWrite.Sub(s.chunkStart)))
+	s.rngWait.add(s.rngNs)
+	s.inputWait.add(s.inputNs)
+	s.outputWait.add(s.writeNs)
+	s.chunk, s.chunkStart = 0, s.lastWrite
+	s.rngNs, s.inputNs, s.writeNs = 0, 0, 0
+}
+
+// beginRead is called as input is about to be read, which starts the clock on the first chunk
+func (s *encodeStats) beginRead(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.chunkStart.IsZero() {
+		s.chunkStart = now
+	}
+}
+
+// beginChunk is called as a collection chunk is created, which ends the previous chunk
+// once the first collection chunk of the next one is created
+func (s *encodeStats) beginChunk(chunkNumber int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if chunkNumber != s.chunk {
+		s.finishChunk()
+		s.chunk = chunkNumber
+	}
+}
+
+func (s *encodeStats) addInput(d time.Duration) {
+	s.mu.Lock()
+	s.inputNs += int64(d)
+	s.mu.Unlock()
+}
+
+func (s *encodeStats) addRNG(d time.Duration) {
+	s.mu.Lock()
+	s.rngNs += int64(d)
+	s.mu.Unlock()
+}
+
+func (s *encodeStats) addWrite(d time.Duration) {
+	s.mu.Lock()
+	s.writeNs += int64(d)
+	s.lastWrite = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *encodeStats) addChunkSize(n int64) {
+	s.mu.Lock()
+	s.chunkSize.add(n)
+	s.mu.Unlock()
+}
+
+// input wraps the stream the pad encoder reads from
+func (s *encodeStats) input(r io.Reader) io.Reader {
+	if s == nil {
+		return r
+	}
+	return &timedReader{r: r, stats: s}
+}
+
+// rng wraps the random number generator used by the pad encoder
+func (s *encodeStats) rng(r pad.RNG) pad.RNG {
+	if s == nil {
+		return r
+	}
+	return &timedRNG{RNG: r, stats: s}
+}
+
+// chunks wraps the function that creates collection chunk writers
+func (s *encodeStats) chunks(newChunk pad.NewChunkFunc) pad.NewChunkFunc {
+	if s == nil {
+		return newChunk
+	}
+	return func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		s.beginChunk(chunkNumber)
+		start := time.Now()
+		w, err := newChunk(collectionName, chunkNumber, chunkFormat)
+		s.addWrite(time.Since(start))
+		if err != nil {
+			return nil, err
+		}
+		return &timedChunkWriter{w: w, stats: s}, nil
+	}
+}
+
+// report logs percentile summaries of the collected distributions
+func (s *encodeStats) report(ctx context.Context) {
+	if s == nil {
+		return
+	}
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finishChunk()
+	if s.chunkTime.count == 0 {
+		return
+	}
+
+	log.Infof("*** ENCODE STATISTICS (%d chunks) ***", s.chunkTime.count)
+	log.Infof("%-12s %14s %14s %14s %14s %14s", "", "p50", "p95", "p99", "max", "total")
+	for _, row := range []struct {
+		name string
+		h    *histogram
+	}{
+		{"Chunk time", &s.chunkTime},
+		{"RNG wait", &s.rngWait},
+		{"Input wait", &s.inputWait},
+		{"Output wait", &s.outputWait},
+	} {
+		log.Infof("%-12s %14s %14s %14s %14s %14s", row.name,
+			formatStatDuration(row.h.percentile(0.50)), formatStatDuration(row.h.percentile(0.95)),
+			formatStatDuration(row.h.percentile(0.99)), formatStatDuration(row.h.max), formatStatDuration(row.h.sum))
+	}
+	log.Infof("%-12s %14s %14s %14s %14s %14s", "Chunk size",
+		file.FormatSize(s.chunkSize.percentile(0.50)), file.FormatSize(s.chunkSize.percentile(0.95)),
+		file.FormatSize(s.chunkSize.percentile(0.99)), file.FormatSize(s.chunkSize.max), file.FormatSize(s.chunkSize.sum))
+
+	// The stages overlap, so the encode runs at the pace of the busiest one. If none of them
+	// was busy for most of the encode, the time went to encoding in between.
+	waits := []struct {
+		name string
+		ns   int64
+	}{
+		{"waiting for the random number generator", s.rngWait.sum},
+		{"waiting for input", s.inputWait.sum},
+		{"writing output", s.outputWait.sum},
+	}
+	slowest := waits[0]
+	for _, w := range waits[1:] {
+		if w.ns > slowest.ns {
+			slowest = w
+		}
+	}
+	if 2*slowest.ns < s.chunkTime.sum {
+		log.Infof("No stage was busy for most of the encode; most time was spent encoding (CPU)")
+		return
+	}
+	log.Infof("Most time was spent %s: %.0f%%", slowest.name, 100*float64(slowest.ns)/float64(s.chunkTime.sum))
+}
+
+// formatStatDuration formats a duration in nanoseconds to about four significant digits
+func formatStatDuration(ns int64) string {
+	d := time.Duration(ns)
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	default:
+		return d.String()
+	}
+}
+
+// timedReader measures time spent waiting for input
+type timedReader struct {
+	r     io.Reader
+	stats *encodeStats
+}
+
+func (t *timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	t.stats.beginRead(start)
+	n, err := t.r.Read(p)
+	t.stats.addInput(time.Since(start))
+	return n, err
+}
+
+// timedRNG measures time spent waiting for random data
+type timedRNG struct {
+	pad.RNG
+	stats *encodeStats
+}
+
+func (t *timedRNG) Read(ctx context.Context, p []byte) error {
+	start := time.Now()
+	err := t.RNG.Read(ctx, p)
+	t.stats.addRNG(time.Since(start))
+	return err
+}
+
+// timedChunkWriter measures time spent writing a collection chunk and records its size
+type timedChunkWriter struct {
+	w     io.WriteCloser
+	stats *encodeStats
+	size  int64
+}
+
+func (t *timedChunkWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.w.Write(p)
+	t.stats.addWrite(time.Since(start))
+	t.size += int64(n)
+	return n, err
+}
+
+func (t *timedChunkWriter) Close() error {
+	start := time.Now()
+	err := t.w.Close()
+	t.stats.addWrite(time.Since(start))
+	t.stats.addChunkSize(t.size)
+	return err
+}
@@ -0,0 +1,87 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestHistogramPercentiles(t *testing.T) {
+	var h histogram
+	for v := int64(1); v <= 10000; v++ {
+		h.add(v)
+	}
+
+	for _, tc := range []struct {
+		p    float64
+		want int64
+	}{
+		{0.50, 5000},
+		{0.95, 9500},
+		{0.99, 9900},
+	} {
+		got := h.percentile(tc.p)
+		if diff := got - tc.want; diff < -tc.want/histogramSubBuckets || diff > tc.want/histogramSubBuckets {
+			t.Errorf("percentile(%.2f) = %d, want about %d", tc.p, got, tc.want)
+		}
+	}
+	if h.max != 10000 || h.count != 10000 {
+		t.Errorf("Expected max 10000 and count 10000, got %d and %d", h.max, h.count)
+	}
+
+	// Every value falls within the range of its bucket
+	for _, v := range []int64{0, 1, 31, 32, 33, 1000, 1 << 40, 1<<62 + 12345} {
+		lo, hi := bucketRange(bucketIndex(v))
+		if v < lo || v > hi {
+			t.Errorf("Value %d is outside its bucket range [%d, %d]", v, lo, hi)
+		}
+	}
+}
+
+func TestEncodeStatsCountsChunks(t *testing.T) {
+	if newEncodeStats(trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))) != nil {
+		t.Errorf("Expected no statistics to be collected without verbose tracing")
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	stats := newEncodeStats(ctx)
+	if stats == nil {
+		t.Fatalf("Expected statistics to be collected with verbose tracing")
+	}
+
+	p, err := pad.NewPadForEncode(ctx, 3, 2)
+	if err != nil {
+		t.Fatalf("Failed to create pad: %v", err)
+	}
+
+	// 10 chunks of input, each written to 3 collections
+	chunkSize := 300
+	input := bytes.Repeat([]byte("s"), chunkSize/p.PermutationCount*10)
+	newChunk := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+		return nopWriteCloser{io.Discard}, nil
+	}
+	if err := p.Encode(ctx, chunkSize, stats.input(bytes.NewReader(input)), stats.rng(pad.NewDefaultRand(ctx)), stats.chunks(newChunk), "bin"); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	stats.report(ctx)
+
+	if stats.chunkTime.count != 10 {
+		t.Errorf("Expected 10 chunks to be timed, got %d", stats.chunkTime.count)
+	}
+	if stats.chunkSize.count != 30 {
+		t.Errorf("Expected 30 collection chunk sizes, got %d", stats.chunkSize.count)
+	}
+	if stats.rngWait.sum == 0 || stats.rngWait.sum > stats.chunkTime.sum {
+		t.Errorf("Expected RNG wait (%d) to be nonzero and within chunk time (%d)", stats.rngWait.sum, stats.chunkTime.sum)
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
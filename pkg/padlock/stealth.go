@@ -0,0 +1,60 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// A collection stored under a stealth name carries the stealth name in the header of every
+// chunk too, in place of its real name, so that neither its files nor their contents name the
+// K-of-N scheme. Only the collection's metadata maps the stealth name back to the real name,
+// so with a metadata key, which seals the metadata, the scheme is hidden from anyone without
+// the key, and decode, verify, and repair need the key to read the chunks.
+
+// stealthAliases returns the aliases an encode writes in the chunk headers of collections
+// stored under stealth names
+func stealthAliases(collections []file.Collection) pad.Aliases {
+	aliases := make(pad.Aliases)
+	for _, coll := range collections {
+		if coll.StoredName != "" {
+			aliases[coll.StoredName] = coll.Name
+		}
+	}
+	return aliases
+}
+
+// metadataAliases returns the aliases the chunk headers of collections stored under stealth
+// names may carry, from their metadata, which key opens if it is sealed
+func metadataAliases(ctx context.Context, collections []file.Collection, key []byte) pad.Aliases {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	aliases := make(pad.Aliases)
+	for _, coll := range collections {
+		if coll.StoredName != "" {
+			aliases[coll.StoredName] = coll.Name
+		}
+		md, err := file.ReadMetadata(ctx, coll, key)
+		if err != nil {
+			if errors.Is(err, file.ErrMetadataSealed) && file.IsStealthName(coll.DiskName()) {
+				log.Infof("Collection %s has sealed metadata; without the metadata key its chunks can't be matched to its name", coll.DiskName())
+			}
+			continue
+		}
+		addMetadataAlias(aliases, md)
+	}
+	return aliases
+}
+
+// addMetadataAlias adds to aliases the stealth name md records its collection is stored under,
+// if any
+func addMetadataAlias(aliases pad.Aliases, md *file.Metadata) {
+	if md != nil && md.StoredName != "" && md.Collection != "" {
+		aliases[md.StoredName] = md.Collection
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// TestStealthChunkHeaders checks that the chunks of collections stored under stealth names
+// carry the stealth names rather than the collection names, and that only the sealed
+// metadata maps them back
+func TestStealthChunkHeaders(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	encodeDir := filepath.Join(tempDir, "encoded")
+	writeFiles(t, inputDir, map[string]string{"a.txt": strings.Repeat("hidden scheme ", 100)})
+	key := []byte("metadata key")
+
+	cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(encodeDir), WithScheme(2, 3), WithFormat(FormatBin),
+		WithChunkSize(512), WithArchive(""), WithStealthNames(), WithMetadataKey(key), WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	chunkFiles, err := filepath.Glob(filepath.Join(encodeDir, "*", "*.bin"))
+	if err != nil || len(chunkFiles) == 0 {
+		t.Fatalf("Expected chunk files, got %v (%v)", chunkFiles, err)
+	}
+	for _, path := range chunkFiles {
+		c, err := InspectChunkFile(ctx, path)
+		if err != nil {
+			t.Fatalf("Failed to inspect %s: %v", path, err)
+		}
+		name := string(c.Payload[1 : 1+int(c.Payload[0])])
+		stored := filepath.Base(filepath.Dir(path))
+		if !strings.HasPrefix(name, stored+":") || !errors.Is(c.HeaderErr, pad.ErrUnresolvedAlias) {
+			t.Errorf("Expected the chunk %s to be named by its stealth name %s, got %q (%v)", path, stored, name, c.HeaderErr)
+		}
+	}
+
+	// Without the metadata key, nothing maps the stealth names to collections
+	decodeCfg, err := NewDecodeConfig(WithInputs(encodeDir), WithOutput(filepath.Join(tempDir, "nokey")))
+	if err != nil {
+		t.Fatalf("NewDecodeConfig failed: %v", err)
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); !errors.Is(err, ErrUnresolvedAlias) {
+		t.Errorf("Expected decoding without the metadata key to fail with ErrUnresolvedAlias, got %v", err)
+	}
+	report, err := VerifyCollections(ctx, VerifyConfig{InputDirs: []string{encodeDir}})
+	if err != nil || report.Passed() {
+		t.Errorf("Expected verifying without the metadata key to fail, got %v", err)
+	}
+
+	// With it, the collections decode and verify as usual
+	decodeDir := filepath.Join(tempDir, "decoded")
+	decodeCfg, err = NewDecodeConfig(WithInputs(encodeDir), WithOutput(decodeDir), WithMetadataKey(key))
+	if err != nil {
+		t.Fatalf("NewDecodeConfig failed: %v", err)
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode with the metadata key: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(decodeDir, "a.txt")); err != nil || string(got) != strings.Repeat("hidden scheme ", 100) {
+		t.Errorf("Expected the data to be restored, got %q (%v)", got, err)
+	}
+	report, err = VerifyCollections(ctx, VerifyConfig{InputDirs: []string{encodeDir}, MetadataKey: key})
+	if err != nil || !report.Passed() {
+		t.Errorf("Expected the collections to verify with the metadata key (%v)", err)
+	}
+	for _, check := range report.Collections {
+		if !file.IsCollectionName(check.Name) {
+			t.Errorf("Expected verify to name the collection, got %q", check.Name)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// StreamOptions controls how DecodeStreams treats the reconstructed stream.
+type StreamOptions struct {
+	Compression Compression // Compression applied at encode time; compressed streams are decompressed before being written
+	Passphrase  []byte      // Passphrase the stream was masked with at encode time, if any
+	HiddenKey   []byte      // If set, the hidden volume this secret opens is decoded instead of the stream
+}
+
+// DecodeStreams reconstructs the original stream from already-open share streams.
+//
+// Each reader must deliver the concatenated chunk payloads of one collection, in chunk
+// order, exactly as produced by the pad encoder (the same byte stream a ChunkReaderAdapter
+// yields for a collection on disk). This bypasses all filesystem discovery, so services
+// can feed shares from network sockets or in-memory buffers directly.
+//
+// The reconstructed data is written to w. Unless opts.Compression is CompressionNone the
+// stream is decompressed first, with the algorithm detected from the stream itself, so w receives the serialized tar stream; otherwise w
+// receives the raw decoded payload. With opts.Passphrase, the passphrase mask is removed
+// before anything else, and any padding added at encode time is always trimmed; with
+// opts.HiddenKey, the hidden volume in the padding is decoded instead. A TAR that was
+// deduplicated at encode time is always rebuilt.
+func DecodeStreams(ctx context.Context, shares []io.Reader, w io.Writer, opts StreamOptions) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if len(shares) == 0 {
+		return fmt.Errorf("no share streams provided")
+	}
+	log.Debugf("Decoding from %d share streams", len(shares))
+
+	p, err := pad.NewPadForDecode(ctx, len(shares))
+	if err != nil {
+		log.Error(fmt.Errorf("failed to create pad instance: %w", err))
+		return err
+	}
+
+	// Unmasking, unpadding, and decompression need to peek at the stream, so they run in
+	// their own goroutine connected to the decoder by a pipe
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	var unmaskErr error
+	go func() {
+		defer pr.Close()
+		r, err := file.UnmaskStream(ctx, pr, opts.Passphrase)
+		unmaskErr = err
+		if err == nil && len(opts.HiddenKey) > 0 {
+			r, err = file.RevealHidden(ctx, r, opts.HiddenKey)
+		} else if err == nil {
+			r, err = file.UnpadStream(ctx, r)
+		}
+		if err == nil && opts.Compression.effective() != CompressionNone {
+			r, err = file.DecompressStreamToStream(ctx, r)
+		}
+		if err == nil {
+			var undeduped io.ReadCloser
+			if undeduped, err = file.UndedupStream(ctx, r); err == nil {
+				defer undeduped.Close()
+				r = undeduped
+			}
+		}
+		if err == nil {
+			_, err = io.Copy(w, r)
+		}
+		if err != nil {
+			pr.CloseWithError(err)
+		}
+		done <- err
+	}()
+
+	decodeErr := p.Decode(ctx, shares, pw)
+	pw.CloseWithError(decodeErr)
+	copyErr := <-done
+
+	// A missing or wrong passphrase, or a hidden volume that doesn't open, stops the decoder
+	// too, but is the error to report
+	if unmaskErr != nil {
+		return unmaskErr
+	}
+	if errors.Is(copyErr, file.ErrNoHiddenVolume) {
+		return copyErr
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("decoding failed: %w", decodeErr)
+	}
+	if copyErr != nil {
+		return fmt.Errorf("decompression failed: %w", copyErr)
+	}
+	return nil
+}
+
+// EncodeFrames encodes cfg.InputDir and writes every chunk to w as a framed record (see
+// file.FrameMagic) instead of writing collections to disk. Only the input, threshold,
+// chunk size, RNG, compression, padding, and passphrase settings of cfg are used.
+//
+// This lets arbitrary transport or storage commands handle each chunk without padlock
+// knowing about the backend. DecodeFrames reverses the process.
+func EncodeFrames(ctx context.Context, cfg EncodeConfig, w io.Writer) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+	log.Infof("Starting framed encode: InputDir=%s", cfg.InputDir)
+
+	frames := file.NewFrameWriter(w)
+	sink := ChunkSinkFunc(func(ctx context.Context, collection string, chunkNumber int) (io.WriteCloser, error) {
+		return frames.ChunkWriter(collection, chunkNumber), nil
+	})
+	if err := encodeToSink(ctx, cfg, sink); err != nil {
+		return err
+	}
+	if err := frames.Flush(); err != nil {
+		log.Error(fmt.Errorf("failed to write frames: %w", err))
+		return fmt.Errorf("failed to write frames: %w", err)
+	}
+	return nil
+}
+
+// DecodeFrames reads framed records produced by EncodeFrames from r and reconstructs the
+// original directory in cfg.OutputDir.
+//
+// Records may be interleaved across collections in any way, but the records of each
+// collection must arrive in chunk order. They are spooled to a temporary directory until
+// the stream ends, since every collection is needed from the first chunk onwards.
+func DecodeFrames(ctx context.Context, r io.Reader, cfg DecodeConfig) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+	log.Infof("Starting framed decode: OutputDir=%s", cfg.OutputDir)
+
+	spoolDir, err := file.MkdirTemp("padlock-frames-")
+	if err != nil {
+		return fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	defer os.RemoveAll(spoolDir)
+
+	spools := make(map[string]*os.File)
+	nextChunk := make(map[string]int)
+	var names []string
+	defer func() {
+		for _, f := range spools {
+			f.Close()
+		}
+	}()
+
+	frames := 0
+	for {
+		frame, err := file.ReadFrame(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Error(fmt.Errorf("failed to read frame %d: %w", frames+1, err))
+			return fmt.Errorf("failed to read frame %d: %w", frames+1, err)
+		}
+		frames++
+
+		spool, ok := spools[frame.Collection]
+		if !ok {
+			if !file.IsCollectionName(frame.Collection) {
+				return fmt.Errorf("frame %d has invalid collection name %q", frames, frame.Collection)
+			}
+			spool, err = os.Create(filepath.Join(spoolDir, frame.Collection))
+			if err != nil {
+				return fmt.Errorf("failed to create spool file: %w", err)
+			}
+			spools[frame.Collection] = spool
+			nextChunk[frame.Collection] = 1
+			names = append(names, frame.Collection)
+		}
+		if frame.Chunk != nextChunk[frame.Collection] {
+			return fmt.Errorf("collection %s: expected chunk %d, got chunk %d", frame.Collection, nextChunk[frame.Collection], frame.Chunk)
+		}
+		nextChunk[frame.Collection]++
+
+		if _, err := spool.Write(frame.Data); err != nil {
+			return fmt.Errorf("failed to spool collection %s: %w", frame.Collection, err)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no frames found in input")
+	}
+	sort.Strings(names)
+	log.Infof("Read %d frames from %d collections: %s", frames, len(names), strings.Join(names, ", "))
+
+	shares := make([]io.Reader, len(names))
+	for i, name := range names {
+		if _, err := spools[name].Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind spool for collection %s: %w", name, err)
+		}
+		shares[i] = spools[name]
+	}
+
+	if err := decodeSharesToDirectory(ctx, shares, cfg); err != nil {
+		return err
+	}
+
+	log.Infof("Framed decode complete")
+	return nil
+}
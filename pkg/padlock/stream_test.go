@@ -0,0 +1,203 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// bufferCloser is an in-memory chunk writer used to capture encoded shares
+type bufferCloser struct {
+	*bytes.Buffer
+}
+
+func (b bufferCloser) Close() error {
+	return nil
+}
+
+func TestDecodeStreams(t *testing.T) {
+	// Create a context for this test
+	ctx := context.Background()
+	tracer := trace.NewTracer("TEST", trace.LogLevelVerbose)
+	ctx = trace.WithContext(ctx, tracer)
+
+	original := bytes.Repeat([]byte("stream decode test data "), 200)
+
+	for _, compression := range []Compression{CompressionNone, CompressionGzip} {
+		// Encode into one in-memory buffer per collection
+		p, err := pad.NewPadForEncode(ctx, 3, 2)
+		if err != nil {
+			t.Fatalf("Failed to create pad: %v", err)
+		}
+		shares := make(map[string]*bytes.Buffer)
+		for _, name := range p.Collections {
+			shares[name] = &bytes.Buffer{}
+		}
+		newChunk := func(collectionName string, chunkNumber int, chunkFormat string) (io.WriteCloser, error) {
+			return bufferCloser{shares[collectionName]}, nil
+		}
+
+		var input io.Reader = bytes.NewReader(original)
+		if compression == CompressionGzip {
+			input = file.CompressStreamToStream(ctx, input)
+		}
+		if err := p.Encode(ctx, 256, input, pad.NewDefaultRand(ctx), newChunk, "bin"); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+
+		// Decode using only two of the three shares
+		readers := []io.Reader{shares[p.Collections[0]], shares[p.Collections[2]]}
+		var out bytes.Buffer
+		if err := DecodeStreams(ctx, readers, &out, StreamOptions{Compression: compression}); err != nil {
+			t.Fatalf("DecodeStreams failed: %v", err)
+		}
+
+		if !bytes.Equal(out.Bytes(), original) {
+			t.Errorf("Decoded data does not match original (compression %d): got %d bytes, want %d",
+				compression, out.Len(), len(original))
+		}
+	}
+}
+
+func TestDecodeStreamsNoShares(t *testing.T) {
+	if err := DecodeStreams(context.Background(), nil, io.Discard, StreamOptions{}); err == nil {
+		t.Errorf("Expected error when no share streams are provided")
+	}
+}
+
+func TestEncodeDecodeFrames(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+
+	tempDir, err := os.MkdirTemp("", "padlock-frames-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	content := bytes.Repeat([]byte("framed stream test data "), 100)
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	cfg := EncodeConfig{
+		InputDir:    inputDir,
+		N:           3,
+		K:           2,
+		Format:      FormatBin,
+		ChunkSize:   256,
+		RNG:         pad.NewDefaultRand(ctx),
+		Compression: CompressionGzip,
+	}
+	var stream bytes.Buffer
+	if err := EncodeFrames(ctx, cfg, &stream); err != nil {
+		t.Fatalf("EncodeFrames failed: %v", err)
+	}
+
+	// Keep only the frames of two collections, as a transport that lost one would
+	var kept bytes.Buffer
+	for {
+		frame, err := file.ReadFrame(&stream)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadFrame failed: %v", err)
+		}
+		if frame.Collection == "2B3" {
+			continue
+		}
+		if err := file.WriteFrame(&kept, frame); err != nil {
+			t.Fatalf("WriteFrame failed: %v", err)
+		}
+	}
+
+	outputDir := filepath.Join(tempDir, "output")
+	decodeCfg := DecodeConfig{OutputDir: outputDir, Compression: CompressionGzip}
+	if err := DecodeFrames(ctx, &kept, decodeCfg); err != nil {
+		t.Fatalf("DecodeFrames failed: %v", err)
+	}
+	decoded, err := os.ReadFile(filepath.Join(outputDir, "test.txt"))
+	if err != nil || !bytes.Equal(decoded, content) {
+		t.Errorf("Decoded content mismatch: %d bytes, %v", len(decoded), err)
+	}
+
+	// An empty stream has nothing to decode
+	if err := DecodeFrames(ctx, &bytes.Buffer{}, decodeCfg); err == nil {
+		t.Errorf("Expected an error decoding an empty stream")
+	}
+}
+
+// TestFramesPassphrase checks that framed chunks carry the passphrase mask through to decode
+func TestFramesPassphrase(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "data.txt"), []byte("framed and masked"), 0644); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+	passphrase := []byte("frames passphrase")
+
+	var stream bytes.Buffer
+	cfg := EncodeConfig{InputDir: inputDir, N: 2, K: 2, Format: FormatBin, ChunkSize: 256, RNG: pad.NewDefaultRand(ctx), Compression: CompressionGzip, Passphrase: passphrase}
+	if err := EncodeFrames(ctx, cfg, &stream); err != nil {
+		t.Fatalf("EncodeFrames failed: %v", err)
+	}
+	frames := stream.Bytes()
+
+	err := DecodeFrames(ctx, bytes.NewReader(frames), DecodeConfig{OutputDir: filepath.Join(tempDir, "missing"), Compression: CompressionGzip})
+	if !errors.Is(err, file.ErrPassphraseRequired) {
+		t.Errorf("Expected ErrPassphraseRequired, got %v", err)
+	}
+	outputDir := filepath.Join(tempDir, "output")
+	if err := DecodeFrames(ctx, bytes.NewReader(frames), DecodeConfig{OutputDir: outputDir, Compression: CompressionGzip, Passphrase: passphrase}); err != nil {
+		t.Fatalf("DecodeFrames failed: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(outputDir, "data.txt")); err != nil || string(got) != "framed and masked" {
+		t.Errorf("Decoded %q, %v", got, err)
+	}
+}
+
+func TestFramesPadding(t *testing.T) {
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "data.txt"), []byte("framed and padded"), 0644); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+
+	var stream bytes.Buffer
+	cfg := EncodeConfig{InputDir: inputDir, N: 2, K: 2, Format: FormatBin, ChunkSize: 1024, RNG: pad.NewDefaultRand(ctx), Compression: CompressionNone, PadTo: Padding{Mode: PadFixed, Size: 32 * 1024}}
+	if err := EncodeFrames(ctx, cfg, &stream); err != nil {
+		t.Fatalf("EncodeFrames failed: %v", err)
+	}
+	if stream.Len() < 2*32*1024 {
+		t.Errorf("Expected at least two padded shares in %d bytes of frames", stream.Len())
+	}
+	outputDir := filepath.Join(tempDir, "output")
+	if err := DecodeFrames(ctx, bytes.NewReader(stream.Bytes()), DecodeConfig{OutputDir: outputDir}); err != nil {
+		t.Fatalf("DecodeFrames failed: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(outputDir, "data.txt")); err != nil || string(got) != "framed and padded" {
+		t.Errorf("Decoded %q, %v", got, err)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// checkOutputStream checks that what the collections encode, a TAR of input directories or
+// the raw stream named stream, can be written where cfg writes it. A TAR is extracted to an
+// output directory unless OutputTar writes it to the output stream as it is, and a raw stream
+// isn't a TAR, so it can't be written as one. A deduplicated TAR is only rebuilt once it is
+// decompressed, so it can't be written still compressed.
+func checkOutputStream(cfg DecodeConfig, stream string, dedup bool) error {
+	switch {
+	case cfg.OutputTar && stream != "":
+		return fmt.Errorf("the collections encode the stream %s rather than a TAR; decode it without the TAR output", stream)
+	case cfg.OutputTar && cfg.KeepCompressed && dedup:
+		return fmt.Errorf("the collections hold a deduplicated TAR, which is only rebuilt once it is decompressed; decode it without keeping it compressed")
+	case cfg.Filter != nil && stream != "":
+		return fmt.Errorf("the collections encode the stream %s, which has no files to select", stream)
+	case cfg.OutputStream != nil && !cfg.OutputTar && stream == "":
+		return fmt.Errorf("the collections encode a directory, which can only be decoded to an output directory or as a TAR")
+	}
+	return nil
+}
+
+// outputDescription names where the decode writes for its log
+func (cfg DecodeConfig) outputDescription() string {
+	switch {
+	case cfg.OutputTar:
+		return "the output stream, as a TAR"
+	case cfg.OutputStream != nil:
+		return "the output stream"
+	}
+	return cfg.OutputDir
+}
+
+// writeTarStream writes the decoded TAR to cfg.OutputStream as it is, rather than extracting
+// it. It still ends with the manifest of file hashes, as the entry file.HashManifestName, so
+// the files can be checked once they are extracted; nothing is checked here but the stream.
+func writeTarStream(ctx context.Context, cfg DecodeConfig, r io.Reader) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	// Report how the TAR is compressed, if it is, so it can be stored under a fitting name
+	br := bufio.NewReader(r)
+	prefix, _ := br.Peek(4)
+	kind := "an uncompressed TAR"
+	if algorithm := file.DetectCompression(prefix); algorithm != "" {
+		kind = "a " + algorithm + "-compressed TAR"
+	}
+
+	n, err := io.Copy(cfg.OutputStream, br)
+	if err != nil {
+		return fmt.Errorf("failed to write the decoded TAR: %w", err)
+	}
+	log.Infof("Wrote the decoded data as %s (%s) to the output stream", kind, FormatByteSize(n))
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// tarContents returns the contents of the regular files in a TAR by name
+func tarContents(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+	contents := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return contents
+		}
+		if err != nil {
+			t.Fatalf("Failed to read TAR: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", hdr.Name, err)
+		}
+		contents[hdr.Name] = string(data)
+	}
+}
+
+// TestTarOutput checks that a decode with a TAR output writes the TAR the collections encode
+// instead of extracting it, decompressed or as it was compressed, from collections on disk or
+// from a chunk source
+func TestTarOutput(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	files := map[string]string{"a.txt": strings.Repeat("alpha ", 300), "sub/b.txt": "beta"}
+	for name, content := range files {
+		path := filepath.Join(inputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	encodeDir := filepath.Join(tempDir, "encoded")
+	cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(encodeDir), WithScheme(2, 3), WithFormat(FormatBin),
+		WithChunkSize(1024), WithCompression(CompressionGzip, 0), WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	check := func(name string, r io.Reader) {
+		t.Helper()
+		contents := tarContents(t, r)
+		for path, content := range files {
+			if contents[path] != content {
+				t.Errorf("%s: expected %s in the TAR", name, path)
+			}
+		}
+		if _, ok := contents[file.HashManifestName]; !ok {
+			t.Errorf("%s: expected the TAR to end with the hash manifest", name)
+		}
+	}
+
+	var out bytes.Buffer
+	decodeCfg, err := NewDecodeConfig(WithInputs(encodeDir), WithTarOutput(&out, false))
+	if err != nil {
+		t.Fatalf("NewDecodeConfig failed: %v", err)
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode to a TAR: %v", err)
+	}
+	check("uncompressed", &out)
+
+	out.Reset()
+	decodeCfg, err = NewDecodeConfig(WithInputs(encodeDir), WithTarOutput(&out, true))
+	if err != nil {
+		t.Fatalf("NewDecodeConfig failed: %v", err)
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode to a compressed TAR: %v", err)
+	}
+	zr, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("Expected a gzip-compressed TAR: %v", err)
+	}
+	check("compressed", zr)
+
+	// Chunks from a source decode to a TAR the same way
+	store := newMemoryStore()
+	sinkCfg, err := NewEncodeConfig(WithInput(inputDir), WithChunkSink(store), WithChunkSize(1024), WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, sinkCfg); err != nil {
+		t.Fatalf("Failed to encode to a chunk sink: %v", err)
+	}
+	out.Reset()
+	decodeCfg, err = NewDecodeConfig(WithChunkSource(store), WithTarOutput(&out, false))
+	if err != nil {
+		t.Fatalf("NewDecodeConfig failed: %v", err)
+	}
+	if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+		t.Fatalf("Failed to decode a chunk source to a TAR: %v", err)
+	}
+	check("chunk source", &out)
+}
+
+// TestTarOutputRefusesStream checks that collections of a raw stream aren't written as a TAR
+func TestTarOutputRefusesStream(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	encodeDir := filepath.Join(t.TempDir(), "encoded")
+	cfg, err := NewEncodeConfig(WithRawInput(strings.NewReader("raw"), "raw.bin"), WithOutputs(encodeDir),
+		WithFormat(FormatBin), WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode stream: %v", err)
+	}
+	var out bytes.Buffer
+	err = DecodeDirectory(ctx, DecodeConfig{InputDir: encodeDir, OutputStream: &out, OutputTar: true, RNG: pad.NewDefaultRand(ctx)})
+	if err == nil || !strings.Contains(err.Error(), "rather than a TAR") {
+		t.Errorf("Expected decoding a stream as a TAR to fail, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// VerifyConfig holds the configuration for verifying collections without decoding them
+type VerifyConfig struct {
+	InputDirs   []string    // Collection directories or directories containing collections and collection TARs
+	Retry       RetryPolicy // Retry policy for transient chunk read failures (directory collections only)
+	MetadataKey []byte      // Passphrase for encrypted collection metadata, used for review-date checks and to name stealth collections
+	MACKey      []byte      // If set, every chunk is authenticated with the MACs derived from this passphrase
+}
+
+// CollectionCheck is the result of verifying a single collection
+type CollectionCheck struct {
+	Collection     file.Collection  // The collection as it was found on disk
+	Name           string           // Collection name recorded in its chunk headers
+	RequiredCopies int              // K recorded in the chunk headers
+	TotalCopies    int              // N recorded in the chunk headers
+	Sharing        pad.Sharing      // Secret sharing scheme recorded in the chunk headers
+	Chunks         int              // Number of chunks read
+	Bytes          int64            // Total size of the chunk payloads
+	Corrected      int              // Chunks whose damage was corrected from their parity sidecars
+	Par2           *file.Par2Report // Result of checking the collection's PAR2 recovery files, if it has any
+	Problems       []string         // Everything found wrong with the collection
+}
+
+// Passed reports whether the collection has chunks and no problems were found
+func (c *CollectionCheck) Passed() bool {
+	return c.Chunks > 0 && len(c.Problems) == 0
+}
+
+func (c *CollectionCheck) problem(format string, args ...interface{}) {
+	c.Problems = append(c.Problems, fmt.Sprintf(format, args...))
+}
+
+// checkRecordedChunks reports a collection with a different number of chunks than its
+// metadata records. Collections encoded before the count was recorded aren't checked.
+func (c *CollectionCheck) checkRecordedChunks(md *file.Metadata) {
+	if md == nil || md.Chunks == 0 || c.Name == "" {
+		return
+	}
+	if c.Chunks != md.Chunks {
+		c.problem("has %d chunks, but its metadata records %d", c.Chunks, md.Chunks)
+	}
+}
+
+// VerifyReport is the result of VerifyCollections
+type VerifyReport struct {
+	Collections []CollectionCheck
+}
+
+// Passed reports whether every collection passed
+func (r *VerifyReport) Passed() bool {
+	for i := range r.Collections {
+		if !r.Collections[i].Passed() {
+			return false
+		}
+	}
+	return len(r.Collections) > 0
+}
+
+// Failed returns the number of collections that did not pass
+func (r *VerifyReport) Failed() int {
+	failed := 0
+	for i := range r.Collections {
+		if !r.Collections[i].Passed() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// VerifyCollections checks the integrity of every collection found in cfg.InputDirs without
+// decoding anything, so any number of collections can be checked, even a single one.
+//
+// Every chunk is read as decode would read it, which verifies PNG rAWd CRCs and any .sha256
+// sidecars, and corrects damage covered by any .parity sidecars. The chunk header is then checked against the collection: each chunk must belong
+// to the same collection and K-of-N scheme, chunk numbers must be contiguous from 1, and each
+// chunk must be exactly the size its header describes, which detects truncated bin chunks.
+// The files of a collection with PAR2 recovery files must match the checksums in them. With
+// cfg.MACKey, every chunk must also pass authentication against the collection's chunk MACs.
+// Finally, each collection must have the number of chunks its metadata records, and
+// collections of the same distribution must all have the same number of chunks.
+func VerifyCollections(ctx context.Context, cfg VerifyConfig) (*VerifyReport, error) {
+	log := trace.FromContext(ctx).WithPrefix("verify")
+
+	collections, tempDir, err := findInputCollections(ctx, "", cfg.InputDirs, 0)
+	if err != nil {
+		return nil, err
+	}
+	if tempDir != "" {
+		defer os.RemoveAll(tempDir)
+	}
+
+	// Warn if the collections are overdue for review
+	CheckReviewDates(ctx, collections, cfg.MetadataKey, time.Now())
+
+	report := &VerifyReport{}
+	for i, coll := range collections {
+		log.Infof("Verifying collection %s (%d of %d)", coll.DiskName(), i+1, len(collections))
+		check, err := verifyCollection(ctx, coll, cfg.Retry, cfg.MACKey, metadataAliases(ctx, []file.Collection{coll}, cfg.MetadataKey))
+		if err != nil {
+			return nil, err
+		}
+		if md, err := file.ReadMetadata(ctx, coll, cfg.MetadataKey); err == nil {
+			check.checkRecordedChunks(md)
+		}
+		report.Collections = append(report.Collections, check)
+	}
+
+	// A collection with fewer chunks than the others of its distribution is incomplete
+	longest := make(map[string]int)
+	for _, check := range report.Collections {
+		scheme := fmt.Sprintf("%dof%d", check.RequiredCopies, check.TotalCopies)
+		longest[scheme] = max(longest[scheme], check.Chunks)
+	}
+	for i := range report.Collections {
+		check := &report.Collections[i]
+		scheme := fmt.Sprintf("%dof%d", check.RequiredCopies, check.TotalCopies)
+		if check.Name != "" && check.Chunks < longest[scheme] {
+			check.problem("has %d chunks, but other %s collections have %d", check.Chunks, scheme, longest[scheme])
+		}
+	}
+
+	return report, nil
+}
+
+// verifyCollection reads every chunk of a collection and checks it against its header, read
+// through aliases, and against its MAC if macKey is set
+func verifyCollection(ctx context.Context, coll file.Collection, retry RetryPolicy, macKey []byte, aliases pad.Aliases) (CollectionCheck, error) {
+	log := trace.FromContext(ctx).WithPrefix("verify")
+
+	check := CollectionCheck{Collection: coll}
+	reader := file.NewCollectionReader(coll)
+	reader.Retry = retry
+	defer reader.Close()
+	tarBased := strings.HasSuffix(coll.Path, ".tar")
+
+	var macs *file.ChunkMACs
+	if len(macKey) > 0 {
+		var err error
+		if macs, err = file.ReadChunkMACs(ctx, coll, macKey); errors.Is(err, os.ErrNotExist) {
+			check.problem("no chunk MACs, so its chunks can't be authenticated")
+		} else if err != nil {
+			check.problem("%v", err)
+		}
+	}
+	stopped := false
+	unresolved := false
+
+	expected := 1
+	for {
+		if err := ctx.Err(); err != nil {
+			return check, err
+		}
+
+		position := reader.ChunkIndex
+		data, err := reader.ReadNextChunk(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			check.problem("chunk %d: %v", position, err)
+			if tarBased {
+				// A damaged TAR can't be read past the bad entry
+				check.problem("chunks after chunk %d were not checked", position)
+				stopped = true
+				break
+			}
+			// Chunk files are independent, so carry on with the next one
+			reader.ChunkIndex++
+			expected++
+			continue
+		}
+		check.Chunks++
+		check.Bytes += int64(len(data))
+		if macs != nil {
+			if err := macs.Verify(position, data); err != nil {
+				check.problem("%v", err)
+			}
+		}
+
+		header, err := pad.ParseChunkHeaderWith(data, aliases)
+		if errors.Is(err, pad.ErrUnresolvedAlias) && file.IsStealthName(coll.DiskName()) {
+			// Only the metadata, which may be sealed, maps a stealth name to the collection
+			if !unresolved {
+				check.problem("its chunks name it by its stealth name, which its metadata doesn't map to a collection; give the metadata key to check them")
+				unresolved = true
+			}
+			expected++
+			continue
+		}
+		if err != nil {
+			check.problem("chunk %d: invalid header: %v", position, err)
+			expected++
+			continue
+		}
+		if check.Name == "" {
+			check.Name = header.Collection
+			check.RequiredCopies = header.RequiredCopies
+			check.TotalCopies = header.TotalCopies
+			check.Sharing = header.Sharing
+			if !file.IsStealthName(coll.Name) && coll.Name != header.Collection {
+				check.problem("stored as %s, but its chunks belong to collection %s", coll.Name, header.Collection)
+			}
+		} else if header.Collection != check.Name {
+			check.problem("chunk %d: belongs to collection %s, not %s", position, header.Collection, check.Name)
+		}
+		if header.Number != expected {
+			check.problem("chunk %d: numbered %d, expected %d (chunks missing or out of order)", position, header.Number, expected)
+			expected = header.Number
+		}
+		expected++
+		if header.ChunkBytes() != int64(len(data)) {
+			check.problem("chunk %d: %d bytes, but its header describes %d", position, len(data), header.ChunkBytes())
+		}
+	}
+
+	if read := reader.ChunkIndex - 1; macs != nil && !stopped && read < macs.Len() {
+		check.problem("ends after %d chunks, but has MACs for %d (chunks missing)", read, macs.Len())
+	}
+
+	check.Corrected = reader.CorrectedChunks
+	checkPar2(ctx, &check)
+	if check.Chunks == 0 && len(check.Problems) == 0 {
+		check.problem("no chunks found")
+	}
+	log.Debugf("Collection %s: %d chunks, %d problems", coll.DiskName(), check.Chunks, len(check.Problems))
+	return check, nil
+}
+
+// checkPar2 checks the files of a collection against its PAR2 recovery files, if it has any
+func checkPar2(ctx context.Context, check *CollectionCheck) {
+	report, err := file.VerifyCollectionPar2(ctx, check.Collection)
+	if err != nil {
+		check.problem("PAR2 recovery files: %v", err)
+		return
+	}
+	check.Par2 = report
+	if report == nil || len(report.Damaged) == 0 {
+		return
+	}
+	index := filepath.Base(report.IndexPath)
+	for _, name := range report.Damaged {
+		check.problem("%s doesn't match %s", name, index)
+	}
+	if report.Repairable() {
+		check.problem("%d damaged slices, %d recovery slices: repair with \"par2 repair %s\"", report.DamagedSlices, report.RecoverySlices, index)
+	} else {
+		check.problem("%d damaged slices, but only %d recovery slices, too few for PAR2 to repair", report.DamagedSlices, report.RecoverySlices)
+	}
+}
+
+// Print writes the verification results as a human-readable report
+func (r *VerifyReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "%-16s %-8s %-6s %8s %18s  %s\n", "Collection", "Scheme", "Format", "Chunks", "Size", "Result")
+	for i := range r.Collections {
+		check := &r.Collections[i]
+		name := check.Collection.DiskName()
+		if check.Name != "" && check.Name != name {
+			name = fmt.Sprintf("%s (%s)", check.Name, name)
+		}
+		scheme := "?"
+		if check.Name != "" {
+			scheme = fmt.Sprintf("%dof%d", check.RequiredCopies, check.TotalCopies)
+		}
+		result := "PASS"
+		if !check.Passed() {
+			result = "FAIL"
+		}
+		fmt.Fprintf(w, "%-16s %-8s %-6s %8d %18s  %s\n", name, scheme, check.Collection.Format, check.Chunks, FormatByteSize(check.Bytes), result)
+		for _, problem := range check.Problems {
+			fmt.Fprintf(w, "    - %s\n", problem)
+		}
+		if check.Corrected > 0 {
+			fmt.Fprintf(w, "    - %d damaged chunks were corrected from their parity sidecars; repair the collection to restore them\n", check.Corrected)
+		}
+	}
+	fmt.Fprintf(w, "%d of %d collections passed\n", len(r.Collections)-r.Failed(), len(r.Collections))
+}
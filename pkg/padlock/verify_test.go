@@ -0,0 +1,183 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestVerifyCollections(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir, err := os.MkdirTemp("", "padlock-verify-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), bytes.Repeat([]byte("verify me "), 200), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	encode := func(outputDir string, format Format, archive bool) {
+		cfg := EncodeConfig{
+			InputDir:           inputDir,
+			OutputDir:          outputDir,
+			N:                  3,
+			K:                  2,
+			Format:             format,
+			ChunkSize:          256,
+			RNG:                pad.NewDefaultRand(ctx),
+			ClearIfNotEmpty:    true,
+			Compression:        CompressionNone,
+			ArchiveCollections: archive,
+		}
+		if err := EncodeDirectory(ctx, cfg); err != nil {
+			t.Fatalf("Failed to encode directory: %v", err)
+		}
+	}
+
+	// Intact TAR collections pass
+	tarDir := filepath.Join(tempDir, "tars")
+	encode(tarDir, FormatBin, true)
+	report, err := VerifyCollections(ctx, VerifyConfig{InputDirs: []string{tarDir}})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if len(report.Collections) != 3 || !report.Passed() {
+		t.Fatalf("Expected 3 passing collections, got %+v", report.Collections)
+	}
+	if c := report.Collections[0]; c.Name != "2A3" || c.RequiredCopies != 2 || c.TotalCopies != 3 || c.Chunks < 3 {
+		t.Errorf("Unexpected result for the first collection: %+v", c)
+	}
+
+	// Damage one chunk of 2B3 and remove one chunk of 2C3
+	filesDir := filepath.Join(tempDir, "files")
+	encode(filesDir, FormatPNG, false)
+	damaged := filepath.Join(filesDir, "2B3", "IMG2B3_0002.PNG")
+	data, err := os.ReadFile(damaged)
+	if err != nil {
+		t.Fatalf("Failed to read chunk: %v", err)
+	}
+	data[len(data)-20] ^= 0xff // Inside the rAWd payload, before its CRC and the IEND chunk
+	if err := os.WriteFile(damaged, data, 0644); err != nil {
+		t.Fatalf("Failed to write chunk: %v", err)
+	}
+	if err := os.Remove(filepath.Join(filesDir, "2C3", "IMG2C3_0003.PNG")); err != nil {
+		t.Fatalf("Failed to remove chunk: %v", err)
+	}
+
+	report, err = VerifyCollections(ctx, VerifyConfig{InputDirs: []string{filesDir}})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if report.Passed() || report.Failed() != 2 {
+		t.Fatalf("Expected 2 failing collections, got %d", report.Failed())
+	}
+	if !report.Collections[0].Passed() {
+		t.Errorf("Expected 2A3 to pass: %v", report.Collections[0].Problems)
+	}
+	var out bytes.Buffer
+	report.Print(&out)
+	for _, want := range []string{"CRC mismatch", "numbered 4, expected 3", "1 of 3 collections passed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected the report to mention %q:\n%s", want, out.String())
+		}
+	}
+
+	// A single collection can be verified on its own
+	report, err = VerifyCollections(ctx, VerifyConfig{InputDirs: []string{filepath.Join(filesDir, "2A3")}})
+	if err != nil || len(report.Collections) != 1 || !report.Passed() {
+		t.Errorf("Expected a single passing collection, got %+v, %v", report, err)
+	}
+
+	// and without the others to compare with, a missing last chunk shows against the metadata
+	chunks, _ := filepath.Glob(filepath.Join(filesDir, "2A3", "IMG2A3_*.PNG"))
+	if err := os.Remove(chunks[len(chunks)-1]); err != nil {
+		t.Fatalf("Failed to remove chunk: %v", err)
+	}
+	report, err = VerifyCollections(ctx, VerifyConfig{InputDirs: []string{filepath.Join(filesDir, "2A3")}})
+	want := fmt.Sprintf("has %d chunks, but its metadata records %d", len(chunks)-1, len(chunks))
+	if err != nil || report.Passed() || !slices.Contains(report.Collections[0].Problems, want) {
+		t.Errorf("Expected the truncated collection to fail with %q, got %+v, %v", want, report, err)
+	}
+}
+
+func TestVerifyPar2(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatalf("Failed to create input dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(inputDir, "test.txt"), bytes.Repeat([]byte("protect me "), 200), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelVerbose))
+	outputDir := filepath.Join(tempDir, "output")
+	cfg := EncodeConfig{
+		InputDir:           inputDir,
+		OutputDir:          outputDir,
+		N:                  3,
+		K:                  2,
+		Format:             FormatBin,
+		ChunkSize:          256,
+		RNG:                pad.NewDefaultRand(ctx),
+		Compression:        CompressionNone,
+		ArchiveCollections: true,
+		Par2Percent:        10,
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "2B3.par2")); err != nil {
+		t.Fatalf("Expected PAR2 files next to the archive: %v", err)
+	}
+
+	report, err := VerifyCollections(ctx, VerifyConfig{InputDirs: []string{outputDir}})
+	if err != nil || len(report.Collections) != 3 || !report.Passed() {
+		t.Fatalf("Expected 3 passing collections, got %+v, %v", report, err)
+	}
+	if report.Collections[1].Par2 == nil || report.Collections[1].Par2.Files != 1 {
+		t.Errorf("Expected the PAR2 files to be checked: %+v", report.Collections[1].Par2)
+	}
+
+	// Damage the end-of-archive padding, which only the PAR2 checksums cover
+	archive := filepath.Join(outputDir, "2B3.tar")
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(archive, data, 0644); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	report, err = VerifyCollections(ctx, VerifyConfig{InputDirs: []string{outputDir}})
+	if err != nil || report.Failed() != 1 || report.Collections[1].Passed() {
+		t.Fatalf("Expected 2B3 to fail, got %+v, %v", report, err)
+	}
+	var out bytes.Buffer
+	report.Print(&out)
+	if !strings.Contains(out.String(), `par2 repair 2B3.par2`) {
+		t.Errorf("Expected the report to explain how to repair 2B3:\n%s", out.String())
+	}
+}
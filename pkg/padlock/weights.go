@@ -0,0 +1,185 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+// An encode with Weights gives each of several output directories a number of collections in
+// proportion to its weight, rather than one each, so that a small destination holds less of
+// the data than a large one. Every collection is the same size, so a destination's share of
+// the space is its weight over the sum of the weights. K and N then count output directories:
+// the encode is made one of the sum of the K smallest weights out of the sum of all of them,
+// so that any K of the output directories hold enough collections between them to restore the
+// data. Weights under which fewer than K of the larger directories hold enough are refused,
+// since those directories would restore the data without the others.
+//
+// Collections are only as large as the data under Shamir sharing, which a weighted encode
+// uses unless another scheme is given. Under OTP every collection holds a piece for each way
+// of choosing the K-1 others, so the extra collections would make every one of them, and so
+// every destination, several times larger; weights are refused with it.
+
+// ParseWeights parses the weights of n output directories: a comma-separated list of whole
+// numbers, such as 1,2,2, or of capacities, such as 16G,64G,64G. Capacities are turned into
+// weights by dividing each by the smallest, rounding down.
+func ParseWeights(s string, n int) ([]int, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("%d weights given for %d output directories", len(parts), n)
+	}
+
+	weights := make([]int, n)
+	capacities := make([]int64, n)
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if weight, err := strconv.Atoi(part); err == nil {
+			if weight < 1 {
+				return nil, fmt.Errorf("weight %d of output directory %d is less than 1", weight, i+1)
+			}
+			weights[i] = weight
+			continue
+		}
+		capacity, err := file.ParseSize(part)
+		if err != nil || capacity <= 0 {
+			return nil, fmt.Errorf("%q is neither a weight nor a capacity", part)
+		}
+		capacities[i] = capacity
+	}
+
+	// Weights and capacities can't be compared, so they can't be mixed
+	given := 0
+	for _, capacity := range capacities {
+		if capacity > 0 {
+			given++
+		}
+	}
+	switch given {
+	case 0:
+		return weights, nil
+	case n:
+		smallest := slices.Min(capacities)
+		for i, capacity := range capacities {
+			weights[i] = int(capacity / smallest)
+		}
+		return weights, nil
+	}
+	return nil, fmt.Errorf("give either a weight or a capacity for every output directory, not a mix")
+}
+
+// weightedScheme returns the scheme of collections an encode of cfg with Weights is made, or
+// an error if fewer than K of its output directories would hold enough to restore the data
+func weightedScheme(cfg EncodeConfig) (k, n int, err error) {
+	switch {
+	case len(cfg.OutputDirs) < 2 || len(cfg.Weights) != len(cfg.OutputDirs):
+		return 0, 0, fmt.Errorf("%d weights given for %d output directories", len(cfg.Weights), len(cfg.OutputDirs))
+	case cfg.N != len(cfg.OutputDirs):
+		return 0, 0, fmt.Errorf("with weights, the scheme counts output directories: %d given for %d", len(cfg.OutputDirs), cfg.N)
+	case cfg.K < 2 || cfg.K > cfg.N:
+		return 0, 0, fmt.Errorf("%d of %d output directories can't be required: %w", cfg.K, cfg.N, ErrInvalidScheme)
+	case !cfg.ArchiveCollections:
+		return 0, 0, fmt.Errorf("weights need collections written as archives, since several are written to one output directory")
+	case cfg.Append || cfg.Resume:
+		return 0, 0, fmt.Errorf("an encode with weights can't be appended to or resumed")
+	}
+
+	sorted := slices.Clone(cfg.Weights)
+	slices.Sort(sorted)
+	for _, weight := range sorted {
+		if weight < 1 {
+			return 0, 0, fmt.Errorf("weight %d is less than 1", weight)
+		}
+		n += weight
+	}
+	if n > 26 {
+		return 0, 0, fmt.Errorf("the weights add up to %d collections, more than 26; give smaller weights: %w", n, ErrInvalidScheme)
+	}
+
+	// Any K output directories hold at least the K smallest weights, and the K-1 largest ones
+	// must hold fewer
+	for _, weight := range sorted[:cfg.K] {
+		k += weight
+	}
+	held := 0
+	for _, weight := range sorted[len(sorted)-cfg.K+1:] {
+		held += weight
+	}
+	if held >= k {
+		return 0, 0, fmt.Errorf("the %d output directories with the largest weights hold %d collections, enough to restore the data without the others; give weights closer together: %w",
+			cfg.K-1, held, ErrInvalidScheme)
+	}
+	if cfg.Sharing == pad.OTP {
+		return 0, 0, fmt.Errorf("under OTP sharing each of the %d collections would hold %d times the data, rather than each output directory holding a share in proportion to its weight; use Shamir sharing: %w",
+			n, pad.OTP.Pieces(n, k), ErrInvalidScheme)
+	}
+	return k, n, nil
+}
+
+// applyWeights turns an encode of cfg with Weights, whose scheme counts output directories,
+// into one whose scheme counts collections, with labels, notes, custodians, and formats
+// given for each output directory repeated for each of its collections
+func applyWeights(ctx context.Context, cfg *EncodeConfig) error {
+	log := trace.FromContext(ctx).WithPrefix("padlock")
+
+	if len(cfg.Weights) == 0 || cfg.weighted {
+		return nil
+	}
+	k, n, err := weightedScheme(*cfg)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	dirs := len(cfg.OutputDirs)
+	if len(cfg.Labels) == dirs {
+		cfg.Labels = repeatWeighted(cfg.Labels, cfg.Weights)
+	}
+	if len(cfg.Custodians) == dirs {
+		cfg.Custodians = repeatWeighted(cfg.Custodians, cfg.Weights)
+	}
+	if len(cfg.Notes) == dirs {
+		cfg.Notes = repeatWeighted(cfg.Notes, cfg.Weights)
+	}
+	if len(cfg.Formats) == dirs {
+		cfg.Formats = repeatWeighted(cfg.Formats, cfg.Weights)
+	}
+	if cfg.Sharing == nil {
+		log.Infof("Splitting the data with Shamir sharing, so that every collection is the size of the data")
+		cfg.Sharing = pad.Shamir
+	}
+
+	for i, dir := range cfg.OutputDirs {
+		log.Debugf("  %s holds %d of the %d collections", dir, cfg.Weights[i], n)
+	}
+	log.Infof("The %d weighted output directories hold %d collections, any %d of which restore the data, so any %d of the directories do", dirs, n, k, cfg.K)
+	cfg.K, cfg.N = k, n
+	cfg.weighted = true
+	return nil
+}
+
+// repeatWeighted returns values with each repeated as many times as its weight
+func repeatWeighted[T any](values []T, weights []int) []T {
+	var repeated []T
+	for i, value := range values {
+		for range weights[i] {
+			repeated = append(repeated, value)
+		}
+	}
+	return repeated
+}
+
+// collectionOutputDirs returns the output directory of each collection of an encode of cfg
+// with several output directories: each of them once, or as many times as its weight
+func (cfg EncodeConfig) collectionOutputDirs() []string {
+	if !cfg.weighted {
+		return cfg.OutputDirs
+	}
+	return repeatWeighted(cfg.OutputDirs, cfg.Weights)
+}
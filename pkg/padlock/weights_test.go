@@ -0,0 +1,192 @@
+// Copyright 2025 Ray Ozzie and a Mixture-of-Models. All rights reserved.
+
+package padlock
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/blues/padlock/pkg/file"
+	"github.com/blues/padlock/pkg/pad"
+	"github.com/blues/padlock/pkg/trace"
+)
+
+func TestParseWeights(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want []int
+	}{
+		{"1,2,2", 3, []int{1, 2, 2}},
+		{" 3 , 1", 2, []int{3, 1}},
+		{"16G,64G,40G", 3, []int{1, 4, 2}},
+		{"1,2", 3, nil},
+		{"0,1", 2, nil},
+		{"1,16G", 2, nil},
+		{"big,1", 2, nil},
+	}
+	for _, tt := range tests {
+		got, err := ParseWeights(tt.s, tt.n)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("ParseWeights(%q, %d) = %v, expected an error", tt.s, tt.n, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("ParseWeights(%q, %d) = %v, %v, expected %v", tt.s, tt.n, got, err, tt.want)
+		}
+	}
+}
+
+func TestWeightedScheme(t *testing.T) {
+	tests := []struct {
+		weights      []int
+		k            int
+		wantK, wantN int
+	}{
+		{[]int{1, 1, 1}, 2, 2, 3},
+		{[]int{1, 2, 2}, 2, 3, 5},
+		{[]int{1, 4, 4}, 2, 5, 9},
+		{[]int{2, 2, 3, 3}, 3, 7, 10},
+	}
+	for _, tt := range tests {
+		cfg := EncodeConfig{OutputDirs: make([]string, len(tt.weights)), Weights: tt.weights, N: len(tt.weights), K: tt.k,
+			ArchiveCollections: true}
+		k, n, err := weightedScheme(cfg)
+		if err != nil || k != tt.wantK || n != tt.wantN {
+			t.Errorf("%v, %d required: got %d-of-%d (%v), expected %d-of-%d", tt.weights, tt.k, k, n, err, tt.wantK, tt.wantN)
+		}
+	}
+}
+
+// TestWeightedSchemeRefused checks that weights under which fewer than K output directories
+// hold enough collections to restore the data are refused
+func TestWeightedSchemeRefused(t *testing.T) {
+	tests := []struct {
+		weights []int
+		k       int
+	}{
+		{[]int{1, 1, 4}, 2},
+		{[]int{1, 1, 2}, 2},
+		{[]int{1, 2, 3, 4}, 3},
+	}
+	for _, tt := range tests {
+		dirs := make([]string, len(tt.weights))
+		for i := range dirs {
+			dirs[i] = fmt.Sprintf("out%d", i)
+		}
+		_, err := NewEncodeConfig(WithInput("in"), WithOutputs(dirs...), WithWeights(tt.weights...), WithScheme(tt.k, len(dirs)))
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) || configErr.Option != "WithWeights" || !errors.Is(err, ErrInvalidScheme) {
+			t.Errorf("%v, %d required: expected the weights to be refused as an invalid scheme, got %v", tt.weights, tt.k, err)
+		}
+	}
+}
+
+// TestWeightedSchemeOTP checks that weights are refused with OTP sharing, under which every
+// collection would grow with the summed weights
+func TestWeightedSchemeOTP(t *testing.T) {
+	_, err := NewEncodeConfig(WithInput("in"), WithOutputs("out0", "out1", "out2"), WithWeights(1, 2, 2), WithScheme(2, 3),
+		WithSharing(pad.OTP))
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || configErr.Option != "WithWeights" || !errors.Is(err, ErrInvalidScheme) {
+		t.Errorf("Expected weights with OTP sharing to be refused as an invalid scheme, got %v", err)
+	}
+}
+
+// TestWeightedSizes checks that each output directory holds a share of the encoded data in
+// proportion to its weight, with every collection about the size of the data
+func TestWeightedSizes(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	content := make([]byte, 256<<10)
+	rand.Read(content)
+	writeFiles(t, inputDir, map[string]string{"a.bin": string(content)})
+
+	weights := []int{1, 2, 2}
+	dirs := []string{filepath.Join(tempDir, "small"), filepath.Join(tempDir, "large1"), filepath.Join(tempDir, "large2")}
+	cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(dirs...), WithWeights(weights...), WithScheme(2, 3),
+		WithFormat(FormatBin), WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	for i, dir := range dirs {
+		var size int64
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				size += info.Size()
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Failed to walk %s: %v", dir, err)
+		}
+		perWeight := float64(size) / float64(weights[i])
+		if perWeight < float64(len(content)) || perWeight > 1.25*float64(len(content)) {
+			t.Errorf("Expected %s to hold about %d times the %d bytes of data, got %d bytes", dir, weights[i], len(content), size)
+		}
+	}
+}
+
+// TestWeightedRoundTrip checks that output directories receive as many collections as their
+// weights, and that any K of them restore the data
+func TestWeightedRoundTrip(t *testing.T) {
+	os.Setenv("GO_TEST", "1")
+	defer os.Unsetenv("GO_TEST")
+
+	ctx := trace.WithContext(context.Background(), trace.NewTracer("TEST", trace.LogLevelNormal))
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "input")
+	writeFiles(t, inputDir, map[string]string{"a.txt": "weighted"})
+
+	dirs := []string{filepath.Join(tempDir, "small"), filepath.Join(tempDir, "large1"), filepath.Join(tempDir, "large2")}
+	var result Result
+	cfg, err := NewEncodeConfig(WithInput(inputDir), WithOutputs(dirs...), WithWeights(1, 2, 2), WithScheme(2, 3),
+		WithFormat(FormatBin), WithRNG(pad.NewDefaultRand(ctx)))
+	if err != nil {
+		t.Fatalf("NewEncodeConfig failed: %v", err)
+	}
+	cfg.Result = &result
+	if err := EncodeDirectory(ctx, cfg); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if result.Copies != 5 || result.Required != 3 {
+		t.Errorf("Expected a 3-of-5 scheme, got %d-of-%d", result.Required, result.Copies)
+	}
+	for i, want := range []int{1, 2, 2} {
+		collections, _, err := file.FindCollections(ctx, dirs[i])
+		if err != nil || len(collections) != want {
+			t.Errorf("Expected %d collections in %s, got %d (%v)", want, dirs[i], len(collections), err)
+		}
+	}
+
+	// Any two of the output directories restore the data, the smallest included
+	for _, pair := range [][]string{{dirs[0], dirs[1]}, {dirs[0], dirs[2]}, {dirs[1], dirs[2]}} {
+		decodeDir := filepath.Join(tempDir, "decoded-"+filepath.Base(pair[0])+"-"+filepath.Base(pair[1]))
+		decodeCfg, err := NewDecodeConfig(WithInputs(pair...), WithOutput(decodeDir))
+		if err != nil {
+			t.Fatalf("NewDecodeConfig failed: %v", err)
+		}
+		if err := DecodeDirectory(ctx, decodeCfg); err != nil {
+			t.Fatalf("Failed to decode from %v: %v", pair, err)
+		}
+		if got, err := os.ReadFile(filepath.Join(decodeDir, "a.txt")); err != nil || string(got) != "weighted" {
+			t.Errorf("Expected the data to be restored from %v, got %q (%v)", pair, got, err)
+		}
+	}
+}